@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Credential sources reported in the startup log instead of the credentials.
+const (
+	authSourceFlag  = "flag"
+	authSourceStdin = "stdin"
+	authSourceFile  = "file"
+	authSourceEnv   = "env"
+)
+
+// resolveAuthCredentials picks the user:password credentials to serve with.
+// An explicit -a/--auth wins, then --auth-file-creds, then GOFS_AUTH (which is
+// the flag's default value). The value "-" reads one line from stdin. It
+// returns the credentials and where they came from, or "" when auth is off.
+func resolveAuthCredentials(flagValue string, flagSet bool, file string, stdin io.Reader,
+	warn io.Writer,
+) (string, string, error) {
+	switch {
+	case flagSet && file != "":
+		return "", "", errors.New("use either --auth or --auth-file-creds, not both")
+	case flagSet && flagValue == "-":
+		creds, err := readCredentialsLine(stdin)
+		return creds, authSourceStdin, err
+	case flagSet:
+		return flagValue, authSourceFlag, nil
+	case file != "":
+		creds, err := readCredentialsFile(file, warn)
+		return creds, authSourceFile, err
+	case flagValue == "-":
+		creds, err := readCredentialsLine(stdin)
+		return creds, authSourceStdin, err
+	case flagValue != "":
+		return flagValue, authSourceEnv, nil
+	}
+	return "", "", nil
+}
+
+// readCredentialsFile reads credentials from the first line of path, warning
+// when the file is readable by group or others.
+func readCredentialsFile(path string, warn io.Writer) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("reading credentials file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("reading credentials file: %s is a directory", path)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		fmt.Fprintf(warn, "Warning: credentials file %s has permissions %04o; use 0600 or stricter\n",
+			path, info.Mode().Perm())
+	}
+
+	f, err := os.Open(path) // #nosec G304 - path chosen by the operator
+	if err != nil {
+		return "", fmt.Errorf("reading credentials file: %w", err)
+	}
+	defer f.Close()
+
+	creds, err := readCredentialsLine(f)
+	if err != nil {
+		return "", fmt.Errorf("reading credentials file %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// readCredentialsLine returns the first line of r without its line ending.
+func readCredentialsLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	creds := strings.TrimRight(line, "\r\n")
+	if creds == "" {
+		return "", errors.New("no credentials provided")
+	}
+	return creds, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeCredentialsFile(t *testing.T, content string, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "creds")
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatalf("Failed to write credentials file: %v", err)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatalf("Failed to chmod credentials file: %v", err)
+	}
+	return path
+}
+
+func TestReadCredentialsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", content: "admin:secret", want: "admin:secret"},
+		{name: "trailing newline", content: "admin:secret\n", want: "admin:secret"},
+		{name: "crlf and extra lines", content: "admin:s3:cret\r\nignored\n", want: "admin:s3:cret"},
+		{name: "empty", content: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeCredentialsFile(t, tt.content, 0o600)
+			var warn bytes.Buffer
+			got, err := readCredentialsFile(path, &warn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if warn.Len() != 0 {
+				t.Errorf("unexpected warning for 0600 file: %s", warn.String())
+			}
+		})
+	}
+
+	if _, err := readCredentialsFile(filepath.Join(t.TempDir(), "missing"), &bytes.Buffer{}); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestReadCredentialsFile_PermissionWarning(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on Windows")
+	}
+
+	path := writeCredentialsFile(t, "admin:secret\n", 0o644)
+	var warn bytes.Buffer
+	got, err := readCredentialsFile(path, &warn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "admin:secret" {
+		t.Errorf("expected credentials to still be read, got %q", got)
+	}
+	if !strings.Contains(warn.String(), "0644") || strings.Contains(warn.String(), "secret") {
+		t.Errorf("unexpected warning: %q", warn.String())
+	}
+}
+
+func TestResolveAuthCredentials(t *testing.T) {
+	file := writeCredentialsFile(t, "fileuser:filepass\n", 0o600)
+
+	tests := []struct {
+		name       string
+		flagValue  string
+		flagSet    bool
+		file       string
+		stdin      string
+		want       string
+		wantSource string
+		wantErr    bool
+	}{
+		{name: "disabled"},
+		{name: "explicit flag", flagValue: "flag:pass", flagSet: true, want: "flag:pass", wantSource: authSourceFlag},
+		{name: "stdin via flag", flagValue: "-", flagSet: true, stdin: "in:pass\n", want: "in:pass",
+			wantSource: authSourceStdin},
+		{name: "empty stdin", flagValue: "-", flagSet: true, stdin: "", wantErr: true},
+		{name: "file", file: file, want: "fileuser:filepass", wantSource: authSourceFile},
+		{name: "file overrides env", flagValue: "env:pass", file: file, want: "fileuser:filepass",
+			wantSource: authSourceFile},
+		{name: "env", flagValue: "env:pass", want: "env:pass", wantSource: authSourceEnv},
+		{name: "env stdin", flagValue: "-", stdin: "in:pass", want: "in:pass", wantSource: authSourceStdin},
+		{name: "flag and file conflict", flagValue: "flag:pass", flagSet: true, file: file, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, source, err := resolveAuthCredentials(tt.flagValue, tt.flagSet, tt.file,
+				strings.NewReader(tt.stdin), &bytes.Buffer{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want || source != tt.wantSource {
+				t.Errorf("expected (%q, %q), got (%q, %q)", tt.want, tt.wantSource, got, source)
+			}
+		})
+	}
+}
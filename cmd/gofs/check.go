@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/handler"
+	"github.com/samzong/gofs/internal/server"
+)
+
+// configReport is what --check-config prints: whether the configuration is
+// valid and what gofs would serve with it.
+type configReport struct {
+	Valid    bool            `json:"valid"`
+	Errors   []string        `json:"errors,omitempty"`
+	Version  string          `json:"version"`
+	Listen   string          `json:"listen,omitempty"` // host:port the server would bind
+	URLs     []string        `json:"urls,omitempty"`
+	Theme    string          `json:"theme,omitempty"`
+	Auth     *authReport     `json:"auth,omitempty"`
+	Mounts   []mountReport   `json:"mounts,omitempty"`
+	Features map[string]bool `json:"features,omitempty"`
+}
+
+type authReport struct {
+	Mode   string `json:"mode"`
+	Source string `json:"source,omitempty"` // Where the credentials come from, never the credentials
+}
+
+type mountReport struct {
+	Path     string `json:"path"`
+	Dir      string `json:"dir"`
+	Name     string `json:"name,omitempty"`
+	Readonly bool   `json:"readonly"`
+	Quota    int64  `json:"quota,omitempty"`
+	AliasOf  string `json:"aliasOf,omitempty"`
+	Error    string `json:"error,omitempty"` // Why the directory cannot be served
+}
+
+// checkConfig validates the configuration flags describe the way serve
+// does, without binding a port, and writes a JSON report to stdout. It
+// returns the process exit code: 0 when gofs would start, 1 otherwise.
+func checkConfig(flags *cmdFlags, stdin io.Reader, stdout, stderr io.Writer) int {
+	report := validateConfig(flags, stdin, stderr)
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fmt.Fprintf(stderr, "Cannot write the report: %v\n", err)
+		return 1
+	}
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// validateConfig runs every step serve takes before listening and reports
+// the first one that fails along with any mount that cannot be served.
+func validateConfig(flags *cmdFlags, stdin io.Reader, stderr io.Writer) configReport {
+	report := configReport{Version: version}
+	fail := func(err error) configReport {
+		report.Errors = append(report.Errors, startupErrorMessage(err))
+		return report
+	}
+
+	cfg, err := buildConfig(flags)
+	if err != nil {
+		return fail(err)
+	}
+	if flags.Theme != "" && cfg.Theme != flags.Theme {
+		// config.New falls back to the default theme, serve only warns
+		return fail(fmt.Errorf("unknown theme %q, supported themes: default, advanced", flags.Theme))
+	}
+	credentials, authSource, err := resolveAuthCredentials(flags.Auth, flags.AuthSet, flags.AuthFile, stdin, stderr)
+	if err != nil {
+		return fail(authError{err})
+	}
+	built, err := buildServer(cfg, flags, credentials, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		return fail(err)
+	}
+	for _, dir := range []string{cfg.ArchiveCacheDir, cfg.VersionsDir, cfg.ScrubDir} {
+		if err := checkWritable(dir); err != nil {
+			return fail(err)
+		}
+	}
+
+	report.Listen = cfg.Address()
+	report.URLs = []string{built.primaryURL}
+	if access := handler.Access(cfg); flags.Share == "" && len(access.URLs) > 0 {
+		report.URLs = access.URLs
+	}
+	report.Theme = cfg.Theme
+	report.Auth = &authReport{Mode: cfg.AuthMode, Source: authSource}
+	report.Features = map[string]bool{
+		"webdav":                cfg.EnableWebDAV,
+		"tree":                  cfg.EnableTree,
+		"restWrite":             cfg.EnableRESTWrite,
+		"userUploadDirs":        cfg.UserUploadDirs,
+		"uploadScan":            cfg.UploadScanCmd != "" || cfg.UploadScanURL != "",
+		"manifests":             cfg.WriteManifests,
+		"versions":              cfg.VersionsDir != "",
+		"scrub":                 cfg.ScrubInterval > 0,
+		"archiveCache":          cfg.ArchiveCacheDir != "",
+		"hotCache":              cfg.HotCacheSize > 0,
+		"dirConfig":             cfg.DirConfig,
+		"acme":                  len(cfg.ACMEDomains) > 0,
+		"share":                 flags.Share != "",
+		"allowIndexing":         cfg.AllowIndexing,
+		"wellKnownDir":          cfg.WellKnownDir != "",
+		"caseInsensitiveRoutes": cfg.CaseInsensitiveRoutes,
+		"tracing":               cfg.OTelEndpoint != "",
+		"snapshot":              cfg.Snapshot,
+		"readonly":              cfg.Readonly,
+		"blockSensitive":        cfg.BlockSensitive,
+		"events":                cfg.Theme == "advanced" && cfg.WatchMode != config.WatchOff,
+	}
+	for _, mount := range cfg.Dirs {
+		m := mountReport{
+			Path:     mount.Path,
+			Dir:      mount.Dir,
+			Name:     mount.Name,
+			Readonly: mount.Readonly,
+			Quota:    mount.Quota,
+			AliasOf:  mount.AliasOf,
+		}
+		if flags.Share == "" && !mount.IsRemote() {
+			m.Error = server.CheckMount(mount.Dir)
+		}
+		if m.Error != "" && !cfg.SkipDirCheck {
+			report.Errors = append(report.Errors, fmt.Sprintf("Configuration error: mount %s (%s): %s",
+				mount.Path, mount.Dir, m.Error))
+		}
+		report.Mounts = append(report.Mounts, m)
+	}
+	report.Valid = len(report.Errors) == 0
+	return report
+}
+
+// checkWritable reports whether files can be created in dir; "" needs no
+// check.
+func checkWritable(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	probe, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
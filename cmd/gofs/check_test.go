@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+)
+
+// defaultFlags returns the flags of "gofs -d dir ..." with no environment.
+func defaultFlags(dirs ...string) *cmdFlags {
+	return &cmdFlags{
+		Port:                 8000,
+		Host:                 "127.0.0.1",
+		Dirs:                 dirs,
+		Theme:                "default",
+		AuthMode:             "all",
+		WebDAVPrefix:         config.DefaultWebDAVPrefix,
+		MaxConcurrentUploads: constants.DefaultMaxConcurrentUploads,
+		UploadLockWait:       constants.DefaultUploadLockWait,
+		WatchMode:            config.WatchAuto,
+		MaxPathDepth:         constants.DefaultMaxPathDepth,
+		MaxNameLength:        constants.DefaultMaxNameLength,
+		PollInterval:         constants.DefaultPollInterval,
+		ArchiveCacheSize:     "10GB",
+		ExtractMaxSize:       "1GB",
+		ScrubRate:            constants.DefaultScrubRate,
+		HotCacheSize:         "0",
+		HotCacheMaxFileSize:  "64KB",
+		MaxRequestBody:       "1MB",
+		MaxUploadSize:        "100MB",
+		MaxHashSize:          "100MB",
+		DigestHeaders:        true,
+		MaxHeaderSize:        "32KB",
+		DenyPaths:            config.DefaultDenyPaths,
+	}
+}
+
+func runCheckConfig(t *testing.T, flags *cmdFlags) (configReport, int) {
+	t.Helper()
+	var stdout bytes.Buffer
+	code := checkConfig(flags, strings.NewReader(""), &stdout, io.Discard)
+	var report configReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Report is not JSON: %v\n%s", err, stdout.String())
+	}
+	return report, code
+}
+
+func TestCheckConfig_Valid(t *testing.T) {
+	root := t.TempDir()
+	flags := defaultFlags("/files:" + root + ":ro:Files")
+	flags.Theme = "advanced"
+	flags.Auth = "alice:secret"
+	flags.AuthSet = true
+	flags.EnableWebDAV = true
+	flags.VersionsDir = filepath.Join(t.TempDir(), "versions")
+
+	report, code := runCheckConfig(t, flags)
+	if code != 0 || !report.Valid || len(report.Errors) != 0 {
+		t.Fatalf("Expected a valid configuration, got %d %+v", code, report)
+	}
+	if report.Listen != "127.0.0.1:8000" || len(report.URLs) != 1 || report.URLs[0] != "http://127.0.0.1:8000/" {
+		t.Errorf("Unexpected addresses %q %v", report.Listen, report.URLs)
+	}
+	if report.Theme != "advanced" || report.Auth == nil || report.Auth.Mode != "all" ||
+		report.Auth.Source != authSourceFlag {
+		t.Errorf("Unexpected theme or auth %q %+v", report.Theme, report.Auth)
+	}
+	if len(report.Mounts) != 1 || report.Mounts[0].Path != "/files" || report.Mounts[0].Dir != root ||
+		!report.Mounts[0].Readonly || report.Mounts[0].Name != "Files" {
+		t.Errorf("Unexpected mounts %+v", report.Mounts)
+	}
+	if !report.Features["webdav"] || !report.Features["versions"] || report.Features["scrub"] {
+		t.Errorf("Unexpected features %v", report.Features)
+	}
+	if strings.Contains(report.Auth.Source, "secret") {
+		t.Error("Report must not contain the credentials")
+	}
+}
+
+func TestCheckConfig_Invalid(t *testing.T) {
+	root := t.TempDir()
+	credsFile := filepath.Join(t.TempDir(), "creds")
+	if err := os.WriteFile(credsFile, []byte("no-colon\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(f *cmdFlags)
+		want   string
+	}{
+		{"missing mount", func(f *cmdFlags) { f.Dirs = []string{filepath.Join(root, "missing")} }, "Configuration error"},
+		{"bad size", func(f *cmdFlags) { f.HotCacheSize = "lots" }, "--hot-cache-size"},
+		{"zero upload size", func(f *cmdFlags) { f.MaxUploadSize = "0" }, "--max-upload-size"},
+		{"zero extract size", func(f *cmdFlags) { f.ExtractMaxSize = "0" }, "--extract-max-size"},
+		{"negative lock wait", func(f *cmdFlags) { f.UploadLockWait = -time.Second }, "--upload-lock-wait"},
+		{"negative path depth", func(f *cmdFlags) { f.MaxPathDepth = -1 }, "--max-path-depth"},
+		{"unknown watch mode", func(f *cmdFlags) { f.WatchMode = "inotify" }, "--watch-mode"},
+		{"zero poll interval", func(f *cmdFlags) { f.PollInterval = 0 }, "--poll-interval"},
+		{"unknown default mount", func(f *cmdFlags) { f.DefaultMount = "/nowhere" }, "--default-mount"},
+		{"bad hash size", func(f *cmdFlags) { f.MaxHashSize = "-1MB" }, "--max-hash-size"},
+		{"bad download size", func(f *cmdFlags) { f.MaxDownloadSize = "2 gigs" }, "--max-download-size"},
+		{"unknown theme", func(f *cmdFlags) { f.Theme = "fancy" }, `unknown theme "fancy"`},
+		{"log path mode", func(f *cmdFlags) { f.LogPathMode = "redacted" }, "--log-path-mode"},
+		{"rest write without auth", func(f *cmdFlags) {
+			f.Theme = "advanced"
+			f.EnableRESTWrite = true
+		}, "--enable-rest-write needs --auth"},
+		{"bad credentials", func(f *cmdFlags) { f.AuthFile = credsFile }, "Authentication error"},
+		{"auth mode", func(f *cmdFlags) {
+			f.Auth = "alice:secret"
+			f.AuthSet = true
+			f.AuthMode = "sometimes"
+		}, "Authentication error"},
+		{"cache dir is a file", func(f *cmdFlags) { f.ArchiveCacheDir = credsFile }, "archive cache"},
+		{"scrub without dir", func(f *cmdFlags) { f.ScrubInterval = 1 }, "--scrub-interval needs --scrub-dir"},
+		{"mounts differing in case", func(f *cmdFlags) {
+			f.Dirs = []string{"/docs:" + root, "/Docs:" + root}
+			f.CaseInsensitiveRoutes = true
+		}, "--case-insensitive-routes"},
+		{"otel endpoint without scheme", func(f *cmdFlags) { f.OTelEndpoint = "collector:4318" }, "--otel-endpoint"},
+		{"snapshot with webdav", func(f *cmdFlags) {
+			f.Snapshot = true
+			f.EnableWebDAV = true
+		}, "--snapshot cannot be combined"},
+		{"sensitive pattern with slash", func(f *cmdFlags) {
+			f.SensitivePatterns = []string{"keys/*.pem"}
+		}, "sensitive pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := defaultFlags(root)
+			tt.modify(flags)
+			report, code := runCheckConfig(t, flags)
+			if code != 1 || report.Valid {
+				t.Fatalf("Expected an invalid configuration, got %d %+v", code, report)
+			}
+			if len(report.Errors) == 0 || !strings.Contains(strings.Join(report.Errors, "\n"), tt.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.want, report.Errors)
+			}
+		})
+	}
+}
+
+func TestCheckConfig_SkipDirCheck(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	flags := defaultFlags(missing)
+	flags.SkipDirCheck = true
+
+	report, code := runCheckConfig(t, flags)
+	if code != 0 || !report.Valid {
+		t.Fatalf("Expected --skip-dir-check to accept a missing mount, got %d %+v", code, report)
+	}
+	if len(report.Mounts) != 1 || report.Mounts[0].Error != "missing" {
+		t.Errorf("Expected the mount to be reported missing, got %+v", report.Mounts)
+	}
+}
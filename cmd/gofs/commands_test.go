@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/handler"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// newTestServer serves a temporary directory with the real handler for theme,
+// optionally wrapped in middleware.
+func newTestServer(t *testing.T, theme string, wrap ...func(http.Handler) http.Handler) (*httptest.Server, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "hello.txt"), []byte("hello world"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	cfg := &config.Config{Theme: theme, MaxHashSize: 1 << 20, RequestTimeout: 30}
+	fs := filesystem.NewLocal(root, false)
+	var h http.Handler = handler.NewFile(fs, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if theme == "advanced" {
+		h = handler.NewAdvancedFile(fs, cfg)
+	}
+	for _, mw := range wrap {
+		h = mw(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, root
+}
+
+func runCommand(t *testing.T, name string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := runClientCommand(name, args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestClientCommand_Ls(t *testing.T) {
+	srv, _ := newTestServer(t, "default")
+
+	code, out, errOut := runCommand(t, "ls", srv.URL)
+	if code != exitOK {
+		t.Fatalf("expected exit 0, got %d: %s", code, errOut)
+	}
+	if !strings.Contains(out, "docs/") || !strings.Contains(out, "hello.txt") {
+		t.Errorf("unexpected listing:\n%s", out)
+	}
+
+	code, out, _ = runCommand(t, "ls", "--json", srv.URL)
+	if code != exitOK {
+		t.Fatalf("expected exit 0, got %d", code)
+	}
+	var items []struct {
+		Name  string `json:"name"`
+		Size  int64  `json:"size"`
+		IsDir bool   `json:"isDir"`
+	}
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if len(items) != 2 || items[0].Name != "docs" || !items[0].IsDir || items[1].Size != 11 {
+		t.Errorf("unexpected items: %+v", items)
+	}
+
+	if code, _, _ := runCommand(t, "ls", srv.URL+"/missing"); code != exitError {
+		t.Errorf("expected exit 1 for missing directory, got %d", code)
+	}
+	if code, _, _ := runCommand(t, "ls"); code != exitUsage {
+		t.Errorf("expected exit 2 without URL, got %d", code)
+	}
+}
+
+func TestClientCommand_Get(t *testing.T) {
+	srv, _ := newTestServer(t, "default")
+	dest := filepath.Join(t.TempDir(), "out.txt")
+
+	code, _, errOut := runCommand(t, "get", srv.URL+"/hello.txt", dest)
+	if code != exitOK {
+		t.Fatalf("expected exit 0, got %d: %s", code, errOut)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "hello world" {
+		t.Errorf("unexpected content %q", data)
+	}
+
+	head, err := http.Head(srv.URL + "/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head.Body.Close()
+	etag := head.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected the server to send an ETag")
+	}
+
+	// An interrupted download is resumed from the .part file
+	resumeDest := writePartial(t, "hello", etag)
+	code, out, errOut := runCommand(t, "get", "--json", srv.URL+"/hello.txt", resumeDest)
+	if code != exitOK {
+		t.Fatalf("expected exit 0, got %d: %s", code, errOut)
+	}
+	if data, _ := os.ReadFile(resumeDest); string(data) != "hello world" {
+		t.Errorf("unexpected resumed content %q", data)
+	}
+	var result struct {
+		Size    int64 `json:"size"`
+		Resumed bool  `json:"resumed"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil || !result.Resumed || result.Size != 11 {
+		t.Errorf("unexpected JSON output %q (%v)", out, err)
+	}
+	for _, leftover := range []string{resumeDest + ".part", resumeDest + ".part.etag"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be gone", leftover)
+		}
+	}
+
+	// A partial file of another version, or without its ETag, or longer
+	// than the file, is downloaded again whole
+	for _, tt := range []struct{ content, etag string }{
+		{"HELLO", `"other"`},
+		{"hello", ""},
+		{"hello world, and more", etag},
+	} {
+		dest := writePartial(t, tt.content, tt.etag)
+		code, out, errOut := runCommand(t, "get", "--json", srv.URL+"/hello.txt", dest)
+		if code != exitOK {
+			t.Fatalf("%q: expected exit 0, got %d: %s", tt.content, code, errOut)
+		}
+		if data, _ := os.ReadFile(dest); string(data) != "hello world" {
+			t.Errorf("%q: unexpected content %q", tt.content, data)
+		}
+		if err := json.Unmarshal([]byte(out), &result); err != nil || result.Resumed {
+			t.Errorf("%q: expected a whole download, got %q (%v)", tt.content, out, err)
+		}
+	}
+
+	// A partial file holding the whole file is complete
+	dest = writePartial(t, "hello world", etag)
+	if code, out, _ := runCommand(t, "get", "--json", srv.URL+"/hello.txt", dest); code != exitOK ||
+		json.Unmarshal([]byte(out), &result) != nil || !result.Resumed || result.Size != 11 {
+		t.Errorf("expected the complete partial file to be kept, got %d %q", code, out)
+	}
+
+	if code, _, _ := runCommand(t, "get", srv.URL+"/missing.txt", dest); code != exitError {
+		t.Errorf("expected exit 1 for missing file, got %d", code)
+	}
+}
+
+// writePartial leaves an interrupted download of content, fetched with etag,
+// in a temporary directory and returns its destination.
+func writePartial(t *testing.T, content, etag string) string {
+	t.Helper()
+	dest := filepath.Join(t.TempDir(), "resume.txt")
+	if err := os.WriteFile(dest+".part", []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write partial file: %v", err)
+	}
+	if etag != "" {
+		if err := os.WriteFile(dest+".part.etag", []byte(etag+"\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write ETag file: %v", err)
+		}
+	}
+	return dest
+}
+
+func TestClientCommand_Upload(t *testing.T) {
+	srv, root := newTestServer(t, "advanced")
+	src := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(src, []byte("a,b\n1,2\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	code, out, errOut := runCommand(t, "upload", "--json", src, srv.URL)
+	if code != exitOK {
+		t.Fatalf("expected exit 0, got %d: %s", code, errOut)
+	}
+	var resp handler.UploadResponse
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if !resp.Success || !strings.HasPrefix(resp.Checksum, "sha256:") {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "report.csv")); string(data) != "a,b\n1,2\n" {
+		t.Errorf("unexpected uploaded content %q", data)
+	}
+
+	if code, _, _ := runCommand(t, "upload", filepath.Join(root, "nope"), srv.URL); code != exitError {
+		t.Errorf("expected exit 1 for missing source file, got %d", code)
+	}
+	if code, _, _ := runCommand(t, "upload", src); code != exitUsage {
+		t.Errorf("expected exit 2 without URL, got %d", code)
+	}
+}
+
+func TestClientCommand_Auth(t *testing.T) {
+	auth, err := middleware.NewBasicAuthFromCredentials("admin:secret")
+	if err != nil {
+		t.Fatalf("Failed to create auth: %v", err)
+	}
+	srv, _ := newTestServer(t, "default", auth.Middleware)
+
+	if code, _, _ := runCommand(t, "ls", srv.URL); code != exitError {
+		t.Errorf("expected exit 1 without credentials, got %d", code)
+	}
+
+	t.Setenv("GOFS_AUTH", "admin:secret")
+	if code, _, errOut := runCommand(t, "ls", srv.URL); code != exitOK {
+		t.Errorf("expected GOFS_AUTH to be honored, got %d: %s", code, errOut)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,10 +18,14 @@ import (
 	"time"
 
 	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
 	"github.com/samzong/gofs/internal/filesystem"
 	"github.com/samzong/gofs/internal/handler"
 	"github.com/samzong/gofs/internal/middleware"
 	"github.com/samzong/gofs/internal/server"
+	"github.com/samzong/gofs/internal/tracing"
+	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/qrcode"
 )
 
 var (
@@ -28,6 +34,22 @@ var (
 )
 
 func main() {
+	// Bare "gofs" and "gofs [options]" are equivalent to "gofs serve"
+	if len(os.Args) > 1 {
+		switch name := os.Args[1]; {
+		case name == "serve":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case name == "tree":
+			os.Args = append([]string{os.Args[0], "--print-tree"}, os.Args[2:]...)
+		case clientCommands[name] != nil:
+			os.Exit(runClientCommand(name, os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
+	serve()
+}
+
+func serve() {
 	flags := parseFlags()
 
 	if flags.Help {
@@ -47,32 +69,400 @@ func main() {
 		os.Exit(0)
 	}
 
-	cfg, err := config.New(flags.Port, flags.Host, "", flags.Theme, flags.ShowHidden, flags.Dirs)
+	if flags.CheckConfig {
+		os.Exit(checkConfig(flags, os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	if flags.PrintTree {
+		os.Exit(printTree(flags, os.Stdout, os.Stderr))
+	}
+
+	cfg, err := buildConfig(flags)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
 		os.Exit(1)
 	}
-	cfg.EnableWebDAV = flags.EnableWebDAV
+	credentials, authSource, err := resolveAuthCredentials(flags.Auth, flags.AuthSet, flags.AuthFile,
+		os.Stdin, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Authentication error: %v\n", err)
+		os.Exit(1)
+	}
 
 	logger := setupLogger()
-	logStartupInfo(logger, cfg, flags.Auth != "")
+	if cfg.OTelEndpoint != "" {
+		// Log lines of traced requests carry their trace and span IDs; the
+		// default logger is replaced too, for the handlers that use it
+		logger = slog.New(tracing.NewLogHandler(logger.Handler()))
+		slog.SetDefault(logger)
+	}
+	logStartupInfo(logger, cfg, authSource)
+	if flags.Share == "" {
+		logAccess(logger, cfg)
+		warnSensitive(logger, cfg)
+	}
+	if cfg.DebugErrors {
+		logger.Warn("Verbose error responses enabled; do not use --debug-errors in production")
+	}
+
+	built, err := buildServer(cfg, flags, credentials, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, startupErrorMessage(err))
+		os.Exit(1)
+	}
+	srv := built.server
+	if flags.QR {
+		if err := printQR(os.Stdout, built.primaryURL); err != nil {
+			logger.Warn("Cannot show a QR code", slog.String("url", built.primaryURL), slog.String("error", err.Error()))
+		}
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if cfg.WriteManifests {
+		startManifestWriters(jobsCtx, cfg, logger)
+	}
+	if built.versions != nil {
+		go built.versions.Run(jobsCtx, constants.VersionsPruneInterval)
+	}
+	if built.scrubber != nil {
+		built.scrubber.SetBusy(func() bool { return srv.InFlight() >= constants.ScrubBusyRequests })
+		go built.scrubber.Run(jobsCtx, cfg.ScrubInterval)
+	}
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+
+	if code := runServer(srv, cfg, shutdown, stopJobs, logger); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// buildConfig turns the command line into a validated configuration. It
+// reads the files the flags name but starts nothing.
+func buildConfig(flags *cmdFlags) (*config.Config, error) {
+	cfg, err := config.New(flags.Port, flags.Host, "", flags.Theme, flags.ShowHidden, flags.Dirs,
+		config.WithSkipDirCheck(flags.SkipDirCheck))
+	if err != nil {
+		return nil, err
+	}
+	cfg.EnableWebDAV = flags.EnableWebDAV
+	cfg.WebDAVFakeLocks = flags.WebDAVFakeLocks
+	if cfg.WebDAVPrefix, err = config.ParseWebDAVPrefix(flags.WebDAVPrefix); err != nil {
+		return nil, fmt.Errorf("--webdav-prefix: %w", err)
+	}
+	cfg.Version = version
+	cfg.DebugErrors = flags.DebugErrors
+	cfg.ShowPrecompressed = flags.ShowPrecompressed
+	cfg.MaxConcurrentUploads = flags.MaxConcurrentUploads
+	if flags.UploadLockWait < 0 {
+		return nil, errors.New("--upload-lock-wait cannot be negative")
+	}
+	cfg.UploadLockWait = flags.UploadLockWait
+	cfg.WriteManifests = flags.WriteManifests
+	cfg.BehindTLSProxy = flags.BehindTLSProxy
+	cfg.HSTSMaxAge = flags.HSTSMaxAge
+	cfg.HSTSIncludeSubDomains = flags.HSTSIncludeSubDomains
+	cfg.XSSProtection = flags.XSSProtection
+	cfg.PermissionsPolicy = flags.PermissionsPolicy
+	cfg.EnableTree = flags.EnableTree
+	if flags.Readonly {
+		cfg.Readonly = true
+		// Also keeps --write-manifests from writing into the mounts
+		for i := range cfg.Dirs {
+			cfg.Dirs[i].Readonly = true
+		}
+	}
+	cfg.EnableRESTWrite = flags.EnableRESTWrite
+	if cfg.EnableRESTWrite && cfg.Theme != "advanced" {
+		return nil, errors.New("--enable-rest-write needs --theme advanced")
+	}
+	cfg.UserUploadDirs = flags.UserUploadDirs
+	if err := config.CheckWatch(flags.WatchMode, flags.PollInterval); err != nil {
+		return nil, err
+	}
+	cfg.WatchMode = flags.WatchMode
+	cfg.PollInterval = flags.PollInterval
+	if cfg.UserUploadDirs && cfg.Theme != "advanced" {
+		return nil, errors.New("--user-upload-dirs needs --theme advanced")
+	}
+	if err := config.CheckUploadScan(flags.UploadScanCmd, flags.UploadScanURL); err != nil {
+		return nil, err
+	}
+	cfg.UploadScanCmd = flags.UploadScanCmd
+	cfg.UploadScanURL = flags.UploadScanURL
+	cfg.UploadScanTimeout = flags.UploadScanTimeout
+	if err := config.CheckOTelEndpoint(flags.OTelEndpoint); err != nil {
+		return nil, err
+	}
+	cfg.OTelEndpoint = flags.OTelEndpoint
+	if err := config.CheckLogPathMode(flags.LogPathMode); err != nil {
+		return nil, err
+	}
+	cfg.LogPathMode = flags.LogPathMode
+	cfg.LogPathKey = flags.LogPathKey
+	cfg.ZipMaxDepth = flags.ZipMaxDepth
+	cfg.ZipMaxEntries = flags.ZipMaxEntries
+	cfg.ZipCollectTimeout = flags.ZipCollectTimeout
+	cfg.MaxConcurrentZips = flags.MaxConcurrentZips
+	cfg.ZipQueueTimeout = flags.ZipQueueTimeout
+	cfg.ArchiveCacheDir = flags.ArchiveCacheDir
+	cfg.DirConfig = flags.DirConfig
+	if cfg.ArchiveCacheSize, err = fileutil.ParseSize(flags.ArchiveCacheSize); err != nil {
+		return nil, fmt.Errorf("--archive-cache-size: %w", err)
+	}
+	if cfg.CacheControl, err = config.ParseCacheControlRules(flags.CacheControl); err != nil {
+		return nil, err
+	}
+	if cfg.CacheControlDefault, err = config.ParseCacheControlDirective(flags.CacheControlDefault); err != nil {
+		return nil, fmt.Errorf("--cache-control-default: %w", err)
+	}
+	if cfg.HotCacheSize, err = fileutil.ParseSize(flags.HotCacheSize); err != nil {
+		return nil, fmt.Errorf("--hot-cache-size: %w", err)
+	}
+	if cfg.HotCacheMaxFileSize, err = fileutil.ParseSize(flags.HotCacheMaxFileSize); err != nil {
+		return nil, fmt.Errorf("--hot-cache-max-file-size: %w", err)
+	}
+	if cfg.MaxRequestBodySize, err = fileutil.ParseSize(flags.MaxRequestBody); err != nil {
+		return nil, fmt.Errorf("--max-request-body: %w", err)
+	}
+	if cfg.MaxUploadSize, err = fileutil.ParseLimit(flags.MaxUploadSize); err != nil {
+		return nil, fmt.Errorf("--max-upload-size: %w", err)
+	}
+	if cfg.MaxHashSize, err = fileutil.ParseLimit(flags.MaxHashSize); err != nil {
+		return nil, fmt.Errorf("--max-hash-size: %w", err)
+	}
+	cfg.DigestHeaders = flags.DigestHeaders
+	if cfg.ExtractMaxSize, err = fileutil.ParseLimit(flags.ExtractMaxSize); err != nil {
+		return nil, fmt.Errorf("--extract-max-size: %w", err)
+	}
+	cfg.ExtractMaxEntries = flags.ExtractMaxEntries
+	if flags.MaxDownloadSize != "" {
+		if cfg.MaxDownloadSize, err = fileutil.ParseLimit(flags.MaxDownloadSize); err != nil {
+			return nil, fmt.Errorf("--max-download-size: %w", err)
+		}
+	}
+	cfg.TrustProxy = flags.TrustProxy
+	if cfg.BaseURL, err = config.ParseBasePath(flags.BaseURL); err != nil {
+		return nil, fmt.Errorf("--base-url: %w", err)
+	}
+	if cfg.MimeTypes, err = config.LoadMimeTypes(flags.MimeTypesFile, flags.MimeTypes); err != nil {
+		return nil, err
+	}
+	if err := config.ApplyQuotas(cfg.Dirs, flags.Quotas); err != nil {
+		return nil, err
+	}
+	if err := config.ApplyRemoteAuth(cfg.Dirs, flags.RemoteAuth); err != nil {
+		return nil, err
+	}
+	if cfg.Dirs, err = config.ApplyAliases(cfg.Dirs, flags.Aliases); err != nil {
+		return nil, err
+	}
+	if cfg.DefaultMount, err = config.CheckDefaultMount(cfg.Dirs, flags.DefaultMount); err != nil {
+		return nil, err
+	}
+	if flags.CaseInsensitiveRoutes {
+		if err := config.CheckCaseInsensitiveMounts(cfg.Dirs); err != nil {
+			return nil, err
+		}
+		cfg.CaseInsensitiveRoutes = true
+	}
+	if len(flags.ACMEDomains) > 0 {
+		if cfg.ACMEDomains, err = config.ParseACMEDomains(flags.ACMEDomains); err != nil {
+			return nil, err
+		}
+		if cfg.Port == 80 {
+			return nil, errors.New("--acme-domain needs port 80 for HTTP; serve HTTPS on another port")
+		}
+		if err := config.CheckACMECacheDir(flags.ACMECacheDir, cfg.Dirs); err != nil {
+			return nil, err
+		}
+		cfg.ACMECacheDir = flags.ACMECacheDir
+	}
+	if cfg.TrustedOrigins, err = config.ParseTrustedOrigins(flags.TrustedOrigins); err != nil {
+		return nil, err
+	}
+	if flags.MaxURLLength < 0 || flags.MaxHeaderCount < 0 {
+		return nil, errors.New("--max-url-length and --max-header-count cannot be negative")
+	}
+	cfg.MaxURLLength = flags.MaxURLLength
+	cfg.MaxHeaderCount = flags.MaxHeaderCount
+	if flags.MaxPathDepth < 0 || flags.MaxNameLength < 0 {
+		return nil, errors.New("--max-path-depth and --max-name-length cannot be negative")
+	}
+	cfg.MaxPathDepth = flags.MaxPathDepth
+	cfg.MaxNameLength = flags.MaxNameLength
+	if cfg.MaxHeaderSize, err = fileutil.ParseSize(flags.MaxHeaderSize); err != nil {
+		return nil, fmt.Errorf("--max-header-size: %w", err)
+	}
+	if cfg.DenyPaths, err = config.ParseDenyPaths(flags.DenyPaths); err != nil {
+		return nil, err
+	}
+	if cfg.SensitivePatterns, err = config.ParseSensitivePatterns(flags.SensitivePatterns); err != nil {
+		return nil, err
+	}
+	cfg.BlockSensitive = flags.BlockSensitive
+	if flags.VersionsDir != "" {
+		if flags.VersionsMaxCount < 0 || flags.VersionsMaxAge < 0 {
+			return nil, errors.New("--versions-max-count and --versions-max-age cannot be negative")
+		}
+		if err := config.CheckVersionsDir(flags.VersionsDir, cfg.Dirs); err != nil {
+			return nil, err
+		}
+		cfg.VersionsDir = flags.VersionsDir
+		cfg.VersionsMaxCount = flags.VersionsMaxCount
+		cfg.VersionsMaxAge = flags.VersionsMaxAge
+	}
+	if flags.ScrubInterval < 0 {
+		return nil, errors.New("--scrub-interval cannot be negative")
+	}
+	if flags.ScrubInterval > 0 {
+		if flags.ScrubDir == "" {
+			return nil, errors.New("--scrub-interval needs --scrub-dir")
+		}
+		if err := config.CheckScrubDir(flags.ScrubDir, cfg.Dirs); err != nil {
+			return nil, err
+		}
+		if cfg.ScrubRate, err = fileutil.ParseSize(flags.ScrubRate); err != nil {
+			return nil, fmt.Errorf("--scrub-rate: %w", err)
+		}
+		cfg.ScrubInterval = flags.ScrubInterval
+		cfg.ScrubDir = flags.ScrubDir
+	}
+	if flags.Snapshot || flags.SnapshotFile != "" {
+		if cfg.EnableWebDAV {
+			return nil, errors.New("--snapshot cannot be combined with --enable-webdav")
+		}
+		if err := config.CheckSnapshot(flags.SnapshotFile, cfg.Dirs); err != nil {
+			return nil, err
+		}
+		cfg.Snapshot = true
+		cfg.SnapshotFile = flags.SnapshotFile
+		// A snapshot is read-only, which also keeps --write-manifests out of it
+		for i := range cfg.Dirs {
+			cfg.Dirs[i].Readonly = true
+		}
+	}
+	cfg.AllowIndexing = flags.AllowIndexing
+	cfg.WellKnownAuth = flags.WellKnownAuth
+	if flags.WellKnownDir != "" {
+		if err := config.CheckWellKnownDir(flags.WellKnownDir); err != nil {
+			return nil, err
+		}
+		cfg.WellKnownDir = flags.WellKnownDir
+	}
+	if flags.MaxRequests < 0 || flags.Timeout < 0 {
+		return nil, errors.New("--max-requests and --timeout cannot be negative")
+	}
+	cfg.MaxRequests = flags.MaxRequests
+	cfg.ShutdownAfter = flags.Timeout
+	if flags.Share != "" {
+		if cfg.EnableWebDAV || cfg.WriteManifests || cfg.ScrubInterval > 0 {
+			return nil, errors.New("--share cannot be combined with --enable-webdav, --write-manifests or --scrub-interval")
+		}
+		if cfg.MaxRequests == 0 {
+			cfg.MaxRequests = 1
+		}
+	}
+	cfg.AuthMode = "none"
+	return cfg, nil
+}
+
+// authError is a problem with the credentials, reported as an
+// authentication error rather than a configuration error.
+type authError struct{ err error }
+
+func (e authError) Error() string { return e.err.Error() }
+
+func (e authError) Unwrap() error { return e.err }
+
+// startupErrorMessage tells why the server could not be built.
+func startupErrorMessage(err error) string {
+	var authErr authError
+	if errors.As(err, &authErr) {
+		return "Authentication error: " + authErr.err.Error()
+	}
+	return "Configuration error: " + err.Error()
+}
+
+// app is a server ready to start, with the background jobs that run beside
+// it.
+type app struct {
+	server     *server.Server
+	versions   *handler.VersionStore
+	scrubber   *handler.Scrubber
+	primaryURL string // Where the files are reached, shown with --qr
+}
+
+// buildServer sets up everything cfg serves without binding a port:
+// authentication, the caches and stores on disk and the handlers.
+// credentials are the resolved user:password, "" when auth is off.
+func buildServer(cfg *config.Config, flags *cmdFlags, credentials string, logger *slog.Logger) (*app, error) {
+	if cfg.EnableRESTWrite && credentials == "" {
+		return nil, errors.New("--enable-rest-write needs --auth or --auth-file-creds")
+	}
 
 	var authMiddleware *middleware.BasicAuth
-	if flags.Auth != "" {
-		authMiddleware, err = middleware.NewBasicAuthFromCredentials(flags.Auth)
+	var err error
+	if credentials != "" {
+		authMiddleware, err = middleware.NewBasicAuthFromCredentials(credentials)
 		if err != nil {
 			logger.Error("Authentication setup failed", slog.Any("error", err))
-			fmt.Fprintf(os.Stderr, "Authentication error: %v\n", err)
-			os.Exit(1)
+			return nil, authError{err}
 		}
-		logger.Info("HTTP Basic Authentication enabled")
+		if err := authMiddleware.SetMode(flags.AuthMode); err != nil {
+			return nil, authError{err}
+		}
+		cfg.AuthMode = authMiddleware.Mode()
+		logger.Info("HTTP Basic Authentication enabled", slog.String("mode", cfg.AuthMode))
 	}
 
-	fileHandler := createFileHandler(cfg, logger)
+	a := &app{primaryURL: serverURL(cfg, "/")}
+	var archives *handler.ArchiveCache
+	if cfg.ArchiveCacheDir != "" {
+		if archives, err = handler.NewArchiveCache(cfg.ArchiveCacheDir, cfg.ArchiveCacheSize, logger); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.VersionsDir != "" {
+		a.versions, err = handler.NewVersionStore(cfg.VersionsDir, cfg.VersionsMaxCount, cfg.VersionsMaxAge, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ScrubInterval > 0 {
+		if a.scrubber, err = newScrubber(cfg, logger); err != nil {
+			return nil, err
+		}
+	}
+	var fileHandler http.Handler
+	if flags.Share != "" {
+		share, err := handler.NewShare(flags.Share, cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("--share: %w", err)
+		}
+		a.primaryURL = serverURL(cfg, share.URLPath())
+		logger.Info("Sharing a single file",
+			slog.String("file", flags.Share),
+			slog.String("url", a.primaryURL),
+		)
+		fileHandler = share
+	} else {
+		if fileHandler, err = createFileHandler(cfg, archives, a.versions, a.scrubber, logger); err != nil {
+			return nil, err
+		}
+	}
 	webdavHandler := createWebDAVHandler(cfg, logger)
 
-	srv := server.New(cfg, fileHandler, webdavHandler, authMiddleware, logger)
+	a.server = server.New(cfg, fileHandler, webdavHandler, authMiddleware, logger)
+	return a, nil
+}
 
+// runServer starts srv and blocks until it fails, a signal arrives on
+// shutdown or --max-requests or --timeout is reached. It then shuts the
+// server down gracefully and returns the process exit code.
+func runServer(srv *server.Server, cfg *config.Config, shutdown <-chan os.Signal, stopJobs func(),
+	logger *slog.Logger) int {
 	serverErrors := make(chan error, 1)
 	go func() {
 		logger.Info("Server starting", slog.String("address", cfg.Address()))
@@ -81,49 +471,174 @@ func main() {
 		}
 	}()
 
-	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
-
 	select {
 	case err := <-serverErrors:
 		logger.Error("Server failed to start", slog.Any("error", err))
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
-		os.Exit(1)
+		return 1
 	case sig := <-shutdown:
 		logger.Info("Shutdown signal received", slog.String("signal", sig.String()))
+	case reason := <-srv.LimitReached():
+		logger.Info("Serve limit reached, shutting down", slog.String("reason", reason))
+	}
+	srv.SetKeepAlivesEnabled(false)
+	stopJobs()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-
-		if err := srv.Shutdown(ctx); err != nil {
-			cancel()
-			logger.Error("Server shutdown failed", slog.Any("error", err))
-			fmt.Fprintf(os.Stderr, "Server shutdown error: %v\n", err)
-			os.Exit(1)
-		}
-		cancel()
-
-		logger.Info("Server stopped gracefully")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Connections still open after the grace period are cut off
+		logger.Warn("Graceful shutdown timed out, closing remaining connections")
+		err = srv.Close()
 	}
+	if err != nil {
+		logger.Error("Server shutdown failed", slog.Any("error", err))
+		fmt.Fprintf(os.Stderr, "Server shutdown error: %v\n", err)
+		return 1
+	}
+
+	logger.Info("Server stopped gracefully")
+	return 0
 }
 
 func showHelp() {
 	fmt.Println("gofs - A lightweight HTTP file server written in Go")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  gofs [options]")
+	fmt.Println("  gofs [serve] [options]            Start the file server")
+	fmt.Println("  gofs ls [--json] URL              List a remote directory")
+	fmt.Println("  gofs get [--json] URL [dest]      Download a file, resuming from dest.part")
+	fmt.Println("  gofs upload [--json] FILE URL     Upload a file to an advanced-theme server")
+	fmt.Println("  gofs tree [--json] [--explain] [options]")
+	fmt.Println("                                    Print what each mount would serve, without listening")
+	fmt.Println()
+	fmt.Println("Client commands read credentials from -a/--auth or GOFS_AUTH and exit with")
+	fmt.Println("0 on success, 1 on failure and 2 on invalid arguments.")
 	fmt.Println()
-	fmt.Println("Options:")
+	fmt.Println("Server options:")
 	fmt.Println("  -a, --auth string   Enable HTTP Basic Authentication with user:password format")
+	fmt.Println("                      Use \"-\" to read user:password from stdin")
+	fmt.Println("      --auth-file-creds path File containing user:password (mode 0600)")
+	fmt.Println("      --auth-mode string Which requests require auth: all, write-only (default \"all\")")
 	fmt.Println("  -d, --dir string    Directory mount (can be used multiple times)")
-	fmt.Println("                      Format: [path:]dir[:ro][:name]")
+	fmt.Println("                      Format: [path:]dir[:ro][:name] or path=...,dir=...[,ro][,name=...][,quota=10GB]")
 	fmt.Println("                      Examples: -d \"/config:/etc/app:ro:Configuration\"")
 	fmt.Println("                                -d \"/logs:/var/log::Application Logs\"")
+	fmt.Println("                                -d 'path=/conf,dir=C:\\app\\conf,ro,name=\"Config: prod\"'")
+	fmt.Println("                      A URL mounts another gofs server read-only: -d \"/hostA=https://a.internal:8000\"")
 	fmt.Println("  -h, --help          Show this help message and exit")
 	fmt.Println("  -H, --show-hidden   Show hidden files and directories")
 	fmt.Println("      --host string   Server host address to bind to (default \"127.0.0.1\")")
 	fmt.Println("  -p, --port int      Server port number to listen on (default 8000)")
 	fmt.Println("      --theme string  UI theme: default, advanced (default \"default\")")
 	fmt.Println("      --enable-webdav Enable WebDAV server on /dav path (read-only)")
+	fmt.Println("      --webdav-prefix string Path WebDAV is served under; \"/\" serves only WebDAV (default \"/dav\")")
+	fmt.Println("      --webdav-fake-locks Answer WebDAV LOCK/UNLOCK without locking so Finder can mount (default true)")
+	fmt.Println("      --readonly      Refuse every request that could change a file, on every mount and WebDAV")
+	fmt.Println("      --enable-tree   Show a collapsible directory tree in the advanced theme")
+	fmt.Println("      --enable-rest-write Accept authenticated PUT and DELETE on file paths, e.g. curl -T")
+	fmt.Println("                      (advanced theme; needs --auth)")
+	fmt.Println("      --user-upload-dirs Store uploads and new folders under incoming/<user>/ (advanced theme)")
+	fmt.Println("      --watch-mode string How the advanced theme notices directory changes: auto, poll or off")
+	fmt.Println("                      (default \"auto\", which polls)")
+	fmt.Println("      --poll-interval duration How often watched directories are checked for changes (default 2s)")
+	fmt.Println("      --upload-scan-cmd string Run this command with the path of each upload before storing it;")
+	fmt.Println("                      a non-zero exit rejects the upload with 422 and stderr as the reason")
+	fmt.Println("      --upload-scan-url url POST each upload here before storing it; 2xx accepts, 4xx rejects")
+	fmt.Println("      --upload-scan-timeout duration Time a scan may take before the upload is refused (default 30s)")
+	fmt.Println("      --otel-endpoint url Send request traces to this OTLP/HTTP collector, e.g. http://localhost:4318")
+	fmt.Println("      --log-path-mode string How request paths appear in logs: full, hash or basename (default \"full\")")
+	fmt.Println("      --log-path-key string HMAC key for --log-path-mode=hash; random per run when unset")
+	fmt.Println("      --skip-dir-check Skip startup checks that mount directories exist and are readable")
+	fmt.Println("      --debug-errors  Include internal error details in responses (development only)")
+	fmt.Println("      --show-precompressed List .gz/.br sidecar files that are served transparently")
+	fmt.Println("      --max-concurrent-uploads int Uploads processed at once per mount (default 5)")
+	fmt.Println("      --upload-lock-wait duration Wait for an upload to the same path before 409 (default 5s)")
+	fmt.Println("      --write-manifests Keep a SHA256SUMS file up to date at the root of writable mounts")
+	fmt.Println("      --snapshot      Serve every mount read-only as it was at startup; changed files answer 503")
+	fmt.Println("      --snapshot-file path Keep the snapshot in this file so restarts serve the same view")
+	fmt.Println("                      (implies --snapshot; must be outside the served directories)")
+	fmt.Println("      --behind-tls-proxy Send Strict-Transport-Security although a proxy terminates TLS")
+	fmt.Println("      --hsts-max-age int Strict-Transport-Security max-age in seconds, 0 disables (default 31536000)")
+	fmt.Println("      --hsts-include-subdomains Add includeSubDomains to Strict-Transport-Security")
+	fmt.Println("      --xss-protection Send X-XSS-Protection: 1; mode=block (default true)")
+	fmt.Println("      --permissions-policy string Permissions-Policy header, empty to omit")
+	fmt.Println("                      (default \"camera=(), microphone=(), geolocation=()\")")
+	fmt.Println("      --quota path=size Cap the bytes stored under a mount, e.g. --quota \"/data=10GB\"")
+	fmt.Println("                      (can be used multiple times; single-directory mounts use \"/\")")
+	fmt.Println("      --alias path=target Serve the mount at target under path too, e.g. --alias \"/v2.3=/latest\"")
+	fmt.Println("                      (can be used multiple times)")
+	fmt.Println("      --default-mount path Mount the root redirects to (default: the first by weight, then name)")
+	fmt.Println("      --case-insensitive-routes Match mount paths regardless of case, e.g. /Docs reaches /docs")
+	fmt.Println("      --remote-auth path=user:password Credentials for the remote mount at path")
+	fmt.Println("                      (can be used multiple times)")
+	fmt.Println("      --cache-control rule Cache-Control for matching files (can be used multiple times)")
+	fmt.Println("                      Format: pattern[,pattern...]=directive, first match wins")
+	fmt.Println("                      Example: --cache-control \"*.js,*.css=public,max-age=86400\"")
+	fmt.Println("      --cache-control-default string Cache-Control when no rule matches")
+	fmt.Println("      --zip-max-depth int Deepest directory level a ZIP download walks (default 64)")
+	fmt.Println("      --zip-max-entries int Most files in one ZIP download (default 10000)")
+	fmt.Println("      --zip-collect-timeout duration Time allowed to collect ZIP entries (default 30s)")
+	fmt.Println("      --max-concurrent-zips int ZIP downloads streamed at once per mount (default 3)")
+	fmt.Println("      --zip-queue-timeout duration How long a ZIP download waits for a slot before 429 (default 10s)")
+	fmt.Println("      --archive-cache-dir path Cache directory ZIPs here so downloads can resume with Range")
+	fmt.Println("      --archive-cache-size size Total size of cached archives (default \"10GB\")")
+	fmt.Println("      --extract-max-entries int Most entries /api/extract unpacks from one archive (default 10000)")
+	fmt.Println("      --extract-max-size size Most bytes /api/extract writes for one archive (default \"1GB\")")
+	fmt.Println("      --versions-dir path Keep files replaced by uploads here (advanced theme), listed by")
+	fmt.Println("                      /api/versions; must be outside the served directories")
+	fmt.Println("      --versions-max-count int Versions kept per file, 0 keeps all (default 10)")
+	fmt.Println("      --versions-max-age duration Prune versions older than this, e.g. 720h (0 keeps them)")
+	fmt.Println("      --scrub-interval duration Re-read every file this often, e.g. 24h, and report content")
+	fmt.Println("                      that changed without an mtime change at /api/scrub/report")
+	fmt.Println("      --scrub-dir path Keep scrub manifests here; must be outside the served directories")
+	fmt.Println("      --scrub-rate size Bytes per second a scrub reads, 0 for no limit (default \"20MB\")")
+	fmt.Println("      --allow-indexing Let crawlers index the server; /robots.txt disallows everything by default")
+	fmt.Println("      --well-known-dir path Serve files under /.well-known/ from path, e.g. security.txt or")
+	fmt.Println("                      ACME HTTP-01 challenges")
+	fmt.Println("      --well-known-auth Require authentication for /robots.txt, /favicon.ico and /.well-known/")
+	fmt.Println("      --hot-cache-size size Keep up to size bytes of small files in memory (default 0, off)")
+	fmt.Println("      --hot-cache-max-file-size size Largest file kept in memory (default \"64KB\")")
+	fmt.Println("      --max-request-body size Largest JSON body for folder, ZIP and bulk requests (default \"1MB\")")
+	fmt.Println("      --max-upload-size size Largest file an upload may store (default \"100MB\")")
+	fmt.Println("      --max-hash-size size Largest file whose ETag is a hash of its content (default \"100MB\")")
+	fmt.Println("      --digest-headers Send Content-Digest (Repr-Digest on ranges) for files with a content ETag")
+	fmt.Println("                      (default true)")
+	fmt.Println("      --max-download-size size Refuse to serve larger files (default: no limit)")
+	fmt.Println("      --dir-config        Apply .gofs.yaml files (hidden, auth, index) in served directories")
+	fmt.Println("      --mime-types path   Content-Type overrides in mime.types format (\"type ext...\" lines)")
+	fmt.Println("      --mime-type .ext=type Content-Type for an extension (can be used multiple times)")
+	fmt.Println("      --base-url path     Path prefix gofs is served under behind a reverse proxy, e.g. /files")
+	fmt.Println("      --trust-proxy       Honour X-Forwarded-For/-Proto/-Host/-Prefix from a reverse proxy")
+	fmt.Println("      --acme-domain host  Serve HTTPS with a Let's Encrypt certificate for host (can be used")
+	fmt.Println("                      multiple times); port 80 answers challenges and redirects to HTTPS")
+	fmt.Println("      --acme-cache-dir path Where ACME keys and certificates are kept")
+	fmt.Println("                      (default \"<user cache dir>/gofs/acme\")")
+	fmt.Println("      --max-requests int  Shut down gracefully after this many file downloads (0 is unlimited)")
+	fmt.Println("      --timeout duration  Shut down gracefully after this long, e.g. 30m (0 runs until stopped)")
+	fmt.Println("      --share path        Serve only this file at a random, unguessable URL and shut down")
+	fmt.Println("                      after one download unless --max-requests is given")
+	fmt.Println("      --trusted-origin url Also accept uploads and changes from pages on this origin, e.g.")
+	fmt.Println("                      https://app.example.com (can be used multiple times)")
+	fmt.Println("      --max-url-length int Longest request URL before 414, 0 disables (default 8192)")
+	fmt.Println("      --max-header-count int Most request headers before 431, 0 disables (default 100)")
+	fmt.Println("      --max-header-size size Largest total of request headers before 431, 0 disables")
+	fmt.Println("                      (default \"32KB\")")
+	fmt.Println("      --max-path-depth int Most segments in a request path or uploaded name, 0 disables (default 64)")
+	fmt.Println("      --max-name-length int Most bytes in one path segment, 0 disables (default 255)")
+	fmt.Println("      --deny-path pattern Answer 404 to paths with a segment matching pattern, e.g. \"*.php\"")
+	fmt.Println("                      (can be used multiple times; replaces the default list of scanner")
+	fmt.Println("                      targets such as .env, .git and wp-admin; \"none\" disables it)")
+	fmt.Println("      --block-sensitive Neither list nor serve files that usually hold secrets, such as .env,")
+	fmt.Println("                      id_rsa, *.pem and .git; without it they are only reported at startup")
+	fmt.Println("      --sensitive-pattern pattern Also treat files matching pattern as sensitive, e.g.")
+	fmt.Println("                      \"*.sqlite\" (can be used multiple times)")
+	fmt.Println("      --qr                Print a QR code of the server URL at startup, with the LAN address")
+	fmt.Println("                      when listening on 0.0.0.0")
+	fmt.Println("      --check-config  Validate the configuration without listening, print a JSON report")
+	fmt.Println("      --print-tree    Same as gofs tree; --json prints JSON, --explain shows hidden entries and why")
+	fmt.Println("                      and exit 0 when it is valid or 1 otherwise")
 	fmt.Println("  -v, --version       Show version information and exit")
 	fmt.Println()
 	fmt.Println("Environment Variables:")
@@ -134,7 +649,88 @@ func showHelp() {
 	fmt.Println("  GOFS_THEME          UI theme (default: default)")
 	fmt.Println("  GOFS_SHOW_HIDDEN    Show hidden files (default: false)")
 	fmt.Println("  GOFS_AUTH           Basic auth credentials (user:password)")
+	fmt.Println("  GOFS_AUTH_FILE_CREDS File containing basic auth credentials")
+	fmt.Println("  GOFS_AUTH_MODE      Which requests require auth (default: all)")
 	fmt.Println("  GOFS_ENABLE_WEBDAV  Enable WebDAV server (default: false)")
+	fmt.Println("  GOFS_WEBDAV_PREFIX  Path WebDAV is served under (default: /dav)")
+	fmt.Println("  GOFS_WEBDAV_FAKE_LOCKS Grant WebDAV locks without locking (default: true)")
+	fmt.Println("  GOFS_READONLY       Refuse every request that could change a file (default: false)")
+	fmt.Println("  GOFS_ENABLE_TREE    Show the directory tree sidebar (default: false)")
+	fmt.Println("  GOFS_ENABLE_REST_WRITE Accept PUT and DELETE on file paths (default: false)")
+	fmt.Println("  GOFS_USER_UPLOAD_DIRS Store uploads under incoming/<user>/ (default: false)")
+	fmt.Println("  GOFS_WATCH_MODE     How directory changes are noticed (default: auto)")
+	fmt.Println("  GOFS_POLL_INTERVAL  How often watched directories are checked (default: 2s)")
+	fmt.Println("  GOFS_UPLOAD_SCAN_CMD Command that scans each upload")
+	fmt.Println("  GOFS_UPLOAD_SCAN_URL URL each upload is POSTed to for scanning")
+	fmt.Println("  GOFS_UPLOAD_SCAN_TIMEOUT Time a scan may take (default: 30s)")
+	fmt.Println("  GOFS_OTEL_ENDPOINT  OTLP/HTTP collector request traces are sent to")
+	fmt.Println("  GOFS_LOG_PATH_MODE  How request paths appear in logs (default: full)")
+	fmt.Println("  GOFS_LOG_PATH_KEY   HMAC key for hashed log paths")
+	fmt.Println("  GOFS_SKIP_DIR_CHECK Skip mount directory checks at startup (default: false)")
+	fmt.Println("  GOFS_DEBUG_ERRORS   Include error details in responses (default: false)")
+	fmt.Println("  GOFS_SHOW_PRECOMPRESSED List .gz/.br sidecar files (default: false)")
+	fmt.Println("  GOFS_MAX_CONCURRENT_UPLOADS Uploads processed at once per mount (default: 5)")
+	fmt.Println("  GOFS_UPLOAD_LOCK_WAIT Wait for an upload to the same path (default: 5s)")
+	fmt.Println("  GOFS_WRITE_MANIFESTS Write SHA256SUMS files periodically (default: false)")
+	fmt.Println("  GOFS_BEHIND_TLS_PROXY A reverse proxy terminates TLS (default: false)")
+	fmt.Println("  GOFS_HSTS_MAX_AGE   Strict-Transport-Security max-age (default: 31536000)")
+	fmt.Println("  GOFS_HSTS_INCLUDE_SUBDOMAINS Add includeSubDomains to HSTS (default: false)")
+	fmt.Println("  GOFS_XSS_PROTECTION Send X-XSS-Protection (default: true)")
+	fmt.Println("  GOFS_PERMISSIONS_POLICY Permissions-Policy header value")
+	fmt.Println("  GOFS_QUOTA          Mount quotas, semicolon-separated path=size")
+	fmt.Println("  GOFS_ALIAS          Mount aliases, semicolon-separated path=target")
+	fmt.Println("  GOFS_DEFAULT_MOUNT  Mount the root redirects to")
+	fmt.Println("  GOFS_CASE_INSENSITIVE_ROUTES Match mount paths regardless of case (default: false)")
+	fmt.Println("  GOFS_REMOTE_AUTH    Remote mount credentials, semicolon-separated path=user:password")
+	fmt.Println("  GOFS_CACHE_CONTROL  Cache-Control rules, semicolon-separated")
+	fmt.Println("  GOFS_CACHE_CONTROL_DEFAULT Cache-Control when no rule matches")
+	fmt.Println("  GOFS_ZIP_MAX_DEPTH  Deepest directory level a ZIP download walks (default: 64)")
+	fmt.Println("  GOFS_ZIP_MAX_ENTRIES Most files in one ZIP download (default: 10000)")
+	fmt.Println("  GOFS_ZIP_COLLECT_TIMEOUT Time allowed to collect ZIP entries (default: 30s)")
+	fmt.Println("  GOFS_MAX_CONCURRENT_ZIPS ZIP downloads streamed at once per mount (default: 3)")
+	fmt.Println("  GOFS_ZIP_QUEUE_TIMEOUT How long a ZIP download waits for a slot (default: 10s)")
+	fmt.Println("  GOFS_ARCHIVE_CACHE_DIR Directory for cached ZIP archives")
+	fmt.Println("  GOFS_ARCHIVE_CACHE_SIZE Total size of cached archives (default: 10GB)")
+	fmt.Println("  GOFS_EXTRACT_MAX_ENTRIES Most entries /api/extract unpacks from one archive (default: 10000)")
+	fmt.Println("  GOFS_EXTRACT_MAX_SIZE Most bytes /api/extract writes for one archive (default: 1GB)")
+	fmt.Println("  GOFS_VERSIONS_DIR   Directory for files replaced by uploads")
+	fmt.Println("  GOFS_VERSIONS_MAX_COUNT Versions kept per file (default: 10)")
+	fmt.Println("  GOFS_VERSIONS_MAX_AGE Prune versions older than this (default: 0, keep)")
+	fmt.Println("  GOFS_SCRUB_INTERVAL How often every file is checked for corruption (default: 0, off)")
+	fmt.Println("  GOFS_SCRUB_DIR      Directory for scrub manifests")
+	fmt.Println("  GOFS_SCRUB_RATE     Bytes per second a scrub reads (default: 20MB)")
+	fmt.Println("  GOFS_SNAPSHOT       Serve mounts as they were at startup (default: false)")
+	fmt.Println("  GOFS_SNAPSHOT_FILE  File the mount snapshots are kept in")
+	fmt.Println("  GOFS_ALLOW_INDEXING Let crawlers index the server (default: false)")
+	fmt.Println("  GOFS_WELL_KNOWN_DIR Directory served under /.well-known/")
+	fmt.Println("  GOFS_WELL_KNOWN_AUTH Require authentication for well-known paths (default: false)")
+	fmt.Println("  GOFS_HOT_CACHE_SIZE Bytes of small files kept in memory (default: 0, off)")
+	fmt.Println("  GOFS_HOT_CACHE_MAX_FILE_SIZE Largest file kept in memory (default: 64KB)")
+	fmt.Println("  GOFS_MAX_REQUEST_BODY Largest JSON request body (default: 1MB)")
+	fmt.Println("  GOFS_MAX_UPLOAD_SIZE Largest file an upload may store (default: 100MB)")
+	fmt.Println("  GOFS_MAX_HASH_SIZE  Largest file with a content-hashed ETag (default: 100MB)")
+	fmt.Println("  GOFS_DIGEST_HEADERS Send Content-Digest and Repr-Digest headers (default: true)")
+	fmt.Println("  GOFS_MAX_DOWNLOAD_SIZE Largest file served for download (default: no limit)")
+	fmt.Println("  GOFS_DIR_CONFIG     Apply .gofs.yaml files in served directories (default: false)")
+	fmt.Println("  GOFS_MIME_TYPES     Content-Type overrides file in mime.types format")
+	fmt.Println("  GOFS_MIME_TYPE      Content-Type overrides, semicolon-separated .ext=type")
+	fmt.Println("  GOFS_BASE_URL       Path prefix behind a reverse proxy")
+	fmt.Println("  GOFS_TRUST_PROXY    Honour X-Forwarded-* headers (default: false)")
+	fmt.Println("  GOFS_ACME_DOMAIN    Let's Encrypt host names, semicolon-separated")
+	fmt.Println("  GOFS_ACME_CACHE_DIR Where ACME keys and certificates are kept")
+	fmt.Println("  GOFS_MAX_REQUESTS   Shut down after this many file downloads (default: 0, unlimited)")
+	fmt.Println("  GOFS_TIMEOUT        Shut down after this long (default: 0, until stopped)")
+	fmt.Println("  GOFS_SHARE          File to serve alone at a random URL")
+	fmt.Println("  GOFS_TRUSTED_ORIGIN Extra trusted origins, semicolon-separated")
+	fmt.Println("  GOFS_MAX_URL_LENGTH Longest request URL (default: 8192)")
+	fmt.Println("  GOFS_MAX_HEADER_COUNT Most request headers (default: 100)")
+	fmt.Println("  GOFS_MAX_HEADER_SIZE Largest total of request headers (default: 32KB)")
+	fmt.Println("  GOFS_MAX_PATH_DEPTH Most segments in a path (default: 64)")
+	fmt.Println("  GOFS_MAX_NAME_LENGTH Most bytes in one path segment (default: 255)")
+	fmt.Println("  GOFS_DENY_PATH      Denied path segment patterns, semicolon-separated")
+	fmt.Println("  GOFS_BLOCK_SENSITIVE Neither list nor serve sensitive files (default: false)")
+	fmt.Println("  GOFS_SENSITIVE_PATTERN Extra sensitive file patterns, semicolon-separated")
+	fmt.Println("  GOFS_QR             Print a QR code of the server URL (default: false)")
 	fmt.Println()
 	fmt.Println("Note: Command line flags override environment variables")
 }
@@ -159,21 +755,108 @@ func (s *stringSlice) Set(value string) error {
 }
 
 type cmdFlags struct {
-	Port         int
-	Host         string
-	Dirs         []string // Directory mounts
-	Theme        string
-	ShowHidden   bool
-	Auth         string
-	Help         bool
-	Version      bool
-	HealthCheck  bool
-	EnableWebDAV bool
+	Port                  int
+	Host                  string
+	Dirs                  []string // Directory mounts
+	Theme                 string
+	ShowHidden            bool
+	Auth                  string
+	AuthSet               bool // -a/--auth given explicitly rather than via GOFS_AUTH
+	AuthFile              string
+	AuthMode              string
+	Help                  bool
+	Version               bool
+	HealthCheck           bool
+	CheckConfig           bool
+	PrintTree             bool
+	TreeJSON              bool
+	TreeExplain           bool
+	EnableWebDAV          bool
+	WebDAVPrefix          string
+	WebDAVFakeLocks       bool
+	Readonly              bool
+	EnableTree            bool
+	EnableRESTWrite       bool
+	UserUploadDirs        bool
+	WatchMode             string // auto, poll or off
+	PollInterval          time.Duration
+	UploadScanCmd         string
+	UploadScanURL         string
+	UploadScanTimeout     time.Duration
+	OTelEndpoint          string
+	LogPathMode           string // full, hash or basename
+	LogPathKey            string
+	SkipDirCheck          bool
+	DebugErrors           bool
+	ShowPrecompressed     bool
+	MaxConcurrentUploads  int
+	UploadLockWait        time.Duration
+	WriteManifests        bool
+	Snapshot              bool
+	SnapshotFile          string
+	BehindTLSProxy        bool
+	HSTSMaxAge            int
+	HSTSIncludeSubDomains bool
+	XSSProtection         bool
+	PermissionsPolicy     string
+	CacheControl          []string // Cache-Control rules, in precedence order
+	CacheControlDefault   string
+	Quotas                []string // "path=size" mount quotas
+	Aliases               []string // "path=target" mount aliases
+	DefaultMount          string
+	CaseInsensitiveRoutes bool
+	RemoteAuth            []string // "path=user:password" remote mount credentials
+	ZipMaxDepth           int
+	ZipMaxEntries         int
+	ZipCollectTimeout     time.Duration
+	MaxConcurrentZips     int
+	ZipQueueTimeout       time.Duration
+	ArchiveCacheDir       string
+	ArchiveCacheSize      string // e.g. "10GB"
+	ExtractMaxEntries     int
+	ExtractMaxSize        string // e.g. "1GB"
+	VersionsDir           string
+	VersionsMaxCount      int
+	VersionsMaxAge        time.Duration
+	ScrubInterval         time.Duration
+	ScrubDir              string
+	ScrubRate             string // Bytes per second, e.g. "20MB"
+	AllowIndexing         bool
+	WellKnownDir          string
+	WellKnownAuth         bool
+	MaxRequestBody        string // e.g. "1MB"
+	MaxUploadSize         string // e.g. "100MB"
+	MaxHashSize           string // e.g. "100MB"
+	DigestHeaders         bool
+	MaxDownloadSize       string // e.g. "2GiB"; "" is unlimited
+	HotCacheSize          string // e.g. "64MB"
+	HotCacheMaxFileSize   string // e.g. "64KB"
+	DirConfig             bool
+	MimeTypesFile         string
+	MimeTypes             []string // ".ext=type" Content-Type overrides
+	BaseURL               string
+	TrustProxy            bool
+	ACMEDomains           []string // Host names for Let's Encrypt certificates
+	ACMECacheDir          string
+	MaxRequests           int
+	Timeout               time.Duration
+	Share                 string // File to serve alone at a random URL
+	QR                    bool
+	TrustedOrigins        []string // Extra origins allowed to send mutating requests
+	MaxURLLength          int
+	MaxHeaderCount        int
+	MaxPathDepth          int
+	MaxNameLength         int
+	MaxHeaderSize         string   // e.g. "32KB"
+	DenyPaths             []string // Path segment patterns answered with 404
+	BlockSensitive        bool
+	SensitivePatterns     []string // Extra path segment patterns of files holding secrets
 }
 
 func parseFlags() *cmdFlags {
 	f := &cmdFlags{}
-	var dirs stringSlice
+	var dirs, cacheControl, quotas, aliases, remoteAuth, mimeTypes, acmeDomains, trustedOrigins, denyPaths,
+		sensitivePatterns stringSlice
 
 	flag.IntVar(&f.Port, "port", getEnv("GOFS_PORT", 8000), "Server port")
 	flag.IntVar(&f.Port, "p", getEnv("GOFS_PORT", 8000), "Server port (shorthand)")
@@ -185,16 +868,206 @@ func parseFlags() *cmdFlags {
 	flag.BoolVar(&f.ShowHidden, "H", getEnv("GOFS_SHOW_HIDDEN", false), "Show hidden files (shorthand)")
 	flag.StringVar(&f.Auth, "auth", getEnv("GOFS_AUTH", ""), "Basic auth (user:password)")
 	flag.StringVar(&f.Auth, "a", getEnv("GOFS_AUTH", ""), "Basic auth (shorthand)")
+	flag.StringVar(&f.AuthFile, "auth-file-creds", getEnv("GOFS_AUTH_FILE_CREDS", ""),
+		"File containing user:password")
+	flag.StringVar(&f.AuthMode, "auth-mode", getEnv("GOFS_AUTH_MODE", "all"), "Auth mode: all, write-only")
 	flag.BoolVar(&f.Help, "help", false, "Show help")
 	flag.BoolVar(&f.Help, "h", false, "Show help (shorthand)")
 	flag.BoolVar(&f.Version, "version", false, "Show version")
 	flag.BoolVar(&f.Version, "v", false, "Show version (shorthand)")
 	flag.BoolVar(&f.HealthCheck, "health-check", false, "Perform health check and exit")
+	flag.BoolVar(&f.CheckConfig, "check-config", false, "Validate the configuration, print a JSON report and exit")
+	flag.BoolVar(&f.PrintTree, "print-tree", false, "Print what each mount serves and exit")
+	flag.BoolVar(&f.TreeJSON, "json", false, "Print the tree as JSON (with --print-tree)")
+	flag.BoolVar(&f.TreeExplain, "explain", false, "Show entries that are not served and why (with --print-tree)")
 	flag.BoolVar(&f.EnableWebDAV, "enable-webdav", getEnv("GOFS_ENABLE_WEBDAV", false), "Enable WebDAV server")
+	flag.StringVar(&f.WebDAVPrefix, "webdav-prefix", getEnv("GOFS_WEBDAV_PREFIX", config.DefaultWebDAVPrefix),
+		"Path WebDAV is served under")
+	flag.BoolVar(&f.WebDAVFakeLocks, "webdav-fake-locks", getEnv("GOFS_WEBDAV_FAKE_LOCKS", true),
+		"Grant WebDAV locks without locking")
+	flag.BoolVar(&f.Readonly, "readonly", getEnv("GOFS_READONLY", false), "Refuse every request that changes files")
+	flag.BoolVar(&f.EnableTree, "enable-tree", getEnv("GOFS_ENABLE_TREE", false), "Show directory tree sidebar")
+	flag.BoolVar(&f.EnableRESTWrite, "enable-rest-write", getEnv("GOFS_ENABLE_REST_WRITE", false),
+		"Accept PUT and DELETE on file paths")
+	flag.BoolVar(&f.UserUploadDirs, "user-upload-dirs", getEnv("GOFS_USER_UPLOAD_DIRS", false),
+		"Store uploads under incoming/<user>/")
+	flag.StringVar(&f.WatchMode, "watch-mode", getEnv("GOFS_WATCH_MODE", config.WatchAuto),
+		"How directory changes are noticed: auto, poll or off")
+	flag.DurationVar(&f.PollInterval, "poll-interval",
+		getEnv("GOFS_POLL_INTERVAL", constants.DefaultPollInterval), "How often watched directories are checked")
+	flag.StringVar(&f.UploadScanCmd, "upload-scan-cmd", getEnv("GOFS_UPLOAD_SCAN_CMD", ""),
+		"Command run with the path of each upload; non-zero exit rejects it")
+	flag.StringVar(&f.UploadScanURL, "upload-scan-url", getEnv("GOFS_UPLOAD_SCAN_URL", ""),
+		"URL each upload is POSTed to; 2xx accepts it")
+	flag.DurationVar(&f.UploadScanTimeout, "upload-scan-timeout",
+		getEnv("GOFS_UPLOAD_SCAN_TIMEOUT", constants.DefaultUploadScanTimeout), "Time a scan may take")
+	flag.StringVar(&f.OTelEndpoint, "otel-endpoint", getEnv("GOFS_OTEL_ENDPOINT", ""),
+		"OTLP/HTTP collector request traces are sent to")
+	flag.StringVar(&f.LogPathMode, "log-path-mode", getEnv("GOFS_LOG_PATH_MODE", config.LogPathFull),
+		"How request paths appear in logs: full, hash or basename")
+	flag.StringVar(&f.LogPathKey, "log-path-key", getEnv("GOFS_LOG_PATH_KEY", ""),
+		"HMAC key for --log-path-mode=hash")
+	flag.BoolVar(&f.SkipDirCheck, "skip-dir-check", getEnv("GOFS_SKIP_DIR_CHECK", false), "Skip mount directory checks")
+	flag.BoolVar(&f.DebugErrors, "debug-errors", getEnv("GOFS_DEBUG_ERRORS", false), "Verbose error responses")
+	flag.BoolVar(&f.ShowPrecompressed, "show-precompressed", getEnv("GOFS_SHOW_PRECOMPRESSED", false),
+		"List precompressed sidecar files")
+	flag.IntVar(&f.MaxConcurrentUploads, "max-concurrent-uploads",
+		getEnv("GOFS_MAX_CONCURRENT_UPLOADS", constants.DefaultMaxConcurrentUploads), "Concurrent upload limit")
+	flag.DurationVar(&f.UploadLockWait, "upload-lock-wait",
+		getEnv("GOFS_UPLOAD_LOCK_WAIT", constants.DefaultUploadLockWait), "Wait for an upload to the same path")
+	flag.BoolVar(&f.WriteManifests, "write-manifests", getEnv("GOFS_WRITE_MANIFESTS", false),
+		"Write SHA256SUMS files periodically")
+	flag.BoolVar(&f.Snapshot, "snapshot", getEnv("GOFS_SNAPSHOT", false), "Serve mounts as they were at startup")
+	flag.StringVar(&f.SnapshotFile, "snapshot-file", getEnv("GOFS_SNAPSHOT_FILE", ""),
+		"File the mount snapshots are kept in")
+	flag.BoolVar(&f.BehindTLSProxy, "behind-tls-proxy", getEnv("GOFS_BEHIND_TLS_PROXY", false),
+		"A reverse proxy terminates TLS")
+	flag.IntVar(&f.HSTSMaxAge, "hsts-max-age", getEnv("GOFS_HSTS_MAX_AGE", constants.DefaultHSTSMaxAge),
+		"Strict-Transport-Security max-age in seconds (0 disables)")
+	flag.BoolVar(&f.HSTSIncludeSubDomains, "hsts-include-subdomains", getEnv("GOFS_HSTS_INCLUDE_SUBDOMAINS", false),
+		"Add includeSubDomains to Strict-Transport-Security")
+	flag.BoolVar(&f.XSSProtection, "xss-protection", getEnv("GOFS_XSS_PROTECTION", true),
+		"Send X-XSS-Protection")
+	flag.StringVar(&f.PermissionsPolicy, "permissions-policy",
+		getEnv("GOFS_PERMISSIONS_POLICY", constants.DefaultPermissionsPolicy), "Permissions-Policy header value")
+	flag.Var(&quotas, "quota", "Mount quota path=size, e.g. /data=10GB (repeatable)")
+	flag.Var(&aliases, "alias", "Mount alias path=target, e.g. /v2.3=/latest (repeatable)")
+	flag.StringVar(&f.DefaultMount, "default-mount", getEnv("GOFS_DEFAULT_MOUNT", ""),
+		"Mount the root redirects to")
+	flag.BoolVar(&f.CaseInsensitiveRoutes, "case-insensitive-routes", getEnv("GOFS_CASE_INSENSITIVE_ROUTES", false),
+		"Match mount paths regardless of case")
+	flag.Var(&remoteAuth, "remote-auth", "Remote mount credentials path=user:password (repeatable)")
+	flag.Var(&cacheControl, "cache-control", "Cache-Control rule patterns=directive (repeatable)")
+	flag.StringVar(&f.CacheControlDefault, "cache-control-default", getEnv("GOFS_CACHE_CONTROL_DEFAULT", ""),
+		"Cache-Control when no rule matches")
+	flag.IntVar(&f.ZipMaxDepth, "zip-max-depth", getEnv("GOFS_ZIP_MAX_DEPTH", constants.DefaultZipMaxDepth),
+		"Deepest directory level a ZIP download walks")
+	flag.IntVar(&f.ZipMaxEntries, "zip-max-entries", getEnv("GOFS_ZIP_MAX_ENTRIES", constants.DefaultZipMaxEntries),
+		"Most files in one ZIP download")
+	flag.DurationVar(&f.ZipCollectTimeout, "zip-collect-timeout",
+		getEnv("GOFS_ZIP_COLLECT_TIMEOUT", constants.DefaultZipCollectTimeout), "Time allowed to collect ZIP entries")
+	flag.IntVar(&f.MaxConcurrentZips, "max-concurrent-zips",
+		getEnv("GOFS_MAX_CONCURRENT_ZIPS", constants.DefaultMaxConcurrentZips), "ZIP downloads streamed at once")
+	flag.DurationVar(&f.ZipQueueTimeout, "zip-queue-timeout",
+		getEnv("GOFS_ZIP_QUEUE_TIMEOUT", constants.DefaultZipQueueTimeout), "How long a ZIP download waits for a slot")
+	flag.StringVar(&f.ArchiveCacheDir, "archive-cache-dir", getEnv("GOFS_ARCHIVE_CACHE_DIR", ""),
+		"Directory for cached ZIP archives")
+	flag.StringVar(&f.ArchiveCacheSize, "archive-cache-size", getEnv("GOFS_ARCHIVE_CACHE_SIZE", "10GB"),
+		"Total size of cached archives")
+	flag.IntVar(&f.ExtractMaxEntries, "extract-max-entries",
+		getEnv("GOFS_EXTRACT_MAX_ENTRIES", constants.DefaultExtractMaxEntries), "Most entries extracted from one archive")
+	flag.StringVar(&f.ExtractMaxSize, "extract-max-size", getEnv("GOFS_EXTRACT_MAX_SIZE", "1GB"),
+		"Most bytes extracted from one archive")
+	flag.StringVar(&f.VersionsDir, "versions-dir", getEnv("GOFS_VERSIONS_DIR", ""),
+		"Directory for files replaced by uploads")
+	flag.IntVar(&f.VersionsMaxCount, "versions-max-count",
+		getEnv("GOFS_VERSIONS_MAX_COUNT", constants.DefaultVersionsMaxCount), "Versions kept per file (0 keeps all)")
+	flag.DurationVar(&f.VersionsMaxAge, "versions-max-age", getEnv("GOFS_VERSIONS_MAX_AGE", time.Duration(0)),
+		"Prune versions older than this (0 keeps them)")
+	flag.DurationVar(&f.ScrubInterval, "scrub-interval", getEnv("GOFS_SCRUB_INTERVAL", time.Duration(0)),
+		"Check every file for corruption this often (0 disables it)")
+	flag.StringVar(&f.ScrubDir, "scrub-dir", getEnv("GOFS_SCRUB_DIR", ""), "Directory for scrub manifests")
+	flag.StringVar(&f.ScrubRate, "scrub-rate", getEnv("GOFS_SCRUB_RATE", constants.DefaultScrubRate),
+		"Bytes per second a scrub reads (0 is unlimited)")
+	flag.BoolVar(&f.AllowIndexing, "allow-indexing", getEnv("GOFS_ALLOW_INDEXING", false),
+		"Let crawlers index the server")
+	flag.StringVar(&f.WellKnownDir, "well-known-dir", getEnv("GOFS_WELL_KNOWN_DIR", ""),
+		"Directory served under /.well-known/")
+	flag.BoolVar(&f.WellKnownAuth, "well-known-auth", getEnv("GOFS_WELL_KNOWN_AUTH", false),
+		"Require authentication for /robots.txt, /favicon.ico and /.well-known/")
+	flag.StringVar(&f.HotCacheSize, "hot-cache-size", getEnv("GOFS_HOT_CACHE_SIZE", "0"),
+		"Bytes of small files kept in memory")
+	flag.StringVar(&f.HotCacheMaxFileSize, "hot-cache-max-file-size", getEnv("GOFS_HOT_CACHE_MAX_FILE_SIZE", "64KB"),
+		"Largest file kept in memory")
+	flag.StringVar(&f.MaxRequestBody, "max-request-body", getEnv("GOFS_MAX_REQUEST_BODY", "1MB"),
+		"Largest JSON request body")
+	flag.StringVar(&f.MaxUploadSize, "max-upload-size", getEnv("GOFS_MAX_UPLOAD_SIZE", "100MB"),
+		"Largest file an upload may store")
+	flag.StringVar(&f.MaxHashSize, "max-hash-size", getEnv("GOFS_MAX_HASH_SIZE", "100MB"),
+		"Largest file whose ETag hashes its content")
+	flag.BoolVar(&f.DigestHeaders, "digest-headers", getEnv("GOFS_DIGEST_HEADERS", true),
+		"Send Content-Digest or Repr-Digest for files with a content ETag")
+	flag.StringVar(&f.MaxDownloadSize, "max-download-size", getEnv("GOFS_MAX_DOWNLOAD_SIZE", ""),
+		"Largest file served for download")
+	flag.BoolVar(&f.DirConfig, "dir-config", getEnv("GOFS_DIR_CONFIG", false),
+		"Apply per-directory .gofs.yaml files")
+	flag.StringVar(&f.MimeTypesFile, "mime-types", getEnv("GOFS_MIME_TYPES", ""),
+		"Content-Type overrides file in mime.types format")
+	flag.Var(&mimeTypes, "mime-type", "Content-Type override .ext=type (repeatable)")
+	flag.StringVar(&f.BaseURL, "base-url", getEnv("GOFS_BASE_URL", ""), "Path prefix behind a reverse proxy")
+	flag.BoolVar(&f.TrustProxy, "trust-proxy", getEnv("GOFS_TRUST_PROXY", false), "Honour X-Forwarded-* headers")
+	flag.Var(&acmeDomains, "acme-domain", "Let's Encrypt certificate host name (repeatable)")
+	flag.StringVar(&f.ACMECacheDir, "acme-cache-dir", getEnv("GOFS_ACME_CACHE_DIR", config.DefaultACMECacheDir()),
+		"Where ACME keys and certificates are kept")
+	flag.IntVar(&f.MaxRequests, "max-requests", getEnv("GOFS_MAX_REQUESTS", 0),
+		"Shut down after this many file downloads (0 is unlimited)")
+	flag.DurationVar(&f.Timeout, "timeout", getEnv("GOFS_TIMEOUT", time.Duration(0)),
+		"Shut down after this long (0 runs until stopped)")
+	flag.StringVar(&f.Share, "share", getEnv("GOFS_SHARE", ""), "Serve one file at a random URL")
+	flag.Var(&trustedOrigins, "trusted-origin", "Extra origin allowed to send mutating requests (repeatable)")
+	flag.IntVar(&f.MaxURLLength, "max-url-length", getEnv("GOFS_MAX_URL_LENGTH", constants.DefaultMaxURLLength),
+		"Longest request URL before 414 (0 disables)")
+	flag.IntVar(&f.MaxHeaderCount, "max-header-count",
+		getEnv("GOFS_MAX_HEADER_COUNT", constants.DefaultMaxHeaderCount), "Most request headers before 431 (0 disables)")
+	flag.StringVar(&f.MaxHeaderSize, "max-header-size", getEnv("GOFS_MAX_HEADER_SIZE", "32KB"),
+		"Largest total of request headers before 431 (0 disables)")
+	flag.IntVar(&f.MaxPathDepth, "max-path-depth", getEnv("GOFS_MAX_PATH_DEPTH", constants.DefaultMaxPathDepth),
+		"Most segments in a request path or uploaded name (0 disables)")
+	flag.IntVar(&f.MaxNameLength, "max-name-length", getEnv("GOFS_MAX_NAME_LENGTH", constants.DefaultMaxNameLength),
+		"Most bytes in one path segment (0 disables)")
+	flag.Var(&denyPaths, "deny-path", "Path segment pattern answered with 404 (repeatable, \"none\" disables)")
+	flag.BoolVar(&f.BlockSensitive, "block-sensitive", getEnv("GOFS_BLOCK_SENSITIVE", false),
+		"Neither list nor serve files that usually hold secrets")
+	flag.Var(&sensitivePatterns, "sensitive-pattern", "Extra sensitive file pattern (repeatable)")
+	flag.BoolVar(&f.QR, "qr", getEnv("GOFS_QR", false), "Print a QR code of the server URL")
 
 	flag.Parse()
+	flag.Visit(func(fl *flag.Flag) {
+		if fl.Name == "auth" || fl.Name == "a" {
+			f.AuthSet = true
+		}
+	})
 
 	f.Dirs = parseDirConfig(dirs, "")
+	f.Quotas = quotas
+	if len(f.Quotas) == 0 {
+		f.Quotas = config.SplitDirList(getEnv("GOFS_QUOTA", ""))
+	}
+	f.Aliases = aliases
+	if len(f.Aliases) == 0 {
+		f.Aliases = config.SplitDirList(getEnv("GOFS_ALIAS", ""))
+	}
+	f.RemoteAuth = remoteAuth
+	if len(f.RemoteAuth) == 0 {
+		f.RemoteAuth = config.SplitDirList(getEnv("GOFS_REMOTE_AUTH", ""))
+	}
+	f.CacheControl = cacheControl
+	if len(f.CacheControl) == 0 {
+		f.CacheControl = config.SplitDirList(getEnv("GOFS_CACHE_CONTROL", ""))
+	}
+	f.MimeTypes = mimeTypes
+	if len(f.MimeTypes) == 0 {
+		f.MimeTypes = config.SplitDirList(getEnv("GOFS_MIME_TYPE", ""))
+	}
+	f.ACMEDomains = acmeDomains
+	if len(f.ACMEDomains) == 0 {
+		f.ACMEDomains = config.SplitDirList(getEnv("GOFS_ACME_DOMAIN", ""))
+	}
+	f.TrustedOrigins = trustedOrigins
+	if len(f.TrustedOrigins) == 0 {
+		f.TrustedOrigins = config.SplitDirList(getEnv("GOFS_TRUSTED_ORIGIN", ""))
+	}
+	f.DenyPaths = denyPaths
+	if len(f.DenyPaths) == 0 {
+		f.DenyPaths = config.SplitDirList(getEnv("GOFS_DENY_PATH", ""))
+	}
+	if len(f.DenyPaths) == 0 {
+		f.DenyPaths = config.DefaultDenyPaths
+	}
+	f.SensitivePatterns = sensitivePatterns
+	if len(f.SensitivePatterns) == 0 {
+		f.SensitivePatterns = config.SplitDirList(getEnv("GOFS_SENSITIVE_PATTERN", ""))
+	}
 	return f
 }
 
@@ -206,10 +1079,7 @@ func parseDirConfig(cmdDirs []string, _ string) []string {
 	if envDirs == "" {
 		return []string{"."}
 	}
-	if strings.Contains(envDirs, ";") {
-		return strings.Split(envDirs, ";")
-	}
-	return []string{envDirs}
+	return config.SplitDirList(envDirs)
 }
 
 func getEnv[T any](key string, defaultValue T) T {
@@ -234,6 +1104,12 @@ func getEnv[T any](key string, defaultValue T) T {
 		} else {
 			return defaultValue
 		}
+	case time.Duration:
+		if durationVal, err := time.ParseDuration(value); err == nil {
+			result = durationVal
+		} else {
+			return defaultValue
+		}
 	default:
 		return defaultValue
 	}
@@ -244,33 +1120,137 @@ func getEnv[T any](key string, defaultValue T) T {
 	return defaultValue
 }
 
-func createFileHandler(cfg *config.Config, logger *slog.Logger) http.Handler {
+func createFileHandler(cfg *config.Config, archives *handler.ArchiveCache, versions *handler.VersionStore,
+	scrubber *handler.Scrubber, logger *slog.Logger,
+) (http.Handler, error) {
 	if len(cfg.Dirs) > 1 {
-		return handler.NewMultiDir(cfg.Dirs, cfg, logger)
+		multi := handler.NewMultiDir(cfg.Dirs, cfg, logger)
+		if archives != nil {
+			multi.SetArchiveCache(archives)
+		}
+		if versions != nil {
+			multi.SetVersions(versions)
+		}
+		if scrubber != nil {
+			multi.SetScrubber(scrubber)
+		}
+		return multi, nil
 	}
 
-	fs := filesystem.NewLocal(getRootDir(cfg), cfg.ShowHidden)
+	mount := config.DirMount{Path: "/", Dir: getRootDir(cfg)}
+	if len(cfg.Dirs) == 1 {
+		mount = cfg.Dirs[0]
+	}
+	var hot *filesystem.HotCache
+	if cfg.HotCacheSize > 0 && !mount.IsRemote() {
+		hot = filesystem.NewHotCache(cfg.HotCacheSize, cfg.HotCacheMaxFileSize)
+	}
+	fs, err := handler.NewMountFS(mount, cfg, hot)
+	if err != nil {
+		return nil, fmt.Errorf("mount %s: %w", mount.Path, err)
+	}
 	if cfg.Theme == "advanced" {
-		return handler.NewAdvancedFile(fs, cfg)
+		advanced := handler.NewAdvancedFile(fs, cfg)
+		advanced.SetQuota(cfg.Dirs[0].Quota)
+		advanced.SetHotCache(hot)
+		if archives != nil {
+			advanced.SetArchiveCache(archives, getRootDir(cfg))
+		}
+		if versions != nil {
+			advanced.SetVersions(versions)
+		}
+		if scrubber != nil {
+			advanced.SetScrubber(scrubber, cfg.Dirs[0].Path)
+		}
+		return advanced, nil
 	}
-	return handler.NewFile(fs, cfg, logger)
+	return handler.NewFile(fs, cfg, logger), nil
 }
 
 func createWebDAVHandler(cfg *config.Config, logger *slog.Logger) http.Handler {
 	if !cfg.EnableWebDAV {
 		return nil
 	}
+	if len(cfg.Dirs) > 0 && cfg.Dirs[0].IsRemote() {
+		logger.Warn("WebDAV cannot serve a remote mount and is disabled",
+			slog.String("webdav_mount", cfg.Dirs[0].Path))
+		return nil
+	}
 
-	fs := filesystem.NewLocal(getRootDir(cfg), cfg.ShowHidden)
+	fs := handler.BlockSensitive(filesystem.NewLocal(getRootDir(cfg), cfg.ShowHidden), cfg)
 	if len(cfg.Dirs) > 1 {
 		logger.Warn("WebDAV only serves the first mounted directory",
 			slog.String("webdav_root", cfg.Dirs[0].Dir),
 			slog.String("webdav_mount", cfg.Dirs[0].Path))
 	}
-	logger.Info("WebDAV server enabled on /dav path (read-only)")
+	if cfg.WebDAVOnly() {
+		logger.Info("WebDAV server enabled at the root (read-only); HTML listings are disabled")
+	} else {
+		logger.Info("WebDAV server enabled (read-only)", slog.String("prefix", cfg.DAVPrefix()))
+	}
 	return handler.NewWebDAV(fs, cfg, logger)
 }
 
+// serverURL returns the address path can be reached at from other machines,
+// using a LAN address when the server listens on all of them.
+func serverURL(cfg *config.Config, path string) string {
+	if len(cfg.ACMEDomains) > 0 {
+		host := cfg.ACMEDomains[0]
+		if cfg.Port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+		}
+		return "https://" + host + cfg.BaseURL + path
+	}
+	host := handler.LANHost(cfg.Host, cfg.Host)
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Port)) + cfg.BaseURL + path
+}
+
+// printQR writes a QR code of url for the terminal to w, followed by url.
+func printQR(w io.Writer, url string) error {
+	code, err := qrcode.Encode([]byte(url), qrcode.M)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", code.Terminal(), url)
+	return err
+}
+
+// startManifestWriters keeps SHA256SUMS current at the root of every writable
+// mount until ctx is done.
+func startManifestWriters(ctx context.Context, cfg *config.Config, logger *slog.Logger) {
+	for _, mount := range cfg.Dirs {
+		if mount.AliasOf != "" {
+			continue // Its target writes the manifest
+		}
+		if mount.Readonly {
+			logger.Info("Skipping manifest writer for read-only mount", slog.String("path", mount.Path))
+			continue
+		}
+		fs := filesystem.NewLocal(mount.Dir, cfg.ShowHidden)
+		writer := handler.NewManifestWriter(fs, cfg, logger.With(slog.String("mount", mount.Path)),
+			constants.ManifestWriteInterval)
+		go writer.Run(ctx)
+	}
+}
+
+// newScrubber checks every mount for corrupted files. It reads the disk
+// directly, past any in-memory cache; aliases are checked as their target,
+// and remote mounts by the server that has them.
+func newScrubber(cfg *config.Config, logger *slog.Logger) (*handler.Scrubber, error) {
+	scrubber, err := handler.NewScrubber(cfg.ScrubDir, cfg.ScrubRate, cfg.ShowHidden,
+		logger.With(slog.String("component", "scrub")))
+	if err != nil {
+		return nil, err
+	}
+	for _, mount := range cfg.Dirs {
+		if mount.AliasOf != "" || mount.IsRemote() {
+			continue
+		}
+		scrubber.AddMount(mount.Path, filesystem.NewLocal(mount.Dir, cfg.ShowHidden))
+	}
+	return scrubber, nil
+}
+
 func getRootDir(cfg *config.Config) string {
 	if len(cfg.Dirs) > 0 {
 		return cfg.Dirs[0].Dir
@@ -278,12 +1258,42 @@ func getRootDir(cfg *config.Config) string {
 	return "."
 }
 
-func logStartupInfo(logger *slog.Logger, cfg *config.Config, authEnabled bool) {
+// logStartupInfo logs the effective configuration. Credentials are never
+// logged; authSource only records where they came from.
+func logStartupInfo(logger *slog.Logger, cfg *config.Config, authSource string) {
 	baseAttrs := []slog.Attr{
 		slog.String("version", version),
 		slog.String("address", cfg.Address()),
-		slog.Bool("auth_enabled", authEnabled),
+		slog.Bool("auth_enabled", authSource != ""),
 		slog.Bool("webdav_enabled", cfg.EnableWebDAV),
+		slog.Bool("readonly", cfg.Readonly),
+	}
+	if authSource != "" {
+		baseAttrs = append(baseAttrs, slog.String("auth_source", authSource))
+	}
+	if cfg.MaxRequests > 0 {
+		baseAttrs = append(baseAttrs, slog.Int("max_requests", cfg.MaxRequests))
+	}
+	if cfg.ShutdownAfter > 0 {
+		baseAttrs = append(baseAttrs, slog.Duration("timeout", cfg.ShutdownAfter))
+	}
+	if cfg.HotCacheSize > 0 {
+		baseAttrs = append(baseAttrs, slog.Int64("hot_cache_size", cfg.HotCacheSize))
+	}
+	if cfg.LogPathMode != "" && cfg.LogPathMode != config.LogPathFull {
+		baseAttrs = append(baseAttrs, slog.String("log_path_mode", cfg.LogPathMode))
+	}
+	if len(cfg.ACMEDomains) > 0 {
+		baseAttrs = append(baseAttrs, slog.Any("acme_domains", cfg.ACMEDomains))
+	}
+	if cfg.BlockSensitive {
+		baseAttrs = append(baseAttrs, slog.Bool("block_sensitive", true))
+	}
+	if cfg.Snapshot {
+		baseAttrs = append(baseAttrs, slog.Bool("snapshot", true))
+		if cfg.SnapshotFile != "" {
+			baseAttrs = append(baseAttrs, slog.String("snapshot_file", cfg.SnapshotFile))
+		}
 	}
 
 	if len(cfg.Dirs) > 1 {
@@ -299,8 +1309,56 @@ func logStartupInfo(logger *slog.Logger, cfg *config.Config, authEnabled bool) {
 	logger.LogAttrs(context.Background(), slog.LevelInfo, "Starting gofs server", baseAttrs...)
 }
 
-// performHealthCheck performs a lightweight health check via HTTP
-func performHealthCheck() error {
+// warnSensitive reports the files that usually hold secrets found near the
+// root of each local mount: as served unless --block-sensitive is given,
+// and as blocked otherwise. Aliases are reported as their target.
+func warnSensitive(logger *slog.Logger, cfg *config.Config) {
+	for _, mount := range cfg.Dirs {
+		if mount.AliasOf != "" || mount.IsRemote() {
+			continue
+		}
+		scan, err := handler.ScanSensitive(mount.Dir, cfg.SensitivePatterns)
+		if err != nil {
+			logger.Debug("Cannot scan for sensitive files", slog.String("path", mount.Path),
+				slog.String("error", err.Error()))
+			continue
+		}
+		if len(scan.Matches) == 0 {
+			continue
+		}
+		attrs := []any{
+			slog.String("path", mount.Path),
+			slog.String("dir", mount.Dir),
+			slog.Any("files", scan.Matches),
+		}
+		if scan.Truncated {
+			attrs = append(attrs, slog.Bool("truncated", true))
+		}
+		if cfg.BlockSensitive {
+			logger.Warn("Sensitive files found in a mount; they are neither listed nor served", attrs...)
+		} else {
+			logger.Warn("SENSITIVE FILES ARE BEING SERVED; pass --block-sensitive to hide them", attrs...)
+		}
+	}
+}
+
+// logAccess tells how other machines can reach the server: a hint when it
+// only listens on loopback, otherwise a ready-to-copy URL per address.
+func logAccess(logger *slog.Logger, cfg *config.Config) {
+	access := handler.Access(cfg)
+	if access.LocalOnly {
+		logger.Info("Only reachable from this machine; use --host 0.0.0.0 to serve other devices on your network",
+			slog.String("host", cfg.Host))
+		return
+	}
+	for _, url := range access.URLs {
+		logger.Info("Reachable from other machines", slog.String("url", url))
+	}
+}
+
+// performHealthCheck asks the local server's /healthz whether it is alive
+// and returns what it reported.
+func performHealthCheck() (server.Health, error) {
 	// Default health check endpoint
 	healthURL := "http://127.0.0.1:8000/healthz"
 
@@ -312,25 +1370,34 @@ func performHealthCheck() error {
 		}
 		healthURL = fmt.Sprintf("http://%s:%s/healthz", host, port)
 	}
+	return fetchHealth(healthURL)
+}
+
+// fetchHealth gets and decodes the health report at healthURL.
+func fetchHealth(healthURL string) (server.Health, error) {
+	var health server.Health
 
 	// Create HTTP client with timeout
 	client := &http.Client{
-		Timeout: 5 * time.Second,
+		Timeout: constants.HealthCheckTimeout,
 	}
 
 	// Perform health check request
 	resp, err := client.Get(healthURL)
 	if err != nil {
-		return fmt.Errorf("health check request failed: %w", err)
+		return health, fmt.Errorf("health check request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("health check failed with status: %d", resp.StatusCode)
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&health); err != nil {
+		return health, fmt.Errorf("health check returned an unreadable response (status %d): %w", resp.StatusCode, err)
 	}
 
-	return nil
+	// Check response status
+	if resp.StatusCode != http.StatusOK || health.Status != server.HealthOK {
+		return health, fmt.Errorf("health check failed with status: %d %s", resp.StatusCode, health.Status)
+	}
+	return health, nil
 }
 
 // setupLogger creates a logger with environment-based configuration
@@ -359,27 +1426,18 @@ func parseLogLevel(level string) slog.Level {
 	}
 }
 
-type HealthResult struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Error     string    `json:"error,omitempty"`
-}
-
+// performHealthCheckAndExit prints a one-line summary of the health check.
 func performHealthCheckAndExit() error {
-	if err := performHealthCheck(); err != nil {
-		result := HealthResult{
-			Status:    "FAILED",
-			Timestamp: time.Now(),
-			Error:     err.Error(),
-		}
-		_ = json.NewEncoder(os.Stdout).Encode(result)
+	health, err := performHealthCheck()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gofs is not healthy: %v\n", err)
 		return err
 	}
-
-	result := HealthResult{
-		Status:    "OK",
-		Timestamp: time.Now(),
-	}
-	_ = json.NewEncoder(os.Stdout).Encode(result)
+	fmt.Println(healthSummary(health))
 	return nil
 }
+
+// healthSummary describes a healthy server for people.
+func healthSummary(health server.Health) string {
+	return fmt.Sprintf("gofs %s is %s, up %s", health.Version, health.Status, health.Uptime)
+}
@@ -1,8 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/server"
 )
 
 func TestGetEnvString(t *testing.T) {
@@ -193,6 +204,27 @@ func TestGetEnvBool(t *testing.T) {
 	}
 }
 
+func TestGetEnvDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		expected time.Duration
+	}{
+		{name: "returns default when env var is empty", envValue: "", expected: 30 * time.Second},
+		{name: "returns parsed duration when valid", envValue: "90s", expected: 90 * time.Second},
+		{name: "returns default when env var is invalid", envValue: "soon", expected: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_DURATION", tt.envValue)
+			if result := getEnv("TEST_DURATION", 30*time.Second); result != tt.expected {
+				t.Errorf("getEnv[time.Duration]() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestSetupLogger(t *testing.T) {
 	// Test default logger creation
 	logger := setupLogger()
@@ -223,3 +255,225 @@ func TestSetupLogger(t *testing.T) {
 		})
 	}
 }
+
+// startTestServer runs srv through runServer on a free local port and
+// returns its base URL and a channel receiving runServer's exit code.
+func startTestServer(t *testing.T, cfg *config.Config, h http.Handler) (string, <-chan int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	cfg.Port = listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := server.New(cfg, h, nil, nil, logger)
+	exit := make(chan int, 1)
+	go func() { exit <- runServer(srv, cfg, make(chan os.Signal), func() {}, logger) }()
+
+	base := "http://" + cfg.Address()
+	// The probe leaves no connection behind to hold up a later shutdown
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	defer client.CloseIdleConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.Get(base + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			return base, exit
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newServeLimitConfig(t *testing.T) *config.Config {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "report.pdf"), []byte("report"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	cfg, err := config.New(0, "127.0.0.1", "", "default", false, []string{root})
+	if err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+	return cfg
+}
+
+func newTestFileHandler(t *testing.T, cfg *config.Config, logger *slog.Logger) http.Handler {
+	t.Helper()
+	h, err := createFileHandler(cfg, nil, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("Failed to create file handler: %v", err)
+	}
+	return h
+}
+
+func TestRunServer_MaxRequests(t *testing.T) {
+	cfg := newServeLimitConfig(t)
+	cfg.MaxRequests = 2
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	base, exit := startTestServer(t, cfg, newTestFileHandler(t, cfg, logger))
+	// Without keep-alives no idle connection holds up the shutdown
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	defer client.CloseIdleConnections()
+
+	get := func(path string) int {
+		resp, err := client.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode
+	}
+
+	// Listings, health checks and missing files are not downloads
+	for _, path := range []string{"/", "/healthz", "/missing.pdf", "/report.pdf"} {
+		if status := get(path); path != "/missing.pdf" && status != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, status)
+		}
+	}
+	select {
+	case code := <-exit:
+		t.Fatalf("server stopped after one download with exit code %d", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	get("/report.pdf")
+	select {
+	case code := <-exit:
+		if code != 0 {
+			t.Errorf("expected exit code 0, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down after the second download")
+	}
+	if _, err := client.Get(base + "/healthz"); err == nil {
+		t.Error("expected the server to stop listening")
+	}
+}
+
+func TestRunServer_Timeout(t *testing.T) {
+	cfg := newServeLimitConfig(t)
+	cfg.ShutdownAfter = 200 * time.Millisecond
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, exit := startTestServer(t, cfg, newTestFileHandler(t, cfg, logger))
+
+	select {
+	case code := <-exit:
+		if code != 0 {
+			t.Errorf("expected exit code 0, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down after the timeout")
+	}
+}
+
+func TestServerURL(t *testing.T) {
+	cfg := &config.Config{Host: "127.0.0.1", Port: 8000, BaseURL: "/files"}
+	if got := serverURL(cfg, "/tok/a.txt"); got != "http://127.0.0.1:8000/files/tok/a.txt" {
+		t.Errorf("unexpected URL %s", got)
+	}
+	cfg.Host = "0.0.0.0"
+	if got := serverURL(cfg, "/"); strings.Contains(got, "0.0.0.0") || !strings.HasSuffix(got, ":8000/files/") {
+		t.Errorf("expected a reachable address, got %s", got)
+	}
+	cfg.ACMEDomains = []string{"files.example.com"}
+	cfg.Port = 443
+	if got := serverURL(cfg, "/tok/a.txt"); got != "https://files.example.com/files/tok/a.txt" {
+		t.Errorf("unexpected URL %s", got)
+	}
+}
+
+func TestPrintQR(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printQR(&buf, "http://192.168.1.20:8000/"); err != nil {
+		t.Fatalf("printQR failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) < 10 || lines[len(lines)-1] != "http://192.168.1.20:8000/" {
+		t.Errorf("expected a QR code followed by the URL, got %q", buf.String())
+	}
+	if err := printQR(&buf, strings.Repeat("x", 3000)); err == nil {
+		t.Error("expected an error for a URL too long to encode")
+	}
+}
+
+func TestWarnSensitive(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		".env":             "TOKEN=1",
+		"id_rsa":           "key",
+		"certs/server.pem": "key",
+		"readme.txt":       "hello",
+	} {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	patterns, err := config.ParseSensitivePatterns(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Dirs: []config.DirMount{
+			{Dir: root, Path: "/files"},
+			{Dir: t.TempDir(), Path: "/empty"},
+		},
+		SensitivePatterns: patterns,
+	}
+
+	for _, block := range []bool{false, true} {
+		cfg.BlockSensitive = block
+		var buf bytes.Buffer
+		warnSensitive(slog.New(slog.NewTextHandler(&buf, nil)), cfg)
+		out := buf.String()
+		if strings.Count(out, "level=WARN") != 1 {
+			t.Fatalf("expected one warning for the mount with secrets, got %q", out)
+		}
+		for _, want := range []string{"path=/files", "/.env", "/id_rsa", "/certs/server.pem"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected the warning to mention %s, got %q", want, out)
+			}
+		}
+		if strings.Contains(out, "readme.txt") {
+			t.Errorf("expected only sensitive files in the warning, got %q", out)
+		}
+		if hint := strings.Contains(out, "--block-sensitive"); hint == block {
+			t.Errorf("block=%v: expected the --block-sensitive hint only while secrets are served, got %q", block, out)
+		}
+	}
+}
+
+func TestFetchHealth(t *testing.T) {
+	cfg := newServeLimitConfig(t)
+	cfg.Version = "1.2.3"
+	base, _ := startTestServer(t, cfg, http.NotFoundHandler())
+
+	health, err := fetchHealth(base + "/healthz")
+	if err != nil {
+		t.Fatalf("Expected a healthy server: %v", err)
+	}
+	if got := healthSummary(health); !strings.HasPrefix(got, "gofs 1.2.3 is ok, up ") {
+		t.Errorf("Unexpected summary %q", got)
+	}
+
+	// Readiness fails once a mount is gone
+	if err := os.RemoveAll(cfg.Dirs[0].Dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchHealth(base + "/readyz"); err == nil || !strings.Contains(err.Error(), "503 unavailable") {
+		t.Errorf("Expected readiness to fail, got %v", err)
+	}
+	if _, err := fetchHealth(base + "/missing"); err == nil {
+		t.Error("Expected a response that is not a health report to fail")
+	}
+}
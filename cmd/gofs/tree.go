@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/samzong/gofs/internal/handler"
+)
+
+// treeReport is what gofs tree --json prints.
+type treeReport struct {
+	Mounts []mountTree `json:"mounts"`
+}
+
+type mountTree struct {
+	Path    string              `json:"path"`
+	Dir     string              `json:"dir"`
+	Entries []handler.TreeEntry `json:"entries"`
+	Error   string              `json:"error,omitempty"` // Why the mount was not walked
+}
+
+// printTree walks every mount of the configuration flags describe and
+// prints what requests could reach, as a tree or, with --json, as JSON.
+// With --explain, entries that are not served are shown with the reason.
+// It returns the process exit code.
+func printTree(flags *cmdFlags, stdout, stderr io.Writer) int {
+	cfg, err := buildConfig(flags)
+	if err != nil {
+		fmt.Fprintln(stderr, startupErrorMessage(err))
+		return 1
+	}
+
+	report := treeReport{Mounts: []mountTree{}}
+	code := 0
+	for _, mount := range cfg.Dirs {
+		m := mountTree{Path: mount.Path, Dir: mount.Dir, Entries: []handler.TreeEntry{}}
+		if mount.IsRemote() {
+			m.Error = "remote mounts are not walked"
+		} else if m.Entries, err = handler.NewVisibility(mount, cfg).Tree(flags.TreeExplain); err != nil {
+			m.Error = err.Error()
+			code = 1
+		}
+		report.Mounts = append(report.Mounts, m)
+	}
+
+	if flags.TreeJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(stderr, "Cannot write the tree: %v\n", err)
+			return 1
+		}
+		return code
+	}
+	for i, m := range report.Mounts {
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		fmt.Fprintf(stdout, "%s (%s)\n", m.Path, m.Dir)
+		if m.Error != "" {
+			fmt.Fprintf(stdout, "  %s\n", m.Error)
+			continue
+		}
+		writeTree(stdout, m.Entries, "")
+	}
+	return code
+}
+
+// writeTree prints entries the way tree(1) does, with directories suffixed
+// by a slash, symlinks by their target and hidden entries by the reason.
+func writeTree(w io.Writer, entries []handler.TreeEntry, indent string) {
+	for i, e := range entries {
+		branch, next := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, next = "└── ", "    "
+		}
+		line := e.Name
+		if e.IsDir {
+			line += "/"
+		}
+		if e.Symlink != "" {
+			line += " -> " + e.Symlink
+		}
+		if e.Hidden != "" {
+			line += "  [hidden: " + e.Hidden + "]"
+		}
+		fmt.Fprintln(w, indent+branch+line)
+		writeTree(w, e.Children, indent+next)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samzong/gofs/internal/handler"
+)
+
+// treeFixture builds a directory with hidden, denied, dir-config hidden and
+// symlinked entries.
+func treeFixture(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"readme.txt":        "a",
+		"docs/guide.md":     "b",
+		"secret/.gofs.yaml": "hidden: true\n",
+		"secret/keys.txt":   "c",
+		".git/config":       "d",
+		".profile":          "e",
+	} {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("docs/guide.md", filepath.Join(root, "guide")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.TempDir(), filepath.Join(root, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestPrintTree(t *testing.T) {
+	root := treeFixture(t)
+	flags := defaultFlags(root)
+	flags.DirConfig = true
+
+	var stdout bytes.Buffer
+	if code := printTree(flags, &stdout, io.Discard); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	want := "/ (" + root + ")\n" +
+		"├── docs/\n" +
+		"│   └── guide.md\n" +
+		"├── guide -> docs/guide.md\n" +
+		"└── readme.txt\n"
+	if stdout.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, stdout.String())
+	}
+
+	flags.TreeExplain = true
+	stdout.Reset()
+	if code := printTree(flags, &stdout, io.Discard); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	want = "/ (" + root + ")\n" +
+		"├── .git/  [hidden: deny-path]\n" +
+		"├── docs/\n" +
+		"│   └── guide.md\n" +
+		"├── secret/  [hidden: dir-hidden]\n" +
+		"├── .profile  [hidden: hidden-file]\n" +
+		"├── guide -> docs/guide.md\n" +
+		"├── outside  [hidden: symlink]\n" +
+		"└── readme.txt\n"
+	if stdout.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, stdout.String())
+	}
+}
+
+func TestPrintTree_JSON(t *testing.T) {
+	root := treeFixture(t)
+	flags := defaultFlags(root, "/remote=https://files.example.com")
+	flags.ShowHidden = true
+	flags.TreeJSON = true
+	flags.TreeExplain = true
+
+	var stdout bytes.Buffer
+	if code := printTree(flags, &stdout, io.Discard); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	var report treeReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Tree is not JSON: %v\n%s", err, stdout.String())
+	}
+	if len(report.Mounts) != 2 || report.Mounts[1].Error == "" {
+		t.Fatalf("Expected the remote mount to be skipped, got %+v", report.Mounts)
+	}
+	hidden := map[string]string{}
+	for _, e := range report.Mounts[0].Entries {
+		hidden[e.Name] = e.Hidden
+	}
+	want := map[string]string{
+		".git":       handler.HiddenDenyPath,
+		".profile":   "",
+		"secret":     "",
+		"outside":    handler.HiddenSymlink,
+		"readme.txt": "",
+	}
+	for name, reason := range want {
+		if got, ok := hidden[name]; !ok || got != reason {
+			t.Errorf("%s: expected reason %q, got %q (present: %v)", name, reason, got, ok)
+		}
+	}
+}
+
+func TestPrintTree_InvalidConfig(t *testing.T) {
+	var stderr bytes.Buffer
+	if code := printTree(defaultFlags(filepath.Join(t.TempDir(), "missing")), io.Discard, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if stderr.Len() == 0 {
+		t.Error("Expected an error message")
+	}
+}
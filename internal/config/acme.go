@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseACMEDomains validates the host names given to --acme-domain and
+// returns them lower-cased and without duplicates. Certificates are only
+// requested for these names, so an empty list is an error.
+func ParseACMEDomains(domains []string) ([]string, error) {
+	seen := make(map[string]bool, len(domains))
+	var parsed []string
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+		if domain == "" {
+			continue
+		}
+		if err := validateACMEDomain(domain); err != nil {
+			return nil, err
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			parsed = append(parsed, domain)
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, errors.New("ACME needs at least one --acme-domain")
+	}
+	return parsed, nil
+}
+
+func validateACMEDomain(domain string) error {
+	if net.ParseIP(domain) != nil {
+		return fmt.Errorf("ACME domain %q: certificates cannot be issued for IP addresses", domain)
+	}
+	if strings.HasPrefix(domain, "*.") {
+		return fmt.Errorf("ACME domain %q: wildcards need a DNS-01 challenge, which is not supported", domain)
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 || len(domain) > 253 {
+		return fmt.Errorf("ACME domain %q is not a fully qualified host name", domain)
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("ACME domain %q is not a valid host name", domain)
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return fmt.Errorf("ACME domain %q contains %q; use an ASCII (punycode) host name", domain, c)
+			}
+		}
+	}
+	return nil
+}
+
+// DefaultACMECacheDir returns where certificates are kept when
+// --acme-cache-dir is not given: a gofs directory in the user's cache.
+func DefaultACMECacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gofs", "acme")
+}
+
+// CheckACMECacheDir creates the certificate cache directory if needed and
+// checks that it is writable. The cache holds private keys, so it must not
+// be inside a served directory.
+func CheckACMECacheDir(dir string, mounts []DirMount) error {
+	if dir == "" {
+		return errors.New("ACME needs a certificate cache directory, set --acme-cache-dir")
+	}
+	abs, err := outsideMounts("ACME cache directory", dir, mounts)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(abs, 0o700); err != nil {
+		return fmt.Errorf("ACME cache directory %s: %w", dir, err)
+	}
+	probe, err := os.CreateTemp(abs, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("ACME cache directory %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// outsideMounts returns the absolute form of dir, or an error naming it as
+// what if it lies inside one of mounts.
+func outsideMounts(what, dir string, mounts []DirMount) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", what, dir, err)
+	}
+	for _, mount := range mounts {
+		if mount.IsRemote() {
+			continue
+		}
+		root, err := filepath.Abs(mount.Dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s %s is inside the served directory %s", what, dir, mount.Dir)
+		}
+	}
+	return abs, nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestParseACMEDomains(t *testing.T) {
+	testCases := []struct {
+		in      []string
+		want    []string
+		wantErr bool
+	}{
+		{in: []string{"example.com"}, want: []string{"example.com"}},
+		{in: []string{" Files.Example.COM. ", "files.example.com", "b.example.org"},
+			want: []string{"files.example.com", "b.example.org"}},
+		{in: []string{"xn--bcher-kva.example"}, want: []string{"xn--bcher-kva.example"}},
+		{in: nil, wantErr: true},
+		{in: []string{"", " "}, wantErr: true},
+		{in: []string{"localhost"}, wantErr: true},
+		{in: []string{"203.0.113.7"}, wantErr: true},
+		{in: []string{"*.example.com"}, wantErr: true},
+		{in: []string{"https://example.com"}, wantErr: true},
+		{in: []string{"example.com:443"}, wantErr: true},
+		{in: []string{"-bad.example.com"}, wantErr: true},
+		{in: []string{"a..example.com"}, wantErr: true},
+		{in: []string{"bücher.example"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseACMEDomains(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseACMEDomains(%q): expected an error, got %q", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseACMEDomains(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestCheckACMECacheDir(t *testing.T) {
+	served := t.TempDir()
+	mounts := []DirMount{{Path: "/", Dir: served}}
+
+	t.Run("creates_missing_dir", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "certs", "acme")
+		if err := CheckACMECacheDir(dir, mounts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			t.Fatalf("expected the cache directory to be created: %v", err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o700 {
+			t.Errorf("expected mode 0700, got %v", info.Mode().Perm())
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("expected the write probe to be removed, found %v", entries)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if err := CheckACMECacheDir("", mounts); err == nil {
+			t.Error("expected an error for an empty cache directory")
+		}
+	})
+
+	t.Run("inside_served_dir", func(t *testing.T) {
+		for _, dir := range []string{served, filepath.Join(served, ".acme")} {
+			if err := CheckACMECacheDir(dir, mounts); err == nil {
+				t.Errorf("expected %s to be refused", dir)
+			}
+		}
+		sibling := served + "-acme"
+		t.Cleanup(func() { os.RemoveAll(sibling) })
+		if err := CheckACMECacheDir(sibling, mounts); err != nil {
+			t.Errorf("expected a sibling directory to be accepted: %v", err)
+		}
+	})
+
+	t.Run("not_writable", func(t *testing.T) {
+		if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+			t.Skip("permissions are not enforced")
+		}
+		dir := t.TempDir()
+		if err := os.Chmod(dir, 0o500); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = os.Chmod(dir, 0o700) })
+		if err := CheckACMECacheDir(dir, mounts); err == nil {
+			t.Error("expected an error for a read-only directory")
+		}
+	})
+
+	t.Run("path_is_file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(file, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckACMECacheDir(file, mounts); err == nil {
+			t.Error("expected an error when the cache path is a file")
+		}
+	})
+}
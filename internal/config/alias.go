@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ApplyAliases appends a mount for each "path=target" specification, as given
+// to --alias. An alias serves the directory of the mount at target under
+// another path, with the same options and a name derived from its own path;
+// the server shares one filesystem and handler between them. target must be a
+// -d mount, not another alias.
+func ApplyAliases(dirs []DirMount, specs []string) ([]DirMount, error) {
+	for _, spec := range specs {
+		aliasPath, target, ok := strings.Cut(spec, "=")
+		aliasPath, target = strings.TrimSpace(aliasPath), strings.TrimSpace(target)
+		if !ok || aliasPath == "" || target == "" {
+			return nil, fmt.Errorf("alias %q: expected path=target", spec)
+		}
+
+		var mount *DirMount
+		for i := range dirs {
+			if dirs[i].AliasOf == "" && strings.TrimSuffix(dirs[i].Path, "/") == strings.TrimSuffix(target, "/") {
+				mount = &dirs[i]
+				break
+			}
+		}
+		if mount == nil {
+			return nil, fmt.Errorf("alias %q: no mount at path %q", spec, target)
+		}
+
+		alias := *mount
+		alias.Path = aliasPath
+		alias.Name = defaultMountName(aliasPath)
+		alias.Spec = ""
+		alias.AliasOf = mount.Path
+		dirs = append(dirs, alias)
+	}
+	if err := validateMounts(dirs); err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyAliases(t *testing.T) {
+	dirs := []DirMount{
+		{Path: "/latest", Dir: "/srv/releases/v2.3", Readonly: true, Name: "Latest", Spec: "/latest:/srv/releases/v2.3:ro"},
+		{Path: "/logs", Dir: "/var/log", Quota: 1 << 20},
+	}
+	got, err := ApplyAliases(dirs, []string{"/v2.3=/latest", " /old-logs = /logs/ "})
+	if err != nil {
+		t.Fatalf("ApplyAliases: %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected two alias mounts, got %+v", got)
+	}
+	want := DirMount{Path: "/v2.3", Dir: "/srv/releases/v2.3", Readonly: true, Name: "v2.3", AliasOf: "/latest"}
+	if got[2] != want {
+		t.Errorf("got %+v, want %+v", got[2], want)
+	}
+	if got[3].Path != "/old-logs" || got[3].Quota != 1<<20 || got[3].AliasOf != "/logs" {
+		t.Errorf("expected the alias to keep the target's options, got %+v", got[3])
+	}
+}
+
+func TestApplyAliases_Errors(t *testing.T) {
+	dirs := []DirMount{{Path: "/latest", Dir: "/srv/v2.3"}, {Path: "/logs", Dir: "/var/log"}}
+	testCases := []struct {
+		name  string
+		specs []string
+		want  string
+	}{
+		{name: "no target", specs: []string{"/v2.3"}, want: "expected path=target"},
+		{name: "empty path", specs: []string{"=/latest"}, want: "expected path=target"},
+		{name: "unknown target", specs: []string{"/v2.3=/nope"}, want: "no mount"},
+		{name: "alias of alias", specs: []string{"/v2.3=/latest", "/stable=/v2.3"}, want: "no mount"},
+		{name: "taken path", specs: []string{"/logs=/latest"}, want: "path conflict"},
+		{name: "relative path", specs: []string{"v2.3=/latest"}, want: "must start with /"},
+		{name: "traversal", specs: []string{"/a/../b=/latest"}, want: "invalid mount path"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ApplyAliases(dirs, tc.specs)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+	if len(dirs) != 2 {
+		t.Errorf("ApplyAliases modified its input: %+v", dirs)
+	}
+}
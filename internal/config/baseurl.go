@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ParseBasePath validates the path prefix gofs is served under behind a
+// reverse proxy, as given to --base-url, and returns it without a trailing
+// slash. An empty path or "/" means the server root and returns "".
+func ParseBasePath(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "/" {
+		return "", nil
+	}
+	return parseURLPath("base URL", s)
+}
+
+// parseURLPath checks that s is a clean absolute URL path made of letters,
+// digits and -._~ and returns it without a trailing slash. what names the
+// setting in errors.
+func parseURLPath(what, s string) (string, error) {
+	if !strings.HasPrefix(s, "/") {
+		return "", fmt.Errorf("%s %q must be a path starting with /", what, s)
+	}
+	trimmed := strings.TrimSuffix(s, "/")
+	if path.Clean(trimmed) != trimmed {
+		return "", fmt.Errorf("%s %q is not a clean path", what, s)
+	}
+	for _, c := range trimmed {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("/-._~", c):
+		default:
+			return "", fmt.Errorf("%s %q contains %q; use letters, digits and -._~", what, s, c)
+		}
+	}
+	return trimmed, nil
+}
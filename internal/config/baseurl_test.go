@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestParseBasePath(t *testing.T) {
+	testCases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "/", want: ""},
+		{in: "/files", want: "/files"},
+		{in: "/files/", want: "/files"},
+		{in: " /a/b-c_d.e~f ", want: "/a/b-c_d.e~f"},
+		{in: "files", wantErr: true},
+		{in: "https://example.com/files", wantErr: true},
+		{in: "//files", wantErr: true},
+		{in: "/a/../b", wantErr: true},
+		{in: "/files?x=1", wantErr: true},
+		{in: "/my files", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseBasePath(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseBasePath(%q): expected an error, got %q", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseBasePath(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CacheControlRule maps glob patterns to a Cache-Control directive.
+type CacheControlRule struct {
+	Patterns  []string // path.Match globs, e.g. "*.js"
+	Directive string   // e.g. "public, max-age=86400"
+}
+
+// ParseCacheControlRule parses a rule of the form "pattern[,pattern...]=directive",
+// e.g. "*.js,*.css=public,max-age=86400". Everything after the first "=" is
+// the directive, so directives may themselves contain commas and "=".
+// Patterns without a "/" match the file name; patterns with one match the
+// slash-separated path within the mount.
+func ParseCacheControlRule(spec string) (CacheControlRule, error) {
+	patternList, directive, ok := strings.Cut(spec, "=")
+	if !ok {
+		return CacheControlRule{}, fmt.Errorf("cache-control rule %q: expected patterns=directive", spec)
+	}
+
+	var rule CacheControlRule
+	for _, pattern := range strings.Split(patternList, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			return CacheControlRule{}, fmt.Errorf("cache-control rule %q: empty pattern", spec)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return CacheControlRule{}, fmt.Errorf("cache-control rule %q: invalid pattern %q: %w", spec, pattern, err)
+		}
+		rule.Patterns = append(rule.Patterns, pattern)
+	}
+
+	directive, err := normalizeCacheDirective(directive)
+	if err != nil {
+		return CacheControlRule{}, fmt.Errorf("cache-control rule %q: %w", spec, err)
+	}
+	rule.Directive = directive
+	return rule, nil
+}
+
+// ParseCacheControlRules parses each spec in order; earlier rules take
+// precedence when several match.
+func ParseCacheControlRules(specs []string) ([]CacheControlRule, error) {
+	rules := make([]CacheControlRule, 0, len(specs))
+	for _, spec := range specs {
+		rule, err := ParseCacheControlRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ParseCacheControlDirective validates a standalone directive such as the
+// default applied when no rule matches. An empty directive is allowed and
+// means no Cache-Control header.
+func ParseCacheControlDirective(directive string) (string, error) {
+	if strings.TrimSpace(directive) == "" {
+		return "", nil
+	}
+	return normalizeCacheDirective(directive)
+}
+
+// normalizeCacheDirective checks every comma-separated directive is a token
+// optionally followed by =value, and rejoins them in canonical form.
+func normalizeCacheDirective(directive string) (string, error) {
+	var parts []string
+	for _, part := range strings.Split(directive, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(part, "=")
+		if !isHeaderToken(name) {
+			return "", fmt.Errorf("invalid directive %q", part)
+		}
+		if (hasValue && value == "") || strings.ContainsAny(value, " \t\r\n") {
+			return "", fmt.Errorf("invalid directive %q", part)
+		}
+		parts = append(parts, strings.ToLower(name)+strings.TrimPrefix(part, name))
+	}
+	if len(parts) == 0 {
+		return "", errors.New("empty directive")
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+func isHeaderToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CacheControlFor returns the Cache-Control directive for the file at name
+// (a slash-separated path within its mount): the first matching rule wins,
+// otherwise CacheControlDefault applies.
+func (c *Config) CacheControlFor(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	base := path.Base(name)
+	for _, rule := range c.CacheControl {
+		for _, pattern := range rule.Patterns {
+			subject := base
+			if strings.Contains(pattern, "/") {
+				subject = name
+			}
+			if ok, _ := path.Match(pattern, subject); ok {
+				return rule.Directive
+			}
+		}
+	}
+	return c.CacheControlDefault
+}
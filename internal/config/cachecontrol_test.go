@@ -0,0 +1,101 @@
+package config
+
+import "testing"
+
+func TestParseCacheControlRule(t *testing.T) {
+	testCases := []struct {
+		name      string
+		spec      string
+		patterns  []string
+		directive string
+		wantErr   bool
+	}{
+		{
+			name:      "multiple patterns",
+			spec:      "*.js,*.css=public,max-age=86400",
+			patterns:  []string{"*.js", "*.css"},
+			directive: "public, max-age=86400",
+		},
+		{name: "catch all", spec: "*=no-cache", patterns: []string{"*"}, directive: "no-cache"},
+		{name: "path pattern", spec: "assets/*=Immutable", patterns: []string{"assets/*"}, directive: "immutable"},
+		{name: "missing directive", spec: "*.js", wantErr: true},
+		{name: "empty directive", spec: "*.js=", wantErr: true},
+		{name: "empty pattern", spec: "*.js,=no-cache", wantErr: true},
+		{name: "invalid pattern", spec: "[=no-cache", wantErr: true},
+		{name: "invalid directive", spec: "*=max age=10", wantErr: true},
+		{name: "empty value", spec: "*=max-age=", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParseCacheControlRule(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %+v", tc.spec, rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(rule.Patterns) != len(tc.patterns) {
+				t.Fatalf("expected patterns %v, got %v", tc.patterns, rule.Patterns)
+			}
+			for i := range tc.patterns {
+				if rule.Patterns[i] != tc.patterns[i] {
+					t.Errorf("expected patterns %v, got %v", tc.patterns, rule.Patterns)
+				}
+			}
+			if rule.Directive != tc.directive {
+				t.Errorf("expected directive %q, got %q", tc.directive, rule.Directive)
+			}
+		})
+	}
+}
+
+func TestConfig_CacheControlFor(t *testing.T) {
+	rules, err := ParseCacheControlRules([]string{
+		"index.html=no-cache",
+		"*.js,*.css=public,max-age=86400",
+		"docs/*.html=public,max-age=60",
+		"*.html=private",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &Config{CacheControl: rules, CacheControlDefault: "no-store"}
+
+	testCases := []struct {
+		path string
+		want string
+	}{
+		{path: "/app.js", want: "public, max-age=86400"},
+		{path: "static/site.css", want: "public, max-age=86400"},
+		{path: "/index.html", want: "no-cache"},     // earlier rule beats *.html
+		{path: "docs/index.html", want: "no-cache"}, // name rule listed before path rule
+		{path: "docs/guide.html", want: "public, max-age=60"},
+		{path: "other/guide.html", want: "private"},
+		{path: "/data.bin", want: "no-store"},
+	}
+	for _, tc := range testCases {
+		if got := cfg.CacheControlFor(tc.path); got != tc.want {
+			t.Errorf("CacheControlFor(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+
+	if got := (&Config{}).CacheControlFor("a.js"); got != "" {
+		t.Errorf("expected no directive without rules, got %q", got)
+	}
+}
+
+func TestParseCacheControlDirective(t *testing.T) {
+	if got, err := ParseCacheControlDirective(""); err != nil || got != "" {
+		t.Errorf("expected empty default to be allowed, got %q, %v", got, err)
+	}
+	if got, err := ParseCacheControlDirective("public,max-age=60"); err != nil || got != "public, max-age=60" {
+		t.Errorf("unexpected result %q, %v", got, err)
+	}
+	if _, err := ParseCacheControlDirective("max age"); err == nil {
+		t.Error("expected error for invalid directive")
+	}
+}
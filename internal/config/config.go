@@ -3,9 +3,13 @@ package config
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal/constants"
 )
 
 var validThemes = map[string]bool{
@@ -16,25 +20,119 @@ var validThemes = map[string]bool{
 // DirMount represents a directory mount configuration
 type DirMount struct {
 	Path     string // URL path prefix (e.g., "/config")
-	Dir      string // Local directory path
+	Dir      string // Local directory path, or the URL of a remote gofs server
 	Readonly bool   // Whether the mount is read-only
 	Name     string // Display name for UI
+	Spec     string // Original -d argument, quoted verbatim in errors
+	Quota    int64  // Maximum bytes stored under the mount; 0 is unlimited
+	AliasOf  string // Path of the mount this one serves again under Path; "" for -d mounts
+	// Place among the mounts on the root page and for the root redirect;
+	// lower weights come first, equal ones by name
+	Weight int
+	// user:password sent to a remote mount, from --remote-auth
+	Credentials string
 }
 
 type Config struct {
-	Host           string
-	Dir            string     // Legacy single directory support
-	Dirs           []DirMount // Multi-directory support
-	Port           int
-	MaxFileSize    int64
-	RequestTimeout int
-	EnableSecurity bool
-	Theme          string
-	ShowHidden     bool
-	EnableWebDAV   bool
+	Host                  string
+	Dir                   string     // Legacy single directory support
+	Dirs                  []DirMount // Multi-directory support
+	DefaultMount          string     // Path of the mount the root redirects to; "" picks the first by weight
+	Port                  int
+	MaxUploadSize         int64 // Largest file an upload may store
+	MaxHashSize           int64 // Largest file hashed for a content ETag
+	DigestHeaders         bool  // Send Content-Digest or Repr-Digest when a file's ETag is its SHA-256
+	MaxDownloadSize       int64 // Largest file served for download; 0 is unlimited
+	RequestTimeout        int
+	EnableSecurity        bool
+	Theme                 string
+	ShowHidden            bool
+	EnableWebDAV          bool
+	WebDAVPrefix          string             // Path WebDAV is served under; "/" serves only WebDAV, "" is /dav
+	WebDAVFakeLocks       bool               // Grant LOCK/UNLOCK without recording them so Finder can mount
+	SkipDirCheck          bool               // Skip filesystem checks of mount directories at startup
+	AuthMode              string             // "none", "all" or "write-only"; reported to API clients
+	Version               string             // Build version reported to API clients
+	DebugErrors           bool               // Include underlying errors in response bodies (development only)
+	ShowPrecompressed     bool               // List .gz/.br sidecar files next to the files they encode
+	MaxConcurrentUploads  int                // Upload slots per advanced handler; 0 uses the default
+	UploadLockWait        time.Duration      // Wait for an upload to the same path; 0 answers 409 at once
+	WriteManifests        bool               // Periodically write SHA256SUMS at the root of writable mounts
+	BehindTLSProxy        bool               // A reverse proxy terminates TLS, so send HSTS on plain HTTP
+	HSTSMaxAge            int                // Strict-Transport-Security max-age in seconds; 0 disables HSTS
+	HSTSIncludeSubDomains bool               // Add includeSubDomains to Strict-Transport-Security
+	XSSProtection         bool               // Send X-XSS-Protection: 1; mode=block
+	PermissionsPolicy     string             // Permissions-Policy header value; empty omits it
+	CacheControl          []CacheControlRule // Cache-Control rules for served files, first match wins
+	CacheControlDefault   string             // Cache-Control when no rule matches; empty omits it
+	EnableTree            bool               // Show the directory tree sidebar in the advanced theme
+	ZipMaxDepth           int                // Deepest directory level a ZIP download walks; 0 uses the default
+	ZipMaxEntries         int                // Most files in one ZIP download; 0 uses the default
+	ZipCollectTimeout     time.Duration      // Time allowed to collect ZIP entries; 0 uses the default
+	MaxConcurrentZips     int                // ZIP downloads streamed at once per advanced handler; 0 uses the default
+	ZipQueueTimeout       time.Duration      // How long a ZIP download waits for a slot; 0 uses the default
+	ExtractMaxEntries     int                // Most entries /api/extract unpacks from one archive; 0 uses the default
+	ExtractMaxSize        int64              // Most bytes /api/extract writes for one archive; 0 uses the default
+	ArchiveCacheDir       string             // Where directory ZIPs are cached for resumable downloads; empty streams them
+	ArchiveCacheSize      int64              // Total bytes of cached archives kept before LRU eviction
+	DirConfig             bool               // Apply .gofs.yaml files (hidden, auth, index) found in served directories
+	MimeTypes             map[string]string  // Content-Type overrides keyed by lower-case extension (".ext")
+	BaseURL               string             // Path prefix behind a proxy, e.g. "/files"; "" is the root
+	TrustProxy            bool               // Honour X-Forwarded-* headers from a reverse proxy
+	MaxRequestBodySize    int64              // Largest JSON request body to the advanced API; 0 uses the default
+	ACMEDomains           []string           // Hosts to get ACME certificates for; empty serves plain HTTP
+	ACMECacheDir          string             // Where ACME account keys and certificates are kept
+	HotCacheSize          int64              // Bytes of small files kept in memory; 0 disables the cache
+	HotCacheMaxFileSize   int64              // Largest file kept in the in-memory cache
+	MaxRequests           int                // Shut down after this many file downloads; 0 is unlimited
+	ShutdownAfter         time.Duration      // Shut down once this has elapsed; 0 runs until stopped
+	TrustedOrigins        []string           // Normalized extra origins allowed to send mutating requests
+	MaxURLLength          int                // Longest request target before 414; 0 disables the check
+	MaxHeaderCount        int                // Most request header lines before 431; 0 disables the check
+	MaxHeaderSize         int64              // Largest total of header names and values before 431; 0 disables
+	MaxPathDepth          int                // Most segments in a request path or uploaded name; 0 disables the check
+	MaxNameLength         int                // Most bytes in one path segment; 0 disables the check
+	DenyPaths             []string           // Lower-case path segment globs answered with a fast 404
+	SensitivePatterns     []string           // Lower-case path segment globs of files that usually hold secrets
+	BlockSensitive        bool               // Leave files matching SensitivePatterns out of every mount
+	VersionsDir           string             // Where files replaced by uploads are kept; empty keeps none
+	VersionsMaxCount      int                // Versions kept per file; 0 keeps every one
+	VersionsMaxAge        time.Duration      // Versions older than this are pruned; 0 keeps them
+	EnableRESTWrite       bool               // Accept authenticated PUT, DELETE and directory POST on file paths
+	UserUploadDirs        bool               // Put uploads and new folders under incoming/<user>/
+	ScrubInterval         time.Duration      // How often every file is checked for corruption; 0 disables it
+	ScrubDir              string             // Where scrub manifests are kept
+	ScrubRate             int64              // Bytes per second a scrub reads; 0 is unlimited
+	AllowIndexing         bool               // robots.txt admits crawlers instead of disallowing everything
+	WellKnownDir          string             // Served under /.well-known/; empty answers 404 there
+	WellKnownAuth         bool               // /robots.txt, /favicon.ico and /.well-known/ require auth
+	UploadScanCmd         string             // Command run on each upload before it is stored; non-zero exit rejects
+	UploadScanURL         string             // URL each upload is POSTed to before it is stored; 2xx accepts
+	UploadScanTimeout     time.Duration      // Time a scan may take; 0 uses the default
+	CaseInsensitiveRoutes bool               // Match mount paths regardless of case; names within mounts are unaffected
+	OTelEndpoint          string             // OTLP/HTTP collector request spans are sent to; empty disables tracing
+	LogPathMode           string             // How request paths appear in logs, a LogPath* mode; empty is full
+	LogPathKey            string             // HMAC key of hashed log paths; empty draws one per run
+	Snapshot              bool               // Serve every mount as it was at startup, or as SnapshotFile recorded it
+	SnapshotFile          string             // Where mount snapshots are kept across restarts; empty keeps them in memory
+	Readonly              bool               // Refuse every request that could change a file, whatever the mounts allow
+	WatchMode             string             // How live updates detect changes, a Watch* mode; empty is auto
+	PollInterval          time.Duration      // How often watched directories are fingerprinted; 0 uses the default
 }
 
-func New(port int, host, dir, theme string, showHidden bool, dirs []string) (*Config, error) {
+// Option customizes a Config before it is validated.
+type Option func(*Config)
+
+// WithSkipDirCheck disables the existence and readability checks performed on
+// mount directories. This is useful in containers where volumes may be
+// attached after the process starts.
+func WithSkipDirCheck(skip bool) Option {
+	return func(c *Config) {
+		c.SkipDirCheck = skip
+	}
+}
+
+func New(port int, host, dir, theme string, showHidden bool, dirs []string, opts ...Option) (*Config, error) {
 	cfg := &Config{
 		Port:       port,
 		Host:       host,
@@ -42,6 +140,9 @@ func New(port int, host, dir, theme string, showHidden bool, dirs []string) (*Co
 		Theme:      theme,
 		ShowHidden: showHidden,
 	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
 
 	// Parse directory configuration
 	if err := cfg.parseDirConfig(dirs); err != nil {
@@ -52,6 +153,7 @@ func New(port int, host, dir, theme string, showHidden bool, dirs []string) (*Co
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
+	cfg.warnMountConflicts()
 	return cfg, nil
 }
 
@@ -72,6 +174,9 @@ func (c *Config) parseDirConfig(dirs []string) error {
 		c.Dirs = append(c.Dirs, mount)
 	}
 
+	if c.SkipDirCheck {
+		return validateMounts(c.Dirs)
+	}
 	return ValidateDirs(c.Dirs)
 }
 
@@ -85,8 +190,11 @@ func (c *Config) setDefaults() {
 	if c.Dir == "" {
 		c.Dir = "."
 	}
-	if c.MaxFileSize == 0 {
-		c.MaxFileSize = 100 << 20 // 100MB default
+	if c.MaxUploadSize == 0 {
+		c.MaxUploadSize = constants.DefaultMaxUploadSize
+	}
+	if c.MaxHashSize == 0 {
+		c.MaxHashSize = constants.DefaultMaxHashSize
 	}
 	if c.RequestTimeout == 0 {
 		c.RequestTimeout = 30 // 30 seconds default
@@ -101,11 +209,19 @@ func (c *Config) validate() error {
 		return fmt.Errorf("port must be between 0 and 65535, got %d", c.Port)
 	}
 
+	if c.MaxUploadSize < 0 || c.MaxHashSize < 0 || c.MaxDownloadSize < 0 {
+		return errors.New("size limits must not be negative")
+	}
+
 	if !validThemes[c.Theme] {
 		fmt.Fprintf(os.Stderr, "Warning: invalid theme %q, falling back to 'default'. Supported themes: default, advanced\n", c.Theme)
 		c.Theme = "default"
 	}
 
+	if c.SkipDirCheck {
+		return nil
+	}
+
 	absDir, err := filepath.Abs(c.Dir)
 	if err != nil {
 		return fmt.Errorf("invalid directory path %q: %w", c.Dir, err)
@@ -129,83 +245,110 @@ func (c *Config) Address() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
-// ParseDir parses a directory configuration string
-// Format: [path:]dir[:ro][:name] or just dir for legacy compatibility
-func ParseDir(dirStr string) (DirMount, error) {
-	parts := strings.Split(dirStr, ":")
-
-	// Legacy: single directory path
-	if len(parts) == 1 {
-		return DirMount{Path: "/", Dir: dirStr, Name: "Files"}, nil
-	}
-
-	if len(parts) < 2 {
-		return DirMount{}, fmt.Errorf("invalid format: %s (expected path:dir[:options])", dirStr)
+// ValidateDirs checks for path conflicts and validates directory mounts with security checks.
+// Every local directory must exist, be a directory and be readable.
+func ValidateDirs(dirs []DirMount) error {
+	if err := validateMounts(dirs); err != nil {
+		return err
 	}
-
-	mount := DirMount{Path: parts[0], Dir: parts[1]}
-
-	// Parse optional flags: "ro" for readonly, anything else for name
-	for _, part := range parts[2:] {
-		switch part {
-		case "ro":
-			mount.Readonly = true
-		case "":
-			// Skip empty parts
-		default:
-			if mount.Name == "" {
-				mount.Name = part
-			}
+	for _, d := range dirs {
+		if d.IsRemote() {
+			continue
 		}
-	}
-
-	// Generate default name from path
-	if mount.Name == "" {
-		if name := strings.Trim(mount.Path, "/"); name != "" {
-			mount.Name = name
-		} else {
-			mount.Name = "Files"
+		if err := validateLocalDir(d.Dir); err != nil {
+			return fmt.Errorf("%s: invalid local directory %s: %w", d.describe(), d.Dir, err)
 		}
 	}
-
-	return mount, nil
+	return nil
 }
 
-// ValidateDirs checks for path conflicts and validates directory mounts with security checks
-func ValidateDirs(dirs []DirMount) error {
-	paths := make(map[string]string)
+// validateMounts performs the checks that do not touch the filesystem:
+// non-empty fields, absolute and safe mount paths, and no duplicate paths.
+func validateMounts(dirs []DirMount) error {
+	paths := make(map[string]DirMount)
 	for _, d := range dirs {
 		if d.Path == "" {
-			return errors.New("empty path in directory mount")
+			return fmt.Errorf("%s: empty path in directory mount", d.describe())
 		}
 		if d.Dir == "" {
-			return fmt.Errorf("empty directory in mount for path %s", d.Path)
+			return fmt.Errorf("%s: empty directory in mount for path %s", d.describe(), d.Path)
+		}
+
+		if d.IsRemote() {
+			if err := validateRemote(d); err != nil {
+				return fmt.Errorf("%s: invalid remote URL %s: %w", d.describe(), d.Dir, err)
+			}
 		}
 
 		// Ensure path starts with /
 		if !strings.HasPrefix(d.Path, "/") {
-			return fmt.Errorf("path must start with /: %s", d.Path)
+			return fmt.Errorf("%s: path must start with /: %s", d.describe(), d.Path)
 		}
 
 		// Security validation: prevent directory traversal in mount paths
 		if err := validateMountPath(d.Path); err != nil {
-			return fmt.Errorf("invalid mount path %s: %w", d.Path, err)
+			return fmt.Errorf("%s: invalid mount path %s: %w", d.describe(), d.Path, err)
 		}
 
-		// Validate local directory path
-		if err := validateLocalDir(d.Dir); err != nil {
-			return fmt.Errorf("invalid local directory %s: %w", d.Dir, err)
+		// Check for conflicts, treating "/a" and "/a/" as the same mount point
+		key := strings.TrimSuffix(d.Path, "/")
+		if existing, ok := paths[key]; ok {
+			return fmt.Errorf("%s: path conflict: %s maps to both %s (from %s) and %s",
+				d.describe(), d.Path, existing.Dir, existing.describe(), d.Dir)
 		}
+		paths[key] = d
+	}
+	return nil
+}
 
-		// Check for conflicts
-		if existing, ok := paths[d.Path]; ok {
-			return fmt.Errorf("path conflict: %s maps to both %s and %s", d.Path, existing, d.Dir)
+// CheckCaseInsensitiveMounts reports mounts whose paths differ only in case,
+// which --case-insensitive-routes could not tell apart.
+func CheckCaseInsensitiveMounts(dirs []DirMount) error {
+	paths := make(map[string]DirMount)
+	for _, d := range dirs {
+		key := strings.ToLower(strings.TrimSuffix(d.Path, "/"))
+		if existing, ok := paths[key]; ok {
+			return fmt.Errorf("%s: path conflict with --case-insensitive-routes: %s and %s (from %s)",
+				d.describe(), d.Path, existing.Path, existing.describe())
 		}
-		paths[d.Path] = d.Dir
+		paths[key] = d
 	}
 	return nil
 }
 
+// describe identifies the mount in error messages by its original -d or
+// --alias argument.
+func (d DirMount) describe() string {
+	if d.Spec != "" {
+		return fmt.Sprintf("-d %q", d.Spec)
+	}
+	if d.AliasOf != "" {
+		return fmt.Sprintf("--alias %q", d.Path+"="+d.AliasOf)
+	}
+	return fmt.Sprintf("mount %q", d.Path)
+}
+
+// warnMountConflicts reports mount settings that are valid but likely unintended.
+func (c *Config) warnMountConflicts() {
+	if c.SkipDirCheck || c.Theme != "advanced" {
+		return
+	}
+	for _, d := range c.Dirs {
+		if d.Readonly || d.IsRemote() {
+			continue
+		}
+		info, err := os.Stat(d.Dir)
+		if err != nil {
+			continue
+		}
+		if info.Mode().Perm()&0o222 == 0 {
+			fmt.Fprintf(os.Stderr,
+				"Warning: %s is writable but directory %s is not; uploads will fail. Add :ro to mount it read-only\n",
+				d.describe(), d.Dir)
+		}
+	}
+}
+
 // validateMountPath ensures mount paths are safe and don't contain dangerous patterns
 func validateMountPath(path string) error {
 	// Clean the path
@@ -253,5 +396,15 @@ func validateLocalDir(dir string) error {
 		return errors.New("path is not a directory")
 	}
 
+	// Ensure the directory can be listed
+	f, err := os.Open(absDir) // #nosec G304 - operator-supplied mount directory
+	if err != nil {
+		return fmt.Errorf("directory is not readable: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("directory is not readable: %w", err)
+	}
+
 	return nil
 }
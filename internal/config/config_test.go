@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -142,8 +143,14 @@ func TestConfig_setDefaults(t *testing.T) {
 	if c.Dir != "." {
 		t.Errorf("expected default dir '.', got %q", c.Dir)
 	}
-	if c.MaxFileSize != 100<<20 {
-		t.Errorf("expected default max file size 104857600, got %d", c.MaxFileSize)
+	if c.MaxUploadSize != 100<<20 {
+		t.Errorf("expected default max upload size 104857600, got %d", c.MaxUploadSize)
+	}
+	if c.MaxHashSize != 100<<20 {
+		t.Errorf("expected default max hash size 104857600, got %d", c.MaxHashSize)
+	}
+	if c.MaxDownloadSize != 0 {
+		t.Errorf("expected downloads to be unlimited by default, got %d", c.MaxDownloadSize)
 	}
 	if c.RequestTimeout != 30 {
 		t.Errorf("expected default request timeout 30, got %d", c.RequestTimeout)
@@ -297,7 +304,7 @@ func TestConfig_BackwardCompatibility(t *testing.T) {
 		Host:           "127.0.0.1",
 		Dir:            ".",
 		Port:           8000,
-		MaxFileSize:    100 << 20,
+		MaxHashSize:    100 << 20,
 		RequestTimeout: 30,
 		EnableSecurity: false,
 		Theme:          "default",
@@ -316,3 +323,103 @@ func TestConfig_BackwardCompatibility(t *testing.T) {
 		t.Errorf("expected address '127.0.0.1:8000', got %q", cfg.Address())
 	}
 }
+
+func TestNew_MountValidationErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(tmpFile, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	missing := filepath.Join(tmpDir, "missing")
+
+	testCases := []struct {
+		name     string
+		dirs     []string
+		contains []string
+	}{
+		{
+			name:     "nonexistent_directory",
+			dirs:     []string{"/data:" + missing},
+			contains: []string{`-d "/data:` + missing + `"`, "directory does not exist"},
+		},
+		{
+			name:     "file_instead_of_directory",
+			dirs:     []string{"/data:" + tmpFile},
+			contains: []string{`-d "/data:` + tmpFile + `"`, "path is not a directory"},
+		},
+		{
+			name:     "relative_mount_path",
+			dirs:     []string{"data:" + tmpDir},
+			contains: []string{`-d "data:` + tmpDir + `"`, "path must start with /"},
+		},
+		{
+			name:     "traversal_in_mount_path",
+			dirs:     []string{"/a/../b:" + tmpDir},
+			contains: []string{`-d "/a/../b:` + tmpDir + `"`, "invalid mount path"},
+		},
+		{
+			name:     "empty_directory",
+			dirs:     []string{"/data:"},
+			contains: []string{`-d "/data:"`, "empty directory"},
+		},
+		{
+			name:     "duplicate_mount_path",
+			dirs:     []string{"/data:" + tmpDir, "/data/:" + tmpDir + ":ro"},
+			contains: []string{`-d "/data/:` + tmpDir + `:ro"`, "path conflict", `-d "/data:` + tmpDir + `"`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(8000, "127.0.0.1", "", "default", false, tc.dirs)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			for _, want := range tc.contains {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestNew_UnreadableDirectory(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks are bypassed when running as root")
+	}
+
+	dir := filepath.Join(t.TempDir(), "locked")
+	if err := os.Mkdir(dir, 0o000); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	defer func() { _ = os.Chmod(dir, 0o755) }()
+
+	_, err := New(8000, "127.0.0.1", "", "default", false, []string{"/locked:" + dir})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "directory is not readable") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNew_SkipDirCheck(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "not-mounted-yet")
+
+	cfg, err := New(8000, "127.0.0.1", "", "default", false, []string{"/data:" + missing},
+		WithSkipDirCheck(true))
+	if err != nil {
+		t.Fatalf("unexpected error with skip-dir-check: %v", err)
+	}
+	if !cfg.SkipDirCheck {
+		t.Error("expected SkipDirCheck to be set")
+	}
+
+	// Structural checks still apply when directory checks are skipped
+	_, err = New(8000, "127.0.0.1", "", "default", false, []string{"data:" + missing},
+		WithSkipDirCheck(true))
+	if err == nil || !strings.Contains(err.Error(), "path must start with /") {
+		t.Errorf("expected mount path error, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckDefaultMount returns the path of the mount --default-mount names, as
+// the mount spells it, or an error if no mount has that path. An empty name
+// returns "".
+func CheckDefaultMount(dirs []DirMount, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	want := "/" + strings.Trim(name, "/")
+	for _, mount := range dirs {
+		if "/"+strings.Trim(mount.Path, "/") == want {
+			return mount.Path, nil
+		}
+	}
+	return "", fmt.Errorf("--default-mount %q: no mount at that path", name)
+}
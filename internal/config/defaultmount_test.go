@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDefaultMount(t *testing.T) {
+	dirs := []DirMount{{Path: "/docs", Dir: "/srv/docs"}, {Path: "/media/", Dir: "/srv/media"}}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{"", "", ""},
+		{"/docs", "/docs", ""},
+		{"docs/", "/docs", ""},
+		{"/media", "/media/", ""},
+		{"/Docs", "", "no mount at that path"},
+		{"/", "", "no mount at that path"},
+	}
+	for _, tt := range tests {
+		got, err := CheckDefaultMount(dirs, tt.name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckDefaultMount(%q) error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CheckDefaultMount(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
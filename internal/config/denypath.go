@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DefaultDenyPaths are the path segments vulnerability scanners probe for and
+// a file server is not meant to hand out. They apply unless --deny-path is
+// given.
+var DefaultDenyPaths = []string{
+	".env", ".git", ".svn", ".htaccess", "cgi-bin", "wp-admin", "wp-login.php", "xmlrpc.php", "phpmyadmin",
+}
+
+// DenyPathsOff given alone to --deny-path turns the denylist off.
+const DenyPathsOff = "none"
+
+// ParseDenyPaths validates the patterns given to --deny-path and returns them
+// lower-cased and without duplicates. A pattern is a path.Match glob for a
+// single path segment, so it cannot contain a slash.
+func ParseDenyPaths(patterns []string) ([]string, error) {
+	seen := make(map[string]bool, len(patterns))
+	var parsed []string
+	off := false
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == DenyPathsOff {
+			off = true
+			continue
+		}
+		if pattern == "" {
+			continue
+		}
+		if err := checkSegmentPattern(pattern); err != nil {
+			return nil, fmt.Errorf("deny path %q: %w", pattern, err)
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			parsed = append(parsed, pattern)
+		}
+	}
+	if off && len(parsed) > 0 {
+		return nil, fmt.Errorf("deny path %q cannot be combined with other patterns", DenyPathsOff)
+	}
+	return parsed, nil
+}
+
+// checkSegmentPattern validates a path.Match glob for a single path segment.
+func checkSegmentPattern(pattern string) error {
+	if strings.Contains(pattern, "/") {
+		return errors.New("patterns match a single path segment and cannot contain /")
+	}
+	_, err := path.Match(pattern, "")
+	return err
+}
+
+// DeniedPath reports whether a segment of urlPath matches one of patterns,
+// ignoring case. Requests for such paths get a plain 404.
+func DeniedPath(urlPath string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	for segment := range strings.SplitSeq(strings.ToLower(urlPath), "/") {
+		if segment == "" {
+			continue
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
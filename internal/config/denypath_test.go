@@ -0,0 +1,38 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDenyPaths(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "empty", patterns: nil, want: nil},
+		{name: "normalized", patterns: []string{" .ENV ", "*.php", ".env", ""}, want: []string{".env", "*.php"}},
+		{name: "defaults", patterns: DefaultDenyPaths, want: DefaultDenyPaths},
+		{name: "off", patterns: []string{"none"}, want: nil},
+		{name: "off with patterns", patterns: []string{"none", ".git"}, wantErr: true},
+		{name: "slash", patterns: []string{"/cgi-bin"}, wantErr: true},
+		{name: "bad glob", patterns: []string{"[a-"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseDenyPaths(tc.patterns)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseDenyPaths(%q) = %q, %v; want %q", tc.patterns, got, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samzong/gofs/pkg/fileutil"
+)
+
+// ParseDir parses a directory mount specification. Two forms are accepted:
+//
+//   - colon form: [path:]dir[:ro][:name], e.g. "/config:/etc/app:ro:Configuration"
+//   - key=value form: path=/config,dir=C:\app\conf,ro,name="Config: prod",quota=10GB
+//
+// A remote mount, whose dir is the URL of another gofs server, may also be
+// given as path=url, e.g. "/hostA=https://a.internal:8000".
+//
+// In the colon form a Windows drive letter ("C:\data") is recognised as part
+// of the directory. Values in the key=value form may be double-quoted to
+// include commas; quoted values may escape quotes and backslashes with "\".
+func ParseDir(dirStr string) (DirMount, error) {
+	if dirStr == "" {
+		return DirMount{}, errors.New("empty directory specification")
+	}
+
+	var (
+		mount DirMount
+		err   error
+	)
+	if remote, ok := parseRemoteDir(dirStr); ok {
+		mount = remote
+	} else if isKeyValueSpec(dirStr) {
+		mount, err = parseKeyValueDir(dirStr)
+	} else {
+		mount, err = parseColonDir(dirStr)
+	}
+	if err != nil {
+		return DirMount{}, err
+	}
+
+	mount.Spec = dirStr
+	if mount.IsRemote() {
+		mount.Readonly = true
+	}
+	if mount.Name == "" {
+		mount.Name = defaultMountName(mount.Path)
+	}
+	return mount, nil
+}
+
+// SplitDirList splits a semicolon-separated list of mount specifications,
+// as used by the GOFS_DIR environment variable. Semicolons inside double
+// quotes do not split, and empty entries are dropped.
+func SplitDirList(list string) []string {
+	var specs []string
+	for _, spec := range splitOutsideQuotes(list, ';') {
+		if strings.TrimSpace(spec) != "" {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// parseColonDir parses the legacy [path:]dir[:ro][:name] form.
+func parseColonDir(dirStr string) (DirMount, error) {
+	parts := mergeDriveLetters(strings.Split(dirStr, ":"))
+
+	// Legacy: single directory path
+	if len(parts) == 1 {
+		return DirMount{Path: "/", Dir: parts[0], Name: "Files"}, nil
+	}
+
+	// A leading Windows drive path has no mount path: dir[:ro][:name]
+	var mount DirMount
+	var options []string
+	if isDrivePath(parts[0]) {
+		mount = DirMount{Path: "/", Dir: parts[0]}
+		options = parts[1:]
+	} else {
+		mount = DirMount{Path: parts[0], Dir: parts[1]}
+		options = parts[2:]
+	}
+
+	// Parse optional flags: "ro" for readonly, anything else for name
+	for i, part := range options {
+		switch part {
+		case "ro":
+			mount.Readonly = true
+		case "":
+			// Skip empty parts
+		default:
+			if mount.Name != "" {
+				return DirMount{}, fmt.Errorf(
+					"component %d (%q): unexpected value after name %q; "+
+						"names containing ':' require the key=value form, e.g. name=\"%s:%s\"",
+					len(parts)-len(options)+i+1, part, mount.Name, mount.Name, part)
+			}
+			mount.Name = part
+		}
+	}
+
+	return mount, nil
+}
+
+// parseKeyValueDir parses the comma-separated key=value form.
+func parseKeyValueDir(dirStr string) (DirMount, error) {
+	mount := DirMount{Path: "/"}
+	seen := make(map[string]bool)
+
+	for i, field := range splitOutsideQuotes(dirStr, ',') {
+		component := i + 1
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		key, rawValue, hasValue := strings.Cut(field, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if seen[key] {
+			return DirMount{}, fmt.Errorf("component %d (%q): duplicate key %q", component, field, key)
+		}
+		seen[key] = true
+
+		value, err := unquoteValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return DirMount{}, fmt.Errorf("component %d (%q): %w", component, field, err)
+		}
+
+		switch key {
+		case "path":
+			if value == "" {
+				return DirMount{}, fmt.Errorf("component %d (%q): path must not be empty", component, field)
+			}
+			mount.Path = value
+		case "dir":
+			if value == "" {
+				return DirMount{}, fmt.Errorf("component %d (%q): dir must not be empty", component, field)
+			}
+			mount.Dir = value
+		case "name":
+			mount.Name = value
+		case "ro", "readonly":
+			if !hasValue {
+				mount.Readonly = true
+				continue
+			}
+			ro, err := strconv.ParseBool(value)
+			if err != nil {
+				return DirMount{}, fmt.Errorf("component %d (%q): %s must be a boolean", component, field, key)
+			}
+			mount.Readonly = ro
+		case "quota":
+			quota, err := fileutil.ParseSize(value)
+			if err != nil {
+				return DirMount{}, fmt.Errorf("component %d (%q): %w", component, field, err)
+			}
+			mount.Quota = quota
+		case "weight":
+			weight, err := strconv.Atoi(value)
+			if err != nil {
+				return DirMount{}, fmt.Errorf("component %d (%q): weight must be an integer", component, field)
+			}
+			mount.Weight = weight
+		default:
+			return DirMount{}, fmt.Errorf(
+				"component %d (%q): unknown key %q (expected path, dir, ro, name, quota or weight)",
+				component, field, key)
+		}
+	}
+
+	if mount.Dir == "" {
+		return DirMount{}, errors.New("missing required key \"dir\"")
+	}
+	return mount, nil
+}
+
+// isKeyValueSpec reports whether the specification uses the key=value form,
+// which is recognised by a first component of path=, dir= or name=.
+func isKeyValueSpec(dirStr string) bool {
+	first, _, _ := strings.Cut(dirStr, ",")
+	key, _, ok := strings.Cut(first, "=")
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "path", "dir", "name":
+		return true
+	}
+	return false
+}
+
+// mergeDriveLetters rejoins Windows drive paths such as "C:\data" that were
+// split on the colon separator. Only the first two components can hold the
+// directory, so later components (names, flags) are left untouched.
+func mergeDriveLetters(parts []string) []string {
+	merged := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		if i <= 1 && i+1 < len(parts) && isDriveLetter(parts[i]) && startsWithSeparator(parts[i+1]) {
+			merged = append(merged, parts[i]+":"+parts[i+1])
+			i++
+			continue
+		}
+		merged = append(merged, parts[i])
+	}
+	return merged
+}
+
+func isDriveLetter(s string) bool {
+	return len(s) == 1 && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
+
+func isDrivePath(s string) bool {
+	return len(s) >= 3 && isDriveLetter(s[:1]) && s[1] == ':' && startsWithSeparator(s[2:])
+}
+
+func startsWithSeparator(s string) bool {
+	return strings.HasPrefix(s, `\`) || strings.HasPrefix(s, "/")
+}
+
+// splitOutsideQuotes splits s on sep, ignoring separators inside double quotes.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	escaped := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes && c == '\\':
+			escaped = true
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquoteValue strips surrounding double quotes and resolves \" and \\ escapes.
+// Unquoted values are returned as-is so Windows paths keep their backslashes.
+func unquoteValue(v string) (string, error) {
+	if !strings.HasPrefix(v, `"`) {
+		if strings.Contains(v, `"`) {
+			return "", errors.New("unexpected quote in unquoted value")
+		}
+		return v, nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '\\' && i+1 < len(v) && (v[i+1] == '"' || v[i+1] == '\\'):
+			b.WriteByte(v[i+1])
+			i++
+		case c == '"':
+			if i != len(v)-1 {
+				return "", errors.New("unexpected characters after closing quote")
+			}
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated quoted value")
+}
+
+// defaultMountName derives a display name from the mount path.
+func defaultMountName(path string) string {
+	if name := strings.Trim(path, "/"); name != "" {
+		return name
+	}
+	return "Files"
+}
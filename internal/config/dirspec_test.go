@@ -0,0 +1,179 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDir(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		expected DirMount
+	}{
+		{
+			name:     "legacy_single_dir",
+			spec:     "/srv/files",
+			expected: DirMount{Path: "/", Dir: "/srv/files", Name: "Files"},
+		},
+		{
+			name:     "path_and_dir",
+			spec:     "/data:/srv",
+			expected: DirMount{Path: "/data", Dir: "/srv", Name: "data"},
+		},
+		{
+			name:     "readonly_and_name",
+			spec:     "/config:/etc/app:ro:Configuration",
+			expected: DirMount{Path: "/config", Dir: "/etc/app", Readonly: true, Name: "Configuration"},
+		},
+		{
+			name:     "empty_flag_and_name",
+			spec:     "/logs:/var/log::Application Logs",
+			expected: DirMount{Path: "/logs", Dir: "/var/log", Name: "Application Logs"},
+		},
+		{
+			name:     "root_path_default_name",
+			spec:     "/:/srv",
+			expected: DirMount{Path: "/", Dir: "/srv", Name: "Files"},
+		},
+		{
+			name:     "windows_drive_single_dir",
+			spec:     `C:\data`,
+			expected: DirMount{Path: "/", Dir: `C:\data`, Name: "Files"},
+		},
+		{
+			name:     "windows_drive_forward_slash",
+			spec:     "d:/media",
+			expected: DirMount{Path: "/", Dir: "d:/media", Name: "Files"},
+		},
+		{
+			name:     "windows_drive_with_path",
+			spec:     `/config:C:\app\conf:ro:Config`,
+			expected: DirMount{Path: "/config", Dir: `C:\app\conf`, Readonly: true, Name: "Config"},
+		},
+		{
+			name:     "windows_drive_without_path_with_flags",
+			spec:     `C:\data:ro`,
+			expected: DirMount{Path: "/", Dir: `C:\data`, Readonly: true, Name: "Files"},
+		},
+		{
+			name:     "key_value_basic",
+			spec:     "path=/config,dir=/etc/app",
+			expected: DirMount{Path: "/config", Dir: "/etc/app", Name: "config"},
+		},
+		{
+			name: "key_value_windows_drive_and_colon_name",
+			spec: `path=/config,dir=C:\app\conf,ro,name=Config: prod`,
+			expected: DirMount{
+				Path: "/config", Dir: `C:\app\conf`, Readonly: true, Name: "Config: prod",
+			},
+		},
+		{
+			name:     "key_value_quoted_name_with_comma",
+			spec:     `dir=/srv,name="Media, archived",ro=false`,
+			expected: DirMount{Path: "/", Dir: "/srv", Name: "Media, archived"},
+		},
+		{
+			name:     "key_value_escaped_quote",
+			spec:     `dir=/srv,name="The \"best\" files"`,
+			expected: DirMount{Path: "/", Dir: "/srv", Name: `The "best" files`},
+		},
+		{
+			name:     "key_value_readonly_true_any_order",
+			spec:     "name=Logs, readonly=true, dir=/var/log, path=/logs",
+			expected: DirMount{Path: "/logs", Dir: "/var/log", Readonly: true, Name: "Logs"},
+		},
+		{
+			name:     "key_value_weight",
+			spec:     "path=/logs,dir=/var/log,weight=-2",
+			expected: DirMount{Path: "/logs", Dir: "/var/log", Name: "logs", Weight: -2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mount, err := ParseDir(tc.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tc.expected.Spec = tc.spec
+			if !reflect.DeepEqual(mount, tc.expected) {
+				t.Errorf("ParseDir(%q) = %+v, want %+v", tc.spec, mount, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseDir_Errors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		contains string
+	}{
+		{name: "empty_spec", spec: "", contains: "empty directory specification"},
+		{name: "ambiguous_colon_name", spec: "/cfg:/etc:Config: prod", contains: `component 4 (" prod")`},
+		{name: "missing_dir", spec: "path=/config,ro", contains: `missing required key "dir"`},
+		{name: "empty_dir_value", spec: "path=/config,dir=", contains: `component 2 ("dir="): dir must not be empty`},
+		{name: "empty_path_value", spec: "path=,dir=/srv", contains: `component 1 ("path="): path must not be empty`},
+		{name: "unknown_key", spec: "dir=/srv,mode=rw", contains: `component 2 ("mode=rw"): unknown key "mode"`},
+		{name: "duplicate_key", spec: "dir=/srv,dir=/tmp", contains: `component 2 ("dir=/tmp"): duplicate key "dir"`},
+		{name: "invalid_bool", spec: "dir=/srv,ro=maybe", contains: `component 2 ("ro=maybe"): ro must be a boolean`},
+		{name: "invalid_weight", spec: "dir=/srv,weight=first", contains: `("weight=first"): weight must be an integer`},
+		{name: "unterminated_quote", spec: `dir=/srv,name="oops`, contains: "unterminated quoted value"},
+		{name: "trailing_after_quote", spec: `dir=/srv,name="a"b`, contains: "unexpected characters after closing quote"},
+		{name: "stray_quote", spec: `dir=/srv,name=a"b`, contains: "unexpected quote in unquoted value"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseDir(tc.spec)
+			if err == nil {
+				t.Fatalf("ParseDir(%q) expected error, got nil", tc.spec)
+			}
+			if !strings.Contains(err.Error(), tc.contains) {
+				t.Errorf("ParseDir(%q) error = %q, want it to contain %q", tc.spec, err.Error(), tc.contains)
+			}
+		})
+	}
+}
+
+func TestSplitDirList(t *testing.T) {
+	testCases := []struct {
+		name     string
+		list     string
+		expected []string
+	}{
+		{name: "single", list: "/srv/files", expected: []string{"/srv/files"}},
+		{
+			name:     "colon_form",
+			list:     "/config:/etc:ro;/logs:/var/log",
+			expected: []string{"/config:/etc:ro", "/logs:/var/log"},
+		},
+		{
+			name:     "windows_drives",
+			list:     `/a:C:\one;/b:D:\two:ro`,
+			expected: []string{`/a:C:\one`, `/b:D:\two:ro`},
+		},
+		{
+			name:     "key_value_with_quoted_semicolon",
+			list:     `path=/a,dir=/srv,name="x; y";/b:/tmp`,
+			expected: []string{`path=/a,dir=/srv,name="x; y"`, "/b:/tmp"},
+		},
+		{name: "drops_empty_entries", list: "/a:/srv;;/b:/tmp;", expected: []string{"/a:/srv", "/b:/tmp"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := SplitDirList(tc.list)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("SplitDirList(%q) = %q, want %q", tc.list, got, tc.expected)
+			}
+			for _, spec := range got {
+				if _, err := ParseDir(spec); err != nil {
+					t.Errorf("ParseDir(%q) failed: %v", spec, err)
+				}
+			}
+		})
+	}
+}
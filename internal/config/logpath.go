@@ -0,0 +1,19 @@
+package config
+
+import "fmt"
+
+// How request paths appear in logs, set by --log-path-mode.
+const (
+	LogPathFull     = "full"     // The path as requested
+	LogPathHash     = "hash"     // A short HMAC of the path, equal for equal paths
+	LogPathBasename = "basename" // The last segment of the path only
+)
+
+// CheckLogPathMode validates --log-path-mode. An empty mode is "full".
+func CheckLogPathMode(mode string) error {
+	switch mode {
+	case "", LogPathFull, LogPathHash, LogPathBasename:
+		return nil
+	}
+	return fmt.Errorf("--log-path-mode %q: expected %s, %s or %s", mode, LogPathFull, LogPathHash, LogPathBasename)
+}
@@ -0,0 +1,16 @@
+package config
+
+import "testing"
+
+func TestCheckLogPathMode(t *testing.T) {
+	for _, mode := range []string{"", "full", "hash", "basename"} {
+		if err := CheckLogPathMode(mode); err != nil {
+			t.Errorf("CheckLogPathMode(%q): unexpected error %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"Hash", "none", "base"} {
+		if err := CheckLogPathMode(mode); err == nil {
+			t.Errorf("CheckLogPathMode(%q): expected an error", mode)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"mime"
+	"os"
+	"strings"
+)
+
+// ParseMimeTypes parses Content-Type overrides of the form ".ext=type", as
+// given to --mime-type, e.g. ".log=text/plain". The leading dot is optional
+// and extensions are matched case-insensitively.
+func ParseMimeTypes(specs []string) (map[string]string, error) {
+	types := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		ext, mimeType, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("mime type %q: expected .ext=type", spec)
+		}
+		if err := addMimeType(types, ext, mimeType); err != nil {
+			return nil, fmt.Errorf("mime type %q: %w", spec, err)
+		}
+	}
+	return types, nil
+}
+
+// LoadMimeTypesFile reads Content-Type overrides in the mime.types format:
+// each line names a type followed by its extensions, and # starts a comment.
+// Overrides from later lines replace earlier ones.
+func LoadMimeTypesFile(path string) (map[string]string, error) {
+	// #nosec G304 - the path comes from the operator's command line
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading mime types: %w", err)
+	}
+	defer file.Close()
+
+	types := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("%s:%d: %q has no extensions", path, lineNo, fields[0])
+		}
+		for _, ext := range fields[1:] {
+			if err := addMimeType(types, ext, fields[0]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading mime types: %w", err)
+	}
+	return types, nil
+}
+
+func addMimeType(types map[string]string, ext, mimeType string) error {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if len(ext) < 2 || strings.ContainsAny(ext[1:], `./\ `) {
+		return fmt.Errorf("invalid extension %q", ext)
+	}
+	mimeType = strings.TrimSpace(mimeType)
+	if _, _, err := mime.ParseMediaType(mimeType); err != nil {
+		return fmt.Errorf("invalid type %q", mimeType)
+	}
+	types[ext] = mimeType
+	return nil
+}
+
+// LoadMimeTypes combines the overrides in the mime.types file at path, if
+// any, with specs from --mime-type, which take precedence. It returns nil
+// when there are none.
+func LoadMimeTypes(path string, specs []string) (map[string]string, error) {
+	types := make(map[string]string)
+	if path != "" {
+		fromFile, err := LoadMimeTypesFile(path)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(types, fromFile)
+	}
+	fromSpecs, err := ParseMimeTypes(specs)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(types, fromSpecs)
+	if len(types) == 0 {
+		return nil, nil
+	}
+	return types, nil
+}
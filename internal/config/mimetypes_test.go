@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMimeTypes(t *testing.T) {
+	types, err := ParseMimeTypes([]string{".LOG=text/plain", "wasm=application/wasm"})
+	if err != nil {
+		t.Fatalf("ParseMimeTypes: %v", err)
+	}
+	if types[".log"] != "text/plain" || types[".wasm"] != "application/wasm" {
+		t.Errorf("unexpected types %v", types)
+	}
+
+	for _, spec := range []string{".log", ".=text/plain", ".tar.gz=application/gzip", ".log=not a type"} {
+		if _, err := ParseMimeTypes([]string{spec}); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestLoadMimeTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mime.types")
+	content := "# overrides\ntext/markdown md markdown\n\napplication/x-log log # server logs\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	types, err := LoadMimeTypes(path, []string{".log=text/plain"})
+	if err != nil {
+		t.Fatalf("LoadMimeTypes: %v", err)
+	}
+	want := map[string]string{".md": "text/markdown", ".markdown": "text/markdown", ".log": "text/plain"}
+	if len(types) != len(want) {
+		t.Fatalf("expected %v, got %v", want, types)
+	}
+	for ext, mimeType := range want {
+		if types[ext] != mimeType {
+			t.Errorf("%s: expected %q, got %q", ext, mimeType, types[ext])
+		}
+	}
+
+	if types, err := LoadMimeTypes("", nil); err != nil || types != nil {
+		t.Errorf("expected no overrides, got %v, %v", types, err)
+	}
+	if err := os.WriteFile(path, []byte("text/markdown\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := LoadMimeTypes(path, nil); err == nil {
+		t.Error("expected an error for a type without extensions")
+	}
+}
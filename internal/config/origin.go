@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// NormalizeOrigin returns the origin of an absolute http or https URL as
+// "scheme://host:port", with the host lower-cased and the scheme's default
+// port made explicit, so origins compare equal however they are spelled.
+// Any path is ignored, which lets a Referer be compared like an Origin.
+func NormalizeOrigin(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("origin %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("origin %q: scheme must be http or https", raw)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" || u.User != nil {
+		return "", fmt.Errorf("origin %q: expected scheme://host[:port]", raw)
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	return u.Scheme + "://" + net.JoinHostPort(host, port), nil
+}
+
+// ParseTrustedOrigins validates the origins given to --trusted-origin and
+// returns them normalized and without duplicates.
+func ParseTrustedOrigins(origins []string) ([]string, error) {
+	seen := make(map[string]bool, len(origins))
+	var parsed []string
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if u, err := url.Parse(origin); err == nil && strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("trusted origin %q must not have a path", origin)
+		}
+		normalized, err := NormalizeOrigin(origin)
+		if err != nil {
+			return nil, fmt.Errorf("trusted %w", err)
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			parsed = append(parsed, normalized)
+		}
+	}
+	return parsed, nil
+}
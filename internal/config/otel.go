@@ -0,0 +1,23 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// CheckOTelEndpoint validates --otel-endpoint, the base URL of an OTLP/HTTP
+// collector such as http://collector:4318. An empty endpoint disables
+// tracing.
+func CheckOTelEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("--otel-endpoint: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("--otel-endpoint %q: expected an http or https URL", endpoint)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package config
+
+import "testing"
+
+func TestCheckOTelEndpoint(t *testing.T) {
+	for endpoint, wantErr := range map[string]bool{
+		"":                                   false,
+		"http://collector:4318":              false,
+		"https://otel.example.com/v1/traces": false,
+		"collector:4318":                     true,
+		"grpc://collector:4317":              true,
+		"/v1/traces":                         true,
+	} {
+		if err := CheckOTelEndpoint(endpoint); (err != nil) != wantErr {
+			t.Errorf("CheckOTelEndpoint(%q) = %v, want error %v", endpoint, err, wantErr)
+		}
+	}
+}
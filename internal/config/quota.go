@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samzong/gofs/pkg/fileutil"
+)
+
+// ApplyQuotas sets mount quotas from "path=size" specifications, as given to
+// --quota. Every path must name a configured mount.
+func ApplyQuotas(dirs []DirMount, specs []string) error {
+	for _, spec := range specs {
+		mountPath, size, ok := strings.Cut(spec, "=")
+		if !ok {
+			return fmt.Errorf("quota %q: expected path=size", spec)
+		}
+		limit, err := fileutil.ParseSize(size)
+		if err != nil {
+			return fmt.Errorf("quota %q: %w", spec, err)
+		}
+
+		found := false
+		for i := range dirs {
+			if dirs[i].Path == strings.TrimSpace(mountPath) {
+				dirs[i].Quota = limit
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("quota %q: no mount at path %q", spec, mountPath)
+		}
+	}
+	return nil
+}
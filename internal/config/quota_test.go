@@ -0,0 +1,32 @@
+package config
+
+import "testing"
+
+func TestApplyQuotas(t *testing.T) {
+	dirs := []DirMount{{Path: "/data", Dir: "/srv/data"}, {Path: "/logs", Dir: "/var/log"}}
+	if err := ApplyQuotas(dirs, []string{"/data=10GB"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dirs[0].Quota != 10<<30 || dirs[1].Quota != 0 {
+		t.Errorf("unexpected quotas: %+v", dirs)
+	}
+
+	for _, spec := range []string{"/missing=1GB", "/data", "/data=lots"} {
+		if err := ApplyQuotas(dirs, []string{spec}); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestParseDir_Quota(t *testing.T) {
+	mount, err := ParseDir("path=/team,dir=/srv/team,quota=5GB")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mount.Quota != 5<<30 {
+		t.Errorf("expected 5GB quota, got %d", mount.Quota)
+	}
+	if _, err := ParseDir("path=/team,dir=/srv/team,quota=big"); err == nil {
+		t.Error("expected error for invalid quota")
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// A remote mount serves the tree of another gofs server, named by its URL in
+// place of a directory: "/hostA=https://a.internal:8000", or the key=value
+// form with dir=https://a.internal:8000. Remote mounts are always read-only.
+
+// IsRemote reports whether the mount serves another gofs server rather than
+// a local directory.
+func (d DirMount) IsRemote() bool {
+	return isRemoteURL(d.Dir)
+}
+
+func isRemoteURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// parseRemoteDir parses the path=url shorthand of a remote mount; ok is
+// false if dirStr is not one.
+func parseRemoteDir(dirStr string) (mount DirMount, ok bool) {
+	mountPath, target, found := strings.Cut(dirStr, "=")
+	if !found || !strings.HasPrefix(mountPath, "/") || !isRemoteURL(target) {
+		return DirMount{}, false
+	}
+	return DirMount{Path: mountPath, Dir: target}, true
+}
+
+// validateRemote checks the URL of a remote mount.
+func validateRemote(d DirMount) error {
+	u, err := url.Parse(d.Dir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Host == "":
+		return errors.New("missing host")
+	case u.User != nil:
+		return errors.New("credentials do not belong in the URL, use --remote-auth")
+	case u.RawQuery != "" || u.Fragment != "":
+		return errors.New("query and fragment are not allowed")
+	}
+	return nil
+}
+
+// ApplyRemoteAuth sets the credentials of remote mounts from
+// "path=user:password" specifications, as given to --remote-auth. Every path
+// must name a remote mount.
+func ApplyRemoteAuth(dirs []DirMount, specs []string) error {
+	for _, spec := range specs {
+		mountPath, credentials, ok := strings.Cut(spec, "=")
+		mountPath = strings.TrimSpace(mountPath)
+		if !ok || mountPath == "" {
+			// The spec holds a password, so it is not quoted back
+			return errors.New("remote auth: expected path=user:password")
+		}
+		if user, _, ok := strings.Cut(credentials, ":"); !ok || user == "" {
+			return fmt.Errorf("remote auth for %s: expected user:password", mountPath)
+		}
+
+		found := false
+		for i := range dirs {
+			if dirs[i].Path == mountPath && dirs[i].IsRemote() {
+				dirs[i].Credentials = credentials
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("remote auth for %s: no remote mount at that path", mountPath)
+		}
+	}
+	return nil
+}
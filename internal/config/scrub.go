@@ -0,0 +1,9 @@
+package config
+
+// CheckScrubDir checks that the directory given to --scrub-dir is outside
+// every served directory, so scrub manifests are never listed or scrubbed
+// themselves.
+func CheckScrubDir(dir string, mounts []DirMount) error {
+	_, err := outsideMounts("scrub directory", dir, mounts)
+	return err
+}
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckScrubDir(t *testing.T) {
+	served := t.TempDir()
+	mounts := []DirMount{{Path: "/", Dir: served}}
+
+	if err := CheckScrubDir(filepath.Join(served, ".scrub"), mounts); err == nil {
+		t.Error("expected a directory inside the mount to be refused")
+	}
+	if err := CheckScrubDir(served+"-scrub", mounts); err != nil {
+		t.Errorf("expected a sibling directory to be accepted: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultSensitivePatterns are path segments that usually hold secrets:
+// dotenv files, private keys, cloud and tool credentials, and version
+// control data. Files matching them are reported at startup and, with
+// --block-sensitive, not served.
+var DefaultSensitivePatterns = []string{
+	".env", ".env.*",
+	"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", "*.pem", "*.key", "*.p12", "*.pfx", ".ssh",
+	".aws", ".azure", ".kube", "application_default_credentials.json", ".netrc", ".pgpass",
+	".git",
+}
+
+// ParseSensitivePatterns returns DefaultSensitivePatterns extended with the
+// patterns given to --sensitive-pattern, lower-cased and without
+// duplicates. Like deny paths, a pattern is a path.Match glob for a single
+// path segment.
+func ParseSensitivePatterns(extra []string) ([]string, error) {
+	seen := make(map[string]bool, len(DefaultSensitivePatterns)+len(extra))
+	var parsed []string
+	for _, pattern := range append(slices.Clone(DefaultSensitivePatterns), extra...) {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if err := checkSegmentPattern(pattern); err != nil {
+			return nil, fmt.Errorf("sensitive pattern %q: %w", pattern, err)
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			parsed = append(parsed, pattern)
+		}
+	}
+	return parsed, nil
+}
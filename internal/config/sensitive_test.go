@@ -0,0 +1,30 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSensitivePatterns(t *testing.T) {
+	got, err := ParseSensitivePatterns(nil)
+	if err != nil || !slices.Equal(got, DefaultSensitivePatterns) {
+		t.Errorf("ParseSensitivePatterns(nil) = %q, %v; want the defaults", got, err)
+	}
+
+	got, err = ParseSensitivePatterns([]string{" *.SQLite ", "id_rsa", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(slices.Clone(DefaultSensitivePatterns), "*.sqlite"); !slices.Equal(got, want) {
+		t.Errorf("expected the defaults plus *.sqlite, got %q", got)
+	}
+	if len(DefaultSensitivePatterns) != len(got)-1 {
+		t.Error("expected the defaults to be left unchanged")
+	}
+
+	for _, pattern := range []string{"keys/*.pem", "[id_rsa"} {
+		if _, err := ParseSensitivePatterns([]string{pattern}); err == nil {
+			t.Errorf("expected an error for %q", pattern)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package config
+
+import "fmt"
+
+// CheckSnapshot checks that every mount can be snapshotted, which remote
+// mounts cannot, and that the file given to --snapshot-file is outside every
+// served directory. file may be empty.
+func CheckSnapshot(file string, mounts []DirMount) error {
+	for _, mount := range mounts {
+		if mount.IsRemote() {
+			return fmt.Errorf("--snapshot cannot snapshot the remote mount %s", mount.Path)
+		}
+	}
+	if file == "" {
+		return nil
+	}
+	_, err := outsideMounts("snapshot file", file, mounts)
+	return err
+}
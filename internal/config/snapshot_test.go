@@ -0,0 +1,26 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSnapshot(t *testing.T) {
+	served := t.TempDir()
+	mounts := []DirMount{{Path: "/", Dir: served}}
+
+	if err := CheckSnapshot(filepath.Join(served, "snapshot.json"), mounts); err == nil {
+		t.Error("expected a file inside the mount to be refused")
+	}
+	if err := CheckSnapshot(served+"-snapshot.json", mounts); err != nil {
+		t.Errorf("expected a file outside the mount to be accepted: %v", err)
+	}
+	if err := CheckSnapshot("", mounts); err != nil {
+		t.Errorf("expected no file to be accepted: %v", err)
+	}
+
+	remote := append(mounts, DirMount{Path: "/remote", Dir: "https://files.example"})
+	if err := CheckSnapshot("", remote); err == nil {
+		t.Error("expected a remote mount to be refused")
+	}
+}
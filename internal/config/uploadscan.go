@@ -0,0 +1,37 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// CheckUploadScan validates the upload scanner given by --upload-scan-cmd
+// or --upload-scan-url. At most one may be set; the command's program must
+// be found and the URL must be an absolute http or https URL.
+func CheckUploadScan(command, rawURL string) error {
+	if command != "" && rawURL != "" {
+		return errors.New("--upload-scan-cmd and --upload-scan-url cannot be combined")
+	}
+	if command != "" {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return errors.New("--upload-scan-cmd: empty command")
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			return fmt.Errorf("--upload-scan-cmd: %w", err)
+		}
+	}
+	if rawURL != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("--upload-scan-url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("--upload-scan-url %q: expected an http or https URL", rawURL)
+		}
+	}
+	return nil
+}
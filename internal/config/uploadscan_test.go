@@ -0,0 +1,37 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckUploadScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		url     string
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "command with arguments", command: "sh -c true"},
+		{name: "https url", url: "https://scanner.internal/scan"},
+		{name: "both", command: "sh", url: "http://scanner", wantErr: "cannot be combined"},
+		{name: "missing command", command: "gofs-no-such-scanner --fast", wantErr: "--upload-scan-cmd"},
+		{name: "relative url", url: "/scan", wantErr: "http or https"},
+		{name: "other scheme", url: "ftp://scanner/scan", wantErr: "http or https"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckUploadScan(tt.command, tt.url)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
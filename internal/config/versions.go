@@ -0,0 +1,9 @@
+package config
+
+// CheckVersionsDir checks that the directory given to --versions-dir is
+// outside every served directory, so kept versions are never listed or
+// served as ordinary files.
+func CheckVersionsDir(dir string, mounts []DirMount) error {
+	_, err := outsideMounts("versions directory", dir, mounts)
+	return err
+}
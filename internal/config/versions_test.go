@@ -0,0 +1,20 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckVersionsDir(t *testing.T) {
+	served := t.TempDir()
+	mounts := []DirMount{{Path: "/", Dir: t.TempDir()}, {Path: "/docs", Dir: served}}
+
+	for _, dir := range []string{served, filepath.Join(served, ".versions")} {
+		if err := CheckVersionsDir(dir, mounts); err == nil {
+			t.Errorf("expected %s to be refused", dir)
+		}
+	}
+	if err := CheckVersionsDir(served+"-versions", mounts); err != nil {
+		t.Errorf("expected a sibling directory to be accepted: %v", err)
+	}
+}
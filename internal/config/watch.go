@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// How listings learn that a directory changed, set by --watch-mode.
+const (
+	WatchAuto = "auto" // The best mechanism the platform offers
+	WatchPoll = "poll" // Compare a fingerprint of each watched directory every --poll-interval
+	WatchOff  = "off"  // No live updates
+)
+
+// CheckWatch validates --watch-mode and --poll-interval. An empty mode is
+// "auto".
+func CheckWatch(mode string, interval time.Duration) error {
+	switch mode {
+	case "", WatchAuto, WatchPoll, WatchOff:
+	default:
+		return fmt.Errorf("--watch-mode %q: expected %s, %s or %s", mode, WatchAuto, WatchPoll, WatchOff)
+	}
+	if interval <= 0 && mode != WatchOff {
+		return fmt.Errorf("--poll-interval %v: must be positive", interval)
+	}
+	return nil
+}
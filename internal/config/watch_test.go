@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckWatch(t *testing.T) {
+	tests := []struct {
+		mode     string
+		interval time.Duration
+		wantErr  bool
+	}{
+		{"", time.Second, false},
+		{"auto", time.Second, false},
+		{"poll", 100 * time.Millisecond, false},
+		{"off", 0, false},
+		{"inotify", time.Second, true},
+		{"Poll", time.Second, true},
+		{"poll", 0, true},
+		{"auto", -time.Second, true},
+	}
+	for _, tt := range tests {
+		if err := CheckWatch(tt.mode, tt.interval); (err != nil) != tt.wantErr {
+			t.Errorf("CheckWatch(%q, %v): got error %v, want error %v", tt.mode, tt.interval, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultWebDAVPrefix is where WebDAV is served unless --webdav-prefix says
+// otherwise.
+const DefaultWebDAVPrefix = "/dav"
+
+// reservedWebDAVPaths are served by gofs itself, so WebDAV cannot take them
+// over.
+var reservedWebDAVPaths = []string{"/api", "/static", "/healthz", "/readyz"}
+
+// ParseWebDAVPrefix validates the path given to --webdav-prefix and returns
+// it without a trailing slash. An empty prefix is DefaultWebDAVPrefix, and
+// "/" serves WebDAV at the root in place of the HTML listing. Prefixes at or
+// below a path gofs serves itself are rejected.
+func ParseWebDAVPrefix(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "":
+		return DefaultWebDAVPrefix, nil
+	case "/":
+		return "/", nil
+	}
+	prefix, err := parseURLPath("WebDAV prefix", s)
+	if err != nil {
+		return "", err
+	}
+	for _, reserved := range reservedWebDAVPaths {
+		if prefix == reserved || strings.HasPrefix(prefix, reserved+"/") {
+			return "", fmt.Errorf("WebDAV prefix %q collides with %s", s, reserved)
+		}
+	}
+	return prefix, nil
+}
+
+// DAVPrefix returns the path WebDAV is served under: WebDAVPrefix, or
+// DefaultWebDAVPrefix when it is unset.
+func (c *Config) DAVPrefix() string {
+	if c.WebDAVPrefix == "" {
+		return DefaultWebDAVPrefix
+	}
+	return c.WebDAVPrefix
+}
+
+// WebDAVOnly reports whether WebDAV is served at the root, which disables
+// the HTML file handlers.
+func (c *Config) WebDAVOnly() bool {
+	return c.EnableWebDAV && c.WebDAVPrefix == "/"
+}
@@ -0,0 +1,45 @@
+package config
+
+import "testing"
+
+func TestParseWebDAVPrefix(t *testing.T) {
+	testCases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: DefaultWebDAVPrefix},
+		{in: "/", want: "/"},
+		{in: "/dav/", want: "/dav"},
+		{in: " /remote.php/webdav ", want: "/remote.php/webdav"},
+		{in: "/apis", want: "/apis"},
+		{in: "/api", wantErr: true},
+		{in: "/api/dav", wantErr: true},
+		{in: "/static/", wantErr: true},
+		{in: "/healthz", wantErr: true},
+		{in: "/readyz", wantErr: true},
+		{in: "dav", wantErr: true},
+		{in: "/a/../dav", wantErr: true},
+		{in: "/my dav", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseWebDAVPrefix(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseWebDAVPrefix(%q): expected an error, got %q", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseWebDAVPrefix(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+
+	if got := (&Config{}).DAVPrefix(); got != DefaultWebDAVPrefix {
+		t.Errorf("expected an unset prefix to default to %q, got %q", DefaultWebDAVPrefix, got)
+	}
+	if (&Config{WebDAVPrefix: "/"}).WebDAVOnly() {
+		t.Error("expected root mode to need WebDAV enabled")
+	}
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// CheckWellKnownDir checks that the directory given to --well-known-dir
+// exists. Unlike the versions and scrub directories it may lie inside a
+// mount.
+func CheckWellKnownDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("well-known directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("well-known directory %s is not a directory", dir)
+	}
+	return nil
+}
@@ -3,9 +3,10 @@ package constants
 import "time"
 
 const (
-	DefaultHost        = "127.0.0.1"
-	DefaultPort        = 8000
-	DefaultMaxFileSize = 100 << 20
+	DefaultHost = "127.0.0.1"
+	DefaultPort = 8000
+	// Files up to this size get an ETag hashed from their content
+	DefaultMaxHashSize = 100 << 20
 
 	DefaultRequestTimeout = 30 * time.Second
 	ServerReadTimeout     = 30 * time.Second
@@ -18,9 +19,17 @@ const (
 	TemplateTimeout  = 5 * time.Second
 
 	StaticAssetCacheMaxAge = 3600
-	DefaultPathBufferSize  = 256
-	ShutdownTimeout        = 5 * time.Second
-	HealthCheckTimeout     = 5 * time.Second
+	// Content-hashed asset URLs never change content, so they cache for a year
+	VersionedAssetCacheMaxAge = 365 * 24 * 3600
+	DefaultPathBufferSize     = 256
+	ShutdownTimeout           = 5 * time.Second
+	HealthCheckTimeout        = 5 * time.Second
+
+	// Listing pages are rendered into pooled buffers; larger ones are not kept
+	MaxPooledPageBuffer = 1 << 20
+
+	// The built-in /favicon.ico only changes with a release
+	FaviconCacheMaxAge = 7 * 24 * 3600
 
 	CSRFTokenExpiry     = 1 * time.Hour
 	CSRFCleanupInterval = 5 * time.Minute
@@ -29,5 +38,145 @@ const (
 	BcryptCost = 12
 
 	// File upload limits
-	MaxUploadSize = 100 << 20
+	DefaultMaxUploadSize = 100 << 20
+	// Multipart uploads beyond this are buffered on disk instead of in memory
+	UploadMemoryLimit           = 32 << 20
+	DefaultMaxConcurrentUploads = 5
+	UploadRetryAfter            = 5 * time.Second
+	// Client-supplied upload mtimes may be this far ahead of the server clock
+	UploadModTimeSkew = 5 * time.Minute
+	// Default time an upload scanner (--upload-scan-cmd/--upload-scan-url) may take
+	DefaultUploadScanTimeout = 30 * time.Second
+	// Writes to one path wait this long for each other by default
+	// (--upload-lock-wait)
+	DefaultUploadLockWait = 5 * time.Second
+
+	// ZIP download limits
+	MaxZipSize               = 500 << 20
+	DefaultMaxConcurrentZips = 3
+	DefaultZipQueueTimeout   = 10 * time.Second
+	ZipRetryAfter            = 5 * time.Second
+
+	// Defaults for the directory walk behind a ZIP download
+	DefaultZipMaxDepth       = 64
+	DefaultZipMaxEntries     = 10000
+	DefaultZipCollectTimeout = 30 * time.Second
+
+	// Server-side ZIP extraction limits
+	DefaultExtractMaxEntries = 10000
+	DefaultExtractMaxSize    = 1 << 30
+	ExtractTimeout           = 10 * time.Minute
+	// Most unsafe entry names a refused extraction lists
+	MaxExtractUnsafeReported = 100
+
+	// Cached directory archives (--archive-cache-dir)
+	DefaultArchiveCacheSize = 10 << 30
+	ArchiveBuildTimeout     = 30 * time.Minute
+
+	// Idempotency-Key replay for uploads and folder creation
+	IdempotencyKeyTTL       = 24 * time.Hour
+	MaxIdempotencyKeys      = 10000
+	MaxIdempotencyKeyLength = 255
+
+	// JSON request limits for the advanced API
+	DefaultMaxRequestBodySize = 1 << 20
+	MaxZipPaths               = 1000
+	MaxRequestPathLength      = 4096
+	MaxHeaderBytes            = 64 << 10
+
+	// Request sanity defaults; each stays below what the server itself accepts
+	DefaultMaxURLLength   = 8192
+	DefaultMaxHeaderCount = 100
+	// Deepest path and longest path segment accepted by default; 255 bytes
+	// is the name limit of most filesystems
+	DefaultMaxPathDepth  = 64
+	DefaultMaxNameLength = 255
+	// Requests rejected by the sanity checks are logged at most once per
+	// interval for each client address
+	SanityWarnInterval   = time.Minute
+	MaxSanityWarnSources = 1024
+
+	// Bytes of the HMAC a --log-path-mode=hash log line keeps, and of the
+	// key drawn when --log-path-key is not set
+	LogPathHashSize = 8
+	LogPathKeySize  = 32
+
+	// Bulk delete/move/copy limits
+	MaxBulkPaths         = 1000
+	BulkWorkers          = 4
+	BulkOperationTimeout = 2 * time.Minute
+
+	// Most paths /api/select returns for one glob
+	MaxSelectPaths = 1000
+
+	// Checksum manifest limits
+	MaxManifestEntries    = 10000
+	MaxManifestSize       = 10 << 30
+	ManifestTimeout       = 2 * time.Minute
+	ManifestCacheEntries  = 64
+	ManifestWriteInterval = 10 * time.Minute
+
+	// Most files a --snapshot records per mount
+	MaxSnapshotEntries = 1_000_000
+
+	// The startup scan for sensitive files looks this many levels below each
+	// mount root, at no more than MaxSensitiveScanned entries, and names up
+	// to MaxSensitiveMatches of them
+	SensitiveScanDepth  = 2
+	MaxSensitiveScanned = 10000
+	MaxSensitiveMatches = 50
+
+	// Change feed (GET /api/changes) limits
+	MaxChangesEntries = 10000
+	MaxChangesScanned = 100000
+	ChangesTimeout    = time.Minute
+
+	// Directory diff (GET /api/diff) limits
+	MaxDiffEntries  = 10000
+	MaxDiffScanned  = 200000 // Entries listed on both sides together
+	DiffTimeout     = time.Minute
+	DiffHashWorkers = 4 // Files hashed at once with hash=1
+
+	// Spans for --otel-endpoint are sent in batches of up to TraceBatchSize
+	// at least every TraceExportInterval. Spans beyond TraceQueueSize that
+	// wait to be sent are dropped rather than slowing requests down.
+	TraceBatchSize      = 512
+	TraceQueueSize      = 2048
+	TraceExportInterval = 5 * time.Second
+	TraceExportTimeout  = 10 * time.Second
+
+	// Directory tree sidebar limits
+	MaxTreeDepth   = 3
+	MaxTreeEntries = 1000
+
+	// Listings count the children of a directory up to MaxChildCount and
+	// remember the counts of up to ChildCountCacheSize directories
+	MaxChildCount       = 1000
+	ChildCountCacheSize = 10000
+
+	// Entries per page of a listing requested with ?page=
+	ListingPageSize = 500
+
+	// Watched directories are fingerprinted this often by default
+	// (--poll-interval); idle GET /api/events streams send a comment every
+	// EventsKeepAlive
+	DefaultPollInterval = 2 * time.Second
+	EventsKeepAlive     = 30 * time.Second
+
+	// File versions kept by --versions-dir
+	DefaultVersionsMaxCount = 10
+	VersionsPruneInterval   = 10 * time.Minute
+
+	// Background integrity scrubbing (--scrub-interval)
+	DefaultScrubRate  = "20MB"      // Bytes read per second
+	ScrubBusyRequests = 8           // In-flight requests at which a scrub pauses
+	ScrubBusyPause    = time.Second // How long a scrub waits before checking the load again
+	ScrubChunkSize    = 64 << 10    // Largest read between rate checks
+
+	// Mount quota usage is recomputed from disk once older than this
+	QuotaUsageTTL = time.Minute
+
+	// Security header defaults
+	DefaultHSTSMaxAge        = 365 * 24 * 60 * 60
+	DefaultPermissionsPolicy = "camera=(), microphone=(), geolocation=()"
 )
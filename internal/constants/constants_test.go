@@ -16,18 +16,13 @@ func TestDefaultConstants(t *testing.T) {
 	}
 
 	// Test file size limits
-	expectedMaxFileSize := 100 << 20 // 100MB in bytes
-	if DefaultMaxFileSize != expectedMaxFileSize {
-		t.Errorf("Expected DefaultMaxFileSize %d bytes (100MB), got %d", expectedMaxFileSize, DefaultMaxFileSize)
+	expectedMaxSize := 100 << 20 // 100MB in bytes
+	if DefaultMaxUploadSize != expectedMaxSize {
+		t.Errorf("Expected DefaultMaxUploadSize %d bytes (100MB), got %d", expectedMaxSize, DefaultMaxUploadSize)
 	}
 
-	if MaxUploadSize != expectedMaxFileSize {
-		t.Errorf("Expected MaxUploadSize %d bytes (100MB), got %d", expectedMaxFileSize, MaxUploadSize)
-	}
-
-	// Test that MaxUploadSize and DefaultMaxFileSize are consistent
-	if MaxUploadSize != DefaultMaxFileSize {
-		t.Errorf("MaxUploadSize (%d) and DefaultMaxFileSize (%d) should be equal", MaxUploadSize, DefaultMaxFileSize)
+	if DefaultMaxHashSize != expectedMaxSize {
+		t.Errorf("Expected DefaultMaxHashSize %d bytes (100MB), got %d", expectedMaxSize, DefaultMaxHashSize)
 	}
 }
 
@@ -140,20 +135,27 @@ func TestFileSizeLimits(t *testing.T) {
 	oneMB := 1 << 20
 	hundredMB := 100 << 20
 
-	if DefaultMaxFileSize != hundredMB {
-		t.Errorf("Expected DefaultMaxFileSize to be 100MB (%d bytes), got %d", hundredMB, DefaultMaxFileSize)
+	if DefaultMaxUploadSize != hundredMB {
+		t.Errorf("Expected DefaultMaxUploadSize to be 100MB (%d bytes), got %d", hundredMB, DefaultMaxUploadSize)
+	}
+
+	// Test that the limits are not too small (at least 1MB)
+	if DefaultMaxUploadSize < oneMB || DefaultMaxHashSize < oneMB {
+		t.Errorf("DefaultMaxUploadSize (%d) and DefaultMaxHashSize (%d) should be at least 1MB (%d bytes)",
+			DefaultMaxUploadSize, DefaultMaxHashSize, oneMB)
 	}
 
-	// Test that the limit is not too small (at least 1MB)
-	if DefaultMaxFileSize < oneMB {
-		t.Errorf("DefaultMaxFileSize (%d) should be at least 1MB (%d bytes)", DefaultMaxFileSize, oneMB)
+	// Multipart uploads are buffered in memory only up to the upload limit
+	if UploadMemoryLimit > DefaultMaxUploadSize {
+		t.Errorf("UploadMemoryLimit (%d) should not exceed DefaultMaxUploadSize (%d)",
+			UploadMemoryLimit, DefaultMaxUploadSize)
 	}
 
 	// Test that the limit is not unreasonably large (less than 1GB)
 	oneGB := 1 << 30
-	if DefaultMaxFileSize >= oneGB {
-		t.Errorf("DefaultMaxFileSize (%d) should be less than 1GB (%d bytes) for reasonable memory usage",
-			DefaultMaxFileSize, oneGB)
+	if DefaultMaxUploadSize >= oneGB {
+		t.Errorf("DefaultMaxUploadSize (%d) should be less than 1GB (%d bytes) for reasonable memory usage",
+			DefaultMaxUploadSize, oneGB)
 	}
 }
 
@@ -256,7 +258,7 @@ func BenchmarkTimeConstantAccess(b *testing.B) {
 func BenchmarkSizeConstantAccess(b *testing.B) {
 	var result int
 	for range b.N {
-		result = DefaultMaxFileSize
+		result = DefaultMaxUploadSize
 	}
 	_ = result
 }
@@ -0,0 +1,163 @@
+package filesystem
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+)
+
+// errExcluded is returned for every path an ExcludingFileSystem leaves out,
+// as if it did not exist.
+var errExcluded = &internal.APIError{Code: "NOT_FOUND", Message: "Not found", Status: http.StatusNotFound}
+
+// ExcludingFileSystem leaves out the paths excluded reports: they are not
+// listed, reading them fails with 404, and they cannot be written, removed
+// or renamed, nor can other files be renamed to them. Every walk built on
+// it (ZIPs, manifests, the change feed, the tree) is filtered the same way
+// as listings.
+type ExcludingFileSystem struct {
+	internal.FileSystem
+	excluded func(name string) bool // Given the slash-separated path below the root
+}
+
+// NewExcluding wraps fs so that the paths excluded reports do not exist.
+func NewExcluding(fs internal.FileSystem, excluded func(name string) bool) *ExcludingFileSystem {
+	return &ExcludingFileSystem{FileSystem: fs, excluded: excluded}
+}
+
+func (e *ExcludingFileSystem) Open(name string) (io.ReadCloser, error) {
+	if err := e.check(name); err != nil {
+		return nil, err
+	}
+	return e.FileSystem.Open(name)
+}
+
+// OpenSeeker opens name unless it is excluded. Its files seek if those of
+// the wrapped FileSystem do.
+func (e *ExcludingFileSystem) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	if err := e.check(name); err != nil {
+		return nil, err
+	}
+	return internal.OpenSeeker(e.FileSystem, name)
+}
+
+func (e *ExcludingFileSystem) Stat(name string) (internal.FileInfo, error) {
+	if err := e.check(name); err != nil {
+		return nil, err
+	}
+	return e.FileSystem.Stat(name)
+}
+
+// ReadDir lists the entries of name that are not excluded, in the order of
+// the wrapped FileSystem.
+func (e *ExcludingFileSystem) ReadDir(name string) ([]internal.FileInfo, error) {
+	if err := e.check(name); err != nil {
+		return nil, err
+	}
+	files, err := e.FileSystem.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	dir := rootRelative(name)
+	visible := files[:0]
+	for _, f := range files {
+		if !e.excluded(path.Join(dir, f.Name())) {
+			visible = append(visible, f)
+		}
+	}
+	return visible, nil
+}
+
+// ReadDirIter streams the entries of name that are not excluded.
+func (e *ExcludingFileSystem) ReadDirIter(name string, fn func(internal.FileInfo) error) error {
+	if err := e.check(name); err != nil {
+		return err
+	}
+	dir := rootRelative(name)
+	return internal.ReadDirIter(e.FileSystem, name, func(f internal.FileInfo) error {
+		if e.excluded(path.Join(dir, f.Name())) {
+			return nil
+		}
+		return fn(f)
+	})
+}
+
+// Lstat returns the information of name, without following a symbolic
+// link there, unless it is excluded.
+func (e *ExcludingFileSystem) Lstat(name string) (internal.FileInfo, error) {
+	if err := e.check(name); err != nil {
+		return nil, err
+	}
+	return internal.Lstat(e.FileSystem, name)
+}
+
+// ReadDirAll lists every entry of name, excluded ones included: they are
+// still there, and a directory holding them cannot be removed.
+func (e *ExcludingFileSystem) ReadDirAll(name string) ([]internal.FileInfo, error) {
+	if err := e.check(name); err != nil {
+		return nil, err
+	}
+	return internal.ReadDirAll(e.FileSystem, name)
+}
+
+func (e *ExcludingFileSystem) Symlink(target, newname string) error {
+	if err := e.check(newname); err != nil {
+		return err
+	}
+	return internal.Symlink(e.FileSystem, target, newname)
+}
+
+// Capabilities reports those of the wrapped FileSystem; exclusion only
+// refuses individual paths.
+func (e *ExcludingFileSystem) Capabilities() internal.Capabilities {
+	return internal.CapabilitiesOf(e.FileSystem)
+}
+
+func (e *ExcludingFileSystem) Create(name string) (io.WriteCloser, error) {
+	if err := e.check(name); err != nil {
+		return nil, err
+	}
+	return e.FileSystem.Create(name)
+}
+
+func (e *ExcludingFileSystem) Mkdir(name string, perm os.FileMode) error {
+	if err := e.check(name); err != nil {
+		return err
+	}
+	return e.FileSystem.Mkdir(name, perm)
+}
+
+func (e *ExcludingFileSystem) Remove(name string) error {
+	if err := e.check(name); err != nil {
+		return err
+	}
+	return e.FileSystem.Remove(name)
+}
+
+func (e *ExcludingFileSystem) Rename(oldname, newname string) error {
+	if err := e.check(oldname); err != nil {
+		return err
+	}
+	if err := e.check(newname); err != nil {
+		return err
+	}
+	return e.FileSystem.Rename(oldname, newname)
+}
+
+func (e *ExcludingFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	if err := e.check(name); err != nil {
+		return err
+	}
+	return e.FileSystem.Chtimes(name, atime, mtime)
+}
+
+func (e *ExcludingFileSystem) check(name string) error {
+	if e.excluded(rootRelative(name)) {
+		return errExcluded
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package filesystem
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+)
+
+func TestExcludingFileSystem(t *testing.T) {
+	root := t.TempDir()
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.MkdirAll(filepath.Join(root, "keys"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "readme.txt"), "hello", mtime)
+	writeFile(t, filepath.Join(root, "server.pem"), "secret", mtime)
+	writeFile(t, filepath.Join(root, "keys", "note.txt"), "note", mtime)
+	ex := NewExcluding(NewLocal(root, true), func(name string) bool {
+		return strings.HasSuffix(name, ".pem") || path.Base(name) == "keys"
+	})
+
+	entries, err := ex.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "readme.txt" {
+		t.Errorf("Expected only readme.txt listed, got %v", entries)
+	}
+	var streamed []string
+	if err := internal.ReadDirIter(ex, "", func(fi internal.FileInfo) error {
+		streamed = append(streamed, fi.Name())
+		return nil
+	}); err != nil || len(streamed) != 1 || streamed[0] != "readme.txt" {
+		t.Errorf("Expected only readme.txt streamed, got %v, %v", streamed, err)
+	}
+
+	for _, name := range []string{"server.pem", "/keys", `keys\note.txt`} {
+		var apiErr *internal.APIError
+		if _, err := ex.Stat(name); !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+			t.Errorf("Expected %s to be a 404, got %v", name, err)
+		}
+	}
+	if _, err := ex.Open("readme.txt"); err != nil {
+		t.Errorf("Expected readme.txt to open, got %v", err)
+	}
+	if err := ex.Rename("readme.txt", "readme.pem"); err == nil {
+		t.Error("Expected a rename to an excluded name to be refused")
+	}
+	if _, err := ex.Create("new.pem"); err == nil {
+		t.Error("Expected creating an excluded file to be refused")
+	}
+}
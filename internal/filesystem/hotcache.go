@@ -0,0 +1,235 @@
+package filesystem
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+)
+
+// HotCache keeps the contents of small files in memory so frequently
+// requested ones are served without reading the disk. Entries are keyed by
+// full path and remember the size and mtime they were read at; a Stat that
+// reports anything else is a miss. The least recently used entries are
+// dropped once the cached bytes exceed maxBytes. A HotCache may be shared by
+// several CachedFileSystems.
+type HotCache struct {
+	maxBytes    int64
+	maxFileSize int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // full path -> *hotCacheEntry
+	lru     *list.List               // most recently used at the front
+	size    int64
+	hits    int64
+	misses  int64
+}
+
+type hotCacheEntry struct {
+	key     string
+	size    int64
+	modTime time.Time
+	data    []byte
+	etag    string
+}
+
+// HotCacheStats reports the effectiveness of a HotCache.
+type HotCacheStats struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRate  float64 `json:"hitRate"` // Hits / (Hits + Misses), 0 before the first lookup
+	Entries  int     `json:"entries"`
+	Bytes    int64   `json:"bytes"`
+	MaxBytes int64   `json:"maxBytes"`
+}
+
+// NewHotCache returns a cache holding up to maxBytes of file contents, each
+// file at most maxFileSize bytes.
+func NewHotCache(maxBytes, maxFileSize int64) *HotCache {
+	return &HotCache{
+		maxBytes:    maxBytes,
+		maxFileSize: min(maxFileSize, maxBytes),
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// Stats returns the current hit rate and usage of the cache.
+func (c *HotCache) Stats() HotCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := HotCacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Entries:  len(c.entries),
+		Bytes:    c.size,
+		MaxBytes: c.maxBytes,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// get returns the entry for key if it was read at size and modTime.
+func (c *HotCache) get(key string, size int64, modTime time.Time) (*hotCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*hotCacheEntry)
+		if entry.size == size && entry.modTime.Equal(modTime) {
+			c.lru.MoveToFront(el)
+			c.hits++
+			return entry, true
+		}
+		c.removeLocked(el)
+	}
+	c.misses++
+	return nil, false
+}
+
+func (c *HotCache) put(entry *hotCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[entry.key]; ok {
+		c.removeLocked(el)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += entry.size
+	for c.size > c.maxBytes {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// invalidate drops key and, when it is a directory, everything below it.
+func (c *HotCache) invalidate(key string) {
+	if key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.removeLocked(el)
+	}
+	prefix := key + string(os.PathSeparator)
+	for k, el := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			c.removeLocked(el)
+		}
+	}
+}
+
+func (c *HotCache) removeLocked(el *list.Element) {
+	entry := c.lru.Remove(el).(*hotCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// CachedFileSystem serves small files of a Local filesystem from a HotCache.
+// Writes made through it invalidate the affected entries; changes made
+// behind its back are noticed through the size and mtime.
+type CachedFileSystem struct {
+	*Local
+	cache *HotCache
+}
+
+// NewCached puts cache in front of fs.
+func NewCached(fs *Local, cache *HotCache) *CachedFileSystem {
+	return &CachedFileSystem{Local: fs, cache: cache}
+}
+
+// CachedFile is returned by CachedFileSystem.Open for files served from
+// memory. It implements internal.ETagger.
+type CachedFile struct {
+	*bytes.Reader
+	etag string
+}
+
+// ETag returns the quoted SHA-256 of the contents, as used for content
+// ETags.
+func (f *CachedFile) ETag() string { return f.etag }
+
+// Close does nothing; the contents stay cached.
+func (f *CachedFile) Close() error { return nil }
+
+// Open returns regular files no larger than the cache's file size limit from
+// memory, reading and caching them on a miss.
+func (c *CachedFileSystem) Open(name string) (io.ReadCloser, error) {
+	return c.OpenSeeker(name)
+}
+
+// OpenSeeker is Open. Cached files seek within memory, the others are the
+// files of the local disk.
+func (c *CachedFileSystem) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	info, err := c.Local.Stat(name)
+	if err != nil || !internal.FileMode(info).IsRegular() || info.Size() > c.cache.maxFileSize {
+		return c.Local.OpenSeeker(name)
+	}
+
+	key := c.getFullPath(name)
+	if entry, ok := c.cache.get(key, info.Size(), info.ModTime()); ok {
+		return &CachedFile{Reader: bytes.NewReader(entry.data), etag: entry.etag}, nil
+	}
+
+	file, err := c.Local.OpenSeeker(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, info.Size()+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != info.Size() {
+		// Changed since the Stat, so the size and mtime do not describe it
+		return c.Local.OpenSeeker(name)
+	}
+
+	sum := sha256.Sum256(data)
+	entry := &hotCacheEntry{
+		key:     key,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		data:    data,
+		etag:    `"` + hex.EncodeToString(sum[:]) + `"`,
+	}
+	c.cache.put(entry)
+	return &CachedFile{Reader: bytes.NewReader(data), etag: entry.etag}, nil
+}
+
+func (c *CachedFileSystem) Create(name string) (io.WriteCloser, error) {
+	c.cache.invalidate(c.getFullPath(name))
+	return c.Local.Create(name)
+}
+
+func (c *CachedFileSystem) Remove(name string) error {
+	defer c.cache.invalidate(c.getFullPath(name))
+	return c.Local.Remove(name)
+}
+
+func (c *CachedFileSystem) Rename(oldname, newname string) error {
+	defer c.cache.invalidate(c.getFullPath(newname))
+	defer c.cache.invalidate(c.getFullPath(oldname))
+	return c.Local.Rename(oldname, newname)
+}
+
+func (c *CachedFileSystem) Symlink(target, newname string) error {
+	defer c.cache.invalidate(c.getFullPath(newname))
+	return c.Local.Symlink(target, newname)
+}
+
+func (c *CachedFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	defer c.cache.invalidate(c.getFullPath(name))
+	return c.Local.Chtimes(name, atime, mtime)
+}
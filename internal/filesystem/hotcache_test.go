@@ -0,0 +1,124 @@
+package filesystem
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readCached(t *testing.T, fs *CachedFileSystem, name string) (string, bool) {
+	t.Helper()
+	file, err := fs.Open(name)
+	if err != nil {
+		t.Fatalf("Open(%q) failed: %v", name, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Reading %q failed: %v", name, err)
+	}
+	_, cached := file.(*CachedFile)
+	return string(data), cached
+}
+
+func writeFile(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+}
+
+func TestCachedFileSystem_ServesUpdatedContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.js")
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeFile(t, path, "version1", mtime)
+
+	cache := NewHotCache(1<<20, 1<<10)
+	fs := NewCached(NewLocal(dir, false), cache)
+
+	if got, _ := readCached(t, fs, "app.js"); got != "version1" {
+		t.Fatalf("expected version1, got %q", got)
+	}
+	if got, cached := readCached(t, fs, "app.js"); got != "version1" || !cached {
+		t.Fatalf("expected a cached version1, got %q (cached %v)", got, cached)
+	}
+
+	// Same size, new mtime
+	writeFile(t, path, "version2", mtime.Add(time.Second))
+	if got, _ := readCached(t, fs, "app.js"); got != "version2" {
+		t.Errorf("expected version2 after an mtime change, got %q", got)
+	}
+
+	// Same mtime, new size
+	writeFile(t, path, "version three", mtime.Add(time.Second))
+	if got, _ := readCached(t, fs, "app.js"); got != "version three" {
+		t.Errorf("expected version three after a size change, got %q", got)
+	}
+
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 3 || stats.HitRate != 0.25 {
+		t.Errorf("expected 1 hit and 3 misses, got %+v", stats)
+	}
+}
+
+func TestCachedFileSystem_WritesInvalidate(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeFile(t, filepath.Join(dir, "a.txt"), "aaaa", mtime)
+	writeFile(t, filepath.Join(dir, "b.txt"), "bbbb", mtime)
+
+	fs := NewCached(NewLocal(dir, false), NewHotCache(1<<20, 1<<10))
+	readCached(t, fs, "a.txt")
+	readCached(t, fs, "b.txt")
+
+	// Same size and mtime after the rename, so only invalidation notices
+	if err := fs.Rename("b.txt", "a.txt"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if got, _ := readCached(t, fs, "a.txt"); got != "bbbb" {
+		t.Errorf("expected the renamed content, got %q", got)
+	}
+
+	if err := fs.Remove("a.txt"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := fs.Open("a.txt"); err == nil {
+		t.Error("expected a removed file not to be served from cache")
+	}
+}
+
+func TestHotCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"a", "b", "c"} {
+		writeFile(t, filepath.Join(dir, name), strings.Repeat(name, 40), mtime)
+	}
+	writeFile(t, filepath.Join(dir, "big"), strings.Repeat("x", 101), mtime)
+
+	cache := NewHotCache(100, 100)
+	fs := NewCached(NewLocal(dir, false), cache)
+
+	readCached(t, fs, "a")
+	readCached(t, fs, "b")
+	readCached(t, fs, "a") // b is now the least recently used
+	readCached(t, fs, "c")
+
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Bytes != 80 {
+		t.Errorf("expected 2 entries of 80 bytes, got %+v", stats)
+	}
+	if _, cached := readCached(t, fs, "a"); !cached {
+		t.Error("expected a to stay cached")
+	}
+	if got, cached := readCached(t, fs, "big"); cached || got != strings.Repeat("x", 101) {
+		t.Errorf("expected a file over the limit to be read from disk, got cached %v", cached)
+	}
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Bytes > stats.MaxBytes {
+		t.Errorf("expected the cache to stay within its limit, got %+v", stats)
+	}
+}
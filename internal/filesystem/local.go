@@ -1,21 +1,31 @@
 package filesystem
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/samzong/gofs/internal"
 	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/pathsafe"
 )
 
 type Local struct {
 	root       string
 	showHidden bool
+
+	caseOnce      sync.Once
+	caseSensitive bool
 }
 
 func NewLocal(root string, showHidden bool) *Local {
@@ -30,6 +40,12 @@ func (fs *Local) Root() string {
 }
 
 func (fs *Local) Open(name string) (io.ReadCloser, error) {
+	return fs.OpenSeeker(name)
+}
+
+// OpenSeeker opens name for reading. The file is the *os.File itself, so it
+// seeks and can be handed to sendfile.
+func (fs *Local) OpenSeeker(name string) (io.ReadSeekCloser, error) {
 	fullPath := fs.getFullPath(name)
 	if fullPath == "" {
 		return nil, &internal.APIError{
@@ -43,7 +59,7 @@ func (fs *Local) Open(name string) (io.ReadCloser, error) {
 		return nil, err
 	}
 
-	// #nosec G304 - path is validated by fileutil.SafePath
+	// #nosec G304 - path is validated by pathsafe.Clean
 	file, err := os.Open(fullPath)
 	if err != nil {
 		return nil, &internal.APIError{
@@ -52,7 +68,63 @@ func (fs *Local) Open(name string) (io.ReadCloser, error) {
 			Status:  http.StatusNotFound,
 		}
 	}
-	return file, nil
+	return &localFile{file}, nil
+}
+
+// osFile names the embedded *os.File of localFile so its File method does
+// not collide with the field.
+type osFile = os.File
+
+// localFile is a file opened by Local. It keeps every method of *os.File
+// and implements internal.OSFile.
+type localFile struct {
+	*osFile
+}
+
+var (
+	_ internal.OSFile             = (*localFile)(nil)
+	_ internal.SeekOpener         = (*Local)(nil)
+	_ internal.CapabilityReporter = (*Local)(nil)
+	_ internal.CapabilityReporter = (*ReadonlyFileSystem)(nil)
+)
+
+func (f *localFile) File() *os.File { return f.osFile }
+
+// Capabilities reports a writable disk whose files seek. Whether names are
+// case-sensitive depends on the filesystem under the root, so it is probed
+// once.
+func (fs *Local) Capabilities() internal.Capabilities {
+	fs.caseOnce.Do(func() { fs.caseSensitive = probeCaseSensitive(fs.root) })
+	return internal.Capabilities{
+		CanWrite:      true,
+		CanSeek:       true,
+		CanRename:     true,
+		CaseSensitive: fs.caseSensitive,
+		CheapListing:  true,
+	}
+}
+
+// probeCaseSensitive stats root under its own name with the case of its last
+// element swapped, without writing anything. Names without letters cannot
+// be probed this way and fall back to the platform default.
+func probeCaseSensitive(root string) bool {
+	base := filepath.Base(root)
+	swapped := strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, base)
+	if swapped == base {
+		return runtime.GOOS != "darwin" && runtime.GOOS != "windows"
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return true
+	}
+	other, err := os.Stat(filepath.Join(filepath.Dir(root), swapped))
+	return err != nil || !os.SameFile(info, other)
 }
 
 // Stat returns file information for the given path.
@@ -83,46 +155,137 @@ func (fs *Local) Stat(name string) (internal.FileInfo, error) {
 	return &localFileInfo{FileInfo: info}, nil
 }
 
-// ReadDir reads the directory and returns a list of directory entries.
-func (fs *Local) ReadDir(name string) ([]internal.FileInfo, error) {
+// Lstat returns file information for the given path without following a
+// symbolic link there. The information of a link carries its target.
+func (fs *Local) Lstat(name string) (internal.FileInfo, error) {
 	fullPath := fs.getFullPath(name)
 	if fullPath == "" {
 		return nil, &internal.APIError{
 			Code:    "INVALID_PATH",
-			Message: "Invalid directory path",
+			Message: "Invalid file path",
 			Status:  http.StatusBadRequest,
 		}
 	}
 
-	// Verify symlink safety
-	if err := fs.verifySymlinkSafety(fullPath); err != nil {
+	// The link itself is not followed, but the directories leading to it are
+	if err := fs.verifySymlinkSafety(filepath.Dir(fullPath)); err != nil {
 		return nil, err
 	}
 
-	entries, err := os.ReadDir(fullPath)
+	info, err := os.Lstat(fullPath)
 	if err != nil {
 		return nil, &internal.APIError{
-			Code:    "DIRECTORY_READ_ERROR",
-			Message: "Unable to read directory contents",
-			Status:  http.StatusForbidden,
+			Code:    "FILE_STAT_ERROR",
+			Message: "Unable to get file information",
+			Status:  http.StatusNotFound,
 		}
 	}
 
-	result := make([]internal.FileInfo, 0, len(entries))
-	for _, entry := range entries {
-		// Filter hidden files if showHidden is false
-		if !fs.showHidden && isHidden(entry.Name()) {
-			continue
+	fi := &localFileInfo{FileInfo: info}
+	if info.Mode()&os.ModeSymlink != 0 {
+		fi.linkTarget = fs.linkTarget(fullPath)
+	}
+	return fi, nil
+}
+
+// dirBatchSize is how many entries ReadDirIter reads from the OS at a time.
+const dirBatchSize = 256
+
+// ReadDir reads the directory and returns its entries sorted by name.
+func (fs *Local) ReadDir(name string) ([]internal.FileInfo, error) {
+	var result []internal.FileInfo
+	err := fs.ReadDirIter(name, func(fi internal.FileInfo) error {
+		result = append(result, fi)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(result, func(a, b internal.FileInfo) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return result, nil
+}
+
+// ReadDirAll reads the directory and returns all of its entries, hidden ones
+// included, sorted by name.
+func (fs *Local) ReadDirAll(name string) ([]internal.FileInfo, error) {
+	var result []internal.FileInfo
+	err := fs.readDirIter(name, true, func(fi internal.FileInfo) error {
+		result = append(result, fi)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(result, func(a, b internal.FileInfo) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return result, nil
+}
+
+// ReadDirIter calls fn for each entry of the directory in the order the OS
+// returns them, reading dirBatchSize entries at a time so huge directories
+// are never held in memory at once.
+func (fs *Local) ReadDirIter(name string, fn func(internal.FileInfo) error) error {
+	return fs.readDirIter(name, fs.showHidden, fn)
+}
+
+// readDirIter is ReadDirIter, leaving out hidden entries unless showHidden.
+func (fs *Local) readDirIter(name string, showHidden bool, fn func(internal.FileInfo) error) error {
+	fullPath := fs.getFullPath(name)
+	if fullPath == "" {
+		return &internal.APIError{
+			Code:    "INVALID_PATH",
+			Message: "Invalid directory path",
+			Status:  http.StatusBadRequest,
 		}
+	}
+
+	// Verify symlink safety
+	if err := fs.verifySymlinkSafety(fullPath); err != nil {
+		return err
+	}
+
+	readErr := &internal.APIError{
+		Code:    "DIRECTORY_READ_ERROR",
+		Message: "Unable to read directory contents",
+		Status:  http.StatusForbidden,
+	}
+	// #nosec G304 - path is validated by pathsafe.Clean
+	dir, err := os.Open(fullPath)
+	if err != nil {
+		return readErr
+	}
+	defer func() { _ = dir.Close() }()
+
+	for {
+		entries, err := dir.ReadDir(dirBatchSize)
+		for _, entry := range entries {
+			// Filter hidden files if showHidden is false
+			if !showHidden && isHidden(path.Join(name, entry.Name())) {
+				continue
+			}
 
-		info, err := entry.Info()
+			info, err := entry.Info()
+			if err != nil {
+				continue // Skip files we can't stat
+			}
+			fi := &localFileInfo{FileInfo: info}
+			if info.Mode()&os.ModeSymlink != 0 {
+				fi.linkTarget = fs.linkTarget(filepath.Join(fullPath, entry.Name()))
+			}
+			if err := fn(fi); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
 		if err != nil {
-			continue // Skip files we can't stat
+			return readErr
 		}
-		result = append(result, &localFileInfo{FileInfo: info})
 	}
-
-	return result, nil
 }
 
 // Create creates or truncates the named file for writing.
@@ -134,8 +297,8 @@ func (fs *Local) Create(name string) (io.WriteCloser, error) {
 	}
 
 	// Security: Path is validated through multi-layer protection:
-	// 1. Handler layer: fileutil.SafePath() validates user input
-	// 2. getFullPath(): Additional fileutil.SafePath() + filepath.Rel() validation
+	// 1. Handler layer: pathsafe.Clean() validates user input
+	// 2. getFullPath(): Additional pathsafe.Clean() + filepath.Rel() validation
 	// 3. Final check: Ensures path stays within root directory bounds
 	file, err := os.Create(path) // #nosec G304 - Path validated through secure getFullPath chain
 	if err != nil {
@@ -170,16 +333,58 @@ func (fs *Local) Remove(name string) error {
 	return nil
 }
 
-// getFullPath converts a request path to a full filesystem path.
-// It uses fileutil.SafePath for validation and returns empty string if invalid.
-func (fs *Local) getFullPath(name string) string {
-	if name == "" {
-		name = "."
+// Rename moves oldname to newname, replacing newname if it exists.
+func (fs *Local) Rename(oldname, newname string) error {
+	oldPath := fs.getFullPath(oldname)
+	newPath := fs.getFullPath(newname)
+	if oldPath == "" || newPath == "" {
+		return fmt.Errorf("invalid path: %s -> %s", oldname, newname)
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("renaming %q to %q: %w", oldPath, newPath, err)
+	}
+	return nil
+}
+
+// Chtimes sets the access and modification times of the named file.
+func (fs *Local) Chtimes(name string, atime, mtime time.Time) error {
+	path := fs.getFullPath(name)
+	if path == "" {
+		return fmt.Errorf("invalid path: %s", name)
+	}
+
+	if err := os.Chtimes(path, atime, mtime); err != nil {
+		return fmt.Errorf("setting times of %q: %w", path, err)
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to target, a slash-separated
+// path relative to the directory of newname that must stay inside the root.
+func (fs *Local) Symlink(target, newname string) error {
+	path := fs.getFullPath(newname)
+	if path == "" {
+		return fmt.Errorf("invalid path: %s", newname)
+	}
+
+	target = filepath.FromSlash(target)
+	relPath, err := filepath.Rel(fs.root, filepath.Join(filepath.Dir(path), target))
+	if filepath.IsAbs(target) || err != nil || escapesRoot(relPath) {
+		return fmt.Errorf("symlink %q points outside the root", newname)
+	}
+
+	if err := os.Symlink(target, path); err != nil {
+		return fmt.Errorf("creating symlink %q: %w", path, err)
 	}
+	return nil
+}
 
-	// Use fileutil.SafePath for validation
-	safeName := fileutil.SafePath(name)
-	if safeName == "" {
+// getFullPath converts a request path to a full filesystem path.
+// It uses pathsafe.Clean for validation and returns empty string if invalid.
+func (fs *Local) getFullPath(name string) string {
+	safeName, err := pathsafe.Clean(name)
+	if err != nil {
 		return ""
 	}
 
@@ -190,13 +395,20 @@ func (fs *Local) getFullPath(name string) string {
 	cleanRoot := filepath.Clean(fs.root)
 	cleanPath := filepath.Clean(fullPath)
 	relPath, err := filepath.Rel(cleanRoot, cleanPath)
-	if err != nil || strings.HasPrefix(relPath, "..") || filepath.IsAbs(relPath) {
+	if err != nil || escapesRoot(relPath) {
 		return ""
 	}
 
 	return fullPath
 }
 
+// escapesRoot reports whether a path relative to the root, as returned by
+// filepath.Rel, points outside of it. Names that merely start with "..", such
+// as "..notes", stay inside.
+func escapesRoot(relPath string) bool {
+	return relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) || filepath.IsAbs(relPath)
+}
+
 // verifySymlinkSafety checks if a symlink points outside the root directory.
 func (fs *Local) verifySymlinkSafety(fullPath string) error {
 	info, err := os.Lstat(fullPath)
@@ -229,7 +441,7 @@ func (fs *Local) verifySymlinkSafety(fullPath string) error {
 
 		// Use filepath.Rel to properly verify containment
 		relPath, err := filepath.Rel(cleanRoot, resolved)
-		if err != nil || strings.HasPrefix(relPath, "..") || filepath.IsAbs(relPath) {
+		if err != nil || escapesRoot(relPath) {
 			return &internal.APIError{
 				Code:    "SYMLINK_ATTACK",
 				Message: "Symlink points outside root directory",
@@ -241,14 +453,38 @@ func (fs *Local) verifySymlinkSafety(fullPath string) error {
 	return nil
 }
 
-// isHidden checks if a file or directory is hidden.
-func isHidden(name string) bool {
-	return fileutil.IsHidden(name)
+// linkTarget returns the target of the symlink at fullPath relative to the
+// link's directory, or "" if it cannot be read or points outside the root, so
+// listings never reveal paths on the host.
+func (fs *Local) linkTarget(fullPath string) string {
+	target, err := os.Readlink(fullPath)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(fullPath), target)
+	}
+	relPath, err := filepath.Rel(fs.root, filepath.Clean(target))
+	if err != nil || escapesRoot(relPath) {
+		return ""
+	}
+	linkRel, err := filepath.Rel(filepath.Dir(fullPath), target)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(linkRel)
+}
+
+// isHidden checks if a file or directory, by its path below the root, is
+// hidden.
+func isHidden(rel string) bool {
+	return fileutil.IsHiddenPath(rel)
 }
 
-// localFileInfo implements internal.FileInfo for os.FileInfo.
+// localFileInfo implements internal.ExtendedFileInfo for os.FileInfo.
 type localFileInfo struct {
 	os.FileInfo
+	linkTarget string
 }
 
 // Name returns the base name of the file.
@@ -271,6 +507,24 @@ func (fi *localFileInfo) ModTime() time.Time {
 	return fi.FileInfo.ModTime()
 }
 
+// Mode returns the file mode and permission bits.
+func (fi *localFileInfo) Mode() os.FileMode {
+	return fi.FileInfo.Mode()
+}
+
+// LinkTarget returns the symlink target for entries listed by ReadDir.
+func (fi *localFileInfo) LinkTarget() string {
+	return fi.linkTarget
+}
+
+// Owner returns the numeric owner and group on platforms that have them.
+func (fi *localFileInfo) Owner() (uid, gid int, ok bool) {
+	return fileOwner(fi.FileInfo)
+}
+
+// ErrReadonly is wrapped by every write attempted on a ReadonlyFileSystem.
+var ErrReadonly = errors.New("read-only filesystem")
+
 // ReadonlyFileSystem wraps a FileSystem to make it read-only
 type ReadonlyFileSystem struct {
 	internal.FileSystem
@@ -281,17 +535,46 @@ func NewReadonly(fs internal.FileSystem) *ReadonlyFileSystem {
 	return &ReadonlyFileSystem{FileSystem: fs}
 }
 
+// OpenSeeker opens name for reading. Its files seek if those of the wrapped
+// FileSystem do.
+func (r *ReadonlyFileSystem) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	return internal.OpenSeeker(r.FileSystem, name)
+}
+
+// Capabilities reports those of the wrapped FileSystem without writes.
+func (r *ReadonlyFileSystem) Capabilities() internal.Capabilities {
+	caps := internal.CapabilitiesOf(r.FileSystem)
+	caps.CanWrite = false
+	caps.CanRename = false
+	return caps
+}
+
 // Create is disabled for read-only filesystem
 func (r *ReadonlyFileSystem) Create(name string) (io.WriteCloser, error) {
-	return nil, fmt.Errorf("read-only filesystem: cannot create %s", name)
+	return nil, fmt.Errorf("%w: cannot create %s", ErrReadonly, name)
 }
 
 // Mkdir is disabled for read-only filesystem
 func (r *ReadonlyFileSystem) Mkdir(name string, _ os.FileMode) error {
-	return fmt.Errorf("read-only filesystem: cannot create directory %s", name)
+	return fmt.Errorf("%w: cannot create directory %s", ErrReadonly, name)
 }
 
 // Remove is disabled for read-only filesystem
 func (r *ReadonlyFileSystem) Remove(name string) error {
-	return fmt.Errorf("read-only filesystem: cannot remove %s", name)
+	return fmt.Errorf("%w: cannot remove %s", ErrReadonly, name)
+}
+
+// Rename is disabled for read-only filesystem
+func (r *ReadonlyFileSystem) Rename(oldname, _ string) error {
+	return fmt.Errorf("%w: cannot rename %s", ErrReadonly, oldname)
+}
+
+// Chtimes is disabled for read-only filesystem
+func (r *ReadonlyFileSystem) Chtimes(name string, _, _ time.Time) error {
+	return fmt.Errorf("%w: cannot change times of %s", ErrReadonly, name)
+}
+
+// ReadDirIter streams the listing of the wrapped filesystem.
+func (r *ReadonlyFileSystem) ReadDirIter(name string, fn func(internal.FileInfo) error) error {
+	return internal.ReadDirIter(r.FileSystem, name, fn)
 }
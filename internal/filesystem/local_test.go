@@ -0,0 +1,217 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+)
+
+func TestLocal_Rename(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old.txt"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("stale"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	fs := NewLocal(dir, false)
+	if err := fs.Rename("old.txt", "new.txt"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected old.txt to be gone, got %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "new.txt"))
+	if err != nil || string(content) != "data" {
+		t.Errorf("expected new.txt to be replaced, got %q (%v)", content, err)
+	}
+
+	if err := fs.Rename("../escape.txt", "new.txt"); err == nil {
+		t.Error("expected error for path outside root")
+	}
+	if err := NewReadonly(fs).Rename("new.txt", "other.txt"); !errors.Is(err, ErrReadonly) {
+		t.Error("expected error from read-only filesystem")
+	}
+}
+
+func TestLocal_Chtimes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	fs := NewLocal(dir, false)
+	mtime := time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := fs.Chtimes("a.txt", mtime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	info, err := fs.Stat("a.txt")
+	if err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v (%v)", mtime, info.ModTime(), err)
+	}
+
+	if err := fs.Chtimes("../escape.txt", mtime, mtime); err == nil {
+		t.Error("expected error for path outside root")
+	}
+	if err := NewReadonly(fs).Chtimes("a.txt", mtime, mtime); !errors.Is(err, ErrReadonly) {
+		t.Error("expected error from read-only filesystem")
+	}
+}
+
+func TestLocal_OpenOSFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	f, err := NewReadonly(NewLocal(dir, false)).Open("a.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	osf, ok := f.(internal.OSFile)
+	if !ok {
+		t.Fatalf("expected an internal.OSFile, got %T", f)
+	}
+	if got := osf.File().Name(); got != filepath.Join(dir, "a.txt") {
+		t.Errorf("expected the opened file, got %s", got)
+	}
+	if _, ok := f.(io.ReadSeeker); !ok {
+		t.Error("expected the file to stay seekable")
+	}
+}
+
+func TestLocal_ReadDirIter(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.txt", "a.txt", ".hidden", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	for i := range dirBatchSize + 10 {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("many-%04d", i)), nil, 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	fs := NewLocal(dir, false)
+	var names []string
+	err := fs.ReadDirIter(".", func(fi internal.FileInfo) error {
+		names = append(names, fi.Name())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadDirIter failed: %v", err)
+	}
+	if len(names) != dirBatchSize+13 || slices.Contains(names, ".hidden") {
+		t.Errorf("expected %d visible entries, got %d", dirBatchSize+13, len(names))
+	}
+
+	listed, err := fs.ReadDir(".")
+	if err != nil || len(listed) != len(names) || listed[0].Name() != "a.txt" {
+		t.Errorf("expected ReadDir to return the same entries sorted, got %d (%v)", len(listed), err)
+	}
+
+	// SkipAll stops the listing early without an error, through any wrapper
+	count := 0
+	err = internal.ReadDirIter(NewReadonly(fs), ".", func(internal.FileInfo) error {
+		count++
+		if count == 3 {
+			return iofs.SkipAll
+		}
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Errorf("expected SkipAll to stop after 3 entries, got %d (%v)", count, err)
+	}
+
+	stop := errors.New("stop")
+	if err := fs.ReadDirIter(".", func(internal.FileInfo) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+	if err := fs.ReadDirIter("a.txt", func(internal.FileInfo) error { return nil }); err == nil {
+		t.Error("expected an error listing a file")
+	}
+	if err := fs.ReadDirIter("../escape", func(internal.FileInfo) error { return nil }); err == nil {
+		t.Error("expected an error for a path outside root")
+	}
+}
+
+// BenchmarkLocal_ReadDir and BenchmarkLocal_ReadDirIter list a directory of
+// 20k entries; compare B/op to see what streaming saves.
+func BenchmarkLocal_ReadDir(b *testing.B) {
+	fs := NewLocal(benchmarkDir(b, 20000), false)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := fs.ReadDir("."); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLocal_ReadDirIter(b *testing.B) {
+	fs := NewLocal(benchmarkDir(b, 20000), false)
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := fs.ReadDirIter(".", func(internal.FileInfo) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDir(b *testing.B, n int) string {
+	b.Helper()
+	dir := b.TempDir()
+	for i := range n {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file-%06d", i)), nil, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCapabilities(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Root")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "probe"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := os.Stat(filepath.Join(dir, "PROBE"))
+	caseSensitive := err != nil
+
+	local := NewLocal(dir, false)
+	tests := []struct {
+		name string
+		fs   internal.FileSystem
+		want internal.Capabilities
+	}{
+		{"local", local, internal.Capabilities{
+			CanWrite: true, CanSeek: true, CanRename: true, CaseSensitive: caseSensitive, CheapListing: true,
+		}},
+		{"readonly", NewReadonly(local), internal.Capabilities{
+			CanSeek: true, CaseSensitive: caseSensitive, CheapListing: true,
+		}},
+		{"cached", NewCached(local, NewHotCache(1<<20, 1<<10)), internal.Capabilities{
+			CanWrite: true, CanSeek: true, CanRename: true, CaseSensitive: caseSensitive, CheapListing: true,
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := internal.CapabilitiesOf(tc.fs); got != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package filesystem
+
+import "os"
+
+// fileOwner reports no owner on platforms without numeric uids.
+func fileOwner(os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
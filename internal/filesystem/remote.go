@@ -0,0 +1,230 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/pkg/client"
+)
+
+// Timeouts of the requests a Remote makes. Bodies have no deadline, so large
+// files stream for as long as they take.
+const (
+	remoteDialTimeout   = 5 * time.Second
+	remoteHeaderTimeout = 10 * time.Second
+)
+
+var (
+	_ internal.SeekOpener         = (*Remote)(nil)
+	_ internal.CapabilityReporter = (*Remote)(nil)
+	_ internal.ETagger            = (*remoteFile)(nil)
+)
+
+// UnavailableError is returned by Remote for every failure other than a
+// missing file: the remote server is down, unreachable, refuses the
+// credentials or answers with an error.
+type UnavailableError struct {
+	Mount string // Path the remote is mounted at
+	Err   error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("remote mount %s is unavailable: %v", e.Mount, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error { return e.Err }
+
+// Remote serves the tree of another gofs server, read from its JSON listings
+// and file GETs; files are stat'ed with HEAD. It is read-only. Its files seek by reopening the download at
+// the new offset with a Range request, so ranges pass through to the remote
+// instead of being read and discarded.
+type Remote struct {
+	client *client.Client
+	mount  string
+}
+
+// NewRemote returns a Remote for the gofs server at baseURL, mounted at
+// mount. username may be empty for a server without authentication.
+func NewRemote(mount, baseURL, username, password string) (*Remote, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: remoteDialTimeout}).DialContext
+	transport.ResponseHeaderTimeout = remoteHeaderTimeout
+
+	opts := []client.Option{
+		client.WithHTTPClient(&http.Client{Transport: transport}),
+		// A request waits for its response, so a server that is down is
+		// reported after one quick retry rather than the client default
+		client.WithRetry(1, 100*time.Millisecond),
+	}
+	if username != "" {
+		opts = append(opts, client.WithBasicAuth(username, password))
+	}
+	c, err := client.New(baseURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Remote{client: c, mount: mount}, nil
+}
+
+// Capabilities reports a read-only backend whose files seek. Every listing
+// is a request to the remote server, so listing is not cheap.
+func (r *Remote) Capabilities() internal.Capabilities {
+	return internal.Capabilities{CanSeek: true, CaseSensitive: true}
+}
+
+func (r *Remote) Open(name string) (io.ReadCloser, error) {
+	return r.OpenSeeker(name)
+}
+
+// OpenSeeker opens the named file. Nothing is downloaded until the first
+// Read.
+func (r *Remote) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	name = remoteName(name)
+	info, err := r.client.Stat(name)
+	if err != nil {
+		return nil, r.wrap(err)
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	return &remoteFile{remote: r, name: name, info: info}, nil
+}
+
+func (r *Remote) Stat(name string) (internal.FileInfo, error) {
+	info, err := r.client.Stat(remoteName(name))
+	if err != nil {
+		return nil, r.wrap(err)
+	}
+	return info, nil
+}
+
+func (r *Remote) ReadDir(name string) ([]internal.FileInfo, error) {
+	entries, err := r.client.ReadDir(remoteName(name))
+	if err != nil {
+		return nil, r.wrap(err)
+	}
+	infos := make([]internal.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, r.wrap(err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (r *Remote) Create(name string) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("%w: cannot create %s", ErrReadonly, name)
+}
+
+func (r *Remote) Mkdir(name string, _ os.FileMode) error {
+	return fmt.Errorf("%w: cannot create directory %s", ErrReadonly, name)
+}
+
+func (r *Remote) Remove(name string) error {
+	return fmt.Errorf("%w: cannot remove %s", ErrReadonly, name)
+}
+
+func (r *Remote) Rename(oldname, _ string) error {
+	return fmt.Errorf("%w: cannot rename %s", ErrReadonly, oldname)
+}
+
+func (r *Remote) Chtimes(name string, _, _ time.Time) error {
+	return fmt.Errorf("%w: cannot change times of %s", ErrReadonly, name)
+}
+
+// wrap passes missing and invalid names through and reports anything else
+// as the remote being unavailable.
+func (r *Remote) wrap(err error) error {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		return err
+	}
+	return &UnavailableError{Mount: r.mount, Err: err}
+}
+
+// remoteName turns a handler path such as "/docs/a.txt" or "" into the
+// io/fs form the client expects.
+func remoteName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// remoteFile downloads a file from its current offset on the first Read
+// after it was opened or moved by Seek. Downloads after the first are only
+// accepted for the ETag the first was answered with, so a file changed in
+// between fails to read rather than mixing two versions.
+type remoteFile struct {
+	remote *Remote
+	name   string
+	info   fs.FileInfo
+	offset int64
+	body   io.ReadCloser
+	etag   string // Of the first download
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		body, etag, err := f.remote.client.OpenRangeIf(f.name, f.offset, f.etag)
+		if err != nil {
+			return 0, f.remote.wrap(err)
+		}
+		f.body = body
+		if f.etag == "" {
+			f.etag = etag
+		}
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset != f.offset {
+		f.closeBody()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+func (f *remoteFile) Close() error {
+	f.closeBody()
+	return nil
+}
+
+func (f *remoteFile) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+// ETag is derived from the listing, since hashing the content would download
+// the whole file for every request.
+func (f *remoteFile) ETag() string {
+	return fmt.Sprintf(`"gofs-%x-%x-%x"`, []byte(f.name), f.info.Size(), f.info.ModTime().Unix())
+}
@@ -0,0 +1,137 @@
+package filesystem
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+)
+
+// SnapshotEntry is a file as it was when a snapshot was taken.
+type SnapshotEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Digest  string    `json:"sha256"`
+}
+
+// DriftedError is returned by SnapshotFileSystem for a file whose size or
+// modification time no longer match its snapshot.
+type DriftedError struct {
+	Path string
+}
+
+func (e *DriftedError) Error() string {
+	return fmt.Sprintf("content drifted: %s changed since the snapshot", e.Path)
+}
+
+// SnapshotFileSystem serves a tree as it was when a snapshot was taken. Files
+// added afterwards, and directories holding no file of the snapshot, are
+// hidden; files whose size or modification time changed fail with a
+// *DriftedError. It is read-only.
+type SnapshotFileSystem struct {
+	*ReadonlyFileSystem
+	files map[string]SnapshotEntry // By slash-separated path below the root
+	dirs  map[string]bool          // Every parent of a file in files, "" included
+}
+
+// NewSnapshot serves the files of fs recorded in files, keyed by their
+// slash-separated path below the root.
+func NewSnapshot(fs internal.FileSystem, files map[string]SnapshotEntry) *SnapshotFileSystem {
+	dirs := map[string]bool{"": true}
+	for name := range files {
+		for dir := path.Dir(name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	return &SnapshotFileSystem{ReadonlyFileSystem: NewReadonly(fs), files: files, dirs: dirs}
+}
+
+// Stat returns the information of name if the snapshot has it unchanged.
+func (s *SnapshotFileSystem) Stat(name string) (internal.FileInfo, error) {
+	key := rootRelative(name)
+	entry, isFile := s.files[key]
+	if !isFile && !s.dirs[key] {
+		return nil, errNotInSnapshot()
+	}
+	info, err := s.ReadonlyFileSystem.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if isFile && (info.IsDir() || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime)) {
+		return nil, &DriftedError{Path: "/" + key}
+	}
+	return info, nil
+}
+
+// Open opens name if the snapshot has it unchanged.
+func (s *SnapshotFileSystem) Open(name string) (io.ReadCloser, error) {
+	return s.OpenSeeker(name)
+}
+
+// OpenSeeker opens name if the snapshot has it unchanged. Its files seek if
+// those of the wrapped FileSystem do.
+func (s *SnapshotFileSystem) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	if _, err := s.Stat(name); err != nil {
+		return nil, err
+	}
+	return s.ReadonlyFileSystem.OpenSeeker(name)
+}
+
+// ReadDir lists the entries of name that the snapshot has, in the order of
+// the wrapped FileSystem.
+func (s *SnapshotFileSystem) ReadDir(name string) ([]internal.FileInfo, error) {
+	dir := rootRelative(name)
+	if !s.dirs[dir] {
+		return nil, errNotInSnapshot()
+	}
+	entries, err := s.ReadonlyFileSystem.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	result := entries[:0]
+	for _, fi := range entries {
+		if s.has(path.Join(dir, fi.Name())) {
+			result = append(result, fi)
+		}
+	}
+	return result, nil
+}
+
+// ReadDirIter streams the entries of name that the snapshot has. Drifted
+// files are listed as they are now; opening them fails.
+func (s *SnapshotFileSystem) ReadDirIter(name string, fn func(internal.FileInfo) error) error {
+	dir := rootRelative(name)
+	if !s.dirs[dir] {
+		return errNotInSnapshot()
+	}
+	return s.ReadonlyFileSystem.ReadDirIter(name, func(fi internal.FileInfo) error {
+		if !s.has(path.Join(dir, fi.Name())) {
+			return nil
+		}
+		return fn(fi)
+	})
+}
+
+// has reports whether the snapshot has a file or directory at key.
+func (s *SnapshotFileSystem) has(key string) bool {
+	_, ok := s.files[key]
+	return ok || s.dirs[key]
+}
+
+// rootRelative turns a path given to a FileSystem into the slash-separated
+// path below the root, which is also its key in a snapshot.
+func rootRelative(name string) string {
+	return strings.Trim(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+}
+
+func errNotInSnapshot() error {
+	return &internal.APIError{
+		Code:    "FILE_STAT_ERROR",
+		Message: "Unable to get file information",
+		Status:  http.StatusNotFound,
+	}
+}
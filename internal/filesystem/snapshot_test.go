@@ -0,0 +1,51 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotFileSystem(t *testing.T) {
+	root := t.TempDir()
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.MkdirAll(filepath.Join(root, "docs", "new"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "docs", "kept.txt"), "kept", mtime)
+	writeFile(t, filepath.Join(root, "docs", "edited.txt"), "v1", mtime)
+	snap := NewSnapshot(NewLocal(root, false), map[string]SnapshotEntry{
+		"docs/kept.txt":   {Size: 4, ModTime: mtime},
+		"docs/edited.txt": {Size: 2, ModTime: mtime},
+	})
+
+	writeFile(t, filepath.Join(root, "docs", "edited.txt"), "v2", mtime.Add(time.Second))
+	writeFile(t, filepath.Join(root, "docs", "added.txt"), "new", mtime)
+	writeFile(t, filepath.Join(root, "docs", "new", "deep.txt"), "new", mtime)
+
+	if _, err := snap.Open("docs/kept.txt"); err != nil {
+		t.Errorf("Expected the unchanged file to open, got %v", err)
+	}
+	var drifted *DriftedError
+	if _, err := snap.Open("docs/edited.txt"); !errors.As(err, &drifted) || drifted.Path != "/docs/edited.txt" {
+		t.Errorf("Expected a DriftedError for the edited file, got %v", err)
+	}
+	for _, name := range []string{"docs/added.txt", "docs/new", "docs/new/deep.txt"} {
+		if _, err := snap.Stat(name); err == nil {
+			t.Errorf("Expected %s, added after the snapshot, to be hidden", name)
+		}
+	}
+
+	entries, err := snap.ReadDir("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "edited.txt" || entries[1].Name() != "kept.txt" {
+		t.Errorf("Expected only the snapshotted files listed, got %v", entries)
+	}
+	if _, err := snap.Create("docs/x.txt"); !errors.Is(err, ErrReadonly) {
+		t.Errorf("Expected writes to be refused, got %v", err)
+	}
+}
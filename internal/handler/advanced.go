@@ -5,51 +5,95 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"io/fs"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path"
 	"path/filepath"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/samzong/gofs/internal"
 	"github.com/samzong/gofs/internal/config"
 	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
 	"github.com/samzong/gofs/internal/handler/templates"
+	"github.com/samzong/gofs/internal/listing"
 	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/internal/tracing"
 	"github.com/samzong/gofs/pkg/fileutil"
-	"github.com/samzong/gofs/pkg/httprange"
+	"github.com/samzong/gofs/pkg/pathsafe"
 	"github.com/samzong/gofs/pkg/zipstream"
 )
 
 type UploadResponse struct {
-	Success bool   `json:"success"`
-	File    string `json:"file"`
-	Size    int64  `json:"size"`
+	Success  bool       `json:"success"`
+	File     string     `json:"file"`
+	Size     int64      `json:"size"`
+	Checksum string     `json:"checksum,omitempty"` // Verified digest as "<algorithm>:<hex>"
+	ModTime  *time.Time `json:"modTime,omitempty"`  // Modification time applied from the request
+	URL      string     `json:"url"`                // Where the uploaded file is served
+}
+
+// LastModifiedHeader carries the modification time to give an uploaded file.
+const LastModifiedHeader = "X-Last-Modified"
+
+// FolderRequest is the body of POST /api/folder.
+type FolderRequest struct {
+	Path string `json:"path"`
 }
 
 type FolderResponse struct {
 	Success bool   `json:"success"`
 	Folder  string `json:"folder"`
+	URL     string `json:"url"` // Where the folder is listed
 }
 
 type DirectoryResponse struct {
-	Path  string         `json:"path"`
-	Files []FileItemJSON `json:"files"`
-	Count int            `json:"count"`
+	Path        string         `json:"path"`
+	Files       []FileItemJSON `json:"files"`
+	Count       int            `json:"count"`
+	Breadcrumbs []Breadcrumb   `json:"breadcrumbs"` // Ancestors of path, outermost first
+	// The view the files are in, as given by the query parameters of the
+	// same names: directories first, then by sort ("name", "size" or
+	// "modTime") in order ("asc" or "desc")
+	Sort  string `json:"sort"`
+	Order string `json:"order"`
+	Page  int    `json:"page,omitempty"`  // Page of files shown, when one was requested
+	Pages int    `json:"pages,omitempty"` // Pages of the whole listing, when a page was requested
+	Total int    `json:"total"`           // Entries of the whole listing
 }
 
+// Breadcrumb is one directory on the way to the listed one. Path is relative
+// to the mount, with a leading slash and no trailing slash.
+type Breadcrumb = listing.Breadcrumb
+
 type FileItemJSON struct {
-	Name    string    `json:"name"`
-	Size    int64     `json:"size"`
-	IsDir   bool      `json:"isDir"`
-	ModTime time.Time `json:"modTime"`
+	Name    string     `json:"name"`
+	Size    int64      `json:"size"`
+	IsDir   bool       `json:"isDir"`
+	ModTime time.Time  `json:"modTime"`
+	Mode    string     `json:"mode"`              // Octal permissions, e.g. "0644"
+	Symlink string     `json:"symlink,omitempty"` // Target of a symbolic link
+	Owner   *FileOwner `json:"owner,omitempty"`
+	Kind    string     `json:"kind"` // folder, image, video, archive, code, document or file
+	// Escaped absolute URL path of the entry, including the mount and
+	// --base-url, with a trailing slash for directories
+	URL string `json:"url"`
+	// Entries of a directory, counted up to 1000; unset for files and
+	// directories that cannot be read
+	ChildCount          *int `json:"childCount,omitempty"`
+	ChildCountTruncated bool `json:"childCountTruncated,omitempty"` // More entries than childCount
 }
 
 type Middleware func(http.Handler) http.Handler
@@ -126,11 +170,52 @@ type RequestContext struct {
 }
 
 type AdvancedFile struct {
-	fs           internal.FileSystem
-	config       *config.Config
-	logger       *slog.Logger
-	csrfTokens   *csrfStore
-	zipSemaphore chan struct{}
+	fs              internal.FileSystem
+	config          *config.Config
+	logger          *slog.Logger
+	csrfTokens      *csrfStore
+	zipSemaphore    chan struct{}
+	zipQueue        *atomic.Int64 // ZIP downloads waiting for a slot of zipSemaphore
+	uploadSemaphore chan struct{}
+	manifests       *manifestBuilder
+	idempotency     *idempotencyStore
+	quota           *quotaTracker        // nil when the mount has no quota
+	archives        *ArchiveCache        // nil streams every ZIP download
+	archiveScope    string               // distinguishes this mount's entries in a shared archive cache
+	dirConfigs      *dirConfigCache      // nil unless --dir-config is enabled
+	hotCache        *filesystem.HotCache // nil unless --hot-cache-size is set; reported by /api/stats
+	versions        *VersionStore        // nil unless --versions-dir is set
+	scrubber        *Scrubber            // nil unless --scrub-interval is set
+	scrubMount      string               // mount path this handler's scrub report is kept under
+	scanner         uploadScanner        // nil unless --upload-scan-cmd or --upload-scan-url is set
+	children        *childCounter
+	uploadLocks     *pathLocks         // Serializes saveUploadedFile calls for one path
+	watcher         dirWatcher         // Feeds GET /api/events; nil with --watch-mode=off
+	flights         *coalescer         // Shared by the manifests, child counts and ETags; reported by /api/stats
+	page            *template.Template // Renders listings; templates.AdvancedTemplate
+}
+
+// CSRFResponse carries a token for the X-CSRF-Token header of mutating
+// requests.
+type CSRFResponse struct {
+	Token string `json:"token"`
+}
+
+// SlotStats reports how many slots of a bounded operation are in use.
+type SlotStats struct {
+	InFlight int `json:"inFlight"`
+	Max      int `json:"max"`
+	Queued   int `json:"queued,omitempty"` // Requests waiting for a slot; only ZIP downloads wait
+}
+
+// StatsResponse reports the current load on the advanced handler.
+type StatsResponse struct {
+	Uploads  SlotStats                 `json:"uploads"`
+	Zips     SlotStats                 `json:"zips"`
+	HotCache *filesystem.HotCacheStats `json:"hotCache,omitempty"` // present with --hot-cache-size
+	// Computations per operation ("etag", "manifest", "childCount") and the
+	// concurrent duplicate requests that shared them
+	Coalesced map[string]CoalesceStats `json:"coalesced"`
 }
 
 func NewAdvancedFile(fs internal.FileSystem, cfg *config.Config) *AdvancedFile {
@@ -139,37 +224,84 @@ func NewAdvancedFile(fs internal.FileSystem, cfg *config.Config) *AdvancedFile {
 		slog.String("theme", "advanced"),
 	)
 
-	return &AdvancedFile{
-		fs:           fs,
-		config:       cfg,
-		logger:       logger,
-		csrfTokens:   newCSRFStore(),
-		zipSemaphore: make(chan struct{}, 3),
+	flights := newCoalescer()
+	// Cached manifests and child counts and the watcher are shared between
+	// requests, so with DirConfig they see the tree without credentials and
+	// leave out every subtree that needs one
+	var dirConfigs *dirConfigCache
+	shared := fs
+	if cfg.DirConfig {
+		dirConfigs = newDirConfigCache(fs)
+		shared = newDirConfigFS(fs, dirConfigs, "")
+	}
+	h := &AdvancedFile{
+		fs:              fs,
+		config:          cfg,
+		logger:          logger,
+		csrfTokens:      newCSRFStore(),
+		zipSemaphore:    make(chan struct{}, maxConcurrentZips(cfg)),
+		zipQueue:        &atomic.Int64{},
+		uploadSemaphore: make(chan struct{}, maxConcurrentUploads(cfg)),
+		manifests:       newManifestBuilder(shared, cfg.ShowHidden, flights),
+		idempotency:     newIdempotencyStore(),
+		scanner:         newUploadScanner(cfg),
+		children:        newChildCounter(shared, cfg, flights),
+		flights:         flights,
+		uploadLocks:     newPathLocks(),
+		watcher:         newDirWatcher(shared, cfg),
+		dirConfigs:      dirConfigs,
+		page:            templates.AdvancedTemplate,
+	}
+	return h
+}
+
+// SetQuota limits the bytes stored under the handler's filesystem. Uploads
+// that would exceed it are rejected with 507 Insufficient Storage. A limit
+// of 0 removes the quota.
+func (h *AdvancedFile) SetQuota(limit int64) {
+	if limit <= 0 {
+		h.quota = nil
+		return
 	}
+	h.quota = newQuotaTracker(h.fs, limit)
+}
+
+// SetArchiveCache serves single-directory ZIP downloads from cache so they
+// support Range requests. scope must be unique per mount, since the cache
+// may be shared.
+func (h *AdvancedFile) SetArchiveCache(cache *ArchiveCache, scope string) {
+	h.archives = cache
+	h.archiveScope = scope
+}
+
+// SetHotCache reports the hit rate of the in-memory file cache in front of
+// the handler's filesystem through /api/stats.
+func (h *AdvancedFile) SetHotCache(cache *filesystem.HotCache) {
+	h.hotCache = cache
 }
 
 func (h *AdvancedFile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var handler http.Handler = http.HandlerFunc(h.handleRequest)
 
 	// Build middleware chain
-	securityConfig := middleware.SecurityConfig{
-		EnableSecurity: h.config.EnableSecurity,
-		ContentSecurityPolicy: "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
-			"img-src 'self' data:; font-src 'self'",
-	}
-	handler = middleware.SecurityHeaders(securityConfig)(handler)
+	securityConfig := middleware.SecurityConfigFor(h.config)
+	securityConfig.ContentSecurityPolicy = "default-src 'self'; script-src 'self'; " +
+		"style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self'"
 	handler = h.loggingMiddleware(handler)
 	handler = h.timeoutMiddleware(handler)
 	handler = h.corsMiddleware(handler)
+	// Outermost, so CORS preflights and timeouts carry the headers too
+	handler = middleware.SecurityHeaders(securityConfig)(handler)
 	handler.ServeHTTP(w, r)
 }
 
 func (h *AdvancedFile) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if h.dirConfigs != nil {
+		h = h.forRequest(r)
+	}
 	switch {
-	case r.URL.Path == "/static/theme.css":
-		h.serveStaticCSS(w, r)
-	case r.URL.Path == "/static/theme.js":
-		h.serveStaticJS(w, r)
+	case isStaticAssetPath(r.URL.Path):
+		serveStaticAsset(w, r)
 	case strings.HasPrefix(r.URL.Path, "/api/"):
 		h.handleAPI(w, r)
 	default:
@@ -177,94 +309,224 @@ func (h *AdvancedFile) handleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// advancedAPIRoutes maps each /api endpoint of the advanced theme to its
+// handler. Every path must be described by apiOperations.
+var advancedAPIRoutes = map[string]func(*AdvancedFile, http.ResponseWriter, *http.Request){
+	"/api/csrf":              (*AdvancedFile).handleCSRFRoute,
+	"/api/capabilities":      (*AdvancedFile).handleCapabilities,
+	"/api/openapi.json":      (*AdvancedFile).handleOpenAPI,
+	"/api/manifest":          (*AdvancedFile).handleManifest,
+	"/api/changes":           (*AdvancedFile).handleChanges,
+	"/api/events":            (*AdvancedFile).handleEvents,
+	"/api/dirs":              (*AdvancedFile).handleDirs,
+	"/api/stats":             (*AdvancedFile).handleStatsRoute,
+	"/api/upload":            (*AdvancedFile).handleUploadRoute,
+	"/api/folder":            (*AdvancedFile).handleFolderRoute,
+	"/api/zip":               (*AdvancedFile).handleZipRoute,
+	"/api/delete":            (*AdvancedFile).handleBulkRoute,
+	"/api/move":              (*AdvancedFile).handleBulkRoute,
+	"/api/copy":              (*AdvancedFile).handleBulkRoute,
+	"/api/extract":           (*AdvancedFile).handleExtractRoute,
+	"/api/select":            (*AdvancedFile).handleSelect,
+	"/api/diff":              (*AdvancedFile).handleDiff,
+	"/api/qr":                (*AdvancedFile).handleQR,
+	"/api/versions":          (*AdvancedFile).handleVersions,
+	"/api/versions/download": (*AdvancedFile).handleVersionDownload,
+	"/api/scrub/report":      (*AdvancedFile).handleScrubReport,
+}
+
 func (h *AdvancedFile) handleAPI(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/api/csrf":
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		h.handleGetCSRFToken(w, r)
-	case "/api/upload":
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	route, ok := advancedAPIRoutes[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	route(h, w, r)
+}
+
+func (h *AdvancedFile) handleCSRFRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.handleGetCSRFToken(w, r)
+}
+
+func (h *AdvancedFile) handleStatsRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.handleStats(w, r)
+}
+
+func (h *AdvancedFile) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	serveCapabilities(w, r, h.config, h.fs)
+}
+
+func (h *AdvancedFile) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	serveOpenAPI(w, r, h.config)
+}
+
+func (h *AdvancedFile) handleManifest(w http.ResponseWriter, r *http.Request) {
+	serveManifest(w, r, h.manifests, h.reporter())
+}
+
+func (h *AdvancedFile) handleChanges(w http.ResponseWriter, r *http.Request) {
+	serveChanges(w, r, h.fs, h.config, h.reporter())
+}
+
+func (h *AdvancedFile) handleEvents(w http.ResponseWriter, r *http.Request) {
+	serveEvents(w, r, h.fs, h.watcher, h.reporter())
+}
+
+func (h *AdvancedFile) handleUploadRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.rejectReadonly(w, r) {
+		return
+	}
+	h.withIdempotency(w, r, func(w http.ResponseWriter, r *http.Request) {
+		// Acquire before anything reads the body so multipart buffering is bounded
+		if !h.acquireUploadSlot(w) {
 			return
 		}
-		if !h.validateCSRFRequest(r) {
-			http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+		defer h.releaseUploadSlot()
+		if err := h.checkCSRF(r); err != nil {
+			h.writeCSRFFailure(w, r, err)
 			return
 		}
 		h.handleUpload(w, r)
-	case "/api/folder":
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		if !h.validateCSRFRequest(r) {
-			http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+	})
+}
+
+// acquireUploadSlot takes one of the upload slots, or answers 429 and
+// returns false when all are in use. A successful call must be paired with
+// releaseUploadSlot.
+func (h *AdvancedFile) acquireUploadSlot(w http.ResponseWriter) bool {
+	select {
+	case h.uploadSemaphore <- struct{}{}:
+		return true
+	default:
+		h.logger.Warn("Too many concurrent uploads")
+		w.Header().Set("Retry-After", strconv.Itoa(int(constants.UploadRetryAfter.Seconds())))
+		middleware.WriteJSONError(w, "Too many concurrent uploads, please try again later",
+			http.StatusTooManyRequests)
+		return false
+	}
+}
+
+func (h *AdvancedFile) releaseUploadSlot() {
+	<-h.uploadSemaphore
+}
+
+func (h *AdvancedFile) handleFolderRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.rejectReadonly(w, r) {
+		return
+	}
+	h.withIdempotency(w, r, func(w http.ResponseWriter, r *http.Request) {
+		if err := h.checkCSRF(r); err != nil {
+			h.writeCSRFFailure(w, r, err)
 			return
 		}
 		h.handleCreateFolder(w, r)
-	case "/api/zip":
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		if !h.validateCSRFRequest(r) {
-			http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
-			return
-		}
+	})
+}
+
+func (h *AdvancedFile) handleZipRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
 		h.handleZipDownload(w, r)
-	default:
-		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
+	if err := h.checkCSRF(r); err != nil {
+		h.writeCSRFFailure(w, r, err)
+		return
+	}
+	h.handleZipDownload(w, r)
 }
 
-func (h *AdvancedFile) handleGetCSRFToken(w http.ResponseWriter, _ *http.Request) {
-	token := h.csrfTokens.generateToken()
-	response := map[string]string{"token": token}
-	if err := middleware.WriteJSON(w, response); err != nil {
-		h.logger.Warn("Failed to write CSRF token response",
-			slog.String("error", err.Error()))
+func (h *AdvancedFile) handleBulkRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.rejectReadonly(w, r) {
+		return
 	}
+	if err := h.checkCSRF(r); err != nil {
+		h.writeCSRFFailure(w, r, err)
+		return
+	}
+	h.handleBulk(w, r)
 }
 
-func (h *AdvancedFile) validateCSRFRequest(r *http.Request) bool {
-	token := r.Header.Get("X-CSRF-Token")
-	if token == "" {
-		token = r.FormValue("csrf_token")
+func (h *AdvancedFile) handleExtractRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
+	if h.rejectReadonly(w, r) {
+		return
+	}
+	if err := h.checkCSRF(r); err != nil {
+		h.writeCSRFFailure(w, r, err)
+		return
+	}
+	h.handleExtract(w, r)
+}
 
-	origin := r.Header.Get("Origin")
-	referer := r.Header.Get("Referer")
-
-	if origin != "" || referer != "" {
-		host := r.Host
-		expectedOrigin := "http://" + host
-		expectedOriginHTTPS := "https://" + host
+// forRequest returns a copy of h whose filesystem applies the .gofs.yaml
+// directives with the request's credentials.
+func (h *AdvancedFile) forRequest(r *http.Request) *AdvancedFile {
+	scoped := *h
+	scoped.fs = newDirConfigFS(h.fs, h.dirConfigs, r.Header.Get("Authorization"))
+	return &scoped
+}
 
-		if origin != "" && origin != expectedOrigin && origin != expectedOriginHTTPS {
-			h.logger.Warn("CSRF: Origin mismatch",
-				slog.String("origin", origin),
-				slog.String("expected", expectedOrigin))
-			return false
-		}
+// reporter renders error responses without leaking internal details.
+func (h *AdvancedFile) reporter() middleware.ErrorReporter {
+	return middleware.ErrorReporter{Logger: h.logger, Debug: h.config.DebugErrors}
+}
 
-		if referer != "" && !strings.HasPrefix(referer, expectedOrigin) && !strings.HasPrefix(referer, expectedOriginHTTPS) {
-			h.logger.Warn("CSRF: Referer mismatch",
-				slog.String("referer", referer),
-				slog.String("expected", expectedOrigin))
-			return false
-		}
+func (h *AdvancedFile) handleGetCSRFToken(w http.ResponseWriter, _ *http.Request) {
+	response := CSRFResponse{Token: h.csrfTokens.generateToken()}
+	if err := middleware.WriteJSON(w, response); err != nil {
+		h.logger.Warn("Failed to write CSRF token response",
+			slog.String("error", err.Error()))
 	}
+}
 
-	return h.csrfTokens.validateToken(token)
+func (h *AdvancedFile) handleStats(w http.ResponseWriter, _ *http.Request) {
+	response := StatsResponse{
+		Uploads:   SlotStats{InFlight: len(h.uploadSemaphore), Max: cap(h.uploadSemaphore)},
+		Zips:      SlotStats{InFlight: len(h.zipSemaphore), Max: cap(h.zipSemaphore), Queued: int(h.zipQueue.Load())},
+		Coalesced: h.flights.Stats(),
+	}
+	if h.hotCache != nil {
+		stats := h.hotCache.Stats()
+		response.HotCache = &stats
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := middleware.WriteJSON(w, response); err != nil {
+		h.logger.Warn("Failed to write stats response",
+			slog.String("error", err.Error()))
+	}
 }
 
 func (h *AdvancedFile) handleUpload(w http.ResponseWriter, r *http.Request) {
 	file, header, err := h.parseUploadRequest(r)
 	if err != nil {
-		middleware.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		h.reporter().JSONError(w, r, "Invalid upload request", http.StatusBadRequest, err)
 		return
 	}
 	defer file.Close()
@@ -274,30 +536,50 @@ func (h *AdvancedFile) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filename := fileutil.SafePath(header.Filename)
-	if filename == "" {
+	limits := pathLimits(h.config)
+	filename, err := limits.Clean(header.Filename)
+	if message := pathLimitMessage(err, limits); message != "" {
+		middleware.WriteJSONError(w, message, http.StatusBadRequest)
+		return
+	}
+	if err != nil || filename == "" {
 		middleware.WriteJSONError(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.saveUploadedFile(r.Context(), file, filename); err != nil {
-		if r.Context().Err() != nil {
-			middleware.WriteJSONError(w, "Upload timeout", http.StatusRequestTimeout)
-			return
-		}
-		middleware.WriteJSONError(w, "Failed to save file", http.StatusInternalServerError)
+	checksum, err := parseUploadChecksum(r)
+	if err != nil {
+		h.reporter().JSONError(w, r, "Invalid checksum", http.StatusBadRequest, err)
 		return
 	}
 
-	h.logger.Info("File uploaded successfully",
-		slog.String("filename", filename),
-		slog.Int64("size", header.Size))
+	modTime, err := parseUploadModTime(r)
+	if err != nil {
+		h.reporter().JSONError(w, r, "Invalid modification time", http.StatusBadRequest, err)
+		return
+	}
+
+	filename, ok := h.uploadDestination(w, r, filename)
+	if !ok {
+		return
+	}
+	if !h.storeUpload(w, r, file, header.Size, filename, checksum, modTime) {
+		return
+	}
 
 	response := UploadResponse{
 		Success: true,
 		File:    filename,
 		Size:    header.Size,
+		URL:     resourceURL(r, filename, false),
+	}
+	if checksum != nil {
+		response.Checksum = checksum.String()
+	}
+	if !modTime.IsZero() {
+		response.ModTime = &modTime
 	}
+	w.Header().Set("Location", response.URL)
 	if err := middleware.WriteJSON(w, response); err != nil {
 		h.logger.Warn("Failed to write JSON response for upload",
 			slog.String("filename", filename),
@@ -305,13 +587,44 @@ func (h *AdvancedFile) handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *AdvancedFile) handleCreateFolder(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Path string `json:"path"`
+// storeUpload saves size bytes from file as filename within the quota. It
+// writes the error response and returns false if the file was not stored.
+func (h *AdvancedFile) storeUpload(w http.ResponseWriter, r *http.Request, file io.Reader, size int64,
+	filename string, checksum *uploadChecksum, modTime time.Time,
+) bool {
+	if limit := maxUploadSize(h.config); size > limit {
+		middleware.WriteJSONError(w, fmt.Sprintf("File too large, at most %d bytes", limit),
+			http.StatusRequestEntityTooLarge)
+		return false
+	}
+	reserved, ok := h.reserveQuota(w, r, filename, size)
+	if !ok {
+		return false
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		middleware.WriteJSONError(w, "Invalid request", http.StatusBadRequest)
+	if err := h.saveUploadedFile(r.Context(), file, filename, checksum, modTime); err != nil {
+		if h.quota != nil {
+			h.quota.Release(reserved)
+		}
+		h.writeSaveFailure(w, r, filename, checksum, err)
+		return false
+	}
+
+	h.logger.Info("File uploaded successfully",
+		slog.String("filename", filename),
+		slog.Int64("size", size),
+		slog.Bool("checksum_verified", checksum != nil))
+	return true
+}
+
+func (h *AdvancedFile) handleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	var req FolderRequest
+	if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.Path) > constants.MaxRequestPathLength {
+		middleware.WriteJSONError(w, fmt.Sprintf("Folder name too long, at most %d bytes",
+			constants.MaxRequestPathLength), http.StatusBadRequest)
 		return
 	}
 
@@ -320,14 +633,25 @@ func (h *AdvancedFile) handleCreateFolder(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	folderName := fileutil.SafePath(req.Path)
-	if folderName == "" {
+	limits := pathLimits(h.config)
+	folderName, err := limits.Clean(req.Path)
+	if message := pathLimitMessage(err, limits); message != "" {
+		middleware.WriteJSONError(w, message, http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		err = validateFolderPath(req.Path)
+	}
+	if err != nil || folderName == "" {
 		middleware.WriteJSONError(w, "Invalid folder name", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.fs.Mkdir(folderName, 0755); err != nil {
-		middleware.WriteJSONError(w, "Failed to create folder", http.StatusInternalServerError)
+	folderName, ok := h.uploadDestination(w, r, folderName)
+	if !ok {
+		return
+	}
+	if !h.makeFolder(w, r, folderName) {
 		return
 	}
 
@@ -337,7 +661,9 @@ func (h *AdvancedFile) handleCreateFolder(w http.ResponseWriter, r *http.Request
 	response := FolderResponse{
 		Success: true,
 		Folder:  folderName,
+		URL:     resourceURL(r, folderName, true),
 	}
+	w.Header().Set("Location", response.URL)
 	if err := middleware.WriteJSON(w, response); err != nil {
 		h.logger.Warn("Failed to write JSON response for folder creation",
 			slog.String("folder", folderName),
@@ -345,86 +671,271 @@ func (h *AdvancedFile) handleCreateFolder(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// makeFolder creates folder name, and any parents of it that are missing,
+// unless the quota is full. It writes the error response and returns false
+// if the folder was not created, with 409 if it already exists.
+func (h *AdvancedFile) makeFolder(w http.ResponseWriter, r *http.Request, name string) bool {
+	if h.quota != nil {
+		if err := h.quota.Check(); err != nil {
+			h.writeQuotaFailure(w, r, err)
+			return false
+		}
+	}
+	if _, err := h.fs.Stat(name); err == nil {
+		middleware.WriteJSONError(w, "Folder already exists", http.StatusConflict)
+		return false
+	}
+	err := mkdirAll(h.fs, path.Dir(name))
+	if err == nil {
+		err = h.fs.Mkdir(name, 0755)
+	}
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, filesystem.ErrReadonly):
+		writeReadonly(w, r)
+	case errors.Is(err, fs.ErrExist):
+		// Created by a concurrent request since the Stat above
+		middleware.WriteJSONError(w, "Folder already exists", http.StatusConflict)
+	case errors.Is(err, errNotDirectory):
+		middleware.WriteJSONError(w, "A file exists in the folder's path", http.StatusConflict)
+	default:
+		h.reporter().JSONError(w, r, "Failed to create folder", http.StatusInternalServerError, err)
+	}
+	return false
+}
+
+// mkdirAll creates directory name and any parents of it fsys lacks. A file
+// in the way is errNotDirectory.
+func mkdirAll(fsys internal.FileSystem, name string) error {
+	current := ""
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." {
+			continue
+		}
+		current = path.Join(current, segment)
+		// Backends differ in the errors Stat returns, so any failure is
+		// taken as a missing directory and left to Mkdir to report
+		if info, err := fsys.Stat(current); err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s: %w", current, errNotDirectory)
+			}
+			continue
+		}
+		if err := fsys.Mkdir(current, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// windowsDeviceNames cannot be used as file names on Windows, with or
+// without an extension, so folders named after them could not be synced or
+// downloaded there.
+var windowsDeviceNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// validateFolderPath checks every segment of a folder path a client asked
+// for. A leading or trailing slash is allowed; empty segments, "." and
+// "..", names ending in a dot or space and Windows device names are not.
+func validateFolderPath(p string) error {
+	p = strings.TrimSuffix(strings.TrimPrefix(p, "/"), "/")
+	for _, segment := range strings.Split(p, "/") {
+		base, _, _ := strings.Cut(segment, ".")
+		switch {
+		case segment == "", segment == ".", segment == "..":
+			return fmt.Errorf("invalid folder name %q", segment)
+		case strings.HasSuffix(segment, ".") || strings.HasSuffix(segment, " "):
+			return fmt.Errorf("folder name %q ends in a dot or space", segment)
+		case slices.Contains(windowsDeviceNames, strings.ToUpper(strings.TrimSpace(base))):
+			return fmt.Errorf("folder name %q is reserved", segment)
+		}
+	}
+	return nil
+}
+
+// mountURL returns the URL path of the request's mount as the client sees it,
+// including any --base-url prefix, without a trailing slash. It is "" for a
+// single directory served from the root.
+func mountURL(r *http.Request) string {
+	prefix := middleware.BasePathFromContext(r.Context())
+	if info, ok := internal.MountInfoFromContext(r.Context()); ok {
+		prefix += strings.TrimSuffix(info.Path, "/")
+	}
+	return prefix
+}
+
+// resourceURL returns the escaped URL path of name on the request's mount,
+// with a trailing slash for directories.
+func resourceURL(r *http.Request, name string, dir bool) string {
+	prefix := mountURL(r)
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	u := prefix + "/" + strings.Join(segments, "/")
+	if dir {
+		u += "/"
+	}
+	return u
+}
+
+// reserveQuota accounts for an upload of size bytes to filename, net of any
+// file it replaces. It writes the error response and returns false if the
+// upload must be refused.
+func (h *AdvancedFile) reserveQuota(w http.ResponseWriter, r *http.Request, filename string,
+	size int64,
+) (int64, bool) {
+	if h.quota == nil {
+		return 0, true
+	}
+	if info, err := h.fs.Stat(filename); err == nil && !info.IsDir() {
+		size -= info.Size()
+	}
+	if err := h.quota.Reserve(size); err != nil {
+		h.writeQuotaFailure(w, r, err)
+		return 0, false
+	}
+	return size, true
+}
+
+func (h *AdvancedFile) writeQuotaFailure(w http.ResponseWriter, r *http.Request, err error) {
+	var quotaErr *quotaExceededError
+	if errors.As(err, &quotaErr) {
+		h.logger.Warn("Write rejected: quota exceeded",
+			slog.Int64("used", quotaErr.used),
+			slog.Int64("limit", quotaErr.limit))
+		writeQuotaError(w, quotaErr)
+		return
+	}
+	h.reporter().JSONError(w, r, "Cannot check storage quota", http.StatusInternalServerError, err)
+}
+
+// ZipRequest selects what a ZIP download contains: Paths, or the entries of
+// the directory Path whose names match Glob.
 type ZipRequest struct {
-	Paths []string `json:"paths"`
-	Name  string   `json:"name"`
+	Paths    []string `json:"paths"`
+	Path     string   `json:"path,omitempty"`
+	Glob     string   `json:"glob,omitempty"`
+	Name     string   `json:"name"`
+	Manifest bool     `json:"manifest,omitempty"` // End the archive with MANIFEST.json
 }
 
-func (h *AdvancedFile) handleZipDownload(w http.ResponseWriter, r *http.Request) {
+// acquireZipSlot takes one of the ZIP download slots, waiting up to
+// --zip-queue-timeout for one to free up. It answers 429 and returns false
+// when none does, or when the client goes away first. A successful call must
+// be paired with releaseZipSlot.
+func (h *AdvancedFile) acquireZipSlot(w http.ResponseWriter, r *http.Request) bool {
 	select {
 	case h.zipSemaphore <- struct{}{}:
-		defer func() { <-h.zipSemaphore }()
+		return true
 	default:
-		h.logger.Warn("Too many concurrent ZIP downloads")
+	}
+
+	timeout := h.config.ZipQueueTimeout
+	if timeout <= 0 {
+		timeout = constants.DefaultZipQueueTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	queued := h.zipQueue.Add(1)
+	defer h.zipQueue.Add(-1)
+	h.logger.Info("ZIP download queued", slog.Int64("queue_depth", queued))
+
+	select {
+	case h.zipSemaphore <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		h.logger.Warn("Too many concurrent ZIP downloads",
+			slog.Duration("waited", timeout),
+			slog.Int64("queue_depth", h.zipQueue.Load()))
+		w.Header().Set("Retry-After", strconv.Itoa(int(constants.ZipRetryAfter.Seconds())))
 		http.Error(w, "Too many concurrent downloads, please try again later", http.StatusTooManyRequests)
-		return
+		return false
 	}
+}
+
+func (h *AdvancedFile) releaseZipSlot() {
+	<-h.zipSemaphore
+}
 
+func (h *AdvancedFile) handleZipDownload(w http.ResponseWriter, r *http.Request) {
 	var req ZipRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		middleware.WriteJSONError(w, "Invalid request", http.StatusBadRequest)
+	if r.Method == http.MethodGet {
+		// GET ?path=dir lets browsers and download managers fetch (and, with
+		// an archive cache, resume) a directory archive directly. With glob,
+		// path is the directory whose matching entries are downloaded.
+		req.Paths = r.URL.Query()["path"]
+		req.Name = r.URL.Query().Get("name")
+		req.Manifest, _ = strconv.ParseBool(r.URL.Query().Get("manifest"))
+		if req.Glob = r.URL.Query().Get("glob"); req.Glob != "" && len(req.Paths) <= 1 {
+			req.Path = r.URL.Query().Get("path")
+			req.Paths = nil
+		}
+	} else if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+	h.serveZip(w, r, req)
+}
+
+// serveZip answers with the ZIP archive of the selection req, once one of
+// the ZIP download slots is free.
+func (h *AdvancedFile) serveZip(w http.ResponseWriter, r *http.Request, req ZipRequest) {
+	if !h.acquireZipSlot(w, r) {
 		return
 	}
+	defer h.releaseZipSlot()
 
+	paths, ok := h.selectionPaths(w, r, req.Paths, req.Path, req.Glob, constants.MaxZipPaths)
+	if !ok {
+		return
+	}
+	req.Paths = paths
 	if len(req.Paths) == 0 {
 		middleware.WriteJSONError(w, "No files selected", http.StatusBadRequest)
 		return
 	}
+	if err := validateRequestPaths(req.Paths, constants.MaxZipPaths); err != nil {
+		writeRequestPathsError(w, err, constants.MaxZipPaths)
+		return
+	}
 
-	var entries []zipstream.FileEntry
-	var totalSize int64
-
-	for _, p := range req.Paths {
-		safePath := middleware.SafeRequestPath(p)
-		if safePath == "" {
-			continue
-		}
-
-		info, err := h.fs.Stat(safePath)
-		if err != nil {
-			h.logger.Debug("File not found for ZIP",
-				slog.String("path", safePath),
-				slog.String("error", err.Error()))
-			continue
-		}
+	limits := zipLimitsFor(h.config)
+	ctx, cancel := context.WithTimeout(r.Context(), limits.timeout)
+	defer cancel()
 
-		if info.IsDir() {
-			dirSize, fileCount := h.calculateDirSize(safePath)
-			totalSize += dirSize
-			h.logger.Debug("Adding directory to ZIP",
-				slog.String("path", safePath),
-				slog.Int64("size", dirSize),
-				slog.Int("files", fileCount))
-		} else {
-			totalSize += info.Size()
-			entries = append(entries, zipstream.FileEntry{
-				Path: safePath,
-				Name: filepath.Base(safePath),
-				Info: info,
-			})
-		}
-	}
-
-	if len(entries) == 0 && len(req.Paths) > 0 {
-		for _, p := range req.Paths {
-			safePath := middleware.SafeRequestPath(p)
-			info, err := h.fs.Stat(safePath)
-			if err == nil && info.IsDir() {
-				h.collectDirFiles(safePath, safePath, &entries)
-			}
-		}
+	entries, dirs, skipped, err := h.collectZipEntries(ctx, req.Paths, limits)
+	if err != nil {
+		h.writeZipLimitError(w, r, err)
+		return
 	}
-
 	if len(entries) == 0 {
-		middleware.WriteJSONError(w, "No valid files to download", http.StatusBadRequest)
+		writeZipSkippedError(w, skipped)
 		return
 	}
+	var fileCount int
+	var totalSize int64
+	for _, entry := range entries {
+		if !entry.Info.IsDir() {
+			fileCount++
+			totalSize += entry.Info.Size()
+		}
+	}
 
+	singleDir := len(req.Paths) == 1 && len(dirs) == 1
+	// Cached archives are shared between requests and never carry a manifest
+	cached := h.archives != nil && singleDir && !req.Manifest
 	zipName := req.Name
 	if zipName == "" {
-		if len(entries) == 1 {
+		switch {
+		case singleDir:
+			zipName = path.Base(dirs[0]) + ".zip"
+		case len(entries) == 1:
 			zipName = strings.TrimSuffix(entries[0].Name, filepath.Ext(entries[0].Name)) + ".zip"
-		} else {
+		default:
 			zipName = fmt.Sprintf("download_%d.zip", time.Now().Unix())
 		}
 	}
@@ -432,30 +943,86 @@ func (h *AdvancedFile) handleZipDownload(w http.ResponseWriter, r *http.Request)
 		zipName += ".zip"
 	}
 
+	if cached {
+		h.serveCachedArchive(w, r, dirs[0], zipName, entries)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", zipName))
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set(ZipSkippedHeader, strconv.Itoa(len(skipped)))
 
 	h.logger.Info("Starting ZIP download",
 		slog.String("filename", zipName),
-		slog.Int("file_count", len(entries)),
+		slog.Int("file_count", fileCount),
+		slog.Int("skipped", len(skipped)),
 		slog.Int64("total_size", totalSize))
 
-	opts := zipstream.Options{
+	zw := zipstream.NewWriter(w, zipOptions())
+	defer zw.Close()
+
+	// The collection deadline does not cover streaming, which runs for as
+	// long as the client keeps reading
+	files, failed, _ := h.writeZipEntries(context.WithoutCancel(r.Context()), zw, entries)
+	if req.Manifest {
+		// Files that failed while streaming can only be reported here, the
+		// header is long gone
+		entry, err := zipManifestEntry(files, append(skipped, failed...))
+		if err == nil {
+			err = zw.AddFile(entry)
+		}
+		if err != nil {
+			h.logger.Warn("Failed to add manifest to ZIP",
+				slog.String("filename", zipName),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	h.logger.Info("ZIP download completed",
+		slog.String("filename", zipName),
+		slog.Int("files_processed", len(files)))
+}
+
+func zipOptions() zipstream.Options {
+	return zipstream.Options{
 		CompressionLevel: zip.Store,
-		MaxSize:          500 * 1024 * 1024,
+		MaxSize:          constants.MaxZipSize,
 		BufferSize:       32 * 1024,
 	}
+}
 
-	zw := zipstream.NewWriter(w, opts)
-	defer zw.Close()
-
+// writeZipEntries adds entries to zw, skipping files that cannot be read. It
+// returns the names of the files written and the paths of those skipped, and
+// stops early only when ctx is done.
+func (h *AdvancedFile) writeZipEntries(ctx context.Context, zw *zipstream.Writer,
+	entries []zipstream.FileEntry,
+) (files []string, skipped []ZipSkipped, err error) {
+	_, span := tracing.Start(ctx, "zip")
+	defer func() {
+		span.SetAttr("gofs.files", len(files))
+		span.SetAttr("gofs.skipped", len(skipped))
+		span.RecordError(err)
+		span.End()
+	}()
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return files, skipped, err
+		}
+		if entry.Info.IsDir() {
+			if err := zw.AddFile(entry); err != nil {
+				h.logger.Warn("Failed to add directory to ZIP",
+					slog.String("path", entry.Path),
+					slog.String("error", err.Error()))
+			}
+			continue
+		}
 		file, err := h.fs.Open(entry.Path)
 		if err != nil {
 			h.logger.Warn("Failed to open file for ZIP",
 				slog.String("path", entry.Path),
 				slog.String("error", err.Error()))
+			skipped = append(skipped, ZipSkipped{Path: "/" + entry.Path, Reason: skipReason(err)})
 			continue
 		}
 
@@ -469,362 +1036,404 @@ func (h *AdvancedFile) handleZipDownload(w http.ResponseWriter, r *http.Request)
 			h.logger.Warn("Failed to add file to ZIP",
 				slog.String("path", entry.Path),
 				slog.String("error", err.Error()))
+			skipped = append(skipped, ZipSkipped{Path: "/" + entry.Path, Reason: "cannot be added to the archive"})
 			continue
 		}
+		files = append(files, entry.Name)
 		if err := file.Close(); err != nil {
 			h.logger.Warn("Failed to close file after ZIP processing",
 				slog.String("path", entry.Path),
 				slog.String("error", err.Error()))
 		}
 	}
-
-	h.logger.Info("ZIP download completed",
-		slog.String("filename", zipName),
-		slog.Int("files_processed", len(entries)))
+	return files, skipped, nil
 }
 
-func (h *AdvancedFile) calculateDirSize(dirPath string) (int64, int) {
-	var totalSize int64
-	var fileCount int
-
-	files, err := h.fs.ReadDir(dirPath)
-	if err != nil {
-		return 0, 0
-	}
-
-	for _, file := range files {
-		if !h.config.ShowHidden && strings.HasPrefix(file.Name(), ".") {
-			continue
-		}
-
-		fullPath := filepath.Join(dirPath, file.Name())
-		if file.IsDir() {
-			size, count := h.calculateDirSize(fullPath)
-			totalSize += size
-			fileCount += count
-		} else {
-			totalSize += file.Size()
-			fileCount++
-		}
-	}
-
-	return totalSize, fileCount
-}
-
-func (h *AdvancedFile) collectDirFiles(basePath, currentPath string, entries *[]zipstream.FileEntry) {
-	files, err := h.fs.ReadDir(currentPath)
-	if err != nil {
-		h.logger.Warn("Failed to read directory for ZIP",
-			slog.String("path", currentPath),
-			slog.String("error", err.Error()))
-		return
-	}
-
-	for _, file := range files {
-		if !h.config.ShowHidden && strings.HasPrefix(file.Name(), ".") {
-			continue
-		}
-
-		fullPath := filepath.Join(currentPath, file.Name())
-
-		relPath, err := filepath.Rel(basePath, fullPath)
-		if err != nil {
-			relPath = file.Name()
+func (h *AdvancedFile) handleFileRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if r.Method == http.MethodPost && r.URL.Query().Has("form") {
+			h.handleForm(w, r)
+			return
 		}
-
-		if file.IsDir() {
-			h.collectDirFiles(basePath, fullPath, entries)
-		} else {
-			*entries = append(*entries, zipstream.FileEntry{
-				Path: fullPath,
-				Name: relPath,
-				Info: file,
-			})
+		if h.config.EnableRESTWrite && isRESTWriteMethod(r.Method) {
+			h.handleRESTWrite(w, r)
+			return
 		}
-	}
-}
-
-func (h *AdvancedFile) handleFileRequest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	path := r.URL.Path
-	if path == "" {
-		path = "/"
+	safePath, err := pathsafe.Clean(r.URL.Path)
+	if err != nil {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
 	}
 
-	safePath := middleware.SafeRequestPath(path)
-
-	// Check for path traversal attempts - SafeRequestPath returns empty string for dangerous paths
-	if safePath == "" && path != "/" {
-		http.Error(w, "Bad Request: Invalid path", http.StatusBadRequest)
+	index, ok := dirAccess(w, r, h.fs, safePath, h.reporter())
+	if !ok {
 		return
 	}
 
 	info, err := h.fs.Stat(safePath)
 	if err != nil {
-		http.NotFound(w, r)
+		if !writeUnavailable(w, r, h.reporter(), err) {
+			http.NotFound(w, r)
+		}
 		return
 	}
-
-	if info.IsDir() {
-		h.renderAdvancedDirectory(w, r, safePath)
+	if !canonicalSlash(w, r, safePath, info.IsDir()) {
 		return
 	}
 
-	h.serveFile(w, r, safePath)
-}
-
-func (h *AdvancedFile) serveStaticCSS(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/css; charset=utf-8")
-	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", constants.StaticAssetCacheMaxAge))
-	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, templates.AdvancedCSS))
-
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if match == fmt.Sprintf(`"%x"`, templates.AdvancedCSS) {
-			w.WriteHeader(http.StatusNotModified)
-			return
-		}
-	}
-
-	_, _ = w.Write([]byte(templates.AdvancedCSS))
-}
-
-func (h *AdvancedFile) serveStaticJS(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
-	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", constants.StaticAssetCacheMaxAge))
-	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, templates.AdvancedJS))
-
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if match == fmt.Sprintf(`"%x"`, templates.AdvancedJS) {
-			w.WriteHeader(http.StatusNotModified)
+	if info.IsDir() {
+		if indexFile(r, h.fs, index) != nil {
+			h.serveFile(w, r, index)
 			return
 		}
+		h.renderAdvancedDirectory(w, r, safePath)
+		return
 	}
 
-	_, _ = w.Write([]byte(templates.AdvancedJS))
+	h.serveFile(w, r, safePath)
 }
 
 func (h *AdvancedFile) renderAdvancedDirectory(w http.ResponseWriter, r *http.Request, dirPath string) {
-	files, err := h.fs.ReadDir(dirPath)
+	view, err := parseListingView(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Cannot read directory", http.StatusInternalServerError)
+		writeListingViewError(w, r, err)
+		return
+	}
+	l, err := readListing(r.Context(), h.fs, dirPath, listingOptions(h.config))
+	if err != nil {
+		if !writeUnavailable(w, r, h.reporter(), err) {
+			h.reporter().Error(w, r, "Cannot read directory", http.StatusInternalServerError, err)
+		}
 		return
 	}
+	view.sort(l)
 
+	// The same URL serves HTML or JSON; caches must not mix them up when
+	// the UI fetches listings for client-side navigation
+	w.Header().Add("Vary", "Accept")
 	if strings.Contains(r.Header.Get("Accept"), "application/json") {
-		h.renderJSON(w, dirPath, files)
+		if !checkListingConditions(w, r, l) {
+			return
+		}
+		h.renderJSON(w, r, l, view)
 		return
 	}
 
 	type FileItem struct {
 		Name          string
+		Path          string // Relative to the mount, as the ZIP form submits it
+		URL           string // Copied by the row's link button
 		IsDir         bool
+		Kind          fileutil.FileKind
 		Size          int64
 		FormattedSize string
 		FormattedTime string
+		Children      string // e.g. "3 items", directories only
 	}
 
-	type BreadcrumbItem struct {
-		Name string
-		Path string
-	}
-
-	var breadcrumbs []BreadcrumbItem
-	if dirPath != "" && dirPath != "." {
-		parts := strings.Split(strings.Trim(dirPath, "/"), "/")
-		currentPath := ""
-		for _, part := range parts {
-			if part == "" {
-				continue
-			}
-			currentPath = path.Join(currentPath, part)
-			breadcrumbs = append(breadcrumbs, BreadcrumbItem{
-				Name: part,
-				Path: "/" + currentPath,
-			})
-		}
-	}
-
+	page := view.page(l)
 	var items []FileItem
-	for _, file := range files {
-		if !h.config.ShowHidden && strings.HasPrefix(file.Name(), ".") {
-			continue
-		}
-
+	for _, e := range page.Entries {
 		formattedSize := ""
-		if !file.IsDir() {
-			formattedSize = fileutil.FormatSize(file.Size())
+		if !e.IsDir {
+			formattedSize = fileutil.FormatSize(e.Size)
 		}
 
 		items = append(items, FileItem{
-			Name:          file.Name(),
-			IsDir:         file.IsDir(),
-			Size:          file.Size(),
+			Name:          e.Name,
+			Path:          path.Join(dirPath, e.Name),
+			URL:           resourceURL(r, path.Join(dirPath, e.Name), e.IsDir),
+			IsDir:         e.IsDir,
+			Kind:          e.Kind,
+			Size:          e.Size,
 			FormattedSize: formattedSize,
-			FormattedTime: file.ModTime().Format("Jan 02, 2006"),
+			FormattedTime: e.ModTime.Format("Jan 02, 2006"),
+			Children:      h.children.formatChildCount(dirPath, e),
 		})
 	}
 
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].IsDir != items[j].IsDir {
-			return items[i].IsDir
-		}
-		return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
-	})
-
 	data := struct {
 		Path        string
 		Parent      bool
 		Files       []FileItem
 		FileCount   int
-		Breadcrumbs []BreadcrumbItem
+		Breadcrumbs []Breadcrumb
+		Icons       template.HTML
+		CSSURL      string
+		JSURL       string
+		TreeEnabled bool
+		MountPath   string
+		Readonly    bool
+		Access      AccessInfo
+		DirURL      string     // Where the forms that work without JavaScript post
+		CSRFToken   string     // For the forms that work without JavaScript
+		Flash       *FormFlash // Outcome of the form submitted before
+		Page        int        // Page shown; 0 when the listing is not paged
+		Pages       int
+		PrevURL     string // Same view one page back; empty on the first page
+		NextURL     string // Same view one page on; empty on the last page
 	}{
 		Path:        "/" + dirPath,
 		Parent:      dirPath != "" && dirPath != ".",
 		Files:       items,
 		FileCount:   len(items),
-		Breadcrumbs: breadcrumbs,
-	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := templates.AdvancedTemplate.Execute(w, data); err != nil {
-		http.Error(w, "Template execution error", http.StatusInternalServerError)
-		return
+		Breadcrumbs: l.Breadcrumbs,
+		Icons:       templates.IconSprite,
+		CSSURL:      middleware.BasePathFromContext(r.Context()) + themeCSS.URL(),
+		JSURL:       middleware.BasePathFromContext(r.Context()) + themeJS.URL(),
+		TreeEnabled: h.config.EnableTree,
+		MountPath:   mountURL(r),
+		Readonly:    h.readonly(r),
+		Access:      Access(h.config),
+		DirURL:      dirURL(r, dirPath),
+		CSRFToken:   h.csrfTokens.generateToken(),
+		Flash:       formFlashFor(r),
+		Page:        view.Page,
+		Pages:       page.Pages,
+	}
+	if view.Page > 1 {
+		data.PrevURL = pageURL(r, min(view.Page-1, page.Pages))
+	}
+	if view.Page > 0 && view.Page < page.Pages {
+		data.NextURL = pageURL(r, view.Page+1)
+	}
+
+	if err := renderPage(w, h.page, data); err != nil {
+		// Nothing has been sent, so the classic listing can still be
+		h.logger.Error("Template execution error, serving the classic listing",
+			slog.String("path", middleware.LogPath(r, data.Path)),
+			slog.Int("file_count", data.FileCount),
+			slog.String("mount", data.MountPath),
+			slog.Bool("readonly", data.Readonly),
+			slog.Bool("tree", data.TreeEnabled),
+			slog.Bool("flash", data.Flash != nil),
+			slog.String("error", err.Error()))
+		if err := renderPage(w, templates.DirectoryTemplate,
+			classicPageData(dirPath, l.Entries, "default", h.children)); err != nil {
+			h.reporter().Error(w, r, "Template execution error", http.StatusInternalServerError, err)
+		}
 	}
 }
 
 func (h *AdvancedFile) serveFile(w http.ResponseWriter, r *http.Request, path string) {
-	file, err := h.fs.Open(path)
-	if err != nil {
-		http.Error(w, "Cannot open file", http.StatusInternalServerError)
-		return
-	}
-	defer file.Close()
-
-	info, err := h.fs.Stat(path)
-	if err != nil {
-		http.Error(w, "Cannot stat file", http.StatusInternalServerError)
-		return
-	}
-
-	if info.Size() > h.config.MaxFileSize {
-		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
-		return
-	}
-
-	rangeHeader := r.Header.Get("Range")
-	rng, err := httprange.ParseRange(rangeHeader, info.Size())
-	if err != nil {
-		if err == httprange.ErrUnsatisfiableRange {
-			httprange.WriteRangeNotSatisfiable(w, info.Size())
-			return
-		}
-		rng = nil
-	}
-
-	mimeType := fileutil.DetectMimeType(path)
-	filename := filepath.Base(path)
-
-	seeker, seekable := file.(io.ReadSeeker)
-	if !seekable && rng != nil {
-		h.logger.Debug("File doesn't support seeking, serving full content",
-			slog.String("path", path),
-			slog.String("component", "advanced_file_handler"),
-		)
-		rng = nil
-	}
-
-	if rng != nil {
-		h.logger.Debug("Serving partial content",
-			slog.String("path", path),
-			slog.Int64("start", rng.Start),
-			slog.Int64("end", rng.End),
-			slog.Int64("length", rng.Length),
-			slog.String("component", "advanced_file_handler"),
-		)
-
-		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
-
-		if err := httprange.ServeContent(w, seeker, rng, info.Size(), mimeType); err != nil {
-			h.logger.Warn("Error serving partial content",
-				slog.String("path", path),
-				slog.String("error", err.Error()),
-				slog.String("component", "advanced_file_handler"),
-			)
-		}
-	} else {
-		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
-
-		if err := httprange.ServeFullContent(w, file, info.Size(), mimeType); err != nil {
-			h.logger.Warn("Error serving full content",
-				slog.String("path", path),
-				slog.String("error", err.Error()),
-				slog.String("component", "advanced_file_handler"),
-			)
-		}
-	}
+	fileServer{fs: h.fs, config: h.config, logger: h.logger, reporter: h.reporter(), flights: h.flights,
+		component: "advanced_file_handler"}.serve(w, r, path)
 }
 
-func (h *AdvancedFile) renderJSON(w http.ResponseWriter, path string, files []internal.FileInfo) {
+func (h *AdvancedFile) renderJSON(w http.ResponseWriter, r *http.Request, l *listing.DirectoryListing,
+	view listingView,
+) {
+	page := view.page(l)
 	var items []FileItemJSON
-	for _, file := range files {
-		if !h.config.ShowHidden && strings.HasPrefix(file.Name(), ".") {
-			continue
-		}
+	for _, e := range page.Entries {
+		childCount, truncated := h.children.childCountJSON(l.Path, e)
 		items = append(items, FileItemJSON{
-			Name:    file.Name(),
-			Size:    file.Size(),
-			IsDir:   file.IsDir(),
-			ModTime: file.ModTime(),
+			Name:                e.Name,
+			Size:                e.Size,
+			IsDir:               e.IsDir,
+			ModTime:             e.ModTime,
+			Mode:                e.Mode,
+			Symlink:             e.Symlink,
+			Owner:               e.Owner,
+			Kind:                string(e.Kind),
+			URL:                 resourceURL(r, path.Join(l.Path, e.Name), e.IsDir),
+			ChildCount:          childCount,
+			ChildCountTruncated: truncated,
 		})
 	}
 
 	response := DirectoryResponse{
-		Path:  path,
-		Files: items,
-		Count: len(items),
+		Path:        l.Path,
+		Files:       items,
+		Count:       len(items),
+		Breadcrumbs: l.Breadcrumbs,
+		Sort:        view.Sort,
+		Order:       view.Order,
+		Page:        view.Page,
+		Pages:       page.Pages,
+		Total:       page.Total,
 	}
 
 	if err := middleware.WriteJSON(w, response); err != nil {
 		h.logger.Warn("Failed to encode JSON for directory listing",
-			slog.String("path", path),
+			slog.String("path", l.Path),
 			slog.String("error", err.Error()))
 	}
 }
 
 func (h *AdvancedFile) parseUploadRequest(r *http.Request) (multipart.File, *multipart.FileHeader, error) {
-	if err := r.ParseMultipartForm(100 << 20); err != nil {
+	if err := r.ParseMultipartForm(constants.UploadMemoryLimit); err != nil {
 		return nil, nil, err
 	}
 	return r.FormFile("file")
 }
 
-func (h *AdvancedFile) saveUploadedFile(ctx context.Context, src multipart.File, filename string) error {
-	dst, err := h.fs.Create(filename)
+// parseUploadModTime reads the modification time a client asks for, from
+// the X-Last-Modified header or a lastModified form field, as RFC 3339 or an
+// HTTP date. It returns the zero time when neither is set. Times before the
+// Unix epoch or more than UploadModTimeSkew ahead of the server are refused.
+func parseUploadModTime(r *http.Request) (time.Time, error) {
+	return parseModTime(r.Header, r.FormValue)
+}
+
+// parseModTime implements parseUploadModTime. formValue is only called when
+// the header is not set.
+func parseModTime(header http.Header, formValue func(string) string) (time.Time, error) {
+	value := header.Get(LastModifiedHeader)
+	if value == "" {
+		value = formValue("lastModified")
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	modTime, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		if modTime, err = http.ParseTime(value); err != nil {
+			return time.Time{}, fmt.Errorf("%q is neither RFC 3339 nor an HTTP date", value)
+		}
+	}
+	if modTime.Before(time.Unix(0, 0)) {
+		return time.Time{}, fmt.Errorf("%s is before 1970", value)
+	}
+	if modTime.After(time.Now().Add(constants.UploadModTimeSkew)) {
+		return time.Time{}, fmt.Errorf("%s is in the future", value)
+	}
+	return modTime, nil
+}
+
+// saveUploadedFile writes the upload to a temporary file next to filename and
+// renames it into place once the data is complete and, if requested, verified
+// and scanned. A non-zero modTime is applied before the rename, so the file never appears
+// with the wrong time. With a version store, the file being replaced is kept
+// first. Backends that cannot rename get the upload written to filename
+// directly, which is removed again if the upload fails. Concurrent saves of
+// one filename take turns, waiting up to --upload-lock-wait before failing
+// with errConcurrentModification, so the file always holds one complete
+// upload.
+func (h *AdvancedFile) saveUploadedFile(ctx context.Context, src io.Reader, filename string,
+	checksum *uploadChecksum, modTime time.Time,
+) error {
+	unlock, err := h.uploadLocks.lock(ctx, filename, h.config.UploadLockWait)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tmpName := uploadTempName(filename)
+	direct := !internal.CapabilitiesOf(h.fs).CanRename
+	if direct {
+		if h.versions != nil {
+			if err := h.versions.Save(h.fs, filename); err != nil {
+				return err
+			}
+		}
+		tmpName = filename
+	}
+	dst, err := h.fs.Create(tmpName)
 	if err != nil {
 		return fmt.Errorf("creating file %q: %w", filename, err)
 	}
-	defer dst.Close()
+
+	var out io.Writer = dst
+	if checksum != nil {
+		out = io.MultiWriter(dst, checksum)
+	}
 
 	done := make(chan error, 1)
 	go func() {
-		_, err := io.Copy(dst, src)
+		_, err := io.Copy(out, src)
 		done <- err
 	}()
 
 	select {
 	case <-ctx.Done():
-		_ = h.fs.Remove(filename)
-		return ctx.Err()
-	case err := <-done:
+		err = ctx.Err()
+	case err = <-done:
 		if err != nil {
-			return fmt.Errorf("copying file data: %w", err)
+			err = fmt.Errorf("copying file data: %w", err)
 		}
-		return nil
 	}
+
+	if closeErr := dst.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("closing file %q: %w", filename, closeErr)
+	}
+	if err == nil && checksum != nil {
+		err = checksum.Verify()
+	}
+	if err == nil && h.scanner != nil {
+		err = h.scanner.scan(ctx, h.fs, tmpName, filename)
+	}
+	if err == nil && !modTime.IsZero() {
+		err = h.fs.Chtimes(tmpName, modTime, modTime)
+	}
+	if err == nil && !direct && h.versions != nil {
+		err = h.versions.Save(h.fs, filename)
+	}
+	if err == nil && !direct {
+		err = h.fs.Rename(tmpName, filename)
+	}
+	if err != nil {
+		_ = h.fs.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// writeSaveFailure answers an upload that saveUploadedFile could not store.
+func (h *AdvancedFile) writeSaveFailure(w http.ResponseWriter, r *http.Request, filename string,
+	checksum *uploadChecksum, err error,
+) {
+	var tooLarge *http.MaxBytesError
+	var rejected *scanRejectedError
+	switch {
+	case r.Context().Err() != nil:
+		middleware.WriteJSONError(w, "Upload timeout", http.StatusRequestTimeout)
+	case errors.As(err, &rejected):
+		h.logger.Warn("Upload rejected by scanner",
+			slog.String("filename", filename),
+			slog.String("user", middleware.Username(r)),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("reason", rejected.message))
+		middleware.WriteJSONError(w, "Upload rejected: "+rejected.message, http.StatusUnprocessableEntity)
+	case errors.Is(err, errScanFailed):
+		h.logger.Error("Upload refused: scan failed",
+			slog.String("filename", filename),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("error", err.Error()))
+		middleware.WriteJSONError(w, "Upload could not be scanned", http.StatusServiceUnavailable)
+	case errors.Is(err, errChecksumMismatch):
+		h.logger.Warn("Upload rejected: checksum mismatch",
+			slog.String("filename", filename),
+			slog.String("expected", checksum.String()))
+		middleware.WriteJSONError(w, "Checksum mismatch", http.StatusUnprocessableEntity)
+	case errors.As(err, &tooLarge):
+		middleware.WriteJSONError(w, fmt.Sprintf("File too large, at most %d bytes", tooLarge.Limit),
+			http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errConcurrentModification):
+		h.logger.Warn("Upload refused: concurrent modification",
+			slog.String("filename", filename),
+			slog.String("remote_addr", r.RemoteAddr))
+		middleware.WriteJSONError(w, "Concurrent modification, another upload to this path is in progress",
+			http.StatusConflict)
+	case errors.Is(err, filesystem.ErrReadonly):
+		writeReadonly(w, r)
+	default:
+		h.reporter().JSONError(w, r, "Failed to save file", http.StatusInternalServerError, err)
+	}
+}
+
+// uploadTempName returns a hidden, unique sibling of filename used while an
+// upload is in progress.
+func uploadTempName(filename string) string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return path.Join(path.Dir(filename), fmt.Sprintf(".%s.upload-%x", path.Base(filename), b))
 }
 
 func (h *AdvancedFile) corsMiddleware(next http.Handler) http.Handler {
@@ -849,8 +1458,20 @@ func (h *AdvancedFile) timeoutMiddleware(next http.Handler) http.Handler {
 		var timeout time.Duration
 
 		switch {
+		case r.URL.Path == "/api/events":
+			// The stream lasts until the client leaves
+			next.ServeHTTP(w, r)
+			return
 		case strings.HasPrefix(r.URL.Path, "/api/upload"):
 			timeout = constants.UploadTimeout
+		case h.config.EnableRESTWrite && r.Method == http.MethodPut:
+			timeout = constants.UploadTimeout
+		case h.config.EnableRESTWrite && r.Method == http.MethodDelete:
+			timeout = constants.BulkOperationTimeout
+		case isBulkPath(r.URL.Path):
+			timeout = constants.BulkOperationTimeout
+		case r.URL.Path == "/api/extract":
+			timeout = constants.ExtractTimeout
 		case strings.HasPrefix(r.URL.Path, "/api/"):
 			timeout = constants.DirectoryTimeout
 		default:
@@ -872,12 +1493,14 @@ func (h *AdvancedFile) loggingMiddleware(next http.Handler) http.Handler {
 
 		reqCtx := RequestContext{
 			StartTime:  startTime,
+			RequestID:  middleware.RequestIDFromContext(r.Context()),
 			UserAgent:  r.UserAgent(),
 			RemoteAddr: r.RemoteAddr,
-			Path:       r.URL.Path,
+			Path:       middleware.LogPath(r, r.URL.Path),
 		}
 
-		h.logger.Info("Request started",
+		h.logger.InfoContext(r.Context(), "Request started",
+			slog.String("request_id", reqCtx.RequestID),
 			slog.String("method", r.Method),
 			slog.String("path", reqCtx.Path),
 			slog.String("remote_addr", reqCtx.RemoteAddr),
@@ -891,7 +1514,8 @@ func (h *AdvancedFile) loggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(wrappedWriter, r)
 
 		duration := time.Since(startTime)
-		h.logger.Info("Request completed",
+		h.logger.InfoContext(r.Context(), "Request completed",
+			slog.String("request_id", reqCtx.RequestID),
 			slog.String("method", r.Method),
 			slog.String("path", reqCtx.Path),
 			slog.Int("status_code", wrappedWriter.statusCode),
@@ -909,3 +1533,8 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
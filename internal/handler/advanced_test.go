@@ -0,0 +1,433 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// startSlowUpload begins an upload whose body blocks until the returned pipe
+// writer is closed. The returned channel receives the response once the
+// handler finishes.
+func startSlowUpload(t *testing.T, h *AdvancedFile) (*io.PipeWriter, <-chan *httptest.ResponseRecorder) {
+	t.Helper()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", pr)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		done <- rr
+	}()
+	return pw, done
+}
+
+func waitForInFlightUploads(t *testing.T, h *AdvancedFile, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(h.uploadSemaphore) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d uploads in flight, got %d", want, len(h.uploadSemaphore))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAdvancedFile_UploadConcurrencyLimit(t *testing.T) {
+	cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "advanced", MaxConcurrentUploads: 2}
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), cfg)
+
+	var writers []*io.PipeWriter
+	var results []<-chan *httptest.ResponseRecorder
+	for range 2 {
+		pw, done := startSlowUpload(t, h)
+		writers = append(writers, pw)
+		results = append(results, done)
+	}
+	waitForInFlightUploads(t, h, 2)
+
+	// A third upload is rejected without touching its body
+	req := newUploadRequest(t, h, "hello world", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	// Stats report the saturated semaphore
+	statsReq := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+	statsRR := httptest.NewRecorder()
+	h.ServeHTTP(statsRR, statsReq)
+
+	var stats StatsResponse
+	if err := json.Unmarshal(statsRR.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if stats.Uploads.InFlight != 2 || stats.Uploads.Max != 2 {
+		t.Errorf("expected 2/2 uploads in flight, got %+v", stats.Uploads)
+	}
+
+	// Slots are released when clients disconnect mid-upload
+	for i, pw := range writers {
+		_ = pw.CloseWithError(errors.New("client disconnected"))
+		select {
+		case <-results[i]:
+		case <-time.After(2 * time.Second):
+			t.Fatal("upload handler did not return after disconnect")
+		}
+	}
+	waitForInFlightUploads(t, h, 0)
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, newUploadRequest(t, h, "hello world", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected upload to succeed after slots were released, got %d", rr.Code)
+	}
+}
+
+func TestAdvancedFile_UploadConcurrencyDefault(t *testing.T) {
+	cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "advanced"}
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), cfg)
+
+	if got := cap(h.uploadSemaphore); got != 5 {
+		t.Errorf("expected default upload concurrency 5, got %d", got)
+	}
+}
+
+// gatedFS blocks every open until a token is sent on release.
+type gatedFS struct {
+	internal.FileSystem
+	release chan struct{}
+}
+
+func (g *gatedFS) Open(name string) (io.ReadCloser, error) {
+	<-g.release
+	return g.FileSystem.Open(name)
+}
+
+func (g *gatedFS) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	<-g.release
+	return internal.OpenSeeker(g.FileSystem, name)
+}
+
+// startZip begins a ZIP download of a.txt. The returned channel receives the
+// response once the handler finishes.
+func startZip(h *AdvancedFile) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/zip?path=a.txt", nil))
+		done <- rr
+	}()
+	return done
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newGatedZipHandler(t *testing.T, cfg *config.Config) (*AdvancedFile, *gatedFS) {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	fs := &gatedFS{FileSystem: filesystem.NewLocal(root, false), release: make(chan struct{})}
+	return NewAdvancedFile(fs, cfg), fs
+}
+
+func TestAdvancedFile_ZipQueue(t *testing.T) {
+	cfg := &config.Config{Theme: "advanced", MaxConcurrentZips: 3, ZipQueueTimeout: 2 * time.Second}
+	h, fs := newGatedZipHandler(t, cfg)
+	defer close(fs.release)
+
+	var results []<-chan *httptest.ResponseRecorder
+	for range 3 {
+		results = append(results, startZip(h))
+	}
+	waitFor(t, "3 ZIP downloads in flight", func() bool { return len(h.zipSemaphore) == 3 })
+
+	// A fourth waits for a slot instead of failing
+	fourth := startZip(h)
+	waitFor(t, "a queued ZIP download", func() bool { return h.zipQueue.Load() == 1 })
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	var stats StatsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if stats.Zips != (SlotStats{InFlight: 3, Max: 3, Queued: 1}) {
+		t.Errorf("expected 3/3 ZIP downloads in flight and 1 queued, got %+v", stats.Zips)
+	}
+
+	// and is served once one of them finishes
+	fs.release <- struct{}{}
+	waitFor(t, "the queued ZIP download to start", func() bool { return h.zipQueue.Load() == 0 })
+	for range 3 {
+		fs.release <- struct{}{}
+	}
+	for _, done := range append(results, fourth) {
+		select {
+		case rr := <-done:
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("ZIP download did not finish")
+		}
+	}
+}
+
+func TestAdvancedFile_ZipQueueTimeout(t *testing.T) {
+	cfg := &config.Config{Theme: "advanced", MaxConcurrentZips: 1, ZipQueueTimeout: 50 * time.Millisecond}
+	h, fs := newGatedZipHandler(t, cfg)
+	defer close(fs.release)
+
+	first := startZip(h)
+	waitFor(t, "a ZIP download in flight", func() bool { return len(h.zipSemaphore) == 1 })
+
+	start := time.Now()
+	rr := <-startZip(h)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the request to wait for the queue timeout, took %v", elapsed)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+	if h.zipQueue.Load() != 0 {
+		t.Errorf("expected the queue to be empty, got %d", h.zipQueue.Load())
+	}
+
+	fs.release <- struct{}{}
+	if rr := <-first; rr.Code != http.StatusOK {
+		t.Errorf("expected the first download to succeed, got %d", rr.Code)
+	}
+}
+
+func TestAdvancedFile_UploadModTime(t *testing.T) {
+	mtime := time.Date(2019, 6, 7, 8, 9, 10, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		fields     map[string]string
+		wantStatus int
+		wantTime   time.Time // zero means "about now"
+	}{
+		{name: "no_header_uses_now", wantStatus: http.StatusOK},
+		{
+			name:       "rfc3339_header",
+			headers:    map[string]string{LastModifiedHeader: mtime.Format(time.RFC3339)},
+			wantStatus: http.StatusOK,
+			wantTime:   mtime,
+		},
+		{
+			name:       "http_date_header",
+			headers:    map[string]string{LastModifiedHeader: mtime.Format(http.TimeFormat)},
+			wantStatus: http.StatusOK,
+			wantTime:   mtime,
+		},
+		{
+			name:       "form_field",
+			fields:     map[string]string{"lastModified": "2019-06-07T10:09:10+02:00"},
+			wantStatus: http.StatusOK,
+			wantTime:   mtime,
+		},
+		{
+			name:       "small_skew_allowed",
+			headers:    map[string]string{LastModifiedHeader: time.Now().Add(time.Minute).Format(time.RFC3339)},
+			wantStatus: http.StatusOK,
+			wantTime:   time.Now().Add(time.Minute).Truncate(time.Second),
+		},
+		{
+			name:       "far_future",
+			headers:    map[string]string{LastModifiedHeader: time.Now().Add(time.Hour).Format(time.RFC3339)},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "before_epoch",
+			headers:    map[string]string{LastModifiedHeader: "1969-12-31T23:59:59Z"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "garbage",
+			headers:    map[string]string{LastModifiedHeader: "yesterday"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fs := filesystem.NewLocal(dir, false)
+			h := NewAdvancedFile(fs, &config.Config{Theme: "advanced"})
+
+			req := newUploadRequest(t, h, "hello world", tt.fields)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			started := time.Now()
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			info, statErr := fs.Stat("hello.txt")
+			if tt.wantStatus != http.StatusOK {
+				if statErr == nil {
+					t.Error("expected no file to be written")
+				}
+				return
+			}
+			if statErr != nil {
+				t.Fatalf("expected the file to be written: %v", statErr)
+			}
+
+			var resp UploadResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if tt.wantTime.IsZero() {
+				if info.ModTime().Before(started.Add(-time.Second)) {
+					t.Errorf("expected a current mtime, got %v", info.ModTime())
+				}
+				if resp.ModTime != nil {
+					t.Errorf("expected no modTime in the response, got %v", resp.ModTime)
+				}
+				return
+			}
+			if !info.ModTime().Equal(tt.wantTime) {
+				t.Errorf("expected mtime %v, got %v", tt.wantTime, info.ModTime())
+			}
+			if resp.ModTime == nil || !resp.ModTime.Equal(tt.wantTime) {
+				t.Errorf("expected the response to echo %v, got %v", tt.wantTime, resp.ModTime)
+			}
+		})
+	}
+}
+
+func TestAdvancedFile_InvalidPaths(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), &config.Config{Theme: "advanced"})
+
+	testCases := []struct {
+		path   string
+		status int
+	}{
+		{"/", http.StatusOK},
+		{"//", http.StatusOK},
+		{"/../", http.StatusBadRequest},
+		{"/docs/../../etc/passwd", http.StatusBadRequest},
+		{"/%2e%2e/etc/passwd", http.StatusBadRequest},
+		{"/file%00.txt", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rr.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.path, tc.status, rr.Code)
+			continue
+		}
+		if tc.status != http.StatusBadRequest {
+			continue
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body["error"] != "Invalid path" {
+			t.Errorf("%s: expected the JSON error envelope, got %q", tc.path, rr.Body.String())
+		}
+	}
+}
+
+func TestAdvancedFile_CreateFolder(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(p string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(FolderRequest{Path: p})
+		req := httptest.NewRequest(http.MethodPost, "/api/folder", bytes.NewReader(body))
+		req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	testCases := []struct {
+		name, path string
+		status     int
+		folder     string
+	}{
+		{"nested", "x/y/z", http.StatusOK, "x/y/z"},
+		{"partially existing", "/a/b/c/d/", http.StatusOK, "a/b/c/d"},
+		{"existing", "a/b", http.StatusConflict, ""},
+		{"file in the way", "notes.txt/sub", http.StatusConflict, ""},
+		{"empty segment", "a//c", http.StatusBadRequest, ""},
+		{"dot segment", "a/./c", http.StatusBadRequest, ""},
+		{"parent segment", "a/../c", http.StatusBadRequest, ""},
+		{"reserved name", "a/con", http.StatusBadRequest, ""},
+		{"reserved name with extension", "LPT1.txt", http.StatusBadRequest, ""},
+		{"trailing dot", "a/b.", http.StatusBadRequest, ""},
+		{"empty", "", http.StatusBadRequest, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := create(tc.path)
+			if rr.Code != tc.status {
+				t.Fatalf("%q: expected %d, got %d: %s", tc.path, tc.status, rr.Code, rr.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			var resp FolderResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.Folder != tc.folder {
+				t.Errorf("%q: expected folder %q, got %s", tc.path, tc.folder, rr.Body.String())
+			}
+			if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(tc.folder))); err != nil || !info.IsDir() {
+				t.Errorf("%q: expected %s to be created: %v", tc.path, tc.folder, err)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "c")); !os.IsNotExist(err) {
+		t.Error("expected rejected paths to create nothing")
+	}
+}
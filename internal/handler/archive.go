@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/pathsafe"
+	"github.com/samzong/gofs/pkg/zipstream"
+)
+
+// ZipLimitErrorResponse is returned when collecting files for a ZIP download
+// trips one of the archive limits. Max is a count for "depth" and "entries"
+// and a number of seconds for "time".
+type ZipLimitErrorResponse struct {
+	Error string `json:"error"`
+	Limit string `json:"limit"`
+	Max   int64  `json:"max"`
+}
+
+// ZipSkippedHeader carries the number of selected paths a ZIP download
+// leaves out because they are missing or cannot be read.
+const ZipSkippedHeader = "X-Gofs-Skipped"
+
+// zipManifestName is the archive entry written with {"manifest": true}.
+const zipManifestName = "MANIFEST.json"
+
+// ZipSkipped is a selected path a ZIP download leaves out, and why.
+type ZipSkipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"` // e.g. "not found" or "permission denied"
+}
+
+// ZipManifest is written as the last entry of a ZIP download requested with
+// {"manifest": true}.
+type ZipManifest struct {
+	Files   []string     `json:"files"`   // Archive names of the files included
+	Skipped []ZipSkipped `json:"skipped"` // Selected paths left out
+}
+
+// ZipSkippedErrorResponse is returned when none of the selected paths can be
+// archived.
+type ZipSkippedErrorResponse struct {
+	Error   string       `json:"error"`
+	Skipped []ZipSkipped `json:"skipped"`
+}
+
+// skipReason describes why a path could not be archived.
+func skipReason(err error) string {
+	var apiErr *internal.APIError
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound:
+		return "not found"
+	case errors.Is(err, fs.ErrPermission), errors.As(err, &apiErr) && apiErr.Status == http.StatusForbidden:
+		return "permission denied"
+	}
+	return "cannot be read"
+}
+
+// zipLimitError reports which archive collection limit was exceeded.
+type zipLimitError struct {
+	limit string // "depth", "entries" or "time"
+	max   int64
+}
+
+func (e *zipLimitError) Error() string {
+	return fmt.Sprintf("archive %s limit of %d exceeded", e.limit, e.max)
+}
+
+// status is 400 for trees nested too deeply and 413 for archives that are
+// too large or too slow to collect.
+func (e *zipLimitError) status() int {
+	if e.limit == "depth" {
+		return http.StatusBadRequest
+	}
+	return http.StatusRequestEntityTooLarge
+}
+
+// zipLimits bounds the directory walk behind a ZIP download.
+type zipLimits struct {
+	maxDepth   int
+	maxEntries int
+	timeout    time.Duration
+}
+
+// zipLimitsFor returns the configured archive limits, falling back to the
+// defaults for unset values.
+func zipLimitsFor(cfg *config.Config) zipLimits {
+	limits := zipLimits{
+		maxDepth:   constants.DefaultZipMaxDepth,
+		maxEntries: constants.DefaultZipMaxEntries,
+		timeout:    constants.DefaultZipCollectTimeout,
+	}
+	if cfg.ZipMaxDepth > 0 {
+		limits.maxDepth = cfg.ZipMaxDepth
+	}
+	if cfg.ZipMaxEntries > 0 {
+		limits.maxEntries = cfg.ZipMaxEntries
+	}
+	if cfg.ZipCollectTimeout > 0 {
+		limits.timeout = cfg.ZipCollectTimeout
+	}
+	return limits
+}
+
+// collectZipEntries resolves a ZIP selection in one pass. Each selected file
+// or directory keeps its own name at the top of the archive, and everything
+// below a directory is named relative to the selection root, so extracting
+// reproduces the tree. Directories get explicit entries so empty ones
+// survive. It returns the selected directories alongside the entries, and
+// the selected paths that were left out.
+func (h *AdvancedFile) collectZipEntries(ctx context.Context, paths []string, limits zipLimits,
+) ([]zipstream.FileEntry, []string, []ZipSkipped, error) {
+	var entries []zipstream.FileEntry
+	var dirs []string
+	var skipped []ZipSkipped
+	seen := make(map[string]bool)
+
+	for _, p := range paths {
+		safePath, err := pathsafe.Clean(p)
+		if err != nil || safePath == "" {
+			skipped = append(skipped, ZipSkipped{Path: p, Reason: "invalid path"})
+			continue
+		}
+		if seen[safePath] {
+			continue
+		}
+		seen[safePath] = true
+
+		info, err := h.fs.Stat(safePath)
+		if err != nil {
+			h.logger.Debug("File not found for ZIP",
+				slog.String("path", safePath),
+				slog.String("error", err.Error()))
+			skipped = append(skipped, ZipSkipped{Path: p, Reason: skipReason(err)})
+			continue
+		}
+
+		if len(entries) >= limits.maxEntries {
+			return nil, nil, nil, &zipLimitError{limit: "entries", max: int64(limits.maxEntries)}
+		}
+		name := path.Base(safePath)
+		if !info.IsDir() {
+			entries = append(entries, zipstream.FileEntry{Path: safePath, Name: name, Info: info})
+			continue
+		}
+
+		h.logger.Debug("Adding directory to ZIP",
+			slog.String("path", safePath))
+		entries = append(entries, zipstream.FileEntry{Path: safePath, Name: name + "/", Info: info})
+		if err := h.collectDirFiles(ctx, safePath, name, limits, &entries); err != nil {
+			return nil, nil, nil, err
+		}
+		dirs = append(dirs, safePath)
+	}
+	return entries, dirs, skipped, nil
+}
+
+// collectDirFiles adds every file and directory below basePath to entries,
+// named prefix followed by the path relative to basePath. Directory entries
+// end in a slash. The walk uses an explicit stack so deep trees cannot
+// exhaust the goroutine stack, and stops with a *zipLimitError once the
+// depth, entry count or ctx deadline is exceeded.
+func (h *AdvancedFile) collectDirFiles(ctx context.Context, basePath, prefix string, limits zipLimits,
+	entries *[]zipstream.FileEntry,
+) error {
+	type pendingDir struct {
+		path  string
+		depth int
+	}
+	stack := []pendingDir{{path: basePath}}
+
+	for len(stack) > 0 {
+		if ctx.Err() != nil {
+			return &zipLimitError{limit: "time", max: int64(limits.timeout / time.Second)}
+		}
+		dir := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// The listing is streamed so a huge directory trips maxEntries
+		// before it is read in full; its entries are sorted afterwards to
+		// keep archives reproducible
+		start := len(*entries)
+		var subdirs []pendingDir
+		var limitErr error
+		err := internal.ReadDirIter(h.fs, dir.path, func(file internal.FileInfo) error {
+			if !h.config.ShowHidden && fileutil.IsHiddenPath(path.Join(dir.path, file.Name())) {
+				return nil
+			}
+			fullPath := filepath.Join(dir.path, file.Name())
+
+			if file.IsDir() && dir.depth+1 > limits.maxDepth {
+				limitErr = &zipLimitError{limit: "depth", max: int64(limits.maxDepth)}
+				return limitErr
+			}
+			if len(*entries) >= limits.maxEntries {
+				limitErr = &zipLimitError{limit: "entries", max: int64(limits.maxEntries)}
+				return limitErr
+			}
+			relPath, err := filepath.Rel(basePath, fullPath)
+			if err != nil {
+				relPath = file.Name()
+			}
+			name := path.Join(prefix, filepath.ToSlash(relPath))
+			if file.IsDir() {
+				name += "/"
+				subdirs = append(subdirs, pendingDir{path: fullPath, depth: dir.depth + 1})
+			}
+			*entries = append(*entries, zipstream.FileEntry{
+				Path: fullPath,
+				Name: name,
+				Info: file,
+			})
+			return nil
+		})
+		if limitErr != nil {
+			return limitErr
+		}
+		if err != nil {
+			h.logger.Warn("Failed to read directory for ZIP",
+				slog.String("path", dir.path),
+				slog.String("error", err.Error()))
+			*entries = (*entries)[:start]
+			continue
+		}
+		slices.SortFunc((*entries)[start:], func(a, b zipstream.FileEntry) int {
+			return strings.Compare(a.Info.Name(), b.Info.Name())
+		})
+		slices.SortFunc(subdirs, func(a, b pendingDir) int { return strings.Compare(a.path, b.path) })
+		// Push in reverse so subdirectories are visited in listing order
+		for i := len(subdirs) - 1; i >= 0; i-- {
+			stack = append(stack, subdirs[i])
+		}
+	}
+	return nil
+}
+
+// zipManifestEntry returns the MANIFEST.json entry listing the files written
+// to an archive and the selected paths left out of it.
+func zipManifestEntry(files []string, skipped []ZipSkipped) (zipstream.FileEntry, error) {
+	manifest := ZipManifest{Files: files, Skipped: skipped}
+	if manifest.Files == nil {
+		manifest.Files = []string{}
+	}
+	if manifest.Skipped == nil {
+		manifest.Skipped = []ZipSkipped{}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return zipstream.FileEntry{}, err
+	}
+	return zipstream.FileEntry{
+		Name:   zipManifestName,
+		Info:   zipManifestInfo{size: int64(len(data)), modTime: time.Now()},
+		Reader: io.NopCloser(bytes.NewReader(data)),
+	}, nil
+}
+
+// zipManifestInfo describes the MANIFEST.json entry to zipstream.
+type zipManifestInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+func (i zipManifestInfo) Name() string       { return zipManifestName }
+func (i zipManifestInfo) Size() int64        { return i.size }
+func (i zipManifestInfo) IsDir() bool        { return false }
+func (i zipManifestInfo) ModTime() time.Time { return i.modTime }
+
+// writeZipSkippedError answers a ZIP request none of whose paths can be
+// archived, with the reason for each.
+func writeZipSkippedError(w http.ResponseWriter, skipped []ZipSkipped) {
+	if len(skipped) == 0 {
+		middleware.WriteJSONError(w, "No valid files to download", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(ZipSkippedErrorResponse{Error: "No valid files to download", Skipped: skipped})
+}
+
+// writeZipLimitError writes the JSON response for a tripped archive limit.
+func (h *AdvancedFile) writeZipLimitError(w http.ResponseWriter, r *http.Request, err error) {
+	var limitErr *zipLimitError
+	if !errors.As(err, &limitErr) {
+		h.reporter().JSONError(w, r, "Failed to collect files", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.logger.Warn("ZIP download rejected",
+		slog.String("limit", limitErr.limit),
+		slog.Int64("max", limitErr.max))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(limitErr.status())
+	_ = json.NewEncoder(w).Encode(ZipLimitErrorResponse{
+		Error: "Archive too large: " + limitErr.Error(),
+		Limit: limitErr.limit,
+		Max:   limitErr.max,
+	})
+}
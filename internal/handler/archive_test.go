@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func postZip(t *testing.T, h *AdvancedFile, paths ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(ZipRequest{Paths: paths, Name: "test.zip"})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/zip", bytes.NewReader(body))
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func assertZipLimit(t *testing.T, rr *httptest.ResponseRecorder, status int, limit string) {
+	t.Helper()
+
+	if rr.Code != status {
+		t.Fatalf("expected %d, got %d: %s", status, rr.Code, rr.Body.String())
+	}
+	var resp ZipLimitErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON error: %v", err)
+	}
+	if resp.Limit != limit || resp.Error == "" {
+		t.Errorf("expected %s limit error, got %+v", limit, resp)
+	}
+}
+
+func TestZipDownload_DepthLimit(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "tree")
+	for i := range 40 {
+		deep = filepath.Join(deep, fmt.Sprintf("d%d", i))
+	}
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(deep, "leaf.txt"), []byte("leaf"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", ZipMaxDepth: 10})
+	start := time.Now()
+	assertZipLimit(t, postZip(t, h, "tree"), http.StatusBadRequest, "depth")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("depth limit took %v to trigger", elapsed)
+	}
+
+	h = NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", ZipMaxDepth: 50})
+	if rr := postZip(t, h, "tree"); rr.Code != http.StatusOK {
+		t.Errorf("tree within the depth limit: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestZipDownload_EntryLimit(t *testing.T) {
+	root := t.TempDir()
+	files := make(map[string]string)
+	for i := range 10 {
+		files[fmt.Sprintf("many/sub%d/f%d.txt", i%3, i)] = "x"
+	}
+	writeTestTree(t, root, files)
+
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", ZipMaxEntries: 5})
+	assertZipLimit(t, postZip(t, h, "many"), http.StatusRequestEntityTooLarge, "entries")
+}
+
+func TestZipDownload_TimeLimit(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir", "sub"), 0o755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	cfg := &config.Config{Theme: "advanced", ZipCollectTimeout: time.Nanosecond}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), cfg)
+	assertZipLimit(t, postZip(t, h, "dir"), http.StatusRequestEntityTooLarge, "time")
+}
+
+func TestZipDownload_SymlinkLoop(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "loop")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "self")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- postZip(t, h, "loop") }()
+
+	select {
+	case rr := <-done:
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil {
+			t.Fatalf("invalid ZIP: %v", err)
+		}
+		for _, f := range zr.File {
+			if strings.Count(f.Name, "self") > 1 {
+				t.Errorf("symlink loop was followed: %s", f.Name)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ZIP of a symlink loop did not finish")
+	}
+}
+
+// extractZip unpacks a ZIP response into a new directory and returns the
+// slash-separated paths it created, directories ending in a slash, mapped to
+// file contents.
+func extractZip(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("invalid ZIP: %v", err)
+	}
+	dest := t.TempDir()
+	for _, f := range zr.File {
+		target := filepath.Join(dest, filepath.FromSlash(f.Name))
+		if !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+			t.Fatalf("entry escapes the archive root: %s", f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree := make(map[string]string)
+	err = filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dest {
+			return err
+		}
+		rel, _ := filepath.Rel(dest, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			tree[rel+"/"] = ""
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		tree[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestZipDownload_PreservesTree(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"sel/empty", "sel/nested/deeper"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	writeTestTree(t, root, map[string]string{
+		"top.txt":          "top",
+		"sel/a.txt":        "a",
+		"sel/nested/b.txt": "b",
+	})
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	selTree := map[string]string{
+		"sel/":               "",
+		"sel/a.txt":          "a",
+		"sel/empty/":         "",
+		"sel/nested/":        "",
+		"sel/nested/b.txt":   "b",
+		"sel/nested/deeper/": "",
+	}
+	mixed := map[string]string{"top.txt": "top"}
+	for name, content := range selTree {
+		mixed[name] = content
+	}
+
+	testCases := []struct {
+		name  string
+		paths []string
+		want  map[string]string
+	}{
+		{name: "directory", paths: []string{"sel"}, want: selTree},
+		{name: "files_and_directories", paths: []string{"top.txt", "sel"}, want: mixed},
+		{name: "nested_file", paths: []string{"sel/nested/b.txt"}, want: map[string]string{"b.txt": "b"}},
+		{name: "empty_directory", paths: []string{"sel/empty"}, want: map[string]string{"empty/": ""}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := postZip(t, h, tc.paths...)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if got := extractZip(t, rr.Body.Bytes()); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("extracted %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestZipDownload_SkippedPaths(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "a", "dir/b.txt": "b"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	post := func(req ZipRequest) *httptest.ResponseRecorder {
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/api/zip", bytes.NewReader(body))
+		r.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+	paths := []string{"/a.txt", "/missing.txt", "/dir", "/gone/c.txt"}
+	wantSkipped := []ZipSkipped{{Path: "/missing.txt", Reason: "not found"}, {Path: "/gone/c.txt", Reason: "not found"}}
+
+	t.Run("manifest", func(t *testing.T) {
+		rr := post(ZipRequest{Paths: paths, Manifest: true})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get(ZipSkippedHeader); got != "2" {
+			t.Errorf("Expected %s: 2, got %q", ZipSkippedHeader, got)
+		}
+		tree := extractZip(t, rr.Body.Bytes())
+		var manifest ZipManifest
+		if err := json.Unmarshal([]byte(tree[zipManifestName]), &manifest); err != nil {
+			t.Fatalf("Invalid %s: %v\n%s", zipManifestName, err, tree[zipManifestName])
+		}
+		if want := []string{"a.txt", "dir/b.txt"}; !reflect.DeepEqual(manifest.Files, want) {
+			t.Errorf("Expected files %v, got %v", want, manifest.Files)
+		}
+		if !reflect.DeepEqual(manifest.Skipped, wantSkipped) {
+			t.Errorf("Expected skipped %v, got %v", wantSkipped, manifest.Skipped)
+		}
+	})
+
+	t.Run("no manifest", func(t *testing.T) {
+		rr := post(ZipRequest{Paths: paths})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get(ZipSkippedHeader); got != "2" {
+			t.Errorf("Expected %s: 2, got %q", ZipSkippedHeader, got)
+		}
+		if _, ok := extractZip(t, rr.Body.Bytes())[zipManifestName]; ok {
+			t.Errorf("Expected no %s without the manifest flag", zipManifestName)
+		}
+	})
+
+	t.Run("GET manifest", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/zip?path=/a.txt&path=/missing.txt&manifest=1", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if !strings.Contains(extractZip(t, rr.Body.Bytes())[zipManifestName], `"/missing.txt"`) {
+			t.Errorf("Expected the manifest to list /missing.txt")
+		}
+	})
+
+	t.Run("nothing valid", func(t *testing.T) {
+		rr := post(ZipRequest{Paths: []string{"/missing.txt", "/gone/c.txt"}, Manifest: true})
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp ZipSkippedErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid JSON error: %v", err)
+		}
+		if resp.Error == "" || !reflect.DeepEqual(resp.Skipped, wantSkipped) {
+			t.Errorf("Expected the reason of every path, got %+v", resp)
+		}
+	})
+}
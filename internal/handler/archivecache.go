@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/pkg/httprange"
+	"github.com/samzong/gofs/pkg/zipstream"
+)
+
+// ArchiveCache keeps directory ZIPs on disk so they can be served with Range
+// and ETag support, letting interrupted downloads resume. Entries are named
+// after a hash of the mount, the directory and the path, size and mtime of
+// every file in it, so any change to the tree produces a new entry. The least
+// recently used entries are removed once the total size exceeds maxSize.
+type ArchiveCache struct {
+	dir     string
+	maxSize int64
+	logger  *slog.Logger
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element // key -> *archiveCacheEntry
+	lru      *list.List               // most recently used at the front
+	size     int64
+	building map[string]*archiveBuild
+}
+
+type archiveCacheEntry struct {
+	key  string
+	size int64
+}
+
+// archiveBuild lets concurrent requests for the same archive wait for a
+// single build.
+type archiveBuild struct {
+	done chan struct{}
+	err  error
+}
+
+// NewArchiveCache opens the cache in dir, creating it if needed. Archives
+// left by a previous run are kept, oldest first in eviction order, and
+// partial builds are removed.
+func NewArchiveCache(dir string, maxSize int64, logger *slog.Logger) (*ArchiveCache, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating archive cache %s: %w", dir, err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading archive cache %s: %w", dir, err)
+	}
+
+	c := &ArchiveCache{
+		dir:      dir,
+		maxSize:  maxSize,
+		logger:   logger,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		building: make(map[string]*archiveBuild),
+	}
+
+	type existing struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var found []existing
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		key, ok := strings.CutSuffix(name, ".zip")
+		if !ok || !isArchiveKey(key) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, existing{key: key, size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.Before(found[j].modTime) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range found {
+		c.insertLocked(e.key, e.size)
+	}
+	c.evictLocked("")
+	return c, nil
+}
+
+// Open returns the cached archive for key, calling build to write it first
+// if it is not cached. The file stays readable even if the entry is evicted
+// while it is being served.
+func (c *ArchiveCache) Open(key string, build func(io.Writer) error) (*os.File, error) {
+	for {
+		c.mu.Lock()
+		if el, ok := c.entries[key]; ok {
+			c.lru.MoveToFront(el)
+			// Opened under the lock so eviction cannot remove it first
+			file, err := os.Open(c.path(key))
+			c.mu.Unlock()
+			return file, err
+		}
+		if b, ok := c.building[key]; ok {
+			c.mu.Unlock()
+			<-b.done
+			if b.err != nil {
+				return nil, b.err
+			}
+			continue
+		}
+		b := &archiveBuild{done: make(chan struct{})}
+		c.building[key] = b
+		c.mu.Unlock()
+
+		size, err := c.build(key, build)
+
+		c.mu.Lock()
+		delete(c.building, key)
+		if err == nil {
+			c.insertLocked(key, size)
+			c.evictLocked(key)
+		}
+		c.mu.Unlock()
+
+		b.err = err
+		close(b.done)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// build writes the archive to a temporary file and renames it into place,
+// so a crash or failed build never leaves a truncated entry behind.
+func (c *ArchiveCache) build(key string, build func(io.Writer) error) (int64, error) {
+	tmp, err := os.CreateTemp(c.dir, key+"-*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("creating archive: %w", err)
+	}
+	err = build(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	info, err := os.Stat(c.path(key))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (c *ArchiveCache) insertLocked(key string, size int64) {
+	c.entries[key] = c.lru.PushFront(&archiveCacheEntry{key: key, size: size})
+	c.size += size
+}
+
+// evictLocked removes least recently used entries until the cache fits in
+// maxSize, never removing keep.
+func (c *ArchiveCache) evictLocked(keep string) {
+	for c.size > c.maxSize {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		entry := el.Value.(*archiveCacheEntry)
+		if entry.key == keep {
+			return
+		}
+		c.lru.Remove(el)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		if err := os.Remove(c.path(entry.key)); err != nil && !os.IsNotExist(err) {
+			c.logger.Warn("Failed to evict cached archive",
+				slog.String("key", entry.key),
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (c *ArchiveCache) path(key string) string {
+	return filepath.Join(c.dir, key+".zip")
+}
+
+// archiveKey identifies the archive of dir on the mount named by scope as it
+// is made of entries.
+func archiveKey(scope, dir string, entries []zipstream.FileEntry) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\n", scope, dir)
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", e.Name, e.Info.Size(), e.Info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isArchiveKey(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// serveCachedArchive serves the ZIP of dir from the archive cache, building
+// it first if needed, with ETag, If-Range and Range support.
+func (h *AdvancedFile) serveCachedArchive(w http.ResponseWriter, r *http.Request, dir, zipName string,
+	entries []zipstream.FileEntry,
+) {
+	key := archiveKey(h.archiveScope, dir, entries)
+
+	// Detached from the request so an interrupted download still leaves a
+	// complete archive behind to resume from
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), constants.ArchiveBuildTimeout)
+	defer cancel()
+	file, err := h.archives.Open(key, func(out io.Writer) error {
+		zw := zipstream.NewWriter(out, zipOptions())
+		if _, _, err := h.writeZipEntries(ctx, zw, entries); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+	if err != nil {
+		h.reporter().JSONError(w, r, "Failed to build archive", http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		h.reporter().JSONError(w, r, "Cannot stat archive", http.StatusInternalServerError, err)
+		return
+	}
+	size := info.Size()
+
+	etag := `"` + key[:32] + `"`
+	w.Header().Set("Cache-Control", "no-cache")
+	rangeOK, serve := checkConditions(w, r, etag, time.Time{})
+	if !serve {
+		return
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if !rangeOK {
+		// The archive changed since the client's partial download
+		rangeHeader = ""
+	}
+	rng, err := httprange.ParseRange(rangeHeader, size)
+	if err != nil {
+		if err == httprange.ErrUnsatisfiableRange {
+			httprange.WriteRangeNotSatisfiable(w, size)
+			return
+		}
+		rng = nil
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", zipName))
+	h.logger.Info("Serving cached ZIP download",
+		slog.String("path", dir),
+		slog.Int("file_count", len(entries)),
+		slog.Int64("size", size),
+		slog.Bool("partial", rng != nil))
+
+	if rng != nil {
+		_, err = httprange.ServeContent(r.Context(), w, file, rng, size, "application/zip")
+	} else {
+		_, err = httprange.ServeFullContent(r.Context(), w, file, size, "application/zip")
+	}
+	if err != nil {
+		logCopyError(h.logger, "Error serving cached ZIP", err,
+			slog.String("path", dir))
+	}
+}
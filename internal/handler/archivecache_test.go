@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func newArchiveTestHandler(t *testing.T, maxSize int64) (*AdvancedFile, string, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"docs/a.txt":     strings.Repeat("a", 100),
+		"docs/sub/b.txt": strings.Repeat("b", 200),
+		"other/c.txt":    strings.Repeat("c", 300),
+	})
+
+	cacheDir := filepath.Join(t.TempDir(), "archives")
+	cache, err := NewArchiveCache(cacheDir, maxSize, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewArchiveCache: %v", err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	h.SetArchiveCache(cache, root)
+	return h, root, cacheDir
+}
+
+func getZip(h http.Handler, dir string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/zip?path="+dir, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func cachedArchives(t *testing.T, cacheDir string) []string {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(cacheDir, "*.zip"))
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	return matches
+}
+
+func TestArchiveCache_ResumableDownload(t *testing.T) {
+	h, root, cacheDir := newArchiveTestHandler(t, 1<<20)
+
+	first := getZip(h, "docs", nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", first.Code, first.Body.String())
+	}
+	full := first.Body.Bytes()
+	if _, err := zip.NewReader(bytes.NewReader(full), int64(len(full))); err != nil {
+		t.Fatalf("invalid ZIP: %v", err)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("expected ETag and Accept-Ranges, got %v", first.Header())
+	}
+	if !strings.Contains(first.Header().Get("Content-Disposition"), `"docs.zip"`) {
+		t.Errorf("unexpected Content-Disposition %q", first.Header().Get("Content-Disposition"))
+	}
+
+	second := getZip(h, "docs", map[string]string{"Range": "bytes=10-19", "If-Range": etag})
+	if second.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", second.Code)
+	}
+	if !bytes.Equal(second.Body.Bytes(), full[10:20]) {
+		t.Error("partial content does not match the full archive")
+	}
+	if got := len(cachedArchives(t, cacheDir)); got != 1 {
+		t.Errorf("expected one cached archive, got %d", got)
+	}
+
+	if rr := getZip(h, "docs", map[string]string{"If-None-Match": etag}); rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+
+	// Changing a file yields a new archive, and a stale If-Range gets the whole of it
+	future := time.Now().Add(time.Hour)
+	if err := os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("changed"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "docs", "a.txt"), future, future); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	third := getZip(h, "docs", map[string]string{"Range": "bytes=10-19", "If-Range": etag})
+	if third.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a changed directory, got %d", third.Code)
+	}
+	if newETag := third.Header().Get("ETag"); newETag == etag || newETag == "" {
+		t.Errorf("expected a new ETag, got %q", newETag)
+	}
+	if got := len(cachedArchives(t, cacheDir)); got != 2 {
+		t.Errorf("expected two cached archives, got %d", got)
+	}
+}
+
+func TestArchiveCache_Eviction(t *testing.T) {
+	h, _, cacheDir := newArchiveTestHandler(t, 700)
+
+	if rr := getZip(h, "docs", nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	docs := cachedArchives(t, cacheDir)
+	if rr := getZip(h, "other", nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	remaining := cachedArchives(t, cacheDir)
+	if len(remaining) != 1 || remaining[0] == docs[0] {
+		t.Errorf("expected only the most recent archive to remain, got %v", remaining)
+	}
+}
+
+func TestArchiveCache_ReopensExistingEntries(t *testing.T) {
+	dir := t.TempDir()
+	key := strings.Repeat("ab", 32)
+	if err := os.WriteFile(filepath.Join(dir, key+".zip"), []byte("zip"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, key+"-123.tmp"), []byte("partial"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cache, err := NewArchiveCache(dir, 1<<20, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewArchiveCache: %v", err)
+	}
+	file, err := cache.Open(key, func(io.Writer) error {
+		t.Error("existing entry should not be rebuilt")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	file.Close()
+	if _, err := os.Stat(filepath.Join(dir, key+"-123.tmp")); !os.IsNotExist(err) {
+		t.Error("partial builds should be removed")
+	}
+}
+
+func TestZipDownload_StreamsWithoutArchiveCache(t *testing.T) {
+	h, _, _ := newArchiveTestHandler(t, 1<<20)
+	h.SetArchiveCache(nil, "")
+
+	rr := getZip(h, "docs", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if rr.Header().Get("Accept-Ranges") != "" || rr.Header().Get("ETag") != "" {
+		t.Errorf("streamed archives must not advertise ranges: %v", rr.Header())
+	}
+}
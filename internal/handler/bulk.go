@@ -0,0 +1,438 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// BulkRequest is the body of POST /api/delete, /api/move and /api/copy.
+// Destination is the directory that move and copy place each path into.
+// Instead of Paths, a request may name the entries of the directory Path
+// whose names match Glob, as GET /api/select would return them.
+type BulkRequest struct {
+	Paths       []string `json:"paths"`
+	Path        string   `json:"path,omitempty"`
+	Glob        string   `json:"glob,omitempty"`
+	Destination string   `json:"destination,omitempty"`
+}
+
+// BulkResult is the outcome for one requested path.
+type BulkResult struct {
+	Path  string `json:"path"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// BulkResponse holds one result per requested path, in request order. A
+// batch with failed items still returns 200; callers check each result.
+type BulkResponse struct {
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+var (
+	errBulkInvalidPath = errors.New("invalid path")
+	errBulkExists      = errors.New("destination already exists")
+	errBulkIntoSelf    = errors.New("cannot place a directory inside itself")
+	errBulkNoRename    = errors.New("backend cannot rename")
+	errBulkUnlisted    = errors.New("directory holds entries that are not listed")
+	errBulkSymlink     = errors.New("symbolic link cannot be copied")
+)
+
+// bulkOp applies an operation to one validated, mount-relative path.
+type bulkOp func(ctx context.Context, name string) error
+
+// isBulkPath reports whether urlPath is one of the bulk mutation endpoints.
+func isBulkPath(urlPath string) bool {
+	switch urlPath {
+	case "/api/delete", "/api/move", "/api/copy":
+		return true
+	}
+	return false
+}
+
+// handleBulk serves the bulk endpoints. Paths are processed by a bounded
+// worker pool under the request deadline; a failing path never aborts the
+// rest of the batch.
+func (h *AdvancedFile) handleBulk(w http.ResponseWriter, r *http.Request) {
+	var req BulkRequest
+	if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+	paths, ok := h.selectionPaths(w, r, req.Paths, req.Path, req.Glob, constants.MaxBulkPaths)
+	if !ok {
+		return
+	}
+	req.Paths = paths
+	if len(req.Paths) == 0 {
+		middleware.WriteJSONError(w, "No files selected", http.StatusBadRequest)
+		return
+	}
+	if err := validateRequestPaths(req.Paths, constants.MaxBulkPaths); err != nil {
+		writeRequestPathsError(w, err, constants.MaxBulkPaths)
+		return
+	}
+	if len(req.Destination) > constants.MaxRequestPathLength {
+		writeRequestPathsError(w, errPathTooLong, constants.MaxBulkPaths)
+		return
+	}
+
+	operation := strings.TrimPrefix(r.URL.Path, "/api/")
+	var op bulkOp
+	switch operation {
+	case "delete":
+		op = h.deletePath
+	case "move", "copy":
+		dest, err := h.bulkDestination(req.Destination)
+		if err != nil {
+			h.reporter().JSONError(w, r, "Invalid destination", http.StatusBadRequest, err)
+			return
+		}
+		if operation == "move" {
+			op = func(_ context.Context, name string) error { return h.movePath(name, dest) }
+		} else {
+			op = func(ctx context.Context, name string) error { return h.copyPath(ctx, name, dest) }
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	response := BulkResponse{Results: h.runBulk(r.Context(), req.Paths, op)}
+	for _, result := range response.Results {
+		if result.OK {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	h.logger.Info("Bulk operation completed",
+		slog.String("operation", operation),
+		slog.Int("succeeded", response.Succeeded),
+		slog.Int("failed", response.Failed))
+
+	if err := middleware.WriteJSON(w, response); err != nil {
+		h.logger.Warn("Failed to write bulk response",
+			slog.String("operation", operation),
+			slog.String("error", err.Error()))
+	}
+}
+
+// runBulk applies op to every path using at most constants.BulkWorkers
+// goroutines. Paths not started before ctx is done fail with its error.
+func (h *AdvancedFile) runBulk(ctx context.Context, paths []string, op bulkOp) []BulkResult {
+	results := make([]BulkResult, len(paths))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(constants.BulkWorkers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = h.runBulkItem(ctx, paths[i], op)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func (h *AdvancedFile) runBulkItem(ctx context.Context, requested string, op bulkOp) BulkResult {
+	result := BulkResult{Path: requested}
+
+	err := ctx.Err()
+	if err == nil {
+		name, cleanErr := pathsafe.Clean(requested)
+		if cleanErr != nil || name == "" {
+			err = errBulkInvalidPath
+		} else {
+			err = op(ctx, name)
+		}
+	}
+	if err != nil {
+		result.Error = h.bulkErrorMessage(requested, err)
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// bulkErrorMessage turns err into a per-item message that does not reveal
+// filesystem paths unless --debug-errors is set.
+func (h *AdvancedFile) bulkErrorMessage(requested string, err error) string {
+	var apiErr *internal.APIError
+	var quotaErr *quotaExceededError
+	switch {
+	case errors.Is(err, errBulkInvalidPath):
+		return "Invalid path"
+	case errors.Is(err, errBulkExists):
+		return "Destination already exists"
+	case errors.Is(err, errBulkIntoSelf):
+		return "Cannot place a directory inside itself"
+	case errors.Is(err, filesystem.ErrReadonly):
+		return "Read-only mount"
+	case errors.Is(err, errBulkNoRename):
+		return "Moving is not supported on this mount"
+	case errors.Is(err, errBulkUnlisted):
+		return "Directory holds hidden entries"
+	case errors.Is(err, errBulkSymlink), errors.Is(err, errors.ErrUnsupported):
+		return "Symbolic link cannot be copied"
+	case errors.Is(err, errConcurrentModification):
+		return "Concurrent modification"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "Request deadline exceeded"
+	case errors.As(err, &quotaErr):
+		return "Insufficient storage: " + quotaErr.Error()
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound:
+		return "Not found"
+	}
+
+	h.logger.Warn("Bulk operation failed",
+		slog.String("path", requested),
+		slog.String("error", err.Error()))
+	if h.config.DebugErrors {
+		return "Operation failed: " + err.Error()
+	}
+	return "Operation failed"
+}
+
+// bulkDestination validates the target directory of a move or copy. An
+// empty destination is the mount root.
+func (h *AdvancedFile) bulkDestination(dest string) (string, error) {
+	name, err := pathsafe.Clean(dest)
+	if err != nil {
+		return "", errBulkInvalidPath
+	}
+	if name == "" {
+		return "", nil
+	}
+	info, err := h.fs.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", name)
+	}
+	return name, nil
+}
+
+// deletePath removes name and, for directories, everything below it.
+func (h *AdvancedFile) deletePath(ctx context.Context, name string) error {
+	freed, err := h.removeTree(ctx, name)
+	if h.quota != nil && freed > 0 {
+		h.quota.Release(freed)
+	}
+	return err
+}
+
+// bulkEntry is one path of a tree a bulk operation walks.
+type bulkEntry struct {
+	name string
+	info internal.FileInfo
+}
+
+// removeTree removes name depth-first and returns the bytes freed, which
+// may be non-zero even when it fails part way through. Symbolic links are
+// removed, never followed. The whole tree is walked before anything is
+// removed, so a directory holding entries the mount does not list, such as
+// dotfiles without --show-hidden, is refused untouched.
+func (h *AdvancedFile) removeTree(ctx context.Context, name string) (int64, error) {
+	info, err := internal.Lstat(h.fs, name)
+	if err != nil {
+		return 0, err
+	}
+	var plan []bulkEntry
+	if err := h.planRemove(ctx, name, info, &plan); err != nil {
+		return 0, err
+	}
+
+	var freed int64
+	for _, entry := range plan {
+		if err := ctx.Err(); err != nil {
+			return freed, err
+		}
+		if err := h.fs.Remove(entry.name); err != nil {
+			return freed, err
+		}
+		if !entry.info.IsDir() {
+			freed += entry.info.Size()
+		}
+	}
+	return freed, nil
+}
+
+// planRemove appends the entries below name, then name itself, to plan in
+// the order they can be removed.
+func (h *AdvancedFile) planRemove(ctx context.Context, name string, info internal.FileInfo, plan *[]bulkEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := h.fs.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		all, err := internal.ReadDirAll(h.fs, name)
+		if err != nil {
+			return err
+		}
+		if len(all) > len(entries) {
+			return errBulkUnlisted
+		}
+		for _, entry := range entries {
+			if err := h.planRemove(ctx, path.Join(name, entry.Name()), entry, plan); err != nil {
+				return err
+			}
+		}
+	}
+	*plan = append(*plan, bulkEntry{name: name, info: info})
+	return nil
+}
+
+// bulkTarget returns where name lands inside dest, refusing to overwrite
+// anything or to nest a directory inside itself.
+func (h *AdvancedFile) bulkTarget(name, dest string) (string, error) {
+	if _, err := internal.Lstat(h.fs, name); err != nil {
+		return "", err
+	}
+	if dest == name || strings.HasPrefix(dest, name+"/") {
+		return "", errBulkIntoSelf
+	}
+	target := path.Join(dest, path.Base(name))
+	if _, err := internal.Lstat(h.fs, target); err == nil {
+		return "", errBulkExists
+	}
+	return target, nil
+}
+
+// movePath renames name into dest. Moves stay within the mount, so they do
+// not change quota usage.
+func (h *AdvancedFile) movePath(name, dest string) error {
+	if !internal.CapabilitiesOf(h.fs).CanRename {
+		return errBulkNoRename
+	}
+	target, err := h.bulkTarget(name, dest)
+	if err != nil {
+		return err
+	}
+	return h.fs.Rename(name, target)
+}
+
+// copyPath copies name, recursively for directories, into dest after
+// reserving its size against the mount quota.
+func (h *AdvancedFile) copyPath(ctx context.Context, name, dest string) error {
+	target, err := h.bulkTarget(name, dest)
+	if err != nil {
+		return err
+	}
+	info, err := internal.Lstat(h.fs, name)
+	if err != nil {
+		return err
+	}
+
+	var reserved int64
+	if h.quota != nil {
+		if reserved, err = h.pathSize(name, info); err != nil {
+			return err
+		}
+		if err := h.quota.Reserve(reserved); err != nil {
+			return err
+		}
+	}
+	if err := h.copyTree(ctx, name, target, info); err != nil {
+		if h.quota != nil {
+			h.quota.Release(reserved)
+		}
+		return err
+	}
+	return nil
+}
+
+// pathSize returns the size of a file, or the total size of a directory.
+func (h *AdvancedFile) pathSize(name string, info internal.FileInfo) (int64, error) {
+	if info.IsDir() {
+		return treeSize(h.fs, name)
+	}
+	return info.Size(), nil
+}
+
+// copyTree copies src, described by info, to dst. Symbolic links are copied
+// as links to the same relative target, never followed. Entries the mount
+// does not list are left out.
+func (h *AdvancedFile) copyTree(ctx context.Context, src, dst string, info internal.FileInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if internal.FileMode(info)&os.ModeSymlink != 0 {
+		target := internal.LinkTarget(info)
+		if target == "" {
+			return errBulkSymlink
+		}
+		return internal.Symlink(h.fs, target, dst)
+	}
+	if !info.IsDir() {
+		return h.copyFile(ctx, src, dst)
+	}
+
+	if err := h.fs.Mkdir(dst, 0755); err != nil {
+		return err
+	}
+	entries, err := h.fs.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := h.copyTree(ctx, path.Join(src, entry.Name()), path.Join(dst, entry.Name()), entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies one file, removing the partial copy if it fails.
+func (h *AdvancedFile) copyFile(ctx context.Context, src, dst string) error {
+	in, err := h.fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := h.fs.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, &contextReader{ctx: ctx, r: in})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if removeErr := h.fs.Remove(dst); removeErr != nil {
+			h.logger.Warn("Failed to remove partial copy",
+				slog.String("path", dst),
+				slog.String("error", removeErr.Error()))
+		}
+		return err
+	}
+	return nil
+}
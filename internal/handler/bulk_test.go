@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func newBulkTestDir(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"a.txt":         "aaaa",
+		"b.txt":         "bb",
+		"dir/inner.txt": "inner",
+		"dest/keep.txt": "keep",
+	})
+	return root
+}
+
+func postBulk(t *testing.T, h *AdvancedFile, endpoint string, req BulkRequest,
+) (*httptest.ResponseRecorder, BulkResponse) {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	httpReq := httptest.NewRequest(http.MethodPost, endpoint, strings.NewReader(string(body)))
+	httpReq.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httpReq)
+
+	var resp BulkResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+	}
+	return rr, resp
+}
+
+func assertBulkResults(t *testing.T, resp BulkResponse, want map[string]string) {
+	t.Helper()
+
+	if len(resp.Results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), resp.Results)
+	}
+	for _, result := range resp.Results {
+		expected, ok := want[result.Path]
+		if !ok {
+			t.Errorf("unexpected result for %q", result.Path)
+			continue
+		}
+		if expected == "" && !result.OK {
+			t.Errorf("%s: expected success, got %q", result.Path, result.Error)
+		}
+		if expected != "" && (result.OK || result.Error != expected) {
+			t.Errorf("%s: expected error %q, got ok=%v error=%q", result.Path, expected, result.OK, result.Error)
+		}
+	}
+}
+
+func TestAdvancedFile_BulkDelete(t *testing.T) {
+	root := newBulkTestDir(t)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	rr, resp := postBulk(t, h, "/api/delete", BulkRequest{Paths: []string{"/a.txt", "missing.txt", "dir", "../x", "/"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	assertBulkResults(t, resp, map[string]string{
+		"/a.txt":      "",
+		"missing.txt": "Not found",
+		"dir":         "",
+		"../x":        "Invalid path",
+		"/":           "Invalid path",
+	})
+	if resp.Succeeded != 2 || resp.Failed != 3 {
+		t.Errorf("expected 2 succeeded and 3 failed, got %d and %d", resp.Succeeded, resp.Failed)
+	}
+	for _, name := range []string{"a.txt", "dir"} {
+		if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been deleted", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "b.txt")); err != nil {
+		t.Error("unselected files must be kept")
+	}
+}
+
+func TestAdvancedFile_BulkMoveAndCopy(t *testing.T) {
+	root := newBulkTestDir(t)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	_, resp := postBulk(t, h, "/api/copy", BulkRequest{
+		Paths:       []string{"a.txt", "dir", "missing.txt", "dest/keep.txt", "dest"},
+		Destination: "/dest",
+	})
+	assertBulkResults(t, resp, map[string]string{
+		"a.txt":         "",
+		"dir":           "",
+		"missing.txt":   "Not found",
+		"dest/keep.txt": "Destination already exists",
+		"dest":          "Cannot place a directory inside itself",
+	})
+	if data, err := os.ReadFile(filepath.Join(root, "dest", "dir", "inner.txt")); err != nil || string(data) != "inner" {
+		t.Errorf("directory should be copied recursively, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Error("copy must keep the source")
+	}
+
+	_, resp = postBulk(t, h, "/api/move", BulkRequest{Paths: []string{"b.txt", "a.txt"}, Destination: "dest"})
+	assertBulkResults(t, resp, map[string]string{
+		"b.txt": "",
+		"a.txt": "Destination already exists",
+	})
+	if _, err := os.Stat(filepath.Join(root, "dest", "b.txt")); err != nil {
+		t.Error("b.txt should be moved into dest")
+	}
+	if _, err := os.Stat(filepath.Join(root, "b.txt")); !os.IsNotExist(err) {
+		t.Error("move must remove the source")
+	}
+
+	for _, dest := range []string{"missing", "a.txt", "../.."} {
+		rr, _ := postBulk(t, h, "/api/move", BulkRequest{Paths: []string{"a.txt"}, Destination: dest})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("destination %q: expected 400, got %d", dest, rr.Code)
+		}
+	}
+}
+
+func TestAdvancedFile_BulkSymlinks(t *testing.T) {
+	root := newBulkTestDir(t)
+	writeTestTree(t, root, map[string]string{"outer/file.txt": "outer"})
+	if err := os.Symlink("../dir", filepath.Join(root, "outer", "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir", filepath.Join(root, "top")); err != nil {
+		t.Fatal(err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	_, resp := postBulk(t, h, "/api/copy", BulkRequest{Paths: []string{"outer"}, Destination: "dest"})
+	assertBulkResults(t, resp, map[string]string{"outer": ""})
+	if target, err := os.Readlink(filepath.Join(root, "dest", "outer", "link")); err != nil || target != "../dir" {
+		t.Errorf("symlink should be copied as a link, got %q (%v)", target, err)
+	}
+
+	_, resp = postBulk(t, h, "/api/delete", BulkRequest{Paths: []string{"outer", "top"}})
+	assertBulkResults(t, resp, map[string]string{"outer": "", "top": ""})
+	for _, name := range []string{"outer", "top"} {
+		if _, err := os.Lstat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been deleted", name)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "dir", "inner.txt")); err != nil || string(data) != "inner" {
+		t.Errorf("deleting a symlink must keep its target, got %q (%v)", data, err)
+	}
+}
+
+func TestAdvancedFile_BulkHiddenEntries(t *testing.T) {
+	root := newBulkTestDir(t)
+	writeTestTree(t, root, map[string]string{"dir/.env": "secret", "dir/sub/more.txt": "more"})
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	_, resp := postBulk(t, h, "/api/delete", BulkRequest{Paths: []string{"dir"}})
+	assertBulkResults(t, resp, map[string]string{"dir": "Directory holds hidden entries"})
+	for _, name := range []string{"dir/.env", "dir/inner.txt", "dir/sub/more.txt"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Errorf("%s must be kept when the delete is refused", name)
+		}
+	}
+
+	_, resp = postBulk(t, h, "/api/copy", BulkRequest{Paths: []string{"dir"}, Destination: "dest"})
+	assertBulkResults(t, resp, map[string]string{"dir": ""})
+	if _, err := os.Stat(filepath.Join(root, "dest", "dir", ".env")); !os.IsNotExist(err) {
+		t.Error("copies must leave out hidden entries")
+	}
+
+	h = NewAdvancedFile(filesystem.NewLocal(root, true), &config.Config{Theme: "advanced", ShowHidden: true})
+	_, resp = postBulk(t, h, "/api/delete", BulkRequest{Paths: []string{"dir"}})
+	assertBulkResults(t, resp, map[string]string{"dir": ""})
+	if _, err := os.Stat(filepath.Join(root, "dir")); !os.IsNotExist(err) {
+		t.Error("dir should be deleted with --show-hidden")
+	}
+}
+
+func TestAdvancedFile_BulkReadonly(t *testing.T) {
+	root := newBulkTestDir(t)
+	h := NewAdvancedFile(filesystem.NewReadonly(filesystem.NewLocal(root, false)), &config.Config{Theme: "advanced"})
+
+	for _, endpoint := range []string{"/api/delete", "/api/move", "/api/copy"} {
+		rr, _ := postBulk(t, h, endpoint, BulkRequest{Paths: []string{"a.txt", "dir"}, Destination: "dest"})
+		var resp ReadonlyErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); rr.Code != http.StatusForbidden || err != nil ||
+			resp.Code != ReadonlyErrorCode {
+			t.Errorf("%s: expected 403 %s, got %d %s", endpoint, ReadonlyErrorCode, rr.Code, rr.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "dir", "inner.txt")); err != nil {
+		t.Error("read-only mount must not be modified")
+	}
+}
+
+func TestAdvancedFile_BulkQuota(t *testing.T) {
+	root := newBulkTestDir(t)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	h.SetQuota(19) // 15 bytes used
+
+	_, resp := postBulk(t, h, "/api/copy", BulkRequest{Paths: []string{"dir"}, Destination: "dest"})
+	if len(resp.Results) != 1 || !strings.HasPrefix(resp.Results[0].Error, "Insufficient storage") {
+		t.Fatalf("expected quota error, got %+v", resp.Results)
+	}
+
+	// Deleting frees space for the copy
+	postBulk(t, h, "/api/delete", BulkRequest{Paths: []string{"a.txt"}})
+	_, resp = postBulk(t, h, "/api/copy", BulkRequest{Paths: []string{"dir"}, Destination: "dest"})
+	assertBulkResults(t, resp, map[string]string{"dir": ""})
+}
+
+func TestAdvancedFile_BulkRequestValidation(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(newBulkTestDir(t), false), &config.Config{Theme: "advanced"})
+
+	if rr, _ := postBulk(t, h, "/api/delete", BulkRequest{}); rr.Code != http.StatusBadRequest {
+		t.Errorf("empty batch: expected 400, got %d", rr.Code)
+	}
+	tooMany := make([]string, constants.MaxBulkPaths+1)
+	if rr, _ := postBulk(t, h, "/api/delete", BulkRequest{Paths: tooMany}); rr.Code != http.StatusBadRequest {
+		t.Errorf("oversized batch: expected 400, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/delete", strings.NewReader(`{"paths":["a.txt"]}`))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("missing CSRF token: expected 403, got %d", rr.Code)
+	}
+}
+
+func TestCapabilities_BulkFeatures(t *testing.T) {
+	cfg := &config.Config{Theme: "advanced"}
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), cfg)
+
+	for _, readonly := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodGet, "/api/capabilities", nil)
+		req = req.WithContext(internal.WithMountInfo(req.Context(), "/data", "Data", readonly))
+		caps := fetchCapabilities(t, h, req)
+		if caps.Features.Delete == readonly || caps.Features.Move == readonly || caps.Features.Copy == readonly {
+			t.Errorf("readonly=%v: unexpected features %+v", readonly, caps.Features)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+)
+
+// CapabilitiesResponse describes the features available to API clients for
+// the mount that served the request.
+type CapabilitiesResponse struct {
+	Version       string       `json:"version"`
+	Theme         string       `json:"theme"`
+	AuthMode      string       `json:"authMode"`
+	Readonly      bool         `json:"readonly"`
+	CaseSensitive bool         `json:"caseSensitive"` // Names differing only in case are different files
+	Features      FeatureFlags `json:"features"`
+	Limits        Limits       `json:"limits"`
+	Access        AccessInfo   `json:"access"` // How other machines reach the server, for a "share" dialog
+}
+
+// FeatureFlags reports which optional features are enabled.
+type FeatureFlags struct {
+	Upload    bool `json:"upload"`
+	Mkdir     bool `json:"mkdir"`
+	Delete    bool `json:"delete"`
+	Move      bool `json:"move"`
+	Copy      bool `json:"copy"`
+	Extract   bool `json:"extract"` // ZIP archives of the mount can be unpacked by POST /api/extract
+	Zip       bool `json:"zip"`
+	WebDAV    bool `json:"webdav"`
+	Search    bool `json:"search"`
+	Markdown  bool `json:"markdown"`
+	Tree      bool `json:"tree"`
+	Versions  bool `json:"versions"`  // Replaced files are kept and served by /api/versions
+	RESTWrite bool `json:"restWrite"` // PUT and DELETE on file paths, with Basic credentials
+	Scrub     bool `json:"scrub"`     // Files are checked for corruption, see /api/scrub/report
+	Range     bool `json:"range"`     // Files answer Range requests, which needs a backend that seeks
+	Events    bool `json:"events"`    // GET /api/events streams directory changes
+}
+
+// Limits reports size limits enforced by the server, in bytes.
+type Limits struct {
+	MaxUploadSize        int64 `json:"maxUploadSize"`
+	MaxDownloadSize      int64 `json:"maxDownloadSize,omitempty"` // Unset when downloads are not limited
+	MaxZipSize           int64 `json:"maxZipSize"`
+	MaxExtractSize       int64 `json:"maxExtractSize,omitempty"` // Unset when extraction is unavailable
+	MaxConcurrentUploads int   `json:"maxConcurrentUploads"`
+}
+
+// maxConcurrentUploads returns the configured upload concurrency, falling back
+// to the default when unset.
+func maxConcurrentUploads(cfg *config.Config) int {
+	if cfg.MaxConcurrentUploads > 0 {
+		return cfg.MaxConcurrentUploads
+	}
+	return constants.DefaultMaxConcurrentUploads
+}
+
+// maxConcurrentZips returns the configured ZIP download concurrency, falling
+// back to the default when unset.
+func maxConcurrentZips(cfg *config.Config) int {
+	if cfg.MaxConcurrentZips > 0 {
+		return cfg.MaxConcurrentZips
+	}
+	return constants.DefaultMaxConcurrentZips
+}
+
+// buildCapabilities derives the capabilities document from the configuration,
+// the mount information carried by the request context and the capabilities
+// of the backend serving it.
+func buildCapabilities(r *http.Request, cfg *config.Config, fsys internal.FileSystem) CapabilitiesResponse {
+	backend := internal.CapabilitiesOf(fsys)
+	readonly := mountReadonly(r, cfg) || !backend.CanWrite
+
+	authMode := cfg.AuthMode
+	if authMode == "" {
+		authMode = "none"
+	}
+
+	advanced := cfg.Theme == "advanced"
+	writable := advanced && !readonly
+
+	caps := CapabilitiesResponse{
+		Version:       cfg.Version,
+		Theme:         cfg.Theme,
+		AuthMode:      authMode,
+		Readonly:      readonly,
+		CaseSensitive: backend.CaseSensitive,
+		Access:        Access(cfg),
+		Features: FeatureFlags{
+			Upload:    writable,
+			Mkdir:     writable,
+			Delete:    writable,
+			Move:      writable && backend.CanRename,
+			Copy:      writable,
+			Extract:   writable,
+			Zip:       advanced,
+			WebDAV:    cfg.EnableWebDAV,
+			Search:    advanced,
+			Tree:      advanced && cfg.EnableTree,
+			Versions:  advanced && cfg.VersionsDir != "",
+			RESTWrite: writable && cfg.EnableRESTWrite,
+			Scrub:     advanced && cfg.ScrubInterval > 0,
+			Range:     backend.CanSeek,
+			Events:    advanced && cfg.WatchMode != config.WatchOff,
+		},
+	}
+	if writable {
+		caps.Limits.MaxUploadSize = maxUploadSize(cfg)
+		caps.Limits.MaxConcurrentUploads = maxConcurrentUploads(cfg)
+		caps.Limits.MaxExtractSize = extractLimitsFor(cfg).maxSize
+	}
+	caps.Limits.MaxDownloadSize = cfg.MaxDownloadSize
+	if advanced {
+		caps.Limits.MaxZipSize = constants.MaxZipSize
+	}
+	return caps
+}
+
+// serveCapabilities writes the capabilities document with an ETag so clients
+// can revalidate cheaply.
+func serveCapabilities(w http.ResponseWriter, r *http.Request, cfg *config.Config, fsys internal.FileSystem) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := json.Marshal(buildCapabilities(r, cfg, fsys))
+	if err != nil {
+		http.Error(w, "JSON encoding error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	serveBytes(w, r, body, generateContentETag(string(body)), "application/json")
+}
@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func fetchCapabilities(t *testing.T, h http.Handler, r *http.Request) CapabilitiesResponse {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+	var caps CapabilitiesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return caps
+}
+
+func TestCapabilities_DefaultTheme(t *testing.T) {
+	fs := filesystem.NewLocal(t.TempDir(), false)
+	cfg := &config.Config{Theme: "default", Version: "1.2.3", MaxHashSize: 1 << 20}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewFile(fs, cfg, logger)
+
+	caps := fetchCapabilities(t, h, httptest.NewRequest(http.MethodGet, "/api/capabilities", nil))
+
+	if caps.Version != "1.2.3" {
+		t.Errorf("expected version 1.2.3, got %q", caps.Version)
+	}
+	if caps.Theme != "default" {
+		t.Errorf("expected theme default, got %q", caps.Theme)
+	}
+	if caps.AuthMode != "none" {
+		t.Errorf("expected auth mode none, got %q", caps.AuthMode)
+	}
+	if caps.Features.Upload || caps.Features.Mkdir || caps.Features.Zip || caps.Features.Search {
+		t.Errorf("default theme should not advertise advanced features: %+v", caps.Features)
+	}
+	if caps.Limits.MaxUploadSize != 0 {
+		t.Errorf("expected no upload limit without uploads, got %d", caps.Limits.MaxUploadSize)
+	}
+}
+
+func TestCapabilities_FlagsToggle(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cfg      config.Config
+		readonly bool
+		check    func(t *testing.T, caps CapabilitiesResponse)
+	}{
+		{
+			name: "advanced_writable",
+			cfg:  config.Config{Theme: "advanced"},
+			check: func(t *testing.T, caps CapabilitiesResponse) {
+				if !caps.Features.Upload || !caps.Features.Mkdir || !caps.Features.Zip || !caps.Features.Search {
+					t.Errorf("expected upload, mkdir, zip and search: %+v", caps.Features)
+				}
+				if caps.Limits.MaxUploadSize != constants.DefaultMaxUploadSize {
+					t.Errorf("expected max upload %d, got %d", constants.DefaultMaxUploadSize, caps.Limits.MaxUploadSize)
+				}
+				if caps.Limits.MaxDownloadSize != 0 {
+					t.Errorf("expected downloads to be unlimited, got %d", caps.Limits.MaxDownloadSize)
+				}
+				if caps.Limits.MaxZipSize != constants.MaxZipSize {
+					t.Errorf("expected max zip %d, got %d", constants.MaxZipSize, caps.Limits.MaxZipSize)
+				}
+				if caps.Limits.MaxConcurrentUploads != constants.DefaultMaxConcurrentUploads {
+					t.Errorf("expected %d concurrent uploads, got %d",
+						constants.DefaultMaxConcurrentUploads, caps.Limits.MaxConcurrentUploads)
+				}
+			},
+		},
+		{
+			name: "configured_size_limits",
+			cfg:  config.Config{Theme: "advanced", MaxUploadSize: 2 << 30, MaxDownloadSize: 1 << 30},
+			check: func(t *testing.T, caps CapabilitiesResponse) {
+				if caps.Limits.MaxUploadSize != 2<<30 || caps.Limits.MaxDownloadSize != 1<<30 {
+					t.Errorf("expected the configured limits, got %+v", caps.Limits)
+				}
+			},
+		},
+		{
+			name:     "advanced_readonly_mount",
+			cfg:      config.Config{Theme: "advanced"},
+			readonly: true,
+			check: func(t *testing.T, caps CapabilitiesResponse) {
+				if !caps.Readonly {
+					t.Error("expected readonly to be true")
+				}
+				if caps.Features.Upload || caps.Features.Mkdir {
+					t.Errorf("readonly mount should disable writes: %+v", caps.Features)
+				}
+				if !caps.Features.Zip {
+					t.Error("zip downloads should remain available on readonly mounts")
+				}
+			},
+		},
+		{
+			name: "webdav_and_auth",
+			cfg:  config.Config{Theme: "advanced", EnableWebDAV: true, AuthMode: "write-only"},
+			check: func(t *testing.T, caps CapabilitiesResponse) {
+				if !caps.Features.WebDAV {
+					t.Error("expected webdav to be enabled")
+				}
+				if caps.AuthMode != "write-only" {
+					t.Errorf("expected auth mode write-only, got %q", caps.AuthMode)
+				}
+			},
+		},
+		{
+			name: "tree",
+			cfg:  config.Config{Theme: "advanced", EnableTree: true},
+			check: func(t *testing.T, caps CapabilitiesResponse) {
+				if !caps.Features.Tree {
+					t.Error("expected tree to be enabled")
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), &cfg)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/capabilities", nil)
+			ctx := internal.WithMountInfo(req.Context(), "/data", "Data", tc.readonly)
+			tc.check(t, fetchCapabilities(t, h, req.WithContext(ctx)))
+		})
+	}
+}
+
+func TestCapabilities_ETag(t *testing.T) {
+	cfg := &config.Config{Theme: "advanced"}
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), cfg)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/capabilities", nil))
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected ETag header")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/capabilities", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+
+	cfg.EnableWebDAV = true
+	req = httptest.NewRequest(http.MethodGet, "/api/capabilities", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 after config change, got %d", rr.Code)
+	}
+	if rr.Header().Get("ETag") == etag {
+		t.Error("expected ETag to change when capabilities change")
+	}
+}
+
+func TestCapabilities_Access(t *testing.T) {
+	cfg := &config.Config{Theme: "advanced", Host: "127.0.0.1", Port: 8000}
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), cfg)
+
+	caps := fetchCapabilities(t, h, httptest.NewRequest(http.MethodGet, "/api/capabilities", nil))
+	if !caps.Access.LocalOnly || caps.Access.URLs == nil {
+		t.Errorf("expected a loopback server to be local-only, got %+v", caps.Access)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := rr.Body.String(); !strings.Contains(body, `class="footer-access"`) ||
+		!strings.Contains(body, "--host 0.0.0.0") {
+		t.Error("expected the listing footer to explain how to share the server")
+	}
+}
+
+// renamelessFS is a backend that can write files but not rename them.
+type renamelessFS struct {
+	internal.FileSystem
+}
+
+func (renamelessFS) Capabilities() internal.Capabilities {
+	return internal.Capabilities{CanWrite: true, CanSeek: true, CaseSensitive: true}
+}
+
+func (renamelessFS) Rename(string, string) error {
+	return errors.New("rename not supported")
+}
+
+func TestCapabilities_MatchBackend(t *testing.T) {
+	local := filesystem.NewLocal(t.TempDir(), false)
+	tests := []struct {
+		name     string
+		fs       internal.FileSystem
+		readonly bool
+		move     bool
+		ranges   bool
+	}{
+		{"local", local, false, true, true},
+		{"readonly", filesystem.NewReadonly(local), true, false, true},
+		{"renameless", renamelessFS{local}, false, false, true},
+		{"streaming", streamingFS{local}, false, true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewAdvancedFile(tc.fs, &config.Config{Theme: "advanced"})
+			caps := fetchCapabilities(t, h, httptest.NewRequest(http.MethodGet, "/api/capabilities", nil))
+
+			backend := internal.CapabilitiesOf(tc.fs)
+			if caps.Readonly != tc.readonly || caps.Features.Upload == tc.readonly ||
+				caps.Features.Move != tc.move || caps.Features.Range != tc.ranges ||
+				caps.CaseSensitive != backend.CaseSensitive {
+				t.Errorf("capabilities do not match %+v: readonly %v, %+v", backend, caps.Readonly, caps.Features)
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			if got := strings.Contains(rr.Body.String(), `data-readonly="true"`); got != tc.readonly {
+				t.Errorf("expected the listing to be read-only %v", tc.readonly)
+			}
+		})
+	}
+}
+
+func TestCapabilities_BackendCodePaths(t *testing.T) {
+	t.Run("upload without rename", func(t *testing.T) {
+		root := t.TempDir()
+		h := NewAdvancedFile(renamelessFS{filesystem.NewLocal(root, false)}, &config.Config{Theme: "advanced"})
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, newUploadRequest(t, h, "hello world", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected the upload to be written in place, got %d: %s", rr.Code, rr.Body.String())
+		}
+		entries, _ := os.ReadDir(root)
+		if len(entries) != 1 || entries[0].Name() != "hello.txt" {
+			t.Errorf("expected only hello.txt, got %v", entries)
+		}
+	})
+
+	t.Run("refused writes are 403", func(t *testing.T) {
+		// Without CapabilityReporter the backend looks writable, so only
+		// its errors tell that it is not
+		fs := struct{ internal.FileSystem }{filesystem.NewReadonly(filesystem.NewLocal(t.TempDir(), false))}
+		h := NewAdvancedFile(fs, &config.Config{Theme: "advanced"})
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, newUploadRequest(t, h, "hello world", nil))
+		folder := httptest.NewRequest(http.MethodPost, "/api/folder", strings.NewReader(`{"path":"new"}`))
+		folder.Header.Set("Content-Type", "application/json")
+		folder.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+		rr2 := httptest.NewRecorder()
+		h.ServeHTTP(rr2, folder)
+		for _, rr := range []*httptest.ResponseRecorder{rr, rr2} {
+			if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), ReadonlyErrorCode) {
+				t.Errorf("expected 403 %s, got %d: %s", ReadonlyErrorCode, rr.Code, rr.Body.String())
+			}
+		}
+	})
+}
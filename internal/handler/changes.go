@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// ChangeEntry is one line of the GET /api/changes stream: a file or
+// directory modified after the requested time, or one deleted since the
+// mount's SHA256SUMS manifest was last written.
+type ChangeEntry struct {
+	ModTime *time.Time `json:"modTime,omitempty"`
+	Path    string     `json:"path"` // Slash-separated path within the mount, without a leading slash
+	Size    int64      `json:"size,omitempty"`
+	IsDir   bool       `json:"isDir,omitempty"`
+	Deleted bool       `json:"deleted,omitempty"`
+}
+
+// ChangesTrailer is the last line of the stream. AsOf is only set when the
+// walk completed and is the since value for the next poll.
+type ChangesTrailer struct {
+	AsOf      *time.Time `json:"asOf,omitempty"`
+	Count     int        `json:"count"`
+	Truncated bool       `json:"truncated,omitempty"` // A limit or the deadline stopped the walk
+	Deletions bool       `json:"deletions"`           // Deleted entries are reported
+}
+
+var errChangesLimit = errors.New("change listing limits exceeded")
+
+// serveChanges handles GET /api/changes?path=...&since=RFC3339, streaming the
+// entries below path modified after since as NDJSON.
+func serveChanges(w http.ResponseWriter, r *http.Request, fs internal.FileSystem, cfg *config.Config,
+	reporter middleware.ErrorReporter,
+) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		reporter.JSONError(w, r, "Invalid since, expected an RFC 3339 timestamp", http.StatusBadRequest, err)
+		return
+	}
+
+	dir, err := pathsafe.Clean(r.URL.Query().Get("path"))
+	if err != nil {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	info, err := fs.Stat(dir)
+	if err != nil {
+		reporter.JSONError(w, r, "Directory not found", http.StatusNotFound, err)
+		return
+	}
+	if !info.IsDir() {
+		middleware.WriteJSONError(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	// Taken before walking so changes made during the walk show up again in
+	// the next poll rather than being missed
+	asOf := time.Now().UTC()
+	ctx, cancel := context.WithTimeout(r.Context(), constants.ChangesTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	rc := http.NewResponseController(w)
+
+	trailer := ChangesTrailer{Deletions: cfg.WriteManifests}
+	emit := func(e ChangeEntry) error {
+		if trailer.Count >= constants.MaxChangesEntries {
+			return errChangesLimit
+		}
+		trailer.Count++
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		if trailer.Count%100 == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			_ = rc.Flush()
+		}
+		return nil
+	}
+
+	seen, err := walkChanges(ctx, fs, dir, since, cfg.ShowHidden, emit)
+	if err == nil && cfg.WriteManifests {
+		// No deletions can be reported before the first manifest is written
+		if manifest, openErr := fs.Open(manifestAlgorithms["sha256"].fileName); openErr == nil {
+			err = emitDeletions(manifest, dir, seen, emit)
+			manifest.Close()
+		}
+	}
+	if err == nil {
+		trailer.AsOf = &asOf
+	} else {
+		trailer.Truncated = true
+	}
+	_ = enc.Encode(trailer)
+	_ = bw.Flush()
+}
+
+// walkChanges calls emit for every entry below dir modified after since and
+// returns the paths of all files it saw.
+func walkChanges(ctx context.Context, fs internal.FileSystem, dir string, since time.Time, showHidden bool,
+	emit func(ChangeEntry) error,
+) (map[string]struct{}, error) {
+	seen := make(map[string]struct{})
+	scanned := 0
+	stack := []string{dir}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		files, err := fs.ReadDir(current)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !showHidden && fileutil.IsHiddenPath(path.Join(current, f.Name())) {
+				continue
+			}
+			if scanned++; scanned > constants.MaxChangesScanned {
+				return nil, errChangesLimit
+			}
+			name := path.Join(current, f.Name())
+			if f.IsDir() {
+				stack = append(stack, name)
+			} else {
+				seen[name] = struct{}{}
+			}
+			if !f.ModTime().After(since) {
+				continue
+			}
+			modTime := f.ModTime().UTC()
+			if err := emit(ChangeEntry{Path: name, Size: f.Size(), ModTime: &modTime, IsDir: f.IsDir()}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return seen, nil
+}
+
+// emitDeletions reports the files below dir listed in the mount's SHA256SUMS
+// manifest that no longer exist. The manifest is only rewritten periodically,
+// so a deletion may be reported to more than one poll.
+func emitDeletions(manifest io.Reader, dir string, seen map[string]struct{}, emit func(ChangeEntry) error) error {
+	scanner := bufio.NewScanner(manifest)
+	for scanner.Scan() {
+		_, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || (dir != "" && !strings.HasPrefix(name, dir+"/")) {
+			continue
+		}
+		if _, exists := seen[name]; exists {
+			continue
+		}
+		if err := emit(ChangeEntry{Path: name, Deleted: true}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func getChanges(t *testing.T, h http.Handler, dir, since string) ([]ChangeEntry, ChangesTrailer) {
+	t.Helper()
+
+	query := url.Values{"path": {dir}, "since": {since}}
+	req := httptest.NewRequest(http.MethodGet, "/api/changes?"+query.Encode(), nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(rr.Body.Bytes()))
+	for scanner.Scan() {
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	if len(lines) == 0 {
+		t.Fatal("empty change stream")
+	}
+
+	var trailer ChangesTrailer
+	if err := json.Unmarshal(lines[len(lines)-1], &trailer); err != nil {
+		t.Fatalf("invalid trailer: %v", err)
+	}
+	entries := make([]ChangeEntry, 0, len(lines)-1)
+	for _, line := range lines[:len(lines)-1] {
+		var e ChangeEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("invalid entry %s: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if trailer.Count != len(entries) {
+		t.Errorf("trailer count %d, got %d entries", trailer.Count, len(entries))
+	}
+	return entries, trailer
+}
+
+func changedPaths(entries []ChangeEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Deleted {
+			paths = append(paths, "-"+e.Path)
+		} else {
+			paths = append(paths, e.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func setupChangesTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	writeTestTree(t, root, map[string]string{
+		"a.txt":           "a.txt",
+		"b.txt":           "b.txt",
+		"docs/c.txt":      "docs/c.txt",
+		"docs/deep/d.txt": "docs/deep/d.txt",
+	})
+	for _, name := range []string{"a.txt", "b.txt", "docs/c.txt", "docs/deep/d.txt", "docs/deep", "docs"} {
+		if err := os.Chtimes(filepath.Join(root, name), old, old); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+	return root
+}
+
+func touchFile(t *testing.T, name string, content string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+func TestChanges_OnlyModifiedEntries(t *testing.T) {
+	handlers := map[string]func(fs *filesystem.Local) http.Handler{
+		"advanced": func(fs *filesystem.Local) http.Handler {
+			return NewAdvancedFile(fs, &config.Config{Theme: "advanced"})
+		},
+		"default": func(fs *filesystem.Local) http.Handler {
+			return NewFile(fs, &config.Config{Theme: "default"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		},
+	}
+
+	for name, newHandler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			root := setupChangesTree(t)
+			h := newHandler(filesystem.NewLocal(root, false))
+
+			entries, trailer := getChanges(t, h, "", "2000-01-01T00:00:00Z")
+			if len(entries) != 6 || trailer.AsOf == nil || trailer.Truncated {
+				t.Fatalf("initial sync: got %v, trailer %+v", changedPaths(entries), trailer)
+			}
+
+			asOf := trailer.AsOf.Format(time.RFC3339Nano)
+			entries, trailer = getChanges(t, h, "", asOf)
+			if len(entries) != 0 {
+				t.Errorf("nothing changed, got %v", changedPaths(entries))
+			}
+
+			later := trailer.AsOf.Add(time.Second)
+			touchFile(t, filepath.Join(root, "b.txt"), "changed "+name, later)
+			touchFile(t, filepath.Join(root, "docs", "deep", "d.txt"), "changed "+name, later)
+
+			entries, _ = getChanges(t, h, "", asOf)
+			if got := changedPaths(entries); strings.Join(got, ",") != "b.txt,docs/deep/d.txt" {
+				t.Errorf("expected only the modified files, got %v", got)
+			}
+			if entries[0].ModTime == nil || entries[0].Size == 0 {
+				t.Errorf("expected size and modTime, got %+v", entries[0])
+			}
+
+			entries, _ = getChanges(t, h, "docs", asOf)
+			if got := changedPaths(entries); strings.Join(got, ",") != "docs/deep/d.txt" {
+				t.Errorf("expected changes below docs only, got %v", got)
+			}
+		})
+	}
+}
+
+func TestChanges_Deletions(t *testing.T) {
+	root := setupChangesTree(t)
+	fs := filesystem.NewLocal(root, false)
+	cfg := &config.Config{Theme: "advanced", WriteManifests: true}
+	h := NewAdvancedFile(fs, cfg)
+
+	_, trailer := getChanges(t, h, "", time.Now().Format(time.RFC3339))
+	if !trailer.Deletions {
+		t.Error("expected deletions to be tracked with --write-manifests")
+	}
+
+	writer := NewManifestWriter(fs, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), time.Hour)
+	if err := writer.WriteOnce(context.Background()); err != nil {
+		t.Fatalf("WriteOnce: %v", err)
+	}
+	since := time.Now().Add(time.Minute).Format(time.RFC3339)
+	if err := os.Remove(filepath.Join(root, "docs", "c.txt")); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	entries, _ := getChanges(t, h, "", since)
+	if got := changedPaths(entries); strings.Join(got, ",") != "-docs/c.txt" {
+		t.Errorf("expected the deleted file, got %v", got)
+	}
+	entries, _ = getChanges(t, h, "docs/deep", since)
+	if len(entries) != 0 {
+		t.Errorf("deletion outside the requested path reported: %v", changedPaths(entries))
+	}
+}
+
+func TestChanges_InvalidRequests(t *testing.T) {
+	root := setupChangesTree(t)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"missing since", "path=docs", http.StatusBadRequest},
+		{"invalid since", "since=yesterday", http.StatusBadRequest},
+		{"date only", "since=2024-01-01", http.StatusBadRequest},
+		{"file path", "path=a.txt&since=2024-01-01T00:00:00Z", http.StatusBadRequest},
+		{"missing path", "path=nope&since=2024-01-01T00:00:00Z", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/changes?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/changes?since=2024-01-01T00:00:00Z", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected 405, got %d", rr.Code)
+	}
+}
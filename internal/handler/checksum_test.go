@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+const (
+	helloSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	helloMD5    = "5eb63bbbe01eeed093cb22bb8f5acdc3"
+)
+
+// newUploadRequest builds a CSRF-authorized multipart upload of content.
+func newUploadRequest(t *testing.T, h *AdvancedFile, content string, fields map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatalf("Failed to write field: %v", err)
+		}
+	}
+	fw, err := mw.CreateFormFile("file", "hello.txt")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	_, _ = fw.Write([]byte(content))
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Failed to close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	return req
+}
+
+func TestAdvancedFile_UploadChecksum(t *testing.T) {
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		fields       map[string]string
+		wantStatus   int
+		wantChecksum string
+		wantFile     bool
+	}{
+		{
+			name:       "no checksum skips verification",
+			wantStatus: http.StatusOK,
+			wantFile:   true,
+		},
+		{
+			name:         "sha256 header matches",
+			headers:      map[string]string{ChecksumSHA256Header: helloSHA256},
+			wantStatus:   http.StatusOK,
+			wantChecksum: "sha256:" + helloSHA256,
+			wantFile:     true,
+		},
+		{
+			name:         "md5 form field matches",
+			fields:       map[string]string{"checksum": "md5:" + strings.ToUpper(helloMD5)},
+			wantStatus:   http.StatusOK,
+			wantChecksum: "md5:" + helloMD5,
+			wantFile:     true,
+		},
+		{
+			name:       "sha256 header mismatch",
+			headers:    map[string]string{ChecksumSHA256Header: strings.Repeat("0", 64)},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "md5 header mismatch",
+			headers:    map[string]string{ChecksumMD5Header: strings.Repeat("a", 32)},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "malformed digest",
+			headers:    map[string]string{ChecksumSHA256Header: "not-hex"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unsupported algorithm",
+			fields:     map[string]string{"checksum": "crc32:0a0b0c0d"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "advanced", RequestTimeout: 30}
+			h := NewAdvancedFile(filesystem.NewLocal(dir, false), cfg)
+
+			req := newUploadRequest(t, h, "hello world", tt.fields)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+
+			_, err := os.Stat(filepath.Join(dir, "hello.txt"))
+			if exists := err == nil; exists != tt.wantFile {
+				t.Errorf("expected file exists=%v, got %v", tt.wantFile, exists)
+			}
+
+			// Temporary upload files must never be left behind
+			entries, _ := os.ReadDir(dir)
+			for _, e := range entries {
+				if strings.Contains(e.Name(), ".upload-") {
+					t.Errorf("temporary file %q left behind", e.Name())
+				}
+			}
+
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var resp UploadResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Checksum != tt.wantChecksum {
+				t.Errorf("expected checksum %q, got %q", tt.wantChecksum, resp.Checksum)
+			}
+		})
+	}
+}
+
+func TestAdvancedFile_UploadChecksumMismatchKeepsExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "hello.txt")
+	if err := os.WriteFile(existing, []byte("original"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "advanced", RequestTimeout: 30}
+	h := NewAdvancedFile(filesystem.NewLocal(dir, false), cfg)
+
+	req := newUploadRequest(t, h, "hello world", nil)
+	req.Header.Set(ChecksumSHA256Header, strings.Repeat("0", 64))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rr.Code)
+	}
+	content, err := os.ReadFile(existing)
+	if err != nil || string(content) != "original" {
+		t.Errorf("expected existing file untouched, got %q (%v)", content, err)
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/listing"
+)
+
+// childCount is the number of entries a listing of a directory holds, as
+// counted when the directory had modTime.
+type childCount struct {
+	modTime time.Time
+	n       int
+	capped  bool // More than n entries
+}
+
+// childCounter counts the children of the directories of a listing. Counts
+// are kept until the directory's mtime changes, which adding, removing or
+// renaming an entry does. They are taken without credentials, so every
+// client is shown the same numbers and directories .gofs.yaml protects are
+// not counted at all. Backends without CheapListing, such as remote mounts,
+// are not counted either: it would cost a request per subdirectory.
+type childCounter struct {
+	fs      internal.FileSystem
+	opts    listing.Options
+	flights *coalescer // Merges concurrent counts of the same directory; may be nil
+	off     bool       // The backend is too slow to list to count
+
+	mu     sync.Mutex
+	counts map[string]childCount // directory -> count
+}
+
+func newChildCounter(fs internal.FileSystem, cfg *config.Config, flights *coalescer) *childCounter {
+	return &childCounter{
+		fs:      fs,
+		opts:    listingOptions(cfg),
+		flights: flights,
+		off:     !internal.CapabilitiesOf(fs).CheapListing,
+		counts:  make(map[string]childCount),
+	}
+}
+
+// count returns the children of the directory entry e of dir. ok is false
+// if they cannot be read or are not counted.
+func (c *childCounter) count(dir string, e listing.Entry) (n int, capped, ok bool) {
+	if c.off {
+		return 0, false, false
+	}
+	name := path.Join(dir, e.Name)
+	c.mu.Lock()
+	cached, found := c.counts[name]
+	c.mu.Unlock()
+	if found && cached.modTime.Equal(e.ModTime) {
+		return cached.n, cached.capped, true
+	}
+
+	counted, err := coalesce(c.flights, coalesceChildCount, coalesceKey(coalesceChildCount, name, e.ModTime),
+		func() (childCount, error) {
+			n, capped, err := listing.Count(c.fs, name, c.opts, constants.MaxChildCount)
+			return childCount{modTime: e.ModTime, n: n, capped: capped}, err
+		})
+	if err != nil {
+		return 0, false, false
+	}
+	n, capped = counted.n, counted.capped
+	c.mu.Lock()
+	if len(c.counts) >= constants.ChildCountCacheSize {
+		clear(c.counts)
+	}
+	c.counts[name] = counted
+	c.mu.Unlock()
+	return n, capped, true
+}
+
+// childCountJSON returns the childCount and childCountTruncated fields of
+// a listing entry, or nil for a file or a directory not counted.
+func (c *childCounter) childCountJSON(dir string, e listing.Entry) (*int, bool) {
+	if !e.IsDir {
+		return nil, false
+	}
+	n, capped, ok := c.count(dir, e)
+	if !ok {
+		return nil, false
+	}
+	return &n, capped
+}
+
+// formatChildCount renders the children of a directory entry for the HTML
+// listings, e.g. "3 items" or "1000+ items", or "" for a file or a
+// directory not counted.
+func (c *childCounter) formatChildCount(dir string, e listing.Entry) string {
+	if !e.IsDir {
+		return ""
+	}
+	n, capped, ok := c.count(dir, e)
+	switch {
+	case !ok:
+		return ""
+	case capped:
+		return strconv.Itoa(n) + "+ items"
+	case n == 1:
+		return "1 item"
+	}
+	return strconv.Itoa(n) + " items"
+}
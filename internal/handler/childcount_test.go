@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+type childCountItem struct {
+	Name      string `json:"name"`
+	Count     *int   `json:"childCount"`
+	Truncated bool   `json:"childCountTruncated"`
+}
+
+func listChildCounts(t *testing.T, h http.Handler) map[string]childCountItem {
+	t.Helper()
+	rr := getPath(h, "/", http.Header{"Accept": {"application/json"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Files []childCountItem `json:"files"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	items := map[string]childCountItem{}
+	for _, f := range resp.Files {
+		items[f.Name] = f
+	}
+	return items
+}
+
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDirectoryJSON_ChildCount(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, filepath.Join(root, "one"), "a.txt", ".hidden")
+	writeFiles(t, filepath.Join(root, "empty"))
+	writeFiles(t, root, "file.txt")
+	many := make([]string, constants.MaxChildCount+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("f%04d", i)
+	}
+	writeFiles(t, filepath.Join(root, "many"), many...)
+
+	fs := filesystem.NewLocal(root, false)
+	handlers := map[string]http.Handler{
+		"advanced": NewAdvancedFile(fs, &config.Config{Theme: "advanced"}),
+		"default":  NewFile(fs, &config.Config{Theme: "default"}, slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}
+	for name, h := range handlers {
+		t.Run(name, func(t *testing.T) {
+			items := listChildCounts(t, h)
+			for dir, want := range map[string]int{"one": 1, "empty": 0, "many": constants.MaxChildCount} {
+				got := items[dir]
+				if got.Count == nil || *got.Count != want || got.Truncated != (dir == "many") {
+					t.Errorf("%s: expected %d (truncated %v), got %+v", dir, want, dir == "many", got)
+				}
+			}
+			if items["file.txt"].Count != nil {
+				t.Errorf("file.txt: expected no childCount, got %d", *items["file.txt"].Count)
+			}
+
+			page := html.UnescapeString(getPath(h, "/", nil).Body.String())
+			for _, want := range []string{"1 item", "0 items", fmt.Sprintf("%d+ items", constants.MaxChildCount)} {
+				if !strings.Contains(page, want) {
+					t.Errorf("Expected the HTML listing to show %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestDirectoryJSON_ChildCountCache(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "dir")
+	writeFiles(t, dir, "a.txt")
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(dir, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	if got := listChildCounts(t, h)["dir"].Count; got == nil || *got != 1 {
+		t.Fatalf("Expected 1 child, got %v", got)
+	}
+
+	// A count is kept as long as the directory's mtime is unchanged
+	writeFiles(t, dir, "b.txt")
+	if err := os.Chtimes(dir, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if got := listChildCounts(t, h)["dir"].Count; got == nil || *got != 1 {
+		t.Errorf("Expected the cached count 1, got %v", got)
+	}
+
+	later := modTime.Add(time.Minute)
+	if err := os.Chtimes(dir, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := listChildCounts(t, h)["dir"].Count; got == nil || *got != 2 {
+		t.Errorf("Expected a recount of 2 after the mtime changed, got %v", got)
+	}
+}
+
+func TestDirectoryJSON_ChildCountRemote(t *testing.T) {
+	remote := remoteGofsHandler(t)
+	var mu sync.Mutex
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		remote.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	mount, err := config.ParseDir("/hostA=" + srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, theme := range []string{"default", "advanced"} {
+		t.Run(theme, func(t *testing.T) {
+			h := NewMultiDir([]config.DirMount{mount}, &config.Config{Theme: theme, RequestTimeout: 30}, logger)
+			rr := getPath(h, "/hostA/", http.Header{"Accept": {"application/json"}})
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if strings.Contains(rr.Body.String(), "childCount") {
+				t.Errorf("Expected no child counts for a remote mount, got %s", rr.Body.String())
+			}
+			getPath(h, "/hostA/", nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range requested {
+				if strings.HasPrefix(p, "/docs") {
+					t.Errorf("Expected the subdirectory not to be listed to count it, got a request for %s", p)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Operations whose concurrent duplicates a coalescer merges.
+const (
+	coalesceETag       = "etag"
+	coalesceManifest   = "manifest"
+	coalesceChildCount = "childCount"
+)
+
+// CoalesceStats counts how often an operation was computed and how many
+// callers were handed the result of a computation another caller started.
+type CoalesceStats struct {
+	Runs   int64 `json:"runs"`
+	Shared int64 `json:"shared"`
+}
+
+// coalescer makes concurrent callers asking for the same result share one
+// computation: the first runs it and the others wait for its result.
+// Nothing is kept once the computation returns; callers that want results
+// to outlive it cache them themselves.
+type coalescer struct {
+	mu     sync.Mutex
+	calls  map[string]*coalescedCall
+	counts map[string]*CoalesceStats // operation -> counts
+}
+
+// errCoalescePanic is what callers waiting on a computation that panicked
+// get.
+var errCoalescePanic = errors.New("coalesced computation panicked")
+
+type coalescedCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{calls: make(map[string]*coalescedCall), counts: make(map[string]*CoalesceStats)}
+}
+
+// coalesceKey identifies the result of op for the file or directory path as
+// it was at modTime, so a change to it starts a new computation.
+func coalesceKey(op, path string, modTime time.Time, extra ...any) string {
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%v", op, path, modTime.UnixNano(), extra)
+}
+
+// coalesce returns fn's result, running fn unless a computation for key is
+// in progress. A nil c runs fn directly.
+func coalesce[T any](c *coalescer, op, key string, fn func() (T, error)) (T, error) {
+	if c == nil {
+		return fn()
+	}
+	c.mu.Lock()
+	stats := c.counts[op]
+	if stats == nil {
+		stats = &CoalesceStats{}
+		c.counts[op] = stats
+	}
+	if call, ok := c.calls[key]; ok {
+		stats.Shared++
+		c.mu.Unlock()
+		<-call.done
+		value, _ := call.value.(T)
+		return value, call.err
+	}
+	call := &coalescedCall{done: make(chan struct{}), err: errCoalescePanic}
+	c.calls[key] = call
+	stats.Runs++
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	value, err := fn()
+	call.value, call.err = value, err
+	return value, err
+}
+
+// Stats returns the counts of every operation run so far.
+func (c *coalescer) Stats() map[string]CoalesceStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make(map[string]CoalesceStats, len(c.counts))
+	for op, s := range c.counts {
+		stats[op] = *s
+	}
+	return stats
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// slowHashFS holds every read until release is closed and counts the bytes
+// read, so a test can tell how often files were hashed.
+type slowHashFS struct {
+	internal.FileSystem
+	release chan struct{}
+	read    atomic.Int64
+}
+
+type slowHashFile struct {
+	io.ReadSeekCloser
+	fs *slowHashFS
+}
+
+func (f *slowHashFile) Read(p []byte) (int, error) {
+	<-f.fs.release
+	n, err := f.ReadSeekCloser.Read(p)
+	f.fs.read.Add(int64(n))
+	return n, err
+}
+
+func (s *slowHashFS) Open(name string) (io.ReadCloser, error) {
+	return s.OpenSeeker(name)
+}
+
+func (s *slowHashFS) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	file, err := internal.OpenSeeker(s.FileSystem, name)
+	if err != nil {
+		return nil, err
+	}
+	return &slowHashFile{ReadSeekCloser: file, fs: s}, nil
+}
+
+// startConcurrent sends n requests for target to h at once, waits until all
+// of them reached the coalescer for op, releases fs and returns the
+// responses.
+func startConcurrent(t *testing.T, h *AdvancedFile, fs *slowHashFS, op, method, target string,
+	n int,
+) []*httptest.ResponseRecorder {
+	t.Helper()
+	responses := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = httptest.NewRecorder()
+			h.ServeHTTP(responses[i], httptest.NewRequest(method, target, nil))
+		}()
+	}
+	waitFor(t, "every request to join", func() bool {
+		s := h.flights.Stats()[op]
+		return s.Runs+s.Shared == int64(n)
+	})
+	close(fs.release)
+	wg.Wait()
+	return responses
+}
+
+func TestCoalesce(t *testing.T) {
+	c := newCoalescer()
+	release := make(chan struct{})
+	var runs atomic.Int32
+	results := make([]int, 10)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = coalesce(c, "op", "key", func() (int, error) {
+				runs.Add(1)
+				<-release
+				return 42, nil
+			})
+		}()
+	}
+	waitFor(t, "every caller to join", func() bool { return c.Stats()["op"].Runs+c.Stats()["op"].Shared == 10 })
+	close(release)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("Expected one run, got %d", runs.Load())
+	}
+	for i, got := range results {
+		if got != 42 {
+			t.Errorf("Caller %d got %d", i, got)
+		}
+	}
+	if got := c.Stats()["op"]; got != (CoalesceStats{Runs: 1, Shared: 9}) {
+		t.Errorf("Unexpected stats %+v", got)
+	}
+
+	// Nothing is kept once the computation returns
+	if got, _ := coalesce(c, "op", "key", func() (int, error) { return 7, nil }); got != 7 {
+		t.Errorf("Expected a new run, got %d", got)
+	}
+	if got, err := coalesce(nil, "op", "key", func() (int, error) { return 1, errors.New("x") }); got != 1 || err == nil {
+		t.Errorf("Expected a nil coalescer to run fn, got %d %v", got, err)
+	}
+}
+
+func TestAdvancedFile_ETagCoalesced(t *testing.T) {
+	root := t.TempDir()
+	content := strings.Repeat("x", 64<<10)
+	if err := os.WriteFile(filepath.Join(root, "big.txt"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := &slowHashFS{FileSystem: filesystem.NewLocal(root, false), release: make(chan struct{})}
+	h := NewAdvancedFile(fs, &config.Config{Theme: "advanced", MaxHashSize: 1 << 20})
+
+	const n = 10
+	responses := startConcurrent(t, h, fs, coalesceETag, http.MethodHead, "/big.txt", n)
+	etag := responses[0].Header().Get("ETag")
+	for i, rr := range responses {
+		if rr.Code != http.StatusOK || rr.Header().Get("ETag") != etag || etag == "" {
+			t.Errorf("Response %d: %d with ETag %q, expected 200 with %q", i, rr.Code, rr.Header().Get("ETag"), etag)
+		}
+	}
+	if got := fs.read.Load(); got != int64(len(content)) {
+		t.Errorf("Expected the file to be hashed once (%d bytes), read %d bytes", len(content), got)
+	}
+
+	rr := getPath(h, "/api/stats", nil)
+	var stats StatsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Invalid stats %s: %v", rr.Body.String(), err)
+	}
+	if got := stats.Coalesced[coalesceETag]; got != (CoalesceStats{Runs: 1, Shared: n - 1}) {
+		t.Errorf("Expected 1 run and %d shared in /api/stats, got %+v", n-1, got)
+	}
+}
+
+func TestAdvancedFile_ManifestCoalesced(t *testing.T) {
+	root := t.TempDir()
+	writeDiffTree(t, filepath.Join(root, "dir"), map[string]string{"a.txt": "aaaa", "sub/b.txt": "bb"})
+	fs := &slowHashFS{FileSystem: filesystem.NewLocal(root, false), release: make(chan struct{})}
+	h := NewAdvancedFile(fs, &config.Config{Theme: "advanced"})
+
+	responses := startConcurrent(t, h, fs, coalesceManifest, http.MethodGet, "/api/manifest?path=/dir", 8)
+	for i, rr := range responses {
+		if rr.Code != http.StatusOK || rr.Body.String() != responses[0].Body.String() {
+			t.Errorf("Response %d: %d %q", i, rr.Code, rr.Body.String())
+		}
+	}
+	if got := fs.read.Load(); got != 6 {
+		t.Errorf("Expected every file to be hashed once (6 bytes), read %d bytes", got)
+	}
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/listing"
+	"github.com/samzong/gofs/internal/tracing"
+)
+
+// checkConditions evaluates the conditional headers of r against the current
+// representation, identified by etag and, unless zero, modTime. They are
+// taken in the order of RFC 9110 section 13.2.2: If-Match, then
+// If-Unmodified-Since, If-None-Match, then If-Modified-Since, and last
+// If-Range. It sets ETag and Last-Modified, and answers 412 or 304 and
+// returns serve false when the request must not be served. Otherwise
+// rangeOK reports whether a Range header may be honored.
+func checkConditions(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) (rangeOK, serve bool) {
+	// HTTP dates have whole seconds
+	modTime = modTime.Truncate(time.Second)
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" {
+		if !etagMatches(match, etag, true) {
+			http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+			return false, false
+		}
+	} else if since, ok := headerTime(r, "If-Unmodified-Since"); ok && !modTime.IsZero() && modTime.After(since) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return false, false
+	}
+
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if etagMatches(match, etag, false) {
+			if safe {
+				writeNotModified(w)
+			} else {
+				http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+			}
+			return false, false
+		}
+	} else if since, ok := headerTime(r, "If-Modified-Since"); ok && safe && !modTime.IsZero() &&
+		!modTime.After(since) {
+		writeNotModified(w)
+		return false, false
+	}
+
+	ifRange := strings.TrimSpace(r.Header.Get("If-Range"))
+	switch {
+	case ifRange == "":
+		return true, true
+	case strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/"):
+		return etagMatches(ifRange, etag, true), true
+	default:
+		// A date only validates the range if it is exactly the current one
+		since, err := http.ParseTime(ifRange)
+		return err == nil && !modTime.IsZero() && modTime.Equal(since), true
+	}
+}
+
+// checkListingConditions sets the validators of the JSON listing l and
+// evaluates the conditional headers of r against them. It returns false when
+// the listing must not be rendered.
+func checkListingConditions(w http.ResponseWriter, r *http.Request, l *listing.DirectoryListing) bool {
+	// Listings change without notice, so caches must revalidate every use
+	w.Header().Set("Cache-Control", "no-cache")
+	_, serve := checkConditions(w, r, l.ETag(), time.Time{})
+	return serve
+}
+
+// writeNotModified answers 304. It carries the validators and caching
+// headers already set, but nothing that describes a body.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	for _, name := range []string{
+		"Content-Type", "Content-Length", "Content-Range", "Content-Encoding", "Content-Disposition",
+	} {
+		h.Del(name)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// serveBytes answers GET and HEAD with a body generated in memory,
+// revalidated against etag. HEAD gets the Content-Length the GET would.
+func serveBytes(w http.ResponseWriter, r *http.Request, body []byte, etag, contentType string) {
+	if _, serve := checkConditions(w, r, etag, time.Time{}); !serve {
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// etagMatches reports whether the If-Match, If-None-Match or If-Range value
+// header lists etag. strong uses the strong comparison, under which weak tags
+// never match; "*" matches any current representation.
+func etagMatches(header, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong {
+			if candidate == etag && !strings.HasPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func headerTime(r *http.Request, name string) (time.Time, bool) {
+	value := r.Header.Get(name)
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
+
+// fileETag returns the ETag of the file at path. Files from the hot cache
+// come with theirs; other seekable files up to maxSize get a hash of their
+// content, since hashing reads the whole file, and the rest one derived from
+// path, size and modification time.
+func fileETag(ctx context.Context, file io.ReadSeeker, path string, info internal.FileInfo, maxSize int64,
+	flights *coalescer, logger *slog.Logger,
+) string {
+	if tagged, ok := file.(internal.ETagger); ok {
+		return tagged.ETag()
+	}
+	if internal.Seekable(file) && info.Size() <= maxSize {
+		// Concurrent requests for the same version of the file share one hash
+		key := coalesceKey(coalesceETag, path, info.ModTime(), info.Size())
+		etag, err := coalesce(flights, coalesceETag, key, func() (string, error) {
+			_, span := tracing.Start(ctx, "hash")
+			defer span.End()
+			span.SetAttr("gofs.path", "/"+path)
+			span.SetAttr("gofs.size", info.Size())
+			etag, err := contentETag(file)
+			span.RecordError(err)
+			return etag, err
+		})
+		if err == nil {
+			return etag
+		}
+		logger.Warn("Failed to generate content-based ETag",
+			slog.String("path", path),
+			slog.String("error", err.Error()),
+		)
+	}
+	return fmt.Sprintf(`"gofs-%x-%x-%x"`, []byte(path), info.Size(), info.ModTime().Unix())
+}
+
+// contentETag hashes the whole of file, leaving its offset where it was.
+func contentETag(file io.ReadSeeker) (string, error) {
+	currentPos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+
+	if _, err := file.Seek(currentPos, io.SeekStart); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(hasher.Sum(nil)) + `"`, nil
+}
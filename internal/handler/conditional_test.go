@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// TestConditionalRequests follows the precedence of RFC 9110 section 13.2.2
+// on both themes and both serving paths. "{etag}" in a header stands for the
+// file's current ETag.
+func TestConditionalRequests(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "data.txt")
+	if err := os.WriteFile(name, []byte("0123456789"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	local := filesystem.NewLocal(root, false)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	at := modTime.Format(http.TimeFormat)
+	before := modTime.Add(-time.Hour).Format(http.TimeFormat)
+	after := modTime.Add(time.Hour).Format(http.TimeFormat)
+
+	testCases := []struct {
+		name      string
+		headers   map[string]string
+		wantCode  int
+		wantBody  string
+		wantRange string
+	}{
+		{name: "unconditional", wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "range", headers: map[string]string{"Range": "bytes=0-3"},
+			wantCode: http.StatusPartialContent, wantBody: "0123", wantRange: "bytes 0-3/10"},
+		{name: "unsatisfiable range", headers: map[string]string{"Range": "bytes=20-"},
+			wantCode: http.StatusRequestedRangeNotSatisfiable, wantRange: "bytes */10"},
+
+		// If-Match uses the strong comparison and takes precedence over If-Unmodified-Since
+		{name: "if-match current", headers: map[string]string{"If-Match": "{etag}", "Range": "bytes=0-3"},
+			wantCode: http.StatusPartialContent, wantBody: "0123", wantRange: "bytes 0-3/10"},
+		{name: "if-match list", headers: map[string]string{"If-Match": `"other", {etag}`},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-match any", headers: map[string]string{"If-Match": "*"},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-match stale", headers: map[string]string{"If-Match": `"other"`, "Range": "bytes=0-3"},
+			wantCode: http.StatusPreconditionFailed},
+		{name: "if-match weak", headers: map[string]string{"If-Match": "W/{etag}"},
+			wantCode: http.StatusPreconditionFailed},
+		{name: "if-match overrides if-unmodified-since",
+			headers:  map[string]string{"If-Match": "{etag}", "If-Unmodified-Since": before},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-unmodified-since at", headers: map[string]string{"If-Unmodified-Since": at},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-unmodified-since before", headers: map[string]string{"If-Unmodified-Since": before},
+			wantCode: http.StatusPreconditionFailed},
+
+		// If-None-Match uses the weak comparison and is evaluated before Range
+		{name: "if-none-match current", headers: map[string]string{"If-None-Match": "{etag}"},
+			wantCode: http.StatusNotModified},
+		{name: "if-none-match with range", headers: map[string]string{"If-None-Match": "{etag}", "Range": "bytes=0-3"},
+			wantCode: http.StatusNotModified},
+		{name: "if-none-match with unsatisfiable range",
+			headers:  map[string]string{"If-None-Match": "{etag}", "Range": "bytes=20-"},
+			wantCode: http.StatusNotModified},
+		{name: "if-none-match weak", headers: map[string]string{"If-None-Match": `"other", W/{etag}`},
+			wantCode: http.StatusNotModified},
+		{name: "if-none-match any", headers: map[string]string{"If-None-Match": "*"},
+			wantCode: http.StatusNotModified},
+		{name: "if-none-match stale with range", headers: map[string]string{"If-None-Match": `"other"`, "Range": "bytes=0-3"},
+			wantCode: http.StatusPartialContent, wantBody: "0123", wantRange: "bytes 0-3/10"},
+		{name: "if-none-match overrides if-modified-since",
+			headers:  map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": after},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-modified-since at", headers: map[string]string{"If-Modified-Since": at, "Range": "bytes=0-3"},
+			wantCode: http.StatusNotModified},
+		{name: "if-modified-since before", headers: map[string]string{"If-Modified-Since": before},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-modified-since invalid", headers: map[string]string{"If-Modified-Since": "yesterday"},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+
+		// If-Range only decides whether Range is honored
+		{name: "if-range current", headers: map[string]string{"If-Range": "{etag}", "Range": "bytes=4-"},
+			wantCode: http.StatusPartialContent, wantBody: "456789", wantRange: "bytes 4-9/10"},
+		{name: "if-range stale", headers: map[string]string{"If-Range": `"other"`, "Range": "bytes=4-"},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-range weak", headers: map[string]string{"If-Range": "W/{etag}", "Range": "bytes=4-"},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-range date", headers: map[string]string{"If-Range": at, "Range": "bytes=4-"},
+			wantCode: http.StatusPartialContent, wantBody: "456789", wantRange: "bytes 4-9/10"},
+		{name: "if-range old date", headers: map[string]string{"If-Range": before, "Range": "bytes=4-"},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "if-range stale with unsatisfiable range",
+			headers:  map[string]string{"If-Range": `"other"`, "Range": "bytes=20-"},
+			wantCode: http.StatusOK, wantBody: "0123456789"},
+	}
+
+	for _, theme := range []string{"default", "advanced"} {
+		for _, fs := range []struct {
+			name string
+			fs   internal.FileSystem
+		}{{"sendfile", local}, {"copying", copyingFS{local}}} {
+			cfg := &config.Config{Theme: theme, MaxHashSize: 1 << 20}
+			var h http.Handler = NewFile(fs.fs, cfg, logger)
+			if theme == "advanced" {
+				h = NewAdvancedFile(fs.fs, cfg)
+			}
+			serve := func(headers map[string]string, etag string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/data.txt", nil)
+				for k, v := range headers {
+					req.Header.Set(k, strings.ReplaceAll(v, "{etag}", etag))
+				}
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+				return rr
+			}
+
+			first := serve(nil, "")
+			etag := first.Header().Get("ETag")
+			if etag == "" || first.Header().Get("Last-Modified") != at {
+				t.Fatalf("%s/%s: expected validators, got ETag %q and Last-Modified %q",
+					theme, fs.name, etag, first.Header().Get("Last-Modified"))
+			}
+
+			for _, tc := range testCases {
+				t.Run(theme+"/"+fs.name+"/"+tc.name, func(t *testing.T) {
+					rr := serve(tc.headers, etag)
+					if rr.Code != tc.wantCode {
+						t.Fatalf("expected %d, got %d: %s", tc.wantCode, rr.Code, rr.Body.String())
+					}
+					if got := rr.Header().Get("Content-Range"); got != tc.wantRange {
+						t.Errorf("expected Content-Range %q, got %q", tc.wantRange, got)
+					}
+					if tc.wantBody != "" && rr.Body.String() != tc.wantBody {
+						t.Errorf("expected body %q, got %q", tc.wantBody, rr.Body.String())
+					}
+					if rr.Code == http.StatusNotModified {
+						if rr.Body.Len() != 0 || rr.Header().Get("Content-Type") != "" {
+							t.Errorf("304 describes a body: %v", rr.Header())
+						}
+						if rr.Header().Get("ETag") != etag {
+							t.Errorf("304 without the current ETag: %v", rr.Header())
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestListingConditionalRequests(t *testing.T) {
+	for _, theme := range []string{"default", "advanced"} {
+		t.Run(theme, func(t *testing.T) {
+			root := t.TempDir()
+			name := filepath.Join(root, "data.txt")
+			if err := os.WriteFile(name, []byte("0123456789"), 0o644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			cfg := &config.Config{Theme: theme}
+			var h http.Handler = NewFile(filesystem.NewLocal(root, false), cfg,
+				slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if theme == "advanced" {
+				h = NewAdvancedFile(filesystem.NewLocal(root, false), cfg)
+			}
+			poll := func(etag string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("Accept", "application/json")
+				if etag != "" {
+					req.Header.Set("If-None-Match", etag)
+				}
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+				return rr
+			}
+
+			first := poll("")
+			etag := first.Header().Get("ETag")
+			if first.Code != http.StatusOK || etag == "" || first.Header().Get("Cache-Control") != "no-cache" {
+				t.Fatalf("expected a listing with an ETag, got %d %v", first.Code, first.Header())
+			}
+			for range 2 {
+				if rr := poll(etag); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+					t.Fatalf("expected 304 for an unchanged listing, got %d %s", rr.Code, rr.Body.String())
+				}
+			}
+
+			// Rewriting a file changes its modification time but not the directory's
+			later := time.Now().Add(time.Minute)
+			if err := os.Chtimes(name, later, later); err != nil {
+				t.Fatalf("Chtimes: %v", err)
+			}
+			rr := poll(etag)
+			if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "data.txt") {
+				t.Fatalf("expected the changed listing, got %d %s", rr.Code, rr.Body.String())
+			}
+			if got := rr.Header().Get("ETag"); got == "" || got == etag {
+				t.Errorf("expected a new ETag, got %q", got)
+			}
+
+			// HTML listings are not affected
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+			html := httptest.NewRecorder()
+			h.ServeHTTP(html, req)
+			if html.Code != http.StatusOK || html.Header().Get("ETag") != "" {
+				t.Errorf("expected the HTML listing without validators, got %d %v", html.Code, html.Header())
+			}
+		})
+	}
+}
+
+// TestResponseHeaderCombinations records the raw headers of 304, HEAD and 206
+// responses and checks them against RFC 9110: a 304 describes no body, a
+// HEAD has the headers of the GET, and a 206 has a Content-Range whose
+// length is its Content-Length.
+func TestResponseHeaderCombinations(t *testing.T) {
+	root := t.TempDir()
+	content := strings.Repeat("0123456789", 100)
+	for name, data := range map[string]string{"data.txt": content, "app.js": "console.log(1)", "app.js.gz": "gz"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	local := filesystem.NewLocal(root, false)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bodyHeaders := []string{"Content-Type", "Content-Length", "Content-Range", "Content-Encoding", "Content-Disposition"}
+
+	for name, h := range map[string]http.Handler{
+		"default/sendfile":  NewFile(local, &config.Config{Theme: "default", MaxHashSize: 1 << 20}, logger),
+		"default/copying":   NewFile(copyingFS{local}, &config.Config{Theme: "default", MaxHashSize: 1 << 20}, logger),
+		"advanced/sendfile": NewAdvancedFile(local, &config.Config{Theme: "advanced", MaxHashSize: 1 << 20}),
+		"advanced/copying":  NewAdvancedFile(copyingFS{local}, &config.Config{Theme: "advanced", MaxHashSize: 1 << 20}),
+	} {
+		do := func(method, target string, headers ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, target, nil)
+			for i := 0; i < len(headers); i += 2 {
+				req.Header.Set(headers[i], headers[i+1])
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			return rr
+		}
+		sameHeaders := func(t *testing.T, get, head *httptest.ResponseRecorder) {
+			t.Helper()
+			if head.Code != get.Code || head.Body.Len() != 0 {
+				t.Fatalf("expected HEAD to answer %d without a body, got %d with %d bytes",
+					get.Code, head.Code, head.Body.Len())
+			}
+			for _, header := range append(bodyHeaders, "ETag", "Last-Modified", "Accept-Ranges") {
+				if head.Header().Get(header) != get.Header().Get(header) {
+					t.Errorf("%s: GET %q, HEAD %q", header, get.Header().Get(header), head.Header().Get(header))
+				}
+			}
+		}
+
+		t.Run(name+"/304", func(t *testing.T) {
+			etag := do(http.MethodGet, "/data.txt").Header().Get("ETag")
+			for _, method := range []string{http.MethodGet, http.MethodHead} {
+				rr := do(method, "/data.txt", "If-None-Match", etag, "Range", "bytes=0-4")
+				if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+					t.Fatalf("%s: expected an empty 304, got %d", method, rr.Code)
+				}
+				for _, header := range bodyHeaders {
+					if values, ok := rr.Header()[header]; ok {
+						t.Errorf("%s: expected no %s on a 304, got %q", method, header, values)
+					}
+				}
+				if rr.Header().Get("ETag") != etag {
+					t.Errorf("%s: expected the 304 to carry the ETag", method)
+				}
+			}
+		})
+
+		t.Run(name+"/HEAD", func(t *testing.T) {
+			get, head := do(http.MethodGet, "/data.txt"), do(http.MethodHead, "/data.txt")
+			sameHeaders(t, get, head)
+			if get.Header().Get("Content-Length") != "1000" || get.Header().Get("Content-Range") != "" {
+				t.Errorf("expected a full 1000 byte response, got %v", get.Header())
+			}
+
+			// The precompressed variant has its own length
+			get = do(http.MethodGet, "/app.js", "Accept-Encoding", "gzip")
+			head = do(http.MethodHead, "/app.js", "Accept-Encoding", "gzip")
+			sameHeaders(t, get, head)
+			if head.Header().Get("Content-Encoding") != "gzip" || head.Header().Get("Content-Length") != "2" {
+				t.Errorf("expected the length of the gzip sidecar, got %v", head.Header())
+			}
+		})
+
+		t.Run(name+"/206", func(t *testing.T) {
+			get := do(http.MethodGet, "/data.txt", "Range", "bytes=10-19")
+			if get.Code != http.StatusPartialContent || get.Body.String() != content[10:20] {
+				t.Fatalf("expected 206 with bytes 10-19, got %d %q", get.Code, get.Body.String())
+			}
+			if get.Header().Get("Content-Range") != "bytes 10-19/1000" || get.Header().Get("Content-Length") != "10" {
+				t.Errorf("expected Content-Range and Content-Length of the range, got %v", get.Header())
+			}
+			sameHeaders(t, get, do(http.MethodHead, "/data.txt", "Range", "bytes=10-19"))
+		})
+	}
+
+	// Bodies generated in memory follow the same rules
+	h := NewAdvancedFile(local, &config.Config{Theme: "advanced"})
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/api/capabilities", nil))
+	head := httptest.NewRecorder()
+	h.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/api/capabilities", nil))
+	if head.Header().Get("Content-Length") != strconv.Itoa(get.Body.Len()) || head.Body.Len() != 0 {
+		t.Errorf("expected HEAD to announce the %d byte body, got %q", get.Body.Len(), head.Header().Get("Content-Length"))
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/capabilities", nil)
+	req.Header.Set("If-None-Match", `"other", `+get.Header().Get("ETag"))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Header().Get("Content-Type") != "" {
+		t.Errorf("expected a bare 304 for a matching ETag list, got %d %v", rr.Code, rr.Header())
+	}
+}
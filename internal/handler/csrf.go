@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// CSRFErrorCode identifies 403 responses to mutating requests that failed the
+// CSRF check. Clients fetch a new token from GET /api/csrf and retry once.
+const CSRFErrorCode = "CSRF_INVALID"
+
+// CSRFErrorResponse is the body of a CSRF failure.
+type CSRFErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"` // Always CSRFErrorCode
+}
+
+var (
+	errCSRFToken         = errors.New("invalid or missing CSRF token")
+	errCSRFMissingOrigin = errors.New("credentials sent without an Origin or Referer header")
+)
+
+// checkCSRF validates a mutating request: an Origin or Referer header must
+// name this server or a --trusted-origin, and the X-CSRF-Token header (or
+// csrf_token form field) must hold an unused token. Browsers attach cookies
+// and Basic credentials on their own, so a request carrying either must also
+// say where it came from; clients without credentials may omit both headers.
+// The returned error describes the first check that failed.
+func (h *AdvancedFile) checkCSRF(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	referer := r.Header.Get("Referer")
+	if origin == "" && referer == "" && (r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != "") {
+		return errCSRFMissingOrigin
+	}
+
+	if origin != "" || referer != "" {
+		// The scheme must match too; behind a TLS-terminating proxy it comes
+		// from X-Forwarded-Proto with --trust-proxy, or --behind-tls-proxy
+		scheme := middleware.RequestScheme(r)
+		if h.config.BehindTLSProxy {
+			scheme = "https"
+		}
+		expected, err := config.NormalizeOrigin(scheme + "://" + r.Host)
+		if err != nil {
+			return fmt.Errorf("request host %q: %w", r.Host, err)
+		}
+		if origin != "" {
+			if err := h.checkOrigin("Origin", origin, expected); err != nil {
+				return err
+			}
+		}
+		if referer != "" {
+			if err := h.checkOrigin("Referer", referer, expected); err != nil {
+				return err
+			}
+		}
+	}
+
+	token := r.Header.Get("X-CSRF-Token")
+	if token == "" {
+		token = r.FormValue("csrf_token")
+	}
+	if !h.csrfTokens.validateToken(token) {
+		return errCSRFToken
+	}
+	return nil
+}
+
+// checkOrigin compares the origin of an Origin or Referer header with the
+// expected one and the trusted origins, saying which part differs.
+func (h *AdvancedFile) checkOrigin(header, value, expected string) error {
+	got, err := config.NormalizeOrigin(value)
+	if err != nil {
+		return fmt.Errorf("%s header: %w", header, err)
+	}
+	if got == expected || slices.Contains(h.config.TrustedOrigins, got) {
+		return nil
+	}
+	return fmt.Errorf("%s %s does not match %s: %s", header, got, expected, originMismatch(got, expected))
+}
+
+// originMismatch names the parts of two normalized origins that differ.
+func originMismatch(got, expected string) string {
+	g, err1 := url.Parse(got)
+	e, err2 := url.Parse(expected)
+	if err1 != nil || err2 != nil {
+		return "malformed origin"
+	}
+	var parts []string
+	if g.Scheme != e.Scheme {
+		parts = append(parts, "scheme")
+	}
+	if g.Hostname() != e.Hostname() {
+		parts = append(parts, "host")
+	}
+	if g.Port() != e.Port() {
+		parts = append(parts, "port")
+	}
+	return fmt.Sprintf("different %v", parts)
+}
+
+// writeCSRFFailure logs why a request failed the CSRF check and answers 403
+// with CSRFErrorCode so the front-end knows to fetch a new token.
+func (h *AdvancedFile) writeCSRFFailure(w http.ResponseWriter, r *http.Request, err error) {
+	h.logger.Warn("CSRF check failed",
+		slog.String("method", r.Method),
+		slog.String("path", middleware.LogPath(r, middleware.OriginalPath(r))),
+		slog.String("reason", err.Error()))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(CSRFErrorResponse{
+		Error: "Invalid or missing CSRF token",
+		Code:  CSRFErrorCode,
+	})
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func TestAdvancedFile_CSRF(t *testing.T) {
+	testCases := []struct {
+		name       string
+		host       string // defaults to files.example.com:8000
+		headers    map[string]string
+		noToken    bool
+		behindTLS  bool
+		wantStatus int
+	}{
+		{name: "no_origin_no_credentials", wantStatus: http.StatusOK},
+		{name: "no_origin_with_basic_auth", headers: map[string]string{"Authorization": "Basic dTpw"},
+			wantStatus: http.StatusForbidden},
+		{name: "no_origin_with_cookie", headers: map[string]string{"Cookie": "session=1"},
+			wantStatus: http.StatusForbidden},
+		{name: "same_origin_with_credentials",
+			headers:    map[string]string{"Origin": "http://files.example.com:8000", "Authorization": "Basic dTpw"},
+			wantStatus: http.StatusOK},
+		{name: "origin_case_insensitive", headers: map[string]string{"Origin": "HTTP://Files.Example.COM:8000"},
+			wantStatus: http.StatusOK},
+		{name: "default_port_explicit_in_origin", host: "files.example.com",
+			headers: map[string]string{"Origin": "http://files.example.com:80"}, wantStatus: http.StatusOK},
+		{name: "default_port_explicit_in_host", host: "files.example.com:80",
+			headers: map[string]string{"Origin": "http://files.example.com"}, wantStatus: http.StatusOK},
+		{name: "ipv6_host", host: "[::1]:8000",
+			headers: map[string]string{"Origin": "http://[::1]:8000"}, wantStatus: http.StatusOK},
+		{name: "other_scheme", headers: map[string]string{"Origin": "https://files.example.com:8000"},
+			wantStatus: http.StatusForbidden},
+		{name: "other_port", headers: map[string]string{"Origin": "http://files.example.com:8001"},
+			wantStatus: http.StatusForbidden},
+		{name: "other_host", headers: map[string]string{"Origin": "http://evil.example.com:8000"},
+			wantStatus: http.StatusForbidden},
+		{name: "host_prefix", headers: map[string]string{"Origin": "http://files.example.com:8000.evil.com"},
+			wantStatus: http.StatusForbidden},
+		{name: "null_origin", headers: map[string]string{"Origin": "null"}, wantStatus: http.StatusForbidden},
+		{name: "same_referer", headers: map[string]string{"Referer": "http://files.example.com:8000/docs/?q=1"},
+			wantStatus: http.StatusOK},
+		{name: "foreign_referer", headers: map[string]string{"Referer": "http://evil.example.com/page"},
+			wantStatus: http.StatusForbidden},
+		{name: "same_origin_foreign_referer", headers: map[string]string{
+			"Origin": "http://files.example.com:8000", "Referer": "http://evil.example.com/"},
+			wantStatus: http.StatusForbidden},
+		{name: "trusted_origin", headers: map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK},
+		{name: "trusted_origin_other_port", headers: map[string]string{"Origin": "https://app.example.com:8443"},
+			wantStatus: http.StatusForbidden},
+		{name: "behind_tls_proxy", behindTLS: true,
+			headers: map[string]string{"Origin": "https://files.example.com:8000"}, wantStatus: http.StatusOK},
+		{name: "missing_token", noToken: true, headers: map[string]string{"Origin": "http://files.example.com:8000"},
+			wantStatus: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Theme:          "advanced",
+				BehindTLSProxy: tc.behindTLS,
+				TrustedOrigins: []string{"https://app.example.com:443"},
+			}
+			h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), cfg)
+
+			body, _ := json.Marshal(FolderRequest{Path: "created"})
+			req := httptest.NewRequest(http.MethodPost, "/api/folder", bytes.NewReader(body))
+			req.Host = "files.example.com:8000"
+			if tc.host != "" {
+				req.Host = tc.host
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if !tc.noToken {
+				req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusForbidden {
+				return
+			}
+			var resp CSRFErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.Code != CSRFErrorCode {
+				t.Errorf("expected a %s error, got %q", CSRFErrorCode, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdvancedFile_CSRFReasons(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), &config.Config{Theme: "advanced"})
+	newRequest := func(headers map[string]string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/folder", nil)
+		req.Host = "files.example.com:8000"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+
+	if err := h.checkCSRF(newRequest(map[string]string{"Cookie": "a=b"})); !errors.Is(err, errCSRFMissingOrigin) {
+		t.Errorf("expected errCSRFMissingOrigin, got %v", err)
+	}
+	if err := h.checkCSRF(newRequest(nil)); !errors.Is(err, errCSRFToken) {
+		t.Errorf("expected errCSRFToken, got %v", err)
+	}
+	err := h.checkCSRF(newRequest(map[string]string{"Origin": "https://files.example.com:8001"}))
+	want := "Origin https://files.example.com:8001 does not match http://files.example.com:8000: " +
+		"different [scheme port]"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+
+	// A rejected origin leaves the token usable
+	token := h.csrfTokens.generateToken()
+	req := newRequest(map[string]string{"Origin": "http://evil.example.com", "X-CSRF-Token": token})
+	if err := h.checkCSRF(req); err == nil {
+		t.Fatal("expected a foreign origin to fail")
+	}
+	req = newRequest(map[string]string{"Origin": "http://files.example.com:8000", "X-CSRF-Token": token})
+	if err := h.checkCSRF(req); err != nil {
+		t.Errorf("expected the token to still be valid, got %v", err)
+	}
+}
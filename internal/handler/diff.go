@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// DiffEntry is one line of the GET /api/diff stream: a file that exists
+// only below a, only below b, or below both with different contents.
+type DiffEntry struct {
+	Path   string    `json:"path"`   // Slash-separated path relative to a and b
+	Change string    `json:"change"` // "added" (only in b), "removed" (only in a) or "changed"
+	A      *DiffFile `json:"a,omitempty"`
+	B      *DiffFile `json:"b,omitempty"`
+}
+
+// DiffFile describes one side of a DiffEntry.
+type DiffFile struct {
+	ModTime time.Time `json:"modTime"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256,omitempty"` // Set when the contents were compared
+}
+
+// DiffTrailer is the last line of the stream.
+type DiffTrailer struct {
+	Count     int  `json:"count"`
+	Hash      bool `json:"hash"`                // Files of equal size were compared by content
+	Truncated bool `json:"truncated,omitempty"` // A limit or the deadline stopped the walk
+}
+
+var errDiffLimit = errors.New("diff limits exceeded")
+
+// diffRoot is one side of a diff: a directory of a mount's filesystem.
+type diffRoot struct {
+	fs  internal.FileSystem
+	dir string
+}
+
+// resolveDiffRoot checks that name is a directory of fs, writing the error
+// response and returning false if it is not.
+func resolveDiffRoot(w http.ResponseWriter, r *http.Request, param string, fs internal.FileSystem, name string,
+	reporter middleware.ErrorReporter,
+) (diffRoot, bool) {
+	info, err := fs.Stat(name)
+	if err != nil {
+		reporter.JSONError(w, r, "Directory not found: "+param, http.StatusNotFound, err)
+		return diffRoot{}, false
+	}
+	if !info.IsDir() {
+		middleware.WriteJSONError(w, "Not a directory: "+param, http.StatusBadRequest)
+		return diffRoot{}, false
+	}
+	return diffRoot{fs: fs, dir: name}, true
+}
+
+// serveDiff streams the differences between the trees a and b as NDJSON,
+// in path order, followed by a DiffTrailer. Files are changed when their
+// sizes or mtimes differ or, with hash, when their sizes or contents do.
+func serveDiff(w http.ResponseWriter, r *http.Request, a, b diffRoot, cfg *config.Config, hash bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), constants.DiffTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	rc := http.NewResponseController(w)
+
+	trailer := DiffTrailer{Hash: hash}
+	d := &treeDiff{
+		ctx:         ctx,
+		a:           a,
+		b:           b,
+		hash:        hash,
+		maxHashSize: maxHashSize(cfg),
+		showHidden:  cfg.ShowHidden,
+		emit: func(e DiffEntry) error {
+			if trailer.Count >= constants.MaxDiffEntries {
+				return errDiffLimit
+			}
+			trailer.Count++
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			if trailer.Count%100 == 0 {
+				if err := bw.Flush(); err != nil {
+					return err
+				}
+				_ = rc.Flush()
+			}
+			return nil
+		},
+	}
+	if err := d.compare("", true, true); err != nil {
+		trailer.Truncated = true
+	}
+	_ = enc.Encode(trailer)
+	_ = bw.Flush()
+}
+
+// handleDiff serves GET /api/diff?a=dir&b=dir for two directories of the
+// mount.
+func (h *AdvancedFile) handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var roots [2]diffRoot
+	for i, param := range []string{"a", "b"} {
+		name, err := pathsafe.Clean(r.URL.Query().Get(param))
+		if err != nil || !r.URL.Query().Has(param) {
+			middleware.WriteJSONError(w, "Invalid or missing "+param, http.StatusBadRequest)
+			return
+		}
+		root, ok := resolveDiffRoot(w, r, param, h.fs, name, h.reporter())
+		if !ok {
+			return
+		}
+		roots[i] = root
+	}
+	hash, _ := strconv.ParseBool(r.URL.Query().Get("hash"))
+	serveDiff(w, r, roots[0], roots[1], h.config, hash)
+}
+
+// treeDiff walks two trees side by side. Listings are merged in name order
+// and directories are descended into where they sort, so the output is the
+// same for the same trees.
+type treeDiff struct {
+	ctx         context.Context
+	a, b        diffRoot
+	hash        bool
+	maxHashSize int64
+	showHidden  bool
+	scanned     int
+	emit        func(DiffEntry) error
+}
+
+// diffPair is a name found below rel in a, b or both.
+type diffPair struct {
+	name   string
+	a, b   internal.FileInfo
+	digest [2]string // Contents of a and b, when compared by hash
+}
+
+// compare reports the differences below rel. inA and inB tell whether rel
+// exists on each side; a subtree found on one side only is reported file by
+// file as added or removed.
+func (d *treeDiff) compare(rel string, inA, inB bool) error {
+	if err := d.ctx.Err(); err != nil {
+		return err
+	}
+	pairs := make(map[string]*diffPair)
+	for i, root := range []diffRoot{d.a, d.b} {
+		if (i == 0 && !inA) || (i == 1 && !inB) {
+			continue
+		}
+		files, err := root.fs.ReadDir(path.Join(root.dir, rel))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if !d.showHidden && fileutil.IsHiddenPath(path.Join(root.dir, rel, f.Name())) {
+				continue
+			}
+			if d.scanned++; d.scanned > constants.MaxDiffScanned {
+				return errDiffLimit
+			}
+			p := pairs[f.Name()]
+			if p == nil {
+				p = &diffPair{name: f.Name()}
+				pairs[f.Name()] = p
+			}
+			if i == 0 {
+				p.a = f
+			} else {
+				p.b = f
+			}
+		}
+	}
+	sorted := make([]*diffPair, 0, len(pairs))
+	for _, p := range pairs {
+		sorted = append(sorted, p)
+	}
+	slices.SortFunc(sorted, func(x, y *diffPair) int { return strings.Compare(x.name, y.name) })
+
+	if err := d.hashPairs(rel, sorted); err != nil {
+		return err
+	}
+	for _, p := range sorted {
+		if err := d.comparePair(rel, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// comparePair reports the differences of one name below rel.
+func (d *treeDiff) comparePair(rel string, p *diffPair) error {
+	name := path.Join(rel, p.name)
+	aFile := p.a != nil && !p.a.IsDir()
+	bFile := p.b != nil && !p.b.IsDir()
+	aDir := p.a != nil && p.a.IsDir()
+	bDir := p.b != nil && p.b.IsDir()
+
+	if aFile && bFile {
+		if !d.changed(p) {
+			return nil
+		}
+		return d.emit(DiffEntry{Path: name, Change: "changed",
+			A: diffFile(p.a, p.digest[0]), B: diffFile(p.b, p.digest[1])})
+	}
+	// A file replaced by a directory, or the other way round, is a removal
+	// and an addition
+	if aFile {
+		if err := d.emit(DiffEntry{Path: name, Change: "removed", A: diffFile(p.a, "")}); err != nil {
+			return err
+		}
+	}
+	if bFile {
+		if err := d.emit(DiffEntry{Path: name, Change: "added", B: diffFile(p.b, "")}); err != nil {
+			return err
+		}
+	}
+	if aDir || bDir {
+		return d.compare(name, aDir, bDir)
+	}
+	return nil
+}
+
+// changed reports whether the files of p differ.
+func (d *treeDiff) changed(p *diffPair) bool {
+	if p.a.Size() != p.b.Size() {
+		return true
+	}
+	if p.digest[0] != "" {
+		return p.digest[0] != p.digest[1]
+	}
+	return !p.a.ModTime().Equal(p.b.ModTime())
+}
+
+// hashPairs digests the files of equal size found on both sides, at most
+// constants.DiffHashWorkers at once. Files larger than maxHashSize are left
+// to the metadata comparison.
+func (d *treeDiff) hashPairs(rel string, pairs []*diffPair) error {
+	if !d.hash {
+		return nil
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, constants.DiffHashWorkers)
+	for _, p := range pairs {
+		if p.a == nil || p.b == nil || p.a.IsDir() || p.b.IsDir() ||
+			p.a.Size() != p.b.Size() || p.a.Size() > d.maxHashSize {
+			continue
+		}
+		for i, root := range []diffRoot{d.a, d.b} {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				digest, err := d.digest(root, path.Join(rel, p.name))
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				p.digest[i] = digest
+			}()
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// digest returns the hex SHA-256 of the file rel below root.
+func (d *treeDiff) digest(root diffRoot, rel string) (string, error) {
+	file, err := root.fs.Open(path.Join(root.dir, rel))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, &contextReader{ctx: d.ctx, r: file}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func diffFile(info internal.FileInfo, digest string) *DiffFile {
+	return &DiffFile{ModTime: info.ModTime().UTC(), Size: info.Size(), SHA256: digest}
+}
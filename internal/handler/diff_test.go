@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// writeDiffTree creates files under root with the given contents, all with
+// the same mtime unless listed in touched.
+func writeDiffTree(t *testing.T, root string, files map[string]string, touched ...string) {
+	t.Helper()
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeTestTree(t, root, files)
+	for name := range files {
+		if err := os.Chtimes(filepath.Join(root, filepath.FromSlash(name)), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range touched {
+		later := modTime.Add(time.Hour)
+		if err := os.Chtimes(filepath.Join(root, filepath.FromSlash(name)), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// getDiff requests target from h and returns the "change path" lines of the
+// stream and its trailer.
+func getDiff(t *testing.T, h http.Handler, target string) ([]string, []DiffEntry, DiffTrailer) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var changes []string
+	var entries []DiffEntry
+	var trailer DiffTrailer
+	scanner := bufio.NewScanner(bytes.NewReader(rr.Body.Bytes()))
+	for scanner.Scan() {
+		var e DiffEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid line %s: %v", scanner.Text(), err)
+		}
+		if e.Change == "" {
+			if err := json.Unmarshal(scanner.Bytes(), &trailer); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		changes = append(changes, e.Change+" "+e.Path)
+		entries = append(entries, e)
+	}
+	return changes, entries, trailer
+}
+
+func newDiffFixture(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeDiffTree(t, filepath.Join(root, "staging"), map[string]string{
+		"same.txt":          "same",
+		"resized.txt":       "longer content",
+		"touched.txt":       "touched",
+		"rewritten.txt":     "abc",
+		"new.txt":           "new",
+		"docs/guide.md":     "guide v2",
+		"docs/new/page.md":  "page",
+		"kind":              "now a file",
+		".hidden/ignored":   "x",
+		"assets/logo.svg":   "logo",
+		"assets/unchanged":  "u",
+		"assets/sub/a.txt":  "a",
+		"assets/sub/b.txt":  "b",
+		"assets/sub/zz.txt": "zz",
+	}, "touched.txt")
+	writeDiffTree(t, filepath.Join(root, "release"), map[string]string{
+		"same.txt":          "same",
+		"resized.txt":       "short",
+		"touched.txt":       "touched",
+		"rewritten.txt":     "xyz",
+		"old.txt":           "old",
+		"docs/guide.md":     "guide v1 draft",
+		"docs/old/page.md":  "page",
+		"kind/file.txt":     "was a directory",
+		"assets/logo.svg":   "logo",
+		"assets/unchanged":  "u",
+		"assets/sub/a.txt":  "a",
+		"assets/sub/b.txt":  "b",
+		"assets/sub/zz.txt": "zz",
+	})
+	return root
+}
+
+func TestAdvancedFile_Diff(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(newDiffFixture(t), false), &config.Config{Theme: "advanced"})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "metadata",
+			query: "a=/release&b=staging",
+			want: []string{
+				"changed docs/guide.md", "added docs/new/page.md", "removed docs/old/page.md",
+				"added kind", "removed kind/file.txt",
+				"added new.txt", "removed old.txt", "changed resized.txt", "changed touched.txt",
+			},
+		},
+		{
+			name:  "hash",
+			query: "a=/release&b=staging&hash=1",
+			want: []string{
+				"changed docs/guide.md", "added docs/new/page.md", "removed docs/old/page.md",
+				"added kind", "removed kind/file.txt",
+				"added new.txt", "removed old.txt", "changed resized.txt", "changed rewritten.txt",
+			},
+		},
+		{
+			name:  "same directory",
+			query: "a=/release/assets&b=/staging/assets&hash=true",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, trailer := getDiff(t, h, "/api/diff?"+tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected\n%v\ngot\n%v", tt.want, got)
+			}
+			if trailer.Count != len(tt.want) || trailer.Truncated {
+				t.Errorf("Unexpected trailer %+v", trailer)
+			}
+		})
+	}
+
+	t.Run("digests", func(t *testing.T) {
+		_, entries, _ := getDiff(t, h, "/api/diff?a=/release&b=/staging&hash=1")
+		for _, e := range entries {
+			if e.Path != "rewritten.txt" {
+				continue
+			}
+			if e.A == nil || e.B == nil || e.A.SHA256 == "" || e.A.SHA256 == e.B.SHA256 || e.A.Size != 3 {
+				t.Errorf("Expected both digests, got %+v %+v", e.A, e.B)
+			}
+			return
+		}
+		t.Error("rewritten.txt not reported")
+	})
+
+	for _, tt := range []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"missing b", "a=/release", http.StatusBadRequest},
+		{"escaping path", "a=/release&b=../x", http.StatusBadRequest},
+		{"missing directory", "a=/release&b=/nope", http.StatusNotFound},
+		{"file", "a=/release&b=/release/old.txt", http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/diff?"+tt.query, nil))
+			if rr.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdvancedFile_DiffLimit(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := range constants.MaxDiffEntries + 1 {
+		if err := os.WriteFile(filepath.Join(root, "b", fmt.Sprintf("f%05d", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	got, _, trailer := getDiff(t, h, "/api/diff?a=a&b=b")
+	if len(got) != constants.MaxDiffEntries || trailer.Count != constants.MaxDiffEntries || !trailer.Truncated {
+		t.Errorf("Expected %d entries and a truncated trailer, got %d %+v", constants.MaxDiffEntries, len(got), trailer)
+	}
+	if got[0] != "added f00000" {
+		t.Errorf("Expected entries in path order, first is %q", got[0])
+	}
+}
+
+func TestMultiDir_DiffAcrossMounts(t *testing.T) {
+	root := newDiffFixture(t)
+	mounts := []config.DirMount{
+		{Path: "/staging", Dir: filepath.Join(root, "staging"), Name: "Staging"},
+		{Path: "/release", Dir: filepath.Join(root, "release"), Name: "Release"},
+	}
+	m := NewMultiDir(mounts, &config.Config{Theme: "advanced"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	query := url.Values{"a": {"/release/docs"}, "b": {"/staging/docs"}}
+	got, _, _ := getDiff(t, m, "/api/diff?"+query.Encode())
+	want := []string{"changed guide.md", "added new/page.md", "removed old/page.md"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Within a mount the paths are relative to it, as for every other endpoint
+	got, _, _ = getDiff(t, m, "/staging/api/diff?a=/assets&b=/assets")
+	if len(got) != 0 {
+		t.Errorf("Expected no differences, got %v", got)
+	}
+
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/diff?a=/other/docs&b=/staging/docs", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a path outside the mounts, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
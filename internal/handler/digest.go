@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etagDigest returns the SHA-256 an ETag from contentETag or the hot cache
+// carries, or nil for an ETag derived from path, size and modification time.
+func etagDigest(etag string) []byte {
+	quoted, ok := strings.CutPrefix(etag, `"`)
+	if !ok {
+		return nil
+	}
+	digest, ok := strings.CutSuffix(quoted, `"`)
+	if !ok || len(digest) != hex.EncodedLen(sha256.Size) {
+		return nil
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil
+	}
+	return sum
+}
+
+// setDigestHeader sets the RFC 9530 sha-256 digest of a file whose ETag
+// already carries it: Content-Digest on a full response, and Repr-Digest on
+// a partial one, since the digest covers the whole file rather than the
+// range sent. Files are never hashed for it, so those too large for a
+// content ETag get neither.
+func setDigestHeader(w http.ResponseWriter, etag string, partial bool) {
+	sum := etagDigest(etag)
+	if sum == nil {
+		return
+	}
+	name := "Content-Digest"
+	if partial {
+		name = "Repr-Digest"
+	}
+	w.Header().Set(name, "sha-256=:"+base64.StdEncoding.EncodeToString(sum)+":")
+}
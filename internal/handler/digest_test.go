@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func TestEtagDigest(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello"))
+	etag, err := contentETag(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := etagDigest(etag); string(got) != string(sum[:]) {
+		t.Errorf("etagDigest(%s) = %x, want %x", etag, got, sum)
+	}
+	for _, etag := range []string{
+		`"gofs-612e747874-5-65e1c540"`,
+		`W/"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"`,
+		`"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b98zz"`,
+		`"2cf24dba"`,
+		"",
+	} {
+		if got := etagDigest(etag); got != nil {
+			t.Errorf("etagDigest(%s) = %x, want nil", etag, got)
+		}
+	}
+}
+
+func TestFileServer_DigestHeaders(t *testing.T) {
+	root := t.TempDir()
+	content := "the quick brown fox"
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	want := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	format := regexp.MustCompile(`^sha-256=:[A-Za-z0-9+/]{43}=:$`)
+	logger := slog.New(slog.DiscardHandler)
+
+	hashed := &config.Config{MaxHashSize: 1 << 20, DigestHeaders: true}
+	unhashed := &config.Config{MaxHashSize: 4, DigestHeaders: true}
+	disabled := &config.Config{MaxHashSize: 1 << 20}
+	cached := filesystem.NewCached(filesystem.NewLocal(root, false), filesystem.NewHotCache(1<<20, 64<<10))
+
+	tests := []struct {
+		name          string
+		handler       http.Handler
+		header        http.Header
+		wantStatus    int
+		contentDigest bool
+		reprDigest    bool
+	}{
+		{"full", NewFile(filesystem.NewLocal(root, false), hashed, logger), nil, http.StatusOK, true, false},
+		{"range", NewFile(filesystem.NewLocal(root, false), hashed, logger),
+			http.Header{"Range": {"bytes=4-8"}}, http.StatusPartialContent, false, true},
+		// Files over --max-hash-size are not hashed just for the header
+		{"not hashed", NewFile(filesystem.NewLocal(root, false), unhashed, logger), nil, http.StatusOK, false, false},
+		// The hot cache knows the digest whatever --max-hash-size says
+		{"hot cache", NewFile(cached, unhashed, logger), nil, http.StatusOK, true, false},
+		{"hot cache range", NewFile(cached, unhashed, logger),
+			http.Header{"Range": {"bytes=0-3"}}, http.StatusPartialContent, false, true},
+		{"disabled", NewFile(filesystem.NewLocal(root, false), disabled, logger), nil, http.StatusOK, false, false},
+		{"advanced", NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{
+			Theme: "advanced", MaxHashSize: 1 << 20, DigestHeaders: true,
+		}), nil, http.StatusOK, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := getPath(tt.handler, "/a.txt", tt.header)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, rr.Code)
+			}
+			for name, wantSet := range map[string]bool{"Content-Digest": tt.contentDigest, "Repr-Digest": tt.reprDigest} {
+				got := rr.Header().Get(name)
+				switch {
+				case !wantSet && got != "":
+					t.Errorf("expected no %s, got %q", name, got)
+				case wantSet && (got != want || !format.MatchString(got)):
+					t.Errorf("expected %s %q, got %q", name, want, got)
+				}
+			}
+		})
+	}
+
+	// A 304 describes no body, so it carries no digest either
+	h := NewFile(filesystem.NewLocal(root, false), hashed, logger)
+	etag := getPath(h, "/a.txt", nil).Header().Get("ETag")
+	rr := getPath(h, "/a.txt", http.Header{"If-None-Match": {etag}})
+	if rr.Code != http.StatusNotModified || rr.Header().Get("Content-Digest") != "" {
+		t.Errorf("expected a 304 without Content-Digest, got %d %q", rr.Code, rr.Header().Get("Content-Digest"))
+	}
+}
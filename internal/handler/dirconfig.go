@@ -0,0 +1,554 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// dirConfigName is the per-directory config file read when --dir-config is
+// enabled. It is never listed, served or writable through the handlers.
+const dirConfigName = ".gofs.yaml"
+
+// maxDirConfigSize bounds how much of a .gofs.yaml is read.
+const maxDirConfigSize = 64 << 10
+
+// maxCheckedCredentials bounds the cache of verified subtree credentials.
+const maxCheckedCredentials = 1024
+
+var (
+	errDirHidden       = &internal.APIError{Code: "NOT_FOUND", Message: "Not found", Status: http.StatusNotFound}
+	errDirAuthRequired = &internal.APIError{
+		Code:    "AUTH_REQUIRED",
+		Message: "Authentication required",
+		Status:  http.StatusUnauthorized,
+	}
+	errDirConfigWrite = &internal.APIError{
+		Code:    "FORBIDDEN",
+		Message: dirConfigName + " cannot be modified",
+		Status:  http.StatusForbidden,
+	}
+)
+
+// dirConfig is one parsed .gofs.yaml. Unset directives are nil so that a
+// nested file only overrides what it mentions.
+type dirConfig struct {
+	hidden *bool
+	auth   *dirCredential // a zero credential ("auth: none") lifts an inherited one
+	index  *string
+}
+
+type dirCredential struct {
+	user string
+	hash []byte
+}
+
+// parseDirConfig reads the subset of YAML used by .gofs.yaml: flat
+// "key: value" lines, optionally quoted, with # comments.
+func parseDirConfig(r io.Reader) (*dirConfig, error) {
+	cfg := &dirConfig{}
+	scanner := bufio.NewScanner(io.LimitReader(r, maxDirConfigSize))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value, err := dirConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		switch key {
+		case "hidden":
+			hidden, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: hidden must be true or false", lineNo)
+			}
+			cfg.hidden = &hidden
+		case "auth":
+			cred := &dirCredential{}
+			if value != "" && value != "none" {
+				user, hash, ok := strings.Cut(value, ":")
+				if !ok || user == "" {
+					return nil, fmt.Errorf("line %d: auth must be \"user:bcrypt-hash\"", lineNo)
+				}
+				if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+					return nil, fmt.Errorf("line %d: auth: %w", lineNo, err)
+				}
+				cred.user, cred.hash = user, []byte(hash)
+			}
+			cfg.auth = cred
+		case "index":
+			if strings.ContainsAny(value, `/\`) || value == "." || value == ".." {
+				return nil, fmt.Errorf("line %d: index must be a file name", lineNo)
+			}
+			cfg.index = &value
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", lineNo, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// dirConfigValue unquotes a scalar and strips a trailing comment.
+func dirConfigValue(raw string) (string, error) {
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return "", nil
+	}
+	switch quote := value[0]; quote {
+	case '"', '\'':
+		end := strings.IndexByte(value[1:], quote)
+		if end < 0 {
+			return "", errors.New("unterminated quoted value")
+		}
+		rest := strings.TrimSpace(value[end+2:])
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", errors.New("unexpected text after quoted value")
+		}
+		return value[1 : end+1], nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// dirRules are the directives in effect for one directory once every
+// .gofs.yaml from the mount root down has been applied.
+type dirRules struct {
+	hidden bool
+	auth   *dirCredential
+	index  string
+}
+
+func (r dirRules) apply(cfg *dirConfig) dirRules {
+	if cfg == nil {
+		return r
+	}
+	if cfg.hidden != nil {
+		r.hidden = *cfg.hidden
+	}
+	if cfg.auth != nil {
+		r.auth = cfg.auth
+		if cfg.auth.user == "" {
+			r.auth = nil
+		}
+	}
+	if cfg.index != nil {
+		r.index = *cfg.index
+	}
+	return r
+}
+
+type dirConfigEntry struct {
+	modTime time.Time
+	size    int64
+	cfg     *dirConfig
+	err     error
+}
+
+// dirConfigCache parses .gofs.yaml files on demand and keeps them until the
+// file's mtime or size changes.
+type dirConfigCache struct {
+	fs internal.FileSystem
+
+	mu          sync.Mutex
+	entries     map[string]dirConfigEntry // directory -> parsed config
+	credentials map[[sha256.Size]byte]bool
+}
+
+func newDirConfigCache(fs internal.FileSystem) *dirConfigCache {
+	return &dirConfigCache{
+		fs:          fs,
+		entries:     make(map[string]dirConfigEntry),
+		credentials: make(map[[sha256.Size]byte]bool),
+	}
+}
+
+// load returns the config of dir, or nil if it has none.
+func (c *dirConfigCache) load(dir string) (*dirConfig, error) {
+	name := path.Join(dir, dirConfigName)
+	info, statErr := c.fs.Stat(name)
+	if statErr != nil || info.IsDir() {
+		// No config file means no directives
+		c.mu.Lock()
+		delete(c.entries, dir)
+		c.mu.Unlock()
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[dir]
+	c.mu.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.cfg, entry.err
+	}
+
+	entry = dirConfigEntry{modTime: info.ModTime(), size: info.Size()}
+	file, err := c.fs.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	entry.cfg, entry.err = parseDirConfig(file)
+	file.Close()
+	if entry.err != nil {
+		entry.err = fmt.Errorf("%s: %w", name, entry.err)
+	}
+
+	c.mu.Lock()
+	c.entries[dir] = entry
+	c.mu.Unlock()
+	return entry.cfg, entry.err
+}
+
+// resolve returns the rules in effect for name and for the directory that
+// contains it. name's own .gofs.yaml is applied if it is a directory.
+func (c *dirConfigCache) resolve(name string) (self, parent dirRules, err error) {
+	name = cleanDirConfigPath(name)
+	cfg, err := c.load("")
+	if err != nil {
+		return self, parent, err
+	}
+	self = self.apply(cfg)
+	if name == "" {
+		return self, self, nil
+	}
+
+	dir := ""
+	for _, part := range strings.Split(name, "/") {
+		parent = self
+		dir = path.Join(dir, part)
+		if cfg, err = c.load(dir); err != nil {
+			return self, parent, err
+		}
+		self = self.apply(cfg)
+	}
+	return self, parent, nil
+}
+
+// authorized reports whether the Authorization header satisfies cred,
+// remembering the result so bcrypt only runs once per credential.
+func (c *dirConfigCache) authorized(cred *dirCredential, authorization string) bool {
+	encoded, ok := strings.CutPrefix(authorization, "Basic ")
+	if !ok {
+		return false
+	}
+	key := sha256.Sum256([]byte(cred.user + "\x00" + string(cred.hash) + "\x00" + encoded))
+	c.mu.Lock()
+	result, cached := c.credentials[key]
+	c.mu.Unlock()
+	if cached {
+		return result
+	}
+
+	result = false
+	if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+		if user, password, ok := strings.Cut(string(decoded), ":"); ok {
+			userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(cred.user)) == 1
+			passwordMatch := bcrypt.CompareHashAndPassword(cred.hash, []byte(password)) == nil
+			result = userMatch && passwordMatch
+		}
+	}
+
+	c.mu.Lock()
+	if len(c.credentials) >= maxCheckedCredentials {
+		clear(c.credentials)
+	}
+	c.credentials[key] = result
+	c.mu.Unlock()
+	return result
+}
+
+// hides returns why the entry f of dir, whose rules are given, is left out
+// of listings, or "" if it is not: .gofs files never show up, nor do
+// directories whose rules hide them.
+func (c *dirConfigCache) hides(rules dirRules, dir string, f internal.FileInfo) (string, error) {
+	if f.Name() == dirConfigName {
+		return HiddenConfigFile, nil
+	}
+	if !f.IsDir() {
+		return "", nil
+	}
+	cfg, err := c.load(path.Join(cleanDirConfigPath(dir), f.Name()))
+	if err != nil {
+		return "", err
+	}
+	if rules.apply(cfg).hidden {
+		return HiddenDirConfig, nil
+	}
+	return "", nil
+}
+
+func cleanDirConfigPath(name string) string {
+	name = path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))
+	return strings.TrimPrefix(name, "/")
+}
+
+// dirConfigFS applies the .gofs.yaml directives to a filesystem for one
+// request: hidden directories do not exist, directories whose credential
+// the request lacks cannot be read, and .gofs.yaml files are invisible.
+// Every walk built on it (ZIPs, manifests, the change feed, the tree) is
+// filtered the same way as listings.
+type dirConfigFS struct {
+	internal.FileSystem
+	configs       *dirConfigCache
+	authorization string
+}
+
+func newDirConfigFS(fs internal.FileSystem, configs *dirConfigCache, authorization string) *dirConfigFS {
+	return &dirConfigFS{FileSystem: fs, configs: configs, authorization: authorization}
+}
+
+// check returns errDirHidden or errDirAuthRequired if name, or the contents
+// of name when it is a directory, may not be read.
+func (d *dirConfigFS) check(name string) (dirRules, error) {
+	self, _, err := d.configs.resolve(name)
+	if err != nil {
+		return self, err
+	}
+	if path.Base(cleanDirConfigPath(name)) == dirConfigName || self.hidden {
+		return self, errDirHidden
+	}
+	if self.auth != nil && !d.configs.authorized(self.auth, d.authorization) {
+		return self, errDirAuthRequired
+	}
+	return self, nil
+}
+
+func (d *dirConfigFS) Open(name string) (io.ReadCloser, error) {
+	if _, err := d.check(name); err != nil {
+		return nil, err
+	}
+	return d.FileSystem.Open(name)
+}
+
+func (d *dirConfigFS) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	if _, err := d.check(name); err != nil {
+		return nil, err
+	}
+	return internal.OpenSeeker(d.FileSystem, name)
+}
+
+// Stat only needs the containing directory to be readable, so a protected
+// directory still shows up in its parent's listing.
+func (d *dirConfigFS) Stat(name string) (internal.FileInfo, error) {
+	if err := d.checkStat(name); err != nil {
+		return nil, err
+	}
+	return d.FileSystem.Stat(name)
+}
+
+func (d *dirConfigFS) Lstat(name string) (internal.FileInfo, error) {
+	if err := d.checkStat(name); err != nil {
+		return nil, err
+	}
+	return internal.Lstat(d.FileSystem, name)
+}
+
+// checkStat is check for the information of name rather than its content.
+func (d *dirConfigFS) checkStat(name string) error {
+	self, parent, err := d.configs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if path.Base(cleanDirConfigPath(name)) == dirConfigName || self.hidden {
+		return errDirHidden
+	}
+	if parent.auth != nil && !d.configs.authorized(parent.auth, d.authorization) {
+		return errDirAuthRequired
+	}
+	return nil
+}
+
+func (d *dirConfigFS) ReadDir(name string) ([]internal.FileInfo, error) {
+	rules, err := d.check(name)
+	if err != nil {
+		return nil, err
+	}
+	files, err := d.FileSystem.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := files[:0]
+	for _, f := range files {
+		show, err := d.listed(rules, name, f)
+		if err != nil {
+			return nil, err
+		}
+		if show {
+			visible = append(visible, f)
+		}
+	}
+	return visible, nil
+}
+
+// ReadDirIter streams the listing of the wrapped filesystem with the same
+// entries left out as ReadDir.
+func (d *dirConfigFS) ReadDirIter(name string, fn func(internal.FileInfo) error) error {
+	rules, err := d.check(name)
+	if err != nil {
+		return err
+	}
+	return internal.ReadDirIter(d.FileSystem, name, func(f internal.FileInfo) error {
+		show, err := d.listed(rules, name, f)
+		if err != nil || !show {
+			return err
+		}
+		return fn(f)
+	})
+}
+
+// ReadDirAll lists every entry of name, those the .gofs.yaml rules hide
+// included: a directory holding them cannot be removed.
+func (d *dirConfigFS) ReadDirAll(name string) ([]internal.FileInfo, error) {
+	if _, err := d.check(name); err != nil {
+		return nil, err
+	}
+	return internal.ReadDirAll(d.FileSystem, name)
+}
+
+// listed reports whether f belongs in the listing of dir.
+func (d *dirConfigFS) listed(rules dirRules, dir string, f internal.FileInfo) (bool, error) {
+	reason, err := d.configs.hides(rules, dir, f)
+	return reason == "", err
+}
+
+// Capabilities reports those of the wrapped filesystem; the rules only
+// refuse individual paths.
+func (d *dirConfigFS) Capabilities() internal.Capabilities {
+	return internal.CapabilitiesOf(d.FileSystem)
+}
+
+func (d *dirConfigFS) Create(name string) (io.WriteCloser, error) {
+	if err := d.checkWrite(name); err != nil {
+		return nil, err
+	}
+	return d.FileSystem.Create(name)
+}
+
+func (d *dirConfigFS) Mkdir(name string, perm os.FileMode) error {
+	if err := d.checkWrite(name); err != nil {
+		return err
+	}
+	return d.FileSystem.Mkdir(name, perm)
+}
+
+func (d *dirConfigFS) Remove(name string) error {
+	if err := d.checkWrite(name); err != nil {
+		return err
+	}
+	return d.FileSystem.Remove(name)
+}
+
+func (d *dirConfigFS) Rename(oldname, newname string) error {
+	if err := d.checkWrite(oldname); err != nil {
+		return err
+	}
+	if err := d.checkWrite(newname); err != nil {
+		return err
+	}
+	return d.FileSystem.Rename(oldname, newname)
+}
+
+func (d *dirConfigFS) Symlink(target, newname string) error {
+	if err := d.checkWrite(newname); err != nil {
+		return err
+	}
+	return internal.Symlink(d.FileSystem, target, newname)
+}
+
+func (d *dirConfigFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := d.checkWrite(name); err != nil {
+		return err
+	}
+	return d.FileSystem.Chtimes(name, atime, mtime)
+}
+
+// checkWrite allows changing name if its directory may be read. Config
+// files themselves can only be changed on disk.
+func (d *dirConfigFS) checkWrite(name string) error {
+	clean := cleanDirConfigPath(name)
+	if path.Base(clean) == dirConfigName {
+		return errDirConfigWrite
+	}
+	if _, err := d.check(path.Dir(clean)); err != nil {
+		return err
+	}
+	// Moving or removing a hidden directory would reveal or destroy it
+	self, _, err := d.configs.resolve(clean)
+	if err != nil {
+		return err
+	}
+	if self.hidden {
+		return errDirHidden
+	}
+	return nil
+}
+
+// dirAccess enforces the .gofs.yaml directives for a request to name before
+// it is served, writing a 404 or 401 response if it may not be. When name is
+// a directory, index is the path of the file to serve instead of a listing.
+func dirAccess(w http.ResponseWriter, r *http.Request, fs internal.FileSystem, name string,
+	reporter middleware.ErrorReporter,
+) (index string, ok bool) {
+	d, ok := fs.(*dirConfigFS)
+	if !ok {
+		return "", true
+	}
+	rules, err := d.check(name)
+	var apiErr *internal.APIError
+	switch {
+	case err == nil:
+		if rules.index == "" {
+			return "", true
+		}
+		return path.Join(cleanDirConfigPath(name), rules.index), true
+	case errors.Is(err, errDirAuthRequired):
+		w.Header().Set("WWW-Authenticate", `Basic realm="gofs", charset="UTF-8"`)
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+	case errors.As(err, &apiErr):
+		http.NotFound(w, r)
+	default:
+		reporter.Error(w, r, "Invalid directory configuration", http.StatusInternalServerError, err)
+	}
+	return "", false
+}
+
+// indexFile returns the index file of a directory request, or nil if the
+// request wants a listing or the index does not exist.
+func indexFile(r *http.Request, fs internal.FileSystem, index string) internal.FileInfo {
+	if index == "" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		return nil
+	}
+	info, err := fs.Stat(index)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,319 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func writeTestTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+// dirConfigHandlers builds both themes over root with --dir-config enabled.
+func dirConfigHandlers(root string) map[string]http.Handler {
+	fs := filesystem.NewLocal(root, false)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return map[string]http.Handler{
+		"default":  NewFile(fs, &config.Config{Theme: "default", DirConfig: true, MaxHashSize: 1 << 20}, logger),
+		"advanced": NewAdvancedFile(fs, &config.Config{Theme: "advanced", DirConfig: true, MaxHashSize: 1 << 20}),
+	}
+}
+
+func getPath(h http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func TestParseDirConfig(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+
+	cfg, err := parseDirConfig(strings.NewReader("---\n# comment\nhidden: false  # trailing\n" +
+		"auth: \"alice:" + string(hash) + "\"\nindex: 'home page.html'\n"))
+	if err != nil {
+		t.Fatalf("parseDirConfig: %v", err)
+	}
+	if cfg.hidden == nil || *cfg.hidden {
+		t.Errorf("expected hidden: false, got %v", cfg.hidden)
+	}
+	if cfg.auth == nil || cfg.auth.user != "alice" || !bytes.Equal(cfg.auth.hash, hash) {
+		t.Errorf("unexpected auth %+v", cfg.auth)
+	}
+	if cfg.index == nil || *cfg.index != "home page.html" {
+		t.Errorf("unexpected index %v", cfg.index)
+	}
+
+	for _, input := range []string{
+		"hidden: maybe",
+		"auth: alice:not-a-hash",
+		"auth: :" + string(hash),
+		"index: ../secret.txt",
+		"owner: alice",
+		"hidden",
+		`index: "unterminated`,
+	} {
+		if _, err := parseDirConfig(strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestDirConfig_Hidden(t *testing.T) {
+	for _, name := range []string{"default", "advanced"} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestTree(t, root, map[string]string{
+				"public/a.txt":                "a",
+				"private/.gofs.yaml":          "hidden: true\n",
+				"private/secret.txt":          "secret",
+				"private/shared/.gofs.yaml":   "hidden: false\n",
+				"private/shared/notes.txt":    "notes",
+				"private/shared/deep/x.txt":   "x",
+				"public/inner/.gofs.yaml":     "hidden: true\n",
+				"public/inner/never-seen.txt": "no",
+			})
+			h := dirConfigHandlers(root)[name]
+
+			listing := getPath(h, "/", nil)
+			if listing.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", listing.Code)
+			}
+			if strings.Contains(listing.Body.String(), "private") {
+				t.Error("hidden directory should not be listed")
+			}
+
+			for _, target := range []string{"/private/", "/private/secret.txt", "/public/inner/", "/public/.gofs.yaml",
+				"/private/shared/.gofs.yaml"} {
+				if rr := getPath(h, target, nil); rr.Code != http.StatusNotFound {
+					t.Errorf("%s: expected 404, got %d", target, rr.Code)
+				}
+			}
+
+			public := getPath(h, "/public/", http.Header{"Accept": {"application/json"}})
+			if strings.Contains(public.Body.String(), "inner") || strings.Contains(public.Body.String(), ".gofs.yaml") {
+				t.Errorf("hidden entries listed: %s", public.Body.String())
+			}
+
+			// The most specific config wins
+			if rr := getPath(h, "/private/shared/notes.txt", nil); rr.Code != http.StatusOK {
+				t.Errorf("expected 200 below hidden: false, got %d", rr.Code)
+			}
+			if rr := getPath(h, "/private/shared/", nil); !strings.Contains(rr.Body.String(), "deep") {
+				t.Errorf("expected the nested directory to be listed, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestDirConfig_Auth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	for _, name := range []string{"default", "advanced"} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestTree(t, root, map[string]string{
+				"team/.gofs.yaml":       "auth: alice:" + string(hash) + "\n",
+				"team/plan.txt":         "plan",
+				"team/open/.gofs.yaml":  "auth: none\n",
+				"team/open/readme.txt":  "readme",
+				"team/sub/deeper.txt":   "deeper",
+				"everyone/announcement": "hello",
+			})
+			h := dirConfigHandlers(root)[name]
+
+			// Listed in the parent, but its contents need the credential
+			if rr := getPath(h, "/", nil); !strings.Contains(rr.Body.String(), "team") {
+				t.Error("protected directory should still be listed")
+			}
+			for _, target := range []string{"/team/", "/team/plan.txt", "/team/sub/deeper.txt"} {
+				rr := getPath(h, target, nil)
+				if rr.Code != http.StatusUnauthorized {
+					t.Errorf("%s: expected 401, got %d", target, rr.Code)
+				}
+				if !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "Basic ") {
+					t.Errorf("%s: missing WWW-Authenticate", target)
+				}
+			}
+
+			wrong := http.Header{"Authorization": {basicAuth("alice", "wrong")}}
+			if rr := getPath(h, "/team/plan.txt", wrong); rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected 401 for a wrong password, got %d", rr.Code)
+			}
+			right := http.Header{"Authorization": {basicAuth("alice", "secret")}}
+			for i := 0; i < 2; i++ {
+				if rr := getPath(h, "/team/plan.txt", right); rr.Code != http.StatusOK || rr.Body.String() != "plan" {
+					t.Errorf("expected the file with the credential, got %d", rr.Code)
+				}
+			}
+
+			if rr := getPath(h, "/team/open/readme.txt", nil); rr.Code != http.StatusOK {
+				t.Errorf("expected auth: none to lift the credential, got %d", rr.Code)
+			}
+			if rr := getPath(h, "/everyone/announcement", nil); rr.Code != http.StatusOK {
+				t.Errorf("unprotected files should be served, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestDirConfig_AuthProtectsZipDownloads(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"docs/a.txt":             "a",
+		"docs/team/.gofs.yaml":   "auth: alice:" + string(hash) + "\n",
+		"docs/team/plan.txt":     "plan",
+		"docs/hidden/.gofs.yaml": "hidden: true\n",
+		"docs/hidden/x.txt":      "x",
+	})
+	h := dirConfigHandlers(root)["advanced"]
+
+	zipNames := func(header http.Header) []string {
+		rr := getPath(h, "/api/zip?path=docs", header)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil {
+			t.Fatalf("invalid ZIP: %v", err)
+		}
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	anonymous := strings.Join(zipNames(nil), ",")
+	if strings.Contains(anonymous, "plan.txt") || strings.Contains(anonymous, "x.txt") ||
+		strings.Contains(anonymous, ".gofs.yaml") {
+		t.Errorf("anonymous ZIP includes protected files: %s", anonymous)
+	}
+	authorized := strings.Join(zipNames(http.Header{"Authorization": {basicAuth("alice", "secret")}}), ",")
+	if !strings.Contains(authorized, "plan.txt") || strings.Contains(authorized, "x.txt") {
+		t.Errorf("unexpected authorized ZIP contents: %s", authorized)
+	}
+}
+
+func TestDirConfig_Index(t *testing.T) {
+	for _, name := range []string{"default", "advanced"} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestTree(t, root, map[string]string{
+				"site/.gofs.yaml":      "index: index.html\n",
+				"site/index.html":      "<h1>home</h1>",
+				"site/blog/index.html": "<h1>blog</h1>",
+				"site/empty/file.txt":  "no index here",
+			})
+			h := dirConfigHandlers(root)[name]
+
+			if rr := getPath(h, "/site/", nil); rr.Body.String() != "<h1>home</h1>" {
+				t.Errorf("expected the index file, got %d %q", rr.Code, rr.Body.String())
+			}
+			// Inherited by subdirectories
+			if rr := getPath(h, "/site/blog/", nil); rr.Body.String() != "<h1>blog</h1>" {
+				t.Errorf("expected the nested index file, got %d %q", rr.Code, rr.Body.String())
+			}
+			if rr := getPath(h, "/site/empty/", nil); !strings.Contains(rr.Body.String(), "file.txt") {
+				t.Errorf("expected a listing without an index file, got %d", rr.Code)
+			}
+			json := getPath(h, "/site/", http.Header{"Accept": {"application/json"}})
+			if !strings.Contains(json.Body.String(), "index.html") {
+				t.Errorf("JSON listings should ignore index, got %s", json.Body.String())
+			}
+		})
+	}
+}
+
+func TestDirConfig_ReloadsChangedFile(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"docs/.gofs.yaml": "hidden: true\n",
+		"docs/a.txt":      "a",
+	})
+	h := dirConfigHandlers(root)["advanced"]
+
+	if rr := getPath(h, "/docs/a.txt", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+
+	configPath := filepath.Join(root, "docs", ".gofs.yaml")
+	if err := os.WriteFile(configPath, []byte("hidden: false\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(configPath, future, future); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	if rr := getPath(h, "/docs/a.txt", nil); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 after the config changed, got %d", rr.Code)
+	}
+
+	if err := os.WriteFile(configPath, []byte("hidden: sometimes\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if rr := getPath(h, "/docs/a.txt", nil); rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 for an invalid config, got %d", rr.Code)
+	}
+
+	if err := os.Remove(configPath); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if rr := getPath(h, "/docs/a.txt", nil); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 once the config is removed, got %d", rr.Code)
+	}
+}
+
+func TestDirConfig_ConfigFilesAreNotWritable(t *testing.T) {
+	root := t.TempDir()
+	fs := filesystem.NewLocal(root, true)
+	d := newDirConfigFS(fs, newDirConfigCache(fs), "")
+
+	if _, err := d.Create(".gofs.yaml"); err == nil {
+		t.Error("expected creating .gofs.yaml to fail")
+	}
+	if err := d.Rename("notes.txt", "sub/.gofs.yaml"); err == nil {
+		t.Error("expected renaming onto .gofs.yaml to fail")
+	}
+}
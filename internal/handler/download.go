@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// wantsDownload reports whether the request asks for a file to be saved
+// rather than shown, with ?download=1 or its short form ?dl=1.
+func wantsDownload(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Get("download") == "1" || query.Get("dl") == "1"
+}
+
+// contentDisposition returns the Content-Disposition of file name: inline by
+// default and attachment when the request wants a download. Names that are
+// not plain ASCII get an ASCII fallback in filename and the exact name in
+// filename* as RFC 6266 describes.
+func contentDisposition(r *http.Request, name string) string {
+	disposition := "inline"
+	if wantsDownload(r) {
+		disposition = "attachment"
+	}
+
+	fallback := strings.Map(func(c rune) rune {
+		if c < 0x20 || c > 0x7e || c == '"' || c == '\\' {
+			return '_'
+		}
+		return c
+	}, name)
+	if fallback == name {
+		return fmt.Sprintf(`%s; filename="%s"`, disposition, name)
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback, encodeExtValue(name))
+}
+
+// encodeExtValue percent-encodes s as the value of an RFC 8187 extended
+// parameter, leaving only attr-char unescaped.
+func encodeExtValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
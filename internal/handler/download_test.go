@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func TestDownloadParameter(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "report.pdf"), []byte("%PDF-1.4 report"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newConfig := func(theme string) *config.Config {
+		return &config.Config{
+			Theme:          theme,
+			MaxHashSize:    1 << 20,
+			RequestTimeout: 30,
+			Dirs:           []config.DirMount{{Path: "/files", Dir: root, Name: "files"}},
+		}
+	}
+	fs := filesystem.NewLocal(root, false)
+	handlers := map[string]struct {
+		handler http.Handler
+		prefix  string
+	}{
+		"file":      {handler: NewFile(fs, newConfig("default"), logger)},
+		"advanced":  {handler: NewAdvancedFile(fs, newConfig("advanced"))},
+		"streaming": {handler: NewAdvancedFile(streamingFS{fs}, newConfig("advanced"))},
+		"multi_dir": {handler: NewMultiDir(newConfig("advanced").Dirs, newConfig("advanced"), logger), prefix: "/files"},
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", `inline; filename="report.pdf"`},
+		{"?download=0", `inline; filename="report.pdf"`},
+		{"?download=1", `attachment; filename="report.pdf"`},
+		{"?dl=1", `attachment; filename="report.pdf"`},
+	}
+
+	for name, hc := range handlers {
+		etags := map[string]bool{}
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			for _, tt := range tests {
+				t.Run(name+"/"+method+tt.query, func(t *testing.T) {
+					rr := httptest.NewRecorder()
+					hc.handler.ServeHTTP(rr, httptest.NewRequest(method, hc.prefix+"/report.pdf"+tt.query, nil))
+					if rr.Code != http.StatusOK {
+						t.Fatalf("expected 200, got %d", rr.Code)
+					}
+					if got := rr.Header().Get("Content-Disposition"); got != tt.want {
+						t.Errorf("expected %q, got %q", tt.want, got)
+					}
+					etags[rr.Header().Get("ETag")] = true
+				})
+			}
+		}
+		if len(etags) != 1 {
+			t.Errorf("%s: expected the same ETag with and without the parameter, got %v", name, etags)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	download := httptest.NewRequest(http.MethodGet, "/?download=1", nil)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"notes.txt", `attachment; filename="notes.txt"`},
+		{"résumé 2024.pdf", `attachment; filename="r_sum_ 2024.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%202024.pdf`},
+		{`say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(download, tt.name); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDownloadLinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fs := filesystem.NewLocal(root, false)
+
+	for name, h := range map[string]http.Handler{
+		"default":  NewFile(fs, &config.Config{Theme: "default"}, logger),
+		"advanced": NewAdvancedFile(fs, &config.Config{Theme: "advanced"}),
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		body := rr.Body.String()
+		if !strings.Contains(body, `href="./a.txt?download=1"`) {
+			t.Errorf("%s: expected a download link for a.txt", name)
+		}
+		if strings.Contains(body, "docs?download=1") || strings.Contains(body, "docs/?download=1") {
+			t.Errorf("%s: expected no download link for a directory", name)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package handler
+
+import (
+	"archive/zip"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// ExtractRequest is the body of POST /api/extract. The ZIP archive at Path
+// is extracted into the directory Dest, which defaults to the archive's own
+// directory and is created if missing. Existing files are only replaced
+// with Overwrite.
+type ExtractRequest struct {
+	Path      string `json:"path"`
+	Dest      string `json:"dest,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// ExtractResponse holds one result per archive entry, in archive order, with
+// paths relative to Dest. Like the bulk endpoints it is 200 even when some
+// entries failed; callers check each result.
+type ExtractResponse struct {
+	Dest      string       `json:"dest"`
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Size      int64        `json:"size"` // Bytes written
+}
+
+// ExtractRejectedResponse is returned for an archive refused before anything
+// is extracted: with the entries whose names would land outside Dest or
+// break --max-path-depth or --max-name-length, or with the extraction limit
+// it exceeds, "entries" or "size".
+type ExtractRejectedResponse struct {
+	Error  string   `json:"error"`
+	Unsafe []string `json:"unsafe,omitempty"`
+	Limit  string   `json:"limit,omitempty"`
+	Max    int64    `json:"max,omitempty"`
+}
+
+var (
+	errExtractTooLarge = errors.New("extraction size limit exceeded")
+	errExtractSymlink  = errors.New("symbolic links are not extracted")
+)
+
+// extractLimits bounds what one extraction writes.
+type extractLimits struct {
+	maxEntries int
+	maxSize    int64
+}
+
+// extractLimitsFor returns the configured extraction limits, falling back
+// to the defaults for unset values.
+func extractLimitsFor(cfg *config.Config) extractLimits {
+	limits := extractLimits{
+		maxEntries: constants.DefaultExtractMaxEntries,
+		maxSize:    constants.DefaultExtractMaxSize,
+	}
+	if cfg.ExtractMaxEntries > 0 {
+		limits.maxEntries = cfg.ExtractMaxEntries
+	}
+	if cfg.ExtractMaxSize > 0 {
+		limits.maxSize = cfg.ExtractMaxSize
+	}
+	return limits
+}
+
+// extractEntry is an archive entry that passed the checks, with its name
+// cleaned.
+type extractEntry struct {
+	file *zip.File
+	name string
+}
+
+// handleExtract extracts a ZIP archive of the mount into a directory of it.
+// Every entry name is checked before anything is written: absolute names,
+// names with ".." and names over the path limits are refused with the whole
+// archive, as are archives with more entries or more declared bytes than
+// the limits allow. The declared sizes are also enforced while writing, and
+// files are written the way uploads are, so versions, the upload scanner and
+// the quota apply.
+func (h *AdvancedFile) handleExtract(w http.ResponseWriter, r *http.Request) {
+	var req ExtractRequest
+	if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if err := validateRequestPaths([]string{req.Path, req.Dest}, 2); err != nil {
+		writeRequestPathsError(w, err, 2)
+		return
+	}
+	name, err := pathsafe.Clean(req.Path)
+	if err != nil || name == "" {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	dest := path.Dir(name)
+	if req.Dest != "" {
+		if dest, err = pathsafe.Clean(req.Dest); err != nil {
+			middleware.WriteJSONError(w, "Invalid destination", http.StatusBadRequest)
+			return
+		}
+	}
+	if dest == "." {
+		dest = ""
+	}
+
+	archive, closer, err := h.openZip(name)
+	if err != nil {
+		h.writeExtractOpenError(w, r, err)
+		return
+	}
+	defer closer.Close()
+
+	// Re-root dest first, so the path limits apply where entries land
+	dest, ok := h.uploadDestination(w, r, dest)
+	if !ok {
+		return
+	}
+	limits := extractLimitsFor(h.config)
+	entries, total, ok := checkExtractEntries(w, archive, dest, limits, pathLimits(h.config))
+	if !ok {
+		return
+	}
+	if dest != "" {
+		if err := mkdirAll(h.fs, dest); err != nil {
+			h.writeExtractDestError(w, r, err)
+			return
+		}
+	}
+	var reserved int64
+	if h.quota != nil {
+		if err := h.quota.Reserve(total); err != nil {
+			h.writeQuotaFailure(w, r, err)
+			return
+		}
+		reserved = total
+	}
+
+	response := ExtractResponse{Dest: dest, Results: make([]BulkResult, 0, len(entries))}
+	remaining := limits.maxSize
+	for _, entry := range entries {
+		written, err := h.extractEntry(r.Context(), entry, dest, req.Overwrite, &remaining)
+		response.Size += written
+		result := BulkResult{Path: entry.name, OK: err == nil}
+		if err != nil {
+			result.Error = h.extractErrorMessage(entry.name, err)
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+		response.Results = append(response.Results, result)
+	}
+	if h.quota != nil && reserved > response.Size {
+		h.quota.Release(reserved - response.Size)
+	}
+
+	h.logger.Info("Archive extracted",
+		slog.String("path", name),
+		slog.String("dest", dest),
+		slog.Int("succeeded", response.Succeeded),
+		slog.Int("failed", response.Failed),
+		slog.Int64("size", response.Size))
+	if err := middleware.WriteJSON(w, response); err != nil {
+		h.logger.Warn("Failed to write extract response",
+			slog.String("path", name),
+			slog.String("error", err.Error()))
+	}
+}
+
+// openZip opens the archive name of the mount for reading.
+func (h *AdvancedFile) openZip(name string) (*zip.Reader, io.Closer, error) {
+	info, err := h.fs.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return nil, nil, zip.ErrFormat
+	}
+	file, err := internal.OpenSeeker(h.fs, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	ra, ok := file.(io.ReaderAt)
+	if !ok {
+		ra = &seekReaderAt{r: file}
+	}
+	archive, err := zip.NewReader(ra, info.Size())
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+	return archive, file, nil
+}
+
+// checkExtractEntries cleans the entry names of archive and checks them
+// against limits, and their paths below dest against paths, returning
+// the entries and the bytes they declare. It writes the error response and
+// returns false if the archive is refused.
+func checkExtractEntries(w http.ResponseWriter, archive *zip.Reader, dest string, limits extractLimits,
+	paths pathsafe.Limits,
+) ([]extractEntry, int64, bool) {
+	var unsafe, overLimit []string
+	var overLimitErr error
+	entries := make([]extractEntry, 0, len(archive.File))
+	var total int64
+	for _, f := range archive.File {
+		name, ok := extractEntryName(f.Name)
+		if !ok {
+			if len(unsafe) < constants.MaxExtractUnsafeReported {
+				unsafe = append(unsafe, f.Name)
+			}
+			continue
+		}
+		if err := paths.Check(path.Join(dest, name)); err != nil {
+			overLimitErr = cmp.Or(overLimitErr, err)
+			if len(overLimit) < constants.MaxExtractUnsafeReported {
+				overLimit = append(overLimit, f.Name)
+			}
+			continue
+		}
+		entries = append(entries, extractEntry{file: f, name: name})
+		if !f.FileInfo().IsDir() {
+			total += int64(min(f.UncompressedSize64, uint64(limits.maxSize)+1))
+		}
+	}
+
+	var rejected *ExtractRejectedResponse
+	status := http.StatusRequestEntityTooLarge
+	switch {
+	case len(unsafe) > 0:
+		rejected = &ExtractRejectedResponse{Error: "Archive has entries outside the destination", Unsafe: unsafe}
+		status = http.StatusBadRequest
+	case len(overLimit) > 0:
+		rejected = &ExtractRejectedResponse{Error: pathLimitMessage(overLimitErr, paths), Unsafe: overLimit}
+		status = http.StatusBadRequest
+	case len(entries) > limits.maxEntries:
+		rejected = &ExtractRejectedResponse{Error: "Archive has too many entries", Limit: "entries",
+			Max: int64(limits.maxEntries)}
+	case total > limits.maxSize:
+		rejected = &ExtractRejectedResponse{Error: "Archive expands beyond the extraction limit", Limit: "size",
+			Max: limits.maxSize}
+	}
+	if rejected != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(rejected)
+		return nil, 0, false
+	}
+	return entries, total, true
+}
+
+// extractEntryName returns the path below the destination that the entry
+// raw is extracted to, and false if it would land anywhere else: names that
+// are absolute, carry a drive letter or have a ".." segment, with either
+// slash. A trailing slash is kept for directories.
+func extractEntryName(raw string) (string, bool) {
+	name := strings.ReplaceAll(raw, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", false
+	}
+	for segment := range strings.SplitSeq(name, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+	clean, err := pathsafe.Clean(name)
+	if err != nil || clean == "" {
+		return "", false
+	}
+	if strings.HasSuffix(name, "/") {
+		clean += "/"
+	}
+	return clean, true
+}
+
+// extractEntry writes entry below dest and returns the bytes written. Files
+// count against remaining, the bytes the extraction may still write; once
+// it runs out, this and every later file fail with errExtractTooLarge.
+func (h *AdvancedFile) extractEntry(ctx context.Context, entry extractEntry, dest string, overwrite bool,
+	remaining *int64,
+) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	target := path.Join(dest, entry.name)
+	mode := entry.file.Mode()
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return 0, errExtractSymlink
+	case mode.IsDir():
+		return 0, mkdirAll(h.fs, target)
+	case *remaining < 0:
+		return 0, errExtractTooLarge
+	}
+
+	if info, err := h.fs.Stat(target); err == nil && (!overwrite || info.IsDir()) {
+		return 0, errBulkExists
+	}
+	if err := mkdirAll(h.fs, path.Dir(target)); err != nil {
+		return 0, err
+	}
+	src, err := entry.file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	counted := &extractBudget{r: src, remaining: remaining}
+	if err := h.saveUploadedFile(ctx, counted, target, nil, entry.file.Modified); err != nil {
+		return 0, err
+	}
+	return counted.n, nil
+}
+
+// extractErrorMessage turns err into a per-entry message like the bulk
+// endpoints do.
+func (h *AdvancedFile) extractErrorMessage(name string, err error) string {
+	var rejected *scanRejectedError
+	switch {
+	case errors.Is(err, errExtractTooLarge):
+		return "Extraction size limit exceeded"
+	case errors.Is(err, errExtractSymlink):
+		return "Symbolic links are not extracted"
+	case errors.Is(err, errNotDirectory):
+		return "A file exists in the entry's path"
+	case errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrChecksum), errors.Is(err, zip.ErrAlgorithm):
+		return "Corrupt or unsupported entry"
+	case errors.As(err, &rejected):
+		return "Rejected: " + rejected.message
+	}
+	return h.bulkErrorMessage(name, err)
+}
+
+// writeExtractOpenError answers a request whose archive cannot be read.
+func (h *AdvancedFile) writeExtractOpenError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *internal.APIError
+	switch {
+	case errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrAlgorithm), errors.Is(err, zip.ErrInsecurePath):
+		middleware.WriteJSONError(w, "Not a ZIP archive", http.StatusBadRequest)
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound:
+		middleware.WriteJSONError(w, "Archive not found", http.StatusNotFound)
+	default:
+		h.reporter().JSONError(w, r, "Cannot read archive", http.StatusInternalServerError, err)
+	}
+}
+
+// writeExtractDestError answers a request whose destination cannot be
+// created.
+func (h *AdvancedFile) writeExtractDestError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errNotDirectory):
+		middleware.WriteJSONError(w, "A file exists in the destination's path", http.StatusConflict)
+	case errors.Is(err, filesystem.ErrReadonly):
+		writeReadonly(w, r)
+	default:
+		h.reporter().JSONError(w, r, "Cannot create destination", http.StatusInternalServerError, err)
+	}
+}
+
+// extractBudget counts the bytes read from an entry against the bytes the
+// extraction may still write, failing with errExtractTooLarge past them.
+type extractBudget struct {
+	r         io.Reader
+	remaining *int64
+	n         int64
+}
+
+func (b *extractBudget) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if *b.remaining -= int64(n); *b.remaining < 0 {
+		return n, errExtractTooLarge
+	}
+	return n, err
+}
+
+// seekReaderAt reads at offsets of a file that can only seek, for backends
+// whose files do not implement io.ReaderAt.
+type seekReaderAt struct {
+	mu sync.Mutex
+	r  io.ReadSeeker
+}
+
+func (s *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(s.r, p)
+}
@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// zipEntry is a file of a test archive; a name ending in "/" is a directory.
+type zipEntry struct {
+	name    string
+	content string
+}
+
+// writeTestZip writes an archive of entries to dir/name.
+func writeTestZip(t *testing.T, dir, name string, entries ...zipEntry) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+		if strings.HasSuffix(e.name, "/") {
+			header.Method = zip.Store
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", e.name, err)
+		}
+		if _, err := w.Write([]byte(e.content)); err != nil {
+			t.Fatalf("Failed to write %s: %v", e.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close archive: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+}
+
+func postExtract(t *testing.T, h *AdvancedFile, req ExtractRequest) (*httptest.ResponseRecorder, ExtractResponse) {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/extract", bytes.NewReader(body))
+	httpReq.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httpReq)
+
+	var resp ExtractResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+	}
+	return rr, resp
+}
+
+func TestAdvancedFile_Extract(t *testing.T) {
+	root := t.TempDir()
+	writeTestZip(t, root, "site.zip",
+		zipEntry{name: "index.html", content: "<h1>hi</h1>"},
+		zipEntry{name: "assets/"},
+		zipEntry{name: "assets/css/main.css", content: "body{}"},
+		zipEntry{name: `assets\js\app.js`, content: "run()"},
+	)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	rr, resp := postExtract(t, h, ExtractRequest{Path: "site.zip", Dest: "out"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if resp.Dest != "out" || resp.Succeeded != 4 || resp.Failed != 0 || resp.Size != int64(len("<h1>hi</h1>body{}run()")) {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	want := []string{"index.html", "assets/", "assets/css/main.css", "assets/js/app.js"}
+	for i, result := range resp.Results {
+		if result.Path != want[i] || !result.OK {
+			t.Errorf("result %d: expected %s ok, got %+v", i, want[i], result)
+		}
+	}
+	for name, content := range map[string]string{
+		"out/index.html": "<h1>hi</h1>", "out/assets/css/main.css": "body{}", "out/assets/js/app.js": "run()",
+	} {
+		if data, err := os.ReadFile(filepath.Join(root, name)); err != nil || string(data) != content {
+			t.Errorf("%s: expected %q, got %q (%v)", name, content, data, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(root, "out", "index.html")); err != nil ||
+		!info.ModTime().Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("extracted files should keep the archive's modification time, got %v (%v)", info.ModTime(), err)
+	}
+
+	// Existing files are only replaced with overwrite
+	if err := os.WriteFile(filepath.Join(root, "out", "index.html"), []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, resp = postExtract(t, h, ExtractRequest{Path: "site.zip", Dest: "out"})
+	if resp.Results[0].OK || resp.Results[0].Error != "Destination already exists" || resp.Failed != 3 {
+		t.Errorf("expected existing files to be kept, got %+v", resp)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "out", "index.html")); string(data) != "mine" {
+		t.Errorf("file replaced without overwrite: %q", data)
+	}
+	_, resp = postExtract(t, h, ExtractRequest{Path: "site.zip", Dest: "out", Overwrite: true})
+	if resp.Failed != 0 {
+		t.Errorf("expected overwrite to succeed, got %+v", resp)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "out", "index.html")); string(data) != "<h1>hi</h1>" {
+		t.Errorf("file not replaced with overwrite: %q", data)
+	}
+
+	// Without dest the archive is extracted next to itself
+	rr, resp = postExtract(t, h, ExtractRequest{Path: "/site.zip"})
+	if rr.Code != http.StatusOK || resp.Dest != "" || resp.Failed != 0 {
+		t.Fatalf("expected extraction into the root, got %d %+v", rr.Code, resp)
+	}
+	if _, err := os.Stat(filepath.Join(root, "assets", "css", "main.css")); err != nil {
+		t.Errorf("expected assets/css/main.css in the root: %v", err)
+	}
+}
+
+func TestAdvancedFile_ExtractZipSlip(t *testing.T) {
+	root := t.TempDir()
+	mount := filepath.Join(root, "mount")
+	if err := os.Mkdir(mount, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestZip(t, mount, "evil.zip",
+		zipEntry{name: "fine.txt", content: "fine"},
+		zipEntry{name: "../evil.txt", content: "evil"},
+		zipEntry{name: "/abs.txt", content: "evil"},
+		zipEntry{name: `..\..\win.txt`, content: "evil"},
+		zipEntry{name: "C:/drive.txt", content: "evil"},
+		zipEntry{name: "a/../../up.txt", content: "evil"},
+	)
+	h := NewAdvancedFile(filesystem.NewLocal(mount, false), &config.Config{Theme: "advanced"})
+
+	rr, _ := postExtract(t, h, ExtractRequest{Path: "evil.zip", Dest: "out"})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp ExtractRejectedResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := []string{"../evil.txt", "/abs.txt", `..\..\win.txt`, "C:/drive.txt", "a/../../up.txt"}
+	if strings.Join(resp.Unsafe, "|") != strings.Join(want, "|") {
+		t.Errorf("expected unsafe entries %q, got %q", want, resp.Unsafe)
+	}
+	for _, name := range []string{"evil.txt", "mount/out", "mount/fine.txt", "win.txt", "up.txt"} {
+		if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s must not be written for a refused archive", name)
+		}
+	}
+}
+
+func TestAdvancedFile_ExtractPathLimits(t *testing.T) {
+	root := t.TempDir()
+	deep := strings.Repeat("d/", 9) + "deep.txt"
+	long := strings.Repeat("n", 21) + ".txt"
+	writeTestZip(t, root, "deep.zip", zipEntry{name: "fine.txt", content: "fine"}, zipEntry{name: deep, content: "x"})
+	writeTestZip(t, root, "long.zip", zipEntry{name: "fine.txt", content: "fine"}, zipEntry{name: long, content: "x"})
+	writeTestZip(t, root, "ok.zip", zipEntry{name: strings.Repeat("d/", 8) + "ok.txt", content: "ok"})
+	h := NewAdvancedFile(filesystem.NewLocal(root, false),
+		&config.Config{Theme: "advanced", MaxPathDepth: 10, MaxNameLength: 24})
+
+	testCases := []struct {
+		archive string
+		entry   string
+		error   string
+	}{
+		// The destination counts towards the depth
+		{"deep.zip", deep, "Path too deep, at most 10 segments"},
+		{"long.zip", long, "Name too long, at most 24 bytes per path segment"},
+	}
+	for _, tc := range testCases {
+		rr, _ := postExtract(t, h, ExtractRequest{Path: tc.archive, Dest: "out"})
+		var resp ExtractRejectedResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", tc.archive, err)
+		}
+		if rr.Code != http.StatusBadRequest || resp.Error != tc.error || len(resp.Unsafe) != 1 ||
+			resp.Unsafe[0] != tc.entry {
+			t.Errorf("%s: expected 400 %q for %s, got %d %s", tc.archive, tc.error, tc.entry, rr.Code, rr.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "out")); !os.IsNotExist(err) {
+		t.Error("nothing may be written for an archive over the path limits")
+	}
+
+	if rr, resp := postExtract(t, h, ExtractRequest{Path: "ok.zip", Dest: "out"}); rr.Code != http.StatusOK ||
+		resp.Succeeded != 1 {
+		t.Errorf("expected an archive within the limits to extract, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Limits apply where the entries land, below the per-user directory
+	h = NewAdvancedFile(filesystem.NewLocal(root, false),
+		&config.Config{Theme: "advanced", MaxPathDepth: 10, MaxNameLength: 24, UserUploadDirs: true})
+	if rr, _ := postExtract(t, h, ExtractRequest{Path: "ok.zip", Dest: "out"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected the re-rooted destination to count, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdvancedFile_ExtractLimits(t *testing.T) {
+	root := t.TempDir()
+	bomb := strings.Repeat("\x00", 64<<10)
+	writeTestZip(t, root, "bomb.zip", zipEntry{name: "zeros.bin", content: bomb})
+	writeTestZip(t, root, "many.zip", zipEntry{name: "a"}, zipEntry{name: "b"}, zipEntry{name: "c"})
+	if info, err := os.Stat(filepath.Join(root, "bomb.zip")); err != nil || info.Size() >= 4<<10 {
+		t.Fatalf("expected a small archive, got %v (%v)", info, err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false),
+		&config.Config{Theme: "advanced", ExtractMaxSize: 32 << 10, ExtractMaxEntries: 2})
+
+	testCases := []struct {
+		archive string
+		limit   string
+		max     int64
+	}{
+		{"bomb.zip", "size", 32 << 10},
+		{"many.zip", "entries", 2},
+	}
+	for _, tc := range testCases {
+		rr, _ := postExtract(t, h, ExtractRequest{Path: tc.archive, Dest: "out"})
+		var resp ExtractRejectedResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", tc.archive, err)
+		}
+		if rr.Code != http.StatusRequestEntityTooLarge || resp.Limit != tc.limit || resp.Max != tc.max {
+			t.Errorf("%s: expected 413 %s %d, got %d %s", tc.archive, tc.limit, tc.max, rr.Code, rr.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "out")); !os.IsNotExist(err) {
+		t.Error("nothing may be written for an archive over the limits")
+	}
+}
+
+func TestAdvancedFile_ExtractBudget(t *testing.T) {
+	// The bytes written are counted across entries, whatever the headers
+	// declared, and the entry that goes over the limit is not kept
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"first.bin", "second.bin"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(bytes.Repeat([]byte{0}, 24<<10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "lying.zip"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make([]extractEntry, 0, len(archive.File))
+	for _, f := range archive.File {
+		entries = append(entries, extractEntry{file: f, name: f.Name})
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	remaining := int64(32 << 10)
+	results := make([]error, 0, len(entries))
+	for _, entry := range entries {
+		_, err := h.extractEntry(t.Context(), entry, "out", false, &remaining)
+		results = append(results, err)
+	}
+	if results[0] != nil || !errors.Is(results[1], errExtractTooLarge) {
+		t.Errorf("expected the second file to trip the limit, got %v", results)
+	}
+	if _, err := os.Stat(filepath.Join(root, "out", "second.bin")); !os.IsNotExist(err) {
+		t.Error("a file over the limit must not be kept")
+	}
+}
+
+func TestAdvancedFile_ExtractReadonly(t *testing.T) {
+	root := t.TempDir()
+	writeTestZip(t, root, "a.zip", zipEntry{name: "a.txt", content: "a"})
+	h := NewAdvancedFile(filesystem.NewReadonly(filesystem.NewLocal(root, false)), &config.Config{Theme: "advanced"})
+
+	rr, _ := postExtract(t, h, ExtractRequest{Path: "a.zip"})
+	var resp ReadonlyErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusForbidden ||
+		resp.Code != ReadonlyErrorCode {
+		t.Errorf("expected 403 %s, got %d %s", ReadonlyErrorCode, rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); !os.IsNotExist(err) {
+		t.Error("a read-only mount must not be written")
+	}
+}
+
+func TestExtractEntryName(t *testing.T) {
+	testCases := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"a.txt", "a.txt", true},
+		{"dir/", "dir/", true},
+		{"./dir/a.txt", "dir/a.txt", true},
+		{`dir\a.txt`, "dir/a.txt", true},
+		{"../a.txt", "", false},
+		{"dir/../../a.txt", "", false},
+		{"dir/../a.txt", "", false},
+		{"/etc/passwd", "", false},
+		{`\a.txt`, "", false},
+		{"C:/a.txt", "", false},
+		{"", "", false},
+	}
+	for _, tc := range testCases {
+		got, ok := extractEntryName(tc.raw)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("extractEntryName(%q) = %q, %v; want %q, %v", tc.raw, got, ok, tc.want, tc.ok)
+		}
+	}
+}
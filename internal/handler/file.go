@@ -1,53 +1,119 @@
 package handler
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"html/template"
 	"io"
 	"log/slog"
 	"net/http"
 	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/samzong/gofs/internal"
 	"github.com/samzong/gofs/internal/config"
 	"github.com/samzong/gofs/internal/handler/templates"
+	"github.com/samzong/gofs/internal/listing"
 	"github.com/samzong/gofs/internal/middleware"
 	"github.com/samzong/gofs/pkg/fileutil"
 	"github.com/samzong/gofs/pkg/httprange"
+	"github.com/samzong/gofs/pkg/pathsafe"
 )
 
+// ListingResponse is the JSON directory listing of the default theme.
+type ListingResponse struct {
+	Path  string        `json:"path"`
+	Files []ListingItem `json:"files"`
+}
+
+// ListingItem is one entry of a ListingResponse.
+type ListingItem struct {
+	Owner   *FileOwner `json:"owner,omitempty"`
+	Name    string     `json:"name"`
+	ModTime string     `json:"modTime"` // RFC 3339
+	Mode    string     `json:"mode"`    // Octal permissions, e.g. "0644"
+	Symlink string     `json:"symlink,omitempty"`
+	Size    int64      `json:"size"`
+	IsDir   bool       `json:"isDir"`
+	Kind    string     `json:"kind"` // folder, image, video, archive, code, document or file
+	// Entries of a directory, counted up to 1000; unset for files and
+	// directories that cannot be read
+	ChildCount          *int `json:"childCount,omitempty"`
+	ChildCountTruncated bool `json:"childCountTruncated,omitempty"` // More entries than childCount
+}
+
 type File struct {
-	fs     internal.FileSystem
-	config *config.Config
-	logger *slog.Logger
+	fs         internal.FileSystem
+	config     *config.Config
+	logger     *slog.Logger
+	manifests  *manifestBuilder
+	dirConfigs *dirConfigCache // nil unless --dir-config is enabled
+	children   *childCounter
+	flights    *coalescer         // Shared by the manifests, child counts and ETags
+	page       *template.Template // Renders listings; templates.DirectoryTemplate
 }
 
 func NewFile(fs internal.FileSystem, cfg *config.Config, logger *slog.Logger) *File {
-	return &File{
-		fs:     fs,
-		config: cfg,
-		logger: logger,
+	flights := newCoalescer()
+	h := &File{
+		fs:        fs,
+		config:    cfg,
+		logger:    logger,
+		manifests: newManifestBuilder(fs, cfg.ShowHidden, flights),
+		children:  newChildCounter(fs, cfg, flights),
+		flights:   flights,
+		page:      templates.DirectoryTemplate,
+	}
+	if cfg.DirConfig {
+		h.dirConfigs = newDirConfigCache(fs)
+		// Cached manifests and child counts are shared between requests, so
+		// they leave out every subtree that needs a credential
+		h.manifests = newManifestBuilder(newDirConfigFS(fs, h.dirConfigs, ""), cfg.ShowHidden, flights)
+		h.children = newChildCounter(newDirConfigFS(fs, h.dirConfigs, ""), cfg, flights)
 	}
+	return h
 }
 
 func (h *File) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	// Apply security headers
+	securityConfig := middleware.SecurityConfigFor(h.config)
+	middleware.SecurityHeaders(securityConfig)(http.HandlerFunc(h.serve)).ServeHTTP(w, r)
+}
+
+func (h *File) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	// Apply security headers
-	securityConfig := middleware.SecurityConfig{
-		EnableSecurity: h.config.EnableSecurity,
+	if h.dirConfigs != nil {
+		h = h.forRequest(r)
 	}
-	middleware.SecurityHeaders(securityConfig)(http.HandlerFunc(h.handleGet)).ServeHTTP(w, r)
+	h.handleGet(w, r)
+}
+
+// forRequest returns a copy of h whose filesystem applies the .gofs.yaml
+// directives with the request's credentials.
+func (h *File) forRequest(r *http.Request) *File {
+	scoped := *h
+	scoped.fs = newDirConfigFS(h.fs, h.dirConfigs, r.Header.Get("Authorization"))
+	return &scoped
+}
+
+// fileAPIRoutes maps the /api endpoints of the default theme to their
+// handlers; other paths are served from the filesystem. Every path must be
+// described by apiOperations.
+var fileAPIRoutes = map[string]func(*File, http.ResponseWriter, *http.Request){
+	"/api/capabilities": func(h *File, w http.ResponseWriter, r *http.Request) { serveCapabilities(w, r, h.config, h.fs) },
+	"/api/openapi.json": func(h *File, w http.ResponseWriter, r *http.Request) { serveOpenAPI(w, r, h.config) },
+	"/api/manifest": func(h *File, w http.ResponseWriter, r *http.Request) {
+		serveManifest(w, r, h.manifests, h.reporter())
+	},
+	"/api/changes": func(h *File, w http.ResponseWriter, r *http.Request) {
+		serveChanges(w, r, h.fs, h.config, h.reporter())
+	},
 }
 
 func (h *File) handleGet(w http.ResponseWriter, r *http.Request) {
@@ -56,269 +122,149 @@ func (h *File) handleGet(w http.ResponseWriter, r *http.Request) {
 		path = "/"
 	}
 
-	safePath := middleware.SafeRequestPath(path)
-
-	info, err := h.fs.Stat(safePath)
-	if err != nil {
-		http.NotFound(w, r)
+	if route, ok := fileAPIRoutes[path]; ok {
+		route(h, w, r)
 		return
 	}
 
-	if info.IsDir() {
-		h.handleDirectory(w, r, safePath)
-		return
-	}
-
-	h.handleFile(w, r, safePath)
-}
-
-func (h *File) handleDirectory(w http.ResponseWriter, r *http.Request, path string) {
-	files, err := h.fs.ReadDir(path)
+	safePath, err := pathsafe.Clean(path)
 	if err != nil {
-		http.Error(w, "Cannot read directory", http.StatusInternalServerError)
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
 
-	sort.Slice(files, func(i, j int) bool {
-		if files[i].IsDir() && !files[j].IsDir() {
-			return true
-		}
-		if !files[i].IsDir() && files[j].IsDir() {
-			return false
-		}
-		return strings.ToLower(files[i].Name()) < strings.ToLower(files[j].Name())
-	})
-
-	if strings.Contains(r.Header.Get("Accept"), "application/json") {
-		h.renderJSON(w, path, files)
+	index, ok := dirAccess(w, r, h.fs, safePath, h.reporter())
+	if !ok {
 		return
 	}
 
-	h.renderHTML(w, path, files, h.config.Theme)
-}
-
-func (h *File) handleFile(w http.ResponseWriter, r *http.Request, path string) {
-	file, err := h.fs.Open(path)
+	info, err := h.fs.Stat(safePath)
 	if err != nil {
-		http.Error(w, "Cannot open file", http.StatusInternalServerError)
+		if !writeUnavailable(w, r, h.reporter(), err) {
+			http.NotFound(w, r)
+		}
 		return
 	}
-	defer h.closeFile(file, path)
-
-	info, err := h.fs.Stat(path)
-	if err != nil {
-		http.Error(w, "Cannot stat file", http.StatusInternalServerError)
+	if !canonicalSlash(w, r, safePath, info.IsDir()) {
 		return
 	}
 
-	if info.Size() > h.config.MaxFileSize {
-		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+	if info.IsDir() {
+		if indexFile(r, h.fs, index) != nil {
+			h.handleFile(w, r, index)
+			return
+		}
+		h.handleDirectory(w, r, safePath)
 		return
 	}
 
-	// Generate ETag based on content hash if file supports seeking
-	var etag string
-	if seeker, ok := file.(io.ReadSeeker); ok {
-		var err error
-		etag, err = h.generateContentETag(seeker)
-		if err != nil {
-			h.logger.Warn("Failed to generate content-based ETag",
-				slog.String("path", path),
-				slog.String("error", err.Error()),
-			)
-			// Use fallback ETag based on file metadata
-			etag = fmt.Sprintf(`"gofs-%x-%x-%x"`,
-				[]byte(path),
-				info.Size(),
-				info.ModTime().Unix())
-		}
-	} else {
-		// Use fallback ETag for non-seekable files
-		etag = fmt.Sprintf(`"gofs-%x-%x-%x"`,
-			[]byte(path),
-			info.Size(),
-			info.ModTime().Unix())
-	}
+	h.handleFile(w, r, safePath)
+}
 
-	// Check If-None-Match header for conditional requests
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if match == etag {
-			w.WriteHeader(http.StatusNotModified)
-			return
+func (h *File) handleDirectory(w http.ResponseWriter, r *http.Request, path string) {
+	l, err := readListing(r.Context(), h.fs, path, listingOptions(h.config))
+	if err != nil {
+		if !writeUnavailable(w, r, h.reporter(), err) {
+			h.reporter().Error(w, r, "Cannot read directory", http.StatusInternalServerError, err)
 		}
+		return
 	}
 
-	rangeHeader := r.Header.Get("Range")
-	rng, err := httprange.ParseRange(rangeHeader, info.Size())
-	if err != nil {
-		if err == httprange.ErrUnsatisfiableRange {
-			httprange.WriteRangeNotSatisfiable(w, info.Size())
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Add("Vary", "Accept")
+		if !checkListingConditions(w, r, l) {
 			return
 		}
-		rng = nil
-	}
-
-	mimeType := fileutil.DetectMimeType(path)
-
-	seeker, seekable := file.(io.ReadSeeker)
-	if !seekable && rng != nil {
-		h.logger.Debug("File doesn't support seeking, serving full content",
-			slog.String("path", path),
-			slog.String("component", "file_handler"),
-		)
-		rng = nil
+		h.renderJSON(w, r, path, l.Entries)
+		return
 	}
 
-	if rng != nil {
-		h.logger.Debug("Serving partial content",
-			slog.String("path", path),
-			slog.Int64("start", rng.Start),
-			slog.Int64("end", rng.End),
-			slog.Int64("length", rng.Length),
-			slog.String("component", "file_handler"),
-		)
-
-		filename := filepath.Base(path)
-		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
-		w.Header().Set("ETag", etag)
+	h.renderHTML(w, r, path, l.Entries, h.config.Theme)
+}
 
-		if err := httprange.ServeContent(w, seeker, rng, info.Size(), mimeType); err != nil {
-			h.logger.Warn("Error serving partial content",
-				slog.String("path", path),
-				slog.String("error", err.Error()),
-				slog.String("component", "file_handler"),
-			)
-		}
-	} else {
-		h.setFileHeaders(w, path, info, etag)
-		if err := httprange.ServeFullContent(w, file, info.Size(), mimeType); err != nil {
-			h.logger.Warn("Error serving full content",
-				slog.String("path", path),
-				slog.String("error", err.Error()),
-				slog.String("component", "file_handler"),
-			)
-		}
-	}
+func (h *File) handleFile(w http.ResponseWriter, r *http.Request, path string) {
+	fileServer{fs: h.fs, config: h.config, logger: h.logger, reporter: h.reporter(), flights: h.flights,
+		component: "file_handler"}.serve(w, r, path)
 }
 
-func (h *File) closeFile(file io.ReadCloser, path string) {
-	if err := file.Close(); err != nil {
-		h.logger.Warn("File close failed",
-			slog.String("path", path),
-			slog.String("error", err.Error()),
-			slog.String("component", "file_handler"),
-		)
+// logCopyError logs a response body that could not be sent in full. Clients
+// going away mid-download is routine, so that is only logged at debug level.
+func logCopyError(logger *slog.Logger, msg string, err error, attrs ...slog.Attr) {
+	level := slog.LevelWarn
+	if errors.Is(err, httprange.ErrClientAborted) {
+		level = slog.LevelDebug
 	}
+	logger.LogAttrs(context.Background(), level, msg, append(attrs, slog.String("error", err.Error()))...)
 }
 
-func (h *File) setFileHeaders(w http.ResponseWriter, path string, info internal.FileInfo, etag string) {
-	filename := filepath.Base(path)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
-	w.Header().Set("Content-Type", fileutil.DetectMimeType(path))
-	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
-	w.Header().Set("ETag", etag)
+// reporter renders error responses without leaking internal details.
+func (h *File) reporter() middleware.ErrorReporter {
+	return middleware.ErrorReporter{Logger: h.logger, Debug: h.config.DebugErrors}
 }
 
-func (h *File) generateContentETag(file io.ReadSeeker) (string, error) {
-	// Save current position
-	currentPos, err := file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return "", err
+// setCacheControl applies the configured Cache-Control rule for path, if any.
+func setCacheControl(w http.ResponseWriter, cfg *config.Config, path string) {
+	if directive := cfg.CacheControlFor(path); directive != "" {
+		w.Header().Set("Cache-Control", directive)
 	}
+}
 
-	// Seek to beginning
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return "", err
+// detectContentType returns the Content-Type for path, sniffing the start of
+// file when neither the configured overrides nor the extension settle it.
+// The body must be served from the returned reader, which replays the sniffed
+// bytes if file cannot seek back to its start.
+func detectContentType(cfg *config.Config, path string, file io.ReadSeeker) (string, io.Reader) {
+	mimeType := fileutil.DetectContentMimeType(path, nil, cfg.MimeTypes)
+	if _, overridden := cfg.MimeTypes[strings.ToLower(filepath.Ext(path))]; overridden ||
+		mimeType != "application/octet-stream" {
+		return mimeType, file
 	}
 
-	// Calculate SHA-256 hash
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		return "", err
+	head := make([]byte, fileutil.SniffLen)
+	n, err := io.ReadFull(file, head)
+	head = head[:n]
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return mimeType, io.MultiReader(bytes.NewReader(head), file)
 	}
-
-	// Restore original position
-	if _, err := file.Seek(currentPos, io.SeekStart); err != nil {
-		return "", err
+	mimeType = fileutil.DetectContentMimeType(path, head, cfg.MimeTypes)
+	if _, err := file.Seek(0, io.SeekStart); err == nil {
+		return mimeType, file
 	}
-
-	hash := hex.EncodeToString(hasher.Sum(nil))
-	return fmt.Sprintf(`"%s"`, hash), nil
+	return mimeType, io.MultiReader(bytes.NewReader(head), file)
 }
 
-func (h *File) renderJSON(w http.ResponseWriter, path string, files []internal.FileInfo) {
-	type FileItem struct {
-		Name    string `json:"name"`
-		ModTime string `json:"modTime"`
-		Size    int64  `json:"size"`
-		IsDir   bool   `json:"isDir"`
-	}
-
-	items := make([]FileItem, 0, len(files))
-	for _, file := range files {
-		items = append(items, FileItem{
-			Name:    file.Name(),
-			Size:    file.Size(),
-			IsDir:   file.IsDir(),
-			ModTime: file.ModTime().Format(time.RFC3339),
+func (h *File) renderJSON(w http.ResponseWriter, r *http.Request, path string, entries []listing.Entry) {
+	items := make([]ListingItem, 0, len(entries))
+	for _, e := range entries {
+		childCount, truncated := h.children.childCountJSON(path, e)
+		items = append(items, ListingItem{
+			Name:                e.Name,
+			Size:                e.Size,
+			IsDir:               e.IsDir,
+			ModTime:             e.ModTime.Format(time.RFC3339),
+			Mode:                e.Mode,
+			Symlink:             e.Symlink,
+			Owner:               e.Owner,
+			Kind:                string(e.Kind),
+			ChildCount:          childCount,
+			ChildCountTruncated: truncated,
 		})
 	}
 
-	response := map[string]any{
-		"path":  path,
-		"files": items,
+	response := ListingResponse{
+		Path:  path,
+		Files: items,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "JSON encoding error", http.StatusInternalServerError)
+		h.reporter().Error(w, r, "JSON encoding error", http.StatusInternalServerError, err)
 		return
 	}
 }
 
-func (h *File) renderHTML(w http.ResponseWriter, path string, files []internal.FileInfo, theme string) {
-	type FileItem struct {
-		Name  string
-		Size  string
-		IsDir bool
-	}
-
-	items := make([]FileItem, 0, len(files))
-	for _, file := range files {
-		size := ""
-		if !file.IsDir() {
-			size = fileutil.FormatSize(file.Size())
-		}
-		items = append(items, FileItem{
-			Name:  file.Name(),
-			IsDir: file.IsDir(),
-			Size:  size,
-		})
-	}
-
-	// Security: Get validated CSS from embedded themes only. The theme parameter
-	// is validated against a whitelist in config validation, and GetThemeCSS
-	// only returns CSS from embedded files compiled into the binary.
-	themeCSS := templates.GetThemeCSS(theme)
-
-	data := struct {
-		Path   string
-		Files  []FileItem
-		Parent bool
-		CSS    template.CSS
-		Theme  string
-	}{
-		Path:   "/" + path,
-		Parent: path != "",
-		Files:  items,
-		CSS:    template.CSS(themeCSS), // #nosec G203 - CSS comes from embedded files only, theme is validated
-		Theme:  theme,
-	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-	if err := templates.DirectoryTemplate.Execute(w, data); err != nil {
-		http.Error(w, "Template execution error", http.StatusInternalServerError)
-		return
+func (h *File) renderHTML(w http.ResponseWriter, r *http.Request, path string, entries []listing.Entry, theme string) {
+	if err := renderPage(w, h.page, classicPageData(path, entries, theme, h.children)); err != nil {
+		h.reporter().Error(w, r, "Template execution error", http.StatusInternalServerError, err)
 	}
 }
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -10,9 +12,11 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/samzong/gofs/internal/config"
 	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
 )
 
 func TestFileHandler_RangeRequest(t *testing.T) {
@@ -33,7 +37,7 @@ func TestFileHandler_RangeRequest(t *testing.T) {
 	// Setup the handler
 	fs := filesystem.NewLocal(tempDir, false)
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100, // 100MB
+		MaxHashSize: 1024 * 1024 * 100, // 100MB
 		Theme:       "default",
 	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -166,7 +170,7 @@ func TestFileHandler_RangeRequestLargeFile(t *testing.T) {
 	// Setup handler
 	fs := filesystem.NewLocal(tempDir, false)
 	cfg := &config.Config{
-		MaxFileSize: 10 * 1024 * 1024, // 10MB
+		MaxHashSize: 10 * 1024 * 1024, // 10MB
 		Theme:       "default",
 	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -248,7 +252,7 @@ func TestFileHandler_MultipleRangeNotSupported(t *testing.T) {
 	// Setup handler
 	fs := filesystem.NewLocal(tempDir, false)
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024,
+		MaxHashSize: 1024 * 1024,
 		Theme:       "default",
 	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -356,7 +360,7 @@ func TestFileHandler_DirectoryListing(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := filesystem.NewLocal(tempDir, tt.showHidden)
 			cfg := &config.Config{
-				MaxFileSize: 1024 * 1024,
+				MaxHashSize: 1024 * 1024,
 				Theme:       tt.theme,
 				ShowHidden:  tt.showHidden,
 			}
@@ -414,7 +418,7 @@ func TestFileHandler_SecurityHeaders(t *testing.T) {
 
 	fs := filesystem.NewLocal(tempDir, false)
 	cfg := &config.Config{
-		MaxFileSize:    1024 * 1024,
+		MaxHashSize:    1024 * 1024,
 		Theme:          "default",
 		EnableSecurity: true,
 	}
@@ -489,7 +493,7 @@ func TestFileHandler_ErrorHandling(t *testing.T) {
 
 	fs := filesystem.NewLocal(tempDir, false)
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024, // 1MB limit
+		MaxHashSize: 1024 * 1024, // 1MB limit
 		Theme:       "default",
 	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -508,10 +512,11 @@ func TestFileHandler_ErrorHandling(t *testing.T) {
 			expectedStatus: http.StatusNotFound,
 		},
 		{
-			name:           "file_too_large",
+			// MaxHashSize does not limit downloads
+			name:           "file_larger_than_max_file_size",
 			path:           "/large.txt",
 			method:         http.MethodGet,
-			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedStatus: http.StatusOK,
 		},
 		{
 			name:           "method_not_allowed",
@@ -550,6 +555,54 @@ func TestFileHandler_ErrorHandling(t *testing.T) {
 	}
 }
 
+func TestFileHandler_ErrorsDoNotLeakPaths(t *testing.T) {
+	secretPath := "/srv/private/customer-data"
+	leakyErr := fmt.Errorf("open %s: permission denied", secretPath)
+
+	tests := []struct {
+		name string
+		fs   *mockFileSystem
+		path string
+	}{
+		{
+			name: "read_dir_failure",
+			fs:   &mockFileSystem{statIsDir: true, readDirError: leakyErr},
+			path: "/",
+		},
+		{
+			name: "open_failure",
+			fs:   &mockFileSystem{openError: leakyErr},
+			path: "/file.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, debug := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s_debug_%v", tt.name, debug), func(t *testing.T) {
+				cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "default", DebugErrors: debug}
+				var logs bytes.Buffer
+				logger := slog.New(slog.NewTextHandler(&logs, nil))
+				handler := NewFile(tt.fs, cfg, logger)
+
+				req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, req)
+
+				if recorder.Code != http.StatusInternalServerError {
+					t.Fatalf("Expected status 500, got %d", recorder.Code)
+				}
+				leaked := strings.Contains(recorder.Body.String(), secretPath)
+				if leaked != debug {
+					t.Errorf("debug=%v: body %q leaked path = %v", debug, recorder.Body.String(), leaked)
+				}
+				if !strings.Contains(logs.String(), secretPath) {
+					t.Errorf("Expected the underlying error to be logged, got %q", logs.String())
+				}
+			})
+		}
+	}
+}
+
 func TestFileHandler_ContentTypes(t *testing.T) {
 	// Create a temporary directory
 	tempDir, err := os.MkdirTemp("", "gofs-content-type-test-*")
@@ -569,7 +622,8 @@ func TestFileHandler_ContentTypes(t *testing.T) {
 		"test.css":  {[]byte("body { color: red; }"), "text/css"},
 		"test.js":   {[]byte("console.log('test');"), "text/javascript"},
 		"image.png": {[]byte("PNG fake content"), "image/png"},
-		"unknown":   {[]byte("unknown content"), "application/octet-stream"},
+		"unknown":   {[]byte("unknown content"), "text/plain"}, // sniffed, no known extension
+		"blob":      {[]byte{0x00, 0x01, 0x02, 0xff}, "application/octet-stream"},
 	}
 
 	for filename, fileData := range testFiles {
@@ -581,7 +635,7 @@ func TestFileHandler_ContentTypes(t *testing.T) {
 
 	fs := filesystem.NewLocal(tempDir, false)
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024,
+		MaxHashSize: 1024 * 1024,
 		Theme:       "default",
 	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -634,30 +688,31 @@ func TestFileHandler_PathSecurity(t *testing.T) {
 
 	fs := filesystem.NewLocal(tempDir, false)
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024,
+		MaxHashSize: 1024 * 1024,
 		Theme:       "default",
 	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	handler := NewFile(fs, cfg, logger)
 
-	// Test various path traversal attempts - these should be sanitized by SafePath
+	// Traversal attempts are rejected rather than mapped to the root listing
 	tests := []struct {
 		name           string
 		path           string
 		expectedStatus int
 		description    string
 	}{
-		{"path_traversal_unix", "../../../etc/passwd", http.StatusOK, "Sanitized to empty string, shows root directory"},
-		{
-			"path_traversal_windows", "..\\..\\..\\windows\\system32\\config\\sam",
-			http.StatusOK, "Sanitized to empty string, shows root directory",
-		},
+		{"path_traversal_unix", "../../../etc/passwd", http.StatusBadRequest, "Rejected"},
+		{"path_traversal_windows", "..\\..\\..\\windows\\system32\\config\\sam", http.StatusBadRequest, "Rejected"},
 		{"absolute_path", "/etc/passwd", http.StatusNotFound, "Becomes etc/passwd which doesn't exist"},
-		{"relative_traversal", "./../safe.txt", http.StatusOK, "Sanitized to empty string, shows root directory"},
-		{
-			"complex_traversal", "./safe.txt/../../etc/passwd",
-			http.StatusOK, "Sanitized to empty string, shows root directory",
-		},
+		{"relative_traversal", "./../safe.txt", http.StatusBadRequest, "Rejected"},
+		{"rooted_traversal", "/../safe.txt", http.StatusBadRequest, "Rejected"},
+		{"complex_traversal", "./safe.txt/../../etc/passwd", http.StatusBadRequest, "Rejected"},
+		{"encoded_traversal", "%2e%2e/safe.txt", http.StatusBadRequest, "Rejected after unescaping once"},
+		{"null_byte", "safe.txt%00.png", http.StatusBadRequest, "Rejected"},
+		{"double_slash", "//safe.txt", http.StatusOK, "Repeated slashes are collapsed"},
+		{"dot_segment", "./safe.txt", http.StatusOK, "Dot segments are collapsed"},
+		{"root", "", http.StatusOK, "The genuine root lists the directory"},
+		{"dot_root", "./", http.StatusOK, "Cleans to the root"},
 	}
 
 	for _, tt := range tests {
@@ -673,6 +728,12 @@ func TestFileHandler_PathSecurity(t *testing.T) {
 			if resp.StatusCode != tt.expectedStatus {
 				t.Errorf("Expected status %d for path %q (%s), got %d", tt.expectedStatus, tt.path, tt.description, resp.StatusCode)
 			}
+			if resp.StatusCode == http.StatusBadRequest {
+				var body middleware.ErrorResponse
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error != "Invalid path" {
+					t.Errorf("Expected the JSON error envelope, got %v (%v)", body, err)
+				}
+			}
 		})
 	}
 
@@ -696,3 +757,249 @@ func TestFileHandler_PathSecurity(t *testing.T) {
 		}
 	})
 }
+
+func TestCacheControlRules(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{"app.js": "js", "page.html": "<p>", "data.bin": "bin"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	rules, err := config.ParseCacheControlRules([]string{"*.js,*.css=public,max-age=86400", "*.html=no-cache"})
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	newConfig := func(theme string) *config.Config {
+		return &config.Config{
+			Theme:               theme,
+			MaxHashSize:         1 << 20,
+			RequestTimeout:      30,
+			CacheControl:        rules,
+			CacheControlDefault: "private, max-age=60",
+			Dirs:                []config.DirMount{{Path: "/files", Dir: root, Name: "files"}},
+		}
+	}
+	fs := filesystem.NewLocal(root, false)
+	handlers := map[string]struct {
+		handler http.Handler
+		prefix  string
+	}{
+		"file":      {handler: NewFile(fs, newConfig("default"), logger)},
+		"advanced":  {handler: NewAdvancedFile(fs, newConfig("advanced"))},
+		"multi_dir": {handler: NewMultiDir(newConfig("default").Dirs, newConfig("default"), logger), prefix: "/files"},
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: "/app.js", want: "public, max-age=86400"},
+		{file: "/page.html", want: "no-cache"},
+		{file: "/data.bin", want: "private, max-age=60"},
+	}
+
+	for name, hc := range handlers {
+		for _, tt := range tests {
+			t.Run(name+tt.file, func(t *testing.T) {
+				rr := httptest.NewRecorder()
+				hc.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, hc.prefix+tt.file, nil))
+				if rr.Code != http.StatusOK {
+					t.Fatalf("expected 200, got %d", rr.Code)
+				}
+				if got := rr.Header().Get("Cache-Control"); got != tt.want {
+					t.Errorf("expected Cache-Control %q, got %q", tt.want, got)
+				}
+			})
+		}
+	}
+
+	// A 304 carries the same directive as the full response
+	h := handlers["file"].handler
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/app.js", nil))
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag on the full response")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "public, max-age=86400" {
+		t.Errorf("expected Cache-Control on 304, got %q", got)
+	}
+
+	// Directory listings are not affected by file rules
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rr.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("expected no Cache-Control on listing, got %q", got)
+	}
+}
+
+func TestFileHandlers_SniffContentType(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0x01}, 1000)...)
+	files := map[string][]byte{
+		"screenshot": png,
+		"data.bin":   []byte("plain text despite the extension\n"),
+		"report.log": []byte("2024-01-01 started\n"),
+	}
+	root := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), content, 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	overrides := map[string]string{".log": "text/x-log"}
+	fs := filesystem.NewLocal(root, false)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := map[string]http.Handler{
+		"default":  NewFile(fs, &config.Config{MaxHashSize: 1 << 20, MimeTypes: overrides}, logger),
+		"advanced": NewAdvancedFile(fs, &config.Config{Theme: "advanced", MaxHashSize: 1 << 20, MimeTypes: overrides}),
+	}
+	expected := map[string]string{
+		"screenshot": "image/png",
+		"data.bin":   "text/plain; charset=utf-8",
+		"report.log": "text/x-log; charset=utf-8",
+	}
+
+	for theme, h := range handlers {
+		for name, want := range expected {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+name, nil))
+			if got := rr.Header().Get("Content-Type"); got != want {
+				t.Errorf("%s %s: expected %q, got %q", theme, name, want, got)
+			}
+			// Sniffing must not consume the start of the body
+			if !bytes.Equal(rr.Body.Bytes(), files[name]) {
+				t.Errorf("%s %s: body differs from the file", theme, name)
+			}
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/screenshot", nil)
+		req.Header.Set("Range", "bytes=0-7")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), png[:8]) {
+			t.Errorf("%s: unexpected range response %d %q", theme, rr.Code, rr.Body.Bytes())
+		}
+	}
+}
+
+func TestFileHandlers_ServeFilesLargerThanMaxFileSize(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256) // 4KB
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "video.mp4"), content, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	fs := filesystem.NewLocal(root, false)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := map[string]http.Handler{
+		"default":  NewFile(fs, &config.Config{MaxHashSize: 1024}, logger),
+		"advanced": NewAdvancedFile(fs, &config.Config{Theme: "advanced", MaxHashSize: 1024}),
+	}
+
+	for theme, h := range handlers {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/video.mp4", nil))
+		if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), content) {
+			t.Errorf("%s: expected the full file, got %d with %d bytes", theme, rr.Code, rr.Body.Len())
+		}
+		if etag := rr.Header().Get("ETag"); theme == "default" && !strings.HasPrefix(etag, `"gofs-`) {
+			t.Errorf("%s: expected a metadata ETag instead of hashing a large file, got %s", theme, etag)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/video.mp4", nil)
+		req.Header.Set("Range", "bytes=2048-3071")
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), content[2048:3072]) {
+			t.Errorf("%s: expected 1KB of partial content, got %d with %d bytes", theme, rr.Code, rr.Body.Len())
+		}
+	}
+}
+
+func TestFileHandler_HotCache(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "app.js")
+	if err := os.WriteFile(path, []byte("console.log(1)"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{MaxHashSize: 1 << 20}
+	uncached := NewFile(filesystem.NewLocal(root, false), cfg, logger)
+	cache := filesystem.NewHotCache(1<<20, 64<<10)
+	cached := NewFile(filesystem.NewCached(filesystem.NewLocal(root, false), cache), cfg, logger)
+
+	get := func(h http.Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/app.js", nil))
+		return rr
+	}
+
+	want := get(uncached)
+	for range 2 {
+		rr := get(cached)
+		if rr.Body.String() != "console.log(1)" {
+			t.Fatalf("expected the file content, got %q", rr.Body.String())
+		}
+		for _, header := range []string{"ETag", "Content-Length", "Content-Type"} {
+			if got := rr.Header().Get(header); got != want.Header().Get(header) {
+				t.Errorf("expected %s %q as without the cache, got %q", header, want.Header().Get(header), got)
+			}
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("console.log(2)"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	rr := get(cached)
+	if rr.Body.String() != "console.log(2)" || rr.Header().Get("ETag") == want.Header().Get("ETag") {
+		t.Errorf("expected the changed file with a new ETag, got %q (%s)", rr.Body.String(), rr.Header().Get("ETag"))
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("expected 1 hit and 2 misses, got %+v", stats)
+	}
+}
+
+func BenchmarkFileHandler_HotCache(b *testing.B) {
+	root := b.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256) // 4KB
+	if err := os.WriteFile(filepath.Join(root, "bundle.js"), content, 0o644); err != nil {
+		b.Fatalf("Failed to write file: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{MaxHashSize: 1 << 20}
+	local := filesystem.NewLocal(root, false)
+	handlers := map[string]http.Handler{
+		"disk":   NewFile(local, cfg, logger),
+		"cached": NewFile(filesystem.NewCached(local, filesystem.NewHotCache(1<<20, 64<<10)), cfg, logger),
+	}
+
+	for name, h := range handlers {
+		b.Run(name, func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, "/bundle.js", nil)
+			b.ReportAllocs()
+			for b.Loop() {
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+				if rr.Code != http.StatusOK {
+					b.Fatalf("expected 200, got %d", rr.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func TestDirectoryListing_FileKinds(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "photo.png", "clip.mp4", "backup.zip", "main.go", "paper.pdf", "data.bin")
+	writeFiles(t, filepath.Join(root, "photos"))
+	want := map[string]string{
+		"photos": "folder", "photo.png": "image", "clip.mp4": "video", "backup.zip": "archive",
+		"main.go": "code", "paper.pdf": "document", "data.bin": "file",
+	}
+
+	fs := filesystem.NewLocal(root, false)
+	handlers := map[string]http.Handler{
+		"advanced": NewAdvancedFile(fs, &config.Config{Theme: "advanced"}),
+		"default":  NewFile(fs, &config.Config{Theme: "default"}, slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}
+	for name, h := range handlers {
+		t.Run(name, func(t *testing.T) {
+			page := getPath(h, "/", nil).Body.String()
+			if !strings.Contains(page, `<symbol id="icon-archive"`) {
+				t.Error("Expected the page to embed the icon sprite")
+			}
+			for file, kind := range want {
+				// Each entry's icon follows its link
+				i := strings.Index(page, `href="./`+file)
+				if i < 0 {
+					t.Fatalf("%s not listed", file)
+				}
+				icon := `<svg class="icon icon-` + kind + `"`
+				if j := strings.Index(page[i:], "<svg "); j < 0 || !strings.HasPrefix(page[i+j:], icon) {
+					t.Errorf("%s: expected the icon %s", file, icon)
+				}
+			}
+
+			var resp struct {
+				Files []struct {
+					Name string `json:"name"`
+					Kind string `json:"kind"`
+				} `json:"files"`
+			}
+			rr := getPath(h, "/", http.Header{"Accept": {"application/json"}})
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Invalid JSON: %v", err)
+			}
+			for _, f := range resp.Files {
+				if f.Kind != want[f.Name] {
+					t.Errorf("%s: expected kind %q, got %q", f.Name, want[f.Name], f.Kind)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// The advanced theme works without JavaScript through plain HTML forms that
+// POST to the listed directory with ?form=upload, ?form=folder or ?form=zip.
+// They carry the CSRF token rendered into the page in a hidden csrf_token
+// field, and answer 303 See Other back to the directory with ?flash=<code>
+// naming the outcome, which the page shows as a message. ZIP downloads are
+// streamed in place instead.
+
+// FormFlash is an outcome message shown at the top of a listing.
+type FormFlash struct {
+	Text  string
+	Error bool
+}
+
+// formFlashes maps the flash codes of form redirects to their message.
+// Messages with %s are given the name parameter.
+var formFlashes = map[string]FormFlash{
+	"uploaded":     {Text: "Uploaded %s"},
+	"folder":       {Text: "Created folder %s"},
+	"upload-fail":  {Text: "The upload failed, please try again", Error: true},
+	"folder-fail":  {Text: "The folder could not be created", Error: true},
+	"no-file":      {Text: "Choose a file to upload", Error: true},
+	"no-selection": {Text: "Select at least one item to download", Error: true},
+	"invalid-name": {Text: "Invalid name", Error: true},
+	"quota":        {Text: "Not enough storage space left", Error: true},
+	"too-large":    {Text: "The file is too large to upload", Error: true},
+	"busy":         {Text: "Too many uploads in progress, please try again later", Error: true},
+	"expired":      {Text: "The page has expired, please try again", Error: true},
+	"readonly":     {Text: "This folder is read-only", Error: true},
+}
+
+// formFlashFor returns the message named by the flash and name query
+// parameters of r, or nil if there is none.
+func formFlashFor(r *http.Request) *FormFlash {
+	flash, ok := formFlashes[r.URL.Query().Get("flash")]
+	if !ok {
+		return nil
+	}
+	if strings.Contains(flash.Text, "%s") {
+		flash.Text = fmt.Sprintf(flash.Text, r.URL.Query().Get("name"))
+	}
+	return &flash
+}
+
+// statusCapture stands in for the ResponseWriter of the JSON handlers a form
+// reuses, keeping only the status of the response they write.
+type statusCapture struct {
+	header http.Header
+	status int
+}
+
+func newStatusCapture() *statusCapture {
+	return &statusCapture{header: http.Header{}}
+}
+
+func (c *statusCapture) Header() http.Header { return c.header }
+
+func (c *statusCapture) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return len(p), nil
+}
+
+func (c *statusCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+// failure returns the flash code of the error response written to c, with
+// fallback for the errors that have none of their own.
+func (c *statusCapture) failure(fallback string) string {
+	switch c.status {
+	case http.StatusInsufficientStorage:
+		return "quota"
+	case http.StatusRequestEntityTooLarge:
+		return "too-large"
+	case http.StatusTooManyRequests:
+		return "busy"
+	}
+	return fallback
+}
+
+// handleForm serves the form submissions of the listing of directory
+// r.URL.Path.
+func (h *AdvancedFile) handleForm(w http.ResponseWriter, r *http.Request) {
+	dir, err := pathsafe.Clean(r.URL.Path)
+	if err != nil {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if _, ok := dirAccess(w, r, h.fs, dir, h.reporter()); !ok {
+		return
+	}
+	if info, err := h.fs.Stat(dir); err != nil || !info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	action := r.URL.Query().Get("form")
+	switch action {
+	case "upload", "folder":
+		if h.readonly(r) {
+			h.formRedirect(w, r, dir, "readonly", "")
+			return
+		}
+	case "zip":
+	default:
+		http.Error(w, "Unknown form", http.StatusBadRequest)
+		return
+	}
+
+	if action == "upload" {
+		// Acquire before the token check parses the body, as /api/upload does
+		capture := newStatusCapture()
+		if !h.acquireUploadSlot(capture) {
+			h.formRedirect(w, r, dir, "busy", "")
+			return
+		}
+		defer h.releaseUploadSlot()
+	}
+	if err := h.checkCSRF(r); err != nil {
+		h.logger.Warn("CSRF check failed",
+			slog.String("method", r.Method),
+			slog.String("path", middleware.LogPath(r, middleware.OriginalPath(r))),
+			slog.String("reason", err.Error()))
+		h.formRedirect(w, r, dir, "expired", "")
+		return
+	}
+
+	switch action {
+	case "upload":
+		h.handleUploadForm(w, r, dir)
+	case "folder":
+		h.handleFolderForm(w, r, dir)
+	case "zip":
+		paths := r.PostForm["path"]
+		if len(paths) == 0 {
+			h.formRedirect(w, r, dir, "no-selection", "")
+			return
+		}
+		h.serveZip(w, r, ZipRequest{Paths: paths, Name: r.PostFormValue("name")})
+	}
+}
+
+// handleUploadForm stores the files of the upload form in dir.
+func (h *AdvancedFile) handleUploadForm(w http.ResponseWriter, r *http.Request, dir string) {
+	if r.MultipartForm == nil || len(r.MultipartForm.File["file"]) == 0 {
+		h.formRedirect(w, r, dir, "no-file", "")
+		return
+	}
+	files := r.MultipartForm.File["file"]
+	landed := dir
+	for _, header := range files {
+		filename, err := pathLimits(h.config).Clean(path.Join(dir, header.Filename))
+		if err != nil || header.Filename == "" {
+			h.formRedirect(w, r, dir, "invalid-name", "")
+			return
+		}
+		capture := newStatusCapture()
+		filename, ok := h.uploadDestination(capture, r, filename)
+		if !ok {
+			h.formRedirect(w, r, dir, "upload-fail", "")
+			return
+		}
+		if h.config.UserUploadDirs {
+			landed = path.Dir(filename)
+		}
+		file, err := header.Open()
+		if err != nil {
+			h.logger.Warn("Failed to open form upload",
+				slog.String("filename", filename),
+				slog.String("error", err.Error()))
+			h.formRedirect(w, r, dir, "upload-fail", "")
+			return
+		}
+		stored := h.storeUpload(capture, r, file, header.Size, filename, nil, time.Time{})
+		file.Close()
+		if !stored {
+			h.formRedirect(w, r, dir, capture.failure("upload-fail"), "")
+			return
+		}
+	}
+
+	name := path.Base(files[0].Filename)
+	if len(files) > 1 {
+		name = fmt.Sprintf("%d files", len(files))
+	}
+	// With per-user upload directories the user is sent to where the files went
+	h.formRedirect(w, r, landed, "uploaded", name)
+}
+
+// handleFolderForm creates the folder named by the folder form in dir.
+func (h *AdvancedFile) handleFolderForm(w http.ResponseWriter, r *http.Request, dir string) {
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	folder, err := pathLimits(h.config).Clean(path.Join(dir, name))
+	if err != nil || name == "" || len(name) > constants.MaxRequestPathLength || folder == dir {
+		h.formRedirect(w, r, dir, "invalid-name", "")
+		return
+	}
+
+	capture := newStatusCapture()
+	folder, ok := h.uploadDestination(capture, r, folder)
+	if !ok || !h.makeFolder(capture, r, folder) {
+		h.formRedirect(w, r, dir, capture.failure("folder-fail"), "")
+		return
+	}
+	h.logger.Info("Folder created successfully",
+		slog.String("folder", folder))
+	if h.config.UserUploadDirs {
+		dir = path.Dir(folder)
+	}
+	h.formRedirect(w, r, dir, "folder", name)
+}
+
+// formRedirect answers 303 See Other to the listing of dir, showing the
+// message of flash.
+func (h *AdvancedFile) formRedirect(w http.ResponseWriter, r *http.Request, dir, flash, name string) {
+	query := url.Values{"flash": {flash}}
+	if name != "" {
+		query.Set("name", name)
+	}
+	http.Redirect(w, r, dirURL(r, dir)+"?"+query.Encode(), http.StatusSeeOther)
+}
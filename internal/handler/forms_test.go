@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+var csrfFieldPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// formPage renders the listing at target and returns it with the CSRF token
+// of its forms, the way a browser without JavaScript sees it.
+func formPage(t *testing.T, h http.Handler, target string) (string, string) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET %s: expected 200, got %d", target, rr.Code)
+	}
+	match := csrfFieldPattern.FindStringSubmatch(rr.Body.String())
+	if match == nil {
+		t.Fatalf("GET %s: no CSRF field in the page", target)
+	}
+	return rr.Body.String(), match[1]
+}
+
+func postForm(h http.Handler, target string, fields url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(fields.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func postUploadForm(t *testing.T, h http.Handler, target, token string, files map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if token != "" {
+		_ = mw.WriteField("csrf_token", token)
+	}
+	for name, content := range files {
+		part, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write([]byte(content))
+	}
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func assertFormRedirect(t *testing.T, rr *httptest.ResponseRecorder, want string) {
+	t.Helper()
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != want {
+		t.Fatalf("expected 303 to %s, got %d to %q: %s", want, rr.Code, rr.Header().Get("Location"), rr.Body.String())
+	}
+}
+
+func TestForms(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	page, token := formPage(t, h, "/docs/")
+	for _, form := range []string{`action="/docs/?form=upload"`, `action="/docs/?form=folder"`} {
+		if !strings.Contains(page, form) {
+			t.Errorf("expected the page to have the %s form", form)
+		}
+	}
+
+	t.Run("upload", func(t *testing.T) {
+		rr := postUploadForm(t, h, "/docs/?form=upload", token, map[string]string{"a.txt": "hello"})
+		assertFormRedirect(t, rr, "/docs/?flash=uploaded&name=a.txt")
+		if data, err := os.ReadFile(filepath.Join(root, "docs", "a.txt")); err != nil || string(data) != "hello" {
+			t.Errorf("expected docs/a.txt to be stored, got %q, %v", data, err)
+		}
+
+		page, _ := formPage(t, h, rr.Header().Get("Location"))
+		if !strings.Contains(page, `role="status">Uploaded a.txt</div>`) {
+			t.Error("expected the listing to confirm the upload")
+		}
+	})
+
+	t.Run("folder", func(t *testing.T) {
+		_, token := formPage(t, h, "/docs/")
+		rr := postForm(h, "/docs/?form=folder", url.Values{"csrf_token": {token}, "name": {"new folder"}})
+		assertFormRedirect(t, rr, "/docs/?flash=folder&name=new+folder")
+		if info, err := os.Stat(filepath.Join(root, "docs", "new folder")); err != nil || !info.IsDir() {
+			t.Errorf("expected docs/new folder to be created: %v", err)
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		page, token := formPage(t, h, "/docs/")
+		if !strings.Contains(page, `name="path" value="docs/a.txt"`) {
+			t.Fatal("expected a checkbox for docs/a.txt")
+		}
+		rr := postForm(h, "/docs/?form=zip", url.Values{"csrf_token": {token}, "path": {"docs/a.txt"}})
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+			t.Fatalf("expected a ZIP, got %d %s", rr.Code, rr.Body.String())
+		}
+		zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil || len(zr.File) != 1 || zr.File[0].Name != "a.txt" {
+			t.Fatalf("expected a.txt in the ZIP, got %v", err)
+		}
+		f, _ := zr.File[0].Open()
+		if data, _ := io.ReadAll(f); string(data) != "hello" {
+			t.Errorf("unexpected content %q", data)
+		}
+
+		_, token = formPage(t, h, "/docs/")
+		assertFormRedirect(t, postForm(h, "/docs/?form=zip", url.Values{"csrf_token": {token}}),
+			"/docs/?flash=no-selection")
+	})
+
+	t.Run("token", func(t *testing.T) {
+		// Missing and already used tokens send the user back to a fresh page
+		assertFormRedirect(t, postUploadForm(t, h, "/?form=upload", "", map[string]string{"b.txt": "x"}),
+			"/?flash=expired")
+		assertFormRedirect(t, postForm(h, "/?form=folder", url.Values{"csrf_token": {token}, "name": {"b"}}),
+			"/?flash=expired")
+		for _, name := range []string{"b.txt", "b"} {
+			if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+				t.Errorf("expected %s not to be created", name)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, token := formPage(t, h, "/")
+		assertFormRedirect(t, postForm(h, "/?form=folder", url.Values{"csrf_token": {token}, "name": {"  "}}),
+			"/?flash=invalid-name")
+		_, token = formPage(t, h, "/")
+		assertFormRedirect(t, postUploadForm(t, h, "/?form=upload", token, nil), "/?flash=no-file")
+		if rr := postForm(h, "/?form=rename", nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected an unknown form to be rejected, got %d", rr.Code)
+		}
+	})
+}
+
+func TestForms_Readonly(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := NewAdvancedFile(filesystem.NewReadonly(filesystem.NewLocal(root, false)), &config.Config{Theme: "advanced"})
+
+	page, token := formPage(t, h, "/")
+	if strings.Contains(page, "?form=upload") || !strings.Contains(page, `action="/?form=zip"`) {
+		t.Error("expected only the ZIP form on a read-only mount")
+	}
+	assertFormRedirect(t, postForm(h, "/?form=folder", url.Values{"csrf_token": {token}, "name": {"b"}}),
+		"/?flash=readonly")
+	rr := postForm(h, "/?form=zip", url.Values{"csrf_token": {token}, "path": {"a.txt"}})
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected ZIP downloads from a read-only mount, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// recordedResponse is a successful response kept for replay.
+type recordedResponse struct {
+	header http.Header
+	body   []byte
+	status int
+}
+
+// idempotencyEntry tracks one Idempotency-Key. response is nil while the
+// first request is still running.
+type idempotencyEntry struct {
+	done     chan struct{}
+	response *recordedResponse
+	expires  time.Time
+}
+
+// idempotencyStore remembers the responses to recent requests carrying an
+// Idempotency-Key so that retries get the original response instead of
+// repeating the write. Only successful responses are kept; a failed request
+// can be retried with the same key.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{entries: make(map[string]*idempotencyEntry)}
+}
+
+// begin returns the recorded response for key, or claims key and returns the
+// entry to finish. A request arriving while another with the same key runs
+// waits for it.
+func (s *idempotencyStore) begin(r *http.Request, key string) (*recordedResponse, *idempotencyEntry, error) {
+	for {
+		s.mu.Lock()
+		e, ok := s.entries[key]
+		if ok && e.response != nil && time.Now().After(e.expires) {
+			delete(s.entries, key)
+			ok = false
+		}
+		if !ok {
+			e = &idempotencyEntry{done: make(chan struct{})}
+			s.entries[key] = e
+			s.mu.Unlock()
+			return nil, e, nil
+		}
+		if e.response != nil {
+			s.mu.Unlock()
+			return e.response, nil, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-e.done:
+		case <-r.Context().Done():
+			return nil, nil, r.Context().Err()
+		}
+	}
+}
+
+// finish records resp for key, or forgets key if resp is nil, and wakes any
+// requests waiting on it.
+func (s *idempotencyStore) finish(key string, e *idempotencyEntry, resp *recordedResponse) {
+	s.mu.Lock()
+	if resp == nil {
+		delete(s.entries, key)
+	} else {
+		e.response = resp
+		e.expires = time.Now().Add(constants.IdempotencyKeyTTL)
+		s.pruneLocked()
+	}
+	s.mu.Unlock()
+	close(e.done)
+}
+
+// pruneLocked drops expired entries and, while the store is over its limit,
+// the completed entries closest to expiry.
+func (s *idempotencyStore) pruneLocked() {
+	if len(s.entries) <= constants.MaxIdempotencyKeys {
+		return
+	}
+	now := time.Now()
+	for key, e := range s.entries {
+		if e.response != nil && now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+	for len(s.entries) > constants.MaxIdempotencyKeys {
+		var oldestKey string
+		var oldest *idempotencyEntry
+		for key, e := range s.entries {
+			if e.response != nil && (oldest == nil || e.expires.Before(oldest.expires)) {
+				oldestKey, oldest = key, e
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(s.entries, oldestKey)
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
+
+// withIdempotency runs next at most once per Idempotency-Key on this
+// endpoint, replaying the recorded response to retries. Requests without the
+// header are passed straight through. Replays are answered before next runs,
+// so a retry carrying an already used CSRF token still gets the response.
+func (h *AdvancedFile) withIdempotency(w http.ResponseWriter, r *http.Request,
+	next func(http.ResponseWriter, *http.Request),
+) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		next(w, r)
+		return
+	}
+	if len(key) > constants.MaxIdempotencyKeyLength {
+		middleware.WriteJSONError(w, "Idempotency-Key too long", http.StatusBadRequest)
+		return
+	}
+	key = r.URL.Path + " " + key
+
+	resp, entry, err := h.idempotency.begin(r, key)
+	if err != nil {
+		middleware.WriteJSONError(w, "Request timeout", http.StatusRequestTimeout)
+		return
+	}
+	if resp != nil {
+		for name, values := range resp.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(resp.status)
+		_, _ = w.Write(resp.body)
+		return
+	}
+
+	rec := &responseRecorder{ResponseWriter: w}
+	var recorded *recordedResponse
+	defer func() { h.idempotency.finish(key, entry, recorded) }()
+	next(rec, r)
+	if rec.status >= 200 && rec.status < 300 {
+		recorded = &recordedResponse{header: rec.header, body: rec.body.Bytes(), status: rec.status}
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func TestAdvancedFile_UploadIdempotencyKey(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	upload := func(content string) *httptest.ResponseRecorder {
+		req := newUploadRequest(t, h, content, nil)
+		req.Header.Set("Idempotency-Key", "artifact-42")
+		req = req.WithContext(internal.WithMountInfo(req.Context(), "/builds", "Builds", false))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := upload("hello world")
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", first.Code, first.Body.String())
+	}
+	second := upload("different content")
+	if second.Code != http.StatusOK {
+		t.Fatalf("replay: expected 200, got %d: %s", second.Code, second.Body.String())
+	}
+
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("replay returned a different body:\n%s\n%s", first.Body.String(), second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected the replay to be marked")
+	}
+	if first.Header().Get("Location") != "/builds/hello.txt" || second.Header().Get("Location") != "/builds/hello.txt" {
+		t.Errorf("unexpected Location %q / %q", first.Header().Get("Location"), second.Header().Get("Location"))
+	}
+	var resp UploadResponse
+	if err := json.Unmarshal(first.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.URL != "/builds/hello.txt" {
+		t.Errorf("expected url /builds/hello.txt, got %q", resp.URL)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected one file on disk, got %d", len(entries))
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "hello.txt")); string(data) != "hello world" {
+		t.Errorf("replay must not rewrite the file, got %q", data)
+	}
+}
+
+func TestAdvancedFile_FolderIdempotencyKey(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	create := func(key, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/folder", strings.NewReader(`{"path":"new dir"}`))
+		req.Header.Set("X-CSRF-Token", token)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// A failed attempt is not remembered
+	if rr := create("mkdir-1", "bogus"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without a valid token, got %d", rr.Code)
+	}
+
+	token := h.csrfTokens.generateToken()
+	first := create("mkdir-1", token)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", first.Code, first.Body.String())
+	}
+	// The retry reuses the consumed token, as a client retrying after a
+	// network error would
+	second := create("mkdir-1", token)
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Errorf("replay: got %d %s, want %s", second.Code, second.Body.String(), first.Body.String())
+	}
+	var resp FolderResponse
+	if err := json.Unmarshal(first.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.URL != "/new%20dir/" || first.Header().Get("Location") != "/new%20dir/" {
+		t.Errorf("unexpected url %q, Location %q", resp.URL, first.Header().Get("Location"))
+	}
+
+	// The key is scoped to the endpoint and other keys run normally
+	if rr := create("mkdir-2", h.csrfTokens.generateToken()); rr.Code != http.StatusConflict {
+		t.Errorf("new key for an existing folder: expected 409, got %d", rr.Code)
+	}
+	if rr := create("", h.csrfTokens.generateToken()); rr.Code != http.StatusConflict {
+		t.Errorf("no key for an existing folder: expected 409, got %d", rr.Code)
+	}
+}
+
+func TestAdvancedFile_IdempotencyKeyTooLong(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), &config.Config{Theme: "advanced"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/folder", bytes.NewReader([]byte(`{"path":"x"}`)))
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	req.Header.Set("Idempotency-Key", strings.Repeat("k", 256))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/listing"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+var (
+	errListingSort  = errors.New("sort must be name, size or modTime")
+	errListingOrder = errors.New("order must be asc or desc")
+	errListingPage  = errors.New("page must be a number from 1")
+)
+
+// listingView is the order and page of a listing, from the sort, order and
+// page query parameters, so a pasted listing URL shows what its author saw.
+type listingView struct {
+	Sort  string // listing.SortName, listing.SortSize or listing.SortModTime
+	Order string // "asc" or "desc"
+	Page  int    // 1-based; 0 lists every entry
+}
+
+// listingPage is the part of a listing one view shows.
+type listingPage struct {
+	Entries []listing.Entry
+	Total   int // Entries of the whole listing
+	Pages   int // Pages of the whole listing; 0 when unpaged
+}
+
+// parseListingView reads the view of query. Absent parameters list every
+// entry by ascending name.
+func parseListingView(query url.Values) (listingView, error) {
+	v := listingView{Sort: listing.SortName, Order: "asc"}
+	switch s := query.Get("sort"); s {
+	case "":
+	case listing.SortName, listing.SortSize, listing.SortModTime:
+		v.Sort = s
+	default:
+		return v, errListingSort
+	}
+	switch o := query.Get("order"); o {
+	case "":
+	case "asc", "desc":
+		v.Order = o
+	default:
+		return v, errListingOrder
+	}
+	if p := query.Get("page"); p != "" {
+		page, err := strconv.Atoi(p)
+		if err != nil || page < 1 {
+			return v, errListingPage
+		}
+		v.Page = page
+	}
+	return v, nil
+}
+
+// sort orders the entries of l for v.
+func (v listingView) sort(l *listing.DirectoryListing) {
+	listing.SortBy(l.Entries, v.Sort, v.Order == "desc")
+}
+
+// page returns the entries of l on v's page, which is empty past the last
+// one.
+func (v listingView) page(l *listing.DirectoryListing) listingPage {
+	p := listingPage{Entries: l.Entries, Total: len(l.Entries)}
+	if v.Page == 0 {
+		return p
+	}
+	p.Pages = max(1, (p.Total+constants.ListingPageSize-1)/constants.ListingPageSize)
+	start := min((v.Page-1)*constants.ListingPageSize, p.Total)
+	p.Entries = l.Entries[start:min(start+constants.ListingPageSize, p.Total)]
+	return p
+}
+
+// pageURL returns the relative URL of page n of the listing r requested,
+// keeping its other query parameters.
+func pageURL(r *http.Request, n int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(n))
+	return "?" + query.Encode()
+}
+
+// writeListingViewError answers a listing request with invalid view
+// parameters in the format it asked for.
+func writeListingViewError(w http.ResponseWriter, r *http.Request, err error) {
+	message := "Invalid listing parameters: " + err.Error()
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		middleware.WriteJSONError(w, message, http.StatusBadRequest)
+		return
+	}
+	http.Error(w, message, http.StatusBadRequest)
+}
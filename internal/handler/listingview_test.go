@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+func TestParseListingView(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    listingView
+		wantErr error
+	}{
+		{"", listingView{Sort: "name", Order: "asc"}, nil},
+		{"sort=size&order=desc&page=2", listingView{Sort: "size", Order: "desc", Page: 2}, nil},
+		{"sort=modTime", listingView{Sort: "modTime", Order: "asc"}, nil},
+		{"sort=mtime", listingView{}, errListingSort},
+		{"order=up", listingView{}, errListingOrder},
+		{"page=0", listingView{}, errListingPage},
+		{"page=two", listingView{}, errListingPage},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := parseListingView(query)
+		if err != tt.wantErr || (err == nil && got != tt.want) {
+			t.Errorf("parseListingView(%q) = %+v, %v; want %+v, %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// getListing fetches the JSON listing at target from h.
+func getListing(t *testing.T, h http.Handler, target string) DirectoryResponse {
+	t.Helper()
+
+	rr := getPath(h, target, http.Header{"Accept": {"application/json"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET %s: expected 200, got %d %s", target, rr.Code, rr.Body.String())
+	}
+	var resp DirectoryResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return resp
+}
+
+func TestAdvancedFile_ListingURLs(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "a b.txt", "100%.txt", "what?#.txt", "ünï.txt")
+	writeFiles(t, filepath.Join(root, "sub dir"), "x.txt")
+	mounts := []config.DirMount{{Path: "/files", Dir: root}}
+	h := middleware.BasePath("/gofs", false)(
+		NewMultiDir(mounts, &config.Config{Theme: "advanced"}, slog.New(slog.DiscardHandler)))
+
+	want := map[string]string{
+		"a b.txt":    "/gofs/files/a%20b.txt",
+		"100%.txt":   "/gofs/files/100%25.txt",
+		"what?#.txt": "/gofs/files/what%3F%23.txt",
+		"ünï.txt":    "/gofs/files/%C3%BCn%C3%AF.txt",
+		"sub dir":    "/gofs/files/sub%20dir/",
+	}
+	resp := getListing(t, h, "/gofs/files/")
+	if len(resp.Files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), resp.Files)
+	}
+	for _, f := range resp.Files {
+		if f.URL != want[f.Name] {
+			t.Errorf("%q: expected URL %q, got %q", f.Name, want[f.Name], f.URL)
+		}
+		if rr := getPath(h, f.URL, nil); rr.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", f.URL, rr.Code)
+		}
+	}
+
+	nested := getListing(t, h, "/gofs/files/sub%20dir/")
+	if len(nested.Files) != 1 || nested.Files[0].URL != "/gofs/files/sub%20dir/x.txt" {
+		t.Errorf("Expected the nested file's URL, got %+v", nested.Files)
+	}
+
+	rr := getPath(h, "/gofs/files/", nil)
+	if !strings.Contains(rr.Body.String(), `data-url="/gofs/files/100%25.txt"`) {
+		t.Error("Expected the copy link button to carry the file's URL")
+	}
+}
+
+func TestAdvancedFile_ListingView(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, filepath.Join(root, "dir"), "x.txt")
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for name, size := range map[string]int{"a.txt": 3, "b.txt": 1, "c.txt": 3} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(strings.Repeat("x", size)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(root, name), base, base.Add(time.Duration(size)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	order := func(resp DirectoryResponse) []string {
+		var names []string
+		for _, f := range resp.Files {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"dir", "a.txt", "b.txt", "c.txt"}},
+		{"?order=desc", []string{"dir", "c.txt", "b.txt", "a.txt"}},
+		{"?sort=size&order=desc", []string{"dir", "a.txt", "c.txt", "b.txt"}},
+		{"?sort=modTime", []string{"dir", "b.txt", "a.txt", "c.txt"}},
+	}
+	for _, tt := range tests {
+		first := getListing(t, h, "/"+tt.query)
+		if got := order(first); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.query, tt.want, got)
+		}
+		for range 3 {
+			if again := getListing(t, h, "/"+tt.query); !reflect.DeepEqual(order(again), order(first)) {
+				t.Errorf("%q: repeated request reordered the files: %v", tt.query, order(again))
+			}
+		}
+	}
+
+	resp := getListing(t, h, "/?sort=size&order=desc")
+	if resp.Sort != "size" || resp.Order != "desc" || resp.Page != 0 || resp.Pages != 0 || resp.Total != 4 {
+		t.Errorf("Unexpected view in the response: %+v", resp)
+	}
+
+	for _, target := range []string{"/?sort=owner", "/?order=random", "/?page=-1"} {
+		if rr := getPath(h, target, http.Header{"Accept": {"application/json"}}); rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected 400, got %d", target, rr.Code)
+		}
+		if rr := getPath(h, target, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s as HTML: expected 400, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestAdvancedFile_ListingPages(t *testing.T) {
+	root := t.TempDir()
+	names := make([]string, constants.ListingPageSize+1)
+	for i := range names {
+		names[i] = fmt.Sprintf("f%04d.txt", i)
+	}
+	writeFiles(t, root, names...)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	first := getListing(t, h, "/?page=1&order=desc")
+	if first.Page != 1 || first.Pages != 2 || first.Total != len(names) || first.Count != constants.ListingPageSize {
+		t.Fatalf("Unexpected first page %d/%d of %d with %d files", first.Page, first.Pages, first.Total, first.Count)
+	}
+	if first.Files[0].Name != names[len(names)-1] {
+		t.Errorf("Expected the page to follow the order, got %q first", first.Files[0].Name)
+	}
+	last := getListing(t, h, "/?page=2&order=desc")
+	if last.Count != 1 || last.Files[0].Name != names[0] {
+		t.Errorf("Expected the remaining file on the last page, got %+v", last.Files)
+	}
+	if past := getListing(t, h, "/?page=3"); past.Count != 0 || past.Pages != 2 {
+		t.Errorf("Expected an empty page past the last one, got %d files of %d pages", past.Count, past.Pages)
+	}
+
+	rr := getPath(h, "/?order=desc&page=2", nil)
+	body := rr.Body.String()
+	if !strings.Contains(body, `href="?order=desc&amp;page=1" rel="prev"`) || strings.Contains(body, `rel="next"`) {
+		t.Errorf("Expected a link back to the first page keeping the order, got %s", body)
+	}
+}
@@ -0,0 +1,369 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // #nosec G501 - MD5SUMS manifests are for integrity checks only
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/internal/tracing"
+	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// manifestAlgorithms maps the supported algo values to their hash and the
+// conventional manifest file name.
+var manifestAlgorithms = map[string]struct {
+	newHash  func() hash.Hash
+	fileName string
+}{
+	"sha256": {newHash: sha256.New, fileName: "SHA256SUMS"},
+	"sha512": {newHash: sha512.New, fileName: "SHA512SUMS"},
+	"md5":    {newHash: md5.New, fileName: "MD5SUMS"}, // #nosec G401 - integrity only
+}
+
+var (
+	errManifestTooLarge = errors.New("manifest limits exceeded")
+	errNotDirectory     = errors.New("not a directory")
+)
+
+// manifestEntry is a file found while walking a directory for a manifest.
+type manifestEntry struct {
+	modTime time.Time
+	path    string
+	size    int64
+}
+
+type cachedManifest struct {
+	stamp string
+	body  []byte
+}
+
+// manifestBuilder produces checksum manifests ("digest  relative/path" lines)
+// for directory trees and caches them until any file in the tree changes.
+type manifestBuilder struct {
+	fs         internal.FileSystem
+	showHidden bool
+	flights    *coalescer // Merges concurrent builds of the same tree; may be nil
+	maxEntries int        // Most files walk collects
+
+	mu    sync.Mutex
+	cache map[string]cachedManifest
+}
+
+func newManifestBuilder(fs internal.FileSystem, showHidden bool, flights *coalescer) *manifestBuilder {
+	return &manifestBuilder{
+		fs:         fs,
+		showHidden: showHidden,
+		flights:    flights,
+		maxEntries: constants.MaxManifestEntries,
+		cache:      make(map[string]cachedManifest),
+	}
+}
+
+// Build returns the manifest for dir and a stamp identifying the state of the
+// tree it was computed from.
+func (b *manifestBuilder) Build(ctx context.Context, dir, algo string) ([]byte, string, error) {
+	alg, ok := manifestAlgorithms[algo]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported algorithm %q", algo)
+	}
+
+	info, err := b.fs.Stat(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if !info.IsDir() {
+		return nil, "", errNotDirectory
+	}
+
+	var entries []manifestEntry
+	if err := b.walk(ctx, dir, "", &entries); err != nil {
+		return nil, "", err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	if total > constants.MaxManifestSize {
+		return nil, "", errManifestTooLarge
+	}
+
+	// The stamp covers every file's path, size and mtime, so any change to
+	// the tree invalidates the cached digests.
+	stamper := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(stamper, "%s\x00%d\x00%d\n", e.path, e.size, e.modTime.UnixNano())
+	}
+	stamp := hex.EncodeToString(stamper.Sum(nil))
+	key := algo + ":" + dir
+
+	b.mu.Lock()
+	cached, ok := b.cache[key]
+	b.mu.Unlock()
+	if ok && cached.stamp == stamp {
+		return cached.body, stamp, nil
+	}
+
+	// Concurrent requests for the same state of the tree share one build.
+	// The build stops with the context of the request that started it, so
+	// the others start their own if theirs is still live.
+	for {
+		body, err := coalesce(b.flights, coalesceManifest, key+"\x00"+stamp, func() ([]byte, error) {
+			_, span := tracing.Start(ctx, "hash")
+			defer span.End()
+			span.SetAttr("gofs.path", "/"+dir)
+			span.SetAttr("gofs.files", len(entries))
+			body, err := b.hash(ctx, dir, key, stamp, entries, alg.newHash)
+			span.RecordError(err)
+			return body, err
+		})
+		if err != nil && ctx.Err() == nil && (errors.Is(err, context.Canceled) ||
+			errors.Is(err, context.DeadlineExceeded)) {
+			continue
+		}
+		return body, stamp, err
+	}
+}
+
+// hash digests entries below dir into a manifest and caches it under key.
+func (b *manifestBuilder) hash(ctx context.Context, dir, key, stamp string, entries []manifestEntry,
+	newHash func() hash.Hash,
+) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		digest, err := b.digest(ctx, path.Join(dir, e.path), newHash())
+		if err != nil {
+			return nil, fmt.Errorf("hashing %s: %w", e.path, err)
+		}
+		fmt.Fprintf(&buf, "%s  %s\n", digest, e.path)
+	}
+
+	b.mu.Lock()
+	if len(b.cache) >= constants.ManifestCacheEntries {
+		clear(b.cache)
+	}
+	b.cache[key] = cachedManifest{stamp: stamp, body: buf.Bytes()}
+	b.mu.Unlock()
+
+	return buf.Bytes(), nil
+}
+
+// walk collects the files below dir, skipping hidden entries and existing
+// manifest files, and enforces the entry limit.
+func (b *manifestBuilder) walk(ctx context.Context, dir, rel string, entries *[]manifestEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	files, err := b.fs.ReadDir(path.Join(dir, rel))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		name := path.Join(rel, f.Name())
+		if !b.showHidden && fileutil.IsHiddenPath(path.Join(dir, name)) {
+			continue
+		}
+		if f.IsDir() {
+			if err := b.walk(ctx, dir, name, entries); err != nil {
+				return err
+			}
+			continue
+		}
+		if isManifestFile(f.Name()) {
+			continue
+		}
+
+		*entries = append(*entries, manifestEntry{path: name, size: f.Size(), modTime: f.ModTime()})
+		if len(*entries) > b.maxEntries {
+			return errManifestTooLarge
+		}
+	}
+	return nil
+}
+
+func (b *manifestBuilder) digest(ctx context.Context, name string, h hash.Hash) (string, error) {
+	file, err := b.fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, &contextReader{ctx: ctx, r: file}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isManifestFile(name string) bool {
+	for _, alg := range manifestAlgorithms {
+		if name == alg.fileName {
+			return true
+		}
+	}
+	return false
+}
+
+// contextReader stops reading once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// serveManifest handles GET /api/manifest?path=...&algo=sha256.
+func serveManifest(w http.ResponseWriter, r *http.Request, b *manifestBuilder, reporter middleware.ErrorReporter) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	algo := strings.ToLower(r.URL.Query().Get("algo"))
+	if algo == "" {
+		algo = "sha256"
+	}
+	if _, ok := manifestAlgorithms[algo]; !ok {
+		http.Error(w, "Unsupported algorithm", http.StatusBadRequest)
+		return
+	}
+
+	dir, err := pathsafe.Clean(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), constants.ManifestTimeout)
+	defer cancel()
+
+	body, stamp, err := b.Build(ctx, dir, algo)
+	switch {
+	case err == nil:
+	case errors.Is(err, errManifestTooLarge):
+		http.Error(w, "Directory too large for a manifest", http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		reporter.Error(w, r, "Manifest generation timed out", http.StatusServiceUnavailable, err)
+		return
+	case errors.Is(err, errNotDirectory):
+		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	default:
+		var apiErr *internal.APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		reporter.Error(w, r, "Cannot build manifest", http.StatusInternalServerError, err)
+		return
+	}
+
+	etag := fmt.Sprintf(`"manifest-%s-%s"`, algo, stamp[:16])
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Disposition", contentDisposition(r, manifestAlgorithms[algo].fileName))
+	serveBytes(w, r, body, etag, "text/plain; charset=utf-8")
+}
+
+// ManifestWriter periodically writes a SHA256SUMS file at the root of a
+// writable mount, rewriting it only when the tree changes.
+type ManifestWriter struct {
+	builder  *manifestBuilder
+	fs       internal.FileSystem
+	logger   *slog.Logger
+	interval time.Duration
+	stamp    string
+}
+
+// NewManifestWriter returns a writer for the tree served by fs.
+func NewManifestWriter(fs internal.FileSystem, cfg *config.Config, logger *slog.Logger,
+	interval time.Duration,
+) *ManifestWriter {
+	return &ManifestWriter{
+		builder:  newManifestBuilder(fs, cfg.ShowHidden, nil),
+		fs:       fs,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run writes the manifest immediately and then on every interval until ctx
+// is done.
+func (m *ManifestWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.WriteOnce(ctx); err != nil && ctx.Err() == nil {
+			m.logger.Warn("Failed to write manifest", slog.String("error", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WriteOnce regenerates the manifest and replaces SHA256SUMS if the tree
+// changed since the last write.
+func (m *ManifestWriter) WriteOnce(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, constants.ManifestTimeout)
+	defer cancel()
+
+	body, stamp, err := m.builder.Build(ctx, "", "sha256")
+	if err != nil {
+		return err
+	}
+	if stamp == m.stamp {
+		return nil
+	}
+
+	name := manifestAlgorithms["sha256"].fileName
+	tmpName := "." + name + ".tmp"
+	dst, err := m.fs.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(body)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = m.fs.Rename(tmpName, name)
+	}
+	if err != nil {
+		_ = m.fs.Remove(tmpName)
+		return err
+	}
+
+	m.stamp = stamp
+	m.logger.Info("Manifest written", slog.String("file", name))
+	return nil
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// writeManifestTree creates files for manifest tests and returns the root.
+func writeManifestTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"release/app-linux.tar.gz":   "linux build",
+		"release/app-darwin.tar.gz":  "darwin build",
+		"release/notes/CHANGELOG.md": "# Changes",
+		"release/.secret":            "hidden",
+		"release/SHA256SUMS":         "stale manifest",
+		"other.txt":                  "outside",
+	})
+	return root
+}
+
+func sha256Line(t *testing.T, root, rel, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel), filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)
+}
+
+func TestManifest_Output(t *testing.T) {
+	root := writeManifestTree(t)
+	cfg := &config.Config{Theme: "default", MaxHashSize: 1 << 20}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewFile(filesystem.NewLocal(root, false), cfg, logger)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/manifest?path=release&algo=sha256", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	want := sha256Line(t, root, "release", "app-darwin.tar.gz") +
+		sha256Line(t, root, "release", "app-linux.tar.gz") +
+		sha256Line(t, root, "release", "notes/CHANGELOG.md")
+	if got := rr.Body.String(); got != want {
+		t.Errorf("unexpected manifest:\n%s\nwant:\n%s", got, want)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected text/plain, got %q", ct)
+	}
+}
+
+func TestManifest_Errors(t *testing.T) {
+	root := writeManifestTree(t)
+	cfg := &config.Config{Theme: "advanced", MaxHashSize: 1 << 20}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), cfg)
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{url: "/api/manifest?algo=crc32", want: http.StatusBadRequest},
+		{url: "/api/manifest?path=other.txt", want: http.StatusBadRequest},
+		{url: "/api/manifest?path=missing", want: http.StatusNotFound},
+		{url: "/api/manifest?path=../etc", want: http.StatusBadRequest},
+		{url: "/api/manifest?algo=md5", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.url, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestManifest_CacheInvalidation(t *testing.T) {
+	root := writeManifestTree(t)
+	b := newManifestBuilder(filesystem.NewLocal(root, false), false, nil)
+	ctx := context.Background()
+
+	first, stamp1, err := b.Build(ctx, "release", "sha256")
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	again, stamp2, err := b.Build(ctx, "release", "sha256")
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if stamp1 != stamp2 || &first[0] != &again[0] {
+		t.Error("expected unchanged tree to be served from cache")
+	}
+
+	target := filepath.Join(root, "release", "app-linux.tar.gz")
+	if err := os.WriteFile(target, []byte("rebuilt linux"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(target, later, later); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+
+	updated, stamp3, err := b.Build(ctx, "release", "sha256")
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if stamp3 == stamp1 {
+		t.Error("expected stamp to change after a file changed")
+	}
+	if !strings.Contains(string(updated), sha256Line(t, root, "release", "app-linux.tar.gz")) {
+		t.Errorf("expected updated digest in manifest:\n%s", updated)
+	}
+}
+
+func TestManifestWriter_WriteOnce(t *testing.T) {
+	root := writeManifestTree(t)
+	fs := filesystem.NewLocal(filepath.Join(root, "release"), false)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	w := NewManifestWriter(fs, &config.Config{}, logger, time.Hour)
+
+	if err := w.WriteOnce(context.Background()); err != nil {
+		t.Fatalf("WriteOnce failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "release", "SHA256SUMS"))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if !strings.Contains(string(data), sha256Line(t, root, "release", "notes/CHANGELOG.md")) {
+		t.Errorf("unexpected manifest file:\n%s", data)
+	}
+	if strings.Contains(string(data), "SHA256SUMS") {
+		t.Error("manifest must not list itself")
+	}
+}
@@ -0,0 +1,6 @@
+package handler
+
+import "github.com/samzong/gofs/internal/listing"
+
+// FileOwner is the numeric owner and group of a file.
+type FileOwner = listing.FileOwner
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func TestDirectoryJSON_Metadata(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "private.txt"), []byte("data"), 0o640); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(root, "private.txt"), 0o640); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	if err := os.Symlink("private.txt", filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(os.TempDir(), filepath.Join(root, "outside")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+
+	fs := filesystem.NewLocal(root, false)
+	handlers := map[string]http.Handler{
+		"advanced": NewAdvancedFile(fs, &config.Config{Theme: "advanced"}),
+		"default":  NewFile(fs, &config.Config{Theme: "default"}, slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}
+	for name, h := range handlers {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", rr.Code)
+			}
+
+			var resp struct {
+				Files []struct {
+					Owner   *FileOwner `json:"owner"`
+					Name    string     `json:"name"`
+					Mode    string     `json:"mode"`
+					Symlink string     `json:"symlink"`
+				} `json:"files"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			got := map[string]string{}
+			for _, f := range resp.Files {
+				got[f.Name] = f.Mode + " " + f.Symlink
+				if runtime.GOOS != "windows" && f.Owner == nil {
+					t.Errorf("%s: expected owner", f.Name)
+				}
+			}
+			if got["private.txt"] != "0640 " {
+				t.Errorf("private.txt: got %q", got["private.txt"])
+			}
+			if got["link"] != "0777 private.txt" {
+				t.Errorf("link: got %q", got["link"])
+			}
+			if !strings.HasSuffix(got["outside"], " ") {
+				t.Errorf("symlink outside the root must not reveal its target, got %q", got["outside"])
+			}
+		})
+	}
+}
+
+func TestWebDAV_PROPFINDMetadata(t *testing.T) {
+	root := t.TempDir()
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.WriteFile(filepath.Join(root, "test.txt"), []byte("data"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "test.txt"), modTime, modTime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+
+	h := NewWebDAV(filesystem.NewLocal(root, false), &config.Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	req := httptest.NewRequest("PROPFIND", "/dav/test.txt", nil)
+	req.Header.Set("Depth", "0")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d: %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "2024-03-01T12:00:00Z</D:creationdate>") {
+		t.Errorf("expected creationdate in %s", body)
+	}
+	if !strings.Contains(body, modTime.Format(http.TimeFormat)+"</D:getlastmodified>") {
+		t.Errorf("expected getlastmodified in %s", body)
+	}
+
+	info, err := NewWebDAVAdapter(filesystem.NewLocal(root, false)).Stat(req.Context(), "/test.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("expected WebDAV mode 0600, got %v", info.Mode())
+	}
+}
@@ -1,28 +1,25 @@
 package handler
 
 import (
+	"cmp"
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/samzong/gofs/internal"
 	"github.com/samzong/gofs/internal/config"
-	"github.com/samzong/gofs/internal/constants"
 	"github.com/samzong/gofs/internal/filesystem"
-	"github.com/samzong/gofs/internal/handler/templates"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
 )
 
-// pathPool reduces string allocation overhead in path manipulation
-var pathPool = sync.Pool{
-	New: func() any {
-		buf := make([]byte, 0, constants.DefaultPathBufferSize)
-		return &buf
-	},
-}
-
 // generateContentETag creates a strong ETag based on content hash and version
 func generateContentETag(content string) string {
 	hash := sha256.Sum256([]byte(content))
@@ -30,6 +27,22 @@ func generateContentETag(content string) string {
 	return fmt.Sprintf(`"gofs-%x"`, hash[:16])
 }
 
+// routeSegments splits a mount path or request path into the segments
+// mounts are matched on. Leading, trailing and duplicate slashes yield no
+// segment, so "//docs//a/" and "/docs/a" match alike. With foldCase the
+// segments are lower-cased for --case-insensitive-routes.
+func routeSegments(path string, foldCase bool) []string {
+	if foldCase {
+		path = strings.ToLower(path)
+	}
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// routeKey is the normalized form of a mount path: "/" or "/a/b".
+func routeKey(path string, foldCase bool) string {
+	return "/" + strings.Join(routeSegments(path, foldCase), "/")
+}
+
 // pathTrie implements a trie data structure for efficient path matching
 type pathTrie struct {
 	handler  *MountHandler
@@ -44,15 +57,10 @@ func newPathTrie() *pathTrie {
 	}
 }
 
-// insert adds a path and its handler to the trie
-func (t *pathTrie) insert(path string, handler *MountHandler) {
+// insert adds the mount with the given route segments to the trie
+func (t *pathTrie) insert(parts []string, handler *MountHandler) {
 	node := t
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-
 	for _, part := range parts {
-		if part == "" {
-			continue
-		}
 		if node.children[part] == nil {
 			node.children[part] = newPathTrie()
 		}
@@ -63,36 +71,22 @@ func (t *pathTrie) insert(path string, handler *MountHandler) {
 	node.isEnd = true
 }
 
-// findBestMatch searches for the longest prefix match in the trie
-func (t *pathTrie) findBestMatch(path string) (*MountHandler, int) {
+// findBestMatch returns the mount with the longest prefix of parts and the
+// number of segments it matched. A mount at "/" matches, with no segments,
+// every path that no other mount claims.
+func (t *pathTrie) findBestMatch(parts []string) (*MountHandler, int) {
 	node := t
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	var bestHandler *MountHandler
+	bestHandler := t.handler
 	bestLen := 0
-	currentLen := 0
 
-	for _, part := range parts {
-		if part == "" && len(parts) == 1 {
-			// Root path case
-			if node.handler != nil {
-				return node.handler, 0
-			}
+	for i, part := range parts {
+		node = node.children[part]
+		if node == nil {
 			break
 		}
-
-		if part == "" {
-			continue
-		}
-
-		if node.children[part] != nil {
-			node = node.children[part]
-			currentLen++
-			if node.isEnd {
-				bestHandler = node.handler
-				bestLen = currentLen
-			}
-		} else {
-			break
+		if node.isEnd {
+			bestHandler = node.handler
+			bestLen = i + 1
 		}
 	}
 
@@ -103,8 +97,9 @@ func (t *pathTrie) findBestMatch(path string) (*MountHandler, int) {
 type MultiDir struct {
 	mu         sync.RWMutex             // protects mounts map and mountOrder slice
 	mounts     map[string]*MountHandler // path prefix -> handler (kept for compatibility)
-	mountOrder []string                 // ordered list of mount paths for deterministic iteration
+	mountOrder []string                 // mount paths by weight, then name, for deterministic iteration
 	trie       *pathTrie                // efficient path matching trie
+	foldCase   bool                     // match mount paths case-insensitively
 	config     *config.Config
 	logger     *slog.Logger
 }
@@ -121,18 +116,52 @@ func NewMultiDir(dirs []config.DirMount, cfg *config.Config, logger *slog.Logger
 	mounts := make(map[string]*MountHandler)
 	var mountOrder []string
 	trie := newPathTrie()
+	foldCase := cfg.CaseInsensitiveRoutes
+
+	// One cache for all mounts, so --hot-cache-size is the total
+	var hot *filesystem.HotCache
+	if cfg.HotCacheSize > 0 {
+		hot = filesystem.NewHotCache(cfg.HotCacheSize, cfg.HotCacheMaxFileSize)
+	}
+
+	// Aliases share the filesystem and handler of their target, and with
+	// them its caches, quota and upload slots
+	shared := make(map[string]*MountHandler)
 
 	for _, mount := range dirs {
-		// Create filesystem
-		var fs internal.FileSystem = filesystem.NewLocal(mount.Dir, cfg.ShowHidden)
-		if mount.Readonly {
-			fs = filesystem.NewReadonly(fs)
+		if target, ok := shared[mount.AliasOf]; ok {
+			mountHandler := &MountHandler{mount: mount, fs: target.fs, handler: target.handler}
+			mountPath := strings.TrimSuffix(routeKey(mount.Path, foldCase), "/") + "/"
+			mounts[mountPath] = mountHandler
+			mountOrder = append(mountOrder, mountPath)
+			trie.insert(routeSegments(mount.Path, foldCase), mountHandler)
+
+			logger.Info("Directory alias mounted",
+				slog.String("path", mount.Path),
+				slog.String("alias_of", mount.AliasOf),
+				slog.String("name", mount.Name),
+			)
+			continue
+		}
+
+		fs, err := NewMountFS(mount, cfg, hot)
+		if err != nil {
+			// Mounts are validated before the handler is built
+			logger.Error("Cannot mount directory",
+				slog.String("path", mount.Path),
+				slog.String("dir", mount.Dir),
+				slog.String("error", err.Error()),
+			)
+			continue
 		}
 
 		// Create handler based on theme
 		var handler http.Handler
 		if cfg.Theme == "advanced" {
-			handler = NewAdvancedFile(fs, cfg)
+			advanced := NewAdvancedFile(fs, cfg)
+			advanced.SetQuota(mount.Quota)
+			advanced.SetHotCache(hot)
+			handler = advanced
 		} else {
 			handler = NewFile(fs, cfg, logger)
 		}
@@ -144,16 +173,14 @@ func NewMultiDir(dirs []config.DirMount, cfg *config.Config, logger *slog.Logger
 		}
 
 		// Ensure path ends with / for proper prefix matching (legacy map)
-		mountPath := mount.Path
-		if !strings.HasSuffix(mountPath, "/") {
-			mountPath += "/"
-		}
+		mountPath := strings.TrimSuffix(routeKey(mount.Path, foldCase), "/") + "/"
 
 		mounts[mountPath] = mountHandler
 		mountOrder = append(mountOrder, mountPath)
 
 		// Add to trie for efficient lookup
-		trie.insert(mount.Path, mountHandler)
+		trie.insert(routeSegments(mount.Path, foldCase), mountHandler)
+		shared[mount.Path] = mountHandler
 
 		logger.Info("Directory mounted",
 			slog.String("path", mount.Path),
@@ -163,90 +190,194 @@ func NewMultiDir(dirs []config.DirMount, cfg *config.Config, logger *slog.Logger
 		)
 	}
 
+	// Order only the mount keys: aliases must follow their targets in dirs
+	slices.SortStableFunc(mountOrder, func(a, b string) int {
+		ma, mb := mounts[a].mount, mounts[b].mount
+		return cmp.Or(cmp.Compare(ma.Weight, mb.Weight), cmp.Compare(ma.Name, mb.Name), cmp.Compare(a, b))
+	})
+
 	return &MultiDir{
 		mounts:     mounts,
 		mountOrder: mountOrder,
 		trie:       trie,
+		foldCase:   foldCase,
 		config:     cfg,
 		logger:     logger,
 	}
 }
 
-// ServeHTTP implements http.Handler with panic recovery
-func (m *MultiDir) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Panic recovery middleware
-	defer func() {
-		if err := recover(); err != nil {
-			m.logger.Error("Handler panic recovered",
-				slog.Any("error", err),
-				slog.String("path", r.URL.Path),
-				slog.String("method", r.Method),
-				slog.String("remote_addr", r.RemoteAddr))
-
-			// Return 500 error if headers haven't been written yet
-			if w.Header().Get("Content-Type") == "" {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
+// SetArchiveCache shares cache between the advanced handlers of all mounts.
+func (m *MultiDir) SetArchiveCache(cache *ArchiveCache) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, mountHandler := range m.mounts {
+		if mountHandler.mount.AliasOf != "" {
+			continue
+		}
+		if advanced, ok := mountHandler.handler.(*AdvancedFile); ok {
+			advanced.SetArchiveCache(cache, mountHandler.mount.Dir)
 		}
-	}()
+	}
+}
+
+// SetVersions keeps replaced files of every mount in its own scope of store.
+// Aliases use the scope of their target.
+func (m *MultiDir) SetVersions(store *VersionStore) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
+	for _, mountHandler := range m.mounts {
+		if mountHandler.mount.AliasOf != "" {
+			continue
+		}
+		if advanced, ok := mountHandler.handler.(*AdvancedFile); ok {
+			advanced.SetVersions(store.Scope(mountHandler.mount.Path))
+		}
+	}
+}
+
+// SetScrubber serves each mount's scrub report from s. Aliases share the
+// report of their target.
+func (m *MultiDir) SetScrubber(s *Scrubber) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, mountHandler := range m.mounts {
+		if mountHandler.mount.AliasOf != "" {
+			continue
+		}
+		if advanced, ok := mountHandler.handler.(*AdvancedFile); ok {
+			advanced.SetScrubber(s, mountHandler.mount.Path)
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (m *MultiDir) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Handle static assets for advanced theme
-	if r.URL.Path == "/static/theme.css" || r.URL.Path == "/static/theme.js" {
-		m.handleStaticAssets(w, r)
+	if isStaticAssetPath(r.URL.Path) {
+		serveStaticAsset(w, r)
 		return
 	}
 
-	// Handle root path
-	if r.URL.Path == "/" {
+	// Diffs may compare directories of different mounts, so they are
+	// answered here unless a mount other than the root one claims the path
+	if r.URL.Path == "/api/diff" && m.config.Theme == "advanced" && isRootMount(m.findBestMatch(r.URL.Path)) {
+		m.serveDiff(w, r)
+		return
+	}
+
+	// Without a mount at "/" the root redirects to the first mount
+	if r.URL.Path == "/" && m.findBestMatch("/") == nil {
 		m.handleRoot(w, r)
 		return
 	}
 
+	// Mounts are matched on the clean path, so "//docs/a" reaches /docs
+	name, err := pathsafe.Clean(r.URL.Path)
+	if err != nil {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
 	// Find best matching mount
-	mountHandler := m.findBestMatch(r.URL.Path)
+	mountHandler := m.findBestMatch("/" + name)
 	if mountHandler == nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	m.serveMountedPath(w, r, mountHandler)
+	m.serveMountedPath(w, r, mountHandler, name)
 }
 
-// handleRoot serves the root path - redirect to first mount
+// serveDiff handles GET /api/diff?a=/mount/dir&b=/mount/dir, where a and b
+// include their mount paths and may lie in different mounts.
+func (m *MultiDir) serveDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reporter := middleware.ErrorReporter{Logger: m.logger, Debug: m.config.DebugErrors}
+	var roots [2]diffRoot
+	for i, param := range []string{"a", "b"} {
+		name, err := pathsafe.Clean(r.URL.Query().Get(param))
+		if err != nil || !r.URL.Query().Has(param) {
+			middleware.WriteJSONError(w, "Invalid or missing "+param, http.StatusBadRequest)
+			return
+		}
+		mountHandler := m.findBestMatch("/" + name)
+		var advanced *AdvancedFile
+		if mountHandler != nil {
+			advanced, _ = mountHandler.handler.(*AdvancedFile)
+		}
+		if advanced == nil {
+			middleware.WriteJSONError(w, "No mount serves "+param, http.StatusNotFound)
+			return
+		}
+		// The mount's .gofs.yaml directives apply as they would to a listing
+		if advanced.dirConfigs != nil {
+			advanced = advanced.forRequest(r)
+		}
+		root, ok := resolveDiffRoot(w, r, param, advanced.fs, mountRelative(mountHandler.mount, name), reporter)
+		if !ok {
+			return
+		}
+		roots[i] = root
+	}
+	hash, _ := strconv.ParseBool(r.URL.Query().Get("hash"))
+	serveDiff(w, r, roots[0], roots[1], m.config, hash)
+}
+
+// handleRoot serves the root path - redirect to the --default-mount, or else
+// the first mount by weight and name
 func (m *MultiDir) handleRoot(w http.ResponseWriter, r *http.Request) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	// Always redirect to first mount (deterministically) for all themes
+	if m.config.DefaultMount != "" {
+		key := strings.TrimSuffix(routeKey(m.config.DefaultMount, m.foldCase), "/") + "/"
+		if mount, exists := m.mounts[key]; exists {
+			http.Redirect(w, r, middleware.BasePathFromContext(r.Context())+
+				strings.TrimSuffix(mount.mount.Path, "/")+"/", http.StatusFound)
+			return
+		}
+	}
 	if len(m.mountOrder) > 0 {
 		firstMountPath := m.mountOrder[0]
 		if mount, exists := m.mounts[firstMountPath]; exists {
-			http.Redirect(w, r, mount.mount.Path, http.StatusFound)
+			http.Redirect(w, r, middleware.BasePathFromContext(r.Context())+
+				strings.TrimSuffix(mount.mount.Path, "/")+"/", http.StatusFound)
 			return
 		}
 	}
 	http.NotFound(w, r)
 }
 
-// findBestMatch finds the mount with the longest matching prefix using optimized trie (thread-safe)
+// findBestMatch finds the mount with the longest matching prefix using optimized trie (thread-safe).
+// path is normalized by routeSegments first, the same way mount paths were
+// when they were added, so the trie and the legacy map agree.
 func (m *MultiDir) findBestMatch(path string) *MountHandler {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	parts := routeSegments(path, m.foldCase)
+
 	// Use trie for O(log n) lookup instead of O(n) iteration
 	if m.trie != nil {
-		handler, _ := m.trie.findBestMatch(path)
+		handler, _ := m.trie.findBestMatch(parts)
 		return handler
 	}
 
 	// Fallback to legacy method if trie is not available
 	var bestMatch *MountHandler
-	var bestLen int
+	bestLen := -1
+	key := "/" + strings.Join(parts, "/")
 
 	for prefix, handler := range m.mounts {
-		// Handle exact path match (e.g., /cmd matches /cmd/)
+		// Prefixes end in a slash, so /cmd matches /cmd/ and "/" matches all
 		mountPath := strings.TrimSuffix(prefix, "/")
-		if path == mountPath || strings.HasPrefix(path, prefix) {
+		if strings.HasPrefix(key+"/", prefix) {
 			prefixLen := len(mountPath)
 			if prefixLen > bestLen {
 				bestMatch = handler
@@ -257,87 +388,101 @@ func (m *MultiDir) findBestMatch(path string) *MountHandler {
 	return bestMatch
 }
 
-// serveMountedPath handles request for a mounted directory with optimized path operations
-func (m *MultiDir) serveMountedPath(w http.ResponseWriter, r *http.Request, mountHandler *MountHandler) {
-	// Store original path for restoration
-	originalPath := r.URL.Path
-
-	// Get buffer from pool for efficient path manipulation
-	bufPtr := pathPool.Get().(*[]byte)
-	defer func() {
-		*bufPtr = (*bufPtr)[:0] // Reset buffer
-		pathPool.Put(bufPtr)    // Return pointer to pool
-	}()
+// isRootMount reports whether h is nil or the mount at "/", which only
+// serves what no other mount claims.
+func isRootMount(h *MountHandler) bool {
+	return h == nil || len(routeSegments(h.mount.Path, false)) == 0
+}
 
-	// Efficiently strip mount prefix
-	mountPrefix := strings.TrimSuffix(mountHandler.mount.Path, "/")
+// mountPoints returns the directories the root of the mount at "/" lists
+// for the mounts directly below it, with the modification times of their
+// roots, by weight and name. Deeper mounts such as /a/b are not listed: /a
+// belongs to the root mount.
+func (m *MultiDir) mountPoints() []internal.FileInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	newPath := originalPath
-	if mountPrefix != "" && strings.HasPrefix(originalPath, mountPrefix) {
-		newPath = originalPath[len(mountPrefix):]
-	}
-	if newPath == "" {
-		newPath = "/"
+	var points []internal.FileInfo
+	for _, key := range m.mountOrder {
+		mountHandler := m.mounts[key]
+		segments := routeSegments(mountHandler.mount.Path, false)
+		if len(segments) != 1 {
+			continue
+		}
+		point := mountPointInfo{name: segments[0]}
+		if info, err := mountHandler.fs.Stat(""); err == nil {
+			point.modTime = info.ModTime()
+		}
+		points = append(points, point)
 	}
+	return points
+}
 
-	r.URL.Path = newPath
+// mountPointsKey is the context key of the entries withMountPoints adds.
+type mountPointsKey struct{}
 
-	// Add mount context and serve
-	mount := mountHandler.mount
-	ctx := internal.WithMountInfo(r.Context(), mount.Path, mount.Name, mount.Readonly)
-	r = r.WithContext(ctx)
-	mountHandler.handler.ServeHTTP(w, r)
-	r.URL.Path = originalPath // Restore for potential reuse
+// withMountPoints returns ctx with points to be listed at the root of the
+// mount serving the request, in place of entries of the same name.
+func withMountPoints(ctx context.Context, points []internal.FileInfo) context.Context {
+	return context.WithValue(ctx, mountPointsKey{}, points)
 }
 
-// handleStaticAssets serves static CSS and JS files for the advanced theme
-func (m *MultiDir) handleStaticAssets(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/static/theme.css":
-		m.serveStaticCSS(w, r)
-	case "/static/theme.js":
-		m.serveStaticJS(w, r)
-	default:
-		http.NotFound(w, r)
-	}
+func mountPointsFrom(ctx context.Context) []internal.FileInfo {
+	points, _ := ctx.Value(mountPointsKey{}).([]internal.FileInfo)
+	return points
 }
 
-// serveStaticCSS serves the advanced theme CSS with improved caching
-func (m *MultiDir) serveStaticCSS(w http.ResponseWriter, r *http.Request) {
-	// Generate strong ETag based on content
-	etag := generateContentETag(templates.AdvancedCSS)
-
-	// Set cache headers for CSS
-	w.Header().Set("Content-Type", "text/css; charset=utf-8")
-	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", constants.StaticAssetCacheMaxAge))
-	w.Header().Set("ETag", etag)
+// mountPointInfo is a directory entry standing for a mount.
+type mountPointInfo struct {
+	name    string
+	modTime time.Time
+}
 
-	// Check if client has cached version
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if match == etag {
-			w.WriteHeader(http.StatusNotModified)
-			return
-		}
+func (i mountPointInfo) Name() string       { return i.name }
+func (i mountPointInfo) Size() int64        { return 0 }
+func (i mountPointInfo) IsDir() bool        { return true }
+func (i mountPointInfo) ModTime() time.Time { return i.modTime }
+
+// mountRelative strips the segments the path of mount matched from name, a
+// clean request path, whatever their case.
+func mountRelative(mount config.DirMount, name string) string {
+	depth := len(routeSegments(mount.Path, false))
+	parts := strings.SplitN(name, "/", depth+1)
+	if len(parts) > depth {
+		return parts[depth]
 	}
-	_, _ = w.Write([]byte(templates.AdvancedCSS))
+	return ""
 }
 
-// serveStaticJS serves the advanced theme JavaScript with improved caching
-func (m *MultiDir) serveStaticJS(w http.ResponseWriter, r *http.Request) {
-	// Generate strong ETag based on content
-	etag := generateContentETag(templates.AdvancedJS)
+// serveMountedPath handles a request for a mounted directory.
+// name is the clean request path from pathsafe.Clean. The mount handler gets
+// a clone of r with the mount prefix stripped, so r itself is never modified
+// and stays valid for anything that still holds it.
+func (m *MultiDir) serveMountedPath(w http.ResponseWriter, r *http.Request, mountHandler *MountHandler,
+	name string,
+) {
+	// Strip the mount prefix, keeping the trailing slash of directory requests
+	newPath := "/" + mountRelative(mountHandler.mount, name)
+	if newPath != "/" && strings.HasSuffix(r.URL.Path, "/") {
+		newPath += "/"
+	}
 
-	// Set cache headers for JS
-	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
-	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", constants.StaticAssetCacheMaxAge))
-	w.Header().Set("ETag", etag)
+	// Add mount context and serve
+	mount := mountHandler.mount
+	ctx := internal.WithMountInfo(r.Context(), mount.Path, mount.Name, mount.Readonly)
+	ctx = middleware.WithOriginalPath(ctx, r.URL.Path)
+	if newPath == "/" && isRootMount(mountHandler) {
+		ctx = withMountPoints(ctx, m.mountPoints())
+	}
 
-	// Check if client has cached version
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if match == etag {
-			w.WriteHeader(http.StatusNotModified)
-			return
-		}
+	// The mount root is a directory whatever the stripped path says
+	if newPath == "/" && !strings.HasSuffix(r.URL.Path, "/") && r.Method == http.MethodGet {
+		redirectToDir(w, r.WithContext(ctx), "")
+		return
 	}
-	_, _ = w.Write([]byte(templates.AdvancedJS))
+
+	r2 := r.Clone(ctx)
+	r2.URL.Path = newPath
+	r2.URL.RawPath = ""
+	mountHandler.handler.ServeHTTP(w, r2)
 }
@@ -2,18 +2,22 @@ package handler
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
 
 	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/middleware"
 )
 
 func TestNewMultiDir(t *testing.T) {
@@ -36,7 +40,7 @@ func TestNewMultiDir(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -92,7 +96,7 @@ func TestMultiDir_ServeHTTP_PathResolution(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -158,6 +162,22 @@ func TestMultiDir_ServeHTTP_PathResolution(t *testing.T) {
 			path:           "/docs/nonexistent.txt",
 			expectedStatus: http.StatusNotFound,
 		},
+		{
+			name:            "double_slash_file",
+			path:            "//docs//subdir/subdoc.txt",
+			expectedStatus:  http.StatusOK,
+			expectedContent: "subdirectory content",
+		},
+		{
+			name:           "traversal_out_of_mount",
+			path:           "/docs/../data/data1.json",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "rooted_traversal",
+			path:           "/../docs/doc1.txt",
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -241,7 +261,7 @@ func TestMultiDir_TrieBasedRouting(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -334,7 +354,7 @@ func TestMultiDir_ConcurrentAccess(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -445,7 +465,7 @@ func TestMultiDir_PanicRecovery(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -541,7 +561,7 @@ func TestMultiDir_MemoryPoolOptimization(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -635,7 +655,7 @@ func TestMultiDir_StrongETags(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -749,7 +769,7 @@ func TestMultiDir_MountOperations(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -770,8 +790,8 @@ func TestMultiDir_MountOperations(t *testing.T) {
 
 	// For redirect, check the Location header instead of body content
 	location := resp.Header.Get("Location")
-	if location != "/initial" {
-		t.Errorf("Expected redirect to /initial, got %s", location)
+	if location != "/initial/" {
+		t.Errorf("Expected redirect to /initial/, got %s", location)
 	}
 
 	// Remove the body content check since we're testing redirect behavior
@@ -804,7 +824,7 @@ func TestMultiDir_ThreadSafety_RaceConditions(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -870,7 +890,7 @@ func TestMultiDir_ETagContentHashing(t *testing.T) {
 	}
 
 	cfg := &config.Config{
-		MaxFileSize: 1024 * 1024 * 100,
+		MaxHashSize: 1024 * 1024 * 100,
 		Theme:       "default",
 	}
 
@@ -907,3 +927,393 @@ func TestMultiDir_ETagContentHashing(t *testing.T) {
 		t.Errorf("ETag should be SHA-256 hash of content: expected %s, got %s", expectedHash, etag)
 	}
 }
+
+func TestMultiDir_ReadonlyMount(t *testing.T) {
+	mounts := []config.DirMount{
+		{Dir: t.TempDir(), Path: "/docs", Name: "Docs"},
+		{Dir: t.TempDir(), Path: "/data", Name: "Data", Readonly: true},
+	}
+	handler := NewMultiDir(mounts, &config.Config{Theme: "advanced"}, slog.Default())
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	listing := get("/data/").Body.String()
+	for _, marker := range []string{`data-readonly="true"`, `class="readonly-badge"`,
+		`class="upload-btn js-only" style="display: none"`, `id="newFolderBtn" style="display: none"`} {
+		if !strings.Contains(listing, marker) {
+			t.Errorf("expected the read-only listing to contain %s", marker)
+		}
+	}
+	if strings.Contains(listing, "?form=upload") {
+		t.Error("expected the read-only listing to have no upload form")
+	}
+	if listing := get("/docs/").Body.String(); strings.Contains(listing, "data-readonly") {
+		t.Error("expected the writable listing to have no read-only marker")
+	}
+	if caps := get("/data/api/capabilities").Body.String(); !strings.Contains(caps, `"readonly":true`) {
+		t.Errorf("expected capabilities to report the mount read-only, got %s", caps)
+	}
+
+	var body strings.Builder
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "a.txt")
+	_, _ = part.Write([]byte("data"))
+	_ = mw.Close()
+
+	requests := map[string]*http.Request{
+		"upload": httptest.NewRequest(http.MethodPost, "/data/api/upload", strings.NewReader(body.String())),
+		"folder": httptest.NewRequest(http.MethodPost, "/data/api/folder", strings.NewReader(`{"path":"new"}`)),
+		"delete": httptest.NewRequest(http.MethodPost, "/data/api/delete", strings.NewReader(`{"paths":["a"]}`)),
+	}
+	requests["upload"].Header.Set("Content-Type", mw.FormDataContentType())
+	for name, req := range requests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp ReadonlyErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusForbidden || err != nil ||
+			resp.Code != ReadonlyErrorCode {
+			t.Errorf("%s: expected 403 %s, got %d %s", name, ReadonlyErrorCode, w.Code, w.Body.String())
+		}
+	}
+	if entries, _ := os.ReadDir(mounts[1].Dir); len(entries) != 0 {
+		t.Errorf("expected the read-only mount to stay empty, got %d entries", len(entries))
+	}
+}
+
+func TestMultiDir_Alias(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "release.txt"), []byte("v2.3"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mounts, err := config.ApplyAliases([]config.DirMount{
+		{Dir: root, Path: "/latest", Name: "Latest", Readonly: true},
+		{Dir: t.TempDir(), Path: "/other", Name: "Other"},
+	}, []string{"/v2.3=/latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Theme: "advanced", HotCacheSize: 1 << 20, HotCacheMaxFileSize: 1 << 10}
+	handler := NewMultiDir(mounts, cfg, slog.New(slog.DiscardHandler))
+
+	latest, alias := handler.findBestMatch("/latest"), handler.findBestMatch("/v2.3")
+	if latest == nil || alias == nil || latest == alias {
+		t.Fatalf("expected a mount handler per path, got %p and %p", latest, alias)
+	}
+	if alias.handler != latest.handler || alias.fs != latest.fs {
+		t.Error("expected the alias to share the handler and filesystem of its target")
+	}
+	if other := handler.findBestMatch("/other"); other.handler == latest.handler {
+		t.Error("expected other mounts to keep their own handler")
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	for _, target := range []string{"/latest/sub/release.txt", "/v2.3/sub/release.txt"} {
+		if w := get(target); w.Code != http.StatusOK || w.Body.String() != "v2.3" {
+			t.Errorf("GET %s: expected the shared file, got %d %q", target, w.Code, w.Body.String())
+		}
+	}
+
+	// Pages link within the path they were requested under
+	listing := get("/v2.3/sub/").Body.String()
+	for _, link := range []string{`href="/v2.3/" class="breadcrumb-item breadcrumb-home"`,
+		`href="/v2.3/sub/" class="breadcrumb-item"`, `data-readonly="true"`} {
+		if !strings.Contains(listing, link) {
+			t.Errorf("expected the alias listing to contain %s", link)
+		}
+	}
+	if strings.Contains(listing, `href="/latest`) {
+		t.Error("expected no links to the target mount in the alias listing")
+	}
+}
+
+func TestMultiDir_DotNamedMount(t *testing.T) {
+	// Only entries below the mount root count as hidden, not the directory
+	// the mount serves
+	dir := filepath.Join(t.TempDir(), ".config")
+	writeDiffTree(t, dir, map[string]string{
+		"app.yaml":  "name: app",
+		"sub/x.txt": "x",
+		".secret":   "token",
+		".git/HEAD": "ref: refs/heads/main",
+	})
+	mount := config.DirMount{Dir: dir, Path: "/config", Name: "Config"}
+	cfg := &config.Config{Theme: "advanced", MaxHashSize: 1 << 20, EnableTree: true}
+	handler := NewMultiDir([]config.DirMount{mount}, cfg, slog.New(slog.DiscardHandler))
+
+	for target, want := range map[string]string{"/config/app.yaml": "name: app", "/config/sub/x.txt": "x"} {
+		if w := getPath(handler, target, nil); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("GET %s: expected %q, got %d %q", target, want, w.Code, w.Body.String())
+		}
+	}
+
+	for _, target := range []string{"/config/", "/config/api/manifest", "/config/api/dirs?depth=2"} {
+		w := getPath(handler, target, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", target, w.Code, w.Body.String())
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, "sub") {
+			t.Errorf("GET %s: expected the mount contents, got %s", target, body)
+		}
+		if strings.Contains(body, ".secret") || strings.Contains(body, ".git") {
+			t.Errorf("GET %s: expected nested dotfiles to stay hidden, got %s", target, body)
+		}
+	}
+
+	entries, err := NewVisibility(mount, cfg).Tree(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, " ") != "sub app.yaml" {
+		t.Errorf("expected the tree to hold sub and app.yaml, got %v", names)
+	}
+}
+
+func TestMultiDir_RootMount(t *testing.T) {
+	root, extra, docs, api := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	writeDiffTree(t, root, map[string]string{
+		"index.txt":    "root",
+		"extra":        "a root file named like a mount",
+		"extras.txt":   "root extras",
+		"docs/a.txt":   "root docs",
+		"docs/own.txt": "shadowed",
+	})
+	writeDiffTree(t, extra, map[string]string{"file.txt": "extra"})
+	writeDiffTree(t, docs, map[string]string{"a.txt": "docs"})
+	writeDiffTree(t, api, map[string]string{"a.txt": "api"})
+
+	// The root mount is last here and first below; order must not matter
+	mounts := []config.DirMount{
+		{Path: "/extra", Dir: extra},
+		{Path: "/docs/api", Dir: api},
+		{Path: "/docs", Dir: docs},
+		{Path: "/", Dir: root},
+	}
+	for _, order := range [][]config.DirMount{mounts, {mounts[3], mounts[0], mounts[1], mounts[2]}} {
+		handler := NewMultiDir(order, &config.Config{Theme: "default"}, slog.New(slog.DiscardHandler))
+
+		tests := []struct {
+			path string
+			want string // Body, or "" for 404
+		}{
+			{"/index.txt", "root"},
+			{"/extras.txt", "root extras"},
+			{"/extra/file.txt", "extra"},
+			{"/docs/a.txt", "docs"},
+			{"/docs/api/a.txt", "api"},
+			{"/docs/own.txt", ""},
+			{"/missing.txt", ""},
+		}
+		for _, tt := range tests {
+			w := getPath(handler, tt.path, nil)
+			if tt.want == "" && w.Code != http.StatusNotFound {
+				t.Errorf("GET %s: expected 404, got %d: %s", tt.path, w.Code, w.Body.String())
+			}
+			if tt.want != "" && (w.Code != http.StatusOK || w.Body.String() != tt.want) {
+				t.Errorf("GET %s: expected %q, got %d %q", tt.path, tt.want, w.Code, w.Body.String())
+			}
+		}
+		if w := getPath(handler, "/extra", nil); w.Code != http.StatusMovedPermanently ||
+			w.Header().Get("Location") != "/extra/" {
+			t.Errorf("GET /extra: expected a redirect to the mount, got %d %q", w.Code, w.Header().Get("Location"))
+		}
+
+		// The root is the root mount's listing, with the mounts below it in
+		// place of the entries they shadow
+		w := getPath(handler, "/", http.Header{"Accept": {"application/json"}})
+		var listing ListingResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("GET /: expected a JSON listing, got %d %s", w.Code, w.Body.String())
+		}
+		kinds := make(map[string]bool)
+		for _, f := range listing.Files {
+			kinds[f.Name] = f.IsDir
+		}
+		want := map[string]bool{"docs": true, "extra": true, "extras.txt": false, "index.txt": false}
+		if len(kinds) != len(want) || len(listing.Files) != len(want) {
+			t.Errorf("GET /: expected entries %v, got %+v", want, listing.Files)
+		}
+		for name, isDir := range want {
+			if got, ok := kinds[name]; !ok || got != isDir {
+				t.Errorf("GET /: expected %s with isDir=%v, got %+v", name, isDir, listing.Files)
+			}
+		}
+		if w := getPath(handler, "/docs/", http.Header{"Accept": {"application/json"}}); strings.Contains(
+			w.Body.String(), `"api"`) {
+			t.Errorf("GET /docs/: only the root mount lists mounts, got %s", w.Body.String())
+		}
+	}
+}
+
+func TestMultiDir_MountWeights(t *testing.T) {
+	// Weights order the mounts; equal weights fall back to the name
+	mounts := []config.DirMount{
+		{Path: "/zeta", Dir: t.TempDir(), Name: "Zeta", Weight: 1},
+		{Path: "/beta", Dir: t.TempDir(), Name: "Beta", Weight: 5},
+		{Path: "/alpha", Dir: t.TempDir(), Name: "Alpha", Weight: 5},
+	}
+
+	tests := []struct {
+		defaultMount string
+		want         string
+	}{
+		{"", "/zeta/"},
+		{"/alpha", "/alpha/"},
+	}
+	for _, tt := range tests {
+		handler := NewMultiDir(mounts, &config.Config{Theme: "default", DefaultMount: tt.defaultMount},
+			slog.New(slog.DiscardHandler))
+		if w := getPath(handler, "/", nil); w.Code != http.StatusFound || w.Header().Get("Location") != tt.want {
+			t.Errorf("default mount %q: expected a redirect to %s, got %d %q",
+				tt.defaultMount, tt.want, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// With a mount at /, the root index lists the mounts in the same order
+	// ahead of its own entries, whatever they are sorted by
+	root := t.TempDir()
+	writeDiffTree(t, root, map[string]string{"aaa/a.txt": "root", "index.txt": "root"})
+	handler := NewMultiDir(append(mounts, config.DirMount{Path: "/", Dir: root, Name: "Files"}),
+		&config.Config{Theme: "advanced"}, slog.New(slog.DiscardHandler))
+	for _, query := range []string{"", "?sort=name&order=desc", "?sort=size"} {
+		l := getListing(t, handler, "/"+query)
+		var got []string
+		for _, f := range l.Files {
+			got = append(got, f.Name)
+		}
+		if want := []string{"zeta", "alpha", "beta", "aaa", "index.txt"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("GET /%s: expected %v, got %v", query, want, got)
+		}
+	}
+}
+
+func TestMultiDir_DoesNotMutateRequest(t *testing.T) {
+	mounts := []config.DirMount{
+		{Dir: t.TempDir(), Path: "/docs", Name: "Docs"},
+		{Dir: t.TempDir(), Path: "/data", Name: "Data"},
+	}
+	handler := NewMultiDir(mounts, &config.Config{Theme: "default"}, slog.New(slog.DiscardHandler))
+
+	// The inner handler keeps the request and reads it after returning, as
+	// streaming handlers and deferred logging do
+	captured := make(chan *http.Request, 1)
+	done := make(chan string)
+	handler.findBestMatch("/docs").handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured <- r
+		go func() { done <- r.URL.Path + " " + middleware.OriginalPath(r) }()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/docs/sub/a%2Fb.txt", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got := <-done; got != "/sub/a/b.txt /docs/sub/a/b.txt" {
+		t.Errorf("inner handler saw %q after ServeHTTP returned", got)
+	}
+	inner := <-captured
+	if inner == req || inner.URL == req.URL {
+		t.Error("expected the inner handler to get a clone of the request")
+	}
+	if req.URL.Path != "/docs/sub/a/b.txt" || req.URL.RawPath != "/docs/sub/a%2Fb.txt" {
+		t.Errorf("expected the original request untouched, got %q (raw %q)", req.URL.Path, req.URL.RawPath)
+	}
+	if inner.URL.EscapedPath() != "/sub/a/b.txt" {
+		t.Errorf("expected the clone to drop the stale raw path, got %q", inner.URL.EscapedPath())
+	}
+}
+
+func TestMultiDir_RouteMatching(t *testing.T) {
+	mounts := []config.DirMount{
+		{Path: "/docs", Name: "Docs"},
+		{Path: "/api", Name: "API"},
+		{Path: "/api/v1", Name: "API V1"},
+	}
+	for i := range mounts {
+		mounts[i].Dir = t.TempDir()
+		content := []byte(mounts[i].Name + " content")
+		if err := os.WriteFile(filepath.Join(mounts[i].Dir, "file.txt"), content, 0o644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		wantSensitive string // Expected body, or "" for 404
+		wantFolded    string
+	}{
+		{"exact case", "/docs/file.txt", "Docs content", "Docs content"},
+		{"mixed case mount", "/Docs/file.txt", "", "Docs content"},
+		{"upper case nested mount", "/API/V1/file.txt", "", "API V1 content"},
+		{"mixed case parent of nested mount", "/Api/v1/file.txt", "", "API V1 content"},
+		{"duplicate slashes", "//docs//file.txt", "Docs content", "Docs content"},
+		{"duplicate slashes in nested mount", "/api//v1///file.txt", "API V1 content", "API V1 content"},
+		{"most specific match", "/api/v1/file.txt", "API V1 content", "API V1 content"},
+		{"parent mount", "/api/file.txt", "API content", "API content"},
+		{"prefix that is not a segment", "/apiv1/file.txt", "", ""},
+		{"unknown mount", "/other/file.txt", "", ""},
+	}
+
+	for _, foldCase := range []bool{false, true} {
+		cfg := &config.Config{Theme: "default", CaseInsensitiveRoutes: foldCase}
+		handler := NewMultiDir(mounts, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/folded=%v", tt.name, foldCase), func(t *testing.T) {
+				want := tt.wantSensitive
+				if foldCase {
+					want = tt.wantFolded
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+				if want == "" {
+					if w.Code != http.StatusNotFound {
+						t.Errorf("Expected 404, got %d: %s", w.Code, w.Body.String())
+					}
+					return
+				}
+				if w.Code != http.StatusOK || w.Body.String() != want {
+					t.Errorf("Expected 200 %q, got %d %q", want, w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestPathTrie_MatchesLegacyMap(t *testing.T) {
+	withoutRoot := []config.DirMount{{Path: "/api/"}, {Path: "/api/v1"}, {Path: "/Docs"}}
+	withRoot := append([]config.DirMount{{Path: "/"}}, withoutRoot...)
+	paths := []string{"/", "/api", "/api/", "//api//v1//x", "/api/v2/x", "/docs/x", "/DOCS", "/apiv1", "/other/x"}
+
+	for _, tc := range []struct {
+		mounts   []config.DirMount
+		foldCase bool
+	}{{withoutRoot, false}, {withoutRoot, true}, {withRoot, false}, {withRoot, true}} {
+		mounts, foldCase := tc.mounts, tc.foldCase
+		withTrie := &MultiDir{trie: newPathTrie(), mounts: map[string]*MountHandler{}, foldCase: foldCase}
+		withMap := &MultiDir{mounts: withTrie.mounts, foldCase: foldCase}
+		for _, mount := range mounts {
+			h := &MountHandler{mount: mount}
+			withTrie.trie.insert(routeSegments(mount.Path, foldCase), h)
+			withTrie.mounts[strings.TrimSuffix(routeKey(mount.Path, foldCase), "/")+"/"] = h
+		}
+		for _, p := range paths {
+			fromTrie, fromMap := withTrie.findBestMatch(p), withMap.findBestMatch(p)
+			if fromTrie != fromMap {
+				t.Errorf("%s (folded=%v): trie matched %v, legacy map %v", p, foldCase, fromTrie, fromMap)
+			}
+		}
+	}
+}
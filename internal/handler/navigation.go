@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// canonicalSlash gives every file and directory a single URL. A directory
+// requested without a trailing slash is redirected to the slashed form, so
+// the relative links of its listing resolve inside it; a file requested with
+// one is not found. name is the clean path of the request within the mount.
+// It writes the response and returns false when the request must not be
+// served.
+func canonicalSlash(w http.ResponseWriter, r *http.Request, name string, isDir bool) bool {
+	slashed := strings.HasSuffix(r.URL.Path, "/")
+	switch {
+	case isDir && !slashed:
+		redirectToDir(w, r, name)
+		return false
+	case !isDir && slashed:
+		http.NotFound(w, r)
+		return false
+	}
+	return true
+}
+
+// redirectToDir answers 301 with the slashed URL of directory name on the
+// request's mount, keeping the query string.
+func redirectToDir(w http.ResponseWriter, r *http.Request, name string) {
+	target := dirURL(r, name)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// dirURL returns the slashed URL path of directory name on the request's
+// mount; "" is the mount root.
+func dirURL(r *http.Request, name string) string {
+	if name == "" || name == "." {
+		return mountURL(r) + "/"
+	}
+	return resourceURL(r, name, true)
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+func TestAdvancedFile_JSONBreadcrumbs(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs", "sub dir"), 0o755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	tests := []struct {
+		path string
+		want []Breadcrumb
+	}{
+		{"/", []Breadcrumb{}},
+		{"/docs/", []Breadcrumb{{Name: "docs", Path: "/docs"}}},
+		{"/docs/sub%20dir/", []Breadcrumb{{Name: "docs", Path: "/docs"}, {Name: "sub dir", Path: "/docs/sub dir"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", rr.Code)
+			}
+			if !strings.Contains(rr.Header().Get("Vary"), "Accept") {
+				t.Error("directory listings must vary on Accept")
+			}
+
+			var resp DirectoryResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if resp.Breadcrumbs == nil || !reflect.DeepEqual(resp.Breadcrumbs, tt.want) {
+				t.Errorf("breadcrumbs = %#v, want %#v", resp.Breadcrumbs, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiDir_NavigationTemplateHooks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs", "empty"), 0o755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	mounts := []config.DirMount{{Path: "/files", Dir: root, Name: "Files"}}
+	m := NewMultiDir(mounts, &config.Config{Theme: "advanced"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	get := func(target string) string {
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", target, rr.Code)
+		}
+		return rr.Body.String()
+	}
+
+	body := get("/files/docs/")
+	for _, want := range []string{
+		`data-path="/docs" data-base="/files"`,
+		`<a href="/files/" class="breadcrumb-item breadcrumb-home">`,
+		`<a href="/files/docs/" class="breadcrumb-item">docs</a>`,
+		`<div class="empty-state" id="emptyState" hidden>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("listing missing %q", want)
+		}
+	}
+
+	if body := get("/files/docs/empty/"); !strings.Contains(body, `<div class="empty-state" id="emptyState">`) {
+		t.Error("empty directory should show the empty state")
+	}
+}
+
+// newNavigationTree creates docs/sub dir/ with a file at each level.
+func newNavigationTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs", "sub dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"docs/a.txt", "docs/sub dir/b.txt"} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCanonicalSlash(t *testing.T) {
+	root := newNavigationTree(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mounts := []config.DirMount{{Path: "/files", Dir: root, Name: "Files"}}
+
+	testCases := []struct {
+		name    string
+		handler http.Handler
+		target  string
+		want    int
+		wantLoc string
+	}{
+		{name: "default/dir", handler: NewFile(filesystem.NewLocal(root, false),
+			&config.Config{Theme: "default"}, logger), target: "/docs", want: http.StatusMovedPermanently,
+			wantLoc: "/docs/"},
+		{name: "default/query", handler: NewFile(filesystem.NewLocal(root, false),
+			&config.Config{Theme: "default"}, logger), target: "/docs/sub%20dir?sort=name&x=1",
+			want: http.StatusMovedPermanently, wantLoc: "/docs/sub%20dir/?sort=name&x=1"},
+		{name: "default/file slash", handler: NewFile(filesystem.NewLocal(root, false),
+			&config.Config{Theme: "default"}, logger), target: "/docs/a.txt/", want: http.StatusNotFound},
+		{name: "advanced/dir", handler: NewAdvancedFile(filesystem.NewLocal(root, false),
+			&config.Config{Theme: "advanced"}), target: "/docs?view=grid", want: http.StatusMovedPermanently,
+			wantLoc: "/docs/?view=grid"},
+		{name: "advanced/file slash", handler: NewAdvancedFile(filesystem.NewLocal(root, false),
+			&config.Config{Theme: "advanced"}), target: "/docs/a.txt/", want: http.StatusNotFound},
+		{name: "advanced/file", handler: NewAdvancedFile(filesystem.NewLocal(root, false),
+			&config.Config{Theme: "advanced"}), target: "/docs/a.txt", want: http.StatusOK},
+		{name: "multi/mount root", handler: NewMultiDir(mounts, &config.Config{Theme: "advanced"}, logger),
+			target: "/files?q=1", want: http.StatusMovedPermanently, wantLoc: "/files/?q=1"},
+		{name: "multi/subdir", handler: NewMultiDir(mounts, &config.Config{Theme: "default"}, logger),
+			target: "/files/docs", want: http.StatusMovedPermanently, wantLoc: "/files/docs/"},
+		{name: "multi/base path", handler: middleware.BasePath("/gofs", false)(
+			NewMultiDir(mounts, &config.Config{Theme: "advanced"}, logger)),
+			target: "/gofs/files/docs/sub%20dir", want: http.StatusMovedPermanently,
+			wantLoc: "/gofs/files/docs/sub%20dir/"},
+		{name: "multi/file slash", handler: NewMultiDir(mounts, &config.Config{Theme: "advanced"}, logger),
+			target: "/files/docs/a.txt/", want: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, rr.Code)
+			}
+			if loc := rr.Header().Get("Location"); loc != tc.wantLoc {
+				t.Errorf("expected Location %q, got %q", tc.wantLoc, loc)
+			}
+		})
+	}
+}
+
+var relativeHref = regexp.MustCompile(`href="(\.{1,2}/[^"]*)"`)
+
+// TestCanonicalSlash_RelativeLinks follows the redirect of an unslashed
+// directory and checks every relative link of the listing it lands on.
+func TestCanonicalSlash_RelativeLinks(t *testing.T) {
+	root := newNavigationTree(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mounts := []config.DirMount{{Path: "/files", Dir: root, Name: "Files"}}
+
+	for _, theme := range []string{"default", "advanced"} {
+		t.Run(theme, func(t *testing.T) {
+			m := NewMultiDir(mounts, &config.Config{Theme: theme}, logger)
+			get := func(target string) *httptest.ResponseRecorder {
+				rr := httptest.NewRecorder()
+				m.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+				return rr
+			}
+
+			rr := get("/files/docs")
+			if rr.Code != http.StatusMovedPermanently {
+				t.Fatalf("expected a redirect, got %d", rr.Code)
+			}
+			page, _ := url.Parse("http://example.com" + rr.Header().Get("Location"))
+			rr = get(page.RequestURI())
+			if rr.Code != http.StatusOK {
+				t.Fatalf("GET %s: expected 200, got %d", page.RequestURI(), rr.Code)
+			}
+
+			want := map[string]bool{"/files/": false, "/files/docs/a.txt": false, "/files/docs/sub%20dir/": false}
+			for _, match := range relativeHref.FindAllStringSubmatch(rr.Body.String(), -1) {
+				ref, err := url.Parse(match[1])
+				if err != nil {
+					t.Fatalf("bad href %q: %v", match[1], err)
+				}
+				link := page.ResolveReference(ref)
+				if _, ok := want[link.EscapedPath()]; !ok {
+					t.Errorf("href %q resolves to unexpected %s", match[1], link.EscapedPath())
+					continue
+				}
+				want[link.EscapedPath()] = true
+				if rr := get(link.EscapedPath()); rr.Code != http.StatusOK {
+					t.Errorf("href %q: GET %s returned %d", match[1], link.EscapedPath(), rr.Code)
+				}
+			}
+			for link, found := range want {
+				if !found {
+					t.Errorf("listing has no relative link to %s", link)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,613 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// apiOperation describes one endpoint in the OpenAPI document. Request and
+// response schemas are generated from the Go types the handlers encode, so
+// the document cannot drift from the wire format.
+type apiOperation struct {
+	method    string
+	path      string
+	summary   string
+	theme     string // "" for operations every theme serves
+	params    []apiParam
+	request   *apiBody
+	responses map[int]apiBody
+}
+
+// apiParam is a query or header parameter.
+type apiParam struct {
+	name        string
+	in          string // "query" or "header"
+	description string
+	typ         string // JSON schema type of the value
+	required    bool
+	repeated    bool
+}
+
+// apiBody is a request or response body. One of typ, oneOf and schema is
+// set for bodies with content; none is set for empty ones.
+type apiBody struct {
+	description string
+	contentType string
+	typ         any            // Go value whose type is the JSON body
+	oneOf       []any          // Go values whose types the body may take
+	schema      map[string]any // hand-written schema for non-JSON bodies
+}
+
+var (
+	errorBody       = apiBody{description: "Error", contentType: "application/json", typ: middleware.ErrorResponse{}}
+	plainErrorBody  = apiBody{description: "Error", contentType: "text/plain", schema: map[string]any{"type": "string"}}
+	csrfFailureBody = apiBody{
+		description: "Invalid or missing CSRF token, or a foreign Origin; fetch a new token and retry",
+		contentType: "application/json",
+		typ:         CSRFErrorResponse{},
+	}
+	writeForbiddenBody = apiBody{
+		description: "CSRF check failed, or the mount or the whole server is read-only",
+		contentType: "application/json",
+		oneOf:       []any{CSRFErrorResponse{}, ReadonlyErrorResponse{}, middleware.ReadonlyServerResponse{}},
+	}
+	notModifiedBody = apiBody{description: "The If-None-Match ETag is current"}
+)
+
+var (
+	pathParam = apiParam{name: "path", in: "query", typ: "string",
+		description: "Directory within the mount, defaults to its root"}
+	csrfParam = apiParam{name: "X-CSRF-Token", in: "header", typ: "string", required: true,
+		description: "Token from GET /api/csrf"}
+	versionPathParam = apiParam{name: "path", in: "query", typ: "string", required: true,
+		description: "File within the mount"}
+	idempotencyParam = apiParam{name: "Idempotency-Key", in: "header", typ: "string",
+		description: "Replays the first response for retries with the same key"}
+)
+
+// apiOperations lists every endpoint served under a mount. Each path in
+// advancedAPIRoutes and fileAPIRoutes must appear here.
+var apiOperations = []apiOperation{
+	{
+		method: http.MethodGet, path: "/api/capabilities", summary: "Describe the server's features and limits",
+		responses: map[int]apiBody{
+			http.StatusOK:          {description: "Capabilities", contentType: "application/json", typ: CapabilitiesResponse{}},
+			http.StatusNotModified: notModifiedBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/openapi.json", summary: "This document",
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "OpenAPI 3 document", contentType: "application/json",
+				schema: map[string]any{"type": "object"},
+			},
+			http.StatusNotModified: notModifiedBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/manifest", summary: "Checksums of every file below a directory",
+		params: []apiParam{
+			pathParam,
+			{name: "algo", in: "query", typ: "string", description: "sha256 (default), sha512 or md5"},
+		},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "One \"<digest>  <path>\" line per file", contentType: "text/plain",
+				schema: map[string]any{"type": "string"},
+			},
+			http.StatusNotModified: notModifiedBody,
+			http.StatusBadRequest:  plainErrorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/changes", summary: "Stream the entries modified since a time",
+		params: []apiParam{
+			pathParam,
+			{name: "since", in: "query", typ: "string", required: true, description: "RFC 3339 timestamp"},
+		},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "NDJSON: one ChangeEntry per line, then a ChangesTrailer",
+				contentType: "application/x-ndjson",
+				oneOf:       []any{ChangeEntry{}, ChangesTrailer{}},
+			},
+			http.StatusBadRequest: errorBody,
+			http.StatusNotFound:   errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/csrf", summary: "Issue a CSRF token for mutating requests",
+		theme: "advanced",
+		responses: map[int]apiBody{
+			http.StatusOK: {description: "Token", contentType: "application/json", typ: CSRFResponse{}},
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/dirs", summary: "List subdirectories for the sidebar tree",
+		theme: "advanced",
+		params: []apiParam{
+			pathParam,
+			{name: "depth", in: "query", typ: "integer", description: "Levels to descend, defaults to 1"},
+		},
+		responses: map[int]apiBody{
+			http.StatusOK:         {description: "Directory tree", contentType: "application/json", typ: DirsResponse{}},
+			http.StatusBadRequest: errorBody,
+			http.StatusNotFound:   errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/events", summary: "Stream change events for a directory",
+		theme:  "advanced",
+		params: []apiParam{pathParam},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "Server-sent events: a \"change\" event with a DirEvent each time the directory changes",
+				contentType: "text/event-stream",
+				typ:         DirEvent{},
+			},
+			http.StatusBadRequest: errorBody,
+			http.StatusNotFound:   errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/stats", summary: "Report upload and ZIP slots in use",
+		theme: "advanced",
+		responses: map[int]apiBody{
+			http.StatusOK: {description: "Load", contentType: "application/json", typ: StatsResponse{}},
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/upload", summary: "Upload a file",
+		theme: "advanced",
+		params: []apiParam{
+			csrfParam,
+			idempotencyParam,
+			{name: ChecksumSHA256Header, in: "header", typ: "string", description: "Expected SHA-256, hex"},
+			{name: ChecksumMD5Header, in: "header", typ: "string", description: "Expected MD5, hex"},
+			{name: LastModifiedHeader, in: "header", typ: "string",
+				description: "Modification time to apply, RFC 3339 or HTTP date"},
+		},
+		request: &apiBody{
+			contentType: "multipart/form-data",
+			schema: map[string]any{
+				"type":     "object",
+				"required": []any{"file"},
+				"properties": map[string]any{
+					"file":     map[string]any{"type": "string", "format": "binary"},
+					"checksum": map[string]any{"type": "string", "description": "<algorithm>:<hex>"},
+					"lastModified": map[string]any{
+						"type": "string", "description": "Modification time to apply, RFC 3339 or HTTP date",
+					},
+				},
+			},
+		},
+		responses: map[int]apiBody{
+			http.StatusOK:                  {description: "Uploaded", contentType: "application/json", typ: UploadResponse{}},
+			http.StatusBadRequest:          errorBody,
+			http.StatusForbidden:           writeForbiddenBody,
+			http.StatusUnprocessableEntity: errorBody,
+			http.StatusTooManyRequests:     errorBody,
+			http.StatusServiceUnavailable:  errorBody,
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/folder", summary: "Create a folder",
+		theme:   "advanced",
+		params:  []apiParam{csrfParam, idempotencyParam},
+		request: &apiBody{contentType: "application/json", typ: FolderRequest{}},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "Created", contentType: "application/json", typ: FolderResponse{},
+			},
+			http.StatusBadRequest:            errorBody,
+			http.StatusForbidden:             writeForbiddenBody,
+			http.StatusConflict:              errorBody,
+			http.StatusRequestEntityTooLarge: errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/zip", summary: "Download paths as a ZIP archive",
+		theme: "advanced",
+		params: []apiParam{
+			{name: "path", in: "query", typ: "string", required: true, repeated: true,
+				description: "File or directory to include, or with glob the directory to match in"},
+			{name: "glob", in: "query", typ: "string", description: "Include the entries of path matching this pattern"},
+			{name: "name", in: "query", typ: "string", description: "Archive file name"},
+			{name: "manifest", in: "query", typ: "boolean", description: "End the archive with MANIFEST.json"},
+		},
+		responses: zipResponses,
+	},
+	{
+		method: http.MethodPost, path: "/api/zip", summary: "Download paths as a ZIP archive",
+		theme:     "advanced",
+		params:    []apiParam{csrfParam},
+		request:   &apiBody{contentType: "application/json", typ: ZipRequest{}},
+		responses: zipResponses,
+	},
+	{
+		method: http.MethodGet, path: "/api/select", summary: "List the entries of a directory matching a pattern",
+		theme: "advanced",
+		params: []apiParam{
+			{name: "path", in: "query", typ: "string", description: "Directory within the mount, defaults to its root"},
+			{name: "glob", in: "query", typ: "string", required: true,
+				description: "Pattern such as *.log, matched against entry names"},
+			{name: "limit", in: "query", typ: "integer", description: "Most paths to return"},
+		},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "Matching paths, in listing order", contentType: "application/json", typ: SelectResponse{},
+			},
+			http.StatusBadRequest: errorBody,
+			http.StatusNotFound:   errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/diff", summary: "Stream the differences between two directories",
+		theme: "advanced",
+		params: []apiParam{
+			{name: "a", in: "query", typ: "string", required: true,
+				description: "Directory within the mount; with several mounts at /api/diff, a path including the mount"},
+			{name: "b", in: "query", typ: "string", required: true, description: "Directory compared with a"},
+			{name: "hash", in: "query", typ: "boolean", description: "Compare files of equal size by SHA-256"},
+		},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "NDJSON: one DiffEntry per line in path order, then a DiffTrailer",
+				contentType: "application/x-ndjson",
+				oneOf:       []any{DiffEntry{}, DiffTrailer{}},
+			},
+			http.StatusBadRequest: errorBody,
+			http.StatusNotFound:   errorBody,
+		},
+	},
+	bulkOperation("/api/delete", "Delete paths"),
+	bulkOperation("/api/move", "Move paths into a directory"),
+	bulkOperation("/api/copy", "Copy paths into a directory"),
+	{
+		method: http.MethodPost, path: "/api/extract", summary: "Extract a ZIP archive of the mount into a directory",
+		theme:   "advanced",
+		params:  []apiParam{csrfParam},
+		request: &apiBody{contentType: "application/json", typ: ExtractRequest{}},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "Per-entry results", contentType: "application/json", typ: ExtractResponse{},
+			},
+			http.StatusBadRequest: {
+				description: "Invalid request, not a ZIP archive, or entries outside the destination",
+				contentType: "application/json",
+				typ:         ExtractRejectedResponse{},
+			},
+			http.StatusForbidden: writeForbiddenBody,
+			http.StatusNotFound:  errorBody,
+			http.StatusConflict:  errorBody,
+			http.StatusRequestEntityTooLarge: {
+				description: "Request body or extraction limit exceeded", contentType: "application/json",
+				typ: ExtractRejectedResponse{},
+			},
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/qr", summary: "QR code of the URL of a file or directory",
+		theme: "advanced",
+		params: []apiParam{{name: "path", in: "query", typ: "string",
+			description: "File or directory within the mount, defaults to its root"}},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "QR code", contentType: "image/png",
+				schema: map[string]any{"type": "string", "format": "binary"},
+			},
+			http.StatusBadRequest: errorBody,
+			http.StatusNotFound:   errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/versions", summary: "List the kept versions of a file",
+		theme:  "advanced",
+		params: []apiParam{versionPathParam},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "Versions, newest first", contentType: "application/json", typ: VersionsResponse{},
+			},
+			http.StatusBadRequest: errorBody,
+			http.StatusNotFound:   errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/versions/download", summary: "Download a kept version of a file",
+		theme: "advanced",
+		params: []apiParam{
+			versionPathParam,
+			{name: "ts", in: "query", typ: "string", required: true, description: "ts of the version to download"},
+		},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "File contents as an attachment", contentType: "application/octet-stream",
+				schema: map[string]any{"type": "string", "format": "binary"},
+			},
+			http.StatusBadRequest: errorBody,
+			http.StatusNotFound:   errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/scrub/report", summary: "Files the last integrity scrub found corrupted",
+		theme: "advanced",
+		responses: map[int]apiBody{
+			http.StatusOK:       {description: "Scrub report", contentType: "application/json", typ: ScrubReport{}},
+			http.StatusNotFound: errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/{path}", summary: "List a directory as JSON",
+		theme: "advanced",
+		params: []apiParam{
+			{name: "Accept", in: "header", typ: "string", required: true,
+				description: "Must include application/json"},
+			{name: "sort", in: "query", typ: "string",
+				description: "Order files after directories by name (default), size or modTime"},
+			{name: "order", in: "query", typ: "string", description: "asc (default) or desc"},
+			{name: "page", in: "query", typ: "integer", description: "Return only this page of 500 entries"},
+		},
+		responses: map[int]apiBody{
+			http.StatusOK:         {description: "Listing", contentType: "application/json", typ: DirectoryResponse{}},
+			http.StatusBadRequest: errorBody,
+		},
+	},
+	{
+		method: http.MethodGet, path: "/{path}", summary: "List a directory as JSON",
+		theme: "default",
+		params: []apiParam{{name: "Accept", in: "header", typ: "string", required: true,
+			description: "Must include application/json"}},
+		responses: map[int]apiBody{
+			http.StatusOK: {description: "Listing", contentType: "application/json", typ: ListingResponse{}},
+		},
+	},
+}
+
+var zipResponses = map[int]apiBody{
+	http.StatusOK: {
+		description: "Archive; " + ZipSkippedHeader + " counts the selected paths left out",
+		contentType: "application/zip",
+		schema:      map[string]any{"type": "string", "format": "binary"},
+	},
+	http.StatusBadRequest: {
+		description: "Invalid selection, no readable path or tree too deep", contentType: "application/json",
+		oneOf: []any{middleware.ErrorResponse{}, ZipSkippedErrorResponse{}, ZipLimitErrorResponse{}},
+	},
+	http.StatusForbidden: csrfFailureBody,
+	http.StatusRequestEntityTooLarge: {
+		description: "Request body or archive limit exceeded", contentType: "application/json",
+		oneOf: []any{middleware.ErrorResponse{}, ZipLimitErrorResponse{}},
+	},
+	http.StatusTooManyRequests: plainErrorBody,
+}
+
+func bulkOperation(path, summary string) apiOperation {
+	return apiOperation{
+		method: http.MethodPost, path: path, summary: summary,
+		theme:   "advanced",
+		params:  []apiParam{csrfParam},
+		request: &apiBody{contentType: "application/json", typ: BulkRequest{}},
+		responses: map[int]apiBody{
+			http.StatusOK: {
+				description: "Per-path results", contentType: "application/json", typ: BulkResponse{},
+			},
+			http.StatusBadRequest:            errorBody,
+			http.StatusForbidden:             writeForbiddenBody,
+			http.StatusRequestEntityTooLarge: errorBody,
+		},
+	}
+}
+
+func schemaRef(name string) string {
+	return "#/components/schemas/" + name
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// schemaBuilder turns Go types into JSON schemas, collecting named structs
+// under components/schemas.
+type schemaBuilder struct {
+	components map[string]any
+}
+
+func (b *schemaBuilder) schemaFor(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schemaFor(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.components[t.Name()]; !ok {
+			b.components[t.Name()] = nil // Reserve the name for recursive types
+			b.components[t.Name()] = b.structSchema(t)
+		}
+		return map[string]any{"$ref": schemaRef(t.Name())}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema follows encoding/json: the tag names the property, "-" skips
+// the field and omitempty makes it optional. Other properties are never
+// sent, which keeps oneOf alternatives distinct.
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []any{}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schemaFor(field.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") && !strings.Contains(","+opts+",", ",omitzero,") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (b *schemaBuilder) content(body apiBody) map[string]any {
+	schema := body.schema
+	switch {
+	case body.typ != nil:
+		schema = b.schemaFor(reflect.TypeOf(body.typ))
+	case body.oneOf != nil:
+		var alternatives []any
+		for _, v := range body.oneOf {
+			alternatives = append(alternatives, b.schemaFor(reflect.TypeOf(v)))
+		}
+		schema = map[string]any{"oneOf": alternatives}
+	}
+	return map[string]any{body.contentType: map[string]any{"schema": schema}}
+}
+
+// buildOpenAPI returns the document for the operations a theme serves.
+// Paths are relative to serverURL, the mount as the client sees it.
+func buildOpenAPI(theme, version, serverURL string) map[string]any {
+	if serverURL == "" {
+		serverURL = "/"
+	}
+	if version == "" {
+		version = "dev"
+	}
+
+	b := &schemaBuilder{components: make(map[string]any)}
+	paths := make(map[string]any)
+	for _, op := range apiOperations {
+		if op.theme != "" && op.theme != theme {
+			continue
+		}
+
+		operation := map[string]any{
+			"summary":     op.summary,
+			"operationId": operationID(op),
+		}
+		var params []any
+		if op.path == "/{path}" {
+			params = append(params, map[string]any{
+				"name": "path", "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range op.params {
+			schema := map[string]any{"type": p.typ}
+			if p.repeated {
+				schema = map[string]any{"type": "array", "items": schema}
+			}
+			param := map[string]any{"name": p.name, "in": p.in, "schema": schema}
+			if p.required {
+				param["required"] = true
+			}
+			if p.description != "" {
+				param["description"] = p.description
+			}
+			params = append(params, param)
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.request != nil {
+			operation["requestBody"] = map[string]any{"required": true, "content": b.content(*op.request)}
+		}
+
+		responses := make(map[string]any)
+		for status, body := range op.responses {
+			response := map[string]any{"description": body.description}
+			if body.description == "" {
+				response["description"] = http.StatusText(status)
+			}
+			if body.contentType != "" {
+				response["content"] = b.content(body)
+			}
+			responses[strconv.Itoa(status)] = response
+		}
+		responses[strconv.Itoa(http.StatusMethodNotAllowed)] = map[string]any{
+			"description": "Method not allowed",
+			"content":     b.content(plainErrorBody),
+		}
+		operation["responses"] = responses
+
+		item, _ := paths[op.path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "gofs",
+			"version": version,
+		},
+		"servers":    []any{map[string]any{"url": serverURL}},
+		"paths":      paths,
+		"components": map[string]any{"schemas": b.components},
+	}
+}
+
+// operationID derives a stable identifier such as "getApiCapabilities".
+func operationID(op apiOperation) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(op.method))
+	for word := range strings.FieldsFuncSeq(op.path, func(r rune) bool {
+		return r == '/' || r == '.' || r == '{' || r == '}'
+	}) {
+		sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return sb.String()
+}
+
+// serveOpenAPI writes the OpenAPI document for the request's mount with an
+// ETag, like serveCapabilities.
+func serveOpenAPI(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := json.Marshal(buildOpenAPI(cfg.Theme, cfg.Version, mountURL(r)))
+	if err != nil {
+		http.Error(w, "JSON encoding error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	serveBytes(w, r, body, generateContentETag(string(body)), "application/json")
+}
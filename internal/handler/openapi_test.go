@@ -0,0 +1,542 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func fetchOpenAPI(t *testing.T, h http.Handler, r *http.Request) map[string]any {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return doc
+}
+
+func newOpenAPITestHandlers(t *testing.T) (advanced *AdvancedFile, file *File, root string) {
+	t.Helper()
+	root = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs", "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hot := filesystem.NewHotCache(1<<20, 64<<10)
+	fs := filesystem.NewCached(filesystem.NewLocal(root, false), hot)
+	advanced = NewAdvancedFile(fs, &config.Config{Theme: "advanced", Version: "1.2.3", EnableTree: true,
+		MaxHashSize: 1 << 20})
+	advanced.SetHotCache(hot)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	file = NewFile(fs, &config.Config{Theme: "default", Version: "1.2.3", MaxHashSize: 1 << 20}, logger)
+	return advanced, file, root
+}
+
+func TestOpenAPI_RoutesDocumented(t *testing.T) {
+	testCases := []struct {
+		theme  string
+		routes []string
+	}{
+		{theme: "advanced", routes: slices.Sorted(maps.Keys(advancedAPIRoutes))},
+		{theme: "default", routes: slices.Sorted(maps.Keys(fileAPIRoutes))},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.theme, func(t *testing.T) {
+			paths := buildOpenAPI(tc.theme, "", "")["paths"].(map[string]any)
+			for _, route := range tc.routes {
+				if _, ok := paths[route]; !ok {
+					t.Errorf("route %s is served but missing from the OpenAPI document", route)
+				}
+			}
+			for path := range paths {
+				if strings.HasPrefix(path, "/api/") && !slices.Contains(tc.routes, path) {
+					t.Errorf("OpenAPI document describes %s, which is not routed", path)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPI_DocumentIsValid(t *testing.T) {
+	for _, theme := range []string{"advanced", "default"} {
+		t.Run(theme, func(t *testing.T) {
+			body, err := json.Marshal(buildOpenAPI(theme, "1.2.3", "/files"))
+			if err != nil {
+				t.Fatalf("Failed to marshal: %v", err)
+			}
+			var doc map[string]any
+			if err := json.Unmarshal(body, &doc); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			for _, problem := range validateOpenAPIDocument(doc) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// validateOpenAPIDocument checks the parts of the OpenAPI 3.0 schema the
+// generator produces.
+func validateOpenAPIDocument(doc map[string]any) []string {
+	var problems []string
+	fail := func(format string, args ...any) { problems = append(problems, fmt.Sprintf(format, args...)) }
+
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.0.") {
+		fail("openapi must be a 3.0.x version, got %v", doc["openapi"])
+	}
+	info, _ := doc["info"].(map[string]any)
+	if title, _ := info["title"].(string); title == "" {
+		fail("info.title is required")
+	}
+	if version, _ := info["version"].(string); version == "" {
+		fail("info.version is required")
+	}
+	servers, _ := doc["servers"].([]any)
+	for _, server := range servers {
+		if u, _ := server.(map[string]any)["url"].(string); u == "" {
+			fail("server url is required")
+		}
+	}
+
+	components, _ := doc["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	for name, schema := range schemas {
+		checkSchema(schema, "components.schemas."+name, schemas, fail)
+	}
+
+	paths, ok := doc["paths"].(map[string]any)
+	if !ok || len(paths) == 0 {
+		fail("paths must be a non-empty object")
+	}
+	for path, item := range paths {
+		if !strings.HasPrefix(path, "/") {
+			fail("path %q must start with /", path)
+		}
+		for method, op := range item.(map[string]any) {
+			where := method + " " + path
+			if !slices.Contains(openAPIMethods, method) {
+				fail("%s: unknown method", where)
+				continue
+			}
+			checkOperation(op.(map[string]any), path, where, schemas, fail)
+		}
+	}
+	return problems
+}
+
+func checkOperation(op map[string]any, path, where string, schemas map[string]any, fail func(string, ...any)) {
+	if id, _ := op["operationId"].(string); id == "" {
+		fail("%s: operationId is required", where)
+	}
+	params, _ := op["parameters"].([]any)
+	for _, p := range params {
+		param := p.(map[string]any)
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		if name == "" || !slices.Contains([]string{"query", "header", "path", "cookie"}, in) {
+			fail("%s: invalid parameter %v", where, param)
+		}
+		if in == "path" && (param["required"] != true || !strings.Contains(path, "{"+name+"}")) {
+			fail("%s: path parameter %s must be required and appear in the path", where, name)
+		}
+		checkSchema(param["schema"], where+" parameter "+name, schemas, fail)
+	}
+	if body, ok := op["requestBody"].(map[string]any); ok {
+		checkContent(body["content"], where+" requestBody", schemas, fail)
+	}
+	responses, _ := op["responses"].(map[string]any)
+	if len(responses) == 0 {
+		fail("%s: responses are required", where)
+	}
+	for status, r := range responses {
+		response := r.(map[string]any)
+		if code, err := strconv.Atoi(status); err != nil || code < 100 || code > 599 {
+			fail("%s: invalid status %q", where, status)
+		}
+		if d, _ := response["description"].(string); d == "" {
+			fail("%s %s: description is required", where, status)
+		}
+		if content, ok := response["content"]; ok {
+			checkContent(content, where+" "+status, schemas, fail)
+		}
+	}
+}
+
+func checkContent(content any, where string, schemas map[string]any, fail func(string, ...any)) {
+	media, ok := content.(map[string]any)
+	if !ok || len(media) == 0 {
+		fail("%s: content must be a non-empty object", where)
+		return
+	}
+	for contentType, m := range media {
+		checkSchema(m.(map[string]any)["schema"], where+" "+contentType, schemas, fail)
+	}
+}
+
+var openAPITypes = []string{"object", "array", "string", "integer", "number", "boolean"}
+
+func checkSchema(s any, where string, schemas map[string]any, fail func(string, ...any)) {
+	schema, ok := s.(map[string]any)
+	if !ok {
+		fail("%s: schema must be an object", where)
+		return
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		name, found := strings.CutPrefix(ref, "#/components/schemas/")
+		if _, exists := schemas[name]; !found || !exists {
+			fail("%s: unresolved $ref %q", where, ref)
+		}
+		return
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		for i, sub := range oneOf {
+			checkSchema(sub, fmt.Sprintf("%s.oneOf[%d]", where, i), schemas, fail)
+		}
+		return
+	}
+	typ, _ := schema["type"].(string)
+	if !slices.Contains(openAPITypes, typ) {
+		fail("%s: invalid type %v", where, schema["type"])
+	}
+	switch typ {
+	case "array":
+		checkSchema(schema["items"], where+".items", schemas, fail)
+	case "object":
+		properties, _ := schema["properties"].(map[string]any)
+		for name, prop := range properties {
+			checkSchema(prop, where+"."+name, schemas, fail)
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := properties[name.(string)]; !ok {
+				fail("%s: required property %v is not defined", where, name)
+			}
+		}
+		if extra, ok := schema["additionalProperties"]; ok {
+			if _, isBool := extra.(bool); !isBool {
+				checkSchema(extra, where+".additionalProperties", schemas, fail)
+			}
+		}
+	}
+}
+
+// validateValue checks a decoded JSON value against a schema from the
+// document, following $ref.
+func validateValue(schemas map[string]any, schema map[string]any, v any, where string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: unresolved $ref %q", where, ref)}
+		}
+		return validateValue(schemas, target, v, where)
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if len(validateValue(schemas, sub.(map[string]any), v, where)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return []string{fmt.Sprintf("%s: %v matches %d oneOf schemas", where, v, matches)}
+		}
+		return nil
+	}
+
+	mismatch := []string{fmt.Sprintf("%s: %v is not of type %v", where, v, schema["type"])}
+	switch schema["type"] {
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return mismatch
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return []string{fmt.Sprintf("%s: %q is not a date-time", where, s)}
+			}
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			return mismatch
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return mismatch
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return mismatch
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return mismatch
+		}
+		var problems []string
+		for i, item := range items {
+			problems = append(problems,
+				validateValue(schemas, schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", where, i))...)
+		}
+		return problems
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return mismatch
+		}
+		var problems []string
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %v", where, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, value := range obj {
+			prop, ok := properties[name].(map[string]any)
+			if !ok {
+				switch extra := schema["additionalProperties"].(type) {
+				case map[string]any:
+					prop = extra
+				case bool:
+					if !extra {
+						problems = append(problems, fmt.Sprintf("%s: undocumented property %q", where, name))
+					}
+					continue
+				default:
+					continue
+				}
+			}
+			problems = append(problems, validateValue(schemas, prop, value, where+"."+name)...)
+		}
+		return problems
+	}
+	return nil
+}
+
+// responseSchema returns the documented schema of a response.
+func responseSchema(t *testing.T, doc map[string]any, method, path string, status int, contentType string,
+) map[string]any {
+	t.Helper()
+	item, ok := doc["paths"].(map[string]any)[path].(map[string]any)
+	if !ok {
+		t.Fatalf("%s is not documented", path)
+	}
+	op, ok := item[strings.ToLower(method)].(map[string]any)
+	if !ok {
+		t.Fatalf("%s %s is not documented", method, path)
+	}
+	response, ok := op["responses"].(map[string]any)[strconv.Itoa(status)].(map[string]any)
+	if !ok {
+		t.Fatalf("%s %s: status %d is not documented", method, path, status)
+	}
+	media, ok := response["content"].(map[string]any)[contentType].(map[string]any)
+	if !ok {
+		t.Fatalf("%s %s %d: content type %s is not documented", method, path, status, contentType)
+	}
+	return media["schema"].(map[string]any)
+}
+
+// checkResponse validates a recorded JSON response against the document.
+func checkResponse(t *testing.T, doc map[string]any, method, path string, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	contentType, _, _ := strings.Cut(rr.Header().Get("Content-Type"), ";")
+	schema := responseSchema(t, doc, method, path, rr.Code, contentType)
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	var values []any
+	if contentType == "application/x-ndjson" {
+		for line := range strings.Lines(rr.Body.String()) {
+			var v any
+			if err := json.Unmarshal([]byte(line), &v); err != nil {
+				t.Fatalf("%s %s: invalid NDJSON line %q: %v", method, path, line, err)
+			}
+			values = append(values, v)
+		}
+	} else {
+		var v any
+		if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", method, path, rr.Body.String(), err)
+		}
+		values = append(values, v)
+	}
+	for _, v := range values {
+		for _, problem := range validateValue(schemas, schema, v, method+" "+path) {
+			t.Error(problem)
+		}
+	}
+}
+
+func TestOpenAPI_ResponsesMatchDocument(t *testing.T) {
+	advanced, file, _ := newOpenAPITestHandlers(t)
+	advancedDoc := fetchOpenAPI(t, advanced, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	fileDoc := fetchOpenAPI(t, file, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	serve := func(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+	jsonRequest := func(method, target string, body any) *http.Request {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		r := httptest.NewRequest(method, target, bytes.NewReader(data))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-CSRF-Token", advanced.csrfTokens.generateToken())
+		return r
+	}
+	listing := func(target string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Accept", "application/json")
+		return r
+	}
+	upload := func() *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, err := mw.CreateFormFile("file", "uploaded.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write([]byte("uploaded"))
+		_ = mw.Close()
+		r := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		r.Header.Set("X-CSRF-Token", advanced.csrfTokens.generateToken())
+		return r
+	}
+	readonly := func(r *http.Request) *http.Request {
+		return r.WithContext(internal.WithMountInfo(r.Context(), "/data", "Data", true))
+	}
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	testCases := []struct {
+		name   string
+		h      http.Handler
+		doc    map[string]any
+		path   string
+		req    *http.Request
+		status int
+	}{
+		{"capabilities", advanced, advancedDoc, "/api/capabilities",
+			httptest.NewRequest(http.MethodGet, "/api/capabilities", nil), http.StatusOK},
+		{"csrf", advanced, advancedDoc, "/api/csrf", httptest.NewRequest(http.MethodGet, "/api/csrf", nil), http.StatusOK},
+		{"stats", advanced, advancedDoc, "/api/stats", httptest.NewRequest(http.MethodGet, "/api/stats", nil), http.StatusOK},
+		{"dirs", advanced, advancedDoc, "/api/dirs",
+			httptest.NewRequest(http.MethodGet, "/api/dirs?depth=2", nil), http.StatusOK},
+		{"dirs_bad_depth", advanced, advancedDoc, "/api/dirs",
+			httptest.NewRequest(http.MethodGet, "/api/dirs?depth=x", nil), http.StatusBadRequest},
+		{"changes", advanced, advancedDoc, "/api/changes",
+			httptest.NewRequest(http.MethodGet, "/api/changes?since="+since, nil), http.StatusOK},
+		{"changes_bad_since", advanced, advancedDoc, "/api/changes",
+			httptest.NewRequest(http.MethodGet, "/api/changes", nil), http.StatusBadRequest},
+		{"events_not_dir", advanced, advancedDoc, "/api/events",
+			httptest.NewRequest(http.MethodGet, "/api/events?path=docs/a.txt", nil), http.StatusBadRequest},
+		{"events_missing", advanced, advancedDoc, "/api/events",
+			httptest.NewRequest(http.MethodGet, "/api/events?path=missing", nil), http.StatusNotFound},
+		{"upload", advanced, advancedDoc, "/api/upload", upload(), http.StatusOK},
+		{"folder", advanced, advancedDoc, "/api/folder",
+			jsonRequest(http.MethodPost, "/api/folder", FolderRequest{Path: "created"}), http.StatusOK},
+		{"folder_invalid", advanced, advancedDoc, "/api/folder",
+			jsonRequest(http.MethodPost, "/api/folder", FolderRequest{Path: ""}), http.StatusBadRequest},
+		{"folder_readonly", advanced, advancedDoc, "/api/folder",
+			readonly(jsonRequest(http.MethodPost, "/api/folder", FolderRequest{Path: "x"})), http.StatusForbidden},
+		{"copy", advanced, advancedDoc, "/api/copy",
+			jsonRequest(http.MethodPost, "/api/copy", BulkRequest{Paths: []string{"docs/a.txt"}, Destination: "created"}),
+			http.StatusOK},
+		{"extract_not_zip", advanced, advancedDoc, "/api/extract",
+			jsonRequest(http.MethodPost, "/api/extract", ExtractRequest{Path: "docs/a.txt"}), http.StatusBadRequest},
+		{"extract_missing", advanced, advancedDoc, "/api/extract",
+			jsonRequest(http.MethodPost, "/api/extract", ExtractRequest{Path: "missing.zip"}), http.StatusNotFound},
+		{"zip_limit", advanced, advancedDoc, "/api/zip",
+			jsonRequest(http.MethodPost, "/api/zip", ZipRequest{Paths: []string{"../escape"}}), http.StatusBadRequest},
+		{"qr_missing", advanced, advancedDoc, "/api/qr",
+			httptest.NewRequest(http.MethodGet, "/api/qr?path=missing.txt", nil), http.StatusNotFound},
+		{"listing", advanced, advancedDoc, "/{path}", listing("/docs/"), http.StatusOK},
+		{"default_capabilities", file, fileDoc, "/api/capabilities",
+			httptest.NewRequest(http.MethodGet, "/api/capabilities", nil), http.StatusOK},
+		{"default_changes", file, fileDoc, "/api/changes",
+			httptest.NewRequest(http.MethodGet, "/api/changes?since="+since, nil), http.StatusOK},
+		{"default_listing", file, fileDoc, "/{path}", listing("/docs/"), http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := serve(tc.h, tc.req)
+			if rr.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			checkResponse(t, tc.doc, tc.req.Method, tc.path, rr)
+		})
+	}
+}
+
+func TestOpenAPI_ETagAndServer(t *testing.T) {
+	advanced, _, _ := newOpenAPITestHandlers(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	r = r.WithContext(internal.WithMountInfo(r.Context(), "/files/", "files", false))
+	rr := httptest.NewRecorder()
+	advanced.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	server := doc["servers"].([]any)[0].(map[string]any)
+	if server["url"] != "/files" {
+		t.Errorf("expected the mount as the server URL, got %v", server["url"])
+	}
+	if version := doc["info"].(map[string]any)["version"]; version != "1.2.3" {
+		t.Errorf("expected version 1.2.3, got %v", version)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	r = r.WithContext(internal.WithMountInfo(r.Context(), "/files/", "files", false))
+	r.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	advanced.ServeHTTP(rr, r)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	advanced.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/openapi.json", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rr.Code)
+	}
+}
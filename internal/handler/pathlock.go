@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errConcurrentModification reports a write that gave up waiting for another
+// write to the same path.
+var errConcurrentModification = errors.New("concurrent modification")
+
+// pathLocks serializes writes to the same path within the process. Each
+// cleaned path has its own lock, kept only while a write holds or waits for
+// it, so writes to different paths never wait for each other. The locks are
+// advisory: other processes writing to the directory do not take them.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// pathLock is the lock of one path and the number of writes holding or
+// waiting for it.
+type pathLock struct {
+	held chan struct{}
+	refs int
+}
+
+func newPathLocks() *pathLocks {
+	return &pathLocks{locks: make(map[string]*pathLock)}
+}
+
+// lock takes the lock of name, waiting up to wait for a write holding it to
+// finish. It returns errConcurrentModification when the wait runs out and
+// the context's error when ctx ends first. A successful call returns the
+// function that releases the lock.
+func (l *pathLocks) lock(ctx context.Context, name string, wait time.Duration) (func(), error) {
+	pl := l.acquire(name)
+	unlock := func() {
+		<-pl.held
+		l.release(name, pl)
+	}
+
+	select {
+	case pl.held <- struct{}{}:
+		return unlock, nil
+	default:
+	}
+	if wait <= 0 {
+		l.release(name, pl)
+		return nil, errConcurrentModification
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case pl.held <- struct{}{}:
+		return unlock, nil
+	case <-timer.C:
+		l.release(name, pl)
+		return nil, errConcurrentModification
+	case <-ctx.Done():
+		l.release(name, pl)
+		return nil, ctx.Err()
+	}
+}
+
+// acquire returns the lock of name, creating it if no write uses it, and
+// counts the caller as one of its users.
+func (l *pathLocks) acquire(name string) *pathLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pl, ok := l.locks[name]
+	if !ok {
+		pl = &pathLock{held: make(chan struct{}, 1)}
+		l.locks[name] = pl
+	}
+	pl.refs++
+	return pl
+}
+
+// release ends the caller's use of pl, dropping it once nobody uses it.
+func (l *pathLocks) release(name string, pl *pathLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if pl.refs--; pl.refs == 0 {
+		delete(l.locks, name)
+	}
+}
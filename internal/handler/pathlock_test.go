@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func TestPathLocks(t *testing.T) {
+	locks := newPathLocks()
+	ctx := context.Background()
+
+	unlock, err := locks.lock(ctx, "a.txt", 0)
+	if err != nil {
+		t.Fatalf("Expected the free lock, got %v", err)
+	}
+	if _, err := locks.lock(ctx, "a.txt", 0); !errors.Is(err, errConcurrentModification) {
+		t.Errorf("Expected a held lock to fail at once, got %v", err)
+	}
+	if _, err := locks.lock(ctx, "a.txt", 20*time.Millisecond); !errors.Is(err, errConcurrentModification) {
+		t.Errorf("Expected the wait to run out, got %v", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := locks.lock(canceled, "a.txt", time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		unlock()
+	}()
+	unlock, err = locks.lock(ctx, "a.txt", 2*time.Second)
+	if err != nil {
+		t.Fatalf("Expected the lock once it was released, got %v", err)
+	}
+	unlock()
+	if len(locks.locks) != 0 {
+		t.Errorf("Expected released locks to be dropped, %d left", len(locks.locks))
+	}
+}
+
+// TestAdvancedFile_UploadLockOtherPath saves to a path whose FNV-1a hash
+// equals that of a path being saved modulo 256, so a table of 256 hashed
+// locks would have made it wait.
+func TestAdvancedFile_UploadLockOtherPath(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	stripe := func(name string) uint32 {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(name))
+		return hash.Sum32() % 256
+	}
+	other := ""
+	for i := 0; other == ""; i++ {
+		if name := fmt.Sprintf("other-%d.txt", i); stripe(name) == stripe("hello.txt") {
+			other = name
+		}
+	}
+
+	pw, done := startSlowSave(t, h, "hello.txt")
+	if err := h.saveUploadedFile(context.Background(), strings.NewReader("other"), other, nil,
+		time.Time{}); err != nil {
+		t.Errorf("Expected %s to be stored while hello.txt is, got %v", other, err)
+	}
+	_, _ = pw.Write([]byte("first payload"))
+	_ = pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected hello.txt to be stored, got %v", err)
+	}
+	for name, want := range map[string]string{"hello.txt": "first payload", other: "other"} {
+		if data, err := os.ReadFile(filepath.Join(root, name)); err != nil || string(data) != want {
+			t.Errorf("Expected %s to hold %q, got %q %v", name, want, data, err)
+		}
+	}
+}
+
+// startSlowSave saves name from a pipe and returns the writer feeding it and
+// the channel receiving saveUploadedFile's result, once the save holds the
+// lock of name.
+func startSlowSave(t *testing.T, h *AdvancedFile, name string) (*io.PipeWriter, <-chan error) {
+	t.Helper()
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- h.saveUploadedFile(context.Background(), pr, name, nil, time.Time{})
+	}()
+	waitFor(t, "the save to take the lock", func() bool {
+		unlock, err := h.uploadLocks.lock(context.Background(), name, 0)
+		if err == nil {
+			unlock()
+		}
+		return err != nil
+	})
+	return pw, done
+}
+
+func TestAdvancedFile_UploadLockConflict(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	pw, done := startSlowSave(t, h, "hello.txt")
+	_, _ = pw.Write([]byte("first "))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, newUploadRequest(t, h, "second payload", nil))
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "Concurrent modification") {
+		t.Errorf("Expected 409 for the second upload, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	_, _ = pw.Write([]byte("payload"))
+	_ = pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the first upload to be stored, got %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "hello.txt"))
+	if err != nil || string(data) != "first payload" {
+		t.Errorf("Expected the first payload, got %q %v", data, err)
+	}
+}
+
+func TestAdvancedFile_UploadLockWait(t *testing.T) {
+	root := t.TempDir()
+	cfg := &config.Config{Theme: "advanced", UploadLockWait: 5 * time.Second}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), cfg)
+
+	pw, done := startSlowSave(t, h, "hello.txt")
+	req := newUploadRequest(t, h, "second payload", nil)
+	second := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		second <- rr
+	}()
+	waitForInFlightUploads(t, h, 1)
+
+	_, _ = pw.Write([]byte("first payload"))
+	_ = pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the first upload to be stored, got %v", err)
+	}
+	if rr := <-second; rr.Code != http.StatusOK {
+		t.Fatalf("Expected the waiting upload to be stored, got %d %s", rr.Code, rr.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(root, "hello.txt"))
+	if err != nil || string(data) != "second payload" {
+		t.Errorf("Expected the upload stored last, got %q %v", data, err)
+	}
+}
+
+func TestAdvancedFile_ConcurrentUploadsSamePath(t *testing.T) {
+	root := t.TempDir()
+	cfg := &config.Config{Theme: "advanced", UploadLockWait: 5 * time.Second}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), cfg)
+
+	payloads := []string{strings.Repeat("a", 256<<10), strings.Repeat("b", 256<<10)}
+	codes := make([]int, len(payloads))
+	var wg sync.WaitGroup
+	for i, payload := range payloads {
+		req := newUploadRequest(t, h, payload, nil)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			codes[i] = rr.Code
+		}()
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Expected upload %d to be stored after the other, got %d", i, code)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(root, "hello.txt"))
+	if err != nil || (string(data) != payloads[0] && string(data) != payloads[1]) {
+		t.Errorf("Expected one complete payload, got %d bytes %v", len(data), err)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/listing"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/httprange"
+)
+
+// precompressedSuffixes lists the sidecar extensions that are served in place
+// of the original file, in order of preference.
+var precompressedSuffixes = []struct {
+	suffix   string
+	encoding string
+}{
+	{suffix: ".br", encoding: "br"},
+	{suffix: ".gz", encoding: "gzip"},
+}
+
+// precompressedVariant is a sidecar file holding an encoded copy of a file.
+type precompressedVariant struct {
+	info     internal.FileInfo
+	path     string
+	encoding string
+}
+
+// findPrecompressed returns the sidecars of path that are at least as recent as
+// the original. Stale sidecars are ignored so edits are never masked.
+func findPrecompressed(fsys internal.FileSystem, path string, original internal.FileInfo) []precompressedVariant {
+	var variants []precompressedVariant
+	for _, s := range precompressedSuffixes {
+		info, err := fsys.Stat(path + s.suffix)
+		if err != nil || info.IsDir() || info.ModTime().Before(original.ModTime()) {
+			continue
+		}
+		variants = append(variants, precompressedVariant{
+			info:     info,
+			path:     path + s.suffix,
+			encoding: s.encoding,
+		})
+	}
+	return variants
+}
+
+// selectPrecompressed picks the preferred variant accepted by the client.
+//
+// Range requests always get the identity representation: byte offsets are
+// only ever served from the identity bytes, under the identity ETag, so an
+// If-Range naming an encoded ETag does not match and yields the full
+// identity body. Encoded representations are served whole, with
+// Accept-Ranges: none, so clients do not resume them with ranges.
+func selectPrecompressed(r *http.Request, variants []precompressedVariant) (precompressedVariant, bool) {
+	if r.Header.Get("Range") != "" {
+		return precompressedVariant{}, false
+	}
+	accept := r.Header.Get("Accept-Encoding")
+	for _, v := range variants {
+		if acceptsEncoding(accept, v.encoding) {
+			return v, true
+		}
+	}
+	return precompressedVariant{}, false
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding.
+// An explicit entry takes precedence over "*", and q=0 means not acceptable.
+func acceptsEncoding(header, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != coding && name != "*" {
+			continue
+		}
+
+		accepted := true
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				accepted = false
+			}
+		}
+
+		if name == coding {
+			return accepted
+		}
+		wildcard = accepted
+	}
+	return wildcard
+}
+
+// servePrecompressed writes the sidecar v as the encoded representation of
+// path, whose identity type is mimeType. It returns false without writing
+// anything if the sidecar cannot be opened, so the caller can fall back to
+// the identity representation.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, fsys internal.FileSystem,
+	v precompressedVariant, path, mimeType string, logger *slog.Logger,
+) bool {
+	file, err := fsys.Open(v.path)
+	if err != nil {
+		logger.Debug("Precompressed sidecar unavailable, serving identity",
+			slog.String("path", v.path),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+	defer file.Close()
+
+	// The encoding is part of the tag so caches never mix representations
+	etag := fmt.Sprintf(`"gofs-%x-%x-%s"`, v.info.Size(), v.info.ModTime().UnixNano(), v.encoding)
+	if _, serve := checkConditions(w, r, etag, v.info.ModTime()); !serve {
+		return true
+	}
+
+	w.Header().Set("Content-Disposition", contentDisposition(r, filepath.Base(path)))
+	w.Header().Set("Content-Encoding", v.encoding)
+	w.Header().Set("Accept-Ranges", "none")
+	if r.Method == http.MethodHead {
+		httprange.WriteHeader(w, nil, v.info.Size(), mimeType)
+		return true
+	}
+	if _, err := httprange.ServeFullContent(r.Context(), w, file, v.info.Size(), mimeType); err != nil {
+		logCopyError(logger, "Error serving precompressed content", err,
+			slog.String("path", v.path),
+		)
+	} else {
+		middleware.MarkDownload(r)
+	}
+	return true
+}
+
+// listingOptions returns the listing filters of cfg. Sidecar files are
+// hidden next to the file they encode unless --show-precompressed is set.
+func listingOptions(cfg *config.Config) listing.Options {
+	opts := listing.Options{ShowHidden: cfg.ShowHidden}
+	if !cfg.ShowPrecompressed {
+		for _, s := range precompressedSuffixes {
+			opts.SidecarSuffixes = append(opts.SidecarSuffixes, s.suffix)
+		}
+	}
+	return opts
+}
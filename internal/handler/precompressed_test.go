@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// writePrecompressedFixture writes app.js with .gz and .br sidecars whose
+// modification times are offset from the original by sidecarAge.
+func writePrecompressedFixture(t *testing.T, sidecarAge time.Duration) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.js":    "console.log('identity');",
+		"app.js.gz": "gzip-bytes",
+		"app.js.br": "brotli-bytes",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	original := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "app.js"), original, original); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	sidecar := original.Add(sidecarAge)
+	for _, name := range []string{"app.js.gz", "app.js.br"} {
+		if err := os.Chtimes(filepath.Join(dir, name), sidecar, sidecar); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestFileHandler_Precompressed(t *testing.T) {
+	dir := writePrecompressedFixture(t, time.Minute)
+	cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "default"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewFile(filesystem.NewLocal(dir, false), cfg, logger)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		rangeHeader    string
+		wantStatus     int
+		wantEncoding   string
+		wantBody       string
+	}{
+		{
+			name:           "prefers brotli",
+			acceptEncoding: "gzip, deflate, br",
+			wantStatus:     http.StatusOK,
+			wantEncoding:   "br",
+			wantBody:       "brotli-bytes",
+		},
+		{
+			name:           "gzip only",
+			acceptEncoding: "gzip",
+			wantStatus:     http.StatusOK,
+			wantEncoding:   "gzip",
+			wantBody:       "gzip-bytes",
+		},
+		{
+			name:           "brotli refused with q=0",
+			acceptEncoding: "br;q=0, *",
+			wantStatus:     http.StatusOK,
+			wantEncoding:   "gzip",
+			wantBody:       "gzip-bytes",
+		},
+		{
+			name:       "no accept-encoding",
+			wantStatus: http.StatusOK,
+			wantBody:   "console.log('identity');",
+		},
+		{
+			name:           "range request gets identity",
+			acceptEncoding: "gzip, br",
+			rangeHeader:    "bytes=0-6",
+			wantStatus:     http.StatusPartialContent,
+			wantBody:       "console",
+		},
+	}
+
+	etags := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("expected Content-Encoding %q, got %q", tt.wantEncoding, got)
+			}
+			if got := rr.Body.String(); got != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, got)
+			}
+			if got := rr.Header().Get("Content-Type"); !strings.Contains(got, "javascript") {
+				t.Errorf("expected JavaScript Content-Type, got %q", got)
+			}
+			if got := rr.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("expected Vary: Accept-Encoding, got %q", got)
+			}
+			etags[tt.wantEncoding] = rr.Header().Get("ETag")
+		})
+	}
+
+	if etags["br"] == etags[""] || etags["gzip"] == etags[""] || etags["br"] == etags["gzip"] {
+		t.Errorf("expected distinct ETags per representation, got %v", etags)
+	}
+
+	t.Run("conditional request on encoded variant", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		req.Header.Set("If-None-Match", etags["br"])
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("expected 304, got %d", rr.Code)
+		}
+	})
+}
+
+// TestPrecompressed_Ranges locks in how ranges and encodings combine: byte
+// ranges are only ever served from the identity representation, and encoded
+// responses are whole, with Accept-Ranges: none.
+func TestPrecompressed_Ranges(t *testing.T) {
+	dir := writePrecompressedFixture(t, time.Minute)
+	cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "advanced"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := map[string]http.Handler{
+		"default":  NewFile(filesystem.NewLocal(dir, false), cfg, logger),
+		"advanced": NewAdvancedFile(filesystem.NewLocal(dir, false), cfg),
+	}
+
+	for name, h := range handlers {
+		t.Run(name, func(t *testing.T) {
+			identityETag := getPath(h, "/app.js", nil).Header().Get("ETag")
+			brETag := getPath(h, "/app.js", http.Header{"Accept-Encoding": {"br"}}).Header().Get("ETag")
+
+			tests := []struct {
+				name         string
+				method       string
+				header       http.Header
+				wantStatus   int
+				wantEncoding string
+				wantRanges   string // Accept-Ranges
+				wantBody     string
+			}{
+				{"encoded", http.MethodGet, http.Header{"Accept-Encoding": {"br"}},
+					http.StatusOK, "br", "none", "brotli-bytes"},
+				{"encoded head", http.MethodHead, http.Header{"Accept-Encoding": {"gzip"}},
+					http.StatusOK, "gzip", "none", ""},
+				{"range over identity", http.MethodGet,
+					http.Header{"Accept-Encoding": {"br, gzip"}, "Range": {"bytes=8-10"}},
+					http.StatusPartialContent, "", "bytes", "log"},
+				{"if-range with the encoded etag", http.MethodGet,
+					http.Header{"Accept-Encoding": {"br"}, "Range": {"bytes=0-6"}, "If-Range": {brETag}},
+					http.StatusOK, "", "bytes", "console.log('identity');"},
+				{"if-range with the identity etag", http.MethodGet,
+					http.Header{"Accept-Encoding": {"br"}, "Range": {"bytes=0-6"}, "If-Range": {identityETag}},
+					http.StatusPartialContent, "", "bytes", "console"},
+				{"unsatisfiable range", http.MethodGet,
+					http.Header{"Accept-Encoding": {"br"}, "Range": {"bytes=100-"}},
+					http.StatusRequestedRangeNotSatisfiable, "", "", ""},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					req := httptest.NewRequest(tt.method, "/app.js", nil)
+					for k, v := range tt.header {
+						req.Header[k] = v
+					}
+					rr := httptest.NewRecorder()
+					h.ServeHTTP(rr, req)
+
+					if rr.Code != tt.wantStatus {
+						t.Fatalf("expected status %d, got %d", tt.wantStatus, rr.Code)
+					}
+					if got := rr.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+						t.Errorf("expected Content-Encoding %q, got %q", tt.wantEncoding, got)
+					}
+					if tt.wantRanges != "" && rr.Header().Get("Accept-Ranges") != tt.wantRanges {
+						t.Errorf("expected Accept-Ranges %q, got %q", tt.wantRanges, rr.Header().Get("Accept-Ranges"))
+					}
+					if got := rr.Body.String(); tt.wantStatus != http.StatusRequestedRangeNotSatisfiable &&
+						got != tt.wantBody {
+						t.Errorf("expected body %q, got %q", tt.wantBody, got)
+					}
+					etag := rr.Header().Get("ETag")
+					if tt.wantStatus != http.StatusRequestedRangeNotSatisfiable &&
+						(etag == identityETag) != (tt.wantEncoding == "") {
+						t.Errorf("expected the ETag of the %q representation, got %s", tt.wantEncoding, etag)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestFileHandler_PrecompressedStale(t *testing.T) {
+	dir := writePrecompressedFixture(t, -time.Minute)
+	cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "default"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewFile(filesystem.NewLocal(dir, false), cfg, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("expected identity for stale sidecars, got Content-Encoding %q", got)
+	}
+	if got := rr.Body.String(); got != "console.log('identity');" {
+		t.Errorf("expected identity body, got %q", got)
+	}
+}
+
+func TestFileHandler_PrecompressedListing(t *testing.T) {
+	dir := writePrecompressedFixture(t, time.Minute)
+	if err := os.WriteFile(filepath.Join(dir, "backup.tar.gz"), []byte("archive"), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	listing := func(show bool) []string {
+		cfg := &config.Config{MaxHashSize: 1 << 20, Theme: "default", ShowPrecompressed: show}
+		handler := NewFile(filesystem.NewLocal(dir, false), cfg, logger)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var resp struct {
+			Files []struct {
+				Name string `json:"name"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode listing: %v", err)
+		}
+		names := make([]string, 0, len(resp.Files))
+		for _, f := range resp.Files {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	if got := strings.Join(listing(false), ","); got != "app.js,backup.tar.gz" {
+		t.Errorf("expected sidecars hidden, got %q", got)
+	}
+	if got := strings.Join(listing(true), ","); got != "app.js,app.js.br,app.js.gz,backup.tar.gz" {
+		t.Errorf("expected sidecars listed with --show-precompressed, got %q", got)
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		coding string
+		want   bool
+	}{
+		{header: "gzip, br", coding: "br", want: true},
+		{header: "gzip", coding: "br", want: false},
+		{header: "GZIP;q=0.5", coding: "gzip", want: true},
+		{header: "gzip;q=0", coding: "gzip", want: false},
+		{header: "*", coding: "br", want: true},
+		{header: "*;q=0", coding: "br", want: false},
+		{header: "br;q=0, *", coding: "br", want: false},
+		{header: "", coding: "gzip", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsEncoding(tt.header, tt.coding); got != tt.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", tt.header, tt.coding, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
+	"github.com/samzong/gofs/pkg/qrcode"
+)
+
+// qrScale is the size in pixels of one module of the /api/qr images.
+const qrScale = 6
+
+// handleQR handles GET /api/qr?path=..., returning a PNG QR code of the URL of
+// a file or directory on the request's mount.
+func (h *AdvancedFile) handleQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := pathsafe.Clean(r.URL.Query().Get("path"))
+	if err != nil {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	info, err := h.fs.Stat(name)
+	if err != nil {
+		h.reporter().JSONError(w, r, "File not found", http.StatusNotFound, err)
+		return
+	}
+
+	scheme := middleware.RequestScheme(r)
+	if h.config.BehindTLSProxy {
+		scheme = "https"
+	}
+	target := mountURL(r) + "/"
+	if name != "" {
+		target = resourceURL(r, name, info.IsDir())
+	}
+	target = scheme + "://" + qrHost(r.Host, h.config.Host) + target
+
+	code, err := qrcode.Encode([]byte(target), qrcode.M)
+	if errors.Is(err, qrcode.ErrTooLong) {
+		middleware.WriteJSONError(w, "URL is too long for a QR code", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.reporter().JSONError(w, r, "Failed to create QR code", http.StatusInternalServerError, err)
+		return
+	}
+	png, err := code.PNG(qrScale)
+	if err != nil {
+		h.reporter().JSONError(w, r, "Failed to create QR code", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(png)
+}
+
+// qrHost returns the host of a request with a loopback address replaced by
+// the LAN one, since a phone scanning the code cannot reach localhost.
+func qrHost(requestHost, bind string) string {
+	host, port, err := net.SplitHostPort(requestHost)
+	if err != nil {
+		host, port = requestHost, ""
+	}
+	lan := LANHost(strings.Trim(host, "[]"), bind)
+	if lan == strings.Trim(host, "[]") {
+		return requestHost
+	}
+	if port == "" {
+		return lan
+	}
+	return net.JoinHostPort(lan, port)
+}
+
+// LANHost returns the first non-loopback IPv4 address of an interface in
+// place of host when the server listens on all addresses (bind) and host is
+// loopback or unspecified. Otherwise host is returned as is, or "localhost"
+// for an unspecified host without a LAN address.
+func LANHost(host, bind string) string {
+	if !isUnspecifiedHost(bind) || !(isUnspecifiedHost(host) || isLoopbackHost(host)) {
+		return host
+	}
+	if ip := lanIPv4(); ip != nil {
+		return ip.String()
+	}
+	if isUnspecifiedHost(host) {
+		return "localhost"
+	}
+	return host
+}
+
+func isUnspecifiedHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func lanIPv4() net.IP {
+	for _, ip := range lanAddresses(systemInterfaces()) {
+		if ip.To4() != nil {
+			return ip
+		}
+	}
+	return nil
+}
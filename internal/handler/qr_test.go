@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/pkg/qrcode"
+)
+
+func TestAdvancedFile_QR(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "a b.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", Host: "127.0.0.1"})
+
+	testCases := []struct {
+		name   string
+		target string
+		url    string
+		status int
+	}{
+		{"root", "/api/qr", "http://127.0.0.1:8000/", http.StatusOK},
+		{"file", "/api/qr?path=docs/a%20b.txt", "http://127.0.0.1:8000/docs/a%20b.txt", http.StatusOK},
+		{"dir", "/api/qr?path=/docs", "http://127.0.0.1:8000/docs/", http.StatusOK},
+		{"missing", "/api/qr?path=missing", "", http.StatusNotFound},
+		{"escape", "/api/qr?path=../etc", "", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			r.Host = "127.0.0.1:8000"
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+			if rr.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("expected image/png, got %s", ct)
+			}
+			code, err := qrcode.Encode([]byte(tc.url), qrcode.M)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := code.PNG(qrScale)
+			if !bytes.Equal(rr.Body.Bytes(), want) {
+				t.Errorf("expected the QR code of %s", tc.url)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/qr", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected 405, got %d", rr.Code)
+	}
+}
+
+func TestLANHost(t *testing.T) {
+	// Hosts that are not loopback, or servers bound to one address, are kept
+	for _, tc := range []struct{ host, bind string }{
+		{"files.example.com", "0.0.0.0"},
+		{"192.168.1.20", ""},
+		{"127.0.0.1", "127.0.0.1"},
+		{"localhost", "192.168.1.20"},
+	} {
+		if got := LANHost(tc.host, tc.bind); got != tc.host {
+			t.Errorf("LANHost(%q, %q): expected %q, got %q", tc.host, tc.bind, tc.host, got)
+		}
+	}
+
+	// Otherwise the host is replaced by a LAN address when there is one
+	for _, host := range []string{"127.0.0.1", "localhost", "::1", "0.0.0.0", ""} {
+		got := LANHost(host, "0.0.0.0")
+		if ip := net.ParseIP(got); ip != nil && ip.To4() != nil && !ip.IsLoopback() && !ip.IsUnspecified() {
+			continue
+		}
+		if want := map[bool]string{true: "localhost", false: host}[isUnspecifiedHost(host)]; got != want {
+			t.Errorf("LANHost(%q): expected a LAN address or %q, got %q", host, want, got)
+		}
+	}
+}
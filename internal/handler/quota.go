@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/pkg/fileutil"
+)
+
+// QuotaErrorResponse is returned with 507 Insufficient Storage when a write
+// would exceed the mount's quota.
+type QuotaErrorResponse struct {
+	Error string `json:"error"`
+	Used  int64  `json:"used"`
+	Limit int64  `json:"limit"`
+}
+
+// quotaExceededError reports the usage that caused a write to be refused.
+type quotaExceededError struct {
+	used, limit int64
+}
+
+func (e *quotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s used of %s",
+		fileutil.FormatSize(e.used), fileutil.FormatSize(e.limit))
+}
+
+// quotaTracker enforces a byte limit on a mount. Usage is computed by walking
+// the tree, then kept up to date with each successful write and recomputed
+// once it is older than constants.QuotaUsageTTL, so changes made outside
+// gofs are eventually noticed.
+type quotaTracker struct {
+	fs    internal.FileSystem
+	limit int64
+
+	mu         sync.Mutex
+	used       int64
+	computedAt time.Time
+}
+
+func newQuotaTracker(fs internal.FileSystem, limit int64) *quotaTracker {
+	return &quotaTracker{fs: fs, limit: limit}
+}
+
+// Reserve accounts for size bytes about to be written, returning a
+// *quotaExceededError if they do not fit. Callers must Release the
+// reservation if the write fails.
+func (q *quotaTracker) Reserve(size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.refreshLocked(); err != nil {
+		return err
+	}
+	if size > 0 && q.used+size > q.limit {
+		return &quotaExceededError{used: q.used, limit: q.limit}
+	}
+	q.used += size
+	return nil
+}
+
+// Release returns bytes to the quota, after a failed write or when a file is
+// removed or shrunk.
+func (q *quotaTracker) Release(size int64) {
+	q.mu.Lock()
+	q.used = max(q.used-size, 0)
+	q.mu.Unlock()
+}
+
+// Check reports a *quotaExceededError if the quota is already used up.
+func (q *quotaTracker) Check() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.refreshLocked(); err != nil {
+		return err
+	}
+	if q.used >= q.limit {
+		return &quotaExceededError{used: q.used, limit: q.limit}
+	}
+	return nil
+}
+
+// Usage returns the current usage, recomputing it if stale.
+func (q *quotaTracker) Usage() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	err := q.refreshLocked()
+	return q.used, err
+}
+
+func (q *quotaTracker) refreshLocked() error {
+	if !q.computedAt.IsZero() && time.Since(q.computedAt) < constants.QuotaUsageTTL {
+		return nil
+	}
+	used, err := treeSize(q.fs, "")
+	if err != nil {
+		return fmt.Errorf("computing quota usage: %w", err)
+	}
+	q.used = used
+	q.computedAt = time.Now()
+	return nil
+}
+
+// treeSize sums the sizes of all files below dir.
+func treeSize(fs internal.FileSystem, dir string) (int64, error) {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			size, err := treeSize(fs, path.Join(dir, entry.Name()))
+			if err != nil {
+				return 0, err
+			}
+			total += size
+			continue
+		}
+		total += entry.Size()
+	}
+	return total, nil
+}
+
+// writeQuotaError writes the 507 response for err.
+func writeQuotaError(w http.ResponseWriter, err *quotaExceededError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInsufficientStorage)
+	_ = json.NewEncoder(w).Encode(QuotaErrorResponse{
+		Error: "Insufficient storage: " + err.Error(),
+		Used:  err.used,
+		Limit: err.limit,
+	})
+}
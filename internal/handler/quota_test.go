@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func uploadNamed(t *testing.T, h *AdvancedFile, name, content string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	_, _ = fw.Write([]byte(content))
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Failed to close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAdvancedFile_Quota(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", MaxHashSize: 1 << 20})
+	h.SetQuota(100)
+
+	if rr := uploadNamed(t, h, "a.txt", strings.Repeat("a", 60)); rr.Code != http.StatusOK {
+		t.Fatalf("first upload: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// Replacing a file only counts the difference in size
+	if rr := uploadNamed(t, h, "a.txt", strings.Repeat("a", 70)); rr.Code != http.StatusOK {
+		t.Fatalf("overwrite: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := uploadNamed(t, h, "b.txt", strings.Repeat("b", 40))
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected 507, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp QuotaErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON error: %v", err)
+	}
+	if resp.Used != 70 || resp.Limit != 100 || resp.Error == "" {
+		t.Errorf("unexpected quota error %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(root, "b.txt")); !os.IsNotExist(err) {
+		t.Error("rejected upload must not be written")
+	}
+
+	// Freeing space outside gofs is noticed once the cached usage is stale
+	if err := os.Remove(filepath.Join(root, "a.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	h.quota.computedAt = time.Now().Add(-2 * time.Hour)
+	if rr := uploadNamed(t, h, "b.txt", strings.Repeat("b", 40)); rr.Code != http.StatusOK {
+		t.Fatalf("after delete: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if used, err := h.quota.Usage(); err != nil || used != 40 {
+		t.Errorf("expected usage 40, got %d (%v)", used, err)
+	}
+}
+
+func TestAdvancedFile_QuotaBlocksMkdirWhenFull(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "full.bin"), make([]byte, 10), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", MaxHashSize: 1 << 20})
+	h.SetQuota(10)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/folder", strings.NewReader(`{"path":"new"}`))
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected 507, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	h.SetQuota(0)
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/folder", strings.NewReader(`{"path":"new"}`))
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 without quota, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/samzong/gofs/internal/config"
+)
+
+// AccessInfo tells clients how other machines can reach the server.
+type AccessInfo struct {
+	LocalOnly bool     `json:"localOnly"` // The server listens on a loopback address only
+	URLs      []string `json:"urls"`      // Root URLs for other machines, LAN addresses first
+}
+
+// netInterface is the part of a net.Interface that address enumeration
+// needs, so tests can supply their own.
+type netInterface struct {
+	Flags net.Flags
+	Addrs []net.Addr
+}
+
+// Access reports how the server configured by cfg can be reached from other
+// machines: its ACME domains, every LAN address when it listens on all of
+// them, or its bind address.
+func Access(cfg *config.Config) AccessInfo {
+	return accessInfo(cfg, systemInterfaces())
+}
+
+func accessInfo(cfg *config.Config, interfaces []netInterface) AccessInfo {
+	urls := []string{}
+	hostURL := func(scheme, host string, defaultPort int) string {
+		if cfg.Port != defaultPort {
+			host = net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+		} else if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+		return scheme + "://" + host + cfg.BaseURL + "/"
+	}
+
+	switch {
+	case len(cfg.ACMEDomains) > 0:
+		for _, domain := range cfg.ACMEDomains {
+			urls = append(urls, hostURL("https", domain, 443))
+		}
+	case isUnspecifiedHost(cfg.Host):
+		for _, ip := range lanAddresses(interfaces) {
+			urls = append(urls, hostURL("http", ip.String(), 80))
+		}
+	case isLoopbackHost(cfg.Host):
+		return AccessInfo{LocalOnly: true, URLs: urls}
+	default:
+		urls = append(urls, hostURL("http", cfg.Host, 80))
+	}
+	return AccessInfo{URLs: urls}
+}
+
+// lanAddresses returns the addresses of the interfaces that are up which
+// other machines can use: IPv4 first, then global IPv6, without loopback
+// and link-local addresses.
+func lanAddresses(interfaces []netInterface) []net.IP {
+	var v4, v6 []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		for _, addr := range iface.Addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() || ipNet.IP.IsUnspecified() {
+				continue
+			}
+			if ip4 := ipNet.IP.To4(); ip4 != nil {
+				v4 = append(v4, ip4)
+			} else if ipNet.IP.IsGlobalUnicast() {
+				v6 = append(v6, ipNet.IP)
+			}
+		}
+	}
+	return slices.Concat(v4, v6)
+}
+
+// systemInterfaces lists the network interfaces of this machine, skipping
+// those whose addresses cannot be read.
+func systemInterfaces() []netInterface {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	list := make([]netInterface, 0, len(interfaces))
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		list = append(list, netInterface{Flags: iface.Flags, Addrs: addrs})
+	}
+	return list
+}
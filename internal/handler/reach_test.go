@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+)
+
+func ipNet(s string) *net.IPNet {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	n.IP = ip
+	return n
+}
+
+var testInterfaces = []netInterface{
+	{Flags: net.FlagUp | net.FlagLoopback, Addrs: []net.Addr{ipNet("127.0.0.1/8"), ipNet("::1/128")}},
+	{Flags: net.FlagUp, Addrs: []net.Addr{
+		ipNet("fe80::1/64"), ipNet("2001:db8::5/64"), ipNet("192.168.1.20/24"), ipNet("169.254.3.4/16"),
+	}},
+	{Flags: 0, Addrs: []net.Addr{ipNet("10.0.0.9/8")}}, // Down
+	{Flags: net.FlagUp, Addrs: []net.Addr{ipNet("10.8.0.2/24"), &net.IPAddr{IP: net.ParseIP("10.9.0.1")}}},
+}
+
+func TestLANAddresses(t *testing.T) {
+	var got []string
+	for _, ip := range lanAddresses(testInterfaces) {
+		got = append(got, ip.String())
+	}
+	want := []string{"192.168.1.20", "10.8.0.2", "2001:db8::5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := lanAddresses(nil); len(got) != 0 {
+		t.Errorf("expected no addresses without interfaces, got %v", got)
+	}
+}
+
+func TestAccessInfo(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  config.Config
+		want AccessInfo
+	}{
+		{name: "loopback", cfg: config.Config{Host: "127.0.0.1", Port: 8000},
+			want: AccessInfo{LocalOnly: true, URLs: []string{}}},
+		{name: "localhost", cfg: config.Config{Host: "localhost", Port: 8000},
+			want: AccessInfo{LocalOnly: true, URLs: []string{}}},
+		{name: "all addresses", cfg: config.Config{Host: "0.0.0.0", Port: 8000, BaseURL: "/files"},
+			want: AccessInfo{URLs: []string{
+				"http://192.168.1.20:8000/files/", "http://10.8.0.2:8000/files/", "http://[2001:db8::5]:8000/files/",
+			}}},
+		{name: "default port", cfg: config.Config{Host: "::", Port: 80},
+			want: AccessInfo{URLs: []string{"http://192.168.1.20/", "http://10.8.0.2/", "http://[2001:db8::5]/"}}},
+		{name: "one address", cfg: config.Config{Host: "192.168.1.20", Port: 8000},
+			want: AccessInfo{URLs: []string{"http://192.168.1.20:8000/"}}},
+		{name: "acme", cfg: config.Config{Host: "0.0.0.0", Port: 443, ACMEDomains: []string{"a.example", "b.example"}},
+			want: AccessInfo{URLs: []string{"https://a.example/", "https://b.example/"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := accessInfo(&tc.cfg, testInterfaces); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+
+	// Without a LAN address there is nothing to offer, but the server is
+	// not local-only either
+	got := accessInfo(&config.Config{Host: "0.0.0.0", Port: 8000}, testInterfaces[:1])
+	if got.LocalOnly || len(got.URLs) != 0 {
+		t.Errorf("expected no URLs, got %+v", got)
+	}
+}
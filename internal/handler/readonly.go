@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// ReadonlyErrorCode identifies 403 responses to writes against a read-only
+// mount.
+const ReadonlyErrorCode = "READONLY_MOUNT"
+
+// ReadonlyErrorResponse is the body of a write refused because the mount is
+// read-only.
+type ReadonlyErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`  // Always ReadonlyErrorCode
+	Mount string `json:"mount"` // URL path of the mount, "/" without --dir mounts
+}
+
+// mountReadonly reports whether the request is served from a read-only
+// mount, taking the mount from the request context under MultiDir and from
+// the only configured directory otherwise. With --readonly every mount is.
+func mountReadonly(r *http.Request, cfg *config.Config) bool {
+	if cfg.Readonly {
+		return true
+	}
+	if info, ok := internal.MountInfoFromContext(r.Context()); ok {
+		return info.Readonly
+	}
+	return len(cfg.Dirs) == 1 && cfg.Dirs[0].Readonly
+}
+
+// readonly reports whether writes through h must be refused, because the
+// mount is configured read-only or the backend cannot write.
+func (h *AdvancedFile) readonly(r *http.Request) bool {
+	return !internal.CapabilitiesOf(h.fs).CanWrite || mountReadonly(r, h.config)
+}
+
+// rejectReadonly answers 403 with ReadonlyErrorCode and returns true if the
+// request would write to a read-only mount.
+func (h *AdvancedFile) rejectReadonly(w http.ResponseWriter, r *http.Request) bool {
+	if !h.readonly(r) {
+		return false
+	}
+	h.logger.Debug("Write rejected: read-only mount",
+		slog.String("method", r.Method),
+		slog.String("path", middleware.LogPath(r, middleware.OriginalPath(r))))
+	writeReadonly(w, r)
+	return true
+}
+
+// writeReadonly answers 403 with ReadonlyErrorCode, also for writes the
+// backend refused with filesystem.ErrReadonly after the checks passed.
+func writeReadonly(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	mount := "/"
+	if info, ok := internal.MountInfoFromContext(r.Context()); ok {
+		mount = info.Path
+	}
+	_ = json.NewEncoder(w).Encode(ReadonlyErrorResponse{
+		Error: "This mount is read-only",
+		Code:  ReadonlyErrorCode,
+		Mount: mount,
+	})
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// NewMountFS returns the filesystem mount is served from: its local
+// directory behind hot, which may be nil, or the gofs server it names.
+// Remote mounts skip the hot cache, which only holds local files. With
+// --block-sensitive files matching the sensitive patterns are left out, and
+// with --snapshot a local mount serves its snapshot, read-only.
+func NewMountFS(mount config.DirMount, cfg *config.Config, hot *filesystem.HotCache) (internal.FileSystem, error) {
+	var fs internal.FileSystem
+	if mount.IsRemote() {
+		username, password, _ := strings.Cut(mount.Credentials, ":")
+		remote, err := filesystem.NewRemote(mount.Path, mount.Dir, username, password)
+		if err != nil {
+			return nil, err
+		}
+		fs = BlockSensitive(remote, cfg)
+	} else {
+		local := filesystem.NewLocal(mount.Dir, cfg.ShowHidden)
+		fs = local
+		if hot != nil {
+			fs = filesystem.NewCached(local, hot)
+		}
+		fs = BlockSensitive(fs, cfg)
+		if cfg.Snapshot {
+			return snapshotMount(mount, cfg, fs)
+		}
+	}
+	if mount.Readonly {
+		fs = filesystem.NewReadonly(fs)
+	}
+	return fs, nil
+}
+
+// writeUnavailable answers 503 naming the mount if err comes from a remote
+// mount that cannot be reached, or naming the file if it drifted from the
+// snapshot served, and reports whether it did.
+func writeUnavailable(w http.ResponseWriter, r *http.Request, reporter middleware.ErrorReporter, err error) bool {
+	var unavailable *filesystem.UnavailableError
+	if errors.As(err, &unavailable) {
+		reporter.Error(w, r, "Remote mount "+unavailable.Mount+" is unavailable", http.StatusServiceUnavailable, err)
+		return true
+	}
+	var drifted *filesystem.DriftedError
+	if errors.As(err, &drifted) {
+		reporter.Error(w, r, "Content drifted since the snapshot: "+drifted.Path, http.StatusServiceUnavailable, err)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/pkg/client"
+)
+
+// newRemoteGofs starts a gofs serving a small tree, to be mounted remotely.
+func newRemoteGofs(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(remoteGofsHandler(t))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func remoteGofsHandler(t *testing.T) http.Handler {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"readme.txt": "hello from A", "docs/guide.md": "# Guide"} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewFile(filesystem.NewLocal(root, false), &config.Config{Theme: "default"}, logger)
+}
+
+func TestMultiDir_RemoteMount(t *testing.T) {
+	remote := newRemoteGofs(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, theme := range []string{"default", "advanced"} {
+		t.Run(theme, func(t *testing.T) {
+			mount, err := config.ParseDir("/hostA=" + remote.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &config.Config{Theme: theme, MaxHashSize: 1 << 20, RequestTimeout: 30}
+			h := NewMultiDir([]config.DirMount{mount, {Path: "/local", Dir: t.TempDir(), Name: "local"}}, cfg, logger)
+
+			req := httptest.NewRequest(http.MethodGet, "/hostA/", nil)
+			req.Header.Set("Accept", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			var listing struct {
+				Files []struct {
+					Name  string `json:"name"`
+					IsDir bool   `json:"isDir"`
+				} `json:"files"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &listing); err != nil || rr.Code != http.StatusOK {
+				t.Fatalf("listing: expected JSON, got %d: %s", rr.Code, rr.Body.String())
+			}
+			names := map[string]bool{}
+			for _, f := range listing.Files {
+				names[f.Name] = f.IsDir
+			}
+			if isDir, ok := names["docs"]; !ok || !isDir {
+				t.Errorf("expected the docs directory in %+v", listing.Files)
+			}
+			if _, ok := names["readme.txt"]; !ok {
+				t.Errorf("expected readme.txt in %+v", listing.Files)
+			}
+
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/hostA/readme.txt", nil))
+			if rr.Code != http.StatusOK || rr.Body.String() != "hello from A" {
+				t.Errorf("download: got %d %q", rr.Code, rr.Body.String())
+			}
+
+			req = httptest.NewRequest(http.MethodGet, "/hostA/readme.txt", nil)
+			req.Header.Set("Range", "bytes=6-9")
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != http.StatusPartialContent || rr.Body.String() != "from" {
+				t.Errorf("range: got %d %q", rr.Code, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Range"); got != "bytes 6-9/12" {
+				t.Errorf("range: got Content-Range %q", got)
+			}
+
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/hostA/docs/missing.md", nil))
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("missing file: expected 404, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestMultiDir_RemoteMountUnavailable(t *testing.T) {
+	remote := newRemoteGofs(t)
+	remote.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mount, err := config.ParseDir("/hostA=" + remote.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewMultiDir([]config.DirMount{mount}, &config.Config{Theme: "default"}, logger)
+
+	for _, target := range []string{"/hostA/", "/hostA/readme.txt"} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "/hostA") {
+			t.Errorf("%s: expected 503 naming the mount, got %d: %s", target, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestMultiDir_RemoteMountAuth(t *testing.T) {
+	remote := remoteGofsHandler(t)
+	protected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		remote.ServeHTTP(w, r)
+	}))
+	defer protected.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for creds, want := range map[string]int{"alice:secret": http.StatusOK, "alice:wrong": http.StatusServiceUnavailable} {
+		dirs := []config.DirMount{{Path: "/hostA", Dir: protected.URL, Readonly: true}}
+		if err := config.ApplyRemoteAuth(dirs, []string{"/hostA=" + creds}); err != nil {
+			t.Fatal(err)
+		}
+		h := NewMultiDir(dirs, &config.Config{Theme: "default"}, logger)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/hostA/readme.txt", nil))
+		if rr.Code != want {
+			t.Errorf("%s: expected %d, got %d: %s", creds, want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestRemote_SeekPinnedToETag(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "data.txt")
+	if err := os.WriteFile(file, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(NewFile(filesystem.NewLocal(root, false), &config.Config{Theme: "default"}, logger))
+	defer srv.Close()
+	remote, err := filesystem.NewRemote("/hostA", srv.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := remote.OpenSeeker("data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "0123" {
+		t.Fatalf("first read: got %q, %v", buf, err)
+	}
+	if _, err := f.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "6789" {
+		t.Fatalf("read after seek: got %q, %v", buf, err)
+	}
+
+	// A reopen after the file changed fails instead of mixing versions
+	if err := os.WriteFile(file, []byte("abcdefghij"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(buf); !errors.Is(err, client.ErrChanged) {
+		t.Errorf("expected client.ErrChanged, got %v", err)
+	}
+}
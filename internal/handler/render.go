@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/handler/templates"
+	"github.com/samzong/gofs/internal/listing"
+	"github.com/samzong/gofs/pkg/fileutil"
+)
+
+// pageBufferPool holds the buffers listing pages are rendered into before
+// any of them is sent.
+var pageBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// renderPage executes tmpl with data into a pooled buffer and only then
+// writes the page, with its Content-Length. A template failing midway
+// returns its error with nothing written, so the caller can still answer
+// with a page or status of its own.
+func renderPage(w http.ResponseWriter, tmpl *template.Template, data any) error {
+	buf := pageBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		// Huge listings would keep their buffers alive in the pool
+		if buf.Cap() <= constants.MaxPooledPageBuffer {
+			pageBufferPool.Put(buf)
+		}
+	}()
+
+	if err := tmpl.Execute(buf, data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	_, _ = buf.WriteTo(w)
+	return nil
+}
+
+// classicPageData is what templates.DirectoryTemplate renders: the entries
+// of the directory path in the given theme.
+func classicPageData(path string, entries []listing.Entry, theme string, children *childCounter) any {
+	type FileItem struct {
+		Name     string
+		Size     string
+		IsDir    bool
+		Kind     fileutil.FileKind
+		Children string // e.g. "3 items", directories only
+		Modified string // Directories only
+	}
+
+	items := make([]FileItem, 0, len(entries))
+	for _, e := range entries {
+		item := FileItem{Name: e.Name, IsDir: e.IsDir, Kind: e.Kind}
+		if e.IsDir {
+			item.Children = children.formatChildCount(path, e)
+			item.Modified = e.ModTime.Format("Jan 02, 2006")
+		} else {
+			item.Size = fileutil.FormatSize(e.Size)
+		}
+		items = append(items, item)
+	}
+
+	// Security: Get validated CSS from embedded themes only. The theme parameter
+	// is validated against a whitelist in config validation, and GetThemeCSS
+	// only returns CSS from embedded files compiled into the binary.
+	themeCSS := templates.GetThemeCSS(theme)
+
+	return struct {
+		Path   string
+		Files  []FileItem
+		Parent bool
+		CSS    template.CSS
+		Icons  template.HTML
+		Theme  string
+	}{
+		Path:   "/" + path,
+		Parent: path != "",
+		Files:  items,
+		CSS:    template.CSS(themeCSS), // #nosec G203 - CSS comes from embedded files only, theme is validated
+		Icons:  templates.IconSprite,
+		Theme:  theme,
+	}
+}
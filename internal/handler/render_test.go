@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// brokenTemplate fails midway, after writing the start of a page.
+var brokenTemplate = template.Must(template.New("broken").Parse(`<html><p>half a page</p>{{.Missing}}</html>`))
+
+func TestAdvancedFile_TemplateFallback(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "report.txt")
+	var logs bytes.Buffer
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	h.logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	h.page = brokenTemplate
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the classic listing with 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	if strings.Contains(body, "half a page") || strings.Contains(body, "Internal Server Error") {
+		t.Errorf("expected no output of the failed template, got %s", body)
+	}
+	if !strings.Contains(body, "<title>/</title>") || !strings.Contains(body, "report.txt") {
+		t.Errorf("expected the classic listing of report.txt, got %s", body)
+	}
+	if got := rr.Header().Get("Content-Length"); got != strconv.Itoa(len(body)) {
+		t.Errorf("expected Content-Length %d, got %q", len(body), got)
+	}
+	if !strings.Contains(logs.String(), "Template execution error") ||
+		!strings.Contains(logs.String(), `"file_count":1`) || !strings.Contains(logs.String(), "Missing") {
+		t.Errorf("expected the template error logged with its data, got %s", logs.String())
+	}
+}
+
+func TestFileHandler_TemplateFailure(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "report.txt")
+	h := NewFile(filesystem.NewLocal(root, false), &config.Config{Theme: "default"},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Length") != strconv.Itoa(rr.Body.Len()) {
+		t.Fatalf("expected 200 with Content-Length, got %d %q", rr.Code, rr.Header().Get("Content-Length"))
+	}
+
+	h.page = brokenTemplate
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "half a page") {
+		t.Errorf("expected the error alone, without the failed template's output: %s", rr.Body.String())
+	}
+	if strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("expected the error's content type, got %q", rr.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+var (
+	errTooManyPaths = errors.New("too many paths")
+	errPathTooLong  = errors.New("path too long")
+)
+
+// maxRequestBodySize returns the configured JSON body limit, falling back to
+// the default when unset.
+func maxRequestBodySize(cfg *config.Config) int64 {
+	if cfg.MaxRequestBodySize > 0 {
+		return cfg.MaxRequestBodySize
+	}
+	return constants.DefaultMaxRequestBodySize
+}
+
+// maxUploadSize returns the configured upload limit, falling back to the
+// default when unset.
+func maxUploadSize(cfg *config.Config) int64 {
+	if cfg.MaxUploadSize > 0 {
+		return cfg.MaxUploadSize
+	}
+	return constants.DefaultMaxUploadSize
+}
+
+// maxHashSize returns the configured hashing limit, falling back to the
+// default when unset.
+func maxHashSize(cfg *config.Config) int64 {
+	if cfg.MaxHashSize > 0 {
+		return cfg.MaxHashSize
+	}
+	return constants.DefaultMaxHashSize
+}
+
+// pathLimits returns the --max-path-depth and --max-name-length limits; a
+// zero limit is not checked.
+func pathLimits(cfg *config.Config) pathsafe.Limits {
+	return pathsafe.Limits{MaxDepth: cfg.MaxPathDepth, MaxNameLength: cfg.MaxNameLength}
+}
+
+// pathLimitMessage describes an error from limits for a 400 response, or
+// returns "" if err has another cause.
+func pathLimitMessage(err error, limits pathsafe.Limits) string {
+	switch {
+	case errors.Is(err, pathsafe.ErrTooDeep):
+		return fmt.Sprintf("Path too deep, at most %d segments", limits.MaxDepth)
+	case errors.Is(err, pathsafe.ErrNameTooLong):
+		return fmt.Sprintf("Name too long, at most %d bytes per path segment", limits.MaxNameLength)
+	}
+	return ""
+}
+
+// decodeJSONBody decodes the request body into v, reading no more than the
+// configured limit. On failure it writes a 413 or 400 JSON error and returns
+// false.
+func (h *AdvancedFile) decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize(h.config))
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			middleware.WriteJSONError(w, fmt.Sprintf("Request body too large, at most %d bytes", tooLarge.Limit),
+				http.StatusRequestEntityTooLarge)
+			return false
+		}
+		h.reporter().JSONError(w, r, "Invalid request", http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// validateRequestPaths checks the paths named by a request against the
+// per-request limits before any of them touches the filesystem. It does not
+// allocate, so oversized requests are cheap to refuse.
+func validateRequestPaths(paths []string, maxPaths int) error {
+	if len(paths) > maxPaths {
+		return errTooManyPaths
+	}
+	for _, p := range paths {
+		if len(p) > constants.MaxRequestPathLength {
+			return errPathTooLong
+		}
+	}
+	return nil
+}
+
+// writeRequestPathsError reports an error from validateRequestPaths as a 400.
+func writeRequestPathsError(w http.ResponseWriter, err error, maxPaths int) {
+	msg := fmt.Sprintf("Path too long, at most %d bytes", constants.MaxRequestPathLength)
+	if errors.Is(err, errTooManyPaths) {
+		msg = fmt.Sprintf("Too many paths, at most %d per request", maxPaths)
+	}
+	middleware.WriteJSONError(w, msg, http.StatusBadRequest)
+}
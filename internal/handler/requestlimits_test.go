@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// endlessPaths streams `{"paths":["a","a",...` without ever ending, so a
+// handler that reads it to the end would never return.
+type endlessPaths struct {
+	offset int
+}
+
+func (e *endlessPaths) Read(p []byte) (int, error) {
+	const head, item = `{"paths":[`, `"a",`
+	for i := range p {
+		if e.offset < len(head) {
+			p[i] = head[e.offset]
+		} else {
+			p[i] = item[(e.offset-len(head))%len(item)]
+		}
+		e.offset++
+	}
+	return len(p), nil
+}
+
+func TestValidateRequestPaths(t *testing.T) {
+	longPath := strings.Repeat("a", constants.MaxRequestPathLength+1)
+
+	testCases := []struct {
+		name  string
+		paths []string
+		want  error
+	}{
+		{name: "empty", paths: nil},
+		{name: "within_limits", paths: []string{"a.txt", strings.Repeat("b", constants.MaxRequestPathLength)}},
+		{name: "too_many", paths: make([]string, 11), want: errTooManyPaths},
+		{name: "too_long", paths: []string{"a.txt", longPath}, want: errPathTooLong},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateRequestPaths(tc.paths, 10); !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateRequestPaths_NoAllocations(t *testing.T) {
+	huge := make([]string, 1_000_000)
+	valid := make([]string, constants.MaxZipPaths)
+	for i := range valid {
+		valid[i] = "docs/readme.md"
+	}
+	long := []string{strings.Repeat("a", 1<<20)}
+
+	for name, paths := range map[string][]string{"huge": huge, "valid": valid, "long": long} {
+		allocs := testing.AllocsPerRun(100, func() {
+			_ = validateRequestPaths(paths, constants.MaxZipPaths)
+		})
+		if allocs != 0 {
+			t.Errorf("%s: expected no allocations, got %v", name, allocs)
+		}
+	}
+}
+
+func TestAdvancedFile_RequestLimits(t *testing.T) {
+	fs := filesystem.NewLocal(newBulkTestDir(t), false)
+	h := NewAdvancedFile(fs, &config.Config{Theme: "advanced", MaxRequestBodySize: 64 << 10})
+
+	post := func(endpoint string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, endpoint, body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	jsonBody := func(v any) io.Reader {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		return strings.NewReader(string(data))
+	}
+
+	manyPaths := make([]string, constants.MaxZipPaths+1)
+	for i := range manyPaths {
+		manyPaths[i] = "a.txt"
+	}
+	longPath := strings.Repeat("a", constants.MaxRequestPathLength+1)
+
+	testCases := []struct {
+		name     string
+		endpoint string
+		body     func() io.Reader
+		status   int
+		message  string
+	}{
+		{"zip_endless_body", "/api/zip", func() io.Reader { return &endlessPaths{} },
+			http.StatusRequestEntityTooLarge, "Request body too large"},
+		{"folder_endless_body", "/api/folder", func() io.Reader { return &endlessPaths{} },
+			http.StatusRequestEntityTooLarge, "Request body too large"},
+		{"delete_endless_body", "/api/delete", func() io.Reader { return &endlessPaths{} },
+			http.StatusRequestEntityTooLarge, "Request body too large"},
+		{"zip_too_many_paths", "/api/zip", func() io.Reader { return jsonBody(ZipRequest{Paths: manyPaths}) },
+			http.StatusBadRequest, "Too many paths"},
+		{"zip_path_too_long", "/api/zip", func() io.Reader { return jsonBody(ZipRequest{Paths: []string{longPath}}) },
+			http.StatusBadRequest, "Path too long"},
+		{"folder_name_too_long", "/api/folder", func() io.Reader { return jsonBody(FolderRequest{Path: longPath}) },
+			http.StatusBadRequest, "Folder name too long"},
+		{"copy_destination_too_long", "/api/copy",
+			func() io.Reader { return jsonBody(BulkRequest{Paths: []string{"a.txt"}, Destination: longPath}) },
+			http.StatusBadRequest, "Path too long"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := post(tc.endpoint, tc.body())
+			if rr.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || !strings.HasPrefix(body["error"], tc.message) {
+				t.Errorf("expected a JSON error starting with %q, got %q", tc.message, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("default_limit", func(t *testing.T) {
+		h := NewAdvancedFile(fs, &config.Config{Theme: "advanced"})
+		if got := maxRequestBodySize(h.config); got != constants.DefaultMaxRequestBodySize {
+			t.Errorf("expected the default limit %d, got %d", constants.DefaultMaxRequestBodySize, got)
+		}
+	})
+}
+
+func TestAdvancedFile_PathLimits(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false),
+		&config.Config{Theme: "advanced", MaxPathDepth: 64, MaxNameLength: 255})
+
+	upload := func(filename string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write([]byte("content"))
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	mkdir := func(name string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(FolderRequest{Path: name})
+		req := httptest.NewRequest(http.MethodPost, "/api/folder", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	deep := strings.TrimSuffix(strings.Repeat("d/", 64), "/")
+	testCases := []struct {
+		name    string
+		do      func() *httptest.ResponseRecorder
+		status  int
+		message string
+	}{
+		{"upload_name_too_long", func() *httptest.ResponseRecorder { return upload(strings.Repeat("u", 256)) },
+			http.StatusBadRequest, "Name too long, at most 255 bytes"},
+		{"upload", func() *httptest.ResponseRecorder { return upload("short.txt") }, http.StatusOK, ""},
+		{"folder_too_deep", func() *httptest.ResponseRecorder { return mkdir(deep + "/d") },
+			http.StatusBadRequest, "Path too deep, at most 64 segments"},
+		{"folder_name_too_long", func() *httptest.ResponseRecorder { return mkdir("a/" + strings.Repeat("f", 256)) },
+			http.StatusBadRequest, "Name too long, at most 255 bytes"},
+		{"folder_at_limits", func() *httptest.ResponseRecorder { return mkdir(deep) }, http.StatusOK, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := tc.do()
+			if rr.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			if tc.message == "" {
+				return
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || !strings.HasPrefix(body["error"], tc.message) {
+				t.Errorf("expected a JSON error starting with %q, got %q", tc.message, rr.Body.String())
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(root, "a")); !os.IsNotExist(err) {
+		t.Errorf("expected no folder for a rejected name, got %v", err)
+	}
+}
+
+func TestAdvancedFile_SizeLimits(t *testing.T) {
+	root := t.TempDir()
+	for name, size := range map[string]int{"small.bin": 10, "big.bin": 100} {
+		if err := os.WriteFile(filepath.Join(root, name), bytes.Repeat([]byte("x"), size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{
+		Theme:           "advanced",
+		EnableRESTWrite: true,
+		MaxUploadSize:   16,
+		MaxHashSize:     50,
+		MaxDownloadSize: 50,
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), cfg)
+
+	t.Run("upload", func(t *testing.T) {
+		for content, want := range map[string]int{
+			"small":                 http.StatusOK,
+			strings.Repeat("x", 17): http.StatusRequestEntityTooLarge,
+		} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, newUploadRequest(t, h, content, nil))
+			if rr.Code != want {
+				t.Errorf("%d bytes: expected %d, got %d: %s", len(content), want, rr.Code, rr.Body.String())
+			}
+		}
+		if data, err := os.ReadFile(filepath.Join(root, "hello.txt")); err != nil || string(data) != "small" {
+			t.Errorf("Expected only the small upload to be stored, got %q (%v)", data, err)
+		}
+	})
+
+	t.Run("rest_put", func(t *testing.T) {
+		body := strings.Repeat("x", 17)
+		rr := curl(t, h, http.MethodPut, "/put.bin", strings.NewReader(body))
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Content-Length over the limit: expected 413, got %d", rr.Code)
+		}
+		// Without a Content-Length the limit applies while reading
+		chunked := io.MultiReader(strings.NewReader(body))
+		if rr := curl(t, h, http.MethodPut, "/put.bin", chunked); rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("chunked body over the limit: expected 413, got %d", rr.Code)
+		}
+		if _, err := os.Stat(filepath.Join(root, "put.bin")); !os.IsNotExist(err) {
+			t.Errorf("Expected no file to be stored, got %v", err)
+		}
+	})
+
+	t.Run("download_and_hash", func(t *testing.T) {
+		get := func(name string) *httptest.ResponseRecorder {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+name, nil))
+			return rr
+		}
+		rr := get("small.bin")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("small.bin: expected 200, got %d", rr.Code)
+		}
+		if etag := rr.Header().Get("ETag"); strings.HasPrefix(etag, `"gofs-`) {
+			t.Errorf("Expected a content ETag below the hash limit, got %s", etag)
+		}
+		if rr := get("big.bin"); rr.Code != http.StatusForbidden {
+			t.Errorf("big.bin: expected 403, got %d", rr.Code)
+		}
+
+		cfg.MaxDownloadSize = 0
+		rr = get("big.bin")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("big.bin without a download limit: expected 200, got %d", rr.Code)
+		}
+		if etag := rr.Header().Get("ETag"); !strings.HasPrefix(etag, `"gofs-`) {
+			t.Errorf("Expected a path-derived ETag above the hash limit, got %s", etag)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// MakeDirectoryHeader turns a POST to a path into a request to create a
+// directory there, for clients that cannot PUT to a path ending in "/".
+const MakeDirectoryHeader = "X-Make-Directory"
+
+func isRESTWriteMethod(method string) bool {
+	return method == http.MethodPut || method == http.MethodDelete || method == http.MethodPost
+}
+
+// noFormValue stands in for r.FormValue on REST writes, whose body is file
+// data that must not be parsed as a form.
+func noFormValue(string) string { return "" }
+
+// handleRESTWrite serves the --enable-rest-write interface on file paths:
+// PUT stores the request body as a file, PUT to a path ending in "/" or POST
+// with X-Make-Directory creates a directory, and DELETE removes a file or a
+// directory tree. These requests need Basic credentials rather than the
+// session of a page, and browsers cannot send them cross-origin without a
+// preflight this handler never grants, so they skip the CSRF token check.
+func (h *AdvancedFile) handleRESTWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		middleware.WriteJSONError(w, "Credentials required", http.StatusUnauthorized)
+		return
+	}
+	if h.rejectReadonly(w, r) {
+		return
+	}
+	name, err := pathsafe.Clean(r.URL.Path)
+	if err != nil {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if name == "" {
+		middleware.WriteJSONError(w, "The mount root cannot be replaced or removed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mkdir := r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/") ||
+		r.Method == http.MethodPost && r.Header.Get(MakeDirectoryHeader) != ""
+	if mkdir || r.Method == http.MethodPut {
+		// Stored like uploads, so --user-upload-dirs redirects them too
+		var ok bool
+		if name, ok = h.uploadDestination(w, r, name); !ok {
+			return
+		}
+	}
+
+	switch {
+	case mkdir:
+		h.restMkdir(w, r, name)
+	case r.Method == http.MethodPut:
+		h.restPut(w, r, name)
+	case r.Method == http.MethodDelete:
+		h.restDelete(w, r, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// restParent checks that the directory name is created in exists. It writes
+// 409 Conflict and returns false if it does not.
+func (h *AdvancedFile) restParent(w http.ResponseWriter, name string) bool {
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+	if info, err := h.fs.Stat(dir); err != nil || !info.IsDir() {
+		middleware.WriteJSONError(w, "Parent directory does not exist", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// restPut stores the request body as file name, replacing any existing file
+// the way an upload through /api/upload does.
+func (h *AdvancedFile) restPut(w http.ResponseWriter, r *http.Request, name string) {
+	if limit := maxUploadSize(h.config); r.ContentLength > limit {
+		middleware.WriteJSONError(w, fmt.Sprintf("File too large, at most %d bytes", limit),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+	if h.quota != nil && r.ContentLength < 0 {
+		middleware.WriteJSONError(w, "Content-Length is required on a mount with a quota", http.StatusLengthRequired)
+		return
+	}
+	if !h.restParent(w, name) {
+		return
+	}
+	existing, err := h.fs.Stat(name)
+	if err == nil && existing.IsDir() {
+		middleware.WriteJSONError(w, "A directory exists at this path", http.StatusConflict)
+		return
+	}
+	created := err != nil
+
+	checksum, err := parseChecksum(r.Header, noFormValue)
+	if err != nil {
+		h.reporter().JSONError(w, r, "Invalid checksum", http.StatusBadRequest, err)
+		return
+	}
+	modTime, err := parseModTime(r.Header, noFormValue)
+	if err != nil {
+		h.reporter().JSONError(w, r, "Invalid modification time", http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.acquireUploadSlot(w) {
+		return
+	}
+	defer h.releaseUploadSlot()
+	reserved, ok := h.reserveQuota(w, r, name, max(r.ContentLength, 0))
+	if !ok {
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxUploadSize(h.config))
+	if err := h.saveUploadedFile(r.Context(), body, name, checksum, modTime); err != nil {
+		if h.quota != nil {
+			h.quota.Release(reserved)
+		}
+		h.writeSaveFailure(w, r, name, checksum, err)
+		return
+	}
+
+	size := r.ContentLength
+	if info, err := h.fs.Stat(name); err == nil {
+		size = info.Size()
+	}
+	h.logger.Info("File stored by PUT",
+		slog.String("filename", name),
+		slog.Int64("size", size),
+		slog.Bool("replaced", !created))
+
+	response := UploadResponse{Success: true, File: name, Size: size, URL: resourceURL(r, name, false)}
+	if checksum != nil {
+		response.Checksum = checksum.String()
+	}
+	if !modTime.IsZero() {
+		response.ModTime = &modTime
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	h.writeRESTResponse(w, status, response.URL, response)
+}
+
+// restMkdir creates directory name, whose parent must exist.
+func (h *AdvancedFile) restMkdir(w http.ResponseWriter, r *http.Request, name string) {
+	if !h.restParent(w, name) {
+		return
+	}
+	if _, err := h.fs.Stat(name); err == nil {
+		middleware.WriteJSONError(w, "Already exists", http.StatusConflict)
+		return
+	}
+	if !h.makeFolder(w, r, name) {
+		return
+	}
+	h.logger.Info("Folder created by REST request", slog.String("folder", name))
+	response := FolderResponse{Success: true, Folder: name, URL: resourceURL(r, name, true)}
+	h.writeRESTResponse(w, http.StatusCreated, response.URL, response)
+}
+
+// restDelete removes name, with everything below it for a directory.
+func (h *AdvancedFile) restDelete(w http.ResponseWriter, r *http.Request, name string) {
+	if _, err := h.fs.Stat(name); err != nil {
+		h.reporter().JSONError(w, r, "File not found", http.StatusNotFound, err)
+		return
+	}
+	if err := h.deletePath(r.Context(), name); err != nil {
+		if errors.Is(err, filesystem.ErrReadonly) {
+			writeReadonly(w, r)
+			return
+		}
+		h.reporter().JSONError(w, r, "Failed to delete", http.StatusInternalServerError, err)
+		return
+	}
+	h.logger.Info("Deleted by REST request", slog.String("path", name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdvancedFile) writeRESTResponse(w http.ResponseWriter, status int, location string, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", location)
+	w.WriteHeader(status)
+	if err := middleware.WriteJSON(w, body); err != nil {
+		h.logger.Warn("Failed to write REST response", slog.String("error", err.Error()))
+	}
+}
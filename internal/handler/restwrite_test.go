@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// curl sends what it is given with Basic credentials and no CSRF token.
+func curl(t *testing.T, h http.Handler, method, target string, body io.Reader,
+	headers ...string,
+) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	req.SetBasicAuth("user", "pass")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func newRESTHandler(t *testing.T) (*AdvancedFile, string) {
+	t.Helper()
+	root := t.TempDir()
+	cfg := &config.Config{Theme: "advanced", EnableRESTWrite: true}
+	return NewAdvancedFile(filesystem.NewLocal(root, false), cfg), root
+}
+
+func TestRESTWrite_Put(t *testing.T) {
+	h, root := newRESTHandler(t)
+
+	rr := curl(t, h, http.MethodPut, "/file.bin", strings.NewReader("first"))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("PUT new file: expected 201, got %d %s", rr.Code, rr.Body.String())
+	}
+	var resp UploadResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.File != "file.bin" || resp.Size != 5 {
+		t.Errorf("unexpected response %s (%v)", rr.Body.String(), err)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/file.bin" {
+		t.Errorf("expected Location /file.bin, got %q", loc)
+	}
+
+	rr = curl(t, h, http.MethodPut, "/file.bin", strings.NewReader("second"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT existing file: expected 200, got %d %s", rr.Code, rr.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "file.bin")); string(data) != "second" {
+		t.Errorf("expected the file to be replaced, got %q", data)
+	}
+
+	// A failed PUT leaves the file as it was and no temporary file behind
+	rr = curl(t, h, http.MethodPut, "/file.bin", strings.NewReader("third"), ChecksumSHA256Header,
+		strings.Repeat("0", 64))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("checksum mismatch: expected 422, got %d", rr.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "file.bin")); string(data) != "second" {
+		t.Errorf("expected the file to be kept, got %q", data)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("expected only file.bin, got %v", entries)
+	}
+
+	// A form content type does not make the body a form
+	rr = curl(t, h, http.MethodPut, "/form.txt", strings.NewReader("checksum=md5:00"),
+		"Content-Type", "application/x-www-form-urlencoded")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("form body: expected 201, got %d %s", rr.Code, rr.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "form.txt")); string(data) != "checksum=md5:00" {
+		t.Errorf("expected the body stored verbatim, got %q", data)
+	}
+}
+
+func TestRESTWrite_MkdirAndDelete(t *testing.T) {
+	h, root := newRESTHandler(t)
+
+	if rr := curl(t, h, http.MethodPut, "/docs/", nil); rr.Code != http.StatusCreated ||
+		rr.Header().Get("Location") != "/docs/" {
+		t.Fatalf("PUT directory: expected 201 with Location /docs/, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := curl(t, h, http.MethodPost, "/docs/sub", nil, MakeDirectoryHeader, "1"); rr.Code != http.StatusCreated {
+		t.Fatalf("POST X-Make-Directory: expected 201, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := curl(t, h, http.MethodPut, "/docs/sub/a.txt", strings.NewReader("a")); rr.Code != http.StatusCreated {
+		t.Fatalf("PUT into the new directory: expected 201, got %d", rr.Code)
+	}
+	if info, err := os.Stat(filepath.Join(root, "docs", "sub")); err != nil || !info.IsDir() {
+		t.Fatalf("expected docs/sub to be a directory: %v", err)
+	}
+
+	if rr := curl(t, h, http.MethodDelete, "/docs/sub/a.txt", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE file: expected 204, got %d", rr.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "docs", "sub", "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected a.txt to be removed: %v", err)
+	}
+	_ = os.WriteFile(filepath.Join(root, "docs", "sub", "b.txt"), []byte("b"), 0o644)
+	if rr := curl(t, h, http.MethodDelete, "/docs/", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE tree: expected 204, got %d", rr.Code)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("expected the tree to be removed, got %v", entries)
+	}
+}
+
+func TestRESTWrite_Errors(t *testing.T) {
+	h, root := newRESTHandler(t)
+	_ = os.Mkdir(filepath.Join(root, "dir"), 0o755)
+	_ = os.WriteFile(filepath.Join(root, "file.txt"), []byte("x"), 0o644)
+
+	disabled := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	readonly := NewAdvancedFile(filesystem.NewReadonly(filesystem.NewLocal(root, false)),
+		&config.Config{Theme: "advanced", EnableRESTWrite: true})
+	quota, _ := newRESTHandler(t)
+	quota.SetQuota(4)
+
+	testCases := []struct {
+		name   string
+		h      http.Handler
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{name: "disabled", h: disabled, method: http.MethodPut, target: "/new.txt", want: http.StatusMethodNotAllowed},
+		{name: "readonly", h: readonly, method: http.MethodPut, target: "/new.txt", want: http.StatusForbidden},
+		{name: "root", h: h, method: http.MethodDelete, target: "/", want: http.StatusMethodNotAllowed},
+		{name: "missing parent", h: h, method: http.MethodPut, target: "/nope/a.txt", want: http.StatusConflict},
+		{name: "onto directory", h: h, method: http.MethodPut, target: "/dir", want: http.StatusConflict},
+		{name: "existing directory", h: h, method: http.MethodPut, target: "/dir/", want: http.StatusConflict},
+		{name: "directory over file", h: h, method: http.MethodPut, target: "/file.txt/", want: http.StatusConflict},
+		{name: "delete missing", h: h, method: http.MethodDelete, target: "/nope.txt", want: http.StatusNotFound},
+		{name: "plain POST", h: h, method: http.MethodPost, target: "/x", want: http.StatusMethodNotAllowed},
+		{name: "traversal", h: h, method: http.MethodPut, target: "/a/../../etc/passwd", want: http.StatusBadRequest},
+		{name: "over quota", h: quota, method: http.MethodPut, target: "/big.txt", body: "12345",
+			want: http.StatusInsufficientStorage},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := curl(t, tc.h, tc.method, tc.target, strings.NewReader(tc.body))
+			if rr.Code != tc.want {
+				t.Errorf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("no credentials", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/file.txt", nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rr.Code)
+		}
+	})
+	t.Run("unknown length with quota", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("1"))
+		req.SetBasicAuth("user", "pass")
+		req.ContentLength = -1
+		rr := httptest.NewRecorder()
+		quota.ServeHTTP(rr, req)
+		if rr.Code != http.StatusLengthRequired {
+			t.Errorf("expected 411, got %d", rr.Code)
+		}
+	})
+	if data, _ := os.ReadFile(filepath.Join(root, "file.txt")); string(data) != "x" {
+		t.Errorf("expected file.txt untouched, got %q", data)
+	}
+}
+
+func TestRESTWrite_MultiDir(t *testing.T) {
+	root := t.TempDir()
+	mounts := []config.DirMount{
+		{Dir: root, Path: "/files", Name: "Files"},
+		{Dir: t.TempDir(), Path: "/ro", Name: "RO", Readonly: true},
+	}
+	cfg := &config.Config{Theme: "advanced", EnableRESTWrite: true}
+	m := NewMultiDir(mounts, cfg, slog.New(slog.DiscardHandler))
+
+	rr := curl(t, m, http.MethodPut, "/files/report.txt", strings.NewReader("report"))
+	if rr.Code != http.StatusCreated || rr.Header().Get("Location") != "/files/report.txt" {
+		t.Fatalf("expected 201 with the mounted Location, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := curl(t, m, http.MethodGet, "/files/report.txt", nil); rr.Body.String() != "report" {
+		t.Errorf("expected the stored file to be served, got %q", rr.Body.String())
+	}
+	if rr := curl(t, m, http.MethodPut, "/ro/report.txt", strings.NewReader("x")); rr.Code != http.StatusForbidden {
+		t.Errorf("read-only mount: expected 403, got %d", rr.Code)
+	}
+	if rr := curl(t, m, http.MethodDelete, "/files/report.txt", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE: expected 204, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,434 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/fileutil"
+)
+
+// Scrubber re-reads every file of its mounts in the background and compares
+// the SHA-256 of its content with the one recorded on the previous pass. A
+// file whose content changed while its size and modification time did not
+// was most likely corrupted on disk, not edited, and is reported as suspect.
+// Each mount's digests are kept in a manifest below dir.
+type Scrubber struct {
+	dir        string
+	rate       int64 // Bytes read per second; 0 is unlimited
+	showHidden bool
+	logger     *slog.Logger
+	busy       func() bool // Reports high request load; nil never pauses
+
+	mu      sync.Mutex
+	mounts  []scrubMount
+	reports map[string]ScrubReport // By mount path
+}
+
+type scrubMount struct {
+	path string
+	fs   internal.FileSystem
+}
+
+// ScrubSuspect is a file whose content no longer matches its recorded digest
+// although its size and modification time are unchanged.
+type ScrubSuspect struct {
+	Path       string    `json:"path"`
+	OldDigest  string    `json:"oldDigest"`  // SHA-256 recorded when the file was last known good
+	NewDigest  string    `json:"newDigest"`  // SHA-256 of its current content
+	ModTime    time.Time `json:"modTime"`    // Modification time, unchanged since OldDigest was recorded
+	RecordedAt time.Time `json:"recordedAt"` // When OldDigest was recorded
+	DetectedAt time.Time `json:"detectedAt"` // When the mismatch was first seen
+}
+
+// ScrubReport is the outcome of the last scrub of a mount.
+type ScrubReport struct {
+	LastRun  time.Time      `json:"lastRun"` // Zero until a scrub completes
+	Files    int            `json:"files"`   // Files with a recorded digest
+	Suspects []ScrubSuspect `json:"suspects"`
+}
+
+// scrubManifest is the state kept for a mount between scrubs.
+type scrubManifest struct {
+	LastRun  time.Time              `json:"lastRun"`
+	Files    map[string]scrubRecord `json:"files"`
+	Suspects []ScrubSuspect         `json:"suspects"`
+}
+
+type scrubRecord struct {
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	Digest     string    `json:"sha256"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// NewScrubber keeps its manifests in dir, creating it if needed. It reads at
+// most rate bytes per second, or without limit if rate is 0.
+func NewScrubber(dir string, rate int64, showHidden bool, logger *slog.Logger) (*Scrubber, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating scrub directory %s: %w", dir, err)
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Scrubber{
+		dir:        dir,
+		rate:       rate,
+		showHidden: showHidden,
+		logger:     logger,
+		reports:    make(map[string]ScrubReport),
+	}, nil
+}
+
+// SetBusy makes scrubs pause for as long as busy reports high request load.
+func (s *Scrubber) SetBusy(busy func() bool) {
+	s.busy = busy
+}
+
+// AddMount scrubs the tree served by fsys at mountPath. The report of an
+// earlier run is available right away.
+func (s *Scrubber) AddMount(mountPath string, fsys internal.FileSystem) {
+	m := scrubMount{path: mountPath, fs: fsys}
+	manifest, err := s.load(m)
+	if err != nil {
+		s.logger.Warn("Failed to read scrub manifest",
+			slog.String("mount", mountPath),
+			slog.String("error", err.Error()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mounts = append(s.mounts, m)
+	s.reports[mountPath] = manifest.report()
+}
+
+// Report returns the outcome of the last scrub of the mount at mountPath.
+func (s *Scrubber) Report(mountPath string) ScrubReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.reports[mountPath]
+	report.Suspects = slices.Clone(report.Suspects)
+	if report.Suspects == nil {
+		report.Suspects = []ScrubSuspect{}
+	}
+	return report
+}
+
+// Run scrubs every mount immediately and then on every interval until ctx is
+// done.
+func (s *Scrubber) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ScrubOnce(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Warn("Scrub failed", slog.String("error", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ScrubOnce scrubs every mount in turn. A mount that fails does not stop the
+// others; the first error is returned.
+func (s *Scrubber) ScrubOnce(ctx context.Context) error {
+	s.mu.Lock()
+	mounts := slices.Clone(s.mounts)
+	s.mu.Unlock()
+
+	throttle := &scrubThrottle{ctx: ctx, rate: s.rate, busy: s.busy}
+	var firstErr error
+	for _, m := range mounts {
+		if err := s.scrubMount(ctx, m, throttle); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("mount %s: %w", m.path, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+func (s *Scrubber) scrubMount(ctx context.Context, m scrubMount, throttle *scrubThrottle) error {
+	previous, err := s.load(m)
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	s.logger.Debug("Scrub started", slog.String("mount", m.path))
+
+	var files []manifestEntry
+	if err := s.walk(ctx, m.fs, "", &files); err != nil {
+		return err
+	}
+
+	next := scrubManifest{LastRun: started, Files: make(map[string]scrubRecord, len(files))}
+	for _, f := range files {
+		digest, err := s.digest(m.fs, f, throttle)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// Gone or changing under us; the next run sees it settled
+			s.logger.Debug("Skipping file during scrub",
+				slog.String("mount", m.path),
+				slog.String("path", f.path),
+				slog.String("error", err.Error()))
+			if old, ok := previous.Files[f.path]; ok {
+				next.Files[f.path] = old
+			}
+			continue
+		}
+
+		now := time.Now()
+		old, known := previous.Files[f.path]
+		if !known || old.Size != f.size || !old.ModTime.Equal(f.modTime) || old.Digest == digest {
+			next.Files[f.path] = scrubRecord{Size: f.size, ModTime: f.modTime, Digest: digest, RecordedAt: now}
+			continue
+		}
+
+		// Keep the known-good digest so the file stays suspect until it is
+		// repaired or replaced
+		next.Files[f.path] = old
+		suspect := ScrubSuspect{
+			Path:       f.path,
+			OldDigest:  old.Digest,
+			NewDigest:  digest,
+			ModTime:    f.modTime,
+			RecordedAt: old.RecordedAt,
+			DetectedAt: now,
+		}
+		if i := slices.IndexFunc(previous.Suspects, func(p ScrubSuspect) bool {
+			return p.Path == f.path && p.NewDigest == digest
+		}); i >= 0 {
+			suspect.DetectedAt = previous.Suspects[i].DetectedAt
+		}
+		next.Suspects = append(next.Suspects, suspect)
+		s.logger.Warn("File content changed without a modification time change, possible corruption",
+			slog.String("mount", m.path),
+			slog.String("path", f.path),
+			slog.String("old_sha256", old.Digest),
+			slog.String("new_sha256", digest))
+	}
+
+	if err := s.save(m, next); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.reports[m.path] = next.report()
+	s.mu.Unlock()
+
+	s.logger.Info("Scrub completed",
+		slog.String("mount", m.path),
+		slog.Int("files", len(files)),
+		slog.Int("suspects", len(next.Suspects)),
+		slog.Duration("duration", time.Since(started)))
+	return nil
+}
+
+// walk collects the files below rel, skipping hidden entries unless
+// they are shown.
+func (s *Scrubber) walk(ctx context.Context, fsys internal.FileSystem, rel string, files *[]manifestEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := fsys.ReadDir(rel)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := path.Join(rel, e.Name())
+		if !s.showHidden && fileutil.IsHiddenPath(name) {
+			continue
+		}
+		if e.IsDir() {
+			if err := s.walk(ctx, fsys, name, files); err != nil {
+				return err
+			}
+			continue
+		}
+		*files = append(*files, manifestEntry{path: name, size: e.Size(), modTime: e.ModTime()})
+	}
+	return nil
+}
+
+// digest hashes f at the throttled rate. It fails if the file changed while
+// it was read, since that is an edit rather than corruption.
+func (s *Scrubber) digest(fsys internal.FileSystem, f manifestEntry, throttle *scrubThrottle) (string, error) {
+	file, err := fsys.Open(f.path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, &throttledReader{throttle: throttle, r: file}); err != nil {
+		return "", err
+	}
+	info, err := fsys.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() != f.size || !info.ModTime().Equal(f.modTime) {
+		return "", errors.New("modified while scrubbing")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// manifestPath names a mount's manifest after its escaped path, so nested
+// mounts cannot collide.
+func (s *Scrubber) manifestPath(m scrubMount) string {
+	return filepath.Join(s.dir, url.PathEscape(m.path)+".json")
+}
+
+func (s *Scrubber) load(m scrubMount) (scrubManifest, error) {
+	manifest := scrubManifest{Files: map[string]scrubRecord{}}
+	data, err := os.ReadFile(s.manifestPath(m))
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return scrubManifest{Files: map[string]scrubRecord{}}, fmt.Errorf("parsing %s: %w", s.manifestPath(m), err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = map[string]scrubRecord{}
+	}
+	return manifest, nil
+}
+
+// save replaces the manifest of m atomically.
+func (s *Scrubber) save(m scrubMount, manifest scrubManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".scrub-*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing scrub manifest: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.manifestPath(m))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing scrub manifest: %w", err)
+	}
+	return nil
+}
+
+func (m scrubManifest) report() ScrubReport {
+	return ScrubReport{LastRun: m.LastRun, Files: len(m.Files), Suspects: m.Suspects}
+}
+
+// scrubThrottle paces the reads of one scrub: it waits while the server is
+// busy and keeps the average rate at or below rate bytes per second.
+type scrubThrottle struct {
+	ctx   context.Context
+	rate  int64
+	busy  func() bool
+	start time.Time
+	read  int64
+}
+
+func (t *scrubThrottle) wait() error {
+	for t.busy != nil && t.busy() {
+		if err := sleepContext(t.ctx, constants.ScrubBusyPause); err != nil {
+			return err
+		}
+		// Pausing must not earn a burst afterwards
+		t.start, t.read = time.Time{}, 0
+	}
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	if t.rate > 0 {
+		due := time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second))
+		if ahead := due - time.Since(t.start); ahead > 0 {
+			return sleepContext(t.ctx, ahead)
+		}
+	}
+	return t.ctx.Err()
+}
+
+// throttledReader reads through a scrubThrottle in small chunks, so the rate
+// holds within a file too.
+type throttledReader struct {
+	throttle *scrubThrottle
+	r        io.Reader
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if err := tr.throttle.wait(); err != nil {
+		return 0, err
+	}
+	if len(p) > constants.ScrubChunkSize {
+		p = p[:constants.ScrubChunkSize]
+	}
+	n, err := tr.r.Read(p)
+	tr.throttle.read += int64(n)
+	return n, err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// SetScrubber serves the scrub report of the mount at mountPath through
+// /api/scrub/report.
+func (h *AdvancedFile) SetScrubber(s *Scrubber, mountPath string) {
+	h.scrubber = s
+	h.scrubMount = mountPath
+}
+
+// handleScrubReport serves GET /api/scrub/report, the files of this mount
+// the last scrub found corrupted.
+func (h *AdvancedFile) handleScrubReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.scrubber == nil {
+		middleware.WriteJSONError(w, "Integrity scrubbing is not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := middleware.WriteJSON(w, h.scrubber.Report(h.scrubMount)); err != nil {
+		h.logger.Warn("Failed to write scrub report", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// corrupt overwrites the content of name with data of the same length and
+// restores its modification time, as bit rot would.
+func corrupt(t *testing.T, name, data string) {
+	t.Helper()
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != info.Size() {
+		t.Fatalf("corrupt %s: %d bytes for a file of %d", name, len(data), info.Size())
+	}
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScrubber_ReportsCorruption(t *testing.T) {
+	root, stateDir := t.TempDir(), t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"photo.jpg":     "original bytes",
+		"docs/a.txt":    "some text",
+		"edited.txt":    "first draft",
+		".hidden/x.bin": "hidden",
+	})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := NewScrubber(stateDir, 0, false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddMount("/", filesystem.NewLocal(root, false))
+	if err := s.ScrubOnce(context.Background()); err != nil {
+		t.Fatalf("first scrub: %v", err)
+	}
+	first := s.Report("/")
+	if first.Files != 3 || len(first.Suspects) != 0 || first.LastRun.IsZero() {
+		t.Fatalf("expected a clean baseline of three files, got %+v", first)
+	}
+
+	corrupt(t, filepath.Join(root, "photo.jpg"), "originaX bytes")
+	// An edit moves the modification time and is not corruption
+	edited := filepath.Join(root, "edited.txt")
+	if err := os.WriteFile(edited, []byte("second"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(edited, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ScrubOnce(context.Background()); err != nil {
+		t.Fatalf("second scrub: %v", err)
+	}
+	report := s.Report("/")
+	if len(report.Suspects) != 1 {
+		t.Fatalf("expected only photo.jpg to be suspect, got %+v", report.Suspects)
+	}
+	suspect := report.Suspects[0]
+	if suspect.Path != "photo.jpg" || suspect.OldDigest == suspect.NewDigest || suspect.OldDigest == "" ||
+		suspect.ModTime.IsZero() || suspect.DetectedAt.Before(suspect.RecordedAt) {
+		t.Errorf("unexpected suspect %+v", suspect)
+	}
+
+	// The file stays suspect on later runs, and across restarts
+	if err := s.ScrubOnce(context.Background()); err != nil {
+		t.Fatalf("third scrub: %v", err)
+	}
+	restarted, err := NewScrubber(stateDir, 0, false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.AddMount("/", filesystem.NewLocal(root, false))
+	again := restarted.Report("/")
+	if len(again.Suspects) != 1 || !again.Suspects[0].DetectedAt.Equal(suspect.DetectedAt) {
+		t.Errorf("expected the suspect to persist with its first detection, got %+v", again.Suspects)
+	}
+
+	// Restoring the content clears it
+	corrupt(t, filepath.Join(root, "photo.jpg"), "original bytes")
+	if err := restarted.ScrubOnce(context.Background()); err != nil {
+		t.Fatalf("scrub after repair: %v", err)
+	}
+	if got := restarted.Report("/").Suspects; len(got) != 0 {
+		t.Errorf("expected no suspects after the repair, got %+v", got)
+	}
+}
+
+func TestScrubber_Endpoint(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(name, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewScrubber(t.TempDir(), 0, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddMount("/", filesystem.NewLocal(root, false))
+	_ = s.ScrubOnce(context.Background())
+	corrupt(t, name, "abd")
+	_ = s.ScrubOnce(context.Background())
+
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/scrub/report", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("scrubbing disabled: expected 404, got %d", rr.Code)
+	}
+
+	h.SetScrubber(s, "/")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/scrub/report", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report ScrubReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(report.Suspects) != 1 || report.Suspects[0].Path != "a.txt" {
+		t.Errorf("expected a.txt to be reported, got %+v", report)
+	}
+	if !strings.Contains(rr.Body.String(), `"oldDigest"`) {
+		t.Errorf("expected digests in the report: %s", rr.Body.String())
+	}
+}
+
+func TestScrubThrottle(t *testing.T) {
+	// Reading 2 KB at 10 KB/s takes about 200ms
+	throttle := &scrubThrottle{ctx: context.Background(), rate: 10 << 10}
+	start := time.Now()
+	r := &throttledReader{throttle: throttle, r: strings.NewReader(strings.Repeat("x", 2<<10))}
+	buf := make([]byte, 512)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			break
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected reads to be paced, took %v", elapsed)
+	}
+
+	// A busy server pauses the scrub until it is canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	busy := &scrubThrottle{ctx: ctx, busy: func() bool { return true }}
+	if err := busy.wait(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
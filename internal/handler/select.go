@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/listing"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// SelectResponse is the answer of GET /api/select: the entries of Path whose
+// names match Glob, as paths the bulk and ZIP endpoints accept.
+type SelectResponse struct {
+	Path      string   `json:"path"`
+	Glob      string   `json:"glob"`
+	Paths     []string `json:"paths"`
+	Truncated bool     `json:"truncated"` // More entries matched than the limit
+}
+
+var (
+	errInvalidGlob   = errors.New("invalid glob")
+	errGlobWithPaths = errors.New("paths and glob cannot be combined")
+	errGlobNotDir    = errors.New("glob path is not a directory")
+)
+
+// handleSelect serves GET /api/select?path=dir&glob=*.log[&limit=n], which
+// lets the page select entries by pattern without listing them itself.
+func (h *AdvancedFile) handleSelect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	limit := constants.MaxSelectPaths
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			middleware.WriteJSONError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, constants.MaxSelectPaths)
+	}
+
+	dir, glob := query.Get("path"), query.Get("glob")
+	paths, more, err := h.expandGlob(dir, glob, limit)
+	if err != nil {
+		h.writeGlobError(w, r, err)
+		return
+	}
+	response := SelectResponse{Path: "/" + strings.Trim(dir, "/"), Glob: glob, Paths: paths, Truncated: more}
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := middleware.WriteJSON(w, response); err != nil {
+		h.logger.Warn("Failed to write select response",
+			slog.String("path", dir),
+			slog.String("error", err.Error()))
+	}
+}
+
+// expandGlob returns the paths of the entries of dir whose names match glob,
+// a path.Match pattern for one name, in listing order. Entries a listing
+// leaves out never match. It returns at most limit paths and reports
+// whether there were more.
+func (h *AdvancedFile) expandGlob(dir, glob string, limit int) (paths []string, more bool, err error) {
+	if glob == "" || len(glob) > constants.MaxRequestPathLength || strings.Contains(glob, "/") {
+		return nil, false, errInvalidGlob
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, false, errInvalidGlob
+	}
+	if len(dir) > constants.MaxRequestPathLength {
+		return nil, false, errPathTooLong
+	}
+	name, err := pathsafe.Clean(dir)
+	if err != nil {
+		return nil, false, errBulkInvalidPath
+	}
+	info, err := h.fs.Stat(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if !info.IsDir() {
+		return nil, false, errGlobNotDir
+	}
+
+	l, err := listing.Read(h.fs, name, listing.Options{ShowHidden: h.config.ShowHidden})
+	if err != nil {
+		return nil, false, err
+	}
+	paths = []string{}
+	for _, e := range l.Entries {
+		if ok, _ := path.Match(glob, e.Name); !ok {
+			continue
+		}
+		if len(paths) == limit {
+			return paths, true, nil
+		}
+		paths = append(paths, "/"+path.Join(name, e.Name))
+	}
+	return paths, false, nil
+}
+
+// selectionPaths resolves the selection of a bulk or ZIP request: either
+// explicit paths, or the entries of dir matching glob. It writes the error
+// response and returns false if the selection is invalid or names more than
+// maxPaths entries.
+func (h *AdvancedFile) selectionPaths(w http.ResponseWriter, r *http.Request, paths []string, dir, glob string,
+	maxPaths int,
+) ([]string, bool) {
+	if glob == "" {
+		return paths, true
+	}
+	if len(paths) > 0 {
+		h.writeGlobError(w, r, errGlobWithPaths)
+		return nil, false
+	}
+	matched, more, err := h.expandGlob(dir, glob, maxPaths)
+	if err != nil {
+		h.writeGlobError(w, r, err)
+		return nil, false
+	}
+	if more {
+		writeRequestPathsError(w, errTooManyPaths, maxPaths)
+		return nil, false
+	}
+	if len(matched) == 0 {
+		middleware.WriteJSONError(w, "No files match "+glob, http.StatusBadRequest)
+		return nil, false
+	}
+	return matched, true
+}
+
+// writeGlobError answers a failed expandGlob or selectionPaths.
+func (h *AdvancedFile) writeGlobError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *internal.APIError
+	switch {
+	case errors.Is(err, errInvalidGlob):
+		middleware.WriteJSONError(w, "Invalid glob, expected a pattern such as *.log", http.StatusBadRequest)
+	case errors.Is(err, errGlobWithPaths):
+		middleware.WriteJSONError(w, "Give either paths or a glob, not both", http.StatusBadRequest)
+	case errors.Is(err, errPathTooLong), errors.Is(err, errBulkInvalidPath):
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+	case errors.Is(err, errGlobNotDir):
+		middleware.WriteJSONError(w, "Path is not a directory", http.StatusBadRequest)
+	case errors.As(err, &apiErr) && apiErr.Status < http.StatusInternalServerError:
+		middleware.WriteJSONError(w, apiErr.Message, apiErr.Status)
+	default:
+		h.reporter().JSONError(w, r, "Cannot read directory", http.StatusInternalServerError, err)
+	}
+}
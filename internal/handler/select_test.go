@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func newSelectTestDir(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"logs/a.log":       "a",
+		"logs/b.log":       "bb",
+		"logs/c.txt":       "ccc",
+		"logs/.hidden.log": "hidden",
+		"logs/old/d.log":   "nested",
+	})
+	return root
+}
+
+func getSelect(h *AdvancedFile, query url.Values) (*httptest.ResponseRecorder, SelectResponse) {
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/select?"+query.Encode(), nil))
+	var resp SelectResponse
+	if rr.Code == http.StatusOK {
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	}
+	return rr, resp
+}
+
+func TestAdvancedFile_Select(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(newSelectTestDir(t), false), &config.Config{Theme: "advanced"})
+
+	tests := []struct {
+		name          string
+		query         url.Values
+		wantStatus    int
+		wantPaths     []string
+		wantTruncated bool
+	}{
+		{
+			name:       "matches names in the directory only",
+			query:      url.Values{"path": {"/logs"}, "glob": {"*.log"}},
+			wantStatus: http.StatusOK,
+			wantPaths:  []string{"/logs/a.log", "/logs/b.log"},
+		},
+		{
+			name:       "directories match too",
+			query:      url.Values{"path": {"logs"}, "glob": {"o*"}},
+			wantStatus: http.StatusOK,
+			wantPaths:  []string{"/logs/old"},
+		},
+		{
+			name:       "no match is an empty list",
+			query:      url.Values{"path": {"/logs"}, "glob": {"*.zip"}},
+			wantStatus: http.StatusOK,
+			wantPaths:  []string{},
+		},
+		{
+			name:          "limit truncates",
+			query:         url.Values{"path": {"/logs"}, "glob": {"*"}, "limit": {"2"}},
+			wantStatus:    http.StatusOK,
+			wantPaths:     []string{"/logs/old", "/logs/a.log"},
+			wantTruncated: true,
+		},
+		{
+			name:       "limit equal to the matches does not truncate",
+			query:      url.Values{"path": {"/logs"}, "glob": {"*.log"}, "limit": {"2"}},
+			wantStatus: http.StatusOK,
+			wantPaths:  []string{"/logs/a.log", "/logs/b.log"},
+		},
+		{name: "invalid limit", query: url.Values{"glob": {"*"}, "limit": {"0"}}, wantStatus: http.StatusBadRequest},
+		{name: "missing glob", query: url.Values{"path": {"/logs"}}, wantStatus: http.StatusBadRequest},
+		{name: "malformed glob", query: url.Values{"glob": {"[a"}}, wantStatus: http.StatusBadRequest},
+		{name: "glob across directories", query: url.Values{"glob": {"logs/*.log"}}, wantStatus: http.StatusBadRequest},
+		{name: "path escaping the mount", query: url.Values{"path": {"../x"}, "glob": {"*"}},
+			wantStatus: http.StatusBadRequest},
+		{name: "missing directory", query: url.Values{"path": {"/nope"}, "glob": {"*"}},
+			wantStatus: http.StatusNotFound},
+		{name: "path of a file", query: url.Values{"path": {"/logs/a.log"}, "glob": {"*"}},
+			wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, resp := getSelect(h, tt.query)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !reflect.DeepEqual(resp.Paths, tt.wantPaths) || resp.Truncated != tt.wantTruncated {
+				t.Errorf("Expected %v (truncated %v), got %v (truncated %v)",
+					tt.wantPaths, tt.wantTruncated, resp.Paths, resp.Truncated)
+			}
+		})
+	}
+}
+
+func TestAdvancedFile_SelectLimitCapped(t *testing.T) {
+	root := t.TempDir()
+	for i := range constants.MaxSelectPaths + 1 {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("f%04d.log", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	rr, resp := getSelect(h, url.Values{"glob": {"*.log"}, "limit": {"5000"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(resp.Paths) != constants.MaxSelectPaths || !resp.Truncated {
+		t.Errorf("Expected %d paths and truncated, got %d (truncated %v)",
+			constants.MaxSelectPaths, len(resp.Paths), resp.Truncated)
+	}
+
+	// A glob matching more entries than a bulk request may name is refused
+	// as a whole rather than applied to some of them
+	rr, _ = postBulk(t, h, "/api/delete", BulkRequest{Glob: "*.log"})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a glob over the bulk limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != constants.MaxSelectPaths+1 {
+		t.Errorf("Expected no file to be deleted, %d left", len(entries))
+	}
+}
+
+func TestAdvancedFile_ZipGlob(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(newSelectTestDir(t), false), &config.Config{Theme: "advanced"})
+	want := map[string]string{"a.log": "a", "b.log": "bb"}
+
+	t.Run("POST", func(t *testing.T) {
+		body, err := json.Marshal(ZipRequest{Path: "/logs", Glob: "*.log", Name: "logs.zip"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/zip", bytes.NewReader(body))
+		req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if got := extractZip(t, rr.Body.Bytes()); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("GET", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/zip?path=/logs&glob=*.log", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if got := extractZip(t, rr.Body.Bytes()); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/zip?path=/logs&glob=*.zip", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+func TestAdvancedFile_BulkGlob(t *testing.T) {
+	root := newSelectTestDir(t)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+
+	rr, _ := postBulk(t, h, "/api/delete", BulkRequest{Paths: []string{"/logs/a.log"}, Path: "/logs", Glob: "*.log"})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("paths and glob: expected 400, got %d", rr.Code)
+	}
+
+	rr, resp := postBulk(t, h, "/api/delete", BulkRequest{Path: "/logs", Glob: "*.log"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	assertBulkResults(t, resp, map[string]string{"/logs/a.log": "", "/logs/b.log": ""})
+	for name, wantKept := range map[string]bool{
+		"a.log": false, "b.log": false, "c.txt": true, ".hidden.log": true, "old/d.log": true,
+	} {
+		_, err := os.Stat(filepath.Join(root, "logs", name))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%s: expected kept=%v, got %v", name, wantKept, kept)
+		}
+	}
+}
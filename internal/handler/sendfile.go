@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/httprange"
+)
+
+// serveOSFile serves a file opened from the local disk with
+// http.ServeContent, which lets net/http hand it to the kernel with sendfile.
+// The caller sets Content-Type, Content-Disposition and ETag first; rng is
+// the range from httprange.ParseRange, so both paths agree on which ranges
+// are honored. The caller has evaluated the conditional headers with
+// checkConditions already.
+func serveOSFile(w http.ResponseWriter, r *http.Request, file internal.OSFile, size int64, rng *httprange.Range) {
+	// Hand net/http the range we settled on: none for headers ParseRange
+	// rejected or does not support, and the clamped range otherwise
+	req := r.Clone(r.Context())
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range"} {
+		req.Header.Del(name)
+	}
+	if rng == nil {
+		req.Header.Del("Range")
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", rng.Start, rng.End))
+	}
+
+	// The caller set Last-Modified; a zero modtime keeps net/http from
+	// setting or checking it again
+	cw := &sendfileWriter{ResponseWriter: w, status: http.StatusOK}
+	http.ServeContent(cw, req, "", time.Time{}, file.File())
+
+	switch {
+	case cw.status == http.StatusOK && cw.written == size,
+		cw.status == http.StatusPartialContent && rng != nil && rng.End == size-1 && cw.written == rng.Length:
+		middleware.MarkDownload(r)
+	}
+}
+
+// sendfileWriter records the status and body size of a response while
+// passing ReadFrom through, so the sendfile path of the underlying writer
+// stays reachable.
+type sendfileWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *sendfileWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sendfileWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// ReadFrom uses the underlying writer's ReadFrom directly: io.Copy would
+// first try the WriteTo of an *os.File src, which cannot reach the
+// connection.
+func (w *sendfileWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, src)
+	}
+	w.written += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *sendfileWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
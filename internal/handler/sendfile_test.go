@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// copyingFS hides internal.OSFile so files take the copying path.
+type copyingFS struct {
+	internal.FileSystem
+}
+
+func (c copyingFS) Open(name string) (io.ReadCloser, error) {
+	f, err := c.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ io.ReadSeekCloser }{f.(io.ReadSeekCloser)}, nil
+}
+
+func TestServeFile_SendfileParity(t *testing.T) {
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := os.WriteFile(filepath.Join(root, "data.txt"), content, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	local := filesystem.NewLocal(root, false)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	requests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+	}{
+		{name: "full"},
+		{name: "head", method: http.MethodHead},
+		{name: "bounded", headers: map[string]string{"Range": "bytes=10-19"}},
+		{name: "open_ended", headers: map[string]string{"Range": "bytes=9990-"}},
+		{name: "suffix", headers: map[string]string{"Range": "bytes=-5"}},
+		{name: "clamped", headers: map[string]string{"Range": "bytes=9995-20000"}},
+		{name: "whitespace", headers: map[string]string{"Range": "bytes= 0-4 ,"}},
+		{name: "multiple", headers: map[string]string{"Range": "bytes=0-4,7-11"}},
+		{name: "invalid", headers: map[string]string{"Range": "bytes=abc"}},
+		{name: "unsatisfiable", headers: map[string]string{"Range": "bytes=20000-"}},
+	}
+
+	for _, theme := range []string{"default", "advanced"} {
+		newHandler := func(fs internal.FileSystem) http.Handler {
+			cfg := &config.Config{Theme: theme, MaxHashSize: 1 << 20}
+			if theme == "advanced" {
+				return NewAdvancedFile(fs, cfg)
+			}
+			return NewFile(fs, cfg, logger)
+		}
+		sendfile, copying := newHandler(local), newHandler(copyingFS{local})
+
+		// The content ETag makes If-None-Match comparable across both paths
+		etag := ""
+		for _, tt := range requests {
+			t.Run(theme+"/"+tt.name, func(t *testing.T) {
+				serve := func(h http.Handler) *httptest.ResponseRecorder {
+					method := tt.method
+					if method == "" {
+						method = http.MethodGet
+					}
+					req := httptest.NewRequest(method, "/data.txt", nil)
+					for k, v := range tt.headers {
+						req.Header.Set(k, v)
+					}
+					rr := httptest.NewRecorder()
+					h.ServeHTTP(rr, req)
+					return rr
+				}
+				want, got := serve(copying), serve(sendfile)
+				if got.Code != want.Code || !bytes.Equal(got.Body.Bytes(), want.Body.Bytes()) {
+					t.Fatalf("sendfile path: %d with %d bytes, copying path: %d with %d bytes",
+						got.Code, got.Body.Len(), want.Code, want.Body.Len())
+				}
+				for _, header := range []string{"Content-Type", "Content-Length", "Content-Range",
+					"Content-Disposition", "Accept-Ranges", "ETag"} {
+					if got.Header().Get(header) != want.Header().Get(header) {
+						t.Errorf("%s: sendfile path %q, copying path %q",
+							header, got.Header().Get(header), want.Header().Get(header))
+					}
+				}
+				etag = want.Header().Get("ETag")
+			})
+		}
+
+		if etag == "" {
+			continue
+		}
+		t.Run(theme+"/if_none_match", func(t *testing.T) {
+			for _, h := range []http.Handler{sendfile, copying} {
+				req := httptest.NewRequest(http.MethodGet, "/data.txt", nil)
+				req.Header.Set("If-None-Match", etag)
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+				if rr.Code != http.StatusNotModified {
+					t.Errorf("expected 304, got %d", rr.Code)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkServeFile(b *testing.B) {
+	root := b.TempDir()
+	const size = 64 << 20
+	if err := os.WriteFile(filepath.Join(root, "large.bin"), make([]byte, size), 0o644); err != nil {
+		b.Fatalf("WriteFile: %v", err)
+	}
+	local := filesystem.NewLocal(root, false)
+	cfg := &config.Config{Theme: "advanced"}
+
+	for _, bc := range []struct {
+		name string
+		fs   internal.FileSystem
+	}{
+		{"sendfile", local},
+		{"copying", copyingFS{local}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			srv := httptest.NewServer(NewAdvancedFile(bc.fs, cfg))
+			defer srv.Close()
+
+			b.SetBytes(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := http.Get(srv.URL + "/large.bin")
+				if err != nil {
+					b.Fatalf("GET: %v", err)
+				}
+				n, err := io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if err != nil || n != size {
+					b.Fatal(fmt.Errorf("read %d of %d bytes: %v", n, size, err))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// BlockSensitive leaves the files matching the sensitive patterns out of
+// fsys with --block-sensitive, so they are neither listed nor served, and
+// returns fsys as is otherwise.
+func BlockSensitive(fsys internal.FileSystem, cfg *config.Config) internal.FileSystem {
+	if !cfg.BlockSensitive {
+		return fsys
+	}
+	patterns := cfg.SensitivePatterns
+	return filesystem.NewExcluding(fsys, func(name string) bool {
+		return config.DeniedPath(name, patterns)
+	})
+}
+
+// SensitiveScan is what ScanSensitive found in a mount.
+type SensitiveScan struct {
+	Matches   []string // Paths below the mount root; directories end in a slash
+	Truncated bool     // The scan stopped at a limit, so there may be more
+}
+
+// ScanSensitive looks for entries of dir matching patterns, the startup
+// check of every local mount. It is shallow and bounded so a large tree
+// does not hold up startup: only the top constants.SensitiveScanDepth levels
+// are read, at most constants.MaxSensitiveScanned entries of them. Matching
+// directories are reported, not descended into, and symlinks are not
+// followed. Hidden files are scanned whatever --show-hidden says, since they
+// can still be requested by name.
+func ScanSensitive(dir string, patterns []string) (SensitiveScan, error) {
+	local := filesystem.NewLocal(dir, true)
+	var scan SensitiveScan
+	scanned := 0
+	level := []string{""}
+	for depth := 0; depth < constants.SensitiveScanDepth && len(level) > 0 && !scan.Truncated; depth++ {
+		var next []string
+		for _, parent := range level {
+			err := internal.ReadDirIter(local, parent, func(f internal.FileInfo) error {
+				if scanned++; scanned > constants.MaxSensitiveScanned {
+					scan.Truncated = true
+					return fs.SkipAll
+				}
+				name := path.Join(parent, f.Name())
+				switch {
+				case config.DeniedPath(name, patterns):
+					if len(scan.Matches) == constants.MaxSensitiveMatches {
+						scan.Truncated = true
+						return fs.SkipAll
+					}
+					if f.IsDir() {
+						name += "/"
+					}
+					scan.Matches = append(scan.Matches, "/"+name)
+				case f.IsDir():
+					next = append(next, name)
+				}
+				return nil
+			})
+			if err != nil && parent == "" {
+				return scan, err
+			}
+			if scan.Truncated {
+				break
+			}
+		}
+		level = next
+	}
+	slices.Sort(scan.Matches)
+	return scan, nil
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/internal/tracing"
+	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/httprange"
+)
+
+// fileServer answers GET and HEAD for files on behalf of both themes, so
+// they send the same headers whichever path a response takes.
+type fileServer struct {
+	fs        internal.FileSystem
+	config    *config.Config
+	logger    *slog.Logger
+	reporter  middleware.ErrorReporter
+	flights   *coalescer // Merges concurrent hashes of the same file; may be nil
+	component string     // Logged with every message
+}
+
+// serve answers r with the file at path. Every decision that can end the
+// response early is taken before any header describing the body is set: the
+// precompressed variant, the conditional headers with their 304 or 412, and
+// the range with its 416. Only then are Content-Disposition and
+// Content-Type set, and Content-Length and Content-Range are left to the
+// code that writes the status, so a 304 never carries them and a HEAD
+// carries exactly what the GET would.
+func (s fileServer) serve(w http.ResponseWriter, r *http.Request, path string) {
+	_, span := tracing.Start(r.Context(), "fs.Open")
+	span.SetAttr("gofs.path", "/"+path)
+	file, err := internal.OpenSeeker(s.fs, path)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		if !writeUnavailable(w, r, s.reporter, err) {
+			s.reporter.Error(w, r, "Cannot open file", http.StatusInternalServerError, err)
+		}
+		return
+	}
+	logPath := middleware.LogPath(r, path)
+	defer s.closeFile(file, logPath)
+
+	info, err := s.fs.Stat(path)
+	if err != nil {
+		if !writeUnavailable(w, r, s.reporter, err) {
+			s.reporter.Error(w, r, "Cannot stat file", http.StatusInternalServerError, err)
+		}
+		return
+	}
+	if s.config.MaxDownloadSize > 0 && info.Size() > s.config.MaxDownloadSize {
+		http.Error(w, "File too large to download", http.StatusForbidden)
+		return
+	}
+
+	// Set before any 304 so revalidated responses carry the same policy
+	setCacheControl(w, s.config, path)
+
+	variants := findPrecompressed(s.fs, path, info)
+	if len(variants) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if v, ok := selectPrecompressed(r, variants); ok &&
+		servePrecompressed(w, r, s.fs, v, path, fileutil.DetectContentMimeType(path, nil, s.config.MimeTypes), s.logger) {
+		return
+	}
+
+	etag := fileETag(r.Context(), file, path, info, s.config.MaxHashSize, s.flights, s.logger)
+	rangeOK, serve := checkConditions(w, r, etag, info.ModTime())
+	if !serve {
+		return
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if !rangeOK {
+		// The file changed since the client's partial download
+		rangeHeader = ""
+	}
+	rng, err := httprange.ParseRange(rangeHeader, info.Size())
+	if err != nil {
+		if err == httprange.ErrUnsatisfiableRange {
+			httprange.WriteRangeNotSatisfiable(w, info.Size())
+			return
+		}
+		rng = nil
+	}
+
+	if rng != nil && !internal.Seekable(file) {
+		s.logger.Debug("File doesn't support seeking, serving full content",
+			slog.String("path", logPath),
+			slog.String("component", s.component),
+		)
+		rng = nil
+	}
+
+	mimeType, body := detectContentType(s.config, path, file)
+	w.Header().Set("Content-Disposition", contentDisposition(r, filepath.Base(path)))
+	w.Header().Set("Content-Type", mimeType)
+	if s.config.DigestHeaders {
+		setDigestHeader(w, etag, rng != nil)
+	}
+
+	// Local files are sent by net/http, with sendfile where the OS has it
+	if osf, ok := file.(internal.OSFile); ok {
+		serveOSFile(w, r, osf, info.Size(), rng)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead:
+		httprange.WriteHeader(w, rng, info.Size(), mimeType)
+	case rng != nil:
+		s.logger.Debug("Serving partial content",
+			slog.String("path", logPath),
+			slog.Int64("start", rng.Start),
+			slog.Int64("end", rng.End),
+			slog.Int64("length", rng.Length),
+			slog.String("component", s.component),
+		)
+		if _, err := httprange.ServeContent(r.Context(), w, file, rng, info.Size(), mimeType); err != nil {
+			logCopyError(s.logger, "Error serving partial content", err,
+				slog.String("path", logPath),
+				slog.String("component", s.component),
+			)
+		} else if rng.End == info.Size()-1 {
+			// A resumed download is complete once its last range is sent
+			middleware.MarkDownload(r)
+		}
+	default:
+		if _, err := httprange.ServeFullContent(r.Context(), w, body, info.Size(), mimeType); err != nil {
+			logCopyError(s.logger, "Error serving full content", err,
+				slog.String("path", logPath),
+				slog.String("component", s.component),
+			)
+		} else {
+			middleware.MarkDownload(r)
+		}
+	}
+}
+
+func (s fileServer) closeFile(file io.Closer, logPath string) {
+	if err := file.Close(); err != nil {
+		s.logger.Warn("File close failed",
+			slog.String("path", logPath),
+			slog.String("error", err.Error()),
+			slog.String("component", s.component),
+		)
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// Share serves a single file for --share at /<token>/<name>, where token is
+// random so the URL cannot be guessed. Every other path is 404.
+type Share struct {
+	file  http.Handler
+	token string
+	name  string
+}
+
+// NewShare shares the regular file at path under a new random token.
+func NewShare(path string, cfg *config.Config, logger *slog.Logger) (*Share, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("sharing %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("sharing %s: not a regular file", path)
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generating share token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	// Hidden files are shared too; the name is the only one ever served
+	fs := filesystem.NewReadonly(filesystem.NewLocal(filepath.Dir(path), true))
+	return &Share{
+		file:  http.StripPrefix("/"+token, NewFile(fs, cfg, logger)),
+		token: token,
+		name:  filepath.Base(path),
+	}, nil
+}
+
+// URLPath returns the escaped path the file is served at.
+func (s *Share) URLPath() string {
+	return "/" + s.token + "/" + url.PathEscape(s.name)
+}
+
+func (s *Share) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	want := "/" + s.token + "/" + s.name
+	if subtle.ConstantTimeCompare([]byte(r.URL.Path), []byte(want)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	s.file.ServeHTTP(w, r)
+}
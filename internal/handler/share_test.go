@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+)
+
+func TestShare(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "report q1.pdf"), []byte("report"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{MaxHashSize: 1 << 20}
+	share, err := NewShare(filepath.Join(root, "report q1.pdf"), cfg, logger)
+	if err != nil {
+		t.Fatalf("NewShare failed: %v", err)
+	}
+	other, err := NewShare(filepath.Join(root, "report q1.pdf"), cfg, logger)
+	if err != nil {
+		t.Fatalf("NewShare failed: %v", err)
+	}
+	if share.URLPath() == other.URLPath() || !strings.HasSuffix(share.URLPath(), "/report%20q1.pdf") {
+		t.Errorf("expected distinct random URLs ending in the escaped name, got %s and %s",
+			share.URLPath(), other.URLPath())
+	}
+
+	token := strings.Split(share.URLPath(), "/")[1]
+	testCases := []struct {
+		path   string
+		status int
+	}{
+		{share.URLPath(), http.StatusOK},
+		{"/report%20q1.pdf", http.StatusNotFound},
+		{"/" + token + "/", http.StatusNotFound},
+		{"/" + token + "/secret.txt", http.StatusNotFound},
+		{other.URLPath(), http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		rr := httptest.NewRecorder()
+		share.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rr.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.path, tc.status, rr.Code)
+		}
+		if tc.status == http.StatusOK && rr.Body.String() != "report" {
+			t.Errorf("%s: expected the shared file, got %q", tc.path, rr.Body.String())
+		}
+	}
+
+	if _, err := NewShare(root, cfg, logger); err == nil {
+		t.Error("expected an error sharing a directory")
+	}
+	if _, err := NewShare(filepath.Join(root, "missing"), cfg, logger); err == nil {
+		t.Error("expected an error sharing a missing file")
+	}
+}
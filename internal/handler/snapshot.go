@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// snapshotState is what --snapshot-file keeps: the snapshot of every mount
+// by mount path, so a restart serves the same view.
+type snapshotState struct {
+	Mounts map[string]snapshotRecord `json:"mounts"`
+}
+
+type snapshotRecord struct {
+	Dir     string                              `json:"dir"` // Absolute directory the snapshot was taken of
+	TakenAt time.Time                           `json:"takenAt"`
+	Files   map[string]filesystem.SnapshotEntry `json:"files"`
+}
+
+// snapshotMount wraps fsys, the tree served at mount, in its snapshot. The
+// snapshot is read from cfg.SnapshotFile if the file has one for the mount;
+// otherwise it is taken now and, with a file, added to it.
+func snapshotMount(mount config.DirMount, cfg *config.Config, fsys internal.FileSystem) (internal.FileSystem, error) {
+	dir, err := filepath.Abs(mount.Dir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := readSnapshotState(cfg.SnapshotFile)
+	if err != nil {
+		return nil, err
+	}
+
+	record, ok := state.Mounts[mount.Path]
+	if ok && record.Dir != dir {
+		return nil, fmt.Errorf("snapshot file %s holds a snapshot of %s for %s, not of %s",
+			cfg.SnapshotFile, record.Dir, mount.Path, dir)
+	}
+	if !ok {
+		files, err := takeSnapshot(context.Background(), fsys, cfg.ShowHidden)
+		if err != nil {
+			return nil, fmt.Errorf("taking snapshot: %w", err)
+		}
+		record = snapshotRecord{Dir: dir, TakenAt: time.Now().UTC(), Files: files}
+		if cfg.SnapshotFile != "" {
+			state.Mounts[mount.Path] = record
+			if err := writeSnapshotState(cfg.SnapshotFile, state); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return filesystem.NewSnapshot(fsys, record.Files), nil
+}
+
+// takeSnapshot records the size, modification time and SHA-256 of every file
+// a checksum manifest of fsys would list.
+func takeSnapshot(ctx context.Context, fsys internal.FileSystem, showHidden bool) (
+	map[string]filesystem.SnapshotEntry, error,
+) {
+	b := newManifestBuilder(fsys, showHidden, nil)
+	b.maxEntries = constants.MaxSnapshotEntries
+
+	var entries []manifestEntry
+	if err := b.walk(ctx, "", "", &entries); err != nil {
+		return nil, err
+	}
+	files := make(map[string]filesystem.SnapshotEntry, len(entries))
+	for _, e := range entries {
+		digest, err := b.digest(ctx, e.path, sha256.New())
+		if err != nil {
+			return nil, fmt.Errorf("hashing %s: %w", e.path, err)
+		}
+		files[e.path] = filesystem.SnapshotEntry{Size: e.size, ModTime: e.modTime, Digest: digest}
+	}
+	return files, nil
+}
+
+// readSnapshotState reads the snapshot file, which may not exist yet. An
+// empty name reads nothing.
+func readSnapshotState(name string) (snapshotState, error) {
+	state := snapshotState{Mounts: make(map[string]snapshotRecord)}
+	if name == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(name) // #nosec G304 - path from --snapshot-file
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("reading snapshot file %s: %w", name, err)
+	}
+	if state.Mounts == nil {
+		state.Mounts = make(map[string]snapshotRecord)
+	}
+	return state, nil
+}
+
+// writeSnapshotState replaces the snapshot file with state.
+func writeSnapshotState(name string, state snapshotState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing snapshot file: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writing snapshot file: %w", err)
+	}
+	return nil
+}
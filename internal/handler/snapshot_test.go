@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+)
+
+func TestSnapshotMount(t *testing.T) {
+	root := t.TempDir()
+	writeDiffTree(t, root, map[string]string{"docs/a.txt": "aaaa", "docs/b.txt": "bb"})
+	cfg := &config.Config{
+		Theme:        "advanced",
+		MaxHashSize:  1 << 20,
+		Snapshot:     true,
+		SnapshotFile: filepath.Join(t.TempDir(), "snapshot.json"),
+	}
+	mount := config.DirMount{Path: "/", Dir: root}
+	serve := func() http.Handler {
+		t.Helper()
+		fs, err := NewMountFS(mount, cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewAdvancedFile(fs, cfg)
+	}
+	h := serve()
+
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(filepath.Join(root, "docs", "b.txt"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "docs", "b.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	writeDiffTree(t, root, map[string]string{"docs/c.txt": "new", "added/d.txt": "new"})
+
+	// A restart reads the snapshot file instead of taking a new snapshot
+	for name, h := range map[string]http.Handler{"running": h, "restarted": serve()} {
+		t.Run(name, func(t *testing.T) {
+			if rr := getPath(h, "/docs/a.txt", nil); rr.Code != http.StatusOK || rr.Body.String() != "aaaa" {
+				t.Errorf("Expected the unchanged file, got %d %q", rr.Code, rr.Body.String())
+			}
+			rr := getPath(h, "/docs/b.txt", nil)
+			if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "drifted") {
+				t.Errorf("Expected 503 for the drifted file, got %d %q", rr.Code, rr.Body.String())
+			}
+			for _, target := range []string{"/docs/c.txt", "/added/", "/added/d.txt"} {
+				if rr := getPath(h, target, nil); rr.Code != http.StatusNotFound {
+					t.Errorf("%s: expected files added later to be hidden, got %d", target, rr.Code)
+				}
+			}
+			listing := getPath(h, "/docs/", http.Header{"Accept": {"application/json"}}).Body.String()
+			if !strings.Contains(listing, "a.txt") || strings.Contains(listing, "c.txt") {
+				t.Errorf("Expected the listing to hide c.txt, got %s", listing)
+			}
+		})
+	}
+
+	state, err := readSnapshotState(cfg.SnapshotFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("aaaa"))
+	if got := state.Mounts["/"].Files["docs/a.txt"]; got.Size != 4 || got.Digest != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected snapshot entry %+v", got)
+	}
+}
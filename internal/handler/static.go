@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/handler/templates"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+const staticAssetPrefix = "/static/theme."
+
+// staticAsset is an embedded advanced theme asset. It is served at a
+// content-hashed URL (/static/theme.<hash>.css) that can be cached forever,
+// and at the legacy unversioned URL for pages rendered by older versions.
+type staticAsset struct {
+	ext         string
+	contentType string
+	body        []byte
+	hash        string
+	etag        string
+}
+
+func newStaticAsset(ext, contentType, body string) *staticAsset {
+	sum := sha256.Sum256([]byte(body))
+	hash := hex.EncodeToString(sum[:6])
+	return &staticAsset{
+		ext:         ext,
+		contentType: contentType,
+		body:        []byte(body),
+		hash:        hash,
+		etag:        `"` + hash + `"`,
+	}
+}
+
+// URL returns the versioned URL of the current asset content.
+func (a *staticAsset) URL() string {
+	return staticAssetPrefix + a.hash + "." + a.ext
+}
+
+var (
+	themeCSS = newStaticAsset("css", "text/css; charset=utf-8", templates.AdvancedCSS)
+	themeJS  = newStaticAsset("js", "application/javascript; charset=utf-8", templates.AdvancedJS)
+
+	staticAssets = map[string]*staticAsset{themeCSS.ext: themeCSS, themeJS.ext: themeJS}
+)
+
+// isStaticAssetPath reports whether urlPath names a theme asset.
+func isStaticAssetPath(urlPath string) bool {
+	return strings.HasPrefix(urlPath, staticAssetPrefix)
+}
+
+// serveStaticAsset serves /static/theme[.<hash>].css|js. Only the current
+// hash is cached as immutable; other hashes redirect to it so pages from a
+// previous release pick up the new assets, and the unversioned paths are
+// revalidated on every use.
+func serveStaticAsset(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, staticAssetPrefix)
+	hash, ext, versioned := strings.Cut(name, ".")
+	if !versioned {
+		ext, hash = name, ""
+	}
+	asset, ok := staticAssets[ext]
+	if !ok || strings.Contains(hash, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case !versioned:
+		w.Header().Set("Cache-Control", "no-cache")
+	case hash == asset.hash:
+		w.Header().Set("Cache-Control",
+			fmt.Sprintf("public, max-age=%d, immutable", constants.VersionedAssetCacheMaxAge))
+	default:
+		http.Redirect(w, r, middleware.BasePathFromContext(r.Context())+asset.URL(), http.StatusFound)
+		return
+	}
+
+	serveBytes(w, r, asset.body, asset.etag, asset.contentType)
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/handler/templates"
+)
+
+func TestStaticAsset_VersionedURLInHTML(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), &config.Config{Theme: "advanced"})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, url := range []string{themeCSS.URL(), themeJS.URL()} {
+		if !strings.Contains(body, `"`+url+`"`) {
+			t.Errorf("expected rendered HTML to reference %s", url)
+		}
+	}
+	if !regexp.MustCompile(`^/static/theme\.[0-9a-f]{12}\.css$`).MatchString(themeCSS.URL()) {
+		t.Errorf("unexpected versioned URL %s", themeCSS.URL())
+	}
+	if strings.Contains(body, `"/static/theme.css"`) {
+		t.Error("rendered HTML should not use the unversioned URL")
+	}
+}
+
+func TestStaticAsset_Serving(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	cfg := &config.Config{Theme: "advanced", Dirs: []config.DirMount{{Path: "/docs", Dir: root}}}
+	handlers := map[string]http.Handler{
+		"advanced":  NewAdvancedFile(filesystem.NewLocal(root, false), cfg),
+		"multi_dir": NewMultiDir(cfg.Dirs, cfg, slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantCache    string
+		wantBody     string
+		wantLocation string
+	}{
+		{
+			name:       "current css hash",
+			path:       themeCSS.URL(),
+			wantStatus: http.StatusOK,
+			wantCache:  "immutable",
+			wantBody:   templates.AdvancedCSS,
+		},
+		{
+			name:       "current js hash",
+			path:       themeJS.URL(),
+			wantStatus: http.StatusOK,
+			wantCache:  "immutable",
+			wantBody:   templates.AdvancedJS,
+		},
+		{
+			name:         "stale hash redirects",
+			path:         "/static/theme.0123456789ab.js",
+			wantStatus:   http.StatusFound,
+			wantLocation: themeJS.URL(),
+		},
+		{
+			name:       "legacy path",
+			path:       "/static/theme.css",
+			wantStatus: http.StatusOK,
+			wantCache:  "no-cache",
+			wantBody:   templates.AdvancedCSS,
+		},
+		{name: "unknown asset", path: "/static/theme.png", wantStatus: http.StatusNotFound},
+	}
+
+	for name, h := range handlers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+				if rr.Code != tt.wantStatus {
+					t.Fatalf("expected %d, got %d", tt.wantStatus, rr.Code)
+				}
+				if tt.wantLocation != "" && rr.Header().Get("Location") != tt.wantLocation {
+					t.Errorf("expected redirect to %s, got %s", tt.wantLocation, rr.Header().Get("Location"))
+				}
+				if !strings.Contains(rr.Header().Get("Cache-Control"), tt.wantCache) {
+					t.Errorf("expected Cache-Control containing %q, got %q", tt.wantCache, rr.Header().Get("Cache-Control"))
+				}
+				if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+					t.Error("unexpected asset body")
+				}
+			})
+		}
+	}
+
+	// Revalidation of the current asset returns 304
+	req := httptest.NewRequest(http.MethodGet, themeCSS.URL(), nil)
+	req.Header.Set("If-None-Match", themeCSS.etag)
+	rr := httptest.NewRecorder()
+	handlers["advanced"].ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+}
@@ -24,6 +24,15 @@ var AdvancedJS string
 //go:embed themes/advanced.html
 var AdvancedHTML string
 
+// IconsSVG is a sprite with a symbol "icon-<kind>" per fileutil.FileKind,
+// inlined into listings so that icons need neither requests nor scripts.
+//
+//go:embed icons.svg
+var IconsSVG string
+
+// IconSprite is IconsSVG for inclusion in a template.
+var IconSprite = template.HTML(IconsSVG) // #nosec G203 - embedded at build time
+
 func GetThemeCSS(theme string) string {
 	switch theme {
 	case "advanced":
@@ -3,6 +3,8 @@ package templates
 import (
 	"strings"
 	"testing"
+
+	"github.com/samzong/gofs/pkg/fileutil"
 )
 
 func TestGetThemeCSS(t *testing.T) {
@@ -309,3 +311,11 @@ func BenchmarkGetThemeCSS_Unknown(b *testing.B) {
 		GetThemeCSS("nonexistent")
 	}
 }
+
+func TestIconsSVG_SymbolPerKind(t *testing.T) {
+	for _, kind := range fileutil.FileKinds {
+		if !strings.Contains(IconsSVG, `<symbol id="icon-`+string(kind)+`"`) {
+			t.Errorf("Expected a symbol for %s", kind)
+		}
+	}
+}
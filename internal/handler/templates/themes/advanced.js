@@ -12,7 +12,15 @@
         csrfToken: null,
         selectedFiles: new Set(),
         isSelectionMode: false,
-        lastSelectedIndex: -1
+        lastSelectedIndex: -1,
+        // Set while the selection is exactly the entries matching a pattern,
+        // so bulk and ZIP requests send the pattern instead of the paths
+        selectionGlob: null,
+        capabilities: null,
+        tree: null,
+        // EventSource of GET /api/events for the listed directory
+        events: null,
+        eventsPath: null
     };
     const elements = {
         html: document.documentElement,
@@ -34,9 +42,18 @@
         previewTitle: document.getElementById('previewTitle'),
         previewBody: document.getElementById('previewBody'),
         previewClose: document.getElementById('previewClose'),
-        newFolderBtn: document.getElementById('newFolderBtn')
+        newFolderBtn: document.getElementById('newFolderBtn'),
+        breadcrumb: document.querySelector('#breadcrumb .breadcrumb-content'),
+        emptyState: document.getElementById('emptyState'),
+        shareToggle: document.getElementById('shareToggle'),
+        sharePopover: document.getElementById('sharePopover'),
+        shareQR: document.getElementById('shareQR'),
+        shareCaption: document.getElementById('shareCaption'),
+        pagination: document.getElementById('pagination')
     };
     function init() {
+        // Swaps the fallback forms for the scripted controls
+        elements.html.classList.add('js');
         applyTheme(state.theme);
         applyViewMode(state.viewMode);
         applyLayoutMode(state.layoutMode);
@@ -45,10 +62,66 @@
         setupKeyboardShortcuts();
         initializeSelection();
         fetchCSRFToken();
+        fetchCapabilities();
+        initTree();
+        initNavigation();
+    }
+
+    // API endpoints live under the mount, itself below any --base-url prefix
+    function apiURL(endpoint) {
+        const base = elements.fileContainer ? elements.fileContainer.dataset.base || '' : '';
+        return `${base}/api/${endpoint}`;
+    }
+
+    function fetchCapabilities() {
+        fetch(apiURL('capabilities'))
+            .then(response => response.json())
+            .then(applyCapabilities)
+            .catch(err => {
+                console.error('Failed to fetch capabilities:', err);
+            });
+    }
+
+    function applyCapabilities(caps) {
+        state.capabilities = caps;
+        const features = caps.features || {};
+        const uploadLabel = elements.uploadInput ? elements.uploadInput.closest('.upload-btn') : null;
+        if (uploadLabel) uploadLabel.style.display = features.upload ? '' : 'none';
+        if (elements.newFolderBtn) elements.newFolderBtn.style.display = features.mkdir ? '' : 'none';
+        const multiSelectBtn = document.getElementById('multiSelectBtn');
+        if (multiSelectBtn) multiSelectBtn.style.display = features.zip ? '' : 'none';
+        if (elements.searchInput) elements.searchInput.disabled = !features.search;
+        applySelectionCapabilities();
+        watchDirectory();
+    }
+
+    // Reloads the listing in place when the server reports that the listed
+    // directory changed. A selection in progress is left alone.
+    function watchDirectory() {
+        const features = state.capabilities ? state.capabilities.features || {} : {};
+        if (!features.events || !window.EventSource || !window.fetch || !elements.fileContainer) return;
+        const dir = currentDirectory().replace(/^\//, '');
+        if (state.events && state.eventsPath === dir) return;
+        if (state.events) state.events.close();
+        state.eventsPath = dir;
+        state.events = new EventSource(`${apiURL('events')}?path=${encodeURIComponent(dir)}`);
+        state.events.addEventListener('change', debounce(() => {
+            if (state.isSelectionMode || state.uploadXHR) return;
+            loadDirectory(location.href, window.scrollY, false);
+        }, 300));
+    }
+
+    function applySelectionCapabilities() {
+        const toolbar = document.getElementById('selectionToolbar');
+        if (!toolbar || !state.capabilities) return;
+        const features = state.capabilities.features || {};
+        toolbar.querySelector('.delete-selected').style.display = features.delete ? '' : 'none';
+        toolbar.querySelector('.move-selected').style.display = features.move ? '' : 'none';
+        toolbar.querySelector('.copy-selected').style.display = features.copy ? '' : 'none';
     }
 
     function fetchCSRFToken() {
-        fetch('/api/csrf')
+        fetch(apiURL('csrf'))
             .then(response => response.json())
             .then(data => {
                 state.csrfToken = data.token;
@@ -61,7 +134,7 @@
     function getCSRFToken() {
         if (!state.csrfToken) {
             const xhr = new XMLHttpRequest();
-            xhr.open('GET', '/api/csrf', false);
+            xhr.open('GET', apiURL('csrf'), false);
             xhr.send();
             if (xhr.status === 200) {
                 const data = JSON.parse(xhr.responseText);
@@ -71,6 +144,46 @@
         return state.csrfToken;
     }
 
+    // JSON error bodies carry a machine-readable code for some failures
+    function errorCode(text) {
+        try {
+            return JSON.parse(text).code || '';
+        } catch (err) {
+            return '';
+        }
+    }
+
+    function isCSRFFailure(status, text) {
+        return status === 403 && errorCode(text) === 'CSRF_INVALID';
+    }
+
+    // The server marks listings of read-only mounts so mutating controls
+    // stay hidden before capabilities arrive
+    function isReadonly() {
+        return document.body.dataset.readonly === 'true';
+    }
+
+    // Tokens are single-use and expire, so a request refused with
+    // CSRF_INVALID is retried once with a freshly fetched token
+    function postJSON(endpoint, payload, retried) {
+        return fetch(apiURL(endpoint), {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': getCSRFToken() || ''
+            },
+            body: JSON.stringify(payload)
+        })
+        .then(response => {
+            if (response.status !== 403 || retried) return response;
+            return response.clone().text().then(text => {
+                if (!isCSRFFailure(response.status, text)) return response;
+                state.csrfToken = null;
+                return postJSON(endpoint, payload, true);
+            });
+        });
+    }
+
     function applyTheme(theme) {
         state.theme = theme;
         elements.html.setAttribute('data-theme', theme);
@@ -166,7 +279,7 @@
         fileItems.forEach(item => {
             const name = item.dataset.name ? item.dataset.name.toLowerCase() : '';
             const matches = !query || name.includes(query);
-            item.style.display = matches ? '' : 'none';
+            (item.closest('.file-entry') || item).style.display = matches ? '' : 'none';
             if (matches) visibleCount++;
         });
         
@@ -188,10 +301,16 @@
         uploadFile(file);
     }
 
-    function uploadFile(file) {
-        const maxSize = 100 * 1024 * 1024;
+    function uploadFile(file, retried) {
+        const features = state.capabilities ? state.capabilities.features : null;
+        if (features && !features.upload) {
+            showNotification('Uploads are disabled for this folder.', 'error');
+            return;
+        }
+        const limits = state.capabilities ? state.capabilities.limits : null;
+        const maxSize = (limits && limits.maxUploadSize) || 100 * 1024 * 1024;
         if (file.size > maxSize) {
-            showNotification('File too large. Maximum size is 100MB.', 'error');
+            showNotification(`File too large. Maximum size is ${Math.round(maxSize / (1024 * 1024))}MB.`, 'error');
             return;
         }
 
@@ -230,9 +349,16 @@
         });
 
         xhr.addEventListener('load', () => {
+            if (!retried && isCSRFFailure(xhr.status, xhr.responseText)) {
+                state.csrfToken = null;
+                uploadFile(file, true);
+                return;
+            }
             if (xhr.status === 200) {
                 showNotification(`${file.name} uploaded successfully!`, 'success');
                 setTimeout(() => location.reload(), 1000);
+            } else if (errorCode(xhr.responseText) === 'READONLY_MOUNT') {
+                showNotification('This folder is read-only.', 'error');
             } else {
                 showNotification('Upload failed. Please try again.', 'error');
             }
@@ -249,7 +375,7 @@
             hideUploadProgress();
         });
 
-        xhr.open('POST', '/api/upload');
+        xhr.open('POST', apiURL('upload'));
         if (csrfToken) {
             xhr.setRequestHeader('X-CSRF-Token', csrfToken);
         }
@@ -280,6 +406,7 @@
 
         document.addEventListener('dragenter', (e) => {
             e.preventDefault();
+            if (isReadonly()) return;
             dragCounter++;
             elements.dropZone.classList.add('active');
         });
@@ -298,6 +425,7 @@
 
         document.addEventListener('drop', (e) => {
             e.preventDefault();
+            if (isReadonly()) return;
             dragCounter = 0;
             elements.dropZone.classList.remove('active');
             
@@ -346,6 +474,25 @@
         }
     }
 
+    // The share popover shows a QR code of the selected item, or of the
+    // current directory when not exactly one item is selected
+    function toggleSharePopover() {
+        if (!elements.sharePopover.hidden) {
+            hideSharePopover();
+            return;
+        }
+        const path = state.selectedFiles.size === 1 ? selectedPaths()[0] : currentDirectory();
+        elements.shareQR.src = `${apiURL('qr')}?path=${encodeURIComponent(path)}`;
+        elements.shareCaption.textContent = path.split('/').pop() || '/';
+        elements.sharePopover.hidden = false;
+        elements.shareToggle.classList.add('active');
+    }
+
+    function hideSharePopover() {
+        elements.sharePopover.hidden = true;
+        elements.shareToggle.classList.remove('active');
+    }
+
     function createNewFolder() {
         const name = prompt('Enter folder name:');
         if (!name) return;
@@ -355,22 +502,17 @@
             return;
         }
         
-        const csrfToken = getCSRFToken();
-        fetch('/api/folder', {
-            method: 'POST',
-            headers: { 
-                'Content-Type': 'application/json',
-                'X-CSRF-Token': csrfToken || ''
-            },
-            body: JSON.stringify({ path: name })
-        })
+        postJSON('folder', { path: name })
         .then(response => {
             if (response.ok) {
                 showNotification(`Folder "${name}" created successfully!`, 'success');
                 fetchCSRFToken();
                 setTimeout(() => location.reload(), 500);
             } else {
-                showNotification('Failed to create folder.', 'error');
+                response.text().then(text => {
+                    const readonly = errorCode(text) === 'READONLY_MOUNT';
+                    showNotification(readonly ? 'This folder is read-only.' : 'Failed to create folder.', 'error');
+                });
                 fetchCSRFToken();
             }
         })
@@ -419,6 +561,7 @@
     
     function handleSelectionChange(item, isSelected, index, isShiftKey) {
         const path = item.getAttribute('href') || item.dataset.path;
+        state.selectionGlob = null;
         
         if (isShiftKey && state.lastSelectedIndex !== -1) {
             const start = Math.min(state.lastSelectedIndex, index);
@@ -467,6 +610,7 @@
                 cb.checked = false;
             });
             if (multiSelectBtn) multiSelectBtn.classList.remove('active');
+            elements.fileContainer.querySelector('.file-item.focused')?.classList.remove('focused');
             clearSelection();
             hideSelectionToolbar();
         }
@@ -475,6 +619,7 @@
     function clearSelection() {
         state.selectedFiles.clear();
         state.lastSelectedIndex = -1;
+        state.selectionGlob = null;
         const selectedItems = elements.fileContainer.querySelectorAll('.file-item.selected');
         selectedItems.forEach(item => {
             item.classList.remove('selected');
@@ -485,6 +630,7 @@
     }
     
     function selectAll() {
+        state.selectionGlob = null;
         const fileItems = elements.fileContainer.querySelectorAll('.file-item:not(.file-item-parent)');
         fileItems.forEach(item => {
             const checkbox = item.querySelector('.file-checkbox');
@@ -497,6 +643,70 @@
         });
         updateSelectionUI();
     }
+
+    // selectByPattern asks the server for the entries of the current
+    // directory matching a pattern such as *.log and selects them
+    function selectByPattern() {
+        const glob = prompt('Select files matching:', state.selectionGlob || '*.');
+        if (!glob) return;
+        const params = new URLSearchParams({ path: currentDirectory() || '/', glob: glob });
+        fetch(`${apiURL('select')}?${params}`)
+        .then(response => response.json().then(data => {
+            if (!response.ok) throw new Error(data.error || `HTTP ${response.status}`);
+            return data;
+        }))
+        .then(data => {
+            clearSelection();
+            const matched = new Set(data.paths);
+            elements.fileContainer.querySelectorAll('.file-item:not(.file-item-parent)').forEach(item => {
+                const href = item.getAttribute('href') || item.dataset.path;
+                if (!matched.has(itemPath(href))) return;
+                const checkbox = item.querySelector('.file-checkbox');
+                if (checkbox) checkbox.checked = true;
+                item.classList.add('selected');
+                state.selectedFiles.add(href);
+            });
+            if (data.truncated) {
+                const shown = data.paths.length;
+                showNotification(`More than ${shown} files match ${glob}, only the first ${shown} are selected`, 'info');
+            } else {
+                state.selectionGlob = glob;
+                if (data.paths.length === 0) showNotification(`No files match ${glob}`, 'info');
+            }
+            updateSelectionUI();
+        })
+        .catch(err => showNotification(`Failed to select ${glob}: ${err.message}`, 'error'));
+    }
+
+    // moveFocus moves the keyboard focus between the items of the listing,
+    // extending the selection over the items passed when extend is set
+    function moveFocus(delta, extend) {
+        const fileItems = Array.from(elements.fileContainer.querySelectorAll('.file-item:not(.file-item-parent)'))
+            .filter(item => item.offsetParent !== null);
+        if (fileItems.length === 0) return;
+        const current = fileItems.findIndex(item => item.classList.contains('focused'));
+        const next = current === -1 ? 0 : Math.min(Math.max(current + delta, 0), fileItems.length - 1);
+        if (current !== -1) fileItems[current].classList.remove('focused');
+        const item = fileItems[next];
+        item.classList.add('focused');
+        item.scrollIntoView({ block: 'nearest' });
+        if (extend) {
+            if (current !== -1) setItemSelected(fileItems[current], true);
+            setItemSelected(item, true);
+        }
+    }
+
+    function setItemSelected(item, selected) {
+        const checkbox = item.querySelector('.file-checkbox');
+        if (!checkbox || checkbox.checked === selected) return;
+        checkbox.checked = selected;
+        handleSelectionChange(item, selected, Number(item.dataset.index), false);
+    }
+
+    function toggleFocusedItem() {
+        const item = elements.fileContainer.querySelector('.file-item.focused');
+        if (item) setItemSelected(item, !item.classList.contains('selected'));
+    }
     
     function updateSelectionUI() {
         const toolbar = document.getElementById('selectionToolbar');
@@ -508,10 +718,9 @@
                     count === 1 ? '1 file selected' : `${count} files selected`;
             }
             
-            const downloadBtn = toolbar.querySelector('.download-selected');
-            if (downloadBtn) {
-                downloadBtn.disabled = count === 0;
-            }
+            toolbar.querySelectorAll('.download-selected, .bulk-action').forEach(btn => {
+                btn.disabled = count === 0;
+            });
         }
     }
     
@@ -542,12 +751,24 @@
                 <button class="btn-small select-all" style="background: rgba(255,255,255,0.2); border: none; color: white; padding: 6px 12px; border-radius: 4px; cursor: pointer;">
                     Select All
                 </button>
+                <button class="btn-small select-pattern" style="background: rgba(255,255,255,0.2); border: none; color: white; padding: 6px 12px; border-radius: 4px; cursor: pointer;">
+                    Select by pattern…
+                </button>
                 <button class="btn-small clear-selection" style="background: rgba(255,255,255,0.2); border: none; color: white; padding: 6px 12px; border-radius: 4px; cursor: pointer;">
                     Clear
                 </button>
                 <button class="btn-small download-selected" style="background: white; border: none; color: var(--color-primary); padding: 6px 16px; border-radius: 4px; cursor: pointer; font-weight: 600;" disabled>
                     Download as ZIP
                 </button>
+                <button class="btn-small bulk-action copy-selected" style="background: rgba(255,255,255,0.2); border: none; color: white; padding: 6px 12px; border-radius: 4px; cursor: pointer; display: none;" disabled>
+                    Copy to…
+                </button>
+                <button class="btn-small bulk-action move-selected" style="background: rgba(255,255,255,0.2); border: none; color: white; padding: 6px 12px; border-radius: 4px; cursor: pointer; display: none;" disabled>
+                    Move to…
+                </button>
+                <button class="btn-small bulk-action delete-selected" style="background: #dc2626; border: none; color: white; padding: 6px 12px; border-radius: 4px; cursor: pointer; display: none;" disabled>
+                    Delete
+                </button>
                 <button class="btn-small close-selection" style="background: transparent; border: none; color: white; padding: 6px; cursor: pointer; font-size: 20px;">
                     ×
                 </button>
@@ -556,8 +777,13 @@
             document.body.appendChild(toolbar);
             
             toolbar.querySelector('.select-all').addEventListener('click', selectAll);
+            toolbar.querySelector('.select-pattern').addEventListener('click', selectByPattern);
             toolbar.querySelector('.clear-selection').addEventListener('click', clearSelection);
             toolbar.querySelector('.download-selected').addEventListener('click', downloadSelectedAsZip);
+            toolbar.querySelector('.copy-selected').addEventListener('click', () => transferSelected('copy'));
+            toolbar.querySelector('.move-selected').addEventListener('click', () => transferSelected('move'));
+            toolbar.querySelector('.delete-selected').addEventListener('click', deleteSelected);
+            applySelectionCapabilities();
             toolbar.querySelector('.close-selection').addEventListener('click', toggleSelectionMode);
         }
         
@@ -575,6 +801,16 @@
         if (state.selectedFiles.size === 0) return;
         
         const paths = Array.from(state.selectedFiles);
+
+        if (state.selectionGlob) {
+            const params = new URLSearchParams({
+                path: currentDirectory() || '/',
+                glob: state.selectionGlob,
+                name: `download_${Date.now()}.zip`
+            });
+            window.location.href = `${apiURL('zip')}?${params}`;
+            return;
+        }
         
         if (paths.length === 1) {
             const link = document.querySelector(`.file-item[href="${paths[0]}"]`);
@@ -582,26 +818,20 @@
                 window.location.href = paths[0];
                 return;
             }
+            if (link) {
+                // A plain GET lets the browser resume the download when the server caches archives
+                window.location.href = `${apiURL('zip')}?path=${encodeURIComponent(selectedPaths()[0])}`;
+                return;
+            }
         }
         
-        const csrfToken = getCSRFToken();
         const zipName = paths.length === 1 ? 
             paths[0].split('/').pop() + '.zip' : 
             `download_${Date.now()}.zip`;
         
         showNotification('Preparing ZIP download...', 'info');
         
-        fetch('/api/zip', {
-            method: 'POST',
-            headers: {
-                'Content-Type': 'application/json',
-                'X-CSRF-Token': csrfToken || ''
-            },
-            body: JSON.stringify({
-                paths: paths,
-                name: zipName
-            })
-        })
+        postJSON('zip', { paths: paths, name: zipName })
         .then(response => {
             if (!response.ok) {
                 throw new Error('Failed to create ZIP');
@@ -628,6 +858,78 @@
         });
     }
     
+    // formatChildCount renders the childCount of a folder the way the
+    // server-rendered listing does
+    function formatChildCount(file) {
+        if (typeof file.childCount !== 'number') return 'Folder';
+        if (file.childCountTruncated) return `${file.childCount}+ items`;
+        return file.childCount === 1 ? '1 item' : `${file.childCount} items`;
+    }
+
+    function currentDirectory() {
+        return (elements.fileContainer.dataset.path || '/').replace(/\/+$/, '');
+    }
+
+    function selectedPaths() {
+        return Array.from(state.selectedFiles).map(itemPath);
+    }
+
+    // itemPath turns the href of a listing item into its path in the mount
+    function itemPath(href) {
+        const name = decodeURIComponent(href.replace(/^\.\//, '').replace(/\/$/, ''));
+        return `${currentDirectory()}/${name}`;
+    }
+
+    function deleteSelected() {
+        const count = state.selectedFiles.size;
+        if (count === 0) return;
+        const label = count === 1 ? '1 item' : `${count} items`;
+        if (!confirm(`Delete ${label}? This cannot be undone.`)) return;
+        runBulkOperation('delete', {});
+    }
+
+    function transferSelected(operation) {
+        if (state.selectedFiles.size === 0) return;
+        const verb = operation === 'move' ? 'Move' : 'Copy';
+        const destination = prompt(`${verb} to folder:`, currentDirectory() || '/');
+        if (destination === null) return;
+        runBulkOperation(operation, { destination: destination });
+    }
+
+    function runBulkOperation(operation, extra) {
+        const selection = state.selectionGlob ?
+            { path: currentDirectory() || '/', glob: state.selectionGlob } :
+            { paths: selectedPaths() };
+        postJSON(operation, Object.assign(selection, extra))
+        .then(response => {
+            if (!response.ok) {
+                return response.json()
+                    .catch(() => ({}))
+                    .then(data => { throw new Error(data.error || `HTTP ${response.status}`); });
+            }
+            return response.json();
+        })
+        .then(data => {
+            const failures = data.results.filter(result => !result.ok);
+            if (failures.length === 0) {
+                showNotification(`${operation} finished for ${data.succeeded} item(s)`, 'success');
+            } else {
+                failures.forEach(result => console.warn(`${operation} failed for ${result.path}: ${result.error}`));
+                const first = failures[0];
+                const name = first.path.split('/').pop();
+                showNotification(`${data.failed} of ${data.results.length} failed (${name}: ${first.error})`, 'error');
+            }
+            fetchCSRFToken();
+            if (data.succeeded > 0) {
+                setTimeout(() => location.reload(), failures.length === 0 ? 500 : 2500);
+            }
+        })
+        .catch(err => {
+            showNotification(`Failed to ${operation} selection: ${err.message}`, 'error');
+            fetchCSRFToken();
+        });
+    }
+
     function setupKeyboardShortcuts() {
         document.addEventListener('keydown', (e) => {
             if ((e.ctrlKey || e.metaKey) && e.key === 'f') {
@@ -660,8 +962,27 @@
                 downloadSelectedAsZip();
             }
             
+            const typing = e.target.closest && e.target.closest('input, textarea, select, [contenteditable]');
+            if (state.isSelectionMode && !typing && !e.ctrlKey && !e.metaKey && !e.altKey) {
+                if (e.key === 'a') {
+                    e.preventDefault();
+                    selectAll();
+                } else if (e.key === 'ArrowDown' || e.key === 'ArrowRight') {
+                    e.preventDefault();
+                    moveFocus(1, e.shiftKey);
+                } else if (e.key === 'ArrowUp' || e.key === 'ArrowLeft') {
+                    e.preventDefault();
+                    moveFocus(-1, e.shiftKey);
+                } else if (e.key === ' ') {
+                    e.preventDefault();
+                    toggleFocusedItem();
+                }
+            }
+            
             if (e.key === 'Escape') {
-                if (elements.previewModal.style.display !== 'none') {
+                if (!elements.sharePopover.hidden) {
+                    hideSharePopover();
+                } else if (elements.previewModal.style.display !== 'none') {
                     elements.previewModal.style.display = 'none';
                 } else if (state.isSelectionMode) {
                     toggleSelectionMode();
@@ -690,12 +1011,24 @@
                 previewFile(e);
             }
         });
+
+        elements.fileContainer?.addEventListener('click', (e) => {
+            const button = e.target.closest('.file-copy-link');
+            if (button) copyLink(button.dataset.url);
+        });
         
         elements.previewClose?.addEventListener('click', () => {
             elements.previewModal.style.display = 'none';
         });
         
         elements.newFolderBtn?.addEventListener('click', createNewFolder);
+
+        elements.shareToggle?.addEventListener('click', toggleSharePopover);
+        document.addEventListener('click', (e) => {
+            if (!elements.sharePopover.hidden && !e.target.closest('#sharePopover, #shareToggle')) {
+                hideSharePopover();
+            }
+        });
         
         const multiSelectBtn = document.getElementById('multiSelectBtn');
         multiSelectBtn?.addEventListener('click', toggleSelectionMode);
@@ -729,6 +1062,19 @@
         return div.innerHTML;
     }
 
+    // Copies the absolute form of url, which the server sends as a path. Without
+    // the Clipboard API (plain HTTP off localhost) the link is shown instead.
+    function copyLink(url) {
+        const link = new URL(url, location.href).href;
+        if (!navigator.clipboard) {
+            window.prompt('Copy this link', link);
+            return;
+        }
+        navigator.clipboard.writeText(link)
+            .then(() => showNotification('Link copied', 'success'))
+            .catch(() => window.prompt('Copy this link', link));
+    }
+
     function showNotification(message, type = 'info') {
         const colors = {
             success: '#059669',
@@ -760,6 +1106,368 @@
         }, 3000);
     }
 
+    const TREE_STORAGE_KEY = 'gofs.tree.expanded';
+    const TREE_COLLAPSED_KEY = 'gofs.tree.collapsed';
+
+    function initTree() {
+        const sidebar = document.getElementById('treeSidebar');
+        if (!sidebar) return;
+
+        const tree = state.tree = {
+            sidebar: sidebar,
+            root: document.getElementById('treeRoot'),
+            base: sidebar.dataset.base || '',
+            current: (sidebar.dataset.current || '/').replace(/^\/+|\/+$/g, ''),
+            expanded: new Set(loadExpandedPaths())
+        };
+
+        // Ancestors of the current directory are always expanded
+        const parts = tree.current ? tree.current.split('/') : [];
+        for (let i = 1; i < parts.length; i++) {
+            tree.expanded.add(parts.slice(0, i).join('/'));
+        }
+
+        const toggle = document.getElementById('treeToggle');
+        const container = sidebar.parentElement;
+        if (sessionStorage.getItem(TREE_COLLAPSED_KEY) === 'true') {
+            container.classList.add('tree-collapsed');
+        }
+        if (toggle) {
+            toggle.addEventListener('click', () => {
+                const collapsed = container.classList.toggle('tree-collapsed');
+                sessionStorage.setItem(TREE_COLLAPSED_KEY, String(collapsed));
+                toggle.title = collapsed ? 'Expand Folders' : 'Collapse Folders';
+            });
+        }
+
+        loadTreeLevel(tree, '', tree.root);
+    }
+
+    function loadExpandedPaths() {
+        try {
+            const paths = JSON.parse(sessionStorage.getItem(TREE_STORAGE_KEY) || '[]');
+            return Array.isArray(paths) ? paths : [];
+        } catch (err) {
+            return [];
+        }
+    }
+
+    function saveExpandedPaths(tree) {
+        sessionStorage.setItem(TREE_STORAGE_KEY, JSON.stringify(Array.from(tree.expanded)));
+    }
+
+    function loadTreeLevel(tree, path, list) {
+        const url = `${tree.base}/api/dirs?depth=1&path=${encodeURIComponent(path)}`;
+        return fetch(url)
+            .then(response => {
+                if (!response.ok) throw new Error(`HTTP ${response.status}`);
+                return response.json();
+            })
+            .then(data => {
+                list.innerHTML = '';
+                (data.dirs || []).forEach(dir => list.appendChild(createTreeNode(tree, dir)));
+                return data.dirs || [];
+            })
+            .catch(err => {
+                console.error('Failed to load folders:', err);
+                return [];
+            });
+    }
+
+    function createTreeNode(tree, dir) {
+        const node = document.createElement('li');
+        node.className = 'tree-node';
+        node.setAttribute('role', 'treeitem');
+        node.dataset.path = dir.path;
+
+        const row = document.createElement('div');
+        row.className = 'tree-row';
+
+        const expander = document.createElement('button');
+        expander.className = 'tree-expander';
+        expander.type = 'button';
+        expander.textContent = '\u203A';
+        expander.setAttribute('aria-label', `Expand ${dir.name}`);
+
+        const link = document.createElement('a');
+        link.className = 'tree-link';
+        link.href = `${tree.base}/${dir.path.split('/').map(encodeURIComponent).join('/')}/`;
+        link.textContent = dir.name;
+        link.title = dir.name;
+
+        const children = document.createElement('ul');
+        children.className = 'tree-list';
+        children.setAttribute('role', 'group');
+        children.hidden = true;
+
+        row.appendChild(expander);
+        row.appendChild(link);
+        node.appendChild(row);
+        node.appendChild(children);
+
+        if (dir.path === tree.current) {
+            node.classList.add('active');
+            link.setAttribute('aria-current', 'page');
+        }
+
+        expander.addEventListener('click', () => toggleTreeNode(tree, node, children, expander));
+        if (tree.expanded.has(dir.path)) {
+            toggleTreeNode(tree, node, children, expander);
+        }
+        return node;
+    }
+
+    function toggleTreeNode(tree, node, children, expander) {
+        const path = node.dataset.path;
+        if (node.classList.contains('expanded')) {
+            node.classList.remove('expanded');
+            children.hidden = true;
+            tree.expanded.delete(path);
+            saveExpandedPaths(tree);
+            return;
+        }
+
+        node.classList.add('expanded');
+        children.hidden = false;
+        tree.expanded.add(path);
+        saveExpandedPaths(tree);
+
+        if (node.dataset.loaded) return;
+        node.dataset.loaded = 'true';
+        loadTreeLevel(tree, path, children).then(dirs => {
+            if (dirs.length === 0) expander.classList.add('empty');
+        });
+    }
+
+    // Kinds with a symbol in the sprite the page embeds; see icons.svg
+    const FILE_KINDS = ['folder', 'image', 'video', 'archive', 'code', 'document', 'file'];
+    const DOWNLOAD_ICON = '<svg width="16" height="16" viewBox="0 0 24 24" fill="none" stroke="currentColor">' +
+        '<path d="M21 15v4a2 2 0 01-2 2H5a2 2 0 01-2-2v-4"/><polyline points="7 10 12 15 17 10"/>' +
+        '<line x1="12" y1="15" x2="12" y2="3"/></svg>';
+    const LINK_ICON = '<svg width="16" height="16" viewBox="0 0 24 24" fill="none" stroke="currentColor">' +
+        '<path d="M10 13a5 5 0 007.54.54l3-3a5 5 0 00-7.07-7.07l-1.72 1.71"/>' +
+        '<path d="M14 11a5 5 0 00-7.54-.54l-3 3a5 5 0 007.07 7.07l1.71-1.71"/></svg>';
+    const PARENT_ICON = '<svg width="48" height="48" viewBox="0 0 24 24" fill="none" stroke="currentColor">' +
+        '<path d="M22 19a2 2 0 01-2 2H4a2 2 0 01-2-2V5a2 2 0 012-2h5l2 3h9a2 2 0 012 2z"/>' +
+        '<polyline points="14 11 9 16 14 21"/></svg>';
+
+    // Directory links load their listing from the JSON API and swap it in,
+    // keeping the URL in sync with pushState. Without JS the links are
+    // ordinary page loads.
+    function initNavigation() {
+        if (!window.history || !history.pushState || !window.fetch) return;
+        history.replaceState({ gofs: true, scrollY: window.scrollY }, '', location.href);
+        document.addEventListener('click', handleNavigationClick);
+        window.addEventListener('popstate', (e) => {
+            if (!e.state || !e.state.gofs) return;
+            loadDirectory(location.href, e.state.scrollY || 0, false);
+        });
+    }
+
+    function handleNavigationClick(e) {
+        // Selection mode and modified clicks (new tab, preview) keep their own behaviour
+        if (e.defaultPrevented || e.button !== 0 || e.ctrlKey || e.metaKey || e.shiftKey || e.altKey) return;
+        const link = e.target.closest('a');
+        if (!link || !link.matches('.file-item[data-type="folder"], .file-item-parent, .breadcrumb-item, .tree-link')) return;
+        const url = new URL(link.href, location.href);
+        if (url.origin !== location.origin) return;
+        e.preventDefault();
+        history.replaceState({ gofs: true, scrollY: window.scrollY }, '', location.href);
+        loadDirectory(url.href, 0, true);
+    }
+
+    function loadDirectory(url, scrollY, push) {
+        return fetch(url, { headers: { 'Accept': 'application/json' }, cache: 'no-store' })
+            .then(response => {
+                if (!response.ok) throw new Error(`HTTP ${response.status}`);
+                return response.json();
+            })
+            .then(data => {
+                if (push) history.pushState({ gofs: true, scrollY: 0 }, '', url);
+                renderDirectory(data);
+                window.scrollTo(0, scrollY);
+            })
+            .catch(err => {
+                console.error('Failed to load directory, falling back to a full page load:', err);
+                if (push) {
+                    location.assign(url);
+                } else {
+                    location.reload();
+                }
+            });
+    }
+
+    function renderDirectory(data) {
+        const crumbs = data.breadcrumbs || [];
+        const dirPath = crumbs.length > 0 ? crumbs[crumbs.length - 1].path : '/';
+
+        if (state.isSelectionMode) toggleSelectionMode();
+        clearSelection();
+
+        // The server orders the files for the sort and order of the URL
+        const files = data.files || [];
+
+        const container = elements.fileContainer;
+        container.textContent = '';
+        container.dataset.path = dirPath;
+        if (crumbs.length > 0) container.appendChild(createParentItem());
+        files.forEach(file => container.appendChild(createFileItem(file)));
+        if (elements.emptyState) elements.emptyState.hidden = files.length > 0;
+
+        renderBreadcrumbs(container.dataset.base || '', crumbs);
+        renderPagination(data.page || 0, data.pages || 0);
+        document.title = `${dirPath} - GoFS`;
+        initializeSelection();
+        handleSearch();
+        updateTreeCurrent(dirPath);
+        watchDirectory();
+    }
+
+    // Mirrors the server-rendered page links; they keep the other query
+    // parameters of the current URL, as the server's do.
+    function renderPagination(page, pages) {
+        const nav = elements.pagination;
+        if (!nav) return;
+        nav.textContent = '';
+        nav.hidden = pages === 0;
+        if (pages === 0) return;
+        const pageLink = (n, rel, text) => {
+            const params = new URLSearchParams(location.search);
+            params.set('page', String(n));
+            const link = document.createElement('a');
+            link.href = `?${params}`;
+            link.rel = rel;
+            link.textContent = text;
+            nav.appendChild(link);
+        };
+        if (page > 1) pageLink(Math.min(page - 1, pages), 'prev', 'Previous');
+        const label = document.createElement('span');
+        label.textContent = `Page ${page} of ${pages}`;
+        nav.appendChild(label);
+        if (page < pages) pageLink(page + 1, 'next', 'Next');
+    }
+
+    function createParentItem() {
+        const link = document.createElement('a');
+        link.href = '../';
+        link.className = 'file-item file-item-parent';
+        link.innerHTML = `<div class="file-icon">${PARENT_ICON}</div>` +
+            '<div class="file-info"><div class="file-name">..</div>' +
+            '<div class="file-meta">Parent Directory</div></div>';
+        return link;
+    }
+
+    function kindIcon(file) {
+        const kind = FILE_KINDS.includes(file.kind) ? file.kind : (file.isDir ? 'folder' : 'file');
+        return `<svg class="icon icon-${kind}" width="48" height="48" fill="none" stroke="currentColor">` +
+            `<use href="#icon-${kind}"/></svg>`;
+    }
+
+    function createFileItem(file) {
+        const link = document.createElement('a');
+        link.href = `./${encodeURIComponent(file.name)}${file.isDir ? '/' : ''}`;
+        link.className = 'file-item';
+        link.dataset.name = file.name;
+        link.dataset.size = String(file.size);
+        link.dataset.type = file.isDir ? 'folder' : 'file';
+
+        const icon = document.createElement('div');
+        icon.className = 'file-icon';
+        icon.innerHTML = kindIcon(file);
+
+        const info = document.createElement('div');
+        info.className = 'file-info';
+        const name = document.createElement('div');
+        name.className = 'file-name';
+        name.title = file.name;
+        name.textContent = file.name;
+        const meta = document.createElement('div');
+        meta.className = 'file-meta';
+        meta.textContent = (file.isDir ? formatChildCount(file) : formatSize(file.size)) + ' ';
+        const date = document.createElement('span');
+        date.className = 'file-date';
+        date.textContent = new Date(file.modTime)
+            .toLocaleDateString('en-US', { month: 'short', day: '2-digit', year: 'numeric' });
+        meta.appendChild(date);
+        info.appendChild(name);
+        info.appendChild(meta);
+
+        link.appendChild(icon);
+        link.appendChild(info);
+
+        const entry = document.createElement('div');
+        entry.className = 'file-entry';
+        entry.appendChild(link);
+        if (!file.isDir) {
+            const copy = document.createElement('button');
+            copy.type = 'button';
+            copy.className = 'file-copy-link';
+            copy.dataset.url = file.url;
+            copy.title = 'Copy link';
+            copy.setAttribute('aria-label', `Copy link to ${file.name}`);
+            copy.innerHTML = LINK_ICON;
+            entry.appendChild(copy);
+
+            const download = document.createElement('a');
+            download.href = `./${encodeURIComponent(file.name)}?download=1`;
+            download.className = 'file-download';
+            download.download = '';
+            download.title = 'Download';
+            download.setAttribute('aria-label', `Download ${file.name}`);
+            download.innerHTML = DOWNLOAD_ICON;
+            entry.appendChild(download);
+        }
+        return entry;
+    }
+
+    function renderBreadcrumbs(base, crumbs) {
+        const content = elements.breadcrumb;
+        if (!content) return;
+        const home = content.querySelector('.breadcrumb-home');
+        while (content.lastChild && content.lastChild !== home) {
+            content.removeChild(content.lastChild);
+        }
+        crumbs.forEach(crumb => {
+            const separator = document.createElement('span');
+            separator.className = 'breadcrumb-separator';
+            separator.textContent = '/';
+            const link = document.createElement('a');
+            link.className = 'breadcrumb-item';
+            link.href = `${base}${crumb.path.split('/').map(encodeURIComponent).join('/')}/`;
+            link.textContent = crumb.name;
+            content.appendChild(separator);
+            content.appendChild(link);
+        });
+    }
+
+    function updateTreeCurrent(dirPath) {
+        const tree = state.tree;
+        if (!tree) return;
+        tree.current = dirPath.replace(/^\/+|\/+$/g, '');
+        tree.root.querySelectorAll('.tree-node.active').forEach(node => {
+            node.classList.remove('active');
+            node.querySelector('.tree-link').removeAttribute('aria-current');
+        });
+        tree.root.querySelectorAll('.tree-node').forEach(node => {
+            if (node.dataset.path !== tree.current) return;
+            node.classList.add('active');
+            node.querySelector('.tree-link').setAttribute('aria-current', 'page');
+        });
+    }
+
+    function formatSize(size) {
+        if (size === 0) return '0 B';
+        if (size < 1024) return `${size.toFixed(1)} B`;
+        const units = ['KB', 'MB', 'GB', 'TB', 'PB'];
+        let value = size / 1024;
+        let unit = 0;
+        while (value >= 1024 && unit < units.length - 1) {
+            value /= 1024;
+            unit++;
+        }
+        return `${value.toFixed(1)} ${units[unit]}`;
+    }
+
     if (document.readyState === 'loading') {
         document.addEventListener('DOMContentLoaded', init);
     } else {
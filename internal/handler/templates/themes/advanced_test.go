@@ -2,6 +2,7 @@ package themes
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -411,3 +412,25 @@ func BenchmarkBreadcrumbItem_Creation(b *testing.B) {
 		}
 	}
 }
+
+func TestAdvancedJS_SoftNavigation(t *testing.T) {
+	for _, hook := range []string{
+		"history.pushState",
+		"'popstate'",
+		"'Accept': 'application/json'",
+		"data.breadcrumbs",
+	} {
+		if !strings.Contains(AdvancedJS, hook) {
+			t.Errorf("advanced.js missing %s", hook)
+		}
+	}
+}
+
+func TestAdvancedJS_APIURLsFollowBase(t *testing.T) {
+	// Absolute /api/ URLs would bypass the mount and any --base-url prefix
+	for _, absolute := range []string{"'/api/", "`/api/", `"/api/`} {
+		if strings.Contains(AdvancedJS, absolute) {
+			t.Errorf("advanced.js hard-codes %s...; use apiURL", absolute)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/listing"
+	"github.com/samzong/gofs/internal/tracing"
+)
+
+// readListing is listing.Read, traced as an "fs.ReadDir" span of the
+// request in ctx. The root of the mount at "/" also lists the other mounts.
+func readListing(ctx context.Context, fs internal.FileSystem, dir string,
+	opts listing.Options,
+) (*listing.DirectoryListing, error) {
+	if dir == "" {
+		opts.Overlay = mountPointsFrom(ctx)
+	}
+	_, span := tracing.Start(ctx, "fs.ReadDir")
+	defer span.End()
+	span.SetAttr("gofs.path", "/"+dir)
+	l, err := listing.Read(fs, dir, opts)
+	span.RecordError(err)
+	if err == nil {
+		span.SetAttr("gofs.entries", len(l.Entries))
+	}
+	return l, err
+}
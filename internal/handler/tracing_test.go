@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/tracing"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestAdvancedFile_TraceSpans(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, filepath.Join(root, "docs"), "a.txt")
+	if err := os.WriteFile(filepath.Join(root, "docs", "b.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	h := tracing.Middleware(tracing.New(exporter))(
+		NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", MaxHashSize: 1 << 20}))
+
+	tests := []struct {
+		target   string
+		children []string // In the order they end
+	}{
+		{"/docs/", []string{"fs.ReadDir"}},
+		{"/docs/b.txt", []string{"fs.Open", "hash"}},
+		{"/api/zip?path=/docs", []string{"zip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			before := len(exporter.GetSpans())
+			if rr := getPath(h, tt.target, nil); rr.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			spans := exporter.GetSpans()[before:]
+			if len(spans) != len(tt.children)+1 {
+				t.Fatalf("Expected %d spans, got %+v", len(tt.children)+1, spans)
+			}
+			request := spans[len(spans)-1]
+			if request.Name != http.MethodGet || request.SpanKind != trace.SpanKindServer {
+				t.Errorf("Expected the request span last, got %+v", request)
+			}
+			for i, name := range tt.children {
+				if spans[i].Name != name || spans[i].Parent.SpanID() != request.SpanContext.SpanID() ||
+					spans[i].Parent.TraceID() != request.SpanContext.TraceID() {
+					t.Errorf("Expected %s as a child of the request, got %+v", name, spans[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// DirNode is a directory in the sidebar tree. Children are only filled in
+// up to the requested depth.
+type DirNode struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"` // Slash-separated path within the mount, without a leading slash
+	Children []DirNode `json:"children,omitempty"`
+}
+
+// DirsResponse is returned by GET /api/dirs.
+type DirsResponse struct {
+	Path      string    `json:"path"`
+	Dirs      []DirNode `json:"dirs"`
+	Truncated bool      `json:"truncated,omitempty"` // MaxTreeEntries was reached
+}
+
+var errTreeEntryLimit = errors.New("tree entry limit reached")
+
+// handleDirs serves GET /api/dirs?path=...&depth=1, listing only the
+// subdirectories of path so the sidebar can expand nodes lazily.
+func (h *AdvancedFile) handleDirs(w http.ResponseWriter, r *http.Request) {
+	if !h.config.EnableTree {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	depth := 1
+	if v := r.URL.Query().Get("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			middleware.WriteJSONError(w, "Invalid depth", http.StatusBadRequest)
+			return
+		}
+		depth = min(n, constants.MaxTreeDepth)
+	}
+
+	dir, err := pathsafe.Clean(r.URL.Query().Get("path"))
+	if err != nil {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	info, err := h.fs.Stat(dir)
+	if err != nil {
+		var apiErr *internal.APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			middleware.WriteJSONError(w, "Not found", http.StatusNotFound)
+			return
+		}
+		h.reporter().JSONError(w, r, "Cannot read directory", http.StatusInternalServerError, err)
+		return
+	}
+	if !info.IsDir() {
+		middleware.WriteJSONError(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	remaining := constants.MaxTreeEntries
+	nodes, err := h.listDirs(dir, depth, &remaining)
+	response := DirsResponse{Path: dir, Dirs: nodes}
+	if errors.Is(err, errTreeEntryLimit) {
+		response.Truncated = true
+	} else if err != nil {
+		h.reporter().JSONError(w, r, "Cannot read directory", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := middleware.WriteJSON(w, response); err != nil {
+		h.logger.Warn("Failed to write dirs response",
+			slog.String("path", dir),
+			slog.String("error", err.Error()))
+	}
+}
+
+// listDirs returns the subdirectories of dir down to depth levels, counting
+// every node against remaining. When the limit is hit it returns the nodes
+// collected so far with errTreeEntryLimit.
+func (h *AdvancedFile) listDirs(dir string, depth int, remaining *int) ([]DirNode, error) {
+	entries, err := h.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
+	})
+
+	nodes := []DirNode{}
+	for _, entry := range entries {
+		if !entry.IsDir() || (!h.config.ShowHidden && fileutil.IsHiddenPath(path.Join(dir, entry.Name()))) {
+			continue
+		}
+		if *remaining == 0 {
+			return nodes, errTreeEntryLimit
+		}
+		*remaining--
+
+		node := DirNode{Name: entry.Name(), Path: path.Join(dir, entry.Name())}
+		if depth > 1 {
+			children, err := h.listDirs(node.Path, depth-1, remaining)
+			node.Children = children
+			if err != nil {
+				nodes = append(nodes, node)
+				return nodes, err
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func newTreeTestDir(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for _, dir := range []string{"beta/inner/deep", "Alpha", ".hidden", "gamma"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	return root
+}
+
+func fetchDirs(t *testing.T, h http.Handler, target string) (*httptest.ResponseRecorder, DirsResponse) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+	var resp DirsResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+	}
+	return rr, resp
+}
+
+func TestAdvancedFile_Dirs(t *testing.T) {
+	root := newTreeTestDir(t)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", EnableTree: true})
+
+	rr, resp := fetchDirs(t, h, "/api/dirs")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var names []string
+	for _, d := range resp.Dirs {
+		names = append(names, d.Name)
+		if d.Children != nil {
+			t.Errorf("depth 1 must not include children of %s", d.Name)
+		}
+	}
+	if got := strings.Join(names, ","); got != "Alpha,beta,gamma" {
+		t.Errorf("expected sorted dirs without files or hidden entries, got %s", got)
+	}
+
+	_, resp = fetchDirs(t, h, "/api/dirs?path=beta&depth=2")
+	if resp.Path != "beta" || len(resp.Dirs) != 1 || resp.Dirs[0].Path != "beta/inner" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if children := resp.Dirs[0].Children; len(children) != 1 || children[0].Path != "beta/inner/deep" {
+		t.Errorf("expected beta/inner/deep as child, got %+v", children)
+	}
+
+	// Depth is clamped rather than rejected
+	rr, _ = fetchDirs(t, h, fmt.Sprintf("/api/dirs?depth=%d", constants.MaxTreeDepth+10))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 for large depth, got %d", rr.Code)
+	}
+}
+
+func TestAdvancedFile_DirsErrors(t *testing.T) {
+	root := newTreeTestDir(t)
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", EnableTree: true})
+
+	testCases := []struct {
+		target string
+		status int
+	}{
+		{"/api/dirs?depth=0", http.StatusBadRequest},
+		{"/api/dirs?depth=abc", http.StatusBadRequest},
+		{"/api/dirs?path=../etc", http.StatusBadRequest},
+		{"/api/dirs?path=file.txt", http.StatusBadRequest},
+		{"/api/dirs?path=missing", http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		if rr, _ := fetchDirs(t, h, tc.target); rr.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.target, tc.status, rr.Code)
+		}
+	}
+
+	disabled := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	if rr, _ := fetchDirs(t, disabled, "/api/dirs"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 with the tree disabled, got %d", rr.Code)
+	}
+}
+
+func TestAdvancedFile_DirsEntryLimit(t *testing.T) {
+	root := t.TempDir()
+	for i := range constants.MaxTreeEntries + 5 {
+		if err := os.Mkdir(filepath.Join(root, fmt.Sprintf("d%04d", i)), 0o755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced", EnableTree: true})
+
+	_, resp := fetchDirs(t, h, "/api/dirs")
+	if !resp.Truncated || len(resp.Dirs) != constants.MaxTreeEntries {
+		t.Errorf("expected %d dirs and truncated, got %d (truncated=%v)",
+			constants.MaxTreeEntries, len(resp.Dirs), resp.Truncated)
+	}
+}
+
+func TestMultiDir_TreeSidebar(t *testing.T) {
+	root := newTreeTestDir(t)
+	mounts := []config.DirMount{{Path: "/files", Dir: root, Name: "Files"}}
+
+	for _, enabled := range []bool{true, false} {
+		cfg := &config.Config{Theme: "advanced", EnableTree: enabled}
+		m := NewMultiDir(mounts, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/files/beta/", nil))
+		body := rr.Body.String()
+		rendered := strings.Contains(body, `id="treeSidebar"`) && strings.Contains(body, `id="treeRoot"`)
+		if rendered != enabled {
+			t.Errorf("EnableTree=%v: sidebar rendered=%v", enabled, rendered)
+		}
+		if enabled && !strings.Contains(body, `data-base="/files"`) {
+			t.Error("sidebar should carry the mount path for API requests")
+		}
+
+		rr, resp := fetchDirs(t, m, "/files/api/dirs?path=beta")
+		if !enabled {
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("expected 404 with the tree disabled, got %d", rr.Code)
+			}
+			continue
+		}
+		if len(resp.Dirs) != 1 || resp.Dirs[0].Path != "beta/inner" {
+			t.Errorf("expected mount-relative paths, got %+v", resp.Dirs)
+		}
+	}
+}
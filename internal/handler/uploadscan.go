@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+)
+
+// maxScanMessage bounds how much of a scanner's stderr or response body is
+// passed on to the client.
+const maxScanMessage = 1024
+
+// UploadNameHeader carries the percent-encoded path of the upload within
+// its mount to --upload-scan-url.
+const UploadNameHeader = "X-Upload-Name"
+
+// errScanFailed is returned when the scanner could not give a verdict: it
+// did not start, timed out or answered with a server error. Uploads are
+// refused then, never stored unscanned.
+var errScanFailed = errors.New("upload scan failed")
+
+// scanRejectedError is returned when the scanner rejected an upload.
+type scanRejectedError struct {
+	message string // What the scanner said, for the client
+}
+
+func (e *scanRejectedError) Error() string {
+	return "upload rejected by scanner: " + e.message
+}
+
+// uploadScanner checks an upload once its data is complete, before it is
+// renamed into place.
+type uploadScanner interface {
+	// scan checks the file tmpName of fsys that is about to be stored as
+	// filename. It returns a *scanRejectedError or an error wrapping
+	// errScanFailed.
+	scan(ctx context.Context, fsys internal.FileSystem, tmpName, filename string) error
+}
+
+// newUploadScanner returns the scanner configured by --upload-scan-cmd or
+// --upload-scan-url, or nil if there is none.
+func newUploadScanner(cfg *config.Config) uploadScanner {
+	timeout := cfg.UploadScanTimeout
+	if timeout <= 0 {
+		timeout = constants.DefaultUploadScanTimeout
+	}
+	switch {
+	case cfg.UploadScanCmd != "":
+		return &commandScanner{args: strings.Fields(cfg.UploadScanCmd), timeout: timeout}
+	case cfg.UploadScanURL != "":
+		return &httpScanner{url: cfg.UploadScanURL, client: &http.Client{}, timeout: timeout}
+	}
+	return nil
+}
+
+// commandScanner runs a command with the path of the upload as its last
+// argument. Exit status 0 accepts the upload; any other rejects it with the
+// command's stderr as the reason.
+type commandScanner struct {
+	args    []string
+	timeout time.Duration
+}
+
+func (s *commandScanner) scan(ctx context.Context, fsys internal.FileSystem, tmpName, _ string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	name, cleanup, err := localPath(fsys, tmpName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errScanFailed, err)
+	}
+	defer cleanup()
+
+	stderr := &cappedBuffer{limit: maxScanMessage}
+	// #nosec G204 - the command is the operator's --upload-scan-cmd
+	cmd := exec.CommandContext(ctx, s.args[0], append(s.args[1:], name)...)
+	cmd.Stderr = stderr
+	// A scanner that leaves children holding stderr open cannot wedge the upload
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: no answer within %s", errScanFailed, s.timeout)
+	case errors.As(err, &exitErr):
+		return &scanRejectedError{message: scanMessage(stderr.String())}
+	case err != nil:
+		return fmt.Errorf("%w: %w", errScanFailed, err)
+	}
+	return nil
+}
+
+// httpScanner POSTs the upload to a URL. A 2xx answer accepts it and a 4xx
+// rejects it with the response body as the reason; anything else is a
+// failed scan.
+type httpScanner struct {
+	url     string
+	client  *http.Client
+	timeout time.Duration
+}
+
+func (s *httpScanner) scan(ctx context.Context, fsys internal.FileSystem, tmpName, filename string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	file, err := fsys.Open(tmpName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errScanFailed, err)
+	}
+	defer file.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, file)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errScanFailed, err)
+	}
+	if info, err := fsys.Stat(tmpName); err == nil {
+		req.ContentLength = info.Size()
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(UploadNameHeader, (&url.URL{Path: "/" + strings.TrimPrefix(filename, "/")}).EscapedPath())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: no answer within %s", errScanFailed, s.timeout)
+		}
+		return fmt.Errorf("%w: %w", errScanFailed, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxScanMessage))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &scanRejectedError{message: scanMessage(string(body))}
+	}
+	return fmt.Errorf("%w: scanner answered %s", errScanFailed, resp.Status)
+}
+
+// localPath returns a path on the local disk holding the file name of fsys:
+// the file itself when fsys keeps it on disk, a temporary copy otherwise.
+// cleanup removes the copy.
+func localPath(fsys internal.FileSystem, name string) (path string, cleanup func(), err error) {
+	file, err := internal.OpenSeeker(fsys, name)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	if osFile, ok := file.(internal.OSFile); ok {
+		if path, err := filepath.Abs(osFile.File().Name()); err == nil {
+			return path, func() {}, nil
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "gofs-scan-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { _ = os.Remove(tmp.Name()) }
+	_, err = io.Copy(tmp, file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// scanMessage turns a scanner's output into a one-line reason.
+func scanMessage(output string) string {
+	message := strings.Join(strings.Fields(output), " ")
+	if message == "" {
+		return "rejected by the upload scanner"
+	}
+	return message
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the
+// rest, so a chatty scanner cannot fill memory.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
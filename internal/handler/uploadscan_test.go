@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// scanScript writes a shell script that scans the file given as its last
+// argument and returns its path.
+func scanScript(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("scanner stubs are shell scripts")
+	}
+	script := filepath.Join(t.TempDir(), "scan.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+// assertScanResult uploads "hello world" through h and checks the status,
+// the error message and that no file but an accepted one is left behind.
+func assertScanResult(t *testing.T, h *AdvancedFile, dir string, wantStatus int, wantMessage string) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, newUploadRequest(t, h, "hello world", nil))
+	if rr.Code != wantStatus {
+		t.Fatalf("Expected %d, got %d: %s", wantStatus, rr.Code, rr.Body.String())
+	}
+	if wantMessage != "" {
+		var resp struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || !strings.Contains(resp.Error, wantMessage) {
+			t.Errorf("Expected an error containing %q, got %s", wantMessage, rr.Body.String())
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if wantStatus == http.StatusOK {
+		if len(names) != 1 || names[0] != "hello.txt" {
+			t.Errorf("Expected only hello.txt to be stored, got %v", names)
+		}
+	} else if len(names) != 0 {
+		t.Errorf("Expected the rejected upload to be removed, got %v", names)
+	}
+}
+
+func TestAdvancedFile_UploadScanCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		script      string
+		timeout     time.Duration
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:       "clean file is stored",
+			script:     `grep -q "hello world" "$1"`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "rejection quotes stderr",
+			script:      `echo "Eicar-Test-Signature FOUND" >&2; exit 1`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantMessage: "Eicar-Test-Signature FOUND",
+		},
+		{
+			name:       "hung scanner times out",
+			script:     `sleep 10`,
+			timeout:    100 * time.Millisecond,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{
+				MaxHashSize:       1 << 20,
+				Theme:             "advanced",
+				UploadScanCmd:     scanScript(t, tt.script),
+				UploadScanTimeout: tt.timeout,
+			}
+			h := NewAdvancedFile(filesystem.NewLocal(dir, false), cfg)
+
+			start := time.Now()
+			assertScanResult(t, h, dir, tt.wantStatus, tt.wantMessage)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Scan took %s, the timeout was not enforced", elapsed)
+			}
+		})
+	}
+}
+
+func TestAdvancedFile_UploadScanURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		respond     func(w http.ResponseWriter, r *http.Request, body string)
+		timeout     time.Duration
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:       "2xx accepts",
+			respond:    func(w http.ResponseWriter, _ *http.Request, _ string) { w.WriteHeader(http.StatusNoContent) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "4xx rejects with the body",
+			respond: func(w http.ResponseWriter, _ *http.Request, body string) {
+				if body == "hello world" {
+					http.Error(w, "file type not allowed", http.StatusForbidden)
+				}
+			},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantMessage: "file type not allowed",
+		},
+		{
+			name:       "5xx refuses the upload",
+			respond:    func(w http.ResponseWriter, _ *http.Request, _ string) { w.WriteHeader(http.StatusBadGateway) },
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "hung scanner times out",
+			respond:    func(_ http.ResponseWriter, r *http.Request, _ string) { <-r.Context().Done() },
+			timeout:    100 * time.Millisecond,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := make(chan string, 1)
+			scanner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				names <- r.Header.Get(UploadNameHeader)
+				tt.respond(w, r, string(body))
+			}))
+			defer scanner.Close()
+
+			dir := t.TempDir()
+			cfg := &config.Config{
+				MaxHashSize:       1 << 20,
+				Theme:             "advanced",
+				UploadScanURL:     scanner.URL,
+				UploadScanTimeout: tt.timeout,
+			}
+			h := NewAdvancedFile(filesystem.NewLocal(dir, false), cfg)
+			assertScanResult(t, h, dir, tt.wantStatus, tt.wantMessage)
+			if got := <-names; got != "/hello.txt" {
+				t.Errorf("Expected %s /hello.txt, got %q", UploadNameHeader, got)
+			}
+		})
+	}
+}
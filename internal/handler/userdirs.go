@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// With --user-upload-dirs, uploads and new folders land in a directory of
+// their own per authenticated user, incoming/<user>/ at the mount root,
+// while everything stays listed and readable to all. Requests without a
+// user, possible when authentication is off, share the anonymous directory.
+const (
+	userUploadRoot = "incoming"
+	anonymousUser  = "anonymous"
+)
+
+// userUploadDir returns the directory the uploads of r go to.
+func userUploadDir(r *http.Request) string {
+	user := middleware.Username(r)
+	if user == "" {
+		user = anonymousUser
+	}
+	// Usernames are not paths: keep them to a single safe segment
+	user = strings.Map(func(c rune) rune {
+		if c == '/' || c == '\\' || c < 0x20 {
+			return '_'
+		}
+		return c
+	}, user)
+	if user == "." || user == ".." {
+		user = anonymousUser
+	}
+	return path.Join(userUploadRoot, user)
+}
+
+// uploadDestination returns where name is written for r. With per-user
+// upload directories, names outside the user's directory are placed in it,
+// and the parents of the destination are created. It writes the error
+// response and returns false if they cannot be.
+func (h *AdvancedFile) uploadDestination(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	if !h.config.UserUploadDirs {
+		return name, true
+	}
+	dir := userUploadDir(r)
+	if name != dir && !strings.HasPrefix(name, dir+"/") {
+		name = path.Join(dir, name)
+	}
+	if err := mkdirAll(h.fs, path.Dir(name)); err != nil {
+		if errors.Is(err, filesystem.ErrReadonly) {
+			writeReadonly(w, r)
+			return "", false
+		}
+		h.reporter().JSONError(w, r, "Cannot create upload directory", http.StatusInternalServerError, err)
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// asUser serves requests to h as if BasicAuth had authenticated user.
+func asUser(h http.Handler, user string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user != "" {
+			r = r.WithContext(middleware.WithUsername(r.Context(), user))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func uploadAs(t *testing.T, h *AdvancedFile, user, name, content string) UploadResponse {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte(content))
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	rr := httptest.NewRecorder()
+	asUser(h, user).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("upload as %q: expected 200, got %d: %s", user, rr.Code, rr.Body.String())
+	}
+	var resp UploadResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestUserUploadDirs(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false),
+		&config.Config{Theme: "advanced", MaxHashSize: 1 << 20, UserUploadDirs: true})
+
+	alice := uploadAs(t, h, "alice", "notes.txt", "from alice")
+	bob := uploadAs(t, h, "bob", "notes.txt", "from bob")
+	if alice.File != "incoming/alice/notes.txt" || alice.URL != "/incoming/alice/notes.txt" {
+		t.Errorf("unexpected response for alice %+v", alice)
+	}
+	if bob.File != "incoming/bob/notes.txt" {
+		t.Errorf("unexpected response for bob %+v", bob)
+	}
+	for user, want := range map[string]string{"alice": "from alice", "bob": "from bob"} {
+		data, err := os.ReadFile(filepath.Join(root, "incoming", user, "notes.txt"))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: expected %q, got %q, %v", user, want, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "notes.txt")); !os.IsNotExist(err) {
+		t.Error("expected nothing to be stored at the root")
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		if resp := uploadAs(t, h, "", "a.txt", "a"); resp.File != "incoming/anonymous/a.txt" {
+			t.Errorf("expected the anonymous directory, got %s", resp.File)
+		}
+		if resp := uploadAs(t, h, "../x", "a.txt", "a"); resp.File != "incoming/.._x/a.txt" {
+			t.Errorf("expected the username to stay one segment, got %s", resp.File)
+		}
+	})
+
+	t.Run("folder", func(t *testing.T) {
+		tests := []struct {
+			user, path, want string
+		}{
+			{"carol", "photos", "incoming/carol/photos"},
+			{"alice", "incoming/alice/photos", "incoming/alice/photos"},
+			// Another user's directory is not theirs to write to
+			{"bob", "incoming/alice/more", "incoming/bob/incoming/alice/more"},
+		}
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodPost, "/api/folder", strings.NewReader(`{"path":"`+tt.path+`"}`))
+			req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+			rr := httptest.NewRecorder()
+			asUser(h, tt.user).ServeHTTP(rr, req)
+			var resp FolderResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+				t.Fatalf("%s %s: expected 200, got %d: %s", tt.user, tt.path, rr.Code, rr.Body.String())
+			}
+			if resp.Folder != tt.want {
+				t.Errorf("%s %s: expected %s, got %s", tt.user, tt.path, tt.want, resp.Folder)
+			}
+			if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(tt.want))); err != nil || !info.IsDir() {
+				t.Errorf("expected %s to be created: %v", tt.want, err)
+			}
+		}
+	})
+
+	t.Run("form", func(t *testing.T) {
+		_, token := formPage(t, h, "/")
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/?form=folder",
+			strings.NewReader(url.Values{"csrf_token": {token}, "name": {"drafts"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		asUser(h, "alice").ServeHTTP(rr, req)
+		assertFormRedirect(t, rr, "/incoming/alice/?flash=folder&name=drafts")
+		if info, err := os.Stat(filepath.Join(root, "incoming", "alice", "drafts")); err != nil || !info.IsDir() {
+			t.Errorf("expected incoming/alice/drafts to be created: %v", err)
+		}
+	})
+
+	t.Run("rest", func(t *testing.T) {
+		rest := NewAdvancedFile(filesystem.NewLocal(root, false),
+			&config.Config{Theme: "advanced", UserUploadDirs: true, EnableRESTWrite: true})
+		if rr := curl(t, asUser(rest, "dave"), http.MethodPut, "/put.txt", strings.NewReader("put")); rr.Code !=
+			http.StatusCreated || rr.Header().Get("Location") != "/incoming/dave/put.txt" {
+			t.Errorf("PUT: expected 201 in dave's directory, got %d %s", rr.Code, rr.Body.String())
+		}
+		if rr := curl(t, asUser(rest, "dave"), http.MethodPut, "/made/", nil); rr.Code != http.StatusCreated {
+			t.Errorf("PUT directory: expected 201, got %d %s", rr.Code, rr.Body.String())
+		}
+		for _, name := range []string{"put.txt", "made"} {
+			if _, err := os.Stat(filepath.Join(root, "incoming", "dave", name)); err != nil {
+				t.Errorf("expected %s in dave's directory: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		asUser(h, "bob").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/incoming/", nil))
+		for _, user := range []string{"alice", "bob"} {
+			if !strings.Contains(rr.Body.String(), `href="./`+user+`/"`) {
+				t.Errorf("expected %s's directory in the shared listing", user)
+			}
+		}
+	})
+}
+
+func TestUserUploadDirs_BasicAuth(t *testing.T) {
+	root := t.TempDir()
+	h := NewAdvancedFile(filesystem.NewLocal(root, false),
+		&config.Config{Theme: "advanced", MaxHashSize: 1 << 20, UserUploadDirs: true})
+	auth, err := middleware.NewBasicAuth("gofs", "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "a.txt")
+	_, _ = fw.Write([]byte("a"))
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("alice:secret")))
+	rr := httptest.NewRecorder()
+	auth.Middleware(h).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "incoming", "alice", "a.txt")); err != nil {
+		t.Errorf("expected the upload in alice's directory: %v", err)
+	}
+}
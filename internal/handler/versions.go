@@ -0,0 +1,354 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// versionLayout names kept versions after the UTC time they were replaced.
+// It sorts chronologically and is safe in file names on every platform.
+const versionLayout = "20060102T150405.000000000Z"
+
+// VersionStore keeps the previous contents of files that uploads replace, as
+// <dir>/<path within the mount>/<timestamp>. dir lies outside every served
+// directory, so versions never show up in listings. Each file keeps at most
+// maxCount versions, none older than maxAge; a zero value lifts that limit.
+type VersionStore struct {
+	dir      string
+	maxCount int
+	maxAge   time.Duration
+	logger   *slog.Logger
+	mu       *sync.Mutex // shared by scopes; serializes naming and pruning
+}
+
+// FileVersion is one kept version of a file.
+type FileVersion struct {
+	Timestamp string    `json:"ts"`      // Identifies the version to GET /api/versions/download
+	Time      time.Time `json:"time"`    // When the version was replaced
+	ModTime   time.Time `json:"modTime"` // Modification time the file had then
+	Size      int64     `json:"size"`
+}
+
+// VersionsResponse lists the kept versions of a file, newest first.
+type VersionsResponse struct {
+	Path     string        `json:"path"`
+	Versions []FileVersion `json:"versions"`
+}
+
+// NewVersionStore keeps versions in dir, creating it if needed.
+func NewVersionStore(dir string, maxCount int, maxAge time.Duration, logger *slog.Logger) (*VersionStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating versions directory %s: %w", dir, err)
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &VersionStore{dir: dir, maxCount: maxCount, maxAge: maxAge, logger: logger, mu: &sync.Mutex{}}, nil
+}
+
+// Scope returns the store for one mount of a multi-directory server. Its
+// versions are kept below a directory named after the escaped mount path, so
+// nested mounts cannot collide.
+func (s *VersionStore) Scope(mountPath string) *VersionStore {
+	scoped := *s
+	scoped.dir = filepath.Join(s.dir, url.PathEscape(mountPath))
+	return &scoped
+}
+
+// Save copies the current contents of name on fsys into the store before an
+// upload replaces it. It does nothing if name is not an existing file.
+func (s *VersionStore) Save(fsys internal.FileSystem, name string) error {
+	info, err := fsys.Stat(name)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	src, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", name, err)
+	}
+	defer src.Close()
+
+	tmp, err := s.createTemp(name)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(tmp.Name())
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("copying %q: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Two replacements within the same nanosecond still get distinct names
+	now := time.Now().UTC()
+	target := filepath.Join(dir, now.Format(versionLayout))
+	for {
+		if _, err := os.Lstat(target); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		now = now.Add(time.Nanosecond)
+		target = filepath.Join(dir, now.Format(versionLayout))
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("keeping version of %q: %w", name, err)
+	}
+	s.pruneDir(dir, now)
+	return nil
+}
+
+// createTemp creates the file a version of name is copied into. It holds
+// s.mu so Prune cannot remove the directory before the file is in it.
+func (s *VersionStore) createTemp(name string) (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.fileDir(name)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating version directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".version-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("creating version: %w", err)
+	}
+	return tmp, nil
+}
+
+// List returns the kept versions of name, newest first.
+func (s *VersionStore) List(name string) ([]FileVersion, error) {
+	entries, err := os.ReadDir(s.fileDir(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []FileVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []FileVersion{}
+	for _, entry := range entries {
+		replaced, ok := parseVersionName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, FileVersion{
+			Timestamp: entry.Name(),
+			Time:      replaced,
+			ModTime:   info.ModTime(),
+			Size:      info.Size(),
+		})
+	}
+	slices.SortFunc(versions, func(a, b FileVersion) int { return b.Time.Compare(a.Time) })
+	return versions, nil
+}
+
+// Open opens the version of name identified by ts.
+func (s *VersionStore) Open(name, ts string) (*os.File, FileVersion, error) {
+	replaced, ok := parseVersionName(ts)
+	if !ok {
+		return nil, FileVersion{}, fs.ErrNotExist
+	}
+	file, err := os.Open(filepath.Join(s.fileDir(name), ts))
+	if err != nil {
+		return nil, FileVersion{}, err
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return nil, FileVersion{}, fs.ErrNotExist
+	}
+	return file, FileVersion{Timestamp: ts, Time: replaced, ModTime: info.ModTime(), Size: info.Size()}, nil
+}
+
+// Run prunes the whole store on every interval until ctx is done, removing
+// versions that outlived maxAge even for files that are never uploaded again.
+func (s *VersionStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if removed := s.Prune(time.Now()); removed > 0 {
+			s.logger.Info("Pruned file versions", slog.Int("removed", removed))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune applies the retention limits to every file in the store as of now
+// and returns how many versions were removed.
+func (s *VersionStore) Prune(now time.Time) int {
+	var dirs []string
+	_ = filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	// Deepest first, so directories emptied by pruning can be removed too
+	for _, dir := range slices.Backward(dirs) {
+		removed += s.pruneDir(dir, now)
+		if dir != s.dir {
+			_ = os.Remove(dir) // Only succeeds when empty
+		}
+	}
+	return removed
+}
+
+// pruneDir removes the versions in dir beyond maxCount or older than maxAge.
+// The caller holds s.mu.
+func (s *VersionStore) pruneDir(dir string, now time.Time) int {
+	if s.maxCount <= 0 && s.maxAge <= 0 {
+		return 0
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	var versions []string
+	for _, entry := range entries {
+		if _, ok := parseVersionName(entry.Name()); ok && entry.Type().IsRegular() {
+			versions = append(versions, entry.Name())
+		}
+	}
+	// Names sort chronologically, newest last
+	slices.Sort(versions)
+
+	removed := 0
+	for i, name := range versions {
+		replaced, _ := parseVersionName(name)
+		tooMany := s.maxCount > 0 && len(versions)-i > s.maxCount
+		tooOld := s.maxAge > 0 && now.Sub(replaced) > s.maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			s.logger.Warn("Failed to prune file version",
+				slog.String("version", filepath.Join(dir, name)),
+				slog.String("error", err.Error()))
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+func (s *VersionStore) fileDir(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+// parseVersionName reports whether name is a version written by Save and
+// returns when it was replaced. Only the canonical spelling is accepted.
+func parseVersionName(name string) (time.Time, bool) {
+	t, err := time.Parse(versionLayout, name)
+	if err != nil || t.Format(versionLayout) != name {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// SetVersions keeps the previous contents of files replaced by uploads in
+// store and serves them through /api/versions.
+func (h *AdvancedFile) SetVersions(store *VersionStore) {
+	h.versions = store
+}
+
+// versionedFile validates the path query parameter of the /api/versions
+// endpoints. It writes the error response and returns false if the request
+// cannot be served.
+func (h *AdvancedFile) versionedFile(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+	if h.versions == nil {
+		middleware.WriteJSONError(w, "File versions are not enabled", http.StatusNotFound)
+		return "", false
+	}
+	name, err := pathsafe.Clean(r.URL.Query().Get("path"))
+	if err != nil || name == "" {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return "", false
+	}
+	// Versions outlive the file, so access is checked on its directory,
+	// which also applies .gofs.yaml rules
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+	if info, err := h.fs.Stat(dir); err != nil || !info.IsDir() {
+		h.reporter().JSONError(w, r, "File not found", http.StatusNotFound, err)
+		return "", false
+	}
+	return name, true
+}
+
+// handleVersions serves GET /api/versions?path=..., the kept versions of a
+// file.
+func (h *AdvancedFile) handleVersions(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.versionedFile(w, r)
+	if !ok {
+		return
+	}
+	versions, err := h.versions.List(name)
+	if err != nil {
+		h.reporter().JSONError(w, r, "Cannot list versions", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := middleware.WriteJSON(w, VersionsResponse{Path: name, Versions: versions}); err != nil {
+		h.logger.Warn("Failed to write versions response", slog.String("error", err.Error()))
+	}
+}
+
+// handleVersionDownload serves GET /api/versions/download?path=...&ts=...,
+// one kept version of a file as an attachment.
+func (h *AdvancedFile) handleVersionDownload(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.versionedFile(w, r)
+	if !ok {
+		return
+	}
+	file, version, err := h.versions.Open(name, r.URL.Query().Get("ts"))
+	if err != nil {
+		h.reporter().JSONError(w, r, "Version not found", http.StatusNotFound, err)
+		return
+	}
+	defer file.Close()
+
+	mimeType, _ := detectContentType(h.config, name, file)
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(name)))
+	http.ServeContent(w, r, "", version.ModTime, file)
+}
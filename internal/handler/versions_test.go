@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+func newVersionedHandler(t *testing.T, maxCount int, maxAge time.Duration) (*AdvancedFile, *VersionStore, string) {
+	t.Helper()
+	root := t.TempDir()
+	store, err := NewVersionStore(t.TempDir(), maxCount, maxAge, nil)
+	if err != nil {
+		t.Fatalf("NewVersionStore: %v", err)
+	}
+	h := NewAdvancedFile(filesystem.NewLocal(root, false), &config.Config{Theme: "advanced"})
+	h.SetVersions(store)
+	return h, store, root
+}
+
+func uploadFile(t *testing.T, h *AdvancedFile, name, content string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte(content))
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-CSRF-Token", h.csrfTokens.generateToken())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("upload %s: %d %s", name, rr.Code, rr.Body.String())
+	}
+}
+
+func listVersions(t *testing.T, h *AdvancedFile, name string) VersionsResponse {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/versions?path="+url.QueryEscape(name), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /api/versions: %d %s", rr.Code, rr.Body.String())
+	}
+	var resp VersionsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return resp
+}
+
+func TestVersions_UploadKeepsReplacedFiles(t *testing.T) {
+	h, _, root := newVersionedHandler(t, 0, 0)
+
+	uploadFile(t, h, "notes.txt", "first")
+	if got := listVersions(t, h, "notes.txt"); len(got.Versions) != 0 {
+		t.Fatalf("a new file has no versions, got %+v", got.Versions)
+	}
+	uploadFile(t, h, "notes.txt", "second!")
+	uploadFile(t, h, "notes.txt", "third")
+
+	resp := listVersions(t, h, "notes.txt")
+	if resp.Path != "notes.txt" || len(resp.Versions) != 2 {
+		t.Fatalf("expected two versions, got %+v", resp)
+	}
+	newest, oldest := resp.Versions[0], resp.Versions[1]
+	if !newest.Time.After(oldest.Time) || newest.Size != 7 || oldest.Size != 5 {
+		t.Errorf("expected the newest version first with its size, got %+v", resp.Versions)
+	}
+
+	download := func(ts string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet,
+			"/api/versions/download?path=notes.txt&ts="+url.QueryEscape(ts), nil))
+		return rr
+	}
+	rr := download(oldest.Timestamp)
+	if rr.Code != http.StatusOK || rr.Body.String() != "first" {
+		t.Fatalf("expected the first upload, got %d %q", rr.Code, rr.Body.String())
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="notes.txt"` {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+	for _, ts := range []string{"", "../notes.txt", "20200101T000000Z", "20200101T000000.000000000Z"} {
+		if rr := download(ts); rr.Code != http.StatusNotFound {
+			t.Errorf("ts %q: expected 404, got %d", ts, rr.Code)
+		}
+	}
+
+	// The current file and its listing are untouched
+	if data, _ := os.ReadFile(filepath.Join(root, "notes.txt")); string(data) != "third" {
+		t.Errorf("expected the latest upload on disk, got %q", data)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Errorf("expected only notes.txt in the served directory, got %v", entries)
+	}
+}
+
+func TestVersions_Errors(t *testing.T) {
+	h, _, _ := newVersionedHandler(t, 0, 0)
+	disabled := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false), &config.Config{Theme: "advanced"})
+
+	testCases := []struct {
+		name   string
+		h      *AdvancedFile
+		target string
+		want   int
+	}{
+		{name: "disabled", h: disabled, target: "/api/versions?path=a.txt", want: http.StatusNotFound},
+		{name: "missing path", h: h, target: "/api/versions", want: http.StatusBadRequest},
+		{name: "traversal", h: h, target: "/api/versions?path=../a.txt", want: http.StatusBadRequest},
+		{name: "missing directory", h: h, target: "/api/versions?path=nope/a.txt", want: http.StatusNotFound},
+		{name: "unknown file", h: h, target: "/api/versions?path=a.txt", want: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tc.h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if rr.Code != tc.want {
+				t.Errorf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestVersions_PruneByCount(t *testing.T) {
+	h, _, _ := newVersionedHandler(t, 2, 0)
+	for _, content := range []string{"1", "22", "333", "4444"} {
+		uploadFile(t, h, "a.txt", content)
+	}
+
+	versions := listVersions(t, h, "a.txt").Versions
+	if len(versions) != 2 || versions[0].Size != 3 || versions[1].Size != 2 {
+		t.Errorf("expected the two newest versions, got %+v", versions)
+	}
+}
+
+func TestVersions_PruneByAge(t *testing.T) {
+	h, store, _ := newVersionedHandler(t, 0, time.Hour)
+	uploadFile(t, h, "a.txt", "old")
+	uploadFile(t, h, "a.txt", "new")
+	uploadFile(t, h, "b.txt", "b")
+	uploadFile(t, h, "b.txt", "b2")
+
+	if removed := store.Prune(time.Now()); removed != 0 {
+		t.Fatalf("expected fresh versions to be kept, %d removed", removed)
+	}
+	if removed := store.Prune(time.Now().Add(2 * time.Hour)); removed != 2 {
+		t.Fatalf("expected both versions to expire, %d removed", removed)
+	}
+	if versions := listVersions(t, h, "a.txt").Versions; len(versions) != 0 {
+		t.Errorf("expected no versions left, got %+v", versions)
+	}
+	if entries, _ := os.ReadDir(store.dir); len(entries) != 0 {
+		t.Errorf("expected emptied directories to be removed, found %v", entries)
+	}
+}
+
+func TestVersionStore_Scope(t *testing.T) {
+	store, err := NewVersionStore(t.TempDir(), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer, inner := store.Scope("/a"), store.Scope("/a/b")
+	if outer.fileDir("b/x.txt") == inner.fileDir("x.txt") {
+		t.Errorf("nested mounts share %s", inner.fileDir("x.txt"))
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"path"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/listing"
+	"github.com/samzong/gofs/pkg/fileutil"
+)
+
+// Why an entry of a mount is not served, as gofs tree --explain reports it.
+const (
+	HiddenDenyPath   = "deny-path"   // A path segment matches --deny-path
+	HiddenSensitive  = "sensitive"   // A path segment matches a sensitive pattern with --block-sensitive
+	HiddenConfigFile = "dir-config"  // A .gofs.yaml, never listed or served
+	HiddenDirConfig  = "dir-hidden"  // A directory a .gofs.yaml hides
+	HiddenFile       = "hidden-file" // A dotfile or system file without --show-hidden
+	HiddenSymlink    = "symlink"     // A symlink leaving the mount, or a broken one
+)
+
+// Visibility decides which entries of a local mount requests can reach. It
+// applies the same checks as the request path, in the same order: the
+// --deny-path filter in front of the handlers, the .gofs.yaml rules, the
+// --block-sensitive patterns, then the hidden-file filter and symlink check
+// of the local filesystem.
+type Visibility struct {
+	fs         internal.FileSystem // the mount with hidden files listed
+	mountPath  string
+	denyPaths  []string
+	sensitive  []string // Nil unless --block-sensitive is enabled
+	showHidden bool
+	configs    *dirConfigCache // nil unless --dir-config is enabled
+}
+
+// NewVisibility returns the visibility rules of a local mount under cfg.
+func NewVisibility(mount config.DirMount, cfg *config.Config) *Visibility {
+	fs := filesystem.NewLocal(mount.Dir, true)
+	v := &Visibility{fs: fs, mountPath: mount.Path, denyPaths: cfg.DenyPaths, showHidden: cfg.ShowHidden}
+	if cfg.BlockSensitive {
+		v.sensitive = cfg.SensitivePatterns
+	}
+	if cfg.DirConfig {
+		v.configs = newDirConfigCache(fs)
+	}
+	return v
+}
+
+// HiddenReason returns why the entry f of dir is not served, or "" if it
+// is. dir is relative to the mount root and must itself be served.
+func (v *Visibility) HiddenReason(dir string, f internal.FileInfo) (string, error) {
+	name := path.Join(dir, f.Name())
+	if config.DeniedPath(path.Join(v.mountPath, name), v.denyPaths) {
+		return HiddenDenyPath, nil
+	}
+	if v.configs != nil {
+		rules, _, err := v.configs.resolve(dir)
+		if err != nil {
+			return "", err
+		}
+		if reason, err := v.configs.hides(rules, dir, f); reason != "" || err != nil {
+			return reason, err
+		}
+	}
+	if config.DeniedPath(name, v.sensitive) {
+		return HiddenSensitive, nil
+	}
+	if !v.showHidden && fileutil.IsHiddenPath(name) {
+		return HiddenFile, nil
+	}
+	if internal.FileMode(f)&os.ModeSymlink != 0 {
+		if _, err := v.fs.Stat(name); err != nil {
+			var apiErr *internal.APIError
+			if errors.As(err, &apiErr) && (apiErr.Code == "SYMLINK_ATTACK" || apiErr.Code == "SYMLINK_ERROR") {
+				return HiddenSymlink, nil
+			}
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// TreeEntry is one entry of a mount in the preview of gofs tree.
+type TreeEntry struct {
+	Name     string      `json:"name"`
+	IsDir    bool        `json:"isDir,omitempty"`
+	Symlink  string      `json:"symlink,omitempty"`
+	Hidden   string      `json:"hidden,omitempty"` // Why the entry is not served, with explain only
+	Children []TreeEntry `json:"children,omitempty"`
+}
+
+// Tree walks the mount and returns the entries requests can reach, ordered
+// as listings order them. With explain, entries that are not served are
+// included with the reason, but hidden directories are not descended into.
+// Symlinked directories are not followed. Symlinks leaving the mount count
+// as hidden: listings show them, but every request for them is refused.
+func (v *Visibility) Tree(explain bool) ([]TreeEntry, error) {
+	return v.tree("", explain)
+}
+
+func (v *Visibility) tree(dir string, explain bool) ([]TreeEntry, error) {
+	l, err := listing.Read(v.fs, dir, listing.Options{ShowHidden: true})
+	if err != nil {
+		return nil, err
+	}
+	entries := []TreeEntry{}
+	for _, e := range l.Entries {
+		reason, err := v.HiddenReason(dir, e.Info)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" && !explain {
+			continue
+		}
+		entry := TreeEntry{Name: e.Name, IsDir: e.IsDir, Symlink: e.Symlink, Hidden: reason}
+		if e.IsDir && reason == "" {
+			if entry.Children, err = v.tree(path.Join(dir, e.Name), explain); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// visibilityFixture builds a mount with entries hidden for every reason.
+func visibilityFixture(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"readme.txt":          "a",
+		"docs/guide.md":       "b",
+		"docs/.draft.md":      "c",
+		"secret/.gofs.yaml":   "hidden: true\n",
+		"secret/keys.txt":     "d",
+		".env":                "e",
+		"wp-login.php":        "f",
+		"private/.gofs.yaml":  "index: none\n",
+		"private/notes.txt":   "g",
+		"cgi-bin/script.sh":   "h",
+		".profile":            "i",
+		"docs/api/openapi.md": "j",
+	})
+	if err := os.Symlink("docs/guide.md", filepath.Join(root, "guide")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.TempDir(), filepath.Join(root, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestVisibility_Tree(t *testing.T) {
+	root := visibilityFixture(t)
+	cfg := &config.Config{DirConfig: true, DenyPaths: config.DefaultDenyPaths}
+	v := NewVisibility(config.DirMount{Path: "/", Dir: root}, cfg)
+
+	entries, err := v.Tree(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]string{}
+	var walk func(dir string, entries []TreeEntry)
+	walk = func(dir string, entries []TreeEntry) {
+		for _, e := range entries {
+			reasons[dir+e.Name] = e.Hidden
+			walk(dir+e.Name+"/", e.Children)
+		}
+	}
+	walk("", entries)
+
+	want := map[string]string{
+		"readme.txt":          "",
+		"docs":                "",
+		"docs/guide.md":       "",
+		"docs/api":            "",
+		"docs/api/openapi.md": "",
+		"docs/.draft.md":      HiddenFile,
+		"secret":              HiddenDirConfig,
+		".env":                HiddenDenyPath,
+		"wp-login.php":        HiddenDenyPath,
+		"cgi-bin":             HiddenDenyPath,
+		"private":             "",
+		"private/.gofs.yaml":  HiddenConfigFile,
+		"private/notes.txt":   "",
+		".profile":            HiddenFile,
+		"guide":               "",
+		"outside":             HiddenSymlink,
+	}
+	for name, reason := range want {
+		got, ok := reasons[name]
+		if !ok {
+			t.Errorf("%s: missing from the tree", name)
+		} else if got != reason {
+			t.Errorf("%s: expected reason %q, got %q", name, reason, got)
+		}
+	}
+	if _, ok := reasons["secret/keys.txt"]; ok {
+		t.Error("hidden directories must not be walked")
+	}
+
+	visible, err := v.Tree(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range visible {
+		if e.Hidden != "" {
+			t.Errorf("%s: hidden entry without explain", e.Name)
+		}
+		names = append(names, e.Name)
+	}
+	if want := []string{"docs", "private", "guide", "readme.txt"}; !slices.Equal(names, want) {
+		t.Errorf("expected %v, got %v", want, names)
+	}
+
+	cfg.ShowHidden = true
+	v = NewVisibility(config.DirMount{Path: "/", Dir: root}, cfg)
+	info, err := os.Lstat(filepath.Join(root, ".profile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason, err := v.HiddenReason("", info); err != nil || reason != "" {
+		t.Errorf(".profile with --show-hidden: got %q, %v", reason, err)
+	}
+}
+
+// TestVisibility_MatchesListing checks that the preview shows what the
+// handlers list, apart from symlinks leaving the mount.
+func TestVisibility_MatchesListing(t *testing.T) {
+	root := visibilityFixture(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{Theme: "default", DirConfig: true}
+	h := NewFile(filesystem.NewLocal(root, false), cfg, logger)
+
+	entries, err := NewVisibility(config.DirMount{Path: "/", Dir: root}, cfg).Tree(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, e := range entries {
+		want = append(want, e.Name)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	var listing struct {
+		Files []struct {
+			Name string `json:"name"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("listing: %v: %s", err, rr.Body.String())
+	}
+	var got []string
+	for _, f := range listing.Files {
+		if f.Name != "outside" { // listed, but every request for it is refused
+			got = append(got, f.Name)
+		}
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("expected the listing %v, got %v", want, got)
+	}
+}
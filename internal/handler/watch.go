@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// DirEvent is the data of a "change" event of GET /api/events: something in
+// the directory at Path was added, removed or modified.
+type DirEvent struct {
+	Path string `json:"path"` // Slash-separated path within the mount, without a leading slash
+}
+
+// dirWatcher tells subscribers when a directory changes. subscribe returns
+// the channel events arrive on and a function that ends the subscription.
+// Events are coalesced: a subscriber that has not taken the last one yet
+// does not get another.
+type dirWatcher interface {
+	subscribe(dir string) (<-chan DirEvent, func())
+}
+
+// newDirWatcher returns the watcher --watch-mode selects, or nil when it is
+// off. There is no native notification backend in the standard library, and
+// NFS and many container filesystems would not deliver its events anyway,
+// so "auto" polls as well.
+func newDirWatcher(fs internal.FileSystem, cfg *config.Config) dirWatcher {
+	if cfg.WatchMode == config.WatchOff {
+		return nil
+	}
+	return newPollWatcher(fs, pollInterval(cfg), cfg.ShowHidden)
+}
+
+// pollInterval returns the configured fingerprint interval, falling back to
+// the default when unset.
+func pollInterval(cfg *config.Config) time.Duration {
+	if cfg.PollInterval > 0 {
+		return cfg.PollInterval
+	}
+	return constants.DefaultPollInterval
+}
+
+// dirFingerprint is what a poll compares: a change to any field means the
+// directory changed. Adding, removing or renaming an entry changes the
+// directory's mtime or the count, and rewriting a file its own mtime.
+type dirFingerprint struct {
+	modTime    int64 // UnixNano of the directory
+	count      int
+	maxModTime int64 // UnixNano of the newest entry
+	missing    bool  // The directory could not be read
+}
+
+// pollWatcher detects changes by fingerprinting each watched directory every
+// interval. A directory is only polled while it has subscribers.
+type pollWatcher struct {
+	fs         internal.FileSystem
+	interval   time.Duration
+	showHidden bool
+
+	mu   sync.Mutex
+	dirs map[string]*watchedDir
+}
+
+// watchedDir is a directory with subscribers and the goroutine polling it.
+type watchedDir struct {
+	subscribers map[chan DirEvent]struct{}
+	stop        chan struct{}
+}
+
+func newPollWatcher(fs internal.FileSystem, interval time.Duration, showHidden bool) *pollWatcher {
+	return &pollWatcher{fs: fs, interval: interval, showHidden: showHidden, dirs: make(map[string]*watchedDir)}
+}
+
+func (p *pollWatcher) subscribe(dir string) (<-chan DirEvent, func()) {
+	events := make(chan DirEvent, 1)
+
+	p.mu.Lock()
+	watched, ok := p.dirs[dir]
+	if !ok {
+		// The first subscriber fingerprints the directory before the poll
+		// starts, so a change right after subscribing is not mistaken for
+		// the initial state. Reading it can be slow, so the lock is let go
+		// meanwhile and whoever starts the poll first wins.
+		p.mu.Unlock()
+		initial := p.fingerprint(dir)
+		p.mu.Lock()
+		if watched, ok = p.dirs[dir]; !ok {
+			watched = &watchedDir{subscribers: make(map[chan DirEvent]struct{}), stop: make(chan struct{})}
+			p.dirs[dir] = watched
+			go p.poll(dir, watched, initial)
+		}
+	}
+	watched.subscribers[events] = struct{}{}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			delete(watched.subscribers, events)
+			if len(watched.subscribers) == 0 {
+				close(watched.stop)
+				delete(p.dirs, dir)
+			}
+		})
+	}
+}
+
+// poll fingerprints dir every interval until its last subscriber leaves,
+// notifying the subscribers whenever the fingerprint differs from last.
+func (p *pollWatcher) poll(dir string, watched *watchedDir, last dirFingerprint) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-watched.stop:
+			return
+		case <-ticker.C:
+		}
+		current := p.fingerprint(dir)
+		if current == last {
+			continue
+		}
+		last = current
+
+		p.mu.Lock()
+		for events := range watched.subscribers {
+			select {
+			case events <- DirEvent{Path: dir}:
+			default:
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// fingerprint reads dir once. Hidden entries are left out unless they are
+// listed, so rewriting one raises no event.
+func (p *pollWatcher) fingerprint(dir string) dirFingerprint {
+	info, err := p.fs.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return dirFingerprint{missing: true}
+	}
+	files, err := p.fs.ReadDir(dir)
+	if err != nil {
+		return dirFingerprint{missing: true}
+	}
+	fp := dirFingerprint{modTime: info.ModTime().UnixNano()}
+	for _, f := range files {
+		if !p.showHidden && fileutil.IsHiddenPath(path.Join(dir, f.Name())) {
+			continue
+		}
+		fp.count++
+		fp.maxModTime = max(fp.maxModTime, f.ModTime().UnixNano())
+	}
+	return fp
+}
+
+// serveEvents handles GET /api/events?path=..., a text/event-stream with a
+// "change" event each time watcher notices that the directory changed. The
+// stream stays open until the client leaves, so the server's write timeout
+// is lifted for it.
+func serveEvents(w http.ResponseWriter, r *http.Request, fs internal.FileSystem, watcher dirWatcher,
+	reporter middleware.ErrorReporter,
+) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if watcher == nil {
+		middleware.WriteJSONError(w, "Live updates are disabled", http.StatusNotFound)
+		return
+	}
+
+	dir, err := pathsafe.Clean(r.URL.Query().Get("path"))
+	if err != nil {
+		middleware.WriteJSONError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	info, err := fs.Stat(dir)
+	if err != nil {
+		reporter.JSONError(w, r, "Directory not found", http.StatusNotFound, err)
+		return
+	}
+	if !info.IsDir() {
+		middleware.WriteJSONError(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	events, unsubscribe := watcher.subscribe(dir)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// A comment line so clients and proxies see the stream open at once
+	if _, err := fmt.Fprint(w, ": watching\n\n"); err != nil || rc.Flush() != nil {
+		return
+	}
+
+	streamEvents(r.Context(), w, rc, events, constants.EventsKeepAlive)
+}
+
+// streamEvents writes each event to w until ctx ends or a write fails,
+// with a comment every keepAlive so idle connections are not dropped.
+func streamEvents(ctx context.Context, w http.ResponseWriter, rc *http.ResponseController,
+	events <-chan DirEvent, keepAlive time.Duration,
+) {
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			_, err = fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
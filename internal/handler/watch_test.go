@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+)
+
+// expectEvent waits for an event on events, or fails after a second.
+func expectEvent(t *testing.T, events <-chan DirEvent, want string) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		if event.Path != want {
+			t.Errorf("expected an event for %q, got %+v", want, event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected an event for %q", want)
+	}
+}
+
+// expectNoEvent fails if an event arrives within ten poll intervals.
+func expectNoEvent(t *testing.T, events <-chan DirEvent, interval time.Duration) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		t.Fatalf("expected no event, got %+v", event)
+	case <-time.After(10 * interval):
+	}
+}
+
+func TestPollWatcher(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, filepath.Join(root, "sub"), "a.txt", ".hidden")
+	const interval = 10 * time.Millisecond
+	w := newPollWatcher(filesystem.NewLocal(root, false), interval, false)
+
+	events, stop := w.subscribe("sub")
+	others, stopOthers := w.subscribe("sub")
+	expectNoEvent(t, events, interval)
+
+	writeFiles(t, filepath.Join(root, "sub"), "b.txt")
+	expectEvent(t, events, "sub")
+	expectEvent(t, others, "sub")
+	expectNoEvent(t, events, interval)
+
+	// Rewriting a file leaves the directory's mtime alone
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "sub", "a.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, "sub")
+
+	if err := os.Chtimes(filepath.Join(root, "sub", ".hidden"), later, later.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	expectNoEvent(t, events, interval)
+
+	if err := os.RemoveAll(filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, "sub")
+
+	// The directory is polled until its last subscriber leaves
+	stop()
+	stop()
+	if len(w.dirs) != 1 {
+		t.Errorf("expected sub to be watched for the remaining subscriber, got %d directories", len(w.dirs))
+	}
+	stopOthers()
+	if len(w.dirs) != 0 {
+		t.Errorf("expected no watched directories, got %d", len(w.dirs))
+	}
+}
+
+func TestAdvancedFile_Events(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, filepath.Join(root, "docs"), "a.txt")
+	cfg := &config.Config{Theme: "advanced", PollInterval: 10 * time.Millisecond}
+	srv := httptest.NewServer(NewAdvancedFile(filesystem.NewLocal(root, false), cfg))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/events?path=docs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	readUntil := func(want string) {
+		t.Helper()
+		for lines.Scan() {
+			if lines.Text() == want {
+				return
+			}
+		}
+		t.Fatalf("stream ended before %q: %v", want, lines.Err())
+	}
+	readUntil(": watching")
+	writeFiles(t, filepath.Join(root, "docs"), "b.txt")
+	readUntil("event: change")
+	if !lines.Scan() || lines.Text() != `data: {"path":"docs"}` {
+		t.Errorf("expected the event data, got %q", lines.Text())
+	}
+}
+
+func TestAdvancedFile_EventsDisabled(t *testing.T) {
+	h := NewAdvancedFile(filesystem.NewLocal(t.TempDir(), false),
+		&config.Config{Theme: "advanced", WatchMode: config.WatchOff})
+	rr := getPath(h, "/api/events", nil)
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "disabled") {
+		t.Errorf("expected 404 with --watch-mode=off, got %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/samzong/gofs/internal"
 	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/middleware"
 	"golang.org/x/net/webdav"
 )
 
@@ -20,9 +21,18 @@ type WebDAV struct {
 
 // NewWebDAV creates a new WebDAV handler
 func NewWebDAV(fs internal.FileSystem, cfg *config.Config, logger *slog.Logger) *WebDAV {
+	if cfg.DirConfig {
+		// WebDAV clients cannot be prompted per subtree, so protected
+		// directories are as unreadable as hidden ones
+		fs = newDirConfigFS(fs, newDirConfigCache(fs), "")
+	}
+
 	// Create WebDAV adapter
 	adapter := NewWebDAVAdapter(fs)
 
+	// At the root the prefix is empty, so every path is a WebDAV path
+	prefix := strings.TrimSuffix(cfg.DAVPrefix(), "/")
+
 	// Configure WebDAV handler with read-only lock system
 	handler := &webdav.Handler{
 		FileSystem: adapter,
@@ -35,14 +45,14 @@ func NewWebDAV(fs internal.FileSystem, cfg *config.Config, logger *slog.Logger)
 					"error", err)
 			}
 		},
-		Prefix: "/dav",
+		Prefix: prefix,
 	}
 
 	return &WebDAV{
 		handler: handler,
 		config:  cfg,
 		logger:  logger,
-		prefix:  "/dav",
+		prefix:  prefix,
 	}
 }
 
@@ -50,7 +60,12 @@ func NewWebDAV(fs internal.FileSystem, cfg *config.Config, logger *slog.Logger)
 func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	// Block write operations for extra safety
 	switch r.Method {
-	case "PUT", "DELETE", "MKCOL", "COPY", "MOVE", "PROPPATCH", "LOCK", "UNLOCK":
+	case "LOCK", "UNLOCK":
+		if w.config.WebDAVFakeLocks {
+			break
+		}
+		fallthrough
+	case "PUT", "DELETE", "MKCOL", "COPY", "MOVE", "PROPPATCH":
 		w.logger.Warn("write operation attempted",
 			"method", r.Method,
 			"path", r.URL.Path,
@@ -65,23 +80,49 @@ func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	// Handle OPTIONS for Windows clients
 	if r.Method == "OPTIONS" {
-		rw.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
-		rw.Header().Set("Public", "OPTIONS, GET, HEAD, PROPFIND")
+		allow := "OPTIONS, GET, HEAD, PROPFIND"
+		if w.config.WebDAVFakeLocks {
+			allow += ", LOCK, UNLOCK"
+		}
+		rw.Header().Set("Allow", allow)
+		rw.Header().Set("Public", allow)
 		rw.WriteHeader(http.StatusOK)
 		return
 	}
 
-	// Limit PROPFIND depth to prevent resource exhaustion
-	if r.Method == "PROPFIND" && r.Header.Get("Depth") == "infinity" {
-		r.Header.Set("Depth", "1")
+	if r.Method == "PROPFIND" {
+		// Limit PROPFIND depth to prevent resource exhaustion
+		if r.Header.Get("Depth") == "infinity" {
+			r.Header.Set("Depth", "1")
+		}
+		r = r.WithContext(withStatCache(r.Context()))
 	}
 
-	// Verify path prefix
-	if !strings.HasPrefix(r.URL.Path, w.prefix) {
+	// Verify path prefix, matching whole segments
+	if r.URL.Path != w.prefix && !strings.HasPrefix(r.URL.Path, w.prefix+"/") {
 		http.NotFound(rw, r)
 		return
 	}
 
+	if r.Method == "LOCK" || r.Method == "UNLOCK" {
+		w.serveFakeLock(rw, r, middleware.BasePathFromContext(r.Context())+r.URL.Path)
+		return
+	}
+
+	// Behind --base-url, restore the stripped prefix so PROPFIND hrefs
+	// resolve for the client
+	if base := middleware.BasePathFromContext(r.Context()); base != "" {
+		handler := *w.handler
+		handler.Prefix = base + w.prefix
+		u := *r.URL
+		u.Path = base + u.Path
+		u.RawPath = ""
+		r2 := r.Clone(r.Context())
+		r2.URL = &u
+		handler.ServeHTTP(rw, r2)
+		return
+	}
+
 	// Delegate to WebDAV handler
 	w.handler.ServeHTTP(rw, r)
 }
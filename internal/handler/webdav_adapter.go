@@ -2,11 +2,14 @@ package handler
 
 import (
 	"context"
+	"encoding/xml"
 	"errors"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/samzong/gofs/internal"
 	"golang.org/x/net/webdav"
@@ -27,27 +30,61 @@ func (w *webDAVAdapter) Mkdir(_ context.Context, _ string, _ os.FileMode) error
 	return webdav.ErrForbidden
 }
 
-// OpenFile implements webdav.FileSystem
-func (w *webDAVAdapter) OpenFile(_ context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
-	// Only allow read operations
-	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
-		return nil, webdav.ErrForbidden
-	}
+// statCacheKey is the context key of a request's statCache.
+type statCacheKey struct{}
+
+// statCache holds the entries a PROPFIND has listed, by clean path. The
+// webdav package stats and opens every child of a listed directory again;
+// with the cache those calls reuse the listing instead of hitting the
+// backend. It belongs to a single request, which walks sequentially.
+type statCache map[string]internal.FileInfo
 
-	// Clean and validate path
+// withStatCache returns ctx with an empty statCache for one request.
+func withStatCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, statCacheKey{}, statCache{})
+}
+
+func statCacheFrom(ctx context.Context) statCache {
+	cache, _ := ctx.Value(statCacheKey{}).(statCache)
+	return cache
+}
+
+// cleanDAVPath turns a WebDAV path into a FileSystem path.
+func cleanDAVPath(name string) string {
 	cleanPath := path.Clean(name)
 	if cleanPath == "/" {
-		cleanPath = "."
-	} else {
-		cleanPath = strings.TrimPrefix(cleanPath, "/")
+		return "."
 	}
+	return strings.TrimPrefix(cleanPath, "/")
+}
 
-	// Get file info first
+// stat returns the info of cleanPath from the request's statCache, falling
+// back to the backend.
+func (w *webDAVAdapter) stat(ctx context.Context, cleanPath string) (internal.FileInfo, bool, error) {
+	if info, ok := statCacheFrom(ctx)[cleanPath]; ok {
+		return info, true, nil
+	}
 	info, err := w.fs.Stat(cleanPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, os.ErrNotExist
+			return nil, false, os.ErrNotExist
 		}
+		return nil, false, err
+	}
+	return info, false, nil
+}
+
+// OpenFile implements webdav.FileSystem
+func (w *webDAVAdapter) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	// Only allow read operations
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, webdav.ErrForbidden
+	}
+
+	// Get file info first
+	cleanPath := cleanDAVPath(name)
+	info, cached, err := w.stat(ctx, cleanPath)
+	if err != nil {
 		return nil, err
 	}
 
@@ -57,22 +94,37 @@ func (w *webDAVAdapter) OpenFile(_ context.Context, name string, flag int, _ os.
 			adapter: w,
 			path:    cleanPath,
 			info:    info,
+			cache:   statCacheFrom(ctx),
 		}, nil
 	}
 
-	// Open regular file for reading
-	reader, err := w.fs.Open(cleanPath)
+	if cached {
+		// Listed files are mostly opened for their properties, so the
+		// backend file is only opened once it is read
+		return &webDAVFile{
+			ReadSeekCloser: &lazyFile{fs: w.fs, path: cleanPath},
+			info:           info,
+			path:           cleanPath,
+		}, nil
+	}
+
+	// Open regular file for reading; GET seeks it to find its size and
+	// serve ranges
+	file, err := internal.OpenSeeker(w.fs, cleanPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, os.ErrNotExist
 		}
 		return nil, err
 	}
+	if !internal.CapabilitiesOf(w.fs).CanSeek {
+		file = &streamFile{ReadSeekCloser: file, size: info.Size()}
+	}
 
 	return &webDAVFile{
-		ReadCloser: reader,
-		info:       info,
-		path:       cleanPath,
+		ReadSeekCloser: file,
+		info:           info,
+		path:           cleanPath,
 	}, nil
 }
 
@@ -87,29 +139,90 @@ func (w *webDAVAdapter) Rename(_ context.Context, _, _ string) error {
 }
 
 // Stat implements webdav.FileSystem
-func (w *webDAVAdapter) Stat(_ context.Context, name string) (os.FileInfo, error) {
-	// Clean and validate path
-	cleanPath := path.Clean(name)
-	if cleanPath == "/" {
-		cleanPath = "."
-	} else {
-		cleanPath = strings.TrimPrefix(cleanPath, "/")
+func (w *webDAVAdapter) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, _, err := w.stat(ctx, cleanDAVPath(name))
+	if err != nil {
+		return nil, err
 	}
+	return &webDAVFileInfo{FileInfo: info}, nil
+}
 
-	info, err := w.fs.Stat(cleanPath)
+// lazyFile opens a backend file on its first Read or Seek.
+type lazyFile struct {
+	fs   internal.FileSystem
+	path string
+	file io.ReadSeekCloser
+}
+
+func (f *lazyFile) open() error {
+	if f.file != nil {
+		return nil
+	}
+	file, err := internal.OpenSeeker(f.fs, f.path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, os.ErrNotExist
-		}
-		return nil, err
+		return err
 	}
+	f.file = file
+	return nil
+}
 
-	return &webDAVFileInfo{FileInfo: info}, nil
+func (f *lazyFile) Read(p []byte) (int, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	return f.file.Read(p)
+}
+
+func (f *lazyFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	return f.file.Seek(offset, whence)
+}
+
+func (f *lazyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// streamFile serves a file of a backend that cannot seek to GET, which
+// seeks to the end and back to find the size before reading the file from
+// its start. Any other seek still fails with internal.ErrNotSeekable, so
+// ranges are not served.
+type streamFile struct {
+	io.ReadSeekCloser
+	size int64
+	read bool
+}
+
+func (f *streamFile) Read(p []byte) (int, error) {
+	n, err := f.ReadSeekCloser.Read(p)
+	if n > 0 {
+		f.read = true
+	}
+	return n, err
+}
+
+func (f *streamFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.ReadSeekCloser.Seek(offset, whence)
+	if !errors.Is(err, internal.ErrNotSeekable) || offset != 0 {
+		return n, err
+	}
+	switch {
+	case whence == io.SeekEnd:
+		return f.size, nil
+	case whence == io.SeekStart && !f.read:
+		return 0, nil
+	}
+	return n, err
 }
 
-// webDAVFile wraps a file for WebDAV access
+// webDAVFile wraps a file for WebDAV access. It seeks if the backend's
+// files do.
 type webDAVFile struct {
-	io.ReadCloser
+	io.ReadSeekCloser
 	info internal.FileInfo
 	path string
 }
@@ -119,12 +232,6 @@ func (f *webDAVFile) Write([]byte) (int, error) {
 	return 0, webdav.ErrForbidden
 }
 
-// Seek implements webdav.File
-func (f *webDAVFile) Seek(_ int64, _ int) (int64, error) {
-	// Most read operations don't need seek, return error
-	return 0, errors.New("seek not supported")
-}
-
 // Readdir implements webdav.File (returns error for regular files)
 func (f *webDAVFile) Readdir(_ int) ([]os.FileInfo, error) {
 	return nil, errors.New("not a directory")
@@ -140,6 +247,7 @@ type webDAVDir struct {
 	adapter *webDAVAdapter
 	path    string
 	info    internal.FileInfo
+	cache   statCache // Nil outside PROPFIND
 	entries []os.FileInfo
 	pos     int
 }
@@ -180,6 +288,11 @@ func (d *webDAVDir) Readdir(count int) ([]os.FileInfo, error) {
 		d.entries = make([]os.FileInfo, len(entries))
 		for i, entry := range entries {
 			d.entries[i] = &webDAVFileInfo{FileInfo: entry}
+			// Listings describe symlinks themselves, so only Stat can
+			// tell what they point to
+			if d.cache != nil && internal.FileMode(entry)&os.ModeSymlink == 0 {
+				d.cache[path.Join(d.path, entry.Name())] = entry
+			}
 		}
 	}
 
@@ -223,15 +336,59 @@ type webDAVFileInfo struct {
 	internal.FileInfo
 }
 
-// Mode implements os.FileInfo
+// Mode implements os.FileInfo, using the backend's mode where it has one
 func (i *webDAVFileInfo) Mode() os.FileMode {
-	if i.IsDir() {
-		return os.ModeDir | 0755
-	}
-	return 0644
+	return internal.FileMode(i.FileInfo)
 }
 
 // Sys implements os.FileInfo
 func (i *webDAVFileInfo) Sys() any {
 	return nil
 }
+
+// creationDateProp is DAV:creationdate, which golang.org/x/net/webdav hides
+// unless the file supplies it. Few filesystems expose a portable birth time,
+// so the modification time is reported, as other file-backed servers do.
+var creationDateProp = xml.Name{Space: "DAV:", Local: "creationdate"}
+
+// fileProps returns the properties supplied on top of the webdav package's
+// live ones.
+func fileProps(info internal.FileInfo) map[xml.Name]webdav.Property {
+	return map[xml.Name]webdav.Property{
+		creationDateProp: {
+			XMLName:  creationDateProp,
+			InnerXML: []byte(info.ModTime().UTC().Format(time.RFC3339)),
+		},
+	}
+}
+
+// rejectPatch answers PROPPATCH with 403 for every property.
+func rejectPatch(patches []webdav.Proppatch) []webdav.Propstat {
+	pstat := webdav.Propstat{Status: http.StatusForbidden}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+		}
+	}
+	return []webdav.Propstat{pstat}
+}
+
+// DeadProps implements webdav.DeadPropsHolder
+func (f *webDAVFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return fileProps(f.info), nil
+}
+
+// Patch implements webdav.DeadPropsHolder (read-only, rejects all changes)
+func (f *webDAVFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return rejectPatch(patches), nil
+}
+
+// DeadProps implements webdav.DeadPropsHolder
+func (d *webDAVDir) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return fileProps(d.info), nil
+}
+
+// Patch implements webdav.DeadPropsHolder (read-only, rejects all changes)
+func (d *webDAVDir) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return rejectPatch(patches), nil
+}
@@ -2,14 +2,22 @@ package handler
 
 import (
 	"context"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/internal/config"
 	"github.com/samzong/gofs/internal/filesystem"
 	"golang.org/x/net/webdav"
 )
@@ -409,14 +417,52 @@ func TestWebDAVFile_Seek(t *testing.T) {
 	}
 	defer file.Close()
 
-	// Test seek (should fail)
-	offset, err := file.Seek(0, io.SeekStart)
-	if err == nil {
-		t.Error("Expected seek to fail")
+	// Local files seek, so GET can find the size and serve ranges
+	offset, err := file.Seek(5, io.SeekStart)
+	if err != nil || offset != 5 {
+		t.Fatalf("Expected to seek to 5, got %d, %v", offset, err)
+	}
+	rest, _ := io.ReadAll(file)
+	if string(rest) != "content" {
+		t.Errorf("Expected to read on from the offset, got %q", rest)
+	}
+
+	// Backends that can only stream say so, but still tell GET the size
+	streaming := NewWebDAVAdapter(streamingFS{fs}).(*webDAVAdapter)
+	file, err = streaming.OpenFile(ctx, "/test.txt", os.O_RDONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(5, io.SeekStart); !errors.Is(err, internal.ErrNotSeekable) {
+		t.Errorf("Expected ErrNotSeekable, got %v", err)
+	}
+	if size, err := file.Seek(0, io.SeekEnd); err != nil || size != 12 {
+		t.Errorf("Expected the size 12, got %d, %v", size, err)
+	}
+	if offset, err := file.Seek(0, io.SeekStart); err != nil || offset != 0 {
+		t.Errorf("Expected to rewind an unread file, got %d, %v", offset, err)
 	}
-	if offset != 0 {
-		t.Errorf("Expected offset 0, got %d", offset)
+	if data, _ := io.ReadAll(file); string(data) != "test content" {
+		t.Errorf("Expected the whole file, got %q", data)
 	}
+	if _, err := file.Seek(0, io.SeekStart); !errors.Is(err, internal.ErrNotSeekable) {
+		t.Errorf("Expected ErrNotSeekable once read, got %v", err)
+	}
+}
+
+// streamingFS hides the seekability of its backend's files, like a backend
+// that can only stream them.
+type streamingFS struct {
+	internal.FileSystem
+}
+
+func (s streamingFS) Open(name string) (io.ReadCloser, error) {
+	f, err := s.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ io.ReadCloser }{f}, nil
 }
 
 func TestWebDAVDir_Operations(t *testing.T) {
@@ -711,6 +757,14 @@ func (m *mockWebDAVFileSystem) Remove(_ string) error {
 	return os.ErrPermission
 }
 
+func (m *mockWebDAVFileSystem) Rename(_, _ string) error {
+	return os.ErrPermission
+}
+
+func (m *mockWebDAVFileSystem) Chtimes(_ string, _, _ time.Time) error {
+	return os.ErrPermission
+}
+
 type mockWebDAVFileInfo struct {
 	name  string
 	size  int64
@@ -732,3 +786,238 @@ func (m *mockWebDAVFileInfo) IsDir() bool {
 func (m *mockWebDAVFileInfo) ModTime() time.Time {
 	return time.Now()
 }
+
+// countingFS counts the backend calls made through it.
+type countingFS struct {
+	internal.FileSystem
+	stats    map[string]int
+	opens    int
+	readDirs int
+}
+
+func newCountingFS(fs internal.FileSystem) *countingFS {
+	return &countingFS{FileSystem: fs, stats: map[string]int{}}
+}
+
+func (c *countingFS) Stat(name string) (internal.FileInfo, error) {
+	c.stats[name]++
+	return c.FileSystem.Stat(name)
+}
+
+func (c *countingFS) Open(name string) (io.ReadCloser, error) {
+	c.opens++
+	return c.FileSystem.Open(name)
+}
+
+func (c *countingFS) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	c.opens++
+	return internal.OpenSeeker(c.FileSystem, name)
+}
+
+func (c *countingFS) ReadDir(name string) ([]internal.FileInfo, error) {
+	c.readDirs++
+	return c.FileSystem.ReadDir(name)
+}
+
+// canonicalMultistatus renders a multistatus body with the properties of
+// each propstat sorted, since the webdav package emits them in map order.
+func canonicalMultistatus(t *testing.T, body string) string {
+	t.Helper()
+	var ms struct {
+		Responses []struct {
+			Href     string `xml:"href"`
+			Propstat []struct {
+				Prop struct {
+					Props []struct {
+						XMLName xml.Name
+						Inner   string `xml:",innerxml"`
+					} `xml:",any"`
+				} `xml:"prop"`
+				Status string `xml:"status"`
+			} `xml:"propstat"`
+		} `xml:"response"`
+	}
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatalf("invalid multistatus: %v", err)
+	}
+	var b strings.Builder
+	for _, resp := range ms.Responses {
+		b.WriteString(resp.Href + "\n")
+		for _, ps := range resp.Propstat {
+			var props []string
+			for _, p := range ps.Prop.Props {
+				props = append(props, p.XMLName.Local+"="+p.Inner)
+			}
+			slices.Sort(props)
+			fmt.Fprintf(&b, "  %s %v\n", ps.Status, props)
+		}
+	}
+	return b.String()
+}
+
+func TestWebDAV_PROPFINDStatCache(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt":       "alpha",
+		"b.html":      "<p>b</p>",
+		"README":      "no extension",
+		"sub/c.txt":   "gamma",
+		"sub/d/e.txt": "epsilon",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := os.Symlink("sub", filepath.Join(root, "link")); err != nil {
+		t.Logf("symlinks not supported: %v", err)
+	}
+
+	fs := newCountingFS(filesystem.NewLocal(root, false))
+	h := NewWebDAV(fs, &config.Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	bodies := map[string]string{
+		"allprop": "",
+		"prop": `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop>` +
+			`<D:getcontentlength/><D:resourcetype/><D:getetag/><D:creationdate/></D:prop></D:propfind>`,
+		"propname": `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:propname/></D:propfind>`,
+	}
+	for name, body := range bodies {
+		for target, children := range map[string][]string{
+			"/dav/":     {"a.txt", "b.html", "README", "sub"},
+			"/dav/sub/": {"sub/c.txt", "sub/d"},
+		} {
+			t.Run(name+target, func(t *testing.T) {
+				propfind := func(serve http.Handler) string {
+					req := httptest.NewRequest("PROPFIND", target, strings.NewReader(body))
+					req.Header.Set("Depth", "1")
+					rr := httptest.NewRecorder()
+					serve.ServeHTTP(rr, req)
+					if rr.Code != http.StatusMultiStatus {
+						t.Fatalf("expected 207, got %d: %s", rr.Code, rr.Body.String())
+					}
+					return canonicalMultistatus(t, rr.Body.String())
+				}
+
+				// The embedded webdav.Handler is the uncached path
+				want := propfind(h.handler)
+				clear(fs.stats)
+				fs.opens = 0
+				if got := propfind(h); got != want {
+					t.Errorf("multistatus differs from the uncached one:\n got %s\nwant %s", got, want)
+				}
+				for _, child := range children {
+					if fs.stats[child] > 0 {
+						t.Errorf("%s was stat'ed %d times", child, fs.stats[child])
+					}
+				}
+				if name != "allprop" && fs.opens > 0 {
+					t.Errorf("expected no files to be opened, got %d", fs.opens)
+				}
+			})
+		}
+	}
+}
+
+func TestWebDAV_PROPFINDDepth0(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	fs := newCountingFS(filesystem.NewLocal(root, false))
+	h := NewWebDAV(fs, &config.Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, target := range []string{"/dav/", "/dav/sub"} {
+		req := httptest.NewRequest("PROPFIND", target, nil)
+		req.Header.Set("Depth", "0")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusMultiStatus {
+			t.Fatalf("expected 207, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	if fs.readDirs != 0 {
+		t.Errorf("expected Depth: 0 to never list a directory, got %d ReadDir calls", fs.readDirs)
+	}
+}
+
+// TestOpensOnce checks that serving a file, whole or in ranges, takes a
+// single open of the backend on both themes and over WebDAV.
+func TestOpensOnce(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "data.txt"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	fs := newCountingFS(filesystem.NewLocal(root, false))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{MaxHashSize: 1 << 20}
+
+	for _, tc := range []struct {
+		name     string
+		handler  http.Handler
+		target   string
+		rng      string
+		wantCode int
+		wantBody string
+	}{
+		{"default", NewFile(fs, cfg, logger), "/data.txt", "", http.StatusOK, "0123456789"},
+		{"default range", NewFile(fs, cfg, logger), "/data.txt", "bytes=2-4", http.StatusPartialContent, "234"},
+		{"advanced", NewAdvancedFile(fs, cfg), "/data.txt", "", http.StatusOK, "0123456789"},
+		{"advanced range", NewAdvancedFile(fs, cfg), "/data.txt", "bytes=8-", http.StatusPartialContent, "89"},
+		{"webdav", NewWebDAV(fs, cfg, logger), "/dav/data.txt", "", http.StatusOK, "0123456789"},
+		{"webdav range", NewWebDAV(fs, cfg, logger), "/dav/data.txt", "bytes=4-", http.StatusPartialContent, "456789"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.rng != "" {
+				req.Header.Set("Range", tc.rng)
+			}
+			fs.opens = 0
+			rr := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rr.Code, rr.Body.String())
+			}
+			if tc.wantBody != "" && rr.Body.String() != tc.wantBody {
+				t.Errorf("expected body %q, got %q", tc.wantBody, rr.Body.String())
+			}
+			if fs.opens != 1 {
+				t.Errorf("expected a single open, got %d", fs.opens)
+			}
+		})
+	}
+}
+
+func BenchmarkWebDAV_PROPFIND(b *testing.B) {
+	root := b.TempDir()
+	for i := range 5000 {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%05d.txt", i)), nil, 0o644); err != nil {
+			b.Fatalf("WriteFile: %v", err)
+		}
+	}
+	h := NewWebDAV(filesystem.NewLocal(root, false), &config.Config{},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, bc := range []struct {
+		name  string
+		serve http.Handler
+	}{
+		{"cached", h},
+		{"uncached", h.handler},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest("PROPFIND", "/dav/", nil)
+				req.Header.Set("Depth", "1")
+				rr := httptest.NewRecorder()
+				bc.serve.ServeHTTP(rr, req)
+				if rr.Code != http.StatusMultiStatus {
+					b.Fatalf("expected 207, got %d", rr.Code)
+				}
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -44,8 +45,8 @@ func TestNewWebDAV(t *testing.T) {
 		t.Error("Logger not set correctly")
 	}
 
-	if webdavHandler.prefix != "/dav" {
-		t.Errorf("Expected prefix '/dav', got %q", webdavHandler.prefix)
+	if webdavHandler.prefix != config.DefaultWebDAVPrefix {
+		t.Errorf("Expected prefix %q, got %q", config.DefaultWebDAVPrefix, webdavHandler.prefix)
 	}
 
 	if webdavHandler.handler == nil {
@@ -268,10 +269,8 @@ func TestWebDAV_GET(t *testing.T) {
 
 	webdavHandler.ServeHTTP(w, req)
 
-	// Note: GET operations may fail due to seek limitations in our WebDAV adapter
-	// This is expected behavior as our implementation is read-only and simplified
-	if w.Code != http.StatusOK && w.Code != http.StatusInternalServerError {
-		t.Errorf("Expected status %d or %d, got %d", http.StatusOK, http.StatusInternalServerError, w.Code)
+	if w.Code != http.StatusOK || w.Body.String() != "Hello, WebDAV world!" {
+		t.Errorf("Expected status %d with the file, got %d %q", http.StatusOK, w.Code, w.Body.String())
 	}
 
 	// Check WebDAV headers are set regardless of content success
@@ -289,9 +288,8 @@ func TestWebDAV_HEAD(t *testing.T) {
 
 	webdavHandler.ServeHTTP(w, req)
 
-	// Note: HEAD operations may fail due to seek limitations in our WebDAV adapter
-	if w.Code != http.StatusOK && w.Code != http.StatusInternalServerError {
-		t.Errorf("Expected status %d or %d, got %d", http.StatusOK, http.StatusInternalServerError, w.Code)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Length") != "20" {
+		t.Errorf("Expected status %d with the file's length, got %d %v", http.StatusOK, w.Code, w.Header())
 	}
 
 	// Check WebDAV headers are set
@@ -301,40 +299,65 @@ func TestWebDAV_HEAD(t *testing.T) {
 }
 
 func TestWebDAV_InvalidPrefix(t *testing.T) {
-	tempDir, err := os.MkdirTemp("", "webdav_test")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	cfg, err := config.New(8080, "localhost", tempDir, "default", false, nil)
-	if err != nil {
-		t.Fatalf("Failed to create config: %v", err)
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
 	}
 
-	fs := filesystem.NewLocal(tempDir, false)
-	logger := slog.Default()
-	webdavHandler := NewWebDAV(fs, cfg, logger)
+	for _, prefix := range []string{"", "/remote.php/webdav"} {
+		cfg, err := config.New(8080, "localhost", tempDir, "default", false, nil)
+		if err != nil {
+			t.Fatalf("Failed to create config: %v", err)
+		}
+		cfg.WebDAVPrefix = prefix
+		webdavHandler := NewWebDAV(filesystem.NewLocal(tempDir, false), cfg, slog.Default())
+		davPrefix := cfg.DAVPrefix()
+
+		invalidPaths := []string{
+			"/invalid/test.txt",
+			"/files/test.txt",
+			"/test.txt",
+			davPrefix[:len(davPrefix)-1] + "/test.txt", // Last character missing
+			davPrefix + "x/test.txt",                   // Longer first segment
+		}
+		for _, path := range invalidPaths {
+			t.Run(path, func(t *testing.T) {
+				req := httptest.NewRequest("GET", path, nil)
+				w := httptest.NewRecorder()
+
+				webdavHandler.ServeHTTP(w, req)
+
+				if w.Code != http.StatusNotFound {
+					t.Errorf("Expected status %d for invalid path %s, got %d",
+						http.StatusNotFound, path, w.Code)
+				}
+			})
+		}
 
-	invalidPaths := []string{
-		"/invalid/test.txt",
-		"/files/test.txt",
-		"/test.txt",
-		"/da/test.txt", // Missing 'v' at end
+		req := httptest.NewRequest("PROPFIND", davPrefix+"/test.txt", nil)
+		req.Header.Set("Depth", "0")
+		w := httptest.NewRecorder()
+		webdavHandler.ServeHTTP(w, req)
+		if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), davPrefix+"/test.txt") {
+			t.Errorf("%s: expected the file, got %d %s", davPrefix, w.Code, w.Body.String())
+		}
 	}
+}
 
-	for _, path := range invalidPaths {
-		t.Run(path, func(t *testing.T) {
-			req := httptest.NewRequest("GET", path, nil)
-			w := httptest.NewRecorder()
-
-			webdavHandler.ServeHTTP(w, req)
+func TestWebDAV_RootPrefix(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	cfg := &config.Config{EnableWebDAV: true, WebDAVPrefix: "/"}
+	webdavHandler := NewWebDAV(filesystem.NewLocal(tempDir, false), cfg, slog.Default())
 
-			if w.Code != http.StatusNotFound {
-				t.Errorf("Expected status %d for invalid path %s, got %d",
-					http.StatusNotFound, path, w.Code)
-			}
-		})
+	req := httptest.NewRequest("PROPFIND", "/", nil)
+	req.Header.Set("Depth", "1")
+	w := httptest.NewRecorder()
+	webdavHandler.ServeHTTP(w, req)
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<D:href>/test.txt</D:href>") {
+		t.Errorf("Expected a listing with root hrefs, got %d %s", w.Code, w.Body.String())
 	}
 }
 
@@ -493,9 +516,8 @@ func TestWebDAV_ConcurrentRequests(t *testing.T) {
 			w := httptest.NewRecorder()
 			webdavHandler.ServeHTTP(w, req)
 
-			// Note: GET operations may fail due to seek limitations
-			if w.Code != http.StatusOK && w.Code != http.StatusInternalServerError {
-				t.Errorf("Concurrent request %d: expected status 200 or 500, got %d", id, w.Code)
+			if w.Code != http.StatusOK {
+				t.Errorf("Concurrent request %d: expected status 200, got %d", id, w.Code)
 			}
 			done <- true
 		}(i)
@@ -512,6 +534,7 @@ type mockFileSystem struct {
 	statError    error
 	openError    error
 	readDirError error
+	statIsDir    bool
 }
 
 func (m *mockFileSystem) Open(_ string) (io.ReadCloser, error) {
@@ -525,7 +548,7 @@ func (m *mockFileSystem) Stat(name string) (internal.FileInfo, error) {
 	if m.statError != nil {
 		return nil, m.statError
 	}
-	return &mockFileInfo{name: name, isDir: false}, nil
+	return &mockFileInfo{name: name, isDir: m.statIsDir}, nil
 }
 
 func (m *mockFileSystem) ReadDir(name string) ([]internal.FileInfo, error) {
@@ -550,6 +573,14 @@ func (m *mockFileSystem) Remove(_ string) error {
 	return os.ErrPermission
 }
 
+func (m *mockFileSystem) Rename(_, _ string) error {
+	return os.ErrPermission
+}
+
+func (m *mockFileSystem) Chtimes(_ string, _, _ time.Time) error {
+	return os.ErrPermission
+}
+
 type mockFileInfo struct {
 	name  string
 	size  int64
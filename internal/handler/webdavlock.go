@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// fakeLockTimeout is the lifetime, in seconds, a synthetic lock claims.
+// Nothing is held on the server, so clients simply refresh or forget it.
+const fakeLockTimeout = 60
+
+// maxLockInfoSize bounds the lockinfo body read from a LOCK request.
+const maxLockInfoSize = 64 << 10
+
+// lockTokenPattern finds the lock token in the If header of a refresh.
+var lockTokenPattern = regexp.MustCompile(`<(opaquelocktoken:[^>]+)>`)
+
+// lockInfo is the body of a LOCK request (RFC 4918, section 14.11).
+type lockInfo struct {
+	XMLName xml.Name `xml:"DAV: lockinfo"`
+	Scope   struct {
+		Shared *struct{} `xml:"DAV: shared"`
+	} `xml:"DAV: lockscope"`
+	Owner struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"DAV: owner"`
+}
+
+// serveFakeLock answers LOCK and UNLOCK on a read-only share. Finder and the
+// Windows redirector refuse to mount servers that do not support class 2
+// locking even when they only read, so LOCK grants a lock that is never
+// recorded and UNLOCK always succeeds. Writes stay blocked either way.
+func (w *WebDAV) serveFakeLock(rw http.ResponseWriter, r *http.Request, href string) {
+	if r.Method == "UNLOCK" {
+		if r.Header.Get("Lock-Token") == "" {
+			http.Error(rw, "Missing Lock-Token header", http.StatusBadRequest)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var info lockInfo
+	token := ""
+	if m := lockTokenPattern.FindStringSubmatch(r.Header.Get("If")); m != nil {
+		// A refresh has no body and keeps its token
+		token = m[1]
+	} else {
+		err := xml.NewDecoder(io.LimitReader(r.Body, maxLockInfoSize)).Decode(&info)
+		if err != nil && err != io.EOF {
+			http.Error(rw, "Malformed lockinfo", http.StatusBadRequest)
+			return
+		}
+		if token, err = newLockToken(); err != nil {
+			http.Error(rw, "Cannot create lock token", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	scope := "<D:exclusive/>"
+	if info.Scope.Shared != nil {
+		scope = "<D:shared/>"
+	}
+	depth := "infinity"
+	if r.Header.Get("Depth") == "0" {
+		depth = "0"
+	}
+	owner := ""
+	if strings.TrimSpace(info.Owner.Inner) != "" {
+		owner = "<D:owner>" + info.Owner.Inner + "</D:owner>"
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`)
+	b.WriteString(`<D:locktype><D:write/></D:locktype>`)
+	fmt.Fprintf(&b, `<D:lockscope>%s</D:lockscope><D:depth>%s</D:depth>%s`, scope, depth, owner)
+	fmt.Fprintf(&b, `<D:timeout>Second-%d</D:timeout>`, fakeLockTimeout)
+	fmt.Fprintf(&b, `<D:locktoken><D:href>%s</D:href></D:locktoken>`, xmlEscape(token))
+	fmt.Fprintf(&b, `<D:lockroot><D:href>%s</D:href></D:lockroot>`, xmlEscape(href))
+	b.WriteString(`</D:activelock></D:lockdiscovery></D:prop>`)
+
+	rw.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	rw.Header().Set("Lock-Token", "<"+token+">")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(rw, b.String())
+}
+
+// newLockToken returns an opaquelocktoken URI holding a random UUID.
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("opaquelocktoken:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// activeLock mirrors the lockdiscovery response of a LOCK request.
+type activeLock struct {
+	XMLName   xml.Name  `xml:"DAV: prop"`
+	LockType  string    `xml:"lockdiscovery>activelock>locktype>write"`
+	Exclusive *struct{} `xml:"lockdiscovery>activelock>lockscope>exclusive"`
+	Shared    *struct{} `xml:"lockdiscovery>activelock>lockscope>shared"`
+	Depth     string    `xml:"lockdiscovery>activelock>depth"`
+	Owner     string    `xml:"lockdiscovery>activelock>owner>href"`
+	Timeout   string    `xml:"lockdiscovery>activelock>timeout"`
+	Token     string    `xml:"lockdiscovery>activelock>locktoken>href"`
+	Root      string    `xml:"lockdiscovery>activelock>lockroot>href"`
+}
+
+func newFakeLockWebDAV(t *testing.T, fakeLocks bool) *WebDAV {
+	t.Helper()
+	cfg := &config.Config{EnableWebDAV: true, WebDAVFakeLocks: fakeLocks}
+	return NewWebDAV(filesystem.NewLocal(t.TempDir(), false), cfg, slog.Default())
+}
+
+func TestWebDAV_FakeLock(t *testing.T) {
+	h := newFakeLockWebDAV(t, true)
+
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype>
+<D:owner><D:href>http://example.com/~user</D:href></D:owner></D:lockinfo>`
+	req := httptest.NewRequest("LOCK", "/dav/doc.txt", strings.NewReader(body))
+	req.Header.Set("Depth", "0")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var lock activeLock
+	if err := xml.Unmarshal(w.Body.Bytes(), &lock); err != nil {
+		t.Fatalf("Invalid lock response: %v\n%s", err, w.Body.String())
+	}
+	uuid := regexp.MustCompile(`^opaquelocktoken:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(lock.Token) {
+		t.Errorf("Expected an opaquelocktoken UUID, got %q", lock.Token)
+	}
+	if got := w.Header().Get("Lock-Token"); got != "<"+lock.Token+">" {
+		t.Errorf("Expected Lock-Token header <%s>, got %q", lock.Token, got)
+	}
+	if lock.Exclusive == nil || lock.Shared != nil || lock.Depth != "0" || lock.Timeout != "Second-60" ||
+		lock.Owner != "http://example.com/~user" || lock.Root != "/dav/doc.txt" {
+		t.Errorf("Unexpected lock: %+v", lock)
+	}
+
+	// A refresh keeps its token
+	req = httptest.NewRequest("LOCK", "/dav/doc.txt", nil)
+	req.Header.Set("If", "(<"+lock.Token+">)")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var refreshed activeLock
+	if err := xml.Unmarshal(w.Body.Bytes(), &refreshed); err != nil || refreshed.Token != lock.Token {
+		t.Errorf("Expected the refresh to keep %s, got %q (%v)", lock.Token, refreshed.Token, err)
+	}
+
+	req = httptest.NewRequest("UNLOCK", "/dav/doc.txt", nil)
+	req.Header.Set("Lock-Token", "<"+lock.Token+">")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected UNLOCK to return %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("UNLOCK", "/dav/doc.txt", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected UNLOCK without a token to return %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Writes stay blocked
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/dav/doc.txt", strings.NewReader("x")))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected PUT to return %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestWebDAV_FakeLockBasePath(t *testing.T) {
+	h := middleware.BasePath("/files", false)(newFakeLockWebDAV(t, true))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("LOCK", "/files/dav/doc.txt", nil))
+
+	var lock activeLock
+	if err := xml.Unmarshal(w.Body.Bytes(), &lock); err != nil || lock.Root != "/files/dav/doc.txt" {
+		t.Errorf("Expected the lock root below the base path, got %q (%v)", lock.Root, err)
+	}
+}
+
+func TestWebDAV_OPTIONSAdvertisesLocks(t *testing.T) {
+	for _, fakeLocks := range []bool{true, false} {
+		w := httptest.NewRecorder()
+		newFakeLockWebDAV(t, fakeLocks).ServeHTTP(w, httptest.NewRequest("OPTIONS", "/dav/", nil))
+
+		if dav := w.Header().Get("DAV"); !strings.Contains(dav, "2") {
+			t.Errorf("Expected the DAV header to advertise class 2, got %q", dav)
+		}
+		if got := strings.Contains(w.Header().Get("Allow"), "LOCK"); got != fakeLocks {
+			t.Errorf("fake locks %v: expected LOCK in Allow to be %v, got %q", fakeLocks, fakeLocks, w.Header().Get("Allow"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	newFakeLockWebDAV(t, false).ServeHTTP(w, httptest.NewRequest("LOCK", "/dav/doc.txt", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected LOCK without fake locks to return %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
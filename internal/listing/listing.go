@@ -0,0 +1,298 @@
+// Package listing builds the directory listings the file handlers render, so
+// every theme and API response reads, filters and orders entries the same way.
+package listing
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+	"github.com/samzong/gofs/pkg/fileutil"
+)
+
+// Options control which entries a listing keeps.
+type Options struct {
+	// ShowHidden keeps the entries fileutil.IsHiddenPath hides, such as
+	// those whose names start with a dot. Backends may leave them out
+	// before the listing sees them.
+	ShowHidden bool
+	// SidecarSuffixes drops files named after a sibling file plus one of
+	// these suffixes, such as the .gz and .br copies served in place of the
+	// original.
+	SidecarSuffixes []string
+	// Overlay adds entries to the listing, replacing read ones of the same
+	// name, such as the mounts below a directory that shadow its own. They
+	// come first under every sort, in the order given.
+	Overlay []internal.FileInfo
+}
+
+// DirectoryListing is the canonical model of a listed directory.
+type DirectoryListing struct {
+	Path        string       // Directory relative to the mount without leading slash; "" is the root
+	Entries     []Entry      // Overlay, directories, then by case-insensitive name unless re-sorted with SortBy
+	Breadcrumbs []Breadcrumb // Ancestors of Path and Path itself, outermost first
+}
+
+// Entry is one file or directory of a listing.
+type Entry struct {
+	Info    internal.FileInfo
+	Name    string
+	ModTime time.Time
+	Mode    string            // Octal permissions, e.g. "0644"
+	Symlink string            // Target of a symbolic link
+	Owner   *FileOwner        // Nil where the backend does not know it
+	Kind    fileutil.FileKind // Group shown by the entry's icon
+	Size    int64
+	IsDir   bool
+	Pinned  bool // Added by Options.Overlay; listed first, in overlay order
+}
+
+// FileOwner is the numeric owner and group of an entry.
+type FileOwner struct {
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+// Breadcrumb is one directory on the way to the listed one. Path is relative
+// to the mount, with a leading slash and no trailing slash.
+type Breadcrumb struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Read lists dir on fsys. Entries are streamed with internal.ReadDirIter so
+// hidden files are dropped as they arrive.
+func Read(fsys internal.FileSystem, dir string, opts Options) (*DirectoryListing, error) {
+	var entries []Entry
+	err := internal.ReadDirIter(fsys, dir, func(fi internal.FileInfo) error {
+		if !opts.ShowHidden && fileutil.IsHiddenPath(path.Join(dir, fi.Name())) {
+			return nil
+		}
+		entries = append(entries, newEntry(fi))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.SidecarSuffixes) > 0 {
+		entries = dropSidecars(entries, opts.SidecarSuffixes)
+	}
+	if len(opts.Overlay) > 0 {
+		entries = overlay(entries, opts.Overlay)
+	}
+	Sort(entries)
+
+	return &DirectoryListing{
+		Path:        strings.Trim(dir, "/"),
+		Entries:     entries,
+		Breadcrumbs: Breadcrumbs(dir),
+	}, nil
+}
+
+// Count returns how many entries a listing of dir would hold, reading no
+// more than needed to know whether there are over limit. Past the limit it
+// returns limit and true.
+func Count(fsys internal.FileSystem, dir string, opts Options, limit int) (n int, capped bool, err error) {
+	var entries []Entry
+	err = internal.ReadDirIter(fsys, dir, func(fi internal.FileInfo) error {
+		if !opts.ShowHidden && fileutil.IsHiddenPath(path.Join(dir, fi.Name())) {
+			return nil
+		}
+		if len(entries) == limit {
+			capped = true
+			return fs.SkipAll
+		}
+		entries = append(entries, newEntry(fi))
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if capped {
+		return limit, true, nil
+	}
+	if len(opts.SidecarSuffixes) > 0 {
+		entries = dropSidecars(entries, opts.SidecarSuffixes)
+	}
+	return len(entries), false, nil
+}
+
+// Keys SortBy orders entries by.
+const (
+	SortName    = "name"
+	SortSize    = "size"
+	SortModTime = "modTime"
+)
+
+// Sort orders entries with directories first, then by case-insensitive name,
+// with the exact name breaking ties.
+func Sort(entries []Entry) {
+	SortBy(entries, SortName, false)
+}
+
+// SortBy orders entries with directories first, then by key, descending if
+// desc is set. Entries with equal keys are ordered by ascending name, so the
+// same entries always come out in the same order. An unknown key sorts
+// by name. Pinned entries stay ahead of all others in their current order.
+func SortBy(entries []Entry, key string, desc bool) {
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		if a.Pinned || b.Pinned {
+			switch {
+			case a.Pinned && b.Pinned:
+				return 0
+			case a.Pinned:
+				return -1
+			}
+			return 1
+		}
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		var c int
+		switch key {
+		case SortSize:
+			c = cmp.Compare(a.Size, b.Size)
+		case SortModTime:
+			c = a.ModTime.Compare(b.ModTime)
+		default:
+			c = compareNames(a.Name, b.Name)
+		}
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = compareNames(a.Name, b.Name)
+		}
+		return c
+	})
+}
+
+// compareNames compares case-insensitively, with the exact name breaking
+// ties.
+func compareNames(a, b string) int {
+	if c := strings.Compare(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// ETag returns a weak entity tag for the listing. It hashes the path and
+// every field the listings render of the sorted entries rather than relying
+// on the directory's modification time, which does not change when a file
+// inside it is rewritten.
+func (l *DirectoryListing) ETag() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n", l.Path)
+	for _, e := range l.Entries {
+		fmt.Fprintf(h, "%q %d %d %t %s %q", e.Name, e.Size, e.ModTime.UnixNano(), e.IsDir, e.Mode, e.Symlink)
+		if e.Owner != nil {
+			fmt.Fprintf(h, " %d:%d", e.Owner.UID, e.Owner.GID)
+		}
+		h.Write([]byte{'\n'})
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// Breadcrumbs returns the breadcrumbs of dir, or an empty slice at the
+// mount root.
+func Breadcrumbs(dir string) []Breadcrumb {
+	breadcrumbs := []Breadcrumb{}
+	currentPath := ""
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		currentPath = path.Join(currentPath, part)
+		breadcrumbs = append(breadcrumbs, Breadcrumb{
+			Name: part,
+			Path: "/" + currentPath,
+		})
+	}
+	return breadcrumbs
+}
+
+func newEntry(fi internal.FileInfo) Entry {
+	e := Entry{
+		Info:    fi,
+		Name:    fi.Name(),
+		ModTime: fi.ModTime(),
+		Mode:    OctalMode(internal.FileMode(fi)),
+		Symlink: internal.LinkTarget(fi),
+		Size:    fi.Size(),
+		IsDir:   fi.IsDir(),
+	}
+	if e.IsDir {
+		e.Kind = fileutil.KindFolder
+	} else {
+		e.Kind = fileutil.ClassifyMime(e.Name)
+	}
+	if uid, gid, ok := internal.FileOwner(fi); ok {
+		e.Owner = &FileOwner{UID: uid, GID: gid}
+	}
+	return e
+}
+
+// overlay replaces the entries named like one of infos by it and adds the
+// others.
+func overlay(entries []Entry, infos []internal.FileInfo) []Entry {
+	replaced := make(map[string]bool, len(infos))
+	for _, fi := range infos {
+		replaced[fi.Name()] = true
+	}
+	entries = slices.DeleteFunc(entries, func(e Entry) bool { return replaced[e.Name] })
+	for _, fi := range infos {
+		e := newEntry(fi)
+		e.Pinned = true
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// dropSidecars removes files whose name is that of a sibling file plus one
+// of suffixes.
+func dropSidecars(entries []Entry, suffixes []string) []Entry {
+	files := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if !e.IsDir {
+			files[e.Name] = true
+		}
+	}
+	return slices.DeleteFunc(entries, func(e Entry) bool {
+		if e.IsDir {
+			return false
+		}
+		for _, suffix := range suffixes {
+			if base, ok := strings.CutSuffix(e.Name, suffix); ok && base != "" && files[base] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// OctalMode formats the permission and setuid, setgid and sticky bits of m
+// the way chmod takes them, e.g. "0755" or "4755".
+func OctalMode(m os.FileMode) string {
+	bits := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if m&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if m&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
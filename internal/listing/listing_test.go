@@ -0,0 +1,258 @@
+package listing
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal"
+)
+
+type mockFS struct {
+	internal.FileSystem
+	entries []internal.FileInfo
+	err     error
+}
+
+func (m mockFS) ReadDir(string) ([]internal.FileInfo, error) { return m.entries, m.err }
+
+type mockFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (m *mockFileInfo) Name() string       { return m.name }
+func (m *mockFileInfo) Size() int64        { return m.size }
+func (m *mockFileInfo) IsDir() bool        { return m.isDir }
+func (m *mockFileInfo) ModTime() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+// mockExtendedFileInfo is a FileInfo from a backend with Unix metadata.
+type mockExtendedFileInfo struct {
+	mockFileInfo
+	mode       os.FileMode
+	linkTarget string
+}
+
+var _ internal.ExtendedFileInfo = (*mockExtendedFileInfo)(nil)
+
+func (m *mockExtendedFileInfo) Mode() os.FileMode              { return m.mode }
+func (m *mockExtendedFileInfo) LinkTarget() string             { return m.linkTarget }
+func (m *mockExtendedFileInfo) Owner() (uid, gid int, ok bool) { return 1000, 100, true }
+
+func names(l *DirectoryListing) []string {
+	var out []string
+	for _, e := range l.Entries {
+		out = append(out, e.Name)
+	}
+	return out
+}
+
+func TestRead(t *testing.T) {
+	fsys := mockFS{entries: []internal.FileInfo{
+		&mockFileInfo{name: "b.txt"},
+		&mockFileInfo{name: "B.txt"},
+		&mockFileInfo{name: "a.txt"},
+		&mockFileInfo{name: "a.txt.gz"},
+		&mockFileInfo{name: "a.txt.br"},
+		&mockFileInfo{name: "orphan.gz"},
+		&mockFileInfo{name: ".hidden"},
+		&mockFileInfo{name: "zdir", isDir: true},
+		&mockFileInfo{name: "Adir", isDir: true},
+		&mockFileInfo{name: "b.txt.gz", isDir: true},
+	}}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"Adir", "b.txt.gz", "zdir", "a.txt", "a.txt.br", "a.txt.gz", "B.txt", "b.txt", "orphan.gz"},
+		},
+		{
+			name: "hidden",
+			opts: Options{ShowHidden: true},
+			want: []string{"Adir", "b.txt.gz", "zdir", ".hidden", "a.txt", "a.txt.br", "a.txt.gz", "B.txt", "b.txt",
+				"orphan.gz"},
+		},
+		{
+			name: "sidecars",
+			opts: Options{SidecarSuffixes: []string{".gz", ".br"}},
+			want: []string{"Adir", "b.txt.gz", "zdir", "a.txt", "B.txt", "b.txt", "orphan.gz"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := Read(fsys, "/docs/", tt.opts)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if got := names(l); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if l.Path != "docs" {
+				t.Errorf("expected path docs, got %q", l.Path)
+			}
+		})
+	}
+}
+
+func TestRead_Error(t *testing.T) {
+	want := errors.New("boom")
+	if _, err := Read(mockFS{err: want}, "", Options{}); !errors.Is(err, want) {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
+
+func TestCount(t *testing.T) {
+	fsys := mockFS{entries: []internal.FileInfo{
+		&mockFileInfo{name: "a.txt"},
+		&mockFileInfo{name: "a.txt.gz"},
+		&mockFileInfo{name: ".hidden"},
+		&mockFileInfo{name: "sub", isDir: true},
+	}}
+
+	tests := []struct {
+		name       string
+		opts       Options
+		limit      int
+		wantN      int
+		wantCapped bool
+	}{
+		{name: "defaults", limit: 10, wantN: 3},
+		{name: "hidden", opts: Options{ShowHidden: true}, limit: 10, wantN: 4},
+		{name: "sidecars", opts: Options{SidecarSuffixes: []string{".gz"}}, limit: 10, wantN: 2},
+		{name: "limit reached", limit: 3, wantN: 3},
+		{name: "limit exceeded", limit: 2, wantN: 2, wantCapped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, capped, err := Count(fsys, "/docs", tt.opts, tt.limit)
+			if err != nil {
+				t.Fatalf("Count: %v", err)
+			}
+			if n != tt.wantN || capped != tt.wantCapped {
+				t.Errorf("got %d (capped %v), want %d (capped %v)", n, capped, tt.wantN, tt.wantCapped)
+			}
+		})
+	}
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	if got := Breadcrumbs(""); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty, non-nil slice at the root, got %#v", got)
+	}
+	want := []Breadcrumb{{Name: "a", Path: "/a"}, {Name: "b c", Path: "/a/b c"}}
+	if got := Breadcrumbs("/a/./b c/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOctalMode(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0o644, "0644"},
+		{os.ModeDir | 0o755, "0755"},
+		{os.ModeSetuid | 0o755, "4755"},
+		{os.ModeDir | os.ModeSticky | 0o777, "1777"},
+		{os.ModeSetgid | 0o2750, "2750"},
+	}
+	for _, tt := range tests {
+		if got := OctalMode(tt.mode); got != tt.want {
+			t.Errorf("OctalMode(%v) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestEntryMetadata(t *testing.T) {
+	e := newEntry(&mockFileInfo{name: "dir", isDir: true})
+	if e.Mode != "0755" || e.Symlink != "" || e.Owner != nil {
+		t.Errorf("basic backend: got mode %q, symlink %q, owner %v", e.Mode, e.Symlink, e.Owner)
+	}
+	if e = newEntry(&mockFileInfo{name: "file", size: 3}); e.Mode != "0644" || e.Size != 3 || e.IsDir {
+		t.Errorf("basic backend file: got %+v", e)
+	}
+
+	e = newEntry(&mockExtendedFileInfo{
+		mockFileInfo: mockFileInfo{name: "link"},
+		mode:         os.ModeSymlink | 0o777,
+		linkTarget:   "target.txt",
+	})
+	if e.Mode != "0777" || e.Symlink != "target.txt" || e.Owner == nil || e.Owner.UID != 1000 || e.Owner.GID != 100 {
+		t.Errorf("extended backend: got mode %q, symlink %q, owner %v", e.Mode, e.Symlink, e.Owner)
+	}
+}
+
+func TestRead_Overlay(t *testing.T) {
+	fsys := mockFS{entries: []internal.FileInfo{
+		&mockFileInfo{name: "extra", size: 10},
+		&mockFileInfo{name: "notes.txt"},
+	}}
+	opts := Options{Overlay: []internal.FileInfo{
+		&mockFileInfo{name: "extra", isDir: true},
+		&mockFileInfo{name: "docs", isDir: true},
+	}}
+
+	l, err := Read(fsys, "", opts)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got := names(l); !reflect.DeepEqual(got, []string{"extra", "docs", "notes.txt"}) {
+		t.Fatalf("expected the overlay merged in first, in its order, got %v", got)
+	}
+	if !l.Entries[0].IsDir || l.Entries[0].Size != 0 {
+		t.Errorf("expected the overlay to replace the read entry, got %+v", l.Entries[0])
+	}
+
+	SortBy(l.Entries, SortSize, true)
+	if got := names(l); !reflect.DeepEqual(got, []string{"extra", "docs", "notes.txt"}) {
+		t.Errorf("expected the overlay to stay first when re-sorted, got %v", got)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	entries := func() []Entry {
+		return []Entry{
+			{Name: "b.txt", Size: 10, ModTime: day},
+			{Name: "A.txt", Size: 30, ModTime: day.Add(time.Hour)},
+			{Name: "dir", IsDir: true, ModTime: day.Add(2 * time.Hour)},
+			{Name: "c.txt", Size: 10, ModTime: day.Add(-time.Hour)},
+			{Name: "a.txt", Size: 20, ModTime: day},
+		}
+	}
+	sorted := func(key string, desc bool) []string {
+		e := entries()
+		SortBy(e, key, desc)
+		var out []string
+		for _, entry := range e {
+			out = append(out, entry.Name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		key  string
+		desc bool
+		want []string
+	}{
+		{SortName, false, []string{"dir", "A.txt", "a.txt", "b.txt", "c.txt"}},
+		{SortName, true, []string{"dir", "c.txt", "b.txt", "a.txt", "A.txt"}},
+		// Equal sizes and times keep ascending names in both orders
+		{SortSize, false, []string{"dir", "b.txt", "c.txt", "a.txt", "A.txt"}},
+		{SortSize, true, []string{"dir", "A.txt", "a.txt", "b.txt", "c.txt"}},
+		{SortModTime, false, []string{"dir", "c.txt", "a.txt", "b.txt", "A.txt"}},
+		{SortModTime, true, []string{"dir", "A.txt", "a.txt", "b.txt", "c.txt"}},
+	}
+	for _, tt := range tests {
+		if got := sorted(tt.key, tt.desc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SortBy(%s, desc=%t) = %v, want %v", tt.key, tt.desc, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"container/list"
+	"context"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
@@ -13,7 +16,32 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Auth modes control which requests require credentials.
+const (
+	AuthModeAll       = "all"        // every request requires credentials
+	AuthModeWriteOnly = "write-only" // only state-changing requests require credentials
+)
+
+// Credential cache limits. Successful logins are remembered for cacheTTL in
+// an LRU of at most maxCachedCredentials entries; failed ones for
+// negativeCacheTTL so repeated bad credentials are rejected without paying
+// for another bcrypt comparison.
+const (
+	maxCachedCredentials = 1024
+	maxFailedCredentials = 4096
+	negativeCacheTTL     = 10 * time.Second
+)
+
+// credentialKey is the SHA-256 of an Authorization header's credentials, so
+// the caches never retain the encoded password itself.
+type credentialKey [sha256.Size]byte
+
+func cacheKey(encoded string) credentialKey {
+	return sha256.Sum256([]byte(encoded))
+}
+
 type authCache struct {
+	key        credentialKey
 	validUntil time.Time
 }
 
@@ -21,9 +49,12 @@ type BasicAuth struct {
 	realm        string
 	username     string
 	passwordHash []byte
-	cacheMu      sync.RWMutex
-	cache        map[string]*authCache
+	cacheMu      sync.Mutex
+	cache        map[credentialKey]*list.Element
+	cacheLRU     *list.List
+	failed       map[credentialKey]time.Time
 	cacheTTL     time.Duration
+	mode         string
 }
 
 func NewBasicAuth(realm, username, password string) (*BasicAuth, error) {
@@ -46,11 +77,56 @@ func NewBasicAuth(realm, username, password string) (*BasicAuth, error) {
 		realm:        realm,
 		username:     username,
 		passwordHash: passwordHash,
-		cache:        make(map[string]*authCache),
+		cache:        make(map[credentialKey]*list.Element),
+		cacheLRU:     list.New(),
+		failed:       make(map[credentialKey]time.Time),
 		cacheTTL:     5 * time.Minute,
+		mode:         AuthModeAll,
 	}, nil
 }
 
+// SetMode selects which requests require credentials. An empty mode
+// defaults to AuthModeAll.
+func (ba *BasicAuth) SetMode(mode string) error {
+	switch mode {
+	case "", AuthModeAll:
+		ba.mode = AuthModeAll
+	case AuthModeWriteOnly:
+		ba.mode = AuthModeWriteOnly
+	default:
+		return fmt.Errorf("invalid auth mode %q: expected %q or %q", mode, AuthModeAll, AuthModeWriteOnly)
+	}
+	return nil
+}
+
+// Mode returns the active auth mode.
+func (ba *BasicAuth) Mode() string {
+	return ba.mode
+}
+
+const usernameKey contextKey = "username"
+
+// WithUsername records name as the user a request was authenticated as.
+func WithUsername(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, usernameKey, name)
+}
+
+// Username returns the user BasicAuth authenticated r as, or "" when the
+// request carried no credentials it checked.
+func Username(r *http.Request) string {
+	name, _ := r.Context().Value(usernameKey).(string)
+	return name
+}
+
+// isReadOnlyMethod reports whether the method never modifies server state.
+func isReadOnlyMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		return true
+	}
+	return false
+}
+
 func NewBasicAuthFromCredentials(credentials string) (*BasicAuth, error) {
 	if credentials == "" {
 		return nil, errors.New("credentials cannot be empty")
@@ -81,6 +157,11 @@ func (ba *BasicAuth) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if ba.mode == AuthModeWriteOnly && isReadOnlyMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		auth := r.Header.Get("Authorization")
 		if auth == "" {
 			ba.requireAuth(w)
@@ -93,13 +174,13 @@ func (ba *BasicAuth) Middleware(next http.Handler) http.Handler {
 		}
 
 		encoded := auth[6:]
-
-		ba.cacheMu.RLock()
-		cached, found := ba.cache[encoded]
-		ba.cacheMu.RUnlock()
-
-		if found && time.Now().Before(cached.validUntil) {
-			next.ServeHTTP(w, r)
+		key := cacheKey(encoded)
+		switch ba.lookupCache(key) {
+		case cacheHit:
+			next.ServeHTTP(w, r.WithContext(WithUsername(r.Context(), ba.username)))
+			return
+		case cacheFailed:
+			ba.requireAuth(w)
 			return
 		}
 
@@ -128,28 +209,92 @@ func (ba *BasicAuth) Middleware(next http.Handler) http.Handler {
 		}
 
 		if usernameMatch == 1 && passwordMatch == 1 {
-			ba.cacheMu.Lock()
-			ba.cache[encoded] = &authCache{
-				validUntil: time.Now().Add(ba.cacheTTL),
-			}
-			ba.cleanupCacheLocked()
-			ba.cacheMu.Unlock()
-
-			next.ServeHTTP(w, r)
+			ba.rememberSuccess(key)
+			next.ServeHTTP(w, r.WithContext(WithUsername(r.Context(), ba.username)))
 			return
 		}
 
+		ba.rememberFailure(key)
 		ba.requireAuth(w)
 	})
 }
 
-func (ba *BasicAuth) cleanupCacheLocked() {
+type cacheResult int
+
+const (
+	cacheMiss cacheResult = iota
+	cacheHit
+	cacheFailed
+)
+
+// lookupCache reports whether key recently succeeded or failed.
+func (ba *BasicAuth) lookupCache(key credentialKey) cacheResult {
+	now := time.Now()
+
+	ba.cacheMu.Lock()
+	defer ba.cacheMu.Unlock()
+
+	if elem, ok := ba.cache[key]; ok {
+		if now.Before(elem.Value.(*authCache).validUntil) {
+			ba.cacheLRU.MoveToFront(elem)
+			return cacheHit
+		}
+		ba.cacheLRU.Remove(elem)
+		delete(ba.cache, key)
+	}
+
+	if failedAt, ok := ba.failed[key]; ok {
+		if now.Sub(failedAt) < negativeCacheTTL {
+			return cacheFailed
+		}
+		delete(ba.failed, key)
+	}
+	return cacheMiss
+}
+
+// rememberSuccess caches key as valid, evicting the least recently used
+// entry when the cache is full.
+func (ba *BasicAuth) rememberSuccess(key credentialKey) {
+	validUntil := time.Now().Add(ba.cacheTTL)
+
+	ba.cacheMu.Lock()
+	defer ba.cacheMu.Unlock()
+
+	if elem, ok := ba.cache[key]; ok {
+		elem.Value.(*authCache).validUntil = validUntil
+		ba.cacheLRU.MoveToFront(elem)
+		return
+	}
+	for ba.cacheLRU.Len() >= maxCachedCredentials {
+		oldest := ba.cacheLRU.Back()
+		ba.cacheLRU.Remove(oldest)
+		delete(ba.cache, oldest.Value.(*authCache).key)
+	}
+	ba.cache[key] = ba.cacheLRU.PushFront(&authCache{key: key, validUntil: validUntil})
+}
+
+// rememberFailure records a failed attempt for key. When the negative cache
+// is full, expired entries are dropped first and then arbitrary ones.
+func (ba *BasicAuth) rememberFailure(key credentialKey) {
 	now := time.Now()
-	for key, entry := range ba.cache {
-		if now.After(entry.validUntil) {
-			delete(ba.cache, key)
+
+	ba.cacheMu.Lock()
+	defer ba.cacheMu.Unlock()
+
+	if _, ok := ba.failed[key]; !ok && len(ba.failed) >= maxFailedCredentials {
+		for k, failedAt := range ba.failed {
+			if now.Sub(failedAt) >= negativeCacheTTL {
+				delete(ba.failed, k)
+			}
+		}
+		for k := range ba.failed {
+			if len(ba.failed) < maxFailedCredentials {
+				break
+			}
+			delete(ba.failed, k)
 		}
 	}
+	ba.failed[key] = now
 }
 
 func (ba *BasicAuth) requireAuth(w http.ResponseWriter) {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -396,6 +397,28 @@ func BenchmarkBasicAuthMiddleware_Failure(b *testing.B) {
 	}
 }
 
+// BenchmarkBasicAuthMiddleware_FailureUncached measures failures that miss the
+// negative cache, so every request pays for a bcrypt comparison.
+func BenchmarkBasicAuthMiddleware_FailureUncached(b *testing.B) {
+	auth, err := NewBasicAuth("test-realm", "admin", "secret")
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := auth.Middleware(nextHandler)
+
+	b.ResetTimer()
+	for i := range b.N {
+		credentials := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("admin:wrong%d", i)))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Basic "+credentials)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+	}
+}
+
 // Test to verify timing attack resistance
 func TestBasicAuthMiddleware_TimingAttackResistance(t *testing.T) {
 	auth, err := NewBasicAuth("test-realm", "admin", "verylongpasswordthatistotallysecret")
@@ -820,15 +843,96 @@ func TestBasicAuthMiddleware_Caching(t *testing.T) {
 	}
 
 	// Verify cache contains the credentials
-	auth.cacheMu.RLock()
-	_, found := auth.cache[credentials]
-	auth.cacheMu.RUnlock()
+	auth.cacheMu.Lock()
+	_, found := auth.cache[cacheKey(credentials)]
+	auth.cacheMu.Unlock()
 
 	if !found {
 		t.Error("expected credentials to be cached")
 	}
 }
 
+func TestBasicAuthMiddleware_NegativeCache(t *testing.T) {
+	auth, err := NewBasicAuth("test-realm", "admin", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(creds string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Basic "+creds)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	wrong := base64.StdEncoding.EncodeToString([]byte("admin:wrong"))
+	for i := range 3 {
+		if code := serve(wrong); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i, code)
+		}
+	}
+
+	auth.cacheMu.Lock()
+	_, failed := auth.failed[cacheKey(wrong)]
+	auth.cacheMu.Unlock()
+	if !failed {
+		t.Fatal("expected failed credentials to be cached")
+	}
+
+	// A cached failure must not block the correct password
+	right := base64.StdEncoding.EncodeToString([]byte("admin:secret"))
+	if code := serve(right); code != http.StatusOK {
+		t.Errorf("expected valid credentials to succeed, got %d", code)
+	}
+
+	// Expired failures are forgotten and checked again
+	auth.cacheMu.Lock()
+	auth.failed[cacheKey(wrong)] = time.Now().Add(-2 * negativeCacheTTL)
+	auth.cacheMu.Unlock()
+	if got := auth.lookupCache(cacheKey(wrong)); got != cacheMiss {
+		t.Errorf("expected expired failure to miss, got %v", got)
+	}
+}
+
+func TestBasicAuth_CacheBounds(t *testing.T) {
+	auth, err := NewBasicAuth("test-realm", "admin", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first := cacheKey("first")
+	auth.rememberSuccess(first)
+	auth.rememberSuccess(cacheKey("second"))
+	// Touch the first entry so the second becomes least recently used
+	if auth.lookupCache(first) != cacheHit {
+		t.Fatal("expected first entry to be cached")
+	}
+	for i := range maxCachedCredentials - 1 {
+		auth.rememberSuccess(cacheKey(fmt.Sprintf("filler-%d", i)))
+	}
+
+	if n := auth.cacheLRU.Len(); n != maxCachedCredentials || len(auth.cache) != n {
+		t.Errorf("expected %d cached entries, got list %d map %d", maxCachedCredentials, n, len(auth.cache))
+	}
+	if auth.lookupCache(cacheKey("second")) != cacheMiss {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if auth.lookupCache(first) != cacheHit {
+		t.Error("expected recently used entry to survive eviction")
+	}
+
+	for i := range maxFailedCredentials + 100 {
+		auth.rememberFailure(cacheKey(fmt.Sprintf("bad-%d", i)))
+	}
+	if n := len(auth.failed); n > maxFailedCredentials {
+		t.Errorf("expected at most %d failed entries, got %d", maxFailedCredentials, n)
+	}
+}
+
 // Test concurrent access safety
 func TestBasicAuthMiddleware_ConcurrentAccess(t *testing.T) {
 	auth, err := NewBasicAuth("test-realm", "admin", "secret")
@@ -906,3 +1010,93 @@ func TestBasicAuth_PasswordSecurity(t *testing.T) {
 		t.Error("different instances should generate different password hashes (salt should be different)")
 	}
 }
+
+func TestBasicAuth_SetMode(t *testing.T) {
+	auth, err := NewBasicAuth("test", "user", "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if auth.Mode() != AuthModeAll {
+		t.Errorf("expected default mode %q, got %q", AuthModeAll, auth.Mode())
+	}
+	if err := auth.SetMode(AuthModeWriteOnly); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth.Mode() != AuthModeWriteOnly {
+		t.Errorf("expected mode %q, got %q", AuthModeWriteOnly, auth.Mode())
+	}
+	if err := auth.SetMode("sometimes"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
+
+func TestBasicAuthMiddleware_WriteOnlyMode(t *testing.T) {
+	auth, err := NewBasicAuth("test", "user", "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := auth.SetMode(AuthModeWriteOnly); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method   string
+		expected int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodHead, http.StatusOK},
+		{http.MethodOptions, http.StatusOK},
+		{"PROPFIND", http.StatusOK},
+		{http.MethodPost, http.StatusUnauthorized},
+		{http.MethodPut, http.StatusUnauthorized},
+		{http.MethodDelete, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/upload", nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.expected {
+				t.Errorf("%s without credentials: expected %d, got %d", tt.method, tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestBasicAuthMiddleware_Username(t *testing.T) {
+	auth, err := NewBasicAuth("gofs", "alice", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := auth.SetMode(AuthModeWriteOnly); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var seen string
+	handler := auth.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = Username(r)
+	}))
+
+	credentials := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+	// The second request is answered from the credential cache
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/upload", nil)
+		req.Header.Set("Authorization", credentials)
+		seen = ""
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if seen != "alice" {
+			t.Errorf("request %d: expected username alice, got %q", i+1, seen)
+		}
+	}
+
+	seen = "unset"
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if seen != "" {
+		t.Errorf("expected no username on an unauthenticated read, got %q", seen)
+	}
+}
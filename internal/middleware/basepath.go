@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/samzong/gofs/internal/config"
+)
+
+// ForwardedPrefixHeader names the path prefix a reverse proxy serves gofs
+// under. It is only honoured with --trust-proxy.
+const ForwardedPrefixHeader = "X-Forwarded-Prefix"
+
+const (
+	basePathKey     contextKey = "base_path"
+	originalPathKey contextKey = "original_path"
+)
+
+// BasePath serves next below prefix, a path returned by
+// config.ParseBasePath. Requests under prefix have it stripped before
+// routing; others are assumed to come from a proxy that already stripped it.
+// The prefix is kept in the request context so handlers can generate links
+// with BasePathFromContext. With trustProxy, a valid X-Forwarded-Prefix
+// header replaces prefix.
+func BasePath(prefix string, trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if prefix == "" && !trustProxy {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			base := prefix
+			if trustProxy {
+				if forwarded := r.Header.Get(ForwardedPrefixHeader); forwarded != "" {
+					if p, err := config.ParseBasePath(forwarded); err == nil {
+						base = p
+					}
+				}
+			}
+			if base == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.URL.Path == base {
+				target := base + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
+
+			r2 := r.WithContext(context.WithValue(r.Context(), basePathKey, base))
+			if rest, ok := strings.CutPrefix(r.URL.Path, base+"/"); ok {
+				u := *r.URL
+				u.Path = "/" + rest
+				if u.RawPath != "" {
+					u.RawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(u.RawPath, base), "/")
+				}
+				r2.URL = &u
+			}
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// BasePathFromContext returns the prefix set by BasePath, or "" when gofs is
+// served from the root.
+func BasePathFromContext(ctx context.Context) string {
+	base, _ := ctx.Value(basePathKey).(string)
+	return base
+}
+
+// WithOriginalPath records path as the URL path of the request before a
+// handler stripped a prefix from a clone of it, so logs can name the path
+// the client asked for.
+func WithOriginalPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, originalPathKey, path)
+}
+
+// OriginalPath returns the path recorded by WithOriginalPath, or the path of
+// r when none was.
+func OriginalPath(r *http.Request) string {
+	if p, ok := r.Context().Value(originalPathKey).(string); ok {
+		return p
+	}
+	return r.URL.Path
+}
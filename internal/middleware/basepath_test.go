@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasePath(t *testing.T) {
+	var gotPath, gotRawPath, gotBase string
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotPath, gotRawPath, gotBase = r.URL.Path, r.URL.RawPath, BasePathFromContext(r.Context())
+	})
+
+	testCases := []struct {
+		name       string
+		prefix     string
+		trustProxy bool
+		target     string
+		forwarded  string
+		wantPath   string
+		wantBase   string
+	}{
+		{name: "strips prefix", prefix: "/files", target: "/files/docs/a.txt", wantPath: "/docs/a.txt", wantBase: "/files"},
+		{name: "prefix root", prefix: "/files", target: "/files/", wantPath: "/", wantBase: "/files"},
+		{name: "already stripped", prefix: "/files", target: "/docs/", wantPath: "/docs/", wantBase: "/files"},
+		{name: "prefix is a segment", prefix: "/files", target: "/filesystem/", wantPath: "/filesystem/", wantBase: "/files"},
+		{name: "no prefix", target: "/docs/", wantPath: "/docs/"},
+		{
+			name: "untrusted forwarded prefix", prefix: "/files", target: "/files/docs/", forwarded: "/evil",
+			wantPath: "/docs/", wantBase: "/files",
+		},
+		{
+			name: "trusted forwarded prefix", trustProxy: true, target: "/docs/", forwarded: "/proxied/",
+			wantPath: "/docs/", wantBase: "/proxied",
+		},
+		{
+			name: "forwarded prefix replaces flag", prefix: "/files", trustProxy: true, target: "/other/docs/",
+			forwarded: "/other", wantPath: "/docs/", wantBase: "/other",
+		},
+		{
+			name: "invalid forwarded prefix", prefix: "/files", trustProxy: true, target: "/files/docs/",
+			forwarded: "javascript:alert(1)", wantPath: "/docs/", wantBase: "/files",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotPath, gotBase = "", ""
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.forwarded != "" {
+				req.Header.Set(ForwardedPrefixHeader, tc.forwarded)
+			}
+			BasePath(tc.prefix, tc.trustProxy)(next).ServeHTTP(httptest.NewRecorder(), req)
+			if gotPath != tc.wantPath || gotBase != tc.wantBase {
+				t.Errorf("expected path %q base %q, got %q %q", tc.wantPath, tc.wantBase, gotPath, gotBase)
+			}
+		})
+	}
+
+	t.Run("strips escaped path", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/files/a%2Fb.txt", nil)
+		BasePath("/files", false)(next).ServeHTTP(httptest.NewRecorder(), req)
+		if gotPath != "/a/b.txt" || gotRawPath != "/a%2Fb.txt" {
+			t.Errorf("expected /a/b.txt (raw /a%%2Fb.txt), got %q (raw %q)", gotPath, gotRawPath)
+		}
+	})
+
+	t.Run("redirects bare prefix", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		BasePath("/files", false)(next).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/files?sort=name", nil))
+		if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "/files/?sort=name" {
+			t.Errorf("expected a redirect to /files/?sort=name, got %d %q", rr.Code, rr.Header().Get("Location"))
+		}
+	})
+}
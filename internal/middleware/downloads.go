@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+type downloadKey struct{}
+
+// CountDownloads calls onDownload after every GET request whose handler
+// reported a completed file download with MarkDownload. Listings, health
+// checks, HEAD requests and failed or interrupted transfers are not counted.
+func CountDownloads(onDownload func()) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+			downloaded := new(bool)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), downloadKey{}, downloaded)))
+			if *downloaded {
+				onDownload()
+			}
+		})
+	}
+}
+
+// MarkDownload records that the response to r delivered a file through to
+// its last byte. It does nothing outside CountDownloads.
+func MarkDownload(r *http.Request) {
+	if downloaded, ok := r.Context().Value(downloadKey{}).(*bool); ok {
+		*downloaded = true
+	}
+}
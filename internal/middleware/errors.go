@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader carries the request ID between clients, proxies and gofs.
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// RequestID assigns every request an ID, reusing a well-formed incoming
+// X-Request-ID header when present, and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// RequestIDFromContext returns the request ID assigned by RequestID, or an
+// empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts short IDs made of characters that are safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ErrorReporter renders error responses with generic, client-safe messages.
+// The underlying error, which may contain absolute filesystem paths, is only
+// logged together with the request ID. Debug re-enables verbose bodies for
+// local development.
+type ErrorReporter struct {
+	Logger *slog.Logger
+	Debug  bool
+}
+
+// Error writes a plain-text error response.
+func (e ErrorReporter) Error(w http.ResponseWriter, r *http.Request, message string, status int, err error) {
+	http.Error(w, e.body(r, message, status, err), status)
+}
+
+// JSONError writes a JSON error response.
+func (e ErrorReporter) JSONError(w http.ResponseWriter, r *http.Request, message string, status int, err error) {
+	WriteJSONError(w, e.body(r, message, status, err), status)
+}
+
+func (e ErrorReporter) body(r *http.Request, message string, status int, err error) string {
+	if err != nil {
+		e.log(r, message, status, err)
+	}
+	if e.Debug && err != nil {
+		return message + ": " + err.Error()
+	}
+	return message
+}
+
+func (e ErrorReporter) log(r *http.Request, message string, status int, err error) {
+	logger := e.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelDebug
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	logger.LogAttrs(r.Context(), level, message,
+		slog.String("request_id", RequestIDFromContext(r.Context())),
+		slog.String("method", r.Method),
+		slog.String("path", LogPath(r, OriginalPath(r))),
+		slog.Int("status", status),
+		slog.String("error", err.Error()),
+	)
+}
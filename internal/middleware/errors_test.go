@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	t.Run("generates_id", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if seen == "" {
+			t.Fatal("expected request ID in context")
+		}
+		if got := rr.Header().Get(RequestIDHeader); got != seen {
+			t.Errorf("expected response header %q, got %q", seen, got)
+		}
+	})
+
+	t.Run("reuses_valid_incoming_id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "abc-123_x.y")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if seen != "abc-123_x.y" {
+			t.Errorf("expected incoming ID to be reused, got %q", seen)
+		}
+	})
+
+	t.Run("replaces_unsafe_incoming_id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if seen == "" || strings.ContainsAny(seen, " \n") {
+			t.Errorf("expected a generated ID, got %q", seen)
+		}
+	})
+}
+
+func TestErrorReporter(t *testing.T) {
+	cause := errors.New("open /srv/secret/file.txt: permission denied")
+
+	t.Run("generic_body_and_logged_cause", func(t *testing.T) {
+		var logs bytes.Buffer
+		reporter := ErrorReporter{Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+
+		rr := httptest.NewRecorder()
+		RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reporter.Error(w, r, "Cannot open file", http.StatusInternalServerError, cause)
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/file.txt", nil))
+
+		if strings.Contains(rr.Body.String(), "/srv/secret") {
+			t.Errorf("body leaked internal path: %q", rr.Body.String())
+		}
+		if !strings.Contains(rr.Body.String(), "Cannot open file") {
+			t.Errorf("expected generic message, got %q", rr.Body.String())
+		}
+		requestID := rr.Header().Get(RequestIDHeader)
+		if !strings.Contains(logs.String(), "/srv/secret") || !strings.Contains(logs.String(), "request_id="+requestID) {
+			t.Errorf("expected cause and request ID in logs, got %q", logs.String())
+		}
+	})
+
+	t.Run("debug_includes_cause", func(t *testing.T) {
+		reporter := ErrorReporter{Logger: slog.New(slog.DiscardHandler), Debug: true}
+		rr := httptest.NewRecorder()
+		reporter.JSONError(rr, httptest.NewRequest(http.MethodPost, "/api/upload", nil),
+			"Failed to save file", http.StatusInternalServerError, cause)
+
+		var body map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if !strings.Contains(body["error"], "/srv/secret") {
+			t.Errorf("expected debug body to include cause, got %q", body["error"])
+		}
+	})
+}
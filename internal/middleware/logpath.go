@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"path"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+)
+
+const pathLoggerKey contextKey = "path_logger"
+
+// PathLogger rewrites request paths for logs that must not reveal which
+// files were asked for, following --log-path-mode.
+type PathLogger struct {
+	mode string
+	key  []byte
+}
+
+// NewPathLogger returns a PathLogger for mode, one of the config.LogPath*
+// modes. Hashes are HMAC-SHA256 under key, so the same path gets the same
+// hash on every line; without a key one is drawn at random, and hashes only
+// match within one run.
+func NewPathLogger(mode string, key []byte) *PathLogger {
+	if mode == config.LogPathHash && len(key) == 0 {
+		key = make([]byte, constants.LogPathKeySize)
+		_, _ = rand.Read(key)
+	}
+	return &PathLogger{mode: mode, key: key}
+}
+
+// Format returns urlPath as it should appear in logs.
+func (p *PathLogger) Format(urlPath string) string {
+	switch p.mode {
+	case config.LogPathHash:
+		mac := hmac.New(sha256.New, p.key)
+		mac.Write([]byte(urlPath))
+		return hex.EncodeToString(mac.Sum(nil)[:constants.LogPathHashSize])
+	case config.LogPathBasename:
+		return path.Base(urlPath)
+	}
+	return urlPath
+}
+
+// LogPaths makes LogPath format the paths of requests through it with p.
+// Logging middleware must run inside it.
+func LogPaths(p *PathLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if p == nil || p.mode == "" || p.mode == config.LogPathFull {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), pathLoggerKey, p)))
+		})
+	}
+}
+
+// LogPath returns urlPath, the path of r or one derived from it, as it
+// should appear in logs. Every log line naming a request path goes through
+// it; without LogPaths the path is returned unchanged.
+func LogPath(r *http.Request, urlPath string) string {
+	if p, ok := r.Context().Value(pathLoggerKey).(*PathLogger); ok {
+		return p.Format(urlPath)
+	}
+	return urlPath
+}
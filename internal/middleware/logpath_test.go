@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+)
+
+// loggedPaths serves targets through LogPaths(p) to a handler that logs
+// each request's path the way the logging middleware does, and returns the
+// logged paths.
+func loggedPaths(t *testing.T, p *PathLogger, targets ...string) []string {
+	t.Helper()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	handler := LogPaths(p)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		logger.Info("HTTP request", slog.String("path", LogPath(r, r.URL.Path)))
+	}))
+	paths := make([]string, 0, len(targets))
+	for _, target := range targets {
+		logs.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+		var entry map[string]any
+		if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+			t.Fatalf("expected one JSON log line, got %q", logs.String())
+		}
+		paths = append(paths, entry["path"].(string))
+	}
+	return paths
+}
+
+func TestLogPaths_Modes(t *testing.T) {
+	targets := []string{"/private/reports/q3.pdf", "/", "/docs/"}
+	testCases := []struct {
+		mode string
+		want []string
+	}{
+		{config.LogPathFull, targets},
+		{"", targets},
+		{config.LogPathBasename, []string{"q3.pdf", "/", "docs"}},
+	}
+	for _, tc := range testCases {
+		got := loggedPaths(t, NewPathLogger(tc.mode, nil), targets...)
+		for i := range targets {
+			if got[i] != tc.want[i] {
+				t.Errorf("mode %q: %s logged as %q, want %q", tc.mode, targets[i], got[i], tc.want[i])
+			}
+		}
+	}
+
+	hashed := loggedPaths(t, NewPathLogger(config.LogPathHash, []byte("key")), targets...)
+	for i, got := range hashed {
+		if !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(got) {
+			t.Errorf("hash: %s logged as %q, want 16 hex digits", targets[i], got)
+		}
+	}
+}
+
+func TestLogPaths_HashStable(t *testing.T) {
+	key := []byte("correlate")
+	p := NewPathLogger(config.LogPathHash, key)
+	got := loggedPaths(t, p, "/a/secret.txt", "/a/other.txt", "/a/secret.txt")
+	if got[0] != got[2] {
+		t.Errorf("the same path should hash alike across requests, got %q and %q", got[0], got[2])
+	}
+	if got[0] == got[1] {
+		t.Errorf("different paths should hash differently, both got %q", got[0])
+	}
+	if again := loggedPaths(t, NewPathLogger(config.LogPathHash, key), "/a/secret.txt"); again[0] != got[0] {
+		t.Errorf("the same key should give the same hash, got %q and %q", again[0], got[0])
+	}
+	if other := loggedPaths(t, NewPathLogger(config.LogPathHash, []byte("other")), "/a/secret.txt"); other[0] == got[0] {
+		t.Error("a different key should give a different hash")
+	}
+
+	// Without a key one is drawn per logger, still stable across its requests
+	random := NewPathLogger(config.LogPathHash, nil)
+	if got := loggedPaths(t, random, "/x", "/x"); got[0] != got[1] {
+		t.Errorf("a random key should still be stable, got %q and %q", got[0], got[1])
+	}
+}
+
+func TestLogPath_WithoutLogPaths(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/docs/a.txt", nil)
+	if got := LogPath(r, r.URL.Path); got != "/docs/a.txt" {
+		t.Errorf("expected the full path without LogPaths, got %q", got)
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Headers set by reverse proxies, honoured only with --trust-proxy.
+const (
+	ForwardedForHeader   = "X-Forwarded-For"
+	ForwardedProtoHeader = "X-Forwarded-Proto"
+	ForwardedHostHeader  = "X-Forwarded-Host"
+)
+
+const schemeKey contextKey = "scheme"
+
+// ProxyHeaders rewrites the request as the client sent it to the reverse
+// proxy in front of gofs: RemoteAddr becomes the client IP from
+// X-Forwarded-For, Host comes from X-Forwarded-Host and the scheme reported
+// by RequestScheme from X-Forwarded-Proto. Without trustProxy the headers are
+// ignored, since any client could set them.
+//
+// X-Forwarded-For is read from the right, skipping loopback and private
+// addresses, which are taken to be proxies; the first other address is the
+// client. If every hop is private, the leftmost one is used.
+func ProxyHeaders(trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !trustProxy {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r2 := r.Clone(r.Context())
+			if ip := forwardedClientIP(r.Header.Values(ForwardedForHeader)); ip != "" {
+				r2.RemoteAddr = ip
+			}
+			if host := forwardedHost(r.Header.Get(ForwardedHostHeader)); host != "" {
+				r2.Host = host
+			}
+			if proto := strings.ToLower(firstHeaderValue(r.Header.Get(ForwardedProtoHeader))); proto == "http" ||
+				proto == "https" {
+				r2 = r2.WithContext(context.WithValue(r2.Context(), schemeKey, proto))
+			}
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// RequestScheme returns "https" or "http" for the scheme the client used,
+// including one reported by a trusted proxy through ProxyHeaders.
+func RequestScheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(schemeKey).(string); ok {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// forwardedClientIP returns the rightmost X-Forwarded-For address that is not
+// a proxy, or "" if the header is missing or malformed.
+func forwardedClientIP(values []string) string {
+	var hops []string
+	for _, value := range values {
+		for hop := range strings.SplitSeq(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !ip.IsLoopback() && !ip.IsPrivate() {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedHost returns the first host in an X-Forwarded-Host header, or ""
+// if it is not a plain host[:port].
+func forwardedHost(value string) string {
+	host := firstHeaderValue(value)
+	if host == "" || strings.ContainsAny(host, "/\\@ \t") {
+		return ""
+	}
+	return host
+}
+
+func firstHeaderValue(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
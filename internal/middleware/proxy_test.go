@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	testCases := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{name: "missing", want: ""},
+		{name: "single client", values: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "skips private proxies", values: []string{"203.0.113.7, 10.0.0.2, 127.0.0.1"}, want: "203.0.113.7"},
+		{name: "rightmost untrusted hop", values: []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, want: "203.0.113.7"},
+		{name: "repeated headers", values: []string{"198.51.100.1", "203.0.113.7"}, want: "203.0.113.7"},
+		{name: "all private", values: []string{"192.168.1.5, 10.0.0.2"}, want: "192.168.1.5"},
+		{name: "ipv6", values: []string{"2001:db8::1, fd00::2"}, want: "2001:db8::1"},
+		{name: "malformed hop", values: []string{"203.0.113.7, bogus"}, want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := forwardedClientIP(tc.values); got != tc.want {
+				t.Errorf("forwardedClientIP(%q) = %q, want %q", tc.values, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProxyHeaders(t *testing.T) {
+	var got *http.Request
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { got = r })
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.2:41000"
+		req.Host = "gofs:8000"
+		req.Header.Set(ForwardedForHeader, "203.0.113.7")
+		req.Header.Set(ForwardedProtoHeader, "https")
+		req.Header.Set(ForwardedHostHeader, "files.example.com")
+		return req
+	}
+
+	t.Run("untrusted", func(t *testing.T) {
+		ProxyHeaders(false)(next).ServeHTTP(httptest.NewRecorder(), newRequest())
+		if got.RemoteAddr != "10.0.0.2:41000" || got.Host != "gofs:8000" || RequestScheme(got) != "http" {
+			t.Errorf("expected the headers to be ignored, got %s %s %s", got.RemoteAddr, got.Host, RequestScheme(got))
+		}
+	})
+
+	t.Run("trusted", func(t *testing.T) {
+		ProxyHeaders(true)(next).ServeHTTP(httptest.NewRecorder(), newRequest())
+		if got.RemoteAddr != "203.0.113.7" || got.Host != "files.example.com" || RequestScheme(got) != "https" {
+			t.Errorf("expected the forwarded client, got %s %s %s", got.RemoteAddr, got.Host, RequestScheme(got))
+		}
+	})
+
+	t.Run("trusted_invalid_values", func(t *testing.T) {
+		req := newRequest()
+		req.Header.Set(ForwardedProtoHeader, "gopher")
+		req.Header.Set(ForwardedHostHeader, "evil.example/path")
+		ProxyHeaders(true)(next).ServeHTTP(httptest.NewRecorder(), req)
+		if got.Host != "gofs:8000" || RequestScheme(got) != "http" {
+			t.Errorf("expected invalid headers to be ignored, got %s %s", got.Host, RequestScheme(got))
+		}
+	})
+}
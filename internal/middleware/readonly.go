@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ReadonlyServerCode identifies 403 responses to requests refused because
+// the server runs with --readonly.
+const ReadonlyServerCode = "READONLY_SERVER"
+
+// ReadonlyServerResponse is the body of a request refused by Readonly.
+type ReadonlyServerResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"` // Always ReadonlyServerCode
+}
+
+// readonlyPosts are the POST endpoints that only read. They are matched
+// against the end of the path so they pass below every mount.
+var readonlyPosts = []string{"/api/zip"}
+
+// davReadMethods are the methods a read-only WebDAV server answers, as
+// listed in Allow.
+var davReadMethods = []string{http.MethodOptions, http.MethodGet, http.MethodHead, "PROPFIND"}
+
+// davLockMethods are answered too when the WebDAV server grants fake locks,
+// which are never recorded and so change nothing.
+var davLockMethods = []string{"LOCK", "UNLOCK"}
+
+// Readonly refuses every request that could change a file. It decides by
+// method rather than by route, so a handler added later cannot be reached
+// by a write: only GET, HEAD and OPTIONS pass, and the POST endpoints in
+// readonlyPosts, which only read. With dav the requests are WebDAV ones:
+// PROPFIND passes too, LOCK and UNLOCK with fakeLocks, and the others are
+// answered 405 with Allow. Other requests are answered 403 with
+// ReadonlyServerCode.
+func Readonly(dav, fakeLocks bool) func(http.Handler) http.Handler {
+	allow := davReadMethods
+	if fakeLocks {
+		allow = append(slices.Clone(davReadMethods), davLockMethods...)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if readOnlyRequest(r, dav, fakeLocks) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if dav {
+				w.Header().Set("Allow", strings.Join(allow, ", "))
+				http.Error(w, "Method not allowed: the server is read-only", http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(ReadonlyServerResponse{
+				Error: "The server is read-only",
+				Code:  ReadonlyServerCode,
+			})
+		})
+	}
+}
+
+func readOnlyRequest(r *http.Request, dav, fakeLocks bool) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case "PROPFIND":
+		return dav
+	case "LOCK", "UNLOCK":
+		return dav && fakeLocks
+	case http.MethodPost:
+		for _, suffix := range readonlyPosts {
+			if !dav && strings.HasSuffix(r.URL.Path, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadonly(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+
+	tests := []struct {
+		method    string
+		path      string
+		dav       bool
+		fakeLocks bool
+		want      int
+	}{
+		{http.MethodGet, "/docs/a.txt", false, false, http.StatusTeapot},
+		{http.MethodHead, "/docs/a.txt", false, false, http.StatusTeapot},
+		{http.MethodOptions, "/", false, false, http.StatusTeapot},
+		{http.MethodPost, "/api/zip", false, false, http.StatusTeapot},
+		{http.MethodPost, "/docs/api/zip", false, false, http.StatusTeapot},
+		{http.MethodPost, "/api/upload", false, false, http.StatusForbidden},
+		{http.MethodPost, "/api/zipper", false, false, http.StatusForbidden},
+		{http.MethodPut, "/docs/a.txt", false, false, http.StatusForbidden},
+		{http.MethodDelete, "/docs/a.txt", false, false, http.StatusForbidden},
+		{"PROPFIND", "/docs/", false, false, http.StatusForbidden},
+		{"PROPFIND", "/dav/", true, false, http.StatusTeapot},
+		{http.MethodGet, "/dav/a.txt", true, false, http.StatusTeapot},
+		{http.MethodPost, "/dav/api/zip", true, false, http.StatusMethodNotAllowed},
+		{http.MethodPut, "/dav/a.txt", true, false, http.StatusMethodNotAllowed},
+		{"MKCOL", "/dav/new", true, false, http.StatusMethodNotAllowed},
+		{"LOCK", "/dav/a.txt", true, false, http.StatusMethodNotAllowed},
+		{"LOCK", "/dav/a.txt", true, true, http.StatusTeapot},
+		{"UNLOCK", "/dav/a.txt", true, true, http.StatusTeapot},
+		{http.MethodPut, "/dav/a.txt", true, true, http.StatusMethodNotAllowed},
+		{"LOCK", "/docs/a.txt", false, true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		Readonly(tt.dav, tt.fakeLocks)(next).ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.want {
+			t.Errorf("%s %s (dav %v): expected %d, got %d", tt.method, tt.path, tt.dav, tt.want, rr.Code)
+		}
+		switch rr.Code {
+		case http.StatusMethodNotAllowed:
+			allow := "OPTIONS, GET, HEAD, PROPFIND"
+			if tt.fakeLocks {
+				allow += ", LOCK, UNLOCK"
+			}
+			if rr.Header().Get("Allow") != allow {
+				t.Errorf("%s %s: unexpected Allow %q", tt.method, tt.path, rr.Header().Get("Allow"))
+			}
+		case http.StatusForbidden:
+			var body ReadonlyServerResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Code != ReadonlyServerCode {
+				t.Errorf("%s %s: unexpected body %s", tt.method, tt.path, rr.Body.String())
+			}
+		}
+	}
+}
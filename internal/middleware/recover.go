@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Recover turns a panic in next into a logged error and, if nothing has been
+// written yet, a 500 JSON error response. Each recovered panic increments
+// panics, which may be nil. http.ErrAbortHandler is re-raised so net/http
+// still aborts the connection quietly.
+func Recover(logger *slog.Logger, panics *atomic.Int64) func(http.Handler) http.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tracked := &headerTracker{ResponseWriter: w}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				if panics != nil {
+					panics.Add(1)
+				}
+				logger.LogAttrs(r.Context(), slog.LevelError, "Handler panic recovered",
+					slog.String("request_id", RequestIDFromContext(r.Context())),
+					slog.String("method", r.Method),
+					slog.String("path", LogPath(r, r.URL.Path)),
+					slog.String("remote_addr", r.RemoteAddr),
+					slog.String("panic", fmt.Sprint(p)),
+					slog.String("stack", string(debug.Stack())),
+				)
+				if !tracked.wroteHeader {
+					WriteJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(tracked, r)
+		})
+	}
+}
+
+// headerTracker records whether the response status has been sent.
+type headerTracker struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (t *headerTracker) WriteHeader(code int) {
+	t.wroteHeader = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *headerTracker) Write(b []byte) (int, error) {
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(b)
+}
+
+// ReadFrom passes through to the underlying writer so file responses keep
+// its sendfile path.
+func (t *headerTracker) ReadFrom(src io.Reader) (int64, error) {
+	t.wroteHeader = true
+	if rf, ok := t.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(t.ResponseWriter, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (t *headerTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	var panics atomic.Int64
+
+	t.Run("responds_with_json_error", func(t *testing.T) {
+		logs.Reset()
+		handler := RequestID(Recover(logger, &panics)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("template exploded")
+		})))
+
+		req := httptest.NewRequest(http.MethodGet, "/docs/", nil)
+		req.Header.Set(RequestIDHeader, "req-42")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d", rr.Code)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body["error"] != "Internal Server Error" {
+			t.Errorf("expected the JSON error envelope, got %q", rr.Body.String())
+		}
+
+		var entry map[string]any
+		if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+			t.Fatalf("expected one JSON log line, got %q", logs.String())
+		}
+		if entry["level"] != "ERROR" || entry["request_id"] != "req-42" || entry["panic"] != "template exploded" ||
+			entry["path"] != "/docs/" {
+			t.Errorf("unexpected log entry %v", entry)
+		}
+		if stack, _ := entry["stack"].(string); !strings.Contains(stack, "recover_test.go") {
+			t.Errorf("expected the stack to include the panicking handler, got %q", stack)
+		}
+		if got := panics.Load(); got != 1 {
+			t.Errorf("expected one counted panic, got %d", got)
+		}
+	})
+
+	t.Run("keeps_partial_response", func(t *testing.T) {
+		handler := Recover(logger, &panics)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("partial"))
+			panic("mid-stream")
+		}))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != "partial" {
+			t.Errorf("expected the partial response to be left alone, got %d %q", rr.Code, rr.Body.String())
+		}
+		if got := panics.Load(); got != 2 {
+			t.Errorf("expected two counted panics, got %d", got)
+		}
+	})
+
+	t.Run("reraises_abort_handler", func(t *testing.T) {
+		handler := Recover(logger, nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("expected http.ErrAbortHandler to propagate, got %v", p)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+// Codes of the responses RequestSanity sends for oversized requests.
+const (
+	URITooLongCode      = "URI_TOO_LONG"
+	HeadersTooLargeCode = "HEADERS_TOO_LARGE"
+	PathTooDeepCode     = "PATH_TOO_DEEP"
+	NameTooLongCode     = "NAME_TOO_LONG"
+)
+
+// SanityErrorResponse is the body of a 414 or 431 from RequestSanity.
+type SanityErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`  // One of the *Code constants above
+	Limit int64  `json:"limit"` // The limit that was exceeded
+}
+
+// SanityConfig holds the thresholds of RequestSanity. A zero limit or an
+// empty DenyPaths turns that check off.
+type SanityConfig struct {
+	MaxURLLength   int
+	MaxHeaderCount int
+	MaxHeaderSize  int64
+	PathLimits     pathsafe.Limits // Depth and segment length of the decoded request path
+	DenyPaths      []string        // Lower-case path.Match globs for a single path segment
+}
+
+// SanityConfigFor builds a SanityConfig from the server configuration.
+func SanityConfigFor(cfg *config.Config) SanityConfig {
+	return SanityConfig{
+		MaxURLLength:   cfg.MaxURLLength,
+		MaxHeaderCount: cfg.MaxHeaderCount,
+		MaxHeaderSize:  cfg.MaxHeaderSize,
+		PathLimits:     pathsafe.Limits{MaxDepth: cfg.MaxPathDepth, MaxNameLength: cfg.MaxNameLength},
+		DenyPaths:      cfg.DenyPaths,
+	}
+}
+
+func (c SanityConfig) enabled() bool {
+	return c.MaxURLLength > 0 || c.MaxHeaderCount > 0 || c.MaxHeaderSize > 0 || len(c.DenyPaths) > 0 ||
+		c.PathLimits != (pathsafe.Limits{})
+}
+
+// RequestSanity rejects requests no legitimate client sends before they reach
+// routing, auth or the filesystem: a request target longer than
+// MaxURLLength gets 414, more than MaxHeaderCount header lines or more than
+// MaxHeaderSize bytes of header names and values get 431, a path deeper or
+// with a longer segment than PathLimits gets 414, and a path with a segment
+// matching DenyPaths gets a plain 404. Rejections are logged as
+// warnings with the client address, at most once a minute per address.
+func RequestSanity(cfg SanityConfig, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !cfg.enabled() {
+			return next
+		}
+		if logger == nil {
+			logger = slog.Default()
+		}
+		warnings := newWarnLimiter(constants.SanityWarnInterval, constants.MaxSanityWarnSources)
+		warn := func(r *http.Request, reason string) {
+			if warnings.allow(clientIP(r.RemoteAddr), time.Now()) {
+				logger.Warn("Request rejected by sanity checks",
+					slog.String("reason", reason),
+					slog.String("method", r.Method),
+					slog.String("path", fmt.Sprintf("%q", truncate(LogPath(r, r.URL.Path), 256))),
+					slog.String("remote_addr", r.RemoteAddr),
+				)
+			}
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.MaxURLLength > 0 && requestTargetLength(r) > cfg.MaxURLLength {
+				warn(r, "url_length")
+				writeSanityError(w, "Request URL too long", URITooLongCode, http.StatusRequestURITooLong,
+					int64(cfg.MaxURLLength))
+				return
+			}
+			switch err := cfg.PathLimits.Check(r.URL.Path); {
+			case errors.Is(err, pathsafe.ErrTooDeep):
+				warn(r, "path_depth")
+				writeSanityError(w, "Request path too deep", PathTooDeepCode, http.StatusRequestURITooLong,
+					int64(cfg.PathLimits.MaxDepth))
+				return
+			case errors.Is(err, pathsafe.ErrNameTooLong):
+				warn(r, "name_length")
+				writeSanityError(w, "Request path segment too long", NameTooLongCode, http.StatusRequestURITooLong,
+					int64(cfg.PathLimits.MaxNameLength))
+				return
+			}
+			if cfg.MaxHeaderCount > 0 || cfg.MaxHeaderSize > 0 {
+				count, size := headerStats(r.Header)
+				switch {
+				case cfg.MaxHeaderCount > 0 && count > cfg.MaxHeaderCount:
+					warn(r, "header_count")
+					writeSanityError(w, "Too many request headers", HeadersTooLargeCode,
+						http.StatusRequestHeaderFieldsTooLarge, int64(cfg.MaxHeaderCount))
+					return
+				case cfg.MaxHeaderSize > 0 && size > cfg.MaxHeaderSize:
+					warn(r, "header_size")
+					writeSanityError(w, "Request headers too large", HeadersTooLargeCode,
+						http.StatusRequestHeaderFieldsTooLarge, cfg.MaxHeaderSize)
+					return
+				}
+			}
+			if config.DeniedPath(r.URL.Path, cfg.DenyPaths) {
+				warn(r, "deny_path")
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeSanityError(w http.ResponseWriter, message, code string, status int, limit int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(SanityErrorResponse{Error: message, Code: code, Limit: limit})
+}
+
+// requestTargetLength is the length of the request target as sent, path and
+// query included.
+func requestTargetLength(r *http.Request) int {
+	if r.RequestURI != "" {
+		return len(r.RequestURI)
+	}
+	return len(r.URL.RequestURI())
+}
+
+// headerStats counts header lines and the bytes of their names and values.
+// Host is not part of r.Header, so it is not counted.
+func headerStats(h http.Header) (count int, size int64) {
+	for name, values := range h {
+		for _, value := range values {
+			count++
+			size += int64(len(name) + len(value))
+		}
+	}
+	return count, size
+}
+
+// clientIP strips the port from a RemoteAddr.
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// warnLimiter lets through one warning per source and interval. It tracks at
+// most maxSources sources; once full, new sources are dropped until old ones
+// expire, so a flood from many addresses cannot grow it without bound.
+type warnLimiter struct {
+	mu         sync.Mutex
+	last       map[string]time.Time
+	interval   time.Duration
+	maxSources int
+}
+
+func newWarnLimiter(interval time.Duration, maxSources int) *warnLimiter {
+	return &warnLimiter{last: make(map[string]time.Time), interval: interval, maxSources: maxSources}
+}
+
+func (l *warnLimiter) allow(source string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last, ok := l.last[source]; ok && now.Sub(last) < l.interval {
+		return false
+	}
+	if len(l.last) >= l.maxSources {
+		for s, last := range l.last {
+			if now.Sub(last) >= l.interval {
+				delete(l.last, s)
+			}
+		}
+		if len(l.last) >= l.maxSources {
+			return false
+		}
+	}
+	l.last[source] = now
+	return true
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/pkg/pathsafe"
+)
+
+func TestRequestSanity(t *testing.T) {
+	cfg := SanityConfig{
+		MaxURLLength:   64,
+		MaxHeaderCount: 5,
+		MaxHeaderSize:  200,
+		DenyPaths:      []string{".env", "*.php", "cgi-bin"},
+	}
+
+	testCases := []struct {
+		name     string
+		target   string
+		headers  map[string]string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "normal", target: "/docs/report.pdf?download=1", wantCode: http.StatusOK},
+		{name: "at url limit", target: "/" + strings.Repeat("a", 63), wantCode: http.StatusOK},
+		{name: "url too long", target: "/" + strings.Repeat("a", 64), wantCode: http.StatusRequestURITooLong,
+			wantErr: URITooLongCode},
+		{name: "query counts", target: "/a?q=" + strings.Repeat("x", 64), wantCode: http.StatusRequestURITooLong,
+			wantErr: URITooLongCode},
+		{name: "too many headers", target: "/", wantCode: http.StatusRequestHeaderFieldsTooLarge,
+			headers: map[string]string{"A": "1", "B": "2", "C": "3", "D": "4", "E": "5", "F": "6"},
+			wantErr: HeadersTooLargeCode},
+		{name: "headers too large", target: "/", wantCode: http.StatusRequestHeaderFieldsTooLarge,
+			headers: map[string]string{"Cookie": strings.Repeat("c", 200)}, wantErr: HeadersTooLargeCode},
+		{name: "denied file", target: "/.env", wantCode: http.StatusNotFound},
+		{name: "denied nested", target: "/site/CGI-BIN/test.sh", wantCode: http.StatusNotFound},
+		{name: "denied glob", target: "/wp/index.php", wantCode: http.StatusNotFound},
+		{name: "pattern matches whole segment", target: "/docs/.envrc.txt", wantCode: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reached := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				reached = true
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			RequestSanity(cfg, slog.New(slog.DiscardHandler))(next).ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d", tc.wantCode, rr.Code)
+			}
+			if reached != (tc.wantCode == http.StatusOK) {
+				t.Errorf("next handler reached: %v", reached)
+			}
+			if tc.wantErr == "" {
+				return
+			}
+			var body SanityErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if body.Code != tc.wantErr || body.Limit == 0 || body.Error == "" {
+				t.Errorf("unexpected body %+v", body)
+			}
+		})
+	}
+}
+
+func TestRequestSanity_PathLimits(t *testing.T) {
+	cfg := SanityConfig{PathLimits: pathsafe.Limits{MaxDepth: 64, MaxNameLength: 255}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	testCases := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "at depth", target: strings.Repeat("/d", 63) + "/a.txt", wantCode: http.StatusOK},
+		{name: "too deep", target: strings.Repeat("/d", 64) + "/a.txt", wantCode: http.StatusRequestURITooLong,
+			wantErr: PathTooDeepCode},
+		{name: "slashes do not count", target: strings.Repeat("//", 100) + "a.txt", wantCode: http.StatusOK},
+		{name: "at length", target: "/docs/" + strings.Repeat("n", 255), wantCode: http.StatusOK},
+		{name: "name too long", target: "/docs/" + strings.Repeat("n", 256) + "/a.txt",
+			wantCode: http.StatusRequestURITooLong, wantErr: NameTooLongCode},
+		// The limit is on the decoded path: 100 escapes are 100 bytes
+		{name: "escapes decoded", target: "/" + strings.Repeat("%61", 100), wantCode: http.StatusOK},
+		{name: "query not counted", target: "/a?q=" + strings.Repeat("x", 1000), wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			RequestSanity(cfg, slog.New(slog.DiscardHandler))(next).ServeHTTP(rr,
+				httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if rr.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d", tc.wantCode, rr.Code)
+			}
+			if tc.wantErr == "" {
+				return
+			}
+			var body SanityErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if body.Code != tc.wantErr || body.Limit == 0 || body.Error == "" {
+				t.Errorf("unexpected body %+v", body)
+			}
+		})
+	}
+}
+
+func TestRequestSanity_Disabled(t *testing.T) {
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	newRequest := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target+"?"+strings.Repeat("q", 10000), nil)
+		for i := range 200 {
+			req.Header.Set("X-Header-"+strconv.Itoa(i), strings.Repeat("v", 100))
+		}
+		return req
+	}
+
+	rr := httptest.NewRecorder()
+	RequestSanity(SanityConfig{}, nil)(next).ServeHTTP(rr, newRequest("/.env"))
+	if rr.Code != http.StatusOK {
+		t.Errorf("every check off: expected 200, got %d", rr.Code)
+	}
+
+	// A single check leaves the others off
+	rr = httptest.NewRecorder()
+	RequestSanity(SanityConfig{DenyPaths: []string{".git"}}, nil)(next).ServeHTTP(rr, newRequest("/.env"))
+	if rr.Code != http.StatusOK {
+		t.Errorf("only the denylist on: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestRequestSanity_WarnRateLimited(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	h := RequestSanity(SanityConfig{DenyPaths: []string{".git"}}, logger)(http.NotFoundHandler())
+
+	probe := func(remoteAddr string) {
+		req := httptest.NewRequest(http.MethodGet, "/.git/config", nil)
+		req.RemoteAddr = remoteAddr
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	probe("203.0.113.7:1000")
+	probe("203.0.113.7:1001")
+	probe("198.51.100.1:2000")
+
+	if n := strings.Count(logs.String(), "level=WARN"); n != 2 {
+		t.Fatalf("expected one warning per address, got %d:\n%s", n, logs.String())
+	}
+	if !strings.Contains(logs.String(), "remote_addr=203.0.113.7:1000") ||
+		!strings.Contains(logs.String(), "reason=deny_path") {
+		t.Errorf("expected the source address and reason in the log:\n%s", logs.String())
+	}
+}
+
+func TestWarnLimiter(t *testing.T) {
+	l := newWarnLimiter(time.Minute, 2)
+	now := time.Now()
+
+	if !l.allow("a", now) || l.allow("a", now.Add(time.Second)) {
+		t.Error("expected one warning per interval")
+	}
+	if !l.allow("a", now.Add(time.Minute)) {
+		t.Error("expected a warning once the interval has passed")
+	}
+	if !l.allow("b", now.Add(time.Minute)) || l.allow("c", now.Add(time.Minute)) {
+		t.Error("expected new sources to be dropped while the limiter is full")
+	}
+	if !l.allow("c", now.Add(2*time.Minute)) {
+		t.Error("expected expired sources to make room")
+	}
+}
@@ -3,33 +3,68 @@ package middleware
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
+	"strconv"
 
-	"github.com/samzong/gofs/pkg/fileutil"
+	"github.com/samzong/gofs/internal/config"
 )
 
 // SecurityConfig defines security header configuration
 type SecurityConfig struct {
 	EnableSecurity        bool
 	ContentSecurityPolicy string
+	HSTSMaxAge            int  // Strict-Transport-Security max-age in seconds; 0 disables HSTS
+	HSTSIncludeSubDomains bool // Add includeSubDomains to Strict-Transport-Security
+	BehindTLSProxy        bool // Send HSTS on plain HTTP because a proxy terminates TLS
+	XSSProtection         bool
+	PermissionsPolicy     string
+}
+
+// SecurityConfigFor returns the security header configuration selected by
+// cfg, so every handler and the server emit the same header set.
+func SecurityConfigFor(cfg *config.Config) SecurityConfig {
+	return SecurityConfig{
+		EnableSecurity:        cfg.EnableSecurity,
+		HSTSMaxAge:            cfg.HSTSMaxAge,
+		HSTSIncludeSubDomains: cfg.HSTSIncludeSubDomains,
+		BehindTLSProxy:        cfg.BehindTLSProxy,
+		XSSProtection:         cfg.XSSProtection,
+		PermissionsPolicy:     cfg.PermissionsPolicy,
+	}
 }
 
 // SecurityHeaders applies common security headers to responses
 func SecurityHeaders(config SecurityConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			setSecurityHeaders(w, config)
+			setSecurityHeaders(w, r, config)
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
 // setSecurityHeaders applies the standard security headers
-func setSecurityHeaders(w http.ResponseWriter, config SecurityConfig) {
+func setSecurityHeaders(w http.ResponseWriter, r *http.Request, config SecurityConfig) {
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.Header().Set("X-Frame-Options", "DENY")
 	w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 
+	if config.XSSProtection {
+		w.Header().Set("X-XSS-Protection", "1; mode=block")
+	}
+	if config.PermissionsPolicy != "" {
+		w.Header().Set("Permissions-Policy", config.PermissionsPolicy)
+	}
+
+	// Browsers ignore HSTS received over plain HTTP, and sending it there
+	// would be wrong anyway unless a proxy in front terminates TLS.
+	if config.HSTSMaxAge > 0 && (r.TLS != nil || config.BehindTLSProxy) {
+		hsts := "max-age=" + strconv.Itoa(config.HSTSMaxAge)
+		if config.HSTSIncludeSubDomains {
+			hsts += "; includeSubDomains"
+		}
+		w.Header().Set("Strict-Transport-Security", hsts)
+	}
+
 	if config.EnableSecurity {
 		csp := config.ContentSecurityPolicy
 		if csp == "" {
@@ -51,21 +86,16 @@ func WriteJSON[T any](w http.ResponseWriter, data T) error {
 	return err
 }
 
+// ErrorResponse is the JSON envelope of API error responses.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
 // WriteJSONError writes a JSON error response with the specified status code
 func WriteJSONError(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
-	errorResponse := map[string]string{
-		"error": message,
-	}
-
 	// Best effort to encode error - if this fails, the error is already written
-	_ = json.NewEncoder(w).Encode(errorResponse)
-}
-
-// SafeRequestPath extracts and validates a safe path from an HTTP request path
-// This consolidates the common pattern of fileutil.SafePath(strings.TrimPrefix(path, "/"))
-func SafeRequestPath(path string) string {
-	return fileutil.SafePath(strings.TrimPrefix(path, "/"))
+	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: message})
 }
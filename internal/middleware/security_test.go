@@ -419,77 +419,6 @@ func TestWriteJSONError_EmptyMessage(t *testing.T) {
 	}
 }
 
-func TestSafeRequestPath_ValidPaths(t *testing.T) {
-	testCases := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{"empty_path", "", ""},
-		{"root_path", "/", ""},
-		{"simple_file", "/file.txt", "file.txt"},
-		{"nested_file", "/dir/file.txt", "dir/file.txt"},
-		{"deep_nested", "/a/b/c/d/file.txt", "a/b/c/d/file.txt"},
-		{"with_spaces", "/dir with spaces/file.txt", "dir with spaces/file.txt"},
-		{"unicode_path", "/测试/文件.txt", "测试/文件.txt"},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			result := SafeRequestPath(tc.input)
-			if result != tc.expected {
-				t.Errorf("Expected %q, got %q", tc.expected, result)
-			}
-		})
-	}
-}
-
-func TestSafeRequestPath_DangerousPaths(t *testing.T) {
-	testCases := []struct {
-		name  string
-		input string
-	}{
-		{"path_traversal_unix", "/../../etc/passwd"},
-		{"path_traversal_windows", "/..\\..\\windows\\system32\\config"},
-		{"relative_traversal", "/../../../etc/passwd"},
-		{"complex_traversal", "/dir/../../../etc/passwd"},
-		{"encoded_traversal", "/%2e%2e/etc/passwd"},
-		{"null_byte", "/file\x00.txt"},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			result := SafeRequestPath(tc.input)
-			// All dangerous paths should return empty string
-			if result != "" {
-				t.Errorf("Expected empty string for dangerous path %q, got %q", tc.input, result)
-			}
-		})
-	}
-}
-
-func TestSafeRequestPath_EdgeCases(t *testing.T) {
-	testCases := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{"multiple_slashes", "///file.txt", ""}, // Multiple slashes are treated as dangerous
-		{"trailing_slash", "/dir/", "dir"},
-		{"dot_path", "/./file.txt", "file.txt"},
-		{"absolute_without_leading_slash", "file.txt", "file.txt"},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			result := SafeRequestPath(tc.input)
-			if result != tc.expected {
-				t.Errorf("Expected %q, got %q", tc.expected, result)
-			}
-		})
-	}
-}
-
 // Test the interaction between security headers and JSON writing
 func TestSecurityHeaders_WithJSONResponse(t *testing.T) {
 	config := SecurityConfig{
@@ -596,18 +525,75 @@ func BenchmarkWriteJSON(b *testing.B) {
 	}
 }
 
-func BenchmarkSafeRequestPath(b *testing.B) {
-	testPaths := []string{
-		"/simple/file.txt",
-		"/deep/nested/path/to/file.txt",
-		"/../../etc/passwd",
-		"/dir with spaces/file.txt",
-		"/测试/文件.txt",
+func TestSecurityHeaders_OptionalHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		config SecurityConfig
+		tls    bool
+		want   map[string]string // "" means the header must be absent
+	}{
+		{
+			name:   "all disabled",
+			config: SecurityConfig{HSTSMaxAge: 0},
+			tls:    true,
+			want: map[string]string{
+				"Strict-Transport-Security": "",
+				"X-XSS-Protection":          "",
+				"Permissions-Policy":        "",
+			},
+		},
+		{
+			name:   "hsts over plain http",
+			config: SecurityConfig{HSTSMaxAge: 600},
+			want:   map[string]string{"Strict-Transport-Security": ""},
+		},
+		{
+			name:   "hsts over tls",
+			config: SecurityConfig{HSTSMaxAge: 600},
+			tls:    true,
+			want:   map[string]string{"Strict-Transport-Security": "max-age=600"},
+		},
+		{
+			name:   "hsts behind tls proxy",
+			config: SecurityConfig{HSTSMaxAge: 600, HSTSIncludeSubDomains: true, BehindTLSProxy: true},
+			want:   map[string]string{"Strict-Transport-Security": "max-age=600; includeSubDomains"},
+		},
+		{
+			name:   "proxy without max-age",
+			config: SecurityConfig{BehindTLSProxy: true},
+			want:   map[string]string{"Strict-Transport-Security": ""},
+		},
+		{
+			name:   "xss protection and permissions policy",
+			config: SecurityConfig{XSSProtection: true, PermissionsPolicy: "camera=()"},
+			want: map[string]string{
+				"X-XSS-Protection":   "1; mode=block",
+				"Permissions-Policy": "camera=()",
+			},
+		},
 	}
 
-	b.ResetTimer()
-	for i := range b.N {
-		path := testPaths[i%len(testPaths)]
-		SafeRequestPath(path)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := SecurityHeaders(tt.config)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			target := "http://example.com/"
+			if tt.tls {
+				target = "https://example.com/"
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+
+			for name, want := range tt.want {
+				got, present := rr.Header()[http.CanonicalHeaderKey(name)]
+				switch {
+				case want == "" && present:
+					t.Errorf("expected no %s header, got %q", name, got)
+				case want != "" && rr.Header().Get(name) != want:
+					t.Errorf("expected %s %q, got %q", name, want, rr.Header().Get(name))
+				}
+			}
+		})
 	}
 }
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal/constants"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// acmeHTTPPort is where ACME HTTP-01 challenges are answered and plain HTTP
+// is redirected to HTTPS.
+const acmeHTTPPort = 80
+
+// newACMEManager returns a certificate manager that obtains and renews
+// certificates for domains only, accepting the CA's terms of service.
+func newACMEManager(domains []string, cacheDir string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+	}
+}
+
+// httpsRedirect redirects requests for one of domains to the same URL over
+// HTTPS on httpsPort, keeping the method with 308 for anything but GET and
+// HEAD. Other hosts are refused so the listener is not an open redirect.
+func httpsRedirect(domains []string, httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if !slices.Contains(domains, host) {
+			http.Error(w, "Unknown host, use HTTPS", http.StatusMisdirectedRequest)
+			return
+		}
+
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, target, status)
+	})
+}
+
+// startACMEHTTP answers HTTP-01 challenges and redirects everything else to
+// HTTPS on port 80. It returns nil if the port cannot be bound, since
+// TLS-ALPN-01 challenges on port 443 still work without it.
+func (s *Server) startACMEHTTP(manager *autocert.Manager) *http.Server {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(acmeHTTPPort))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.logger.Warn("Cannot listen for ACME HTTP-01 challenges; only TLS-ALPN-01 on port 443 will work",
+			slog.String("address", addr),
+			slog.Any("error", err),
+		)
+		return nil
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           manager.HTTPHandler(httpsRedirect(s.config.ACMEDomains, s.config.Port)),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    constants.MaxHeaderBytes,
+	}
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("ACME HTTP server error", slog.String("address", addr), slog.Any("error", err))
+		}
+	}()
+	s.logger.Info("Redirecting HTTP to HTTPS and answering ACME challenges", slog.String("address", addr))
+	return srv
+}
+
+// serveACME serves the handler over TLS with certificates from manager.
+func (s *Server) serveACME(listener net.Listener, manager *autocert.Manager) error {
+	s.server.TLSConfig = manager.TLSConfig()
+	if err := s.server.ServeTLS(listener, "", ""); err != nil {
+		return fmt.Errorf("server failed to serve TLS: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	domains := []string{"files.example.com", "example.org"}
+
+	testCases := []struct {
+		name      string
+		method    string
+		target    string
+		port      int
+		wantCode  int
+		wantWhere string
+	}{
+		{name: "get", method: http.MethodGet, target: "http://files.example.com/docs/a.txt?x=1", port: 443,
+			wantCode: http.StatusMovedPermanently, wantWhere: "https://files.example.com/docs/a.txt?x=1"},
+		{name: "drops_http_port", method: http.MethodHead, target: "http://example.org:80/", port: 443,
+			wantCode: http.StatusMovedPermanently, wantWhere: "https://example.org/"},
+		{name: "custom_https_port", method: http.MethodGet, target: "http://example.org/a%20b", port: 8443,
+			wantCode: http.StatusMovedPermanently, wantWhere: "https://example.org:8443/a%20b"},
+		{name: "post_keeps_method", method: http.MethodPost, target: "http://example.org/api/upload", port: 443,
+			wantCode: http.StatusPermanentRedirect, wantWhere: "https://example.org/api/upload"},
+		{name: "case_and_trailing_dot", method: http.MethodGet, target: "http://FILES.example.com./", port: 443,
+			wantCode: http.StatusMovedPermanently, wantWhere: "https://files.example.com/"},
+		{name: "unknown_host", method: http.MethodGet, target: "http://evil.example.net/", port: 443,
+			wantCode: http.StatusMisdirectedRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			httpsRedirect(domains, tc.port).ServeHTTP(rr, httptest.NewRequest(tc.method, tc.target, nil))
+			if rr.Code != tc.wantCode {
+				t.Fatalf("expected status %d, got %d", tc.wantCode, rr.Code)
+			}
+			if got := rr.Header().Get("Location"); got != tc.wantWhere {
+				t.Errorf("expected Location %q, got %q", tc.wantWhere, got)
+			}
+		})
+	}
+}
+
+func TestACMEManager_HTTPHandler(t *testing.T) {
+	manager := newACMEManager([]string{"files.example.com"}, t.TempDir())
+	handler := manager.HTTPHandler(httpsRedirect([]string{"files.example.com"}, 443))
+
+	// Unknown challenge tokens are answered by autocert, not redirected
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet,
+		"http://files.example.com/.well-known/acme-challenge/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown challenge token, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://files.example.com/docs/", nil))
+	if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "https://files.example.com/docs/" {
+		t.Errorf("expected a redirect to HTTPS, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if err := manager.HostPolicy(t.Context(), "other.example.com"); err == nil {
+		t.Error("expected certificates to be refused for hosts not listed")
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// Health is the JSON body of /healthz and /readyz. Probes get the status,
+// uptime and version; ?verbose=1 adds the fields marked omitempty.
+type Health struct {
+	Status    string        `json:"status"`
+	Uptime    string        `json:"uptime"`
+	Version   string        `json:"version"`
+	Started   *time.Time    `json:"started,omitempty"`
+	GoVersion string        `json:"goVersion,omitempty"`
+	InFlight  *int64        `json:"inFlight,omitempty"`
+	Mounts    []MountHealth `json:"mounts,omitempty"`
+}
+
+// MountHealth is the readiness of one mount in a verbose /readyz. Error is
+// a short reason rather than the underlying error, which would name the
+// local directory to unauthenticated clients.
+type MountHealth struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Health statuses.
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// healthHandler answers /healthz and /readyz. /healthz only reports that the
+// process serves requests and never touches the filesystem; /readyz also
+// checks that every mounted directory can be listed.
+type healthHandler struct {
+	started  time.Time
+	version  string
+	mounts   []config.DirMount
+	inFlight func() int64
+}
+
+func newHealthHandler(cfg *config.Config, inFlight func() int64) *healthHandler {
+	version := cfg.Version
+	if version == "" {
+		version = "dev"
+	}
+	return &healthHandler{
+		started:  time.Now(),
+		version:  version,
+		mounts:   cfg.Dirs,
+		inFlight: inFlight,
+	}
+}
+
+// wrap answers the health endpoints and passes every other request to next.
+func (h *healthHandler) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			h.serve(w, r, false)
+		case "/readyz":
+			h.serve(w, r, true)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (h *healthHandler) serve(w http.ResponseWriter, r *http.Request, ready bool) {
+	verbose := r.URL.Query().Get("verbose") == "1"
+	health := Health{
+		Status:  HealthOK,
+		Uptime:  time.Since(h.started).Round(time.Second).String(),
+		Version: h.version,
+	}
+	if verbose {
+		started := h.started.UTC()
+		inFlight := h.inFlight()
+		health.Started = &started
+		health.GoVersion = runtime.Version()
+		health.InFlight = &inFlight
+	}
+	if ready {
+		for _, mount := range h.mounts {
+			if mount.AliasOf != "" || mount.IsRemote() {
+				continue // Remote mounts answer 503 on their own when down
+			}
+			status := MountHealth{Path: mount.Path, Status: HealthOK}
+			if reason := CheckMount(mount.Dir); reason != "" {
+				health.Status = HealthUnavailable
+				status = MountHealth{Path: mount.Path, Status: HealthUnavailable, Error: reason}
+			}
+			if verbose {
+				health.Mounts = append(health.Mounts, status)
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if health.Status != HealthOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = middleware.WriteJSON(w, health)
+}
+
+// CheckMount returns why dir cannot be served, or "" when it can.
+func CheckMount(dir string) string {
+	f, err := os.Open(dir)
+	if err != nil {
+		return mountReason(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return mountReason(err)
+	}
+	if !info.IsDir() {
+		return "not a directory"
+	}
+	if _, err := f.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return mountReason(err)
+	}
+	return ""
+}
+
+func mountReason(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "missing"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied"
+	default:
+		return "unreadable"
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+)
+
+func TestHealthHandler(t *testing.T) {
+	root := t.TempDir()
+	missing := filepath.Join(root, "gone")
+	if err := os.Mkdir(missing, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Version: "1.2.3", Dirs: []config.DirMount{
+		{Path: "/", Dir: root},
+		{Path: "/gone", Dir: missing},
+		{Path: "/again", Dir: missing, AliasOf: "/gone"},
+	}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Not Found")
+	})
+	h := newHealthHandler(cfg, func() int64 { return 3 }).wrap(next)
+
+	get := func(target string) (*httptest.ResponseRecorder, map[string]any) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("%s: expected JSON, got %q: %s", target, rr.Header().Get("Content-Type"), rr.Body.String())
+		}
+		var body map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", target, err)
+		}
+		return rr, body
+	}
+	fields := func(body map[string]any) []string {
+		var names []string
+		for _, name := range []string{"status", "uptime", "version", "started", "goVersion", "inFlight", "mounts"} {
+			if _, ok := body[name]; ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	for _, tc := range []struct {
+		target     string
+		wantCode   int
+		wantStatus string
+		wantFields string
+	}{
+		{"/healthz", http.StatusOK, "ok", "[status uptime version]"},
+		{"/healthz?verbose=1", http.StatusOK, "ok", "[status uptime version started goVersion inFlight]"},
+		{"/readyz", http.StatusOK, "ok", "[status uptime version]"},
+		{"/readyz?verbose=1", http.StatusOK, "ok", "[status uptime version started goVersion inFlight mounts]"},
+	} {
+		rr, body := get(tc.target)
+		if rr.Code != tc.wantCode || body["status"] != tc.wantStatus || body["version"] != "1.2.3" {
+			t.Errorf("%s: expected %d %q, got %d %v", tc.target, tc.wantCode, tc.wantStatus, rr.Code, body)
+		}
+		if got := fmt.Sprint(fields(body)); got != tc.wantFields {
+			t.Errorf("%s: expected fields %s, got %s", tc.target, tc.wantFields, got)
+		}
+		if rr.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: expected the response not to be cached", tc.target)
+		}
+	}
+
+	if err := os.Remove(missing); err != nil {
+		t.Fatal(err)
+	}
+	if rr, body := get("/healthz"); rr.Code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("expected liveness to ignore the mounts, got %d %v", rr.Code, body)
+	}
+	if rr, body := get("/readyz"); rr.Code != http.StatusServiceUnavailable || body["status"] != "unavailable" {
+		t.Errorf("expected a missing mount to fail readiness, got %d %v", rr.Code, body)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz?verbose=1", nil))
+	var health Health
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := []MountHealth{{Path: "/", Status: "ok"}, {Path: "/gone", Status: "unavailable", Error: "missing"}}
+	if fmt.Sprint(health.Mounts) != fmt.Sprint(want) || *health.InFlight != 3 {
+		t.Errorf("expected %v, got %+v", want, health)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/files", nil))
+	if rr.Code != http.StatusNotFound || rr.Body.String() != "Not Found" {
+		t.Errorf("expected other paths to reach the handler, got %d %q", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+// serveLimits asks for the server to be shut down after maxDownloads file
+// downloads or once timeout has elapsed, whichever comes first. Zero values
+// disable either limit.
+type serveLimits struct {
+	maxDownloads int64
+	timeout      time.Duration
+
+	downloads atomic.Int64
+	reached   chan string // receives the reason once a limit is reached
+	done      atomic.Bool
+	once      sync.Once
+}
+
+func newServeLimits(maxDownloads int, timeout time.Duration) *serveLimits {
+	return &serveLimits{
+		maxDownloads: int64(maxDownloads),
+		timeout:      timeout,
+		reached:      make(chan string, 1),
+	}
+}
+
+func (l *serveLimits) enabled() bool {
+	return l.maxDownloads > 0 || l.timeout > 0
+}
+
+// start begins the timeout, if any.
+func (l *serveLimits) start() {
+	if l.timeout > 0 {
+		time.AfterFunc(l.timeout, func() {
+			l.stop(fmt.Sprintf("timeout of %s elapsed", l.timeout))
+		})
+	}
+}
+
+func (l *serveLimits) countDownload() {
+	if l.maxDownloads > 0 && l.downloads.Add(1) == l.maxDownloads {
+		l.stop(fmt.Sprintf("served %d downloads", l.maxDownloads))
+	}
+}
+
+func (l *serveLimits) stop(reason string) {
+	l.once.Do(func() {
+		l.done.Store(true)
+		l.reached <- reason
+	})
+}
+
+// wrap counts downloads served by next and refuses new requests with 503
+// once a limit has been reached, while the server shuts down.
+func (l *serveLimits) wrap(next http.Handler) http.Handler {
+	if !l.enabled() {
+		return next
+	}
+	counted := middleware.CountDownloads(l.countDownload)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.done.Load() {
+			w.Header().Set("Connection", "close")
+			middleware.WriteJSONError(w, "Server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		counted.ServeHTTP(w, r)
+	})
+}
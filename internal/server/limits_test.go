@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+func TestServeLimits_MaxDownloads(t *testing.T) {
+	limits := newServeLimits(2, 0)
+	h := limits.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file" {
+			middleware.MarkDownload(r)
+		}
+	}))
+	serve := func(method, path string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr.Code
+	}
+
+	serve(http.MethodGet, "/file")
+	serve(http.MethodHead, "/file")
+	serve(http.MethodGet, "/listing")
+	select {
+	case reason := <-limits.reached:
+		t.Fatalf("limit reached early: %s", reason)
+	default:
+	}
+
+	serve(http.MethodGet, "/file")
+	select {
+	case reason := <-limits.reached:
+		if reason != "served 2 downloads" {
+			t.Errorf("unexpected reason %q", reason)
+		}
+	default:
+		t.Fatal("expected the limit to be reached")
+	}
+	if status := serve(http.MethodGet, "/file"); status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 once the limit is reached, got %d", status)
+	}
+}
+
+func TestServeLimits_Timeout(t *testing.T) {
+	limits := newServeLimits(0, 10*time.Millisecond)
+	limits.start()
+	select {
+	case reason := <-limits.reached:
+		if reason != "timeout of 10ms elapsed" {
+			t.Errorf("unexpected reason %q", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the timeout to be reached")
+	}
+}
@@ -4,14 +4,18 @@ package server
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
 	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/internal/tracing"
 )
 
 // Server implements a lightweight HTTP file server with graceful shutdown support.
@@ -20,22 +24,14 @@ type Server struct {
 	handler       http.Handler
 	webdavHandler http.Handler
 	server        *http.Server
+	acmeHTTP      *http.Server // Port 80 challenge and redirect server; nil without ACME
 	listener      net.Listener
 	logger        *slog.Logger
 	mu            sync.RWMutex
-}
-
-// healthCheckMiddleware wraps a handler to add health check endpoint.
-func healthCheckMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/healthz", "/readyz":
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprint(w, "OK")
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+	panics        *atomic.Int64
+	inFlight      *atomic.Int64
+	limits        *serveLimits
+	tracer        *tracing.Tracer // nil unless --otel-endpoint is set
 }
 
 // loggingMiddleware provides simple HTTP request logging using slog
@@ -50,9 +46,10 @@ func loggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 			next.ServeHTTP(wrapped, r)
 
 			duration := time.Since(start)
-			logger.Info("HTTP request",
+			logger.InfoContext(r.Context(), "HTTP request",
+				slog.String("request_id", middleware.RequestIDFromContext(r.Context())),
 				slog.String("method", r.Method),
-				slog.String("path", fmt.Sprintf("%q", r.URL.Path)),
+				slog.String("path", fmt.Sprintf("%q", middleware.LogPath(r, r.URL.Path))),
 				slog.String("remote_addr", r.RemoteAddr),
 				slog.Int("status", wrapped.statusCode),
 				slog.Duration("duration", duration),
@@ -61,6 +58,17 @@ func loggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// countInFlight keeps counter at the number of requests inside next.
+func countInFlight(counter *atomic.Int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counter.Add(1)
+			defer counter.Add(-1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // responseWriter wraps http.ResponseWriter to capture status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -72,9 +80,24 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// ReadFrom passes through to the underlying writer so file responses keep
+// its sendfile path.
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(rw.ResponseWriter, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // New creates a new HTTP server instance with the given configuration and handler.
 // The authMiddleware parameter is optional; if nil, no authentication is required.
-// The webdavHandler parameter is optional; if provided, WebDAV will be enabled on /dav path.
+// The webdavHandler parameter is optional; if provided, WebDAV will be enabled under
+// cfg.DAVPrefix(). A prefix of "/" serves only WebDAV and handler is not used.
 func New(cfg *config.Config, handler http.Handler, webdavHandler http.Handler,
 	authMiddleware *middleware.BasicAuth, logger *slog.Logger) *Server {
 	if logger == nil {
@@ -82,48 +105,135 @@ func New(cfg *config.Config, handler http.Handler, webdavHandler http.Handler,
 	}
 
 	componentLogger := logger.With(slog.String("component", "server"))
+	limits := newServeLimits(cfg.MaxRequests, cfg.ShutdownAfter)
+
+	inFlight := &atomic.Int64{}
+	health := newHealthHandler(cfg, inFlight.Load)
+	wellKnown := newWellKnownHandler(cfg)
+
+	// withWellKnown answers the well-known paths inside authentication with
+	// --well-known-auth and ahead of it otherwise
+	withWellKnown := func(h http.Handler) http.Handler {
+		if authMiddleware != nil && !cfg.WellKnownAuth {
+			return wellKnown.wrap(authMiddleware.Middleware(h))
+		}
+		if authMiddleware != nil {
+			return authMiddleware.Middleware(wellKnown.wrap(h))
+		}
+		return wellKnown.wrap(h)
+	}
 
 	// Build simple middleware chain for the main handler
 	var finalHandler = handler
 
 	// Add health check middleware (first in chain)
-	finalHandler = healthCheckMiddleware(finalHandler)
+	finalHandler = health.wrap(finalHandler)
+
+	// Add authentication middleware if provided, and the well-known paths
+	finalHandler = withWellKnown(finalHandler)
 
-	// Add authentication middleware if provided
-	if authMiddleware != nil {
-		finalHandler = authMiddleware.Middleware(finalHandler)
+	// Count downloads for --max-requests and refuse requests once stopping
+	finalHandler = limits.wrap(finalHandler)
+
+	// --readonly refuses writes by method ahead of every handler, so none is
+	// reachable by a write whatever checks of its own it has
+	withReadonly := func(h http.Handler, _ bool) http.Handler { return h }
+	if cfg.Readonly {
+		withReadonly = func(h http.Handler, dav bool) http.Handler {
+			return middleware.Readonly(dav, dav && cfg.WebDAVFakeLocks)(h)
+		}
 	}
+	finalHandler = withReadonly(finalHandler, false)
+
+	// Security headers wrap auth so 401s and other errors carry them too
+	securityHeaders := middleware.SecurityHeaders(middleware.SecurityConfigFor(cfg))
+	finalHandler = securityHeaders(finalHandler)
+
+	// Recover panics inside logging so the 500 is logged like any other response
+	panics := &atomic.Int64{}
+	recoverPanics := middleware.Recover(componentLogger, panics)
+	finalHandler = recoverPanics(finalHandler)
 
-	// Add HTTP request logging middleware (last in chain)
+	// Add HTTP request logging middleware
 	finalHandler = loggingMiddleware(componentLogger)(finalHandler)
 
+	// Trace outside logging so the request's log line carries its trace ID.
+	// Without --otel-endpoint nothing is traced and no exporter is started.
+	var tracer *tracing.Tracer
+	withTracing := func(h http.Handler) http.Handler { return h }
+	if cfg.OTelEndpoint != "" {
+		var err error
+		if tracer, err = tracing.NewOTLP(cfg.OTelEndpoint, "gofs", componentLogger); err != nil {
+			componentLogger.Error("Cannot start the trace exporter, requests are not traced", slog.Any("error", err))
+		} else {
+			withTracing = tracing.Middleware(tracer)
+		}
+	}
+	finalHandler = withTracing(finalHandler)
+
+	// Assign request IDs before logging so every log line can be correlated (last in chain)
+	finalHandler = middleware.RequestID(finalHandler)
+
 	// Apply middleware to WebDAV handler if provided
 	var finalWebDAVHandler http.Handler
+	davPrefix := cfg.DAVPrefix()
 	if webdavHandler != nil {
 		finalWebDAVHandler = webdavHandler
-		if authMiddleware != nil {
+		switch {
+		case davPrefix == "/":
+			// WebDAV owns the root, so it answers health checks and
+			// well-known paths too
+			finalWebDAVHandler = withWellKnown(health.wrap(finalWebDAVHandler))
+		case authMiddleware != nil:
 			finalWebDAVHandler = authMiddleware.Middleware(finalWebDAVHandler)
 		}
+		finalWebDAVHandler = limits.wrap(finalWebDAVHandler)
+		finalWebDAVHandler = withReadonly(finalWebDAVHandler, true)
+		finalWebDAVHandler = securityHeaders(finalWebDAVHandler)
+		finalWebDAVHandler = recoverPanics(finalWebDAVHandler)
 		finalWebDAVHandler = loggingMiddleware(componentLogger)(finalWebDAVHandler)
+		finalWebDAVHandler = withTracing(finalWebDAVHandler)
+		finalWebDAVHandler = middleware.RequestID(finalWebDAVHandler)
 	}
 
 	// Create a router if WebDAV is enabled
 	var rootHandler http.Handler
-	if finalWebDAVHandler != nil {
+	switch {
+	case finalWebDAVHandler != nil && davPrefix == "/":
+		rootHandler = finalWebDAVHandler
+	case finalWebDAVHandler != nil:
 		mux := http.NewServeMux()
-		mux.Handle("/dav/", finalWebDAVHandler)
+		mux.Handle(davPrefix+"/", finalWebDAVHandler)
 		mux.Handle("/", finalHandler)
 		rootHandler = mux
-	} else {
+	default:
 		rootHandler = finalHandler
 	}
 
+	// Strip the base path before routing so the WebDAV prefix matches below it too
+	rootHandler = middleware.BasePath(cfg.BaseURL, cfg.TrustProxy)(rootHandler)
+
+	// Turn away oversized and denylisted requests before any other work
+	rootHandler = middleware.RequestSanity(middleware.SanityConfigFor(cfg), componentLogger)(rootHandler)
+
+	// Resolve the client address, host and scheme first so logs and handlers
+	// see the request as sent to the proxy
+	rootHandler = middleware.ProxyHeaders(cfg.TrustProxy)(rootHandler)
+
+	// Count every request being served, for background work that yields to load
+	rootHandler = countInFlight(inFlight)(rootHandler)
+
+	// Rewrite the paths every log line names, outside everything that logs
+	rootHandler = middleware.LogPaths(middleware.NewPathLogger(cfg.LogPathMode, []byte(cfg.LogPathKey)))(rootHandler)
+
 	componentLogger.Info("Server initialized",
 		slog.String("host", cfg.Host),
 		slog.Int("port", cfg.Port),
 		slog.String("dir", cfg.Dir),
 		slog.Bool("auth_enabled", authMiddleware != nil),
 		slog.Bool("webdav_enabled", webdavHandler != nil),
+		slog.String("webdav_prefix", davPrefix),
+		slog.Bool("readonly", cfg.Readonly),
 	)
 
 	return &Server{
@@ -131,9 +241,30 @@ func New(cfg *config.Config, handler http.Handler, webdavHandler http.Handler,
 		handler:       rootHandler,
 		webdavHandler: finalWebDAVHandler,
 		logger:        componentLogger,
+		panics:        panics,
+		inFlight:      inFlight,
+		limits:        limits,
+		tracer:        tracer,
 	}
 }
 
+// LimitReached receives why the server wants to stop once --max-requests
+// downloads have been served or --timeout has elapsed. The caller is
+// expected to Shutdown the server.
+func (s *Server) LimitReached() <-chan string {
+	return s.limits.reached
+}
+
+// Panics returns how many handler panics have been recovered.
+func (s *Server) Panics() int64 {
+	return s.panics.Load()
+}
+
+// InFlight returns how many requests are being served right now.
+func (s *Server) InFlight() int64 {
+	return s.inFlight.Load()
+}
+
 // Start starts the HTTP server and begins accepting connections.
 // This method blocks until the server is shut down or an error occurs.
 func (s *Server) Start() error {
@@ -156,12 +287,13 @@ func (s *Server) Start() error {
 	s.mu.Lock()
 	s.listener = listener
 	s.server = &http.Server{
-		Addr:         addr,
-		Handler:      s.handler,
-		ReadTimeout:  time.Duration(s.config.RequestTimeout) * time.Second,
-		WriteTimeout: time.Duration(s.config.RequestTimeout) * time.Second,
-		IdleTimeout:  120 * time.Second,
-		ErrorLog:     nil, // Disable default logging in favor of structured logging
+		Addr:           addr,
+		Handler:        s.handler,
+		ReadTimeout:    time.Duration(s.config.RequestTimeout) * time.Second,
+		WriteTimeout:   time.Duration(s.config.RequestTimeout) * time.Second,
+		IdleTimeout:    120 * time.Second,
+		MaxHeaderBytes: constants.MaxHeaderBytes,
+		ErrorLog:       nil, // Disable default logging in favor of structured logging
 	}
 	s.mu.Unlock()
 
@@ -171,6 +303,22 @@ func (s *Server) Start() error {
 		slog.Duration("write_timeout", time.Duration(s.config.RequestTimeout)*time.Second),
 		slog.Duration("idle_timeout", 120*time.Second),
 	)
+	s.limits.start()
+
+	if len(s.config.ACMEDomains) > 0 {
+		manager := newACMEManager(s.config.ACMEDomains, s.config.ACMECacheDir)
+		s.mu.Lock()
+		s.acmeHTTP = s.startACMEHTTP(manager)
+		s.mu.Unlock()
+		if err := s.serveACME(listener, manager); err != nil {
+			s.logger.Error("Server serve error",
+				slog.String("address", addr),
+				slog.Any("error", err),
+			)
+			return err
+		}
+		return nil
+	}
 
 	// Start serving
 	if err := s.server.Serve(listener); err != nil {
@@ -188,6 +336,8 @@ func (s *Server) Start() error {
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	// Flushed once the server has stopped, so the last requests are traced too
+	defer s.flushTraces(ctx)
 
 	if s.server == nil {
 		s.logger.Warn("Shutdown called on nil server")
@@ -196,6 +346,12 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 	s.logger.Info("Server shutdown initiated")
 
+	if s.acmeHTTP != nil {
+		if err := s.acmeHTTP.Shutdown(ctx); err != nil {
+			s.logger.Warn("ACME HTTP server shutdown failed", slog.Any("error", err))
+		}
+	}
+
 	if err := s.server.Shutdown(ctx); err != nil {
 		s.logger.Error("Server shutdown failed", slog.Any("error", err))
 		return fmt.Errorf("server shutdown failed: %w", err)
@@ -204,3 +360,38 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("Server shutdown completed")
 	return nil
 }
+
+// SetKeepAlivesEnabled turns HTTP keep-alives on or off. Turning them off
+// before Shutdown lets connections close after their current request
+// instead of waiting to go idle.
+func (s *Server) SetKeepAlivesEnabled(enabled bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.server != nil {
+		s.server.SetKeepAlivesEnabled(enabled)
+	}
+}
+
+// Close closes the listener and every connection at once, for when a
+// graceful Shutdown runs out of time.
+func (s *Server) Close() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.acmeHTTP != nil {
+		_ = s.acmeHTTP.Close()
+	}
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+// flushTraces sends the spans not yet exported.
+func (s *Server) flushTraces(ctx context.Context) {
+	if s.tracer == nil {
+		return
+	}
+	if err := s.tracer.Shutdown(ctx); err != nil {
+		s.logger.Warn("Cannot send the remaining trace spans", slog.Any("error", err))
+	}
+}
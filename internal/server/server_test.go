@@ -1,72 +1,32 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/handler"
 	"github.com/samzong/gofs/internal/middleware"
+	"github.com/samzong/gofs/internal/tracing"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
 )
 
-func TestHealthCheckMiddleware(t *testing.T) {
-	// Create a test handler that returns 404 for non-health endpoints
-	testHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprint(w, "Not Found")
-	})
-
-	// Wrap with health check middleware
-	handler := healthCheckMiddleware(testHandler)
-
-	tests := []struct {
-		name           string
-		path           string
-		expectedStatus int
-		expectedBody   string
-	}{
-		{
-			name:           "health check endpoint /healthz",
-			path:           "/healthz",
-			expectedStatus: http.StatusOK,
-			expectedBody:   "OK",
-		},
-		{
-			name:           "health check endpoint /readyz",
-			path:           "/readyz",
-			expectedStatus: http.StatusOK,
-			expectedBody:   "OK",
-		},
-		{
-			name:           "non-health endpoint",
-			path:           "/files",
-			expectedStatus: http.StatusNotFound,
-			expectedBody:   "Not Found",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest("GET", tt.path, nil)
-			w := httptest.NewRecorder()
-
-			handler.ServeHTTP(w, req)
-
-			if w.Code != tt.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
-			}
-
-			if w.Body.String() != tt.expectedBody {
-				t.Errorf("Expected body %q, got %q", tt.expectedBody, w.Body.String())
-			}
-		})
-	}
-}
-
 func TestLoggingMiddleware(t *testing.T) {
 	// Create a simple test handler
 	testHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
@@ -225,6 +185,10 @@ func TestServerShutdown(t *testing.T) {
 	if err != nil {
 		t.Errorf("Shutdown() with nil server returned error: %v", err)
 	}
+	server.SetKeepAlivesEnabled(false)
+	if err := server.Close(); err != nil {
+		t.Errorf("Close() with nil server returned error: %v", err)
+	}
 }
 
 func TestConcurrentRequests(t *testing.T) {
@@ -263,3 +227,612 @@ func TestConcurrentRequests(t *testing.T) {
 		<-done
 	}
 }
+
+func TestNew_SecurityHeadersOnEveryPath(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("content"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	configs := []struct {
+		name string
+		cfg  config.Config
+		want map[string]string // "" means the header must be absent
+	}{
+		{
+			name: "defaults off",
+			cfg:  config.Config{HSTSMaxAge: 600},
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+				"Strict-Transport-Security": "",
+				"X-XSS-Protection":          "",
+				"Permissions-Policy":        "",
+			},
+		},
+		{
+			name: "all enabled behind proxy",
+			cfg: config.Config{
+				HSTSMaxAge:            600,
+				HSTSIncludeSubDomains: true,
+				BehindTLSProxy:        true,
+				XSSProtection:         true,
+				PermissionsPolicy:     "camera=()",
+			},
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Strict-Transport-Security": "max-age=600; includeSubDomains",
+				"X-XSS-Protection":          "1; mode=block",
+				"Permissions-Policy":        "camera=()",
+			},
+		},
+	}
+
+	for _, cc := range configs {
+		cfg := cc.cfg
+		cfg.Theme = "default"
+		cfg.MaxHashSize = 1 << 20
+		cfg.RequestTimeout = 30
+		cfg.Dirs = []config.DirMount{{Path: "/a", Dir: root}, {Path: "/b", Dir: root}}
+		fs := filesystem.NewLocal(root, false)
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+		auth, err := middleware.NewBasicAuth("test", "user", "password")
+		if err != nil {
+			t.Fatalf("Failed to create auth middleware: %v", err)
+		}
+		if err := auth.SetMode(middleware.AuthModeWriteOnly); err != nil {
+			t.Fatalf("Failed to set auth mode: %v", err)
+		}
+		advancedCfg := cfg
+		advancedCfg.Theme = "advanced"
+
+		handlers := map[string]http.Handler{
+			"file":      handler.NewFile(fs, &cfg, logger),
+			"advanced":  handler.NewAdvancedFile(fs, &advancedCfg),
+			"multi_dir": handler.NewMultiDir(cfg.Dirs, &cfg, logger),
+		}
+		requests := []struct {
+			name   string
+			method string
+			path   string
+		}{
+			{name: "listing", method: http.MethodGet, path: "/"},
+			{name: "not_found", method: http.MethodGet, path: "/missing.txt"},
+			{name: "unauthorized", method: http.MethodPost, path: "/"},
+			{name: "health", method: http.MethodGet, path: "/healthz"},
+			{name: "webdav", method: "PROPFIND", path: "/dav/"},
+			{name: "webdav_error", method: http.MethodGet, path: "/dav/missing.txt"},
+		}
+
+		for handlerName, h := range handlers {
+			srv := New(&cfg, h, handler.NewWebDAV(fs, &cfg, logger), auth, logger)
+			for _, req := range requests {
+				t.Run(cc.name+"/"+handlerName+"/"+req.name, func(t *testing.T) {
+					rr := httptest.NewRecorder()
+					srv.handler.ServeHTTP(rr, httptest.NewRequest(req.method, req.path, nil))
+					for name, want := range cc.want {
+						got, present := rr.Header()[http.CanonicalHeaderKey(name)]
+						switch {
+						case want == "" && present:
+							t.Errorf("status %d: expected no %s header, got %q", rr.Code, name, got)
+						case want != "" && rr.Header().Get(name) != want:
+							t.Errorf("status %d: expected %s %q, got %q", rr.Code, name, want, rr.Header().Get(name))
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestNew_RecoversHandlerPanics(t *testing.T) {
+	cfg, err := config.New(8080, "localhost", ".", "default", false, nil)
+	if err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	panicking := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})
+	server := New(cfg, panicking, panicking, nil, logger)
+
+	for _, path := range []string{"/file.txt", "/dav/file.txt"} {
+		w := httptest.NewRecorder()
+		server.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusInternalServerError, w.Code)
+		}
+		if w.Header().Get(middleware.RequestIDHeader) == "" {
+			t.Errorf("%s: expected a request ID on the error response", path)
+		}
+	}
+	if got := server.Panics(); got != 2 {
+		t.Errorf("Expected 2 recovered panics, got %d", got)
+	}
+	if !strings.Contains(logs.String(), `"msg":"Handler panic recovered"`) ||
+		!strings.Contains(logs.String(), `"status":500`) {
+		t.Errorf("Expected the panic and the 500 to be logged, got %s", logs.String())
+	}
+}
+
+func TestNew_LogPathMode(t *testing.T) {
+	cfg, err := config.New(8080, "localhost", ".", "default", false, nil)
+	if err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+	cfg.LogPathMode = config.LogPathHash
+	cfg.LogPathKey = "key"
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	panicking := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})
+	server := New(cfg, panicking, nil, nil, logger)
+	for range 2 {
+		server.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/secret/plan.txt", nil))
+	}
+
+	if strings.Contains(logs.String(), "secret") || strings.Contains(logs.String(), "plan.txt") {
+		t.Errorf("expected no path in the logs, got %s", logs.String())
+	}
+	want := middleware.NewPathLogger(config.LogPathHash, []byte("key")).Format("/secret/plan.txt")
+	if n := strings.Count(logs.String(), want); n != 4 {
+		t.Errorf("expected the access and panic lines of both requests to log %s, got %d in %s", want, n, logs.String())
+	}
+}
+
+func TestNew_CountsInFlightRequests(t *testing.T) {
+	cfg, err := config.New(8080, "localhost", ".", "default", false, nil)
+	if err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	blocking := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	server := New(cfg, blocking, nil, nil, nil)
+
+	done := make(chan struct{})
+	go func() {
+		server.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/file.txt", nil))
+		close(done)
+	}()
+	<-entered
+	if got := server.InFlight(); got != 1 {
+		t.Errorf("Expected 1 request in flight, got %d", got)
+	}
+	close(release)
+	<-done
+	if got := server.InFlight(); got != 0 {
+		t.Errorf("Expected no requests in flight once served, got %d", got)
+	}
+}
+
+func TestNew_BaseURL(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("content"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	urlAttr := regexp.MustCompile(`(?:href|src|action|data-base)="([^"]*)"`)
+
+	newServer := func(dirs []config.DirMount, trustProxy bool) *Server {
+		cfg := &config.Config{
+			Theme:          "advanced",
+			MaxHashSize:    1 << 20,
+			RequestTimeout: 30,
+			Dirs:           dirs,
+			BaseURL:        "/files",
+			TrustProxy:     trustProxy,
+		}
+		fs := filesystem.NewLocal(root, false)
+		var h http.Handler = handler.NewAdvancedFile(fs, cfg)
+		if len(dirs) > 1 {
+			h = handler.NewMultiDir(dirs, cfg, logger)
+		}
+		return New(cfg, h, handler.NewWebDAV(fs, cfg, logger), nil, logger)
+	}
+
+	testCases := []struct {
+		name   string
+		dirs   []config.DirMount
+		path   string
+		prefix string
+	}{
+		{name: "single", dirs: []config.DirMount{{Path: "/", Dir: root}}, path: "/files/docs/", prefix: "/files"},
+		{
+			name:   "multi_dir",
+			dirs:   []config.DirMount{{Path: "/a", Dir: root}, {Path: "/b", Dir: root}},
+			path:   "/files/b/docs/",
+			prefix: "/files/b",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newServer(tc.dirs, false)
+			rr := httptest.NewRecorder()
+			srv.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rr.Code)
+			}
+
+			matches := urlAttr.FindAllStringSubmatch(rr.Body.String(), -1)
+			if len(matches) == 0 {
+				t.Fatal("Expected the listing to contain links")
+			}
+			for _, m := range matches {
+				u := m[1]
+				switch {
+				case strings.HasPrefix(u, "./"), strings.HasPrefix(u, "../"), strings.HasPrefix(u, "#"),
+					strings.HasPrefix(u, "https://"):
+				case strings.Contains(u, "/static/"):
+					if !strings.HasPrefix(u, "/files/static/") {
+						t.Errorf("Expected %s to carry the base URL", m[0])
+					}
+				case u != tc.prefix && !strings.HasPrefix(u, tc.prefix+"/"):
+					t.Errorf("Expected %s to start with %s", m[0], tc.prefix)
+				}
+			}
+
+			// The advanced JS builds its API URLs from data-base
+			api := httptest.NewRecorder()
+			srv.handler.ServeHTTP(api, httptest.NewRequest(http.MethodGet, tc.prefix+"/api/capabilities", nil))
+			if api.Code != http.StatusOK {
+				t.Errorf("Expected %s/api/capabilities to be served, got %d", tc.prefix, api.Code)
+			}
+		})
+	}
+
+	t.Run("redirects", func(t *testing.T) {
+		srv := newServer([]config.DirMount{{Path: "/a", Dir: root}, {Path: "/b", Dir: root}}, false)
+		for path, want := range map[string]string{
+			"/files":                   "/files/",
+			"/files/":                  "/files/a",
+			"/files/static/theme.x.js": "/files/static/theme.",
+		} {
+			rr := httptest.NewRecorder()
+			srv.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			if location := rr.Header().Get("Location"); !strings.HasPrefix(location, want) {
+				t.Errorf("%s: expected a redirect to %s, got %d %q", path, want, rr.Code, location)
+			}
+		}
+	})
+
+	t.Run("webdav", func(t *testing.T) {
+		srv := newServer([]config.DirMount{{Path: "/", Dir: root}}, false)
+		req := httptest.NewRequest("PROPFIND", "/files/dav/docs/", nil)
+		req.Header.Set("Depth", "1")
+		rr := httptest.NewRecorder()
+		srv.handler.ServeHTTP(rr, req)
+		href := "<D:href>/files/dav/docs/a.txt</D:href>"
+		if rr.Code != http.StatusMultiStatus || !strings.Contains(rr.Body.String(), href) {
+			t.Errorf("Expected hrefs under /files/dav, got %d %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("forwarded_prefix", func(t *testing.T) {
+		for _, trust := range []bool{false, true} {
+			srv := newServer([]config.DirMount{{Path: "/", Dir: root}}, trust)
+			req := httptest.NewRequest(http.MethodGet, "/docs/", nil)
+			req.Header.Set(middleware.ForwardedPrefixHeader, "/proxied")
+			rr := httptest.NewRecorder()
+			srv.handler.ServeHTTP(rr, req)
+			want, notWant := `data-base="/files"`, `data-base="/proxied"`
+			if trust {
+				want, notWant = notWant, want
+			}
+			if !strings.Contains(rr.Body.String(), want) || strings.Contains(rr.Body.String(), notWant) {
+				t.Errorf("trust proxy %v: expected %s in the listing", trust, want)
+			}
+		}
+	})
+}
+
+func TestNew_TrustProxy(t *testing.T) {
+	root := t.TempDir()
+
+	for _, trust := range []bool{false, true} {
+		t.Run(fmt.Sprintf("trust_%v", trust), func(t *testing.T) {
+			cfg := &config.Config{
+				Theme:          "advanced",
+				MaxHashSize:    1 << 20,
+				RequestTimeout: 30,
+				Dirs:           []config.DirMount{{Path: "/", Dir: root}},
+				TrustProxy:     trust,
+			}
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&logs, nil))
+			srv := New(cfg, handler.NewAdvancedFile(filesystem.NewLocal(root, false), cfg), nil, nil, logger)
+
+			proxied := func(method, path, body, token string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				req.RemoteAddr = "10.0.0.2:41000"
+				req.Host = "gofs:8000"
+				req.Header.Set(middleware.ForwardedForHeader, "203.0.113.7, 10.0.0.1")
+				req.Header.Set(middleware.ForwardedProtoHeader, "https")
+				req.Header.Set(middleware.ForwardedHostHeader, "files.example.com")
+				req.Header.Set("Origin", "https://files.example.com")
+				req.Header.Set("X-CSRF-Token", token)
+				rr := httptest.NewRecorder()
+				srv.handler.ServeHTTP(rr, req)
+				return rr
+			}
+
+			csrf := proxied(http.MethodGet, "/api/csrf", "", "")
+			var token struct {
+				Token string `json:"token"`
+			}
+			if err := json.Unmarshal(csrf.Body.Bytes(), &token); err != nil || token.Token == "" {
+				t.Fatalf("Failed to get a CSRF token: %d %s", csrf.Code, csrf.Body.String())
+			}
+			rr := proxied(http.MethodPost, "/api/folder", `{"path":"new"}`, token.Token)
+
+			wantStatus := http.StatusForbidden
+			if trust {
+				wantStatus = http.StatusOK
+			}
+			if rr.Code != wantStatus {
+				t.Errorf("Expected the https origin to get %d, got %d %s", wantStatus, rr.Code, rr.Body.String())
+			}
+
+			wantAddr := `"remote_addr":"10.0.0.2:41000"`
+			if trust {
+				wantAddr = `"remote_addr":"203.0.113.7"`
+			}
+			if !strings.Contains(logs.String(), wantAddr) {
+				t.Errorf("Expected access logs with %s, got %s", wantAddr, logs.String())
+			}
+		})
+	}
+}
+
+func TestNew_WebDAVPrefix(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("content"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	files := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "html")
+	})
+	propfind := func(srv *Server, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PROPFIND", path, nil)
+		req.Header.Set("Depth", "1")
+		rr := httptest.NewRecorder()
+		srv.handler.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(srv *Server, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	t.Run("custom", func(t *testing.T) {
+		cfg := &config.Config{EnableWebDAV: true, WebDAVPrefix: "/remote.php/webdav"}
+		dav := handler.NewWebDAV(filesystem.NewLocal(root, false), cfg, logger)
+		srv := New(cfg, files, dav, nil, logger)
+
+		if rr := propfind(srv, "/remote.php/webdav/"); rr.Code != http.StatusMultiStatus ||
+			!strings.Contains(rr.Body.String(), "/remote.php/webdav/a.txt") {
+			t.Errorf("Expected a WebDAV listing, got %d %s", rr.Code, rr.Body.String())
+		}
+		for _, path := range []string{"/", "/dav/", "/remote.php/"} {
+			if rr := get(srv, path); rr.Body.String() != "html" {
+				t.Errorf("%s: expected the file handler, got %d %q", path, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("root", func(t *testing.T) {
+		cfg := &config.Config{EnableWebDAV: true, WebDAVPrefix: "/"}
+		dav := handler.NewWebDAV(filesystem.NewLocal(root, false), cfg, logger)
+		srv := New(cfg, files, dav, nil, logger)
+
+		if rr := propfind(srv, "/"); rr.Code != http.StatusMultiStatus ||
+			!strings.Contains(rr.Body.String(), "<D:href>/a.txt</D:href>") {
+			t.Errorf("Expected a WebDAV listing at the root, got %d %s", rr.Code, rr.Body.String())
+		}
+		if rr := get(srv, "/"); strings.Contains(rr.Body.String(), "html") {
+			t.Error("Expected the file handler to be disabled")
+		}
+		if rr := get(srv, "/healthz"); rr.Code != http.StatusOK {
+			t.Errorf("Expected health checks to be served, got %d", rr.Code)
+		}
+	})
+}
+
+func TestNew_OTelEndpoint(t *testing.T) {
+	var exported []*coltracepb.ExportTraceServiceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		req := &coltracepb.ExportTraceServiceRequest{}
+		body, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Errorf("Invalid export: %v", err)
+		}
+		exported = append(exported, req)
+	}))
+	defer collector.Close()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	logger := slog.New(tracing.NewLogHandler(slog.NewTextHandler(&logs, nil)))
+	cfg := &config.Config{Theme: "advanced", RequestTimeout: 30, OTelEndpoint: collector.URL}
+	s := New(cfg, handler.NewAdvancedFile(filesystem.NewLocal(root, false), cfg), nil, nil, logger)
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+	s.flushTraces(context.Background())
+
+	var spans []*tracepb.Span
+	for _, req := range exported {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	if len(spans) != 2 || spans[0].Name != "fs.ReadDir" || spans[1].Name != "GET" ||
+		!bytes.Equal(spans[0].ParentSpanId, spans[1].SpanId) {
+		t.Fatalf("Expected fs.ReadDir as a child of GET, got %v", spans)
+	}
+	if want := "trace_id=" + hex.EncodeToString(spans[1].TraceId); !strings.Contains(logs.String(), want) {
+		t.Errorf("Expected the request log to carry %s, got\n%s", want, logs.String())
+	}
+
+	if New(&config.Config{}, http.NotFoundHandler(), nil, nil, logger).tracer != nil {
+		t.Error("Expected no tracer without --otel-endpoint")
+	}
+}
+
+// TestNew_RangeWithAcceptEncoding checks that the middleware chain leaves the
+// representation the file handler picked alone: ranges stay identity bytes
+// and encoded sidecars stay whole.
+func TestNew_RangeWithAcceptEncoding(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{"app.js": "console.log(1);", "app.js.gz": "gzip-bytes"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{Theme: "advanced", MaxHashSize: 1 << 20, RequestTimeout: 30, EnableSecurity: true}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := New(cfg, handler.NewAdvancedFile(filesystem.NewLocal(root, false), cfg), nil, nil, logger)
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		req.Header = header
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-6"}})
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "console" || rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected identity bytes 0-6, got %d %q encoded %q",
+			rr.Code, rr.Body.String(), rr.Header().Get("Content-Encoding"))
+	}
+	rr = get(http.Header{"Accept-Encoding": {"gzip"}})
+	if rr.Code != http.StatusOK || rr.Body.String() != "gzip-bytes" || rr.Header().Get("Accept-Ranges") != "none" {
+		t.Errorf("Expected the whole gzip sidecar without ranges, got %d %q Accept-Ranges %q",
+			rr.Code, rr.Body.String(), rr.Header().Get("Accept-Ranges"))
+	}
+}
+
+// TestNew_Readonly sends every mutating operation the OpenAPI document lists,
+// REST writes and WebDAV writes through a --readonly server and checks that
+// none reaches a handler.
+func TestNew_Readonly(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Theme:           "advanced",
+		MaxHashSize:     1 << 20,
+		RequestTimeout:  30,
+		Dirs:            []config.DirMount{{Path: "/", Dir: root}},
+		EnableWebDAV:    true,
+		EnableRESTWrite: true,
+		WebDAVFakeLocks: true,
+		Readonly:        true,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fs := filesystem.NewLocal(root, false)
+	s := New(cfg, handler.NewAdvancedFile(fs, cfg), handler.NewWebDAV(fs, cfg, logger), nil, logger)
+	send := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(`{"paths":["docs"]}`)))
+		return rr
+	}
+
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(send(http.MethodGet, "/api/openapi.json").Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var checked int
+	for path, methods := range doc.Paths {
+		for method := range methods {
+			method = strings.ToUpper(method)
+			if method == http.MethodGet || method == http.MethodPost && path == "/api/zip" {
+				continue
+			}
+			checked++
+			target := strings.ReplaceAll(path, "{path}", "docs/a.txt")
+			if rr := send(method, target); rr.Code != http.StatusForbidden ||
+				!strings.Contains(rr.Body.String(), middleware.ReadonlyServerCode) {
+				t.Errorf("%s %s: expected 403 %s, got %d %s", method, path, middleware.ReadonlyServerCode,
+					rr.Code, rr.Body.String())
+			}
+		}
+	}
+	if checked < 5 {
+		t.Errorf("Expected the document to list the mutating operations, found %d", checked)
+	}
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete, http.MethodPost, http.MethodPatch} {
+		if rr := send(method, "/docs/a.txt"); rr.Code != http.StatusForbidden {
+			t.Errorf("REST %s: expected 403, got %d", method, rr.Code)
+		}
+	}
+	for _, method := range []string{http.MethodPut, http.MethodDelete, "MKCOL", "MOVE", "COPY", "PROPPATCH"} {
+		if rr := send(method, "/dav/docs/a.txt"); rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") == "" {
+			t.Errorf("WebDAV %s: expected 405 with Allow, got %d", method, rr.Code)
+		}
+	}
+
+	// Fake locks are never recorded, so Finder can still mount the share
+	lock := httptest.NewRequest("LOCK", "/dav/docs/a.txt", nil)
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, lock)
+	if rr.Code != http.StatusOK || rr.Header().Get("Lock-Token") == "" {
+		t.Errorf("WebDAV LOCK: expected a fake lock, got %d %s", rr.Code, rr.Body.String())
+	}
+	unlock := httptest.NewRequest("UNLOCK", "/dav/docs/a.txt", nil)
+	unlock.Header.Set("Lock-Token", rr.Header().Get("Lock-Token"))
+	rr = httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, unlock)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("WebDAV UNLOCK: expected 204, got %d", rr.Code)
+	}
+	if got, err := os.ReadFile(filepath.Join(root, "docs", "a.txt")); err != nil || string(got) != "a" {
+		t.Errorf("Expected the file to be untouched, got %q %v", got, err)
+	}
+
+	// Reads still work, and the capabilities hide every write
+	if rr := send(http.MethodGet, "/docs/a.txt"); rr.Code != http.StatusOK {
+		t.Errorf("Expected reads to be served, got %d", rr.Code)
+	}
+	if rr := send(http.MethodPost, "/api/zip"); rr.Code == http.StatusForbidden &&
+		strings.Contains(rr.Body.String(), middleware.ReadonlyServerCode) {
+		t.Error("Expected POST /api/zip, which only reads, to pass")
+	}
+	var caps handler.CapabilitiesResponse
+	if err := json.Unmarshal(send(http.MethodGet, "/api/capabilities").Body.Bytes(), &caps); err != nil {
+		t.Fatal(err)
+	}
+	if !caps.Readonly || caps.Features.Upload || caps.Features.Delete || caps.Features.RESTWrite {
+		t.Errorf("Expected capabilities without writes, got %+v", caps)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/constants"
+)
+
+//go:embed favicon.ico
+var favicon []byte
+
+const wellKnownPrefix = "/.well-known/"
+
+// Bodies of /robots.txt without and with --allow-indexing.
+const (
+	robotsDisallow = "User-agent: *\nDisallow: /\n"
+	robotsAllow    = "User-agent: *\nDisallow:\n"
+)
+
+// wellKnownHandler answers the paths browsers, crawlers and certificate
+// tooling ask every server for: /robots.txt, /favicon.ico and anything
+// under /.well-known/. They are answered before the mounts, so they do not
+// fill the logs with 404s or depend on whether hidden files are shown.
+type wellKnownHandler struct {
+	robots      []byte
+	faviconETag string
+	dir         fs.FS // --well-known-dir; nil answers 404 under /.well-known/
+}
+
+func newWellKnownHandler(cfg *config.Config) *wellKnownHandler {
+	h := &wellKnownHandler{robots: []byte(robotsDisallow)}
+	if cfg.AllowIndexing {
+		h.robots = []byte(robotsAllow)
+	}
+	sum := sha256.Sum256(favicon)
+	h.faviconETag = `"` + hex.EncodeToString(sum[:8]) + `"`
+	if cfg.WellKnownDir != "" {
+		h.dir = os.DirFS(cfg.WellKnownDir)
+	}
+	return h
+}
+
+// wrap answers the well-known paths and passes every other request to next.
+func (h *wellKnownHandler) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/robots.txt":
+			if allowRead(w, r) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", constants.StaticAssetCacheMaxAge))
+				http.ServeContent(w, r, "robots.txt", time.Time{}, bytes.NewReader(h.robots))
+			}
+		case r.URL.Path == "/favicon.ico":
+			if allowRead(w, r) {
+				w.Header().Set("Content-Type", "image/x-icon")
+				w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", constants.FaviconCacheMaxAge))
+				w.Header().Set("ETag", h.faviconETag)
+				http.ServeContent(w, r, "favicon.ico", time.Time{}, bytes.NewReader(favicon))
+			}
+		case strings.HasPrefix(r.URL.Path, wellKnownPrefix) || r.URL.Path == "/.well-known":
+			if allowRead(w, r) {
+				h.serveDir(w, r)
+			}
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serveDir serves a file of --well-known-dir. Directories are not listed.
+func (h *wellKnownHandler) serveDir(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, wellKnownPrefix)
+	if h.dir == nil || !fs.ValidPath(name) {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := fs.Stat(h.dir, name)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFileFS(w, r, h.dir, name)
+}
+
+// allowRead answers 405 to anything but GET and HEAD and reports whether the
+// request may be served.
+func allowRead(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/middleware"
+)
+
+func TestWellKnownHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := newWellKnownHandler(&config.Config{}).wrap(next)
+
+	get := func(method, target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(http.MethodGet, "/robots.txt", nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != robotsDisallow {
+		t.Errorf("robots.txt: got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = get(http.MethodGet, "/favicon.ico", nil)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), favicon) ||
+		rr.Header().Get("Content-Type") != "image/x-icon" {
+		t.Fatalf("favicon.ico: got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" || rr.Header().Get("Cache-Control") == "" {
+		t.Errorf("favicon.ico: expected caching headers, got %v", rr.Header())
+	}
+	if rr := get(http.MethodGet, "/favicon.ico", http.Header{"If-None-Match": {etag}}); rr.Code != http.StatusNotModified {
+		t.Errorf("favicon.ico revalidation: expected 304, got %d", rr.Code)
+	}
+
+	if rr := get(http.MethodGet, "/.well-known/security.txt", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("well-known without a directory: expected 404, got %d", rr.Code)
+	}
+	if rr := get(http.MethodPost, "/robots.txt", nil); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST robots.txt: expected 405, got %d", rr.Code)
+	}
+	if rr := get(http.MethodGet, "/docs/robots.txt", nil); rr.Code != http.StatusTeapot {
+		t.Errorf("robots.txt below the root: expected the file handler, got %d", rr.Code)
+	}
+}
+
+func TestWellKnownHandler_Dir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "acme-challenge"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"security.txt":         "Contact: mailto:security@example.com\n",
+		"acme-challenge/token": "token.key",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{WellKnownDir: dir, AllowIndexing: true}
+	h := newWellKnownHandler(cfg).wrap(http.NotFoundHandler())
+
+	for name, content := range files {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/.well-known/"+name, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != content {
+			t.Errorf("%s: got %d %q", name, rr.Code, rr.Body.String())
+		}
+	}
+	for _, target := range []string{"/.well-known/", "/.well-known/acme-challenge/", "/.well-known/missing",
+		"/.well-known/../etc/passwd"} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", target, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if rr.Body.String() != robotsAllow {
+		t.Errorf("robots.txt with --allow-indexing: got %q", rr.Body.String())
+	}
+}
+
+func TestWellKnownHandler_Auth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	auth, err := middleware.NewBasicAuth("gofs", "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		wellKnownAuth bool
+		want          int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusUnauthorized},
+	} {
+		cfg := &config.Config{Host: "127.0.0.1", WellKnownAuth: tc.wellKnownAuth}
+		srv := New(cfg, files, nil, auth, logger)
+		for _, target := range []string{"/robots.txt", "/favicon.ico"} {
+			rr := httptest.NewRecorder()
+			srv.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+			if rr.Code != tc.want {
+				t.Errorf("%s with --well-known-auth=%v: expected %d, got %d", target, tc.wellKnownAuth, tc.want, rr.Code)
+			}
+		}
+		rr := httptest.NewRecorder()
+		srv.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/file.txt", nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("files must still require auth, got %d", rr.Code)
+		}
+	}
+}
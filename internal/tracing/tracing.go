@@ -0,0 +1,142 @@
+// Package tracing records request spans with the OpenTelemetry SDK and sends
+// them to a collector over OTLP/HTTP. It is the only package that imports
+// OpenTelemetry; handlers start spans through Start and get a *Span back, so
+// the SDK stays out of the rest of the tree.
+//
+// Tracing is off unless a request passes through Middleware: Start finds no
+// recording span in the context and returns a nil *Span, whose methods do
+// nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/samzong/gofs/internal/constants"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scope is the instrumentation scope of every span gofs records.
+const scope = "github.com/samzong/gofs"
+
+// Tracer owns the tracer provider requests are traced with.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// New returns a tracer handing each span to exporter as it ends, for
+// exporters that do not block such as tracetest.InMemoryExporter. NewOTLP
+// batches instead.
+func New(exporter sdktrace.SpanExporter) *Tracer {
+	return newTracer(sdktrace.WithSyncer(exporter))
+}
+
+// NewOTLP returns a tracer posting spans in batches to the OTLP/HTTP
+// collector at endpoint, on behalf of service, the service.name of every
+// span. Export failures are logged to logger.
+func NewOTLP(endpoint, service string, logger *slog.Logger) (*Tracer, error) {
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(TracesURL(endpoint)),
+		otlptracehttp.WithTimeout(constants.TraceExportTimeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("Cannot send trace spans", slog.Any("error", err))
+	}))
+	return newTracer(
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithMaxExportBatchSize(constants.TraceBatchSize),
+			sdktrace.WithMaxQueueSize(constants.TraceQueueSize),
+			sdktrace.WithBatchTimeout(constants.TraceExportInterval),
+		),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	), nil
+}
+
+func newTracer(opts ...sdktrace.TracerProviderOption) *Tracer {
+	provider := sdktrace.NewTracerProvider(opts...)
+	return &Tracer{provider: provider, tracer: provider.Tracer(scope)}
+}
+
+// TracesURL returns where spans for the OTLP/HTTP endpoint are posted: its
+// /v1/traces path, unless the endpoint already names it.
+func TracesURL(endpoint string) string {
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+}
+
+// Shutdown flushes the spans not yet exported and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+// Span is an operation being timed. A nil *Span is valid and records
+// nothing.
+type Span struct {
+	span trace.Span
+}
+
+// Start starts a span as a child of the span in ctx. Without a recording
+// one it returns ctx and a nil *Span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.IsRecording() {
+		return ctx, nil
+	}
+	ctx, span := parent.TracerProvider().Tracer(scope).Start(ctx, name)
+	return ctx, &Span{span: span}
+}
+
+// SetAttr records an attribute of the operation. value is a string, int,
+// int64 or bool; anything else is recorded as its fmt.Sprint string.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attr(key, value))
+}
+
+// RecordError marks the operation as failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+func attr(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
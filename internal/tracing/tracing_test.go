@@ -0,0 +1,200 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStart_WithoutTracer(t *testing.T) {
+	ctx := context.Background()
+	got, span := Start(ctx, "fs.ReadDir")
+	if span != nil || got != ctx {
+		t.Fatalf("Expected no span without a traced request, got %v", span)
+	}
+	// A nil span is safe to use
+	span.SetAttr("k", "v")
+	span.RecordError(errors.New("x"))
+	span.End()
+}
+
+func TestMiddleware_SpanHierarchy(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	h := Middleware(New(exporter))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, read := Start(r.Context(), "fs.ReadDir")
+		_, open := Start(ctx, "fs.Open")
+		open.SetAttr("gofs.size", int64(42))
+		open.RecordError(errors.New("denied"))
+		open.End()
+		read.End()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/docs/", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %+v", spans)
+	}
+	open, read, root := spans[0], spans[1], spans[2]
+	if root.Name != "GET" || root.SpanKind != trace.SpanKindServer || root.Parent.IsValid() {
+		t.Errorf("Unexpected root span %+v", root)
+	}
+	if read.Parent.SpanID() != root.SpanContext.SpanID() || open.Parent.SpanID() != read.SpanContext.SpanID() {
+		t.Errorf("Expected fs.Open < fs.ReadDir < GET, got parents %s %s", open.Parent.SpanID(),
+			read.Parent.SpanID())
+	}
+	for _, s := range spans {
+		if s.SpanContext.TraceID() != root.SpanContext.TraceID() || s.EndTime.Before(s.StartTime) {
+			t.Errorf("%s: unexpected trace or times %+v", s.Name, s)
+		}
+	}
+	if open.Status.Code != codes.Error || open.Status.Description != "denied" || root.Status.Code == codes.Error {
+		t.Errorf("Expected only fs.Open to fail, got %+v and %+v", open.Status, root.Status)
+	}
+	if !hasAttr(open, attribute.Int64("gofs.size", 42)) {
+		t.Errorf("Unexpected fs.Open attributes %+v", open.Attributes)
+	}
+	if !hasAttr(root, attribute.Int("http.response.status_code", http.StatusNotFound)) ||
+		!hasAttr(root, attribute.String("url.path", "/docs/")) {
+		t.Errorf("Unexpected root attributes %+v", root.Attributes)
+	}
+}
+
+func TestMiddleware_Traceparent(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	h := Middleware(New(exporter))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for header, continued := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": true,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": false,
+		"garbage": false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Traceparent", header)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		spans := exporter.GetSpans()
+		root := spans[len(spans)-1]
+		got := root.SpanContext.TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" &&
+			root.Parent.SpanID().String() == "00f067aa0ba902b7"
+		if got != continued {
+			t.Errorf("%q: expected continued=%v, got trace %s parent %s", header, continued,
+				root.SpanContext.TraceID(), root.Parent.SpanID())
+		}
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil))).With("component", "test")
+	exporter := tracetest.NewInMemoryExporter()
+	h := Middleware(New(exporter))(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "traced")
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	logger.Info("untraced")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sc := exporter.GetSpans()[0].SpanContext
+	want := "trace_id=" + sc.TraceID().String() + " span_id=" + sc.SpanID().String()
+	if len(lines) != 2 || !strings.Contains(lines[0], want) || strings.Contains(lines[1], "trace_id") {
+		t.Errorf("Expected only the first line to carry %q, got\n%s", want, buf.String())
+	}
+}
+
+func TestNewOTLP(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*coltracepb.ExportTraceServiceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		req := &coltracepb.ExportTraceServiceRequest{}
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" ||
+			proto.Unmarshal(body, req) != nil {
+			t.Errorf("Unexpected export %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	tracer, err := NewOTLP(collector.URL, "gofs", slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Middleware(tracer)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "hash")
+		span.SetAttr("gofs.size", int64(42))
+		span.RecordError(errors.New("short read"))
+		span.End()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 || len(requests[0].ResourceSpans) != 1 {
+		t.Fatalf("Expected one export, got %v", requests)
+	}
+	rs := requests[0].ResourceSpans[0]
+	if name := rs.Resource.Attributes[0]; name.Key != "service.name" || name.Value.GetStringValue() != "gofs" {
+		t.Errorf("Unexpected resource %v", rs.Resource)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %v", spans)
+	}
+	hash, get := spans[0], spans[1]
+	if !bytes.Equal(hash.ParentSpanId, get.SpanId) || len(get.ParentSpanId) != 0 ||
+		!bytes.Equal(hash.TraceId, get.TraceId) {
+		t.Errorf("Unexpected hierarchy %v %v", hash, get)
+	}
+	if get.Kind != tracepb.Span_SPAN_KIND_SERVER || hash.Kind != tracepb.Span_SPAN_KIND_INTERNAL ||
+		hash.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+		t.Errorf("Unexpected kinds or status %v %v", hash, get)
+	}
+	if len(hash.Attributes) != 1 || hash.Attributes[0].Value.GetIntValue() != 42 {
+		t.Errorf("Unexpected attributes %v", hash.Attributes)
+	}
+}
+
+func TestTracesURL(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"http://collector:4318":            "http://collector:4318/v1/traces",
+		"http://collector:4318/":           "http://collector:4318/v1/traces",
+		"https://otel.example/v1/traces":   "https://otel.example/v1/traces",
+		"https://otel.example/api/collect": "https://otel.example/api/collect/v1/traces",
+	} {
+		if got := TracesURL(endpoint); got != want {
+			t.Errorf("TracesURL(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
+
+func hasAttr(span tracetest.SpanStub, want attribute.KeyValue) bool {
+	for _, a := range span.Attributes {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
@@ -2,7 +2,9 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"time"
 )
@@ -14,6 +16,8 @@ type FileSystem interface {
 	Create(name string) (io.WriteCloser, error)
 	Mkdir(name string, perm os.FileMode) error
 	Remove(name string) error
+	Rename(oldname, newname string) error
+	Chtimes(name string, atime, mtime time.Time) error
 }
 
 type FileInfo interface {
@@ -23,6 +27,216 @@ type FileInfo interface {
 	ModTime() time.Time
 }
 
+// ExtendedFileInfo is implemented by FileInfo values from backends that know
+// Unix metadata. Use FileMode, LinkTarget and FileOwner to read it with
+// sensible defaults for backends that do not.
+type ExtendedFileInfo interface {
+	FileInfo
+	Mode() os.FileMode
+	// LinkTarget is the target of a symbolic link, or "" for other files.
+	LinkTarget() string
+	// Owner reports the numeric owner and group; ok is false where the
+	// platform does not have them.
+	Owner() (uid, gid int, ok bool)
+}
+
+// FileMode returns the mode of fi, defaulting to 0755 for directories and
+// 0644 for files.
+func FileMode(fi FileInfo) os.FileMode {
+	if ext, ok := fi.(ExtendedFileInfo); ok {
+		return ext.Mode()
+	}
+	if fi.IsDir() {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// LinkTarget returns the symbolic link target of fi, or "" if it is not a
+// link or the backend cannot tell.
+func LinkTarget(fi FileInfo) string {
+	if ext, ok := fi.(ExtendedFileInfo); ok {
+		return ext.LinkTarget()
+	}
+	return ""
+}
+
+// FileOwner returns the numeric owner and group of fi if the backend knows
+// them.
+func FileOwner(fi FileInfo) (uid, gid int, ok bool) {
+	if ext, ok := fi.(ExtendedFileInfo); ok {
+		return ext.Owner()
+	}
+	return 0, 0, false
+}
+
+// OSFile is implemented by files that Open returns straight from the local
+// disk. Handlers serve the *os.File itself so net/http can send it with
+// sendfile instead of copying it through user space.
+type OSFile interface {
+	File() *os.File
+}
+
+// ErrNotSeekable is returned by Seek on files of backends that can only be
+// read from the start.
+var ErrNotSeekable = errors.New("file does not support seeking")
+
+// SeekOpener is implemented by backends whose files can seek: the local disk,
+// the in-memory hot cache and the wrappers around them. Backends that can
+// only stream a file from its start, such as a remote object store without
+// range reads, should not implement it. Use OpenSeeker to open a file of any
+// FileSystem this way.
+type SeekOpener interface {
+	// OpenSeeker opens the named file for reading, like Open.
+	OpenSeeker(name string) (io.ReadSeekCloser, error)
+}
+
+// OpenSeeker opens the named file of fsys for reading. Backends that
+// implement SeekOpener return files that seek; others are read from the
+// start, their Seek fails with ErrNotSeekable, and Seekable reports false.
+// Handlers open a file once with OpenSeeker and use it for content sniffing,
+// ETags and ranges alike.
+func OpenSeeker(fsys FileSystem, name string) (io.ReadSeekCloser, error) {
+	if so, ok := fsys.(SeekOpener); ok {
+		return so.OpenSeeker(name)
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if rsc, ok := file.(io.ReadSeekCloser); ok {
+		return rsc, nil
+	}
+	return unseekableFile{file}, nil
+}
+
+// Seekable reports whether file can seek. Only files OpenSeeker had to wrap
+// cannot.
+func Seekable(file io.Seeker) bool {
+	_, wrapped := file.(unseekableFile)
+	return !wrapped
+}
+
+type unseekableFile struct {
+	io.ReadCloser
+}
+
+func (unseekableFile) Seek(int64, int) (int64, error) {
+	return 0, ErrNotSeekable
+}
+
+// ETagger is implemented by files that know their entity tag, such as files
+// held in memory or fetched from another server. Handlers use it instead of
+// hashing the content.
+type ETagger interface {
+	// ETag returns the quoted entity tag.
+	ETag() string
+}
+
+// DirIterator is implemented by backends that can list a directory without
+// holding all of its entries in memory. Use ReadDirIter to list any
+// FileSystem this way.
+type DirIterator interface {
+	// ReadDirIter calls fn for each entry of the named directory, in no
+	// particular order, and stops at the first error fn returns.
+	ReadDirIter(name string, fn func(FileInfo) error) error
+}
+
+// ReadDirIter calls fn for each entry of the named directory. Backends that
+// implement DirIterator stream the entries; others are listed with ReadDir.
+// Returning fs.SkipAll from fn stops the listing without an error; any other
+// error from fn is returned as is.
+func ReadDirIter(fsys FileSystem, name string, fn func(FileInfo) error) error {
+	var err error
+	if it, ok := fsys.(DirIterator); ok {
+		err = it.ReadDirIter(name, fn)
+	} else {
+		var entries []FileInfo
+		if entries, err = fsys.ReadDir(name); err == nil {
+			for _, entry := range entries {
+				if err = fn(entry); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// RawTree is implemented by backends that have symbolic links, or entries
+// ReadDir leaves out. Recursive deletes and copies use it to see a tree as
+// it is on disk, so they neither follow links nor strand unlisted entries.
+type RawTree interface {
+	// Lstat is Stat without following a symbolic link at name.
+	Lstat(name string) (FileInfo, error)
+	// ReadDirAll lists every entry of the named directory, including those
+	// ReadDir leaves out.
+	ReadDirAll(name string) ([]FileInfo, error)
+	// Symlink creates newname as a symbolic link to target, which is
+	// relative to the directory of newname.
+	Symlink(target, newname string) error
+}
+
+// Lstat returns the information of name without following a symbolic link.
+// Backends that do not implement RawTree are asked with Stat.
+func Lstat(fsys FileSystem, name string) (FileInfo, error) {
+	if rt, ok := fsys.(RawTree); ok {
+		return rt.Lstat(name)
+	}
+	return fsys.Stat(name)
+}
+
+// ReadDirAll lists every entry of the named directory. Backends that do not
+// implement RawTree are listed with ReadDir.
+func ReadDirAll(fsys FileSystem, name string) ([]FileInfo, error) {
+	if rt, ok := fsys.(RawTree); ok {
+		return rt.ReadDirAll(name)
+	}
+	return fsys.ReadDir(name)
+}
+
+// Symlink creates newname as a symbolic link to target. It fails with
+// errors.ErrUnsupported on backends that do not implement RawTree.
+func Symlink(fsys FileSystem, target, newname string) error {
+	if rt, ok := fsys.(RawTree); ok {
+		return rt.Symlink(target, newname)
+	}
+	return errors.ErrUnsupported
+}
+
+// Capabilities describes what a backend supports, so handlers can pick a code
+// path and tell clients which features work instead of failing at the first
+// attempt.
+type Capabilities struct {
+	CanWrite      bool // Create, Mkdir, Remove and Chtimes can succeed
+	CanSeek       bool // Files seek, see SeekOpener
+	CanRename     bool // Rename moves a file in place rather than failing
+	CaseSensitive bool // Names that differ only in case are different files
+	CheapListing  bool // Listing a directory is a local read, cheap enough to do for every entry of a listing
+}
+
+// CapabilityReporter is implemented by backends that know their
+// capabilities. Wrappers should report those of the backend they wrap,
+// narrowed by whatever they refuse. Use CapabilitiesOf to get the
+// capabilities of any FileSystem.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the capabilities of fsys. Backends that do not
+// implement CapabilityReporter are taken to be writable, case-sensitive and
+// cheap to list, with seeking files if they implement SeekOpener.
+func CapabilitiesOf(fsys FileSystem) Capabilities {
+	if cr, ok := fsys.(CapabilityReporter); ok {
+		return cr.Capabilities()
+	}
+	_, seeks := fsys.(SeekOpener)
+	return Capabilities{CanWrite: true, CanSeek: seeks, CanRename: true, CaseSensitive: true, CheapListing: true}
+}
+
 type APIError struct {
 	Details any    `json:"details,omitempty"`
 	Code    string `json:"code"`
@@ -58,3 +272,9 @@ func WithMountInfo(ctx context.Context, path, name string, readonly bool) contex
 	info := MountInfo{Path: path, Name: name, Readonly: readonly}
 	return context.WithValue(ctx, mountInfoKey, info)
 }
+
+// MountInfoFromContext returns the mount information stored by WithMountInfo.
+func MountInfoFromContext(ctx context.Context) (MountInfo, bool) {
+	info, ok := ctx.Value(mountInfoKey).(MountInfo)
+	return info, ok
+}
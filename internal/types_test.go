@@ -2,8 +2,12 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"net/http"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestAPIError_Error(t *testing.T) {
@@ -403,3 +407,53 @@ func BenchmarkMountInfo_ContextRetrieval(b *testing.B) {
 		_ = ctx.Value(mountInfoKey)
 	}
 }
+
+func TestMountInfoFromContext(t *testing.T) {
+	if _, ok := MountInfoFromContext(context.Background()); ok {
+		t.Error("Expected no mount info in empty context")
+	}
+
+	ctx := WithMountInfo(context.Background(), "/logs", "Logs", true)
+	info, ok := MountInfoFromContext(ctx)
+	if !ok {
+		t.Fatal("Expected mount info to be present")
+	}
+	if info.Path != "/logs" || info.Name != "Logs" || !info.Readonly {
+		t.Errorf("Unexpected mount info: %+v", info)
+	}
+}
+
+type readDirOnlyFS struct {
+	FileSystem
+	entries []FileInfo
+}
+
+func (f readDirOnlyFS) ReadDir(string) ([]FileInfo, error) { return f.entries, nil }
+
+type namedInfo string
+
+func (n namedInfo) Name() string       { return string(n) }
+func (n namedInfo) Size() int64        { return 0 }
+func (n namedInfo) IsDir() bool        { return false }
+func (n namedInfo) ModTime() time.Time { return time.Time{} }
+
+func TestReadDirIter_Fallback(t *testing.T) {
+	fsys := readDirOnlyFS{entries: []FileInfo{namedInfo("a"), namedInfo("b"), namedInfo("c")}}
+
+	var names []string
+	err := ReadDirIter(fsys, ".", func(fi FileInfo) error {
+		names = append(names, fi.Name())
+		if fi.Name() == "b" {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("expected [a b], got %v (%v)", names, err)
+	}
+
+	stop := errors.New("stop")
+	if err := ReadDirIter(fsys, ".", func(FileInfo) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+}
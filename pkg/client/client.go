@@ -0,0 +1,393 @@
+// Package client exposes a tree served by gofs as an io/fs.FS. Directory
+// listings come from the JSON listing API and file contents from plain GETs,
+// so any gofs theme can be consumed by standard fs tooling.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samzong/gofs/pkg/httprange"
+)
+
+// Default retry policy for idempotent requests.
+const (
+	DefaultRetries      = 3
+	DefaultRetryBackoff = 200 * time.Millisecond
+)
+
+// errNotDir is returned when a directory operation targets a file.
+var errNotDir = errors.New("not a directory")
+
+// ErrChanged is returned by OpenRangeIf when the file no longer has the ETag
+// the earlier parts of it were read with.
+var ErrChanged = errors.New("file changed on the server")
+
+var (
+	_ fs.FS        = (*Client)(nil)
+	_ fs.ReadDirFS = (*Client)(nil)
+	_ fs.StatFS    = (*Client)(nil)
+)
+
+// Client reads a gofs server as a read-only file system. A Client is safe for
+// concurrent use.
+type Client struct {
+	ctx        context.Context
+	baseURL    *url.URL
+	httpClient *http.Client
+	username   string
+	password   string
+	token      string
+	retries    int
+	backoff    time.Duration
+}
+
+// Option customizes a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithBasicAuth sends HTTP Basic credentials with every request.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) { c.username, c.password = username, password }
+}
+
+// WithToken sends a bearer token with every request, for deployments behind
+// an authenticating proxy.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithRetry sets how many times a failed request is retried and the initial
+// backoff, which doubles after each attempt. Zero retries disables retrying.
+func WithRetry(retries int, backoff time.Duration) Option {
+	return func(c *Client) { c.retries, c.backoff = retries, backoff }
+}
+
+// New returns a Client for the gofs tree rooted at baseURL. The URL may point
+// at a mount, for example "http://host:8000/docs".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base URL must be http or https: %q", baseURL)
+	}
+	u.RawQuery, u.Fragment = "", ""
+
+	c := &Client{
+		ctx:        context.Background(),
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		retries:    DefaultRetries,
+		backoff:    DefaultRetryBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// WithContext returns a shallow copy of c whose requests use ctx.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	c2 := *c
+	c2.ctx = ctx
+	return &c2
+}
+
+// Open opens the named file or directory.
+func (c *Client) Open(name string) (fs.File, error) {
+	info, err := c.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		entries, err := c.readDir("open", name)
+		if err != nil {
+			return nil, err
+		}
+		return &dir{info: info, entries: entries}, nil
+	}
+
+	resp, err := c.get("open", name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &file{info: info, body: resp.Body}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (c *Client) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := c.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return c.readDir("readdir", name)
+}
+
+// Stat returns file information for the named file or directory.
+func (c *Client) Stat(name string) (fs.FileInfo, error) {
+	return c.stat("stat", name)
+}
+
+// stat asks for the headers of a file with HEAD. Anything else, such as a
+// directory, is found in its parent's listing, since listings are the only
+// metadata the server exposes for every theme.
+func (c *Client) stat(op, name string) (*fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		if _, err := c.list(op, name); err != nil {
+			return nil, err
+		}
+		return &fileInfo{name: ".", isDir: true}, nil
+	}
+
+	if info, ok, err := c.head(op, name); ok || err != nil {
+		return info, err
+	}
+	listing, err := c.list(op, path.Dir(name))
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = name
+			if errors.Is(pathErr.Err, errNotDir) {
+				pathErr.Err = fs.ErrNotExist
+			}
+		}
+		return nil, err
+	}
+
+	base := path.Base(name)
+	for _, item := range listing.Files {
+		if item.Name == base {
+			return item.fileInfo(), nil
+		}
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// head returns the information of the file name from the headers of a HEAD
+// request. ok is false if they do not describe a file: directories redirect
+// to their listing, which has no Last-Modified.
+func (c *Client) head(op, name string) (info *fileInfo, ok bool, err error) {
+	resp, err := c.request(http.MethodHead, op, name, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp.Body.Close()
+
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil || resp.ContentLength < 0 || strings.HasSuffix(resp.Request.URL.Path, "/") {
+		return nil, false, nil
+	}
+	return &fileInfo{name: path.Base(name), size: resp.ContentLength, modTime: modTime}, true, nil
+}
+
+func (c *Client) readDir(op, name string) ([]fs.DirEntry, error) {
+	listing, err := c.list(op, name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(listing.Files))
+	for _, item := range listing.Files {
+		entries = append(entries, fs.FileInfoToDirEntry(item.fileInfo()))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// listing is the subset of the directory JSON shared by the default and
+// advanced handlers.
+type listing struct {
+	Path  string        `json:"path"`
+	Files []listingItem `json:"files"`
+}
+
+type listingItem struct {
+	ModTime time.Time `json:"modTime"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	IsDir   bool      `json:"isDir"`
+}
+
+// fileInfo returns the information of the entry. Times are kept to the
+// second, the precision of the Last-Modified a file is stat'ed with, so
+// both agree.
+func (i listingItem) fileInfo() *fileInfo {
+	return &fileInfo{name: i.Name, size: i.Size, modTime: i.ModTime.Truncate(time.Second), isDir: i.IsDir}
+}
+
+func (c *Client) list(op, name string) (*listing, error) {
+	resp, err := c.get(op, name, http.Header{"Accept": {"application/json"}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		return nil, &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+
+	var l listing
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("decoding listing: %w", err)}
+	}
+	return &l, nil
+}
+
+// OpenRange returns the contents of the named file from offset on. The
+// server is asked for the range only; if it sends the whole file the bytes
+// before offset are skipped. The caller must close the reader.
+func (c *Client) OpenRange(name string, offset int64) (io.ReadCloser, error) {
+	body, _, err := c.OpenRangeIf(name, offset, "")
+	return body, err
+}
+
+// OpenRangeIf is OpenRange for a file that must still have the strong ETag
+// etag, which the reads of its earlier parts were answered with. The range
+// is asked for with If-Range, and if the file changed the reader fails with
+// ErrChanged instead of mixing two versions. An empty etag accepts any
+// version. The ETag of the response is returned with the reader.
+func (c *Client) OpenRangeIf(name string, offset int64, etag string) (io.ReadCloser, string, error) {
+	if !fs.ValidPath(name) {
+		return nil, "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if strings.HasPrefix(etag, "W/") {
+		etag = "" // If-Range needs a strong ETag
+	}
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if etag != "" {
+			header.Set("If-Range", etag)
+		}
+	}
+
+	resp, err := c.get("open", name, header)
+	if err != nil {
+		return nil, "", err
+	}
+	got := resp.Header.Get("ETag")
+	if etag != "" && got != etag {
+		resp.Body.Close()
+		return nil, "", &fs.PathError{Op: "open", Path: name, Err: ErrChanged}
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		if rng, _, err := httprange.ParseContentRange(resp.Header.Get("Content-Range")); err != nil ||
+			rng == nil || rng.Start != offset {
+			resp.Body.Close()
+			return nil, "", &fs.PathError{Op: "open", Path: name,
+				Err: fmt.Errorf("partial content does not start at byte %d", offset)}
+		}
+	}
+	if offset > 0 && resp.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil && !errors.Is(err, io.EOF) {
+			resp.Body.Close()
+			return nil, "", &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return resp.Body, got, nil
+}
+
+// get issues a GET for name with request.
+func (c *Client) get(op, name string, header http.Header) (*http.Response, error) {
+	return c.request(http.MethodGet, op, name, header)
+}
+
+// request issues a request for name, retrying transient failures with
+// exponential backoff. The caller must close the response body.
+func (c *Client) request(method, op, name string, header http.Header) (*http.Response, error) {
+	target := c.baseURL.JoinPath(name)
+	if name == "." && !strings.HasSuffix(target.Path, "/") {
+		target.Path += "/"
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(method, target.String(), header)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return c.checkStatus(op, name, resp)
+		}
+		if attempt >= c.retries || c.ctx.Err() != nil {
+			if err != nil {
+				return nil, &fs.PathError{Op: op, Path: name, Err: err}
+			}
+			return c.checkStatus(op, name, resp)
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return nil, &fs.PathError{Op: op, Path: name, Err: c.ctx.Err()}
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) do(method, target string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.httpClient.Do(req)
+}
+
+// checkStatus maps HTTP errors onto fs errors, closing the body on failure.
+func (c *Client) checkStatus(op, name string, resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	var err error
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		err = fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		err = fs.ErrPermission
+	default:
+		err = fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
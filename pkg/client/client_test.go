@@ -0,0 +1,273 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/samzong/gofs/internal/config"
+	"github.com/samzong/gofs/internal/filesystem"
+	"github.com/samzong/gofs/internal/handler"
+	"github.com/samzong/gofs/pkg/client"
+)
+
+// writeTree creates a small tree and returns its root and the files in it.
+func writeTree(t *testing.T) (string, []string) {
+	t.Helper()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"readme.txt":             "hello",
+		"docs/guide.md":          "# Guide",
+		"docs/nested/deep.txt":   "deep",
+		"name with spaces.txt":   "spaces",
+		"empty/.keep-not-listed": "",
+	}
+	var names []string
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if filepath.Base(name)[0] != '.' {
+			names = append(names, name)
+		}
+	}
+	return root, names
+}
+
+func TestClient_FSDefaultHandler(t *testing.T) {
+	root, names := writeTree(t)
+	cfg := &config.Config{Theme: "default", MaxHashSize: 1 << 20}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(handler.NewFile(filesystem.NewLocal(root, false), cfg, logger))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := fstest.TestFS(c, names...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_FSAdvancedHandler(t *testing.T) {
+	root, names := writeTree(t)
+	cfg := &config.Config{Theme: "advanced", MaxHashSize: 1 << 20, RequestTimeout: 30}
+	srv := httptest.NewServer(handler.NewAdvancedFile(filesystem.NewLocal(root, false), cfg))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := fstest.TestFS(c, names...); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(c, "docs/guide.md")
+	if err != nil || string(data) != "# Guide" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	root, _ := writeTree(t)
+	cfg := &config.Config{Theme: "default", MaxHashSize: 1 << 20}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(handler.NewFile(filesystem.NewLocal(root, false), cfg, logger))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL, client.WithRetry(0, 0))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if _, err := c.Stat("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	if _, err := c.Open("readme.txt/child"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist below a file, got %v", err)
+	}
+	if _, err := c.Open("../etc/passwd"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected ErrInvalid, got %v", err)
+	}
+	if _, err := c.ReadDir("readme.txt"); err == nil {
+		t.Error("expected error reading a file as a directory")
+	}
+	if _, err := client.New("ftp://example.com"); err == nil {
+		t.Error("expected error for non-HTTP base URL")
+	}
+}
+
+func TestClient_RetryAndAuth(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"path":"/","files":null}`)
+	}))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL, client.WithBasicAuth("admin", "secret"), client.WithRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	entries, err := c.ReadDir(".")
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected empty listing, got %d entries", len(entries))
+	}
+
+	unauth, _ := client.New(srv.URL, client.WithRetry(0, 0))
+	if _, err := unauth.Stat("."); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected ErrPermission, got %v", err)
+	}
+}
+
+func TestClient_ContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c, _ := client.New(srv.URL, client.WithRetry(5, time.Hour))
+	if _, err := c.WithContext(ctx).Stat("."); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClient_OpenRange(t *testing.T) {
+	root, _ := writeTree(t)
+	cfg := &config.Config{Theme: "default", MaxHashSize: 1 << 20}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(handler.NewFile(filesystem.NewLocal(root, false), cfg, logger))
+	defer srv.Close()
+
+	// A server that ignores Range sends the whole file
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer plain.Close()
+
+	for _, baseURL := range []string{srv.URL, plain.URL} {
+		c, _ := client.New(baseURL, client.WithRetry(0, 0))
+		for offset, want := range map[int64]string{0: "hello", 2: "llo"} {
+			rc, err := c.OpenRange("readme.txt", offset)
+			if err != nil {
+				t.Fatalf("OpenRange(%d): %v", offset, err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil || string(data) != want {
+				t.Errorf("%s at %d: got %q, %v, want %q", baseURL, offset, data, err, want)
+			}
+		}
+	}
+
+	c, _ := client.New(srv.URL, client.WithRetry(0, 0))
+	if _, err := c.OpenRange("missing.txt", 1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestClient_StatHead(t *testing.T) {
+	root, _ := writeTree(t)
+	cfg := &config.Config{Theme: "default", MaxHashSize: 1 << 20}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	files := handler.NewFile(filesystem.NewLocal(root, false), cfg, logger)
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		files.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, _ := client.New(srv.URL, client.WithRetry(0, 0))
+	tests := []struct {
+		name  string
+		size  int64
+		isDir bool
+		want  []string
+	}{
+		// A file is stat'ed without listing its directory
+		{"docs/guide.md", 7, false, []string{"HEAD /docs/guide.md"}},
+		{"docs/nested", -1, true, []string{"HEAD /docs/nested", "HEAD /docs/nested/", "GET /docs", "GET /docs/"}},
+	}
+	for _, tt := range tests {
+		requests = nil
+		info, err := c.Stat(tt.name)
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", tt.name, err)
+		}
+		if tt.size >= 0 && info.Size() != tt.size || info.IsDir() != tt.isDir || info.ModTime().IsZero() {
+			t.Errorf("Stat(%s) = size %d, dir %v, modified %v", tt.name, info.Size(), info.IsDir(), info.ModTime())
+		}
+		if !slices.Equal(requests, tt.want) {
+			t.Errorf("Stat(%s): expected requests %v, got %v", tt.name, tt.want, requests)
+		}
+	}
+}
+
+func TestClient_OpenRangeIf(t *testing.T) {
+	root, _ := writeTree(t)
+	cfg := &config.Config{Theme: "default", MaxHashSize: 1 << 20}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(handler.NewFile(filesystem.NewLocal(root, false), cfg, logger))
+	defer srv.Close()
+
+	c, _ := client.New(srv.URL, client.WithRetry(0, 0))
+	rc, etag, err := c.OpenRangeIf("readme.txt", 0, "")
+	if err != nil || etag == "" {
+		t.Fatalf("expected the first download to carry an ETag, got %q, %v", etag, err)
+	}
+	rc.Close()
+
+	rc, _, err = c.OpenRangeIf("readme.txt", 2, etag)
+	if err != nil {
+		t.Fatalf("OpenRangeIf with the same ETag: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "llo" {
+		t.Errorf("expected the rest of the same file, got %q", data)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "readme.txt"), []byte("HELLO"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.OpenRangeIf("readme.txt", 2, etag); !errors.Is(err, client.ErrChanged) {
+		t.Errorf("expected ErrChanged for a changed file, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package fileutil
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// FileKind is the group a file is shown as in listings, e.g. to pick its
+// icon. Its values are safe to use in CSS class names and element IDs.
+type FileKind string
+
+const (
+	KindFolder   FileKind = "folder"
+	KindImage    FileKind = "image"
+	KindVideo    FileKind = "video"
+	KindArchive  FileKind = "archive"
+	KindCode     FileKind = "code"
+	KindDocument FileKind = "document"
+	KindFile     FileKind = "file" // Anything else
+)
+
+// FileKinds lists every FileKind, e.g. for an icon per kind.
+var FileKinds = []FileKind{KindFolder, KindImage, KindVideo, KindArchive, KindCode, KindDocument, KindFile}
+
+// kindByExtension takes precedence over kindByMimeType, for types whose MIME
+// type says little (source code is text/plain) or misleads (an SVG is an
+// image but also XML).
+var kindByExtension = map[string]FileKind{
+	".7z": KindArchive, ".bz2": KindArchive, ".gz": KindArchive, ".rar": KindArchive, ".tar": KindArchive,
+	".tgz": KindArchive, ".xz": KindArchive, ".zip": KindArchive, ".zst": KindArchive,
+
+	".c": KindCode, ".cc": KindCode, ".cpp": KindCode, ".cs": KindCode, ".css": KindCode, ".go": KindCode,
+	".h": KindCode, ".hpp": KindCode, ".htm": KindCode, ".html": KindCode, ".java": KindCode, ".js": KindCode,
+	".json": KindCode, ".kt": KindCode, ".lua": KindCode, ".php": KindCode, ".pl": KindCode, ".py": KindCode,
+	".rb": KindCode, ".rs": KindCode, ".sh": KindCode, ".sql": KindCode, ".swift": KindCode, ".toml": KindCode,
+	".ts": KindCode, ".tsx": KindCode, ".jsx": KindCode, ".xml": KindCode, ".yaml": KindCode, ".yml": KindCode,
+
+	".csv": KindDocument, ".doc": KindDocument, ".docx": KindDocument, ".epub": KindDocument,
+	".md": KindDocument, ".odp": KindDocument, ".ods": KindDocument, ".odt": KindDocument,
+	".pdf": KindDocument, ".ppt": KindDocument, ".pptx": KindDocument, ".rtf": KindDocument,
+	".txt": KindDocument, ".xls": KindDocument, ".xlsx": KindDocument,
+
+	".svg": KindImage,
+}
+
+// kindByMimeType groups the extensions not in kindByExtension by the prefix
+// of the type DetectMimeType gives them, in order.
+var kindByMimeType = []struct {
+	prefix string
+	kind   FileKind
+}{
+	{"image/", KindImage},
+	{"video/", KindVideo},
+	{"text/", KindDocument},
+}
+
+// ClassifyMime returns the FileKind of path from its extension. A path
+// ending in a slash is a folder.
+func ClassifyMime(path string) FileKind {
+	if strings.HasSuffix(path, "/") {
+		return KindFolder
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if kind, ok := kindByExtension[ext]; ok {
+		return kind
+	}
+	if ext == "" {
+		return KindFile
+	}
+	mimeType := DetectMimeType(path)
+	for _, rule := range kindByMimeType {
+		if strings.HasPrefix(mimeType, rule.prefix) {
+			return rule.kind
+		}
+	}
+	return KindFile
+}
@@ -0,0 +1,51 @@
+package fileutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifyMime(t *testing.T) {
+	tests := []struct {
+		path string
+		want FileKind
+	}{
+		{"photos/", KindFolder},
+		{"/a/b/", KindFolder},
+		{"photo.png", KindImage},
+		{"PHOTO.JPG", KindImage},
+		{"logo.svg", KindImage},
+		{"clip.mp4", KindVideo},
+		{"clip.webm", KindVideo},
+		{"backup.zip", KindArchive},
+		{"release.tar.gz", KindArchive},
+		{"main.go", KindCode},
+		{"script.py", KindCode},
+		{"config.yaml", KindCode},
+		{"page.html", KindCode},
+		{"paper.pdf", KindDocument},
+		{"README.md", KindDocument},
+		{"notes.txt", KindDocument},
+		{"report.docx", KindDocument},
+		{"song.mp3", KindFile},
+		{"binary.bin", KindFile},
+		{"Makefile", KindFile},
+		{"", KindFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ClassifyMime(tt.path); got != tt.want {
+				t.Errorf("ClassifyMime(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKindByExtension_Lowercase(t *testing.T) {
+	// ClassifyMime lower-cases extensions before looking them up
+	for ext, kind := range kindByExtension {
+		if ext != strings.ToLower(ext) || ext[0] != '.' {
+			t.Errorf("%q (%s): extensions must be lower case and start with a dot", ext, kind)
+		}
+	}
+}
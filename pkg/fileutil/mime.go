@@ -3,10 +3,14 @@ package fileutil
 
 import (
 	"mime"
+	"net/http"
 	"path/filepath"
 	"strings"
 )
 
+// SniffLen is how many leading bytes of a file DetectContentMimeType uses.
+const SniffLen = 512
+
 // DetectMimeType determines the MIME type of a file based on its extension.
 // It uses a comprehensive mapping to ensure consistent results across platforms.
 func DetectMimeType(filename string) string {
@@ -80,13 +84,54 @@ func DetectMimeType(filename string) string {
 
 	// Fallback to standard library for any types we might have missed
 	if mimeType := mime.TypeByExtension(ext); mimeType != "" {
-		return mimeType
+		return WithCharset(mimeType)
 	}
 
 	// Default to binary stream for unknown types
 	return "application/octet-stream"
 }
 
+// DetectContentMimeType determines the MIME type of a file from overrides,
+// a map of lower-case extensions (".ext") to types, then its extension, and
+// finally, if the extension is unknown or only says
+// application/octet-stream, from head, the first SniffLen bytes of the file.
+// A nil head skips sniffing, e.g. for compressed representations.
+func DetectContentMimeType(filename string, head []byte, overrides map[string]string) string {
+	if mimeType, ok := overrides[strings.ToLower(filepath.Ext(filename))]; ok {
+		return WithCharset(mimeType)
+	}
+	mimeType := DetectMimeType(filename)
+	if mimeType != "application/octet-stream" || len(head) == 0 {
+		return mimeType
+	}
+	return http.DetectContentType(head)
+}
+
+// WithCharset adds "charset=utf-8" to textual MIME types that do not name a
+// charset, and leaves every other type alone.
+func WithCharset(mimeType string) string {
+	if strings.Contains(strings.ToLower(mimeType), "charset=") || !IsTextualMimeType(mimeType) {
+		return mimeType
+	}
+	return mimeType + "; charset=utf-8"
+}
+
+// IsTextualMimeType reports whether mimeType describes text, such as text/*,
+// JSON, XML, YAML, TOML and JavaScript.
+func IsTextualMimeType(mimeType string) bool {
+	base, _, _ := strings.Cut(strings.ToLower(mimeType), ";")
+	base = strings.TrimSpace(base)
+	if strings.HasPrefix(base, "text/") {
+		return true
+	}
+	switch base {
+	case "application/json", "application/xml", "application/javascript", "application/x-yaml",
+		"application/yaml", "application/toml", "application/x-sh", "image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(base, "+json") || strings.HasSuffix(base, "+xml")
+}
+
 // IsTextFile determines whether a file should be treated as text based on its MIME type.
 func IsTextFile(filename string) bool {
 	mimeType := DetectMimeType(filename)
@@ -284,3 +284,47 @@ func TestIsImageFile(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectContentMimeType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	overrides := map[string]string{".log": "application/x-custom-log", ".notes": "text/x-notes"}
+
+	tests := []struct {
+		name     string
+		filename string
+		head     []byte
+		expected string
+	}{
+		{name: "extensionless PNG", filename: "screenshot", head: png, expected: "image/png"},
+		{name: "text in a .bin file", filename: "data.bin", head: []byte("plain words\n"),
+			expected: "text/plain; charset=utf-8"},
+		{name: "known extension wins", filename: "page.html", head: png, expected: "text/html; charset=utf-8"},
+		{name: "override", filename: "server.LOG", head: []byte("text"), expected: "application/x-custom-log"},
+		{name: "textual override gets charset", filename: "a.notes", expected: "text/x-notes; charset=utf-8"},
+		{name: "no content to sniff", filename: "archive", expected: "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectContentMimeType(tt.filename, tt.head, overrides); got != tt.expected {
+				t.Errorf("DetectContentMimeType(%q) = %q, want %q", tt.filename, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWithCharset(t *testing.T) {
+	tests := map[string]string{
+		"text/plain":                "text/plain; charset=utf-8",
+		"application/ld+json":       "application/ld+json; charset=utf-8",
+		"text/html; charset=utf-16": "text/html; charset=utf-16",
+		"image/png":                 "image/png",
+		"application/octet-stream":  "application/octet-stream",
+		"application/wasm":          "application/wasm",
+	}
+	for in, want := range tests {
+		if got := WithCharset(in); got != want {
+			t.Errorf("WithCharset(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -4,64 +4,6 @@ import (
 	"testing"
 )
 
-func TestSafePath(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name:     "empty path",
-			input:    "",
-			expected: "",
-		},
-		{
-			name:     "simple filename",
-			input:    "test.txt",
-			expected: "test.txt",
-		},
-		{
-			name:     "path with slash prefix",
-			input:    "/test.txt",
-			expected: "test.txt",
-		},
-		{
-			name:     "normal directory path",
-			input:    "dir/file.txt",
-			expected: "dir/file.txt",
-		},
-		{
-			name:     "path with parent directory",
-			input:    "../test.txt",
-			expected: "",
-		},
-		{
-			name:     "path with multiple parent directories",
-			input:    "../../etc/passwd",
-			expected: "",
-		},
-		{
-			name:     "complex path with parent directory",
-			input:    "dir/../../../etc/passwd",
-			expected: "",
-		},
-		{
-			name:     "normal nested path",
-			input:    "dir/subdir/file.txt",
-			expected: "dir/subdir/file.txt",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := SafePath(tt.input)
-			if result != tt.expected {
-				t.Errorf("SafePath(%q) = %q, want %q", tt.input, result, tt.expected)
-			}
-		})
-	}
-}
-
 func TestIsHidden(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -90,6 +32,30 @@ func TestIsHidden(t *testing.T) {
 	}
 }
 
+func TestIsHiddenPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rel      string
+		expected bool
+	}{
+		{"root", "", false},
+		{"slash root", "/", false},
+		{"normal file", "docs/readme.md", false},
+		{"dot file", "docs/.env", true},
+		{"below dot directory", ".git/HEAD", true},
+		{"leading slash", "/sub/.hidden/file.txt", true},
+		{"system file", "photos/Thumbs.db", true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := IsHiddenPath(tt.rel); result != tt.expected {
+				t.Errorf("IsHiddenPath(%q) = %v, want %v", tt.rel, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestFormatSize(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,56 @@
+package fileutil
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the suffixes accepted by ParseSize. Like FormatSize they use
+// binary multiples, so "1KB" and "1KiB" are both 1024 bytes.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TIB", 1 << 40}, {"TB", 1 << 40}, {"T", 1 << 40},
+	{"GIB", 1 << 30}, {"GB", 1 << 30}, {"G", 1 << 30},
+	{"MIB", 1 << 20}, {"MB", 1 << 20}, {"M", 1 << 20},
+	{"KIB", 1 << 10}, {"KB", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a byte size such as "512MB", "2GiB" or "1048576".
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			multiplier = u.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n*float64(multiplier) >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ParseLimit parses a size like ParseSize, but refuses sizes below one byte:
+// a limit of zero would refuse everything it applies to.
+func ParseLimit(s string) (int64, error) {
+	n, err := ParseSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("size %q must be positive", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,49 @@
+package fileutil
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "1048576", want: 1 << 20},
+		{input: "10GB", want: 10 << 30},
+		{input: "512mb", want: 512 << 20},
+		{input: "1.5K", want: 1536},
+		{input: "2 TiB", want: 2 << 40},
+		{input: "2GiB", want: 2 << 30},
+		{input: "100MB", want: 100 << 20},
+		{input: "100B", want: 100},
+		{input: "", wantErr: true},
+		{input: "GB", wantErr: true},
+		{input: "-1GB", wantErr: true},
+		{input: "ten", wantErr: true},
+		{input: "99999999999TB", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseSize(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseSize(%q): expected error, got %d", tc.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", tc.input, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	if got, err := ParseLimit("100MB"); err != nil || got != 100<<20 {
+		t.Errorf("ParseLimit(100MB) = %d, %v; want %d", got, err, 100<<20)
+	}
+	for _, input := range []string{"0", "0.1", "0MB", "", "-5"} {
+		if got, err := ParseLimit(input); err == nil {
+			t.Errorf("ParseLimit(%q): expected error, got %d", input, got)
+		}
+	}
+}
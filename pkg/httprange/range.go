@@ -4,12 +4,14 @@
 package httprange
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 var (
@@ -19,8 +21,22 @@ var (
 	ErrUnsatisfiableRange = errors.New("range not satisfiable")
 	// ErrMultipleRanges indicates multiple ranges were requested (not supported)
 	ErrMultipleRanges = errors.New("multiple ranges not supported")
+	// ErrClientAborted wraps the errors of a copy the client ended, either by
+	// canceling the request context or by a failed write to the response
+	ErrClientAborted = errors.New("client aborted")
 )
 
+// copyBufferSize is the chunk size content is copied in. The request
+// context is checked between chunks.
+const copyBufferSize = 64 << 10
+
+var copyBufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
 // Range represents a single byte range request
 type Range struct {
 	Start  int64 // Start byte position (inclusive)
@@ -35,6 +51,11 @@ type Range struct {
 //   - bytes=-500      (last 500 bytes)
 //   - bytes=500-      (from byte 500 to end)
 //
+// Optional whitespace is accepted around "=" and around list commas, and
+// positions too large for an int64 never wrap: a first position past any
+// file is unsatisfiable, and a last position or suffix length past it is
+// clamped like any other.
+//
 // Currently only supports single range requests.
 func ParseRange(rangeHeader string, fileSize int64) (*Range, error) {
 	if rangeHeader == "" {
@@ -42,15 +63,22 @@ func ParseRange(rangeHeader string, fileSize int64) (*Range, error) {
 	}
 
 	// Range header must start with "bytes="
-	const prefix = "bytes="
-	if !strings.HasPrefix(rangeHeader, prefix) {
+	unit, rangeSet, ok := strings.Cut(rangeHeader, "=")
+	if !ok || trimOWS(unit) != "bytes" {
 		return nil, ErrInvalidRange
 	}
 
-	rangeSpec := strings.TrimPrefix(rangeHeader, prefix)
-
-	// Check for multiple ranges (not supported)
-	if strings.Contains(rangeSpec, ",") {
+	// The list rule allows empty elements, so "bytes=0-499," is one range
+	var rangeSpec string
+	specs := 0
+	for _, elem := range strings.Split(rangeSet, ",") {
+		if elem = trimOWS(elem); elem != "" {
+			rangeSpec = elem
+			specs++
+		}
+	}
+	if specs > 1 {
+		// Check for multiple ranges (not supported)
 		return nil, ErrMultipleRanges
 	}
 
@@ -67,31 +95,31 @@ func ParseRange(rangeHeader string, fileSize int64) (*Range, error) {
 	switch {
 	case parts[0] == "" && parts[1] != "":
 		// Suffix range: -N means last N bytes
-		n, err := strconv.ParseInt(parts[1], 10, 64)
+		n, err := parsePos(parts[1])
 		if err != nil || n <= 0 {
 			return nil, ErrInvalidRange
 		}
-		start = fileSize - n
-		if start < 0 {
-			start = 0
+		start = 0
+		if n < fileSize {
+			start = fileSize - n
 		}
 		end = fileSize - 1
 
 	case parts[0] != "" && parts[1] == "":
 		// Open-ended range: N- means from byte N to end
-		start, err = strconv.ParseInt(parts[0], 10, 64)
-		if err != nil || start < 0 {
+		start, err = parsePos(parts[0])
+		if err != nil {
 			return nil, ErrInvalidRange
 		}
 		end = fileSize - 1
 
 	case parts[0] != "" && parts[1] != "":
 		// Bounded range: N-M means bytes N through M
-		start, err = strconv.ParseInt(parts[0], 10, 64)
-		if err != nil || start < 0 {
+		start, err = parsePos(parts[0])
+		if err != nil {
 			return nil, ErrInvalidRange
 		}
-		end, err = strconv.ParseInt(parts[1], 10, 64)
+		end, err = parsePos(parts[1])
 		if err != nil || end < start {
 			return nil, ErrInvalidRange
 		}
@@ -116,44 +144,174 @@ func ParseRange(rangeHeader string, fileSize int64) (*Range, error) {
 	}, nil
 }
 
+// parsePos parses a byte position. Positions too large for an int64
+// saturate at math.MaxInt64, which lies past the end of any file, instead of
+// failing or wrapping.
+func parsePos(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if errors.Is(err, strconv.ErrRange) && n > 0 {
+		return n, nil
+	}
+	if err != nil || n < 0 {
+		return 0, ErrInvalidRange
+	}
+	return n, nil
+}
+
+// trimOWS removes the optional whitespace (spaces and tabs) HTTP allows
+// around list elements and parameters.
+func trimOWS(s string) string {
+	return strings.Trim(s, " \t")
+}
+
 // ContentRange returns the Content-Range header value for this range
 func (r *Range) ContentRange(fileSize int64) string {
 	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, fileSize)
 }
 
+// ParseContentRange parses the Content-Range header of a response, as
+// clients resuming a download check it. The range is nil for "bytes */size",
+// sent with 416, and the size is -1 when the server does not know it.
+func ParseContentRange(header string) (*Range, int64, error) {
+	spec, ok := strings.CutPrefix(trimOWS(header), "bytes ")
+	if !ok {
+		return nil, 0, ErrInvalidRange
+	}
+	span, sizeStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, 0, ErrInvalidRange
+	}
+
+	size := int64(-1)
+	if sizeStr != "*" {
+		n, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || n < 0 {
+			return nil, 0, ErrInvalidRange
+		}
+		size = n
+	}
+	if span == "*" {
+		if size < 0 {
+			return nil, 0, ErrInvalidRange
+		}
+		return nil, size, nil
+	}
+
+	startStr, endStr, ok := strings.Cut(span, "-")
+	if !ok {
+		return nil, 0, ErrInvalidRange
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return nil, 0, ErrInvalidRange
+	}
+	end, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil || end < start || size >= 0 && end >= size {
+		return nil, 0, ErrInvalidRange
+	}
+	return &Range{Start: start, End: end, Length: end - start + 1}, size, nil
+}
+
 // ServeContent serves the specified range of content from the reader.
-// It sets appropriate headers and returns the partial content.
-func ServeContent(w http.ResponseWriter, r io.ReadSeeker, rng *Range, fileSize int64, mimeType string) error {
+// It sets appropriate headers and returns the partial content. The copy stops
+// once ctx is done; the number of body bytes written is returned either way.
+// Errors caused by the client wrap ErrClientAborted.
+func ServeContent(ctx context.Context, w http.ResponseWriter, r io.ReadSeeker, rng *Range, fileSize int64,
+	mimeType string,
+) (int64, error) {
 	// Seek to the start position
 	if _, err := r.Seek(rng.Start, io.SeekStart); err != nil {
-		return fmt.Errorf("seek failed: %w", err)
+		return 0, fmt.Errorf("seek failed: %w", err)
 	}
 
-	// Set response headers for partial content
-	w.Header().Set("Content-Range", rng.ContentRange(fileSize))
-	w.Header().Set("Content-Length", strconv.FormatInt(rng.Length, 10))
+	WriteHeader(w, rng, fileSize, mimeType)
+
+	// Copy the requested range
+	return copyContent(ctx, w, r, rng.Length)
+}
+
+// WriteHeader writes the headers and status that ServeContent, or
+// ServeFullContent for a nil rng, sends before the body. Handlers answer
+// HEAD requests with it alone.
+func WriteHeader(w http.ResponseWriter, rng *Range, fileSize int64, mimeType string) {
 	w.Header().Set("Content-Type", mimeType)
+	if rng == nil {
+		acceptRanges(w)
+		w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
 	w.Header().Set("Accept-Ranges", "bytes")
-
-	// Set 206 Partial Content status
+	w.Header().Set("Content-Range", rng.ContentRange(fileSize))
+	w.Header().Set("Content-Length", strconv.FormatInt(rng.Length, 10))
 	w.WriteHeader(http.StatusPartialContent)
-
-	// Copy the requested range
-	_, err := io.CopyN(w, r, rng.Length)
-	return err
 }
 
 // ServeFullContent serves the entire content when no range is requested.
-// It sets the Accept-Ranges header to indicate range support.
-func ServeFullContent(w http.ResponseWriter, r io.Reader, fileSize int64, mimeType string) error {
+// It sets the Accept-Ranges header to indicate range support, unless the
+// handler set it already: a representation ranges are not served from, such
+// as an encoded one, sets "none". Like ServeContent it stops once ctx is
+// done and returns the bytes written.
+func ServeFullContent(ctx context.Context, w http.ResponseWriter, r io.Reader, fileSize int64,
+	mimeType string,
+) (int64, error) {
 	// Set headers for full content
-	w.Header().Set("Accept-Ranges", "bytes")
+	acceptRanges(w)
 	w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
 	w.Header().Set("Content-Type", mimeType)
 
 	// Copy the entire content
-	_, err := io.Copy(w, r)
-	return err
+	return copyContent(ctx, w, r, -1)
+}
+
+// acceptRanges advertises byte ranges unless the handler already set
+// Accept-Ranges.
+func acceptRanges(w http.ResponseWriter) {
+	if w.Header().Get("Accept-Ranges") == "" {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+}
+
+// copyContent copies limit bytes from r to w, or everything up to EOF if
+// limit is negative, in chunks from copyBufferPool. A reader that ends
+// before limit bytes yields io.ErrUnexpectedEOF.
+func copyContent(ctx context.Context, w io.Writer, r io.Reader, limit int64) (int64, error) {
+	bufp := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(bufp)
+	buf := *bufp
+
+	var written int64
+	for limit < 0 || written < limit {
+		if err := ctx.Err(); err != nil {
+			return written, fmt.Errorf("%w: %w", ErrClientAborted, err)
+		}
+
+		chunk := buf
+		if limit >= 0 && limit-written < int64(len(chunk)) {
+			chunk = chunk[:limit-written]
+		}
+		nr, rerr := r.Read(chunk)
+		if nr > 0 {
+			nw, werr := w.Write(chunk[:nr])
+			written += int64(nw)
+			if werr == nil && nw < nr {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				return written, fmt.Errorf("%w: %w", ErrClientAborted, werr)
+			}
+		}
+		if rerr == io.EOF {
+			if limit >= 0 && written < limit {
+				return written, io.ErrUnexpectedEOF
+			}
+			return written, nil
+		}
+		if rerr != nil {
+			return written, fmt.Errorf("read failed: %w", rerr)
+		}
+	}
+	return written, nil
 }
 
 // WriteRangeNotSatisfiable writes a 416 Range Not Satisfiable response
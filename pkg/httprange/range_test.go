@@ -2,149 +2,219 @@ package httprange
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 )
 
-func TestParseRange(t *testing.T) {
-	tests := []struct {
-		name        string
-		rangeHeader string
-		fileSize    int64
-		want        *Range
-		wantErr     error
-	}{
-		{
-			name:        "empty range header",
-			rangeHeader: "",
-			fileSize:    1000,
-			want:        nil,
-			wantErr:     nil,
-		},
-		{
-			name:        "bounded range",
-			rangeHeader: "bytes=0-499",
-			fileSize:    1000,
-			want: &Range{
-				Start:  0,
-				End:    499,
-				Length: 500,
-			},
-			wantErr: nil,
-		},
-		{
-			name:        "open-ended range",
-			rangeHeader: "bytes=500-",
-			fileSize:    1000,
-			want: &Range{
-				Start:  500,
-				End:    999,
-				Length: 500,
-			},
-			wantErr: nil,
-		},
-		{
-			name:        "suffix range",
-			rangeHeader: "bytes=-500",
-			fileSize:    1000,
-			want: &Range{
-				Start:  500,
-				End:    999,
-				Length: 500,
-			},
-			wantErr: nil,
-		},
-		{
-			name:        "suffix range larger than file",
-			rangeHeader: "bytes=-2000",
-			fileSize:    1000,
-			want: &Range{
-				Start:  0,
-				End:    999,
-				Length: 1000,
-			},
-			wantErr: nil,
-		},
-		{
-			name:        "end clamped to file size",
-			rangeHeader: "bytes=500-2000",
-			fileSize:    1000,
-			want: &Range{
-				Start:  500,
-				End:    999,
-				Length: 500,
-			},
-			wantErr: nil,
+// parseRangeTests are shared by TestParseRange and the FuzzParseRange seed
+// corpus.
+var parseRangeTests = []struct {
+	name        string
+	rangeHeader string
+	fileSize    int64
+	want        *Range
+	wantErr     error
+}{
+	{
+		name:        "empty range header",
+		rangeHeader: "",
+		fileSize:    1000,
+		want:        nil,
+		wantErr:     nil,
+	},
+	{
+		name:        "bounded range",
+		rangeHeader: "bytes=0-499",
+		fileSize:    1000,
+		want: &Range{
+			Start:  0,
+			End:    499,
+			Length: 500,
 		},
-		{
-			name:        "invalid prefix",
-			rangeHeader: "chunks=0-499",
-			fileSize:    1000,
-			want:        nil,
-			wantErr:     ErrInvalidRange,
+		wantErr: nil,
+	},
+	{
+		name:        "open-ended range",
+		rangeHeader: "bytes=500-",
+		fileSize:    1000,
+		want: &Range{
+			Start:  500,
+			End:    999,
+			Length: 500,
 		},
-		{
-			name:        "multiple ranges not supported",
-			rangeHeader: "bytes=0-499,500-999",
-			fileSize:    1000,
-			want:        nil,
-			wantErr:     ErrMultipleRanges,
+		wantErr: nil,
+	},
+	{
+		name:        "suffix range",
+		rangeHeader: "bytes=-500",
+		fileSize:    1000,
+		want: &Range{
+			Start:  500,
+			End:    999,
+			Length: 500,
 		},
-		{
-			name:        "invalid range format",
-			rangeHeader: "bytes=invalid",
-			fileSize:    1000,
-			want:        nil,
-			wantErr:     ErrInvalidRange,
+		wantErr: nil,
+	},
+	{
+		name:        "suffix range larger than file",
+		rangeHeader: "bytes=-2000",
+		fileSize:    1000,
+		want: &Range{
+			Start:  0,
+			End:    999,
+			Length: 1000,
 		},
-		{
-			name:        "start after end",
-			rangeHeader: "bytes=500-100",
-			fileSize:    1000,
-			want:        nil,
-			wantErr:     ErrInvalidRange,
+		wantErr: nil,
+	},
+	{
+		name:        "end clamped to file size",
+		rangeHeader: "bytes=500-2000",
+		fileSize:    1000,
+		want: &Range{
+			Start:  500,
+			End:    999,
+			Length: 500,
 		},
-		{
-			name:        "start beyond file size",
-			rangeHeader: "bytes=1500-2000",
-			fileSize:    1000,
-			want:        nil,
-			wantErr:     ErrUnsatisfiableRange,
-		},
-		{
-			name:        "negative start",
-			rangeHeader: "bytes=-500-999",
-			fileSize:    1000,
-			want:        nil,
-			wantErr:     ErrInvalidRange,
+		wantErr: nil,
+	},
+	{
+		name:        "invalid prefix",
+		rangeHeader: "chunks=0-499",
+		fileSize:    1000,
+		want:        nil,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "multiple ranges not supported",
+		rangeHeader: "bytes=0-499,500-999",
+		fileSize:    1000,
+		want:        nil,
+		wantErr:     ErrMultipleRanges,
+	},
+	{
+		name:        "invalid range format",
+		rangeHeader: "bytes=invalid",
+		fileSize:    1000,
+		want:        nil,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "start after end",
+		rangeHeader: "bytes=500-100",
+		fileSize:    1000,
+		want:        nil,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "start beyond file size",
+		rangeHeader: "bytes=1500-2000",
+		fileSize:    1000,
+		want:        nil,
+		wantErr:     ErrUnsatisfiableRange,
+	},
+	{
+		name:        "negative start",
+		rangeHeader: "bytes=-500-999",
+		fileSize:    1000,
+		want:        nil,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "single byte range",
+		rangeHeader: "bytes=0-0",
+		fileSize:    1000,
+		want: &Range{
+			Start:  0,
+			End:    0,
+			Length: 1,
 		},
-		{
-			name:        "single byte range",
-			rangeHeader: "bytes=0-0",
-			fileSize:    1000,
-			want: &Range{
-				Start:  0,
-				End:    0,
-				Length: 1,
-			},
-			wantErr: nil,
+		wantErr: nil,
+	},
+	{
+		name:        "last byte",
+		rangeHeader: "bytes=999-999",
+		fileSize:    1000,
+		want: &Range{
+			Start:  999,
+			End:    999,
+			Length: 1,
 		},
-		{
-			name:        "last byte",
-			rangeHeader: "bytes=999-999",
-			fileSize:    1000,
-			want: &Range{
-				Start:  999,
-				End:    999,
-				Length: 1,
-			},
-			wantErr: nil,
-		},
-	}
+		wantErr: nil,
+	},
+	{
+		name:        "whitespace around equals and commas",
+		rangeHeader: "bytes = 0-499 ,\t",
+		fileSize:    1000,
+		want:        &Range{Start: 0, End: 499, Length: 500},
+	},
+	{
+		name:        "whitespace between ranges",
+		rangeHeader: "bytes=0-1 , 5-6",
+		fileSize:    1000,
+		wantErr:     ErrMultipleRanges,
+	},
+	{
+		name:        "whitespace inside range",
+		rangeHeader: "bytes=0 -499",
+		fileSize:    1000,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "empty suffix",
+		rangeHeader: "bytes=-",
+		fileSize:    1000,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "double dash",
+		rangeHeader: "bytes=--1",
+		fileSize:    1000,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "empty range set",
+		rangeHeader: "bytes=",
+		fileSize:    1000,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "overflowing start",
+		rangeHeader: "bytes=9999999999999999999999-",
+		fileSize:    1000,
+		wantErr:     ErrUnsatisfiableRange,
+	},
+	{
+		name:        "overflowing start and end",
+		rangeHeader: "bytes=9999999999999999999999-99999999999999999999999",
+		fileSize:    1000,
+		wantErr:     ErrUnsatisfiableRange,
+	},
+	{
+		name:        "overflowing start before end",
+		rangeHeader: "bytes=9999999999999999999999-5",
+		fileSize:    1000,
+		wantErr:     ErrInvalidRange,
+	},
+	{
+		name:        "overflowing end",
+		rangeHeader: "bytes=500-9999999999999999999999",
+		fileSize:    1000,
+		want:        &Range{Start: 500, End: 999, Length: 500},
+	},
+	{
+		name:        "overflowing suffix",
+		rangeHeader: "bytes=-9999999999999999999999",
+		fileSize:    1000,
+		want:        &Range{Start: 0, End: 999, Length: 1000},
+	},
+}
 
-	for _, tt := range tests {
+func TestParseRange(t *testing.T) {
+	for _, tt := range parseRangeTests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := ParseRange(tt.rangeHeader, tt.fileSize)
 
@@ -172,6 +242,37 @@ func TestParseRange(t *testing.T) {
 	}
 }
 
+func FuzzParseRange(f *testing.F) {
+	for _, tt := range parseRangeTests {
+		f.Add(tt.rangeHeader, tt.fileSize)
+	}
+	f.Add("bytes=-0", int64(0))
+	f.Add("bytes=0-", int64(-1))
+	f.Add("bytes=-9223372036854775807", int64(-9223372036854775808))
+
+	f.Fuzz(func(t *testing.T, rangeHeader string, fileSize int64) {
+		got, err := ParseRange(rangeHeader, fileSize)
+		if err != nil {
+			if got != nil {
+				t.Fatalf("ParseRange(%q, %d) returned %+v with error %v", rangeHeader, fileSize, got, err)
+			}
+			if err != ErrInvalidRange && err != ErrUnsatisfiableRange && err != ErrMultipleRanges {
+				t.Fatalf("ParseRange(%q, %d) returned unexpected error %v", rangeHeader, fileSize, err)
+			}
+			return
+		}
+		if got == nil {
+			if rangeHeader != "" {
+				t.Fatalf("ParseRange(%q, %d) returned no range and no error", rangeHeader, fileSize)
+			}
+			return
+		}
+		if got.Start < 0 || got.Start > got.End || got.End >= fileSize || got.Length != got.End-got.Start+1 {
+			t.Fatalf("ParseRange(%q, %d) = %+v, outside the file", rangeHeader, fileSize, got)
+		}
+	})
+}
+
 func TestContentRange(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -221,6 +322,43 @@ func TestContentRange(t *testing.T) {
 	}
 }
 
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    *Range
+		size    int64
+		wantErr bool
+	}{
+		{header: "bytes 0-499/1000", want: &Range{Start: 0, End: 499, Length: 500}, size: 1000},
+		{header: "bytes 500-999/*", want: &Range{Start: 500, End: 999, Length: 500}, size: -1},
+		{header: "bytes */1000", size: 1000},
+		{header: "bytes */*", wantErr: true},
+		{header: "bytes 500-999/500", wantErr: true},
+		{header: "bytes 9-3/10", wantErr: true},
+		{header: "bytes -3/10", wantErr: true},
+		{header: "items 0-1/2", wantErr: true},
+		{header: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, size, err := ParseContentRange(tt.header)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRange) {
+					t.Errorf("expected ErrInvalidRange, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != tt.size || (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("got %+v size %d, want %+v size %d", got, size, tt.want, tt.size)
+			}
+		})
+	}
+}
+
 func TestServeContent(t *testing.T) {
 	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
 	fileSize := int64(len(content))
@@ -272,10 +410,13 @@ func TestServeContent(t *testing.T) {
 			reader := bytes.NewReader(content)
 			recorder := httptest.NewRecorder()
 
-			err := ServeContent(recorder, reader, tt.rng, fileSize, "text/plain")
+			n, err := ServeContent(context.Background(), recorder, reader, tt.rng, fileSize, "text/plain")
 			if err != nil {
 				t.Fatalf("ServeContent() error = %v", err)
 			}
+			if n != tt.rng.Length {
+				t.Errorf("ServeContent() wrote %d bytes, want %d", n, tt.rng.Length)
+			}
 
 			resp := recorder.Result()
 			defer resp.Body.Close()
@@ -306,6 +447,22 @@ func TestServeContent(t *testing.T) {
 	}
 }
 
+func TestWriteHeader(t *testing.T) {
+	rr := httptest.NewRecorder()
+	WriteHeader(rr, nil, 100, "text/plain")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Length") != "100" || rr.Body.Len() != 0 {
+		t.Errorf("full: got %d, Content-Length %s", rr.Code, rr.Header().Get("Content-Length"))
+	}
+
+	rr = httptest.NewRecorder()
+	WriteHeader(rr, &Range{Start: 10, End: 19, Length: 10}, 100, "text/plain")
+	if rr.Code != http.StatusPartialContent || rr.Header().Get("Content-Length") != "10" ||
+		rr.Header().Get("Content-Range") != "bytes 10-19/100" || rr.Body.Len() != 0 {
+		t.Errorf("range: got %d, Content-Length %s, Content-Range %s",
+			rr.Code, rr.Header().Get("Content-Length"), rr.Header().Get("Content-Range"))
+	}
+}
+
 func TestServeFullContent(t *testing.T) {
 	content := []byte("Full content of the file")
 	fileSize := int64(len(content))
@@ -313,10 +470,13 @@ func TestServeFullContent(t *testing.T) {
 	reader := bytes.NewReader(content)
 	recorder := httptest.NewRecorder()
 
-	err := ServeFullContent(recorder, reader, fileSize, "text/plain")
+	n, err := ServeFullContent(context.Background(), recorder, reader, fileSize, "text/plain")
 	if err != nil {
 		t.Fatalf("ServeFullContent() error = %v", err)
 	}
+	if n != fileSize {
+		t.Errorf("ServeFullContent() wrote %d bytes, want %d", n, fileSize)
+	}
 
 	resp := recorder.Result()
 	defer resp.Body.Close()
@@ -345,6 +505,107 @@ func TestServeFullContent(t *testing.T) {
 	}
 }
 
+// cancelingWriter cancels its context once limit bytes have been written.
+type cancelingWriter struct {
+	*httptest.ResponseRecorder
+	cancel  context.CancelFunc
+	limit   int
+	written int
+}
+
+func (w *cancelingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseRecorder.Write(p)
+	if w.written += n; w.written >= w.limit {
+		w.cancel()
+	}
+	return n, err
+}
+
+// failingWriter fails every write after the first limit bytes.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+var errBrokenPipe = errors.New("broken pipe")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.limit {
+		w.limit -= len(p)
+		return w.ResponseRecorder.Write(p)
+	}
+	n, _ := w.ResponseRecorder.Write(p[:w.limit])
+	w.limit = 0
+	return n, errBrokenPipe
+}
+
+// failingReader returns data and then fails.
+type failingReader struct {
+	data []byte
+}
+
+var errDisk = errors.New("disk error")
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errDisk
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestServeContent_Canceled(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4*copyBufferSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelingWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel, limit: copyBufferSize}
+
+	rng := &Range{Start: 0, End: int64(len(content)) - 1, Length: int64(len(content))}
+	n, err := ServeContent(ctx, w, bytes.NewReader(content), rng, int64(len(content)), "text/plain")
+	if !errors.Is(err, ErrClientAborted) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a client abort wrapping context.Canceled, got %v", err)
+	}
+	if n != copyBufferSize || int64(w.Body.Len()) != n {
+		t.Errorf("expected %d bytes before the cancel, wrote %d (body %d)", copyBufferSize, n, w.Body.Len())
+	}
+
+	// A context canceled up front writes no body at all
+	n, err = ServeFullContent(ctx, httptest.NewRecorder(), bytes.NewReader(content), int64(len(content)), "text/plain")
+	if n != 0 || !errors.Is(err, ErrClientAborted) {
+		t.Errorf("expected nothing written and a client abort, got %d, %v", n, err)
+	}
+}
+
+func TestServeFullContent_Errors(t *testing.T) {
+	content := bytes.Repeat([]byte("y"), 3*copyBufferSize)
+
+	w := &failingWriter{ResponseRecorder: httptest.NewRecorder(), limit: copyBufferSize + 10}
+	n, err := ServeFullContent(context.Background(), w, bytes.NewReader(content), int64(len(content)), "text/plain")
+	if !errors.Is(err, ErrClientAborted) || !errors.Is(err, errBrokenPipe) {
+		t.Errorf("expected a client abort wrapping the write error, got %v", err)
+	}
+	if n != copyBufferSize+10 {
+		t.Errorf("expected %d bytes written, got %d", copyBufferSize+10, n)
+	}
+
+	r := &failingReader{data: content[:100]}
+	n, err = ServeFullContent(context.Background(), httptest.NewRecorder(), r, int64(len(content)), "text/plain")
+	if !errors.Is(err, errDisk) || errors.Is(err, ErrClientAborted) {
+		t.Errorf("expected a server-side read error, got %v", err)
+	}
+	if n != 100 {
+		t.Errorf("expected 100 bytes written, got %d", n)
+	}
+
+	rng := &Range{Start: 0, End: 199, Length: 200}
+	_, err = ServeContent(context.Background(), httptest.NewRecorder(), bytes.NewReader(content[:150]), rng,
+		200, "text/plain")
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a short file, got %v", err)
+	}
+}
+
 func TestWriteRangeNotSatisfiable(t *testing.T) {
 	recorder := httptest.NewRecorder()
 
@@ -0,0 +1,111 @@
+// Package pathsafe validates paths supplied by clients, such as request paths,
+// query parameters and upload file names, before they reach the filesystem.
+package pathsafe
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInvalid is returned for paths that must be rejected rather than served:
+// parent directory references, encoded traversal, control characters and
+// absolute Windows paths.
+var ErrInvalid = errors.New("invalid path")
+
+// ErrTooDeep and ErrNameTooLong are returned for paths outside Limits.
+var (
+	ErrTooDeep     = errors.New("path too deep")
+	ErrNameTooLong = errors.New("path segment too long")
+)
+
+// Limits bounds the shape of a path. A zero field turns its check off.
+type Limits struct {
+	MaxDepth      int // Most segments
+	MaxNameLength int // Most bytes in one segment
+}
+
+// encodedTraversal lists escaped forms of ".." that have no business in a path
+// that has already been unescaped once.
+var encodedTraversal = []string{"%2e%2e", "%252e%252e", "0x2e0x2e"}
+
+// Clean returns path as a clean, slash-separated path relative to the root it
+// is resolved against, without leading or trailing slashes. Repeated slashes
+// and "." segments are collapsed, so "///a//b/" is "a/b". The root itself,
+// whether given as "", "/" or "/./", is "".
+//
+// Clean never resolves ".." segments: a path containing one is ErrInvalid,
+// as is one with a NUL or other control character, an encoded "..", or a
+// leading Windows drive letter. Backslashes count as separators when looking
+// for "..", so "..\\x" is rejected too.
+func Clean(p string) (string, error) {
+	for _, r := range p {
+		if unicode.IsControl(r) && r != '\t' {
+			return "", ErrInvalid
+		}
+	}
+
+	// Unicode normalization prevents look-alike encodings from slipping by
+	p = norm.NFC.String(p)
+
+	lower := strings.ToLower(p)
+	for _, pattern := range encodedTraversal {
+		if strings.Contains(lower, pattern) {
+			return "", ErrInvalid
+		}
+	}
+
+	segments := strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' })
+	for _, segment := range segments {
+		// "..;" is how some servers spell ".." with path parameters
+		if name, _, _ := strings.Cut(segment, ";"); name == ".." {
+			return "", ErrInvalid
+		}
+	}
+	if len(segments) > 0 && isDriveLetter(segments[0]) {
+		return "", ErrInvalid
+	}
+
+	return strings.TrimPrefix(path.Clean("/"+p), "/"), nil
+}
+
+// Check returns ErrTooDeep if p has more than l.MaxDepth segments, or
+// ErrNameTooLong if one is longer than l.MaxNameLength bytes. Segments are
+// separated by slashes; empty ones, as in "/a//b/", do not count.
+func (l Limits) Check(p string) error {
+	depth := 0
+	for segment := range strings.SplitSeq(p, "/") {
+		if segment == "" {
+			continue
+		}
+		if depth++; l.MaxDepth > 0 && depth > l.MaxDepth {
+			return ErrTooDeep
+		}
+		if l.MaxNameLength > 0 && len(segment) > l.MaxNameLength {
+			return ErrNameTooLong
+		}
+	}
+	return nil
+}
+
+// Clean is Clean followed by Check, for names such as upload file names
+// that do not arrive in a request URL.
+func (l Limits) Clean(p string) (string, error) {
+	clean, err := Clean(p)
+	if err != nil {
+		return "", err
+	}
+	if err := l.Check(clean); err != nil {
+		return "", err
+	}
+	return clean, nil
+}
+
+// isDriveLetter reports whether segment starts like "C:".
+func isDriveLetter(segment string) bool {
+	return len(segment) >= 2 && segment[1] == ':' &&
+		('a' <= segment[0] && segment[0] <= 'z' || 'A' <= segment[0] && segment[0] <= 'Z')
+}
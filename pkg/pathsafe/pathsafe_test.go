@@ -0,0 +1,141 @@
+package pathsafe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClean_Valid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"empty_path", "", ""},
+		{"root_path", "/", ""},
+		{"dot_root", "/./", ""},
+		{"simple_file", "test.txt", "test.txt"},
+		{"leading_slash", "/test.txt", "test.txt"},
+		{"nested_file", "/dir/file.txt", "dir/file.txt"},
+		{"deep_nested", "/a/b/c/d/file.txt", "a/b/c/d/file.txt"},
+		{"trailing_slash", "/dir/", "dir"},
+		{"dot_segment", "/./file.txt", "file.txt"},
+		{"multiple_slashes", "///file.txt", "file.txt"},
+		{"inner_slashes", "/dir//sub///file.txt", "dir/sub/file.txt"},
+		{"unc_like", "//server/share", "server/share"},
+		{"with_spaces", "/dir with spaces/file.txt", "dir with spaces/file.txt"},
+		{"unicode_path", "/测试/文件.txt", "测试/文件.txt"},
+		{"nfc_normalized", "/cafe\u0301.txt", "caf\u00e9.txt"},
+		{"dots_in_name", "notes..txt", "notes..txt"},
+		{"three_dots", ".../file.txt", ".../file.txt"},
+		{"tab", "a\tb.txt", "a\tb.txt"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Clean(tc.input)
+			if err != nil {
+				t.Fatalf("Clean(%q) failed: %v", tc.input, err)
+			}
+			if result != tc.expected {
+				t.Errorf("Clean(%q) = %q, want %q", tc.input, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestClean_Invalid(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"parent", "../test.txt"},
+		{"parent_only", ".."},
+		{"rooted_parent", "/../safe.txt"},
+		{"multiple_parents", "../../etc/passwd"},
+		{"complex_traversal", "/dir/../../../etc/passwd"},
+		{"inner_parent", "dir/../file.txt"},
+		{"trailing_parent", "dir/.."},
+		{"double_slash_parent", "//../etc/passwd"},
+		{"windows_traversal", "/..\\..\\windows\\system32\\config"},
+		{"mixed_separators", "dir\\..\\..\\etc"},
+		{"path_parameter", "/..;/etc/passwd"},
+		{"encoded_traversal", "/%2e%2e/etc/passwd"},
+		{"encoded_traversal_upper", "/%2E%2E/etc/passwd"},
+		{"double_encoded_traversal", "/%252e%252e/etc/passwd"},
+		{"hex_traversal", "/0x2e0x2e/etc/passwd"},
+		{"null_byte", "/file\x00.txt"},
+		{"newline", "/file\n.txt"},
+		{"escape_character", "/file\x1b.txt"},
+		{"drive_letter", "C:/Windows/system.ini"},
+		{"rooted_drive_letter", "/c:\\Windows"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Clean(tc.input)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Clean(%q) = %q, %v; want ErrInvalid", tc.input, result, err)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	deep := strings.Repeat("d/", 64)
+	long := strings.Repeat("x", 255)
+	limits := Limits{MaxDepth: 64, MaxNameLength: 255}
+
+	testCases := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"root", "/", nil},
+		{"at_depth", deep, nil},
+		{"empty_segments", "//" + strings.ReplaceAll(deep, "/", "//"), nil},
+		{"too_deep", deep + "file.txt", ErrTooDeep},
+		{"at_length", "/a/" + long, nil},
+		{"multibyte_at_length", "/" + strings.Repeat("é", 127), nil},
+		{"name_too_long", "/a/" + long + "x/b", ErrNameTooLong},
+		{"multibyte_too_long", "/" + strings.Repeat("é", 128), ErrNameTooLong},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := limits.Check(tc.input); !errors.Is(err, tc.want) {
+				t.Errorf("Check: got %v, want %v", err, tc.want)
+			}
+			if _, err := limits.Clean(tc.input); !errors.Is(err, tc.want) {
+				t.Errorf("Clean: got %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	if err := (Limits{}).Check(deep + long + "x"); err != nil {
+		t.Errorf("zero limits: got %v", err)
+	}
+	if _, err := limits.Clean("../x"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Clean(../x): got %v, want ErrInvalid", err)
+	}
+	// "." segments are collapsed before the depth is counted
+	if _, err := limits.Clean(strings.Repeat("./", 100) + "a"); err != nil {
+		t.Errorf("Clean(./.../a): got %v", err)
+	}
+}
+
+func BenchmarkClean(b *testing.B) {
+	testPaths := []string{
+		"/simple/file.txt",
+		"/deep/nested/path/to/file.txt",
+		"/../../etc/passwd",
+		"/dir with spaces/file.txt",
+		"/测试/文件.txt",
+	}
+
+	for b.Loop() {
+		for _, p := range testPaths {
+			_, _ = Clean(p)
+		}
+	}
+}
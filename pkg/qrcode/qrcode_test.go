@@ -0,0 +1,352 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" as 1-M, from the worked example of the standard's tutorial
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(len(want))); !bytes.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestFormatAndVersionInformation(t *testing.T) {
+	formats := map[Level]int{
+		L: 0b111011111000100,
+		M: 0b101010000010010,
+		Q: 0b011010101011111,
+		H: 0b001011010001001,
+	}
+	for level, want := range formats {
+		if got := formatInformation(level, 0); got != want {
+			t.Errorf("level %d mask 0: expected %015b, got %015b", level, want, got)
+		}
+	}
+	if got := versionInformation(7); got != 0b000111110010010100 {
+		t.Errorf("version 7: expected 000111110010010100, got %018b", got)
+	}
+}
+
+func TestLayoutTables(t *testing.T) {
+	alignments := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		14: {6, 26, 46, 66},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	for version, want := range alignments {
+		if got := alignmentPatternPositions(version); !slices.Equal(got, want) {
+			t.Errorf("version %d: expected alignment patterns at %v, got %v", version, want, got)
+		}
+	}
+
+	// Data codewords from the capacity table of the standard
+	capacities := []struct {
+		version int
+		level   Level
+		want    int
+	}{
+		{1, M, 16}, {5, Q, 62}, {7, H, 66}, {10, M, 216}, {10, H, 122}, {27, L, 1468}, {40, L, 2956}, {40, H, 1276},
+	}
+	for _, tc := range capacities {
+		if got := numDataCodewords(tc.version, tc.level); got != tc.want {
+			t.Errorf("%d-%d: expected %d data codewords, got %d", tc.version, tc.level, tc.want, got)
+		}
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		data    string
+		level   Level
+		version int
+	}{
+		{"", M, 1},
+		{"https://example.com/", L, 2},
+		{"http://192.168.1.20:8000/docs/", M, 3},
+		{"http://192.168.1.20:8000/photos/2024/IMG_0001.jpg", Q, 5},
+		{"http://files.example.com/" + strings.Repeat("a/", 60), H, 12},
+		{strings.Repeat("0123456789", 120), M, 29},
+		{strings.Repeat("x", 2953), L, 40},
+	}
+
+	for _, tc := range testCases {
+		code, err := Encode([]byte(tc.data), tc.level)
+		if err != nil {
+			t.Fatalf("Encode(%d bytes) failed: %v", len(tc.data), err)
+		}
+		if code.Version != tc.version || code.Size != tc.version*4+17 {
+			t.Errorf("%d bytes at level %d: expected version %d, got %d (size %d)",
+				len(tc.data), tc.level, tc.version, code.Version, code.Size)
+		}
+
+		image, err := code.PNG(3)
+		if err != nil {
+			t.Fatalf("PNG failed: %v", err)
+		}
+		if got := decodePNG(t, image); got != tc.data {
+			t.Errorf("version %d: decoded %q, expected %q", code.Version, got, tc.data)
+		}
+
+		again, _ := Encode([]byte(tc.data), tc.level)
+		if again.Mask != code.Mask || !slices.EqualFunc(again.modules, code.modules, slices.Equal) {
+			t.Errorf("version %d: expected deterministic output", code.Version)
+		}
+	}
+}
+
+func TestEncode_TooLong(t *testing.T) {
+	if _, err := Encode(make([]byte, 2954), L); !errors.Is(err, ErrTooLong) {
+		t.Errorf("expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	code, err := Encode([]byte("https://example.com/"), M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(code.Terminal(), "\n"), "\n")
+	if want := (code.Size + 4 + 1) / 2; len(lines) != want {
+		t.Errorf("expected %d lines, got %d", want, len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "\x1b[30;47m") || !strings.HasSuffix(line, "\x1b[0m") {
+			t.Fatalf("expected black on white lines, got %q", line)
+		}
+	}
+	// The second line holds the top two module rows of the finder patterns
+	if !strings.Contains(lines[1], "█▀▀▀▀▀█") {
+		t.Errorf("expected the top edge of a finder pattern, got %q", lines[1])
+	}
+}
+
+// decodePNG reads a code rendered by PNG back into its data. It only copes
+// with clean, axis-aligned renderings, but otherwise follows the standard
+// independently of the encoder: format information is BCH checked and every
+// block must have zero Reed-Solomon syndromes.
+func decodePNG(t *testing.T, data []byte) string {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Invalid PNG: %v", err)
+	}
+	dark := func(x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r < 0x8000
+	}
+
+	// The top left finder starts after the quiet zone and is 7 modules wide
+	start := 0
+	for !dark(start, start) {
+		start++
+	}
+	end := start
+	for dark(end, start) {
+		end++
+	}
+	scale := (end - start) / 7
+	size := (img.Bounds().Dx() - 2*start) / scale
+	grid := make([][]bool, size)
+	for y := range grid {
+		grid[y] = make([]bool, size)
+		for x := range grid[y] {
+			grid[y][x] = dark(start+x*scale+scale/2, start+y*scale+scale/2)
+		}
+	}
+	return decodeGrid(t, grid)
+}
+
+func decodeGrid(t *testing.T, grid [][]bool) string {
+	t.Helper()
+	size := len(grid)
+	version := (size - 17) / 4
+	bit := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	// Both copies of the format information must agree and pass the BCH check
+	var first, second int
+	for i := range 15 {
+		var x, y int
+		switch {
+		case i <= 5:
+			x, y = 8, i
+		case i == 6:
+			x, y = 8, 7
+		case i == 7:
+			x, y = 8, 8
+		case i == 8:
+			x, y = 7, 8
+		default:
+			x, y = 14-i, 8
+		}
+		first |= bit(grid[y][x]) << i
+		if i < 8 {
+			second |= bit(grid[8][size-1-i]) << i
+		} else {
+			second |= bit(grid[size-15+i][8]) << i
+		}
+	}
+	if first != second {
+		t.Fatalf("format information copies differ: %015b and %015b", first, second)
+	}
+	format := first ^ 0x5412
+	rem := format
+	for i := 14; i >= 10; i-- {
+		if rem>>i&1 != 0 {
+			rem ^= 0x537 << (i - 10)
+		}
+	}
+	if rem != 0 {
+		t.Fatalf("format information %015b fails the BCH check", first)
+	}
+	level := map[int]Level{1: L, 0: M, 3: Q, 2: H}[format>>13]
+	mask := format >> 10 & 7
+	if !grid[size-8][8] {
+		t.Fatal("missing the dark module")
+	}
+
+	isFunction := func(x, y int) bool {
+		if (x < 9 && y < 9) || (x >= size-8 && y < 9) || (x < 9 && y >= size-8) || x == 6 || y == 6 {
+			return true
+		}
+		if version >= 7 && ((x >= size-11 && x < size-8 && y < 6) || (y >= size-11 && y < size-8 && x < 6)) {
+			return true
+		}
+		positions := alignmentPatternPositions(version)
+		for i, cx := range positions {
+			for j, cy := range positions {
+				last := len(positions) - 1
+				if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+					continue
+				}
+				if abs(x-cx) <= 2 && abs(y-cy) <= 2 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	masks := []func(x, y int) bool{
+		func(x, y int) bool { return (y+x)%2 == 0 },
+		func(x, y int) bool { return y%2 == 0 },
+		func(x, y int) bool { return x%3 == 0 },
+		func(x, y int) bool { return (y+x)%3 == 0 },
+		func(x, y int) bool { return (y/2+x/3)%2 == 0 },
+		func(x, y int) bool { return (y*x)%2+(y*x)%3 == 0 },
+		func(x, y int) bool { return ((y*x)%2+(y*x)%3)%2 == 0 },
+		func(x, y int) bool { return ((y+x)%2+(y*x)%3)%2 == 0 },
+	}
+
+	// Read the codewords in the zigzag order, bottom right first
+	var bits []int
+	for col := size - 1; col > 0; col -= 2 {
+		if col == 6 {
+			col--
+		}
+		for i := range size {
+			y := i
+			if (size-1-col)/2%2 == 0 && col > 6 || (size-2-col)/2%2 == 0 && col < 6 {
+				y = size - 1 - i
+			}
+			for _, x := range []int{col, col - 1} {
+				if !isFunction(x, y) {
+					bits = append(bits, bit(grid[y][x] != masks[mask](x, y)))
+				}
+			}
+		}
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i := range codewords {
+		for _, b := range bits[i*8 : i*8+8] {
+			codewords[i] = codewords[i]<<1 | byte(b)
+		}
+	}
+
+	// De-interleave: short blocks first, one data codeword more in long ones
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	numShort := numBlocks - len(codewords)%numBlocks
+	shortData := len(codewords)/numBlocks - eccLen
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortData; i++ {
+		for j := range blocks {
+			if i < shortData || j >= numShort {
+				blocks[j] = append(blocks[j], codewords[k])
+				k++
+			}
+		}
+	}
+	for range eccLen {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+
+	// Every syndrome of a valid block is zero
+	var exp [255]byte
+	x := 1
+	for i := range exp {
+		exp[i] = byte(x)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	var dataCodewords []byte
+	for j, block := range blocks {
+		for i := range eccLen {
+			var syndrome byte
+			for n, c := range block {
+				power := i * (len(block) - 1 - n) % 255
+				syndrome ^= gfMultiply(c, exp[power])
+			}
+			if syndrome != 0 {
+				t.Fatalf("block %d: syndrome %d is %d", j, i, syndrome)
+			}
+		}
+		dataCodewords = append(dataCodewords, block[:len(block)-eccLen]...)
+	}
+
+	// A single byte mode segment
+	reader := bitReader{data: dataCodewords}
+	if m := reader.read(4); m != 0x4 {
+		t.Fatalf("expected byte mode, got %04b", m)
+	}
+	n := reader.read(charCountBits(version))
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(reader.read(8))
+	}
+	return string(out)
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) int {
+	v := 0
+	for range n {
+		v = v<<1 | int(r.data[r.pos>>3]>>(7-r.pos&7)&1)
+		r.pos++
+	}
+	return v
+}
@@ -0,0 +1,69 @@
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// QuietZone is the light border, in modules, that scanners need around a
+// code.
+const QuietZone = 4
+
+// Image returns the code with its quiet zone, scale pixels per module.
+func (c *Code) Image(scale int) *image.Paletted {
+	scale = max(scale, 1)
+	n := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, n, n), color.Palette{color.White, color.Black})
+	for y := range n {
+		for x := range n {
+			if c.Dark(x/scale-QuietZone, y/scale-QuietZone) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
+
+// PNG returns the code as a PNG image, scale pixels per module.
+func (c *Code) PNG(scale int) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, c.Image(scale)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Terminal returns the code as lines of half-block characters, two module
+// rows per line, in black on white so it scans on dark terminals too.
+func (c *Code) Terminal() string {
+	const (
+		start = "\x1b[30;47m"
+		reset = "\x1b[0m"
+	)
+	// A two-module border is enough on screen and keeps the code compact
+	const border = 2
+	var sb strings.Builder
+	for y := -border; y < c.Size+border; y += 2 {
+		sb.WriteString(start)
+		for x := -border; x < c.Size+border; x++ {
+			top, bottom := c.Dark(x, y), c.Dark(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(reset)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -1,3 +1,10 @@
+// Package zipstream writes ZIP archives to a stream without seeking back.
+//
+// Entries are written with a data descriptor carrying their CRC and sizes,
+// so nothing needs to be known up front. Zip64 records are added wherever
+// the format needs them: in the data descriptor and central directory of an
+// entry of 4GiB or more, for offsets past 4GiB, and in the end of central
+// directory record for archives with 65535 or more entries.
 package zipstream
 
 import (
@@ -9,12 +16,21 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
+// flagUTF8 is general purpose bit 11 (EFS): the entry name is UTF-8.
+const flagUTF8 = 0x800
+
 type Options struct {
 	CompressionLevel uint16
 	MaxSize          int64
 	BufferSize       int
+	// SizeHint returns the expected uncompressed size of an entry, or a
+	// negative value when it is unknown. It defaults to entry.Info.Size() and
+	// is only used to refuse entries that would exceed MaxSize before they
+	// are streamed; MaxSize is enforced on the bytes actually written too.
+	SizeHint func(entry FileEntry) int64
 }
 
 func DefaultOptions() Options {
@@ -84,8 +100,11 @@ func NewWriter(w io.Writer, opts Options) *Writer {
 }
 
 func (zw *Writer) AddFile(entry FileEntry) error {
-	if zw.opts.MaxSize > 0 && zw.written+entry.Info.Size() > zw.opts.MaxSize {
-		return fmt.Errorf("exceeds maximum ZIP size of %d bytes", zw.opts.MaxSize)
+	// Directory entries have no content to count against MaxSize
+	if zw.opts.MaxSize > 0 && !entry.Info.IsDir() {
+		if size := zw.sizeHint(entry); size > 0 && zw.written+size > zw.opts.MaxSize {
+			return fmt.Errorf("exceeds maximum ZIP size of %d bytes", zw.opts.MaxSize)
+		}
 	}
 
 	zw.progress.mu.Lock()
@@ -97,20 +116,28 @@ func (zw *Writer) AddFile(entry FileEntry) error {
 		name = filepath.Base(entry.Path)
 	}
 
+	// Extractors restore mtimes from Modified, written as both an MS-DOS
+	// time and an extended timestamp; entries without one get the current time
+	modified := entry.Info.ModTime()
+	if modified.IsZero() {
+		modified = time.Now()
+	}
 	header := &zip.FileHeader{
 		Name:     name,
-		Modified: entry.Info.ModTime(),
+		Modified: modified,
+		NonUTF8:  !utf8.ValidString(name),
+	}
+	if !header.NonUTF8 && !isASCII(name) {
+		// Without the EFS flag, Windows Explorer decodes names as CP437
+		header.Flags |= flagUTF8
 	}
 
+	// Sizes are left unset: archive/zip ignores them when streaming and
+	// writes the real ones, as Zip64 fields from 4GiB, once the entry is done
 	if entry.Info.IsDir() {
 		header.Name = ensureTrailingSlash(header.Name)
-	} else {
-		// Prevent integer overflow: ensure file size is non-negative before conversion
-		size := entry.Info.Size()
-		if size < 0 {
-			return fmt.Errorf("invalid file size %d for %s: file size cannot be negative", size, entry.Path)
-		}
-		header.UncompressedSize64 = uint64(size)
+	} else if size := entry.Info.Size(); size < 0 {
+		return fmt.Errorf("invalid file size %d for %s: file size cannot be negative", size, entry.Path)
 	}
 
 	header.Method = zw.getCompressionMethod(header.Name)
@@ -152,6 +179,9 @@ func (zw *Writer) AddFile(entry FileEntry) error {
 			}
 			written += int64(nw)
 			zw.written += int64(nw)
+			if zw.opts.MaxSize > 0 && zw.written > zw.opts.MaxSize {
+				return fmt.Errorf("exceeds maximum ZIP size of %d bytes", zw.opts.MaxSize)
+			}
 
 			zw.progress.mu.Lock()
 			zw.progress.ProcessedBytes += int64(nw)
@@ -173,6 +203,13 @@ func (zw *Writer) AddFile(entry FileEntry) error {
 	return nil
 }
 
+func (zw *Writer) sizeHint(entry FileEntry) int64 {
+	if zw.opts.SizeHint != nil {
+		return zw.opts.SizeHint(entry)
+	}
+	return entry.Info.Size()
+}
+
 func (zw *Writer) AddDirectory(basePath string, zipPath string) error {
 	return filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -229,6 +266,15 @@ func (zw *Writer) getCompressionMethod(filename string) uint16 {
 	return zip.Deflate
 }
 
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
 func ensureTrailingSlash(path string) string {
 	if !strings.HasSuffix(path, "/") {
 		return path + "/"
@@ -3,9 +3,11 @@ package zipstream
 import (
 	"archive/zip"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -172,6 +174,175 @@ func TestMaxSizeLimit(t *testing.T) {
 	}
 }
 
+func TestMaxSizeLimit_SizeHint(t *testing.T) {
+	info := mockFileInfo{name: "stream.txt", modTime: time.Now()}
+
+	t.Run("refuses_before_streaming", func(t *testing.T) {
+		w := NewWriter(io.Discard, Options{
+			MaxSize:  100,
+			SizeHint: func(FileEntry) int64 { return 200 },
+		})
+		err := w.AddFile(FileEntry{Name: "stream.txt", Info: info, Reader: io.NopCloser(bytes.NewReader(nil))})
+		if err == nil {
+			t.Error("Expected the size hint to exceed the limit")
+		}
+		if w.written != 0 {
+			t.Errorf("Expected nothing to be streamed, got %d bytes", w.written)
+		}
+	})
+
+	t.Run("enforced_while_streaming", func(t *testing.T) {
+		// Info claims an empty file, but the reader keeps going
+		w := NewWriter(io.Discard, Options{MaxSize: 100, BufferSize: 32})
+		err := w.AddFile(FileEntry{
+			Name:   "stream.txt",
+			Info:   info,
+			Reader: io.NopCloser(bytes.NewReader(make([]byte, 200))),
+		})
+		if err == nil {
+			t.Error("Expected an error once more than MaxSize bytes were written")
+		}
+	})
+}
+
+// zeroReader yields n zero bytes without allocating them.
+type zeroReader struct{ n int64 }
+
+func (z *zeroReader) Read(p []byte) (int, error) {
+	if z.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > z.n {
+		p = p[:z.n]
+	}
+	clear(p)
+	z.n -= int64(len(p))
+	return len(p), nil
+}
+
+func (z *zeroReader) Close() error { return nil }
+
+// writeTempZip streams entries to a file and opens it with archive/zip.
+func writeTempZip(t *testing.T, opts Options, entries []FileEntry) *zip.ReadCloser {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "out.zip")
+	out, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StreamFiles(out, entries, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatalf("Failed to open the archive: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return reader
+}
+
+func TestZip64_LargeEntry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams more than 4GiB")
+	}
+
+	// Deflate keeps the zeros down to a few MiB on disk
+	const size = 1<<32 + 1024
+	entries := []FileEntry{
+		{Name: "before.txt", Info: mockFileInfo{size: 5}, Reader: io.NopCloser(bytes.NewReader([]byte("first")))},
+		{Name: "huge.bin", Info: mockFileInfo{size: size}, Reader: &zeroReader{n: size}},
+		{Name: "after.txt", Info: mockFileInfo{size: 4}, Reader: io.NopCloser(bytes.NewReader([]byte("last")))},
+	}
+	reader := writeTempZip(t, Options{CompressionLevel: zip.Deflate, BufferSize: 1 << 20}, entries)
+
+	if len(reader.File) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(reader.File))
+	}
+	if got := reader.File[1].UncompressedSize64; got != size {
+		t.Errorf("Expected huge.bin to be %d bytes, got %d", int64(size), got)
+	}
+	rc, err := reader.File[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if got, err := io.ReadAll(rc); err != nil || string(got) != "last" {
+		t.Errorf("Expected the entry after the Zip64 one to read back, got %q, %v", got, err)
+	}
+}
+
+func TestZip64_ManyEntries(t *testing.T) {
+	const count = 70000
+	entries := make([]FileEntry, count)
+	for i := range entries {
+		entries[i] = FileEntry{
+			Name:   fmt.Sprintf("dir/file-%05d.txt", i),
+			Info:   mockFileInfo{size: 1},
+			Reader: io.NopCloser(strings.NewReader("x")),
+		}
+	}
+	reader := writeTempZip(t, DefaultOptions(), entries)
+
+	if len(reader.File) != count {
+		t.Fatalf("Expected %d entries, got %d", count, len(reader.File))
+	}
+	if last := reader.File[count-1].Name; last != "dir/file-69999.txt" {
+		t.Errorf("Expected the last entry to be dir/file-69999.txt, got %s", last)
+	}
+}
+
+func TestAddFile_HeaderMetadata(t *testing.T) {
+	modTime := time.Date(2023, 6, 15, 10, 30, 45, 0, time.Local)
+	entry := func(name string, modTime time.Time) FileEntry {
+		return FileEntry{
+			Name:   name,
+			Info:   mockFileInfo{size: 2, modTime: modTime},
+			Reader: io.NopCloser(strings.NewReader("ok")),
+		}
+	}
+	entries := []FileEntry{
+		entry("报告/数据.txt", modTime),
+		entry("plain.txt", modTime),
+		entry("latin1-\xe9.txt", modTime),
+		entry("undated.txt", time.Time{}),
+	}
+
+	var buf bytes.Buffer
+	if err := StreamFiles(&buf, entries, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.File) != len(entries) {
+		t.Fatalf("Expected %d entries, got %d", len(entries), len(reader.File))
+	}
+
+	chinese, plain, latin1, undated := reader.File[0], reader.File[1], reader.File[2], reader.File[3]
+	if chinese.Name != "报告/数据.txt" || chinese.Flags&flagUTF8 == 0 || chinese.NonUTF8 {
+		t.Errorf("Expected a UTF-8 flagged Chinese name, got %q (flags %#x)", chinese.Name, chinese.Flags)
+	}
+	if plain.Flags&flagUTF8 != 0 {
+		t.Errorf("Expected no UTF-8 flag on an ASCII name, got flags %#x", plain.Flags)
+	}
+	if latin1.Flags&flagUTF8 != 0 || !latin1.NonUTF8 {
+		t.Errorf("Expected an invalid UTF-8 name to be marked NonUTF8, got flags %#x", latin1.Flags)
+	}
+
+	for _, f := range []*zip.File{chinese, plain, latin1} {
+		if diff := f.Modified.Sub(modTime).Abs(); diff > time.Second {
+			t.Errorf("%s: expected Modified %v, got %v", f.Name, modTime, f.Modified)
+		}
+	}
+	if time.Since(undated.Modified).Abs() > time.Minute {
+		t.Errorf("Expected an entry without a mtime to get the current time, got %v", undated.Modified)
+	}
+}
+
 func TestProgress(t *testing.T) {
 	var buf bytes.Buffer
 	w := NewWriter(&buf, DefaultOptions())